@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// auditHours lists the commits, pushed and unpushed, that were made outside work hours, on skipped weekdays or on
+// blackout dates, with counts per repository. It changes nothing.
+func (b *batch) auditHours(ctx context.Context, gitRepos iter.Seq[string]) {
+	cfg := b.scheduleConfig()
+	fmt.Printf("Auditing commit times against work hours %02d:00-%02d:00", cfg.WorkDayStartHour, cfg.WorkDayEndHour)
+	if b.SkipWeekDays != "" {
+		fmt.Printf(", skipping %s", b.SkipWeekDays)
+	}
+	if len(cfg.BlackoutDates) > 0 {
+		fmt.Printf(" and %d blackout dates", len(cfg.BlackoutDates))
+	}
+	if region := cfg.Holidays.Code(); region != "" {
+		fmt.Printf(" and the public holidays of %s", region)
+	}
+	if len(b.repoOverrides) > 0 {
+		fmt.Printf(", with the work hours of REPO_OVERRIDES where they match")
+	}
+	fmt.Println("...")
+
+	audited, flaggedRepos, flaggedCommits, flaggedUnpushed := 0, 0, 0, 0
+	for repo := range gitRepos {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Only the commits attributed to you are yours to account for
+		email := b.rewriteOptions(ctx, repo).AuthorEmail
+		if email == "" {
+			if identity, err := git.GetCommitterIdentity(ctx, repo); err == nil {
+				email = identity.Email
+			}
+		}
+		commits, err := git.GetAuthorCommits(ctx, repo, email)
+		if err != nil {
+			fmt.Printf("Warning: Could not check commits for %s: %v\n", repo, err)
+			continue
+		}
+		unpushed := make(map[string]bool)
+		if unpushedCommits, err := git.GetUnpushedCommits(ctx, repo, b.parentBranch(ctx, repo)); err != nil {
+			fmt.Printf("Warning: Could not check unpushed commits for %s: %v\n", repo, err)
+		} else {
+			for _, commit := range unpushedCommits {
+				unpushed[commit.Hash] = true
+			}
+		}
+		audited++
+
+		repoCfg := b.repoScheduleConfig(ctx, repo)
+
+		counts := make(map[cadence.Violation]int)
+		var lines []string
+		for _, commit := range commits {
+			violation, err := repoCfg.CheckTime(commit)
+			if err != nil {
+				fmt.Printf("Warning: Could not parse the time of %s in %s: %v\n", commit.Hash, repo, err)
+				continue
+			}
+			if violation == "" {
+				continue
+			}
+			counts[violation]++
+			state := "pushed"
+			if unpushed[commit.Hash] {
+				state = "unpushed"
+				flaggedUnpushed++
+			}
+			lines = append(lines, fmt.Sprintf("   • %s %s %s, %s [%s]", commit.Hash, commit.DateTime, violation, commit.Subject, state))
+		}
+
+		if len(lines) == 0 {
+			fmt.Printf("✅ %s: All %d commits within work hours\n", repo, len(commits))
+			continue
+		}
+		flaggedRepos++
+		flaggedCommits += len(lines)
+		fmt.Printf("\n⚠️  %s: %d of %d commits outside the schedule (%s)\n", repo, len(lines), len(commits), violationSummary(counts))
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+
+	fmt.Printf("\nSummary: %d commits in %d of %d repositories are outside the schedule, %d of them unpushed\n",
+		flaggedCommits, flaggedRepos, audited, flaggedUnpushed)
+}
+
+// violationSummary counts the commits per violation, e.g. "3 outside work hours, 1 skipped weekday"
+func violationSummary(counts map[cadence.Violation]int) string {
+	var parts []string
+	for _, violation := range []cadence.Violation{cadence.ViolationOutsideHours, cadence.ViolationSkippedDay, cadence.ViolationBlackoutDate, cadence.ViolationHoliday} {
+		if counts[violation] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[violation], violation))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,198 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// createArchive writes a gzip-compressed tar archive of the repository at sourcePath to archivePath, with every entry
+// inside a folder named after the repository. A git directory outside the work tree is stored as its .git directory.
+// When files is not nil, only those files of the work tree are included. A failed archive is removed.
+func createArchive(ctx context.Context, sourcePath string, gitDir string, files []string, manifest Manifest, archivePath string) (Backup, error) {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to create backup of %s: %w", sourcePath, err)
+	}
+
+	err = writeArchive(ctx, file, sourcePath, gitDir, files, manifest)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return Backup{}, fmt.Errorf("failed to create backup of %s: %w", sourcePath, err)
+	}
+
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return Backup{}, err
+	}
+	return Backup{Path: archivePath, Size: info.Size()}, nil
+}
+
+// archiveWriter is a tar writer that counts the work tree files written to it for the manifest
+type archiveWriter struct {
+	*tar.Writer
+	root  string
+	files int
+}
+
+func (w *archiveWriter) WriteHeader(header *tar.Header) error {
+	if header.Typeflag != tar.TypeDir && !strings.HasPrefix(header.Name, w.root+"/.git/") {
+		w.files++
+	}
+	return w.Writer.WriteHeader(header)
+}
+
+// writeArchive writes the tar.gz stream of a repository to w, followed by manifest in its .git directory
+func writeArchive(ctx context.Context, w io.Writer, sourcePath string, gitDir string, files []string, manifest Manifest) error {
+	gz := gzip.NewWriter(w)
+	root := filepath.Base(sourcePath)
+	tw := &archiveWriter{Writer: tar.NewWriter(gz), root: root}
+
+	var err error
+	if files == nil {
+		err = addToArchive(ctx, tw, sourcePath, root, func(rel string) bool {
+			// The .git file pointing at the separate git directory is replaced by the directory itself
+			return gitDir != "" && rel == ".git"
+		})
+		if err == nil && gitDir != "" {
+			err = addToArchive(ctx, tw, gitDir, root+"/.git", nil)
+		}
+	} else {
+		err = addTrackedToArchive(ctx, tw, sourcePath, gitDir, files, root)
+	}
+	if err != nil {
+		return err
+	}
+
+	manifest.Files = tw.files
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	header := &tar.Header{Name: root + "/.git/" + ManifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// addTrackedToArchive adds the git directory and the given work tree files to tw under the name prefix
+func addTrackedToArchive(ctx context.Context, tw *archiveWriter, sourcePath string, gitDir string, files []string, prefix string) error {
+	if gitDir == "" {
+		gitDir = filepath.Join(sourcePath, ".git")
+	}
+	if err := addToArchive(ctx, tw, sourcePath, prefix, func(rel string) bool { return rel != "." }); err != nil {
+		return err
+	}
+	if err := addToArchive(ctx, tw, gitDir, prefix+"/.git", nil); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(sourcePath, filepath.FromSlash(file))
+		info, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) || (err == nil && info.IsDir()) {
+			continue // Deleted from the work tree, or a submodule
+		}
+		if err != nil {
+			return err
+		}
+		if err := addEntry(tw, path, prefix+"/"+file, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addToArchive adds dir and everything below it to tw under the name prefix. skip, when set, is called with the
+// slash-separated path of every entry relative to dir.
+func addToArchive(ctx context.Context, tw *archiveWriter, dir string, prefix string, skip func(rel string) bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if skip != nil && skip(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name := prefix
+		if rel != "." {
+			name = prefix + "/" + rel
+		}
+		return addEntry(tw, path, name, info)
+	})
+}
+
+// addEntry writes the file, directory or symlink at path to tw as name
+func addEntry(tw *archiveWriter, path string, name string, info fs.FileInfo) error {
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	} else if !info.Mode().IsRegular() && !info.IsDir() {
+		return nil // Sockets, pipes and devices have no place in a backup
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name = strings.TrimSuffix(name, "/") + "/"
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tw, file)
+	return err
+}
@@ -0,0 +1,314 @@
+// Package backup creates copies of repositories before their history is rewritten.
+package backup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// FolderPattern is the pattern used to identify backup folders created by this tool
+const FolderPattern = ".backup-"
+
+// IsBackupFolder checks if a git repository path matches the backup folder pattern
+func IsBackupFolder(repoPath string) bool {
+	baseName := filepath.Base(repoPath)
+	return strings.Contains(baseName, FolderPattern)
+}
+
+// Format is how a backup is stored
+type Format string
+
+const (
+	// FormatCopy copies the repository directory as it is. This is the default.
+	FormatCopy Format = "copy"
+	// FormatTarGz writes a gzip-compressed tar archive, which takes far less space than a copy
+	FormatTarGz Format = "tar.gz"
+)
+
+// Options controls how backups are created
+type Options struct {
+	// Format is how the backup is stored; empty means FormatCopy
+	Format Format
+	// Dir is the directory backups are created in, which is created when missing. Empty puts every backup next
+	// to its repository.
+	Dir string
+	// TrackedOnly leaves out untracked and ignored files, such as dependencies and build output, and only backs up
+	// the tracked files and the git directory. That is all a rewrite can change.
+	TrackedOnly bool
+}
+
+// Backup is a backup that was created
+type Backup struct {
+	// Path is the backup folder or archive
+	Path string
+	// Size is the number of bytes the backup takes on disk
+	Size int64
+}
+
+// Create creates a timestamped backup of a repository, next to it or in opts.Dir.
+// If the repository's git directory lives outside the work tree (--separate-git-dir), it is stored in
+// the backup as a regular .git directory so the backup doesn't share history with the original.
+func Create(ctx context.Context, sourcePath string, opts Options) (Backup, error) {
+	// Generate timestamp for backup folder name
+	now := time.Now()
+	timestamp := now.Format("2006-01-02-15-04-05")
+	backupPath := fmt.Sprintf("%s%s%s", sourcePath, FolderPattern, timestamp)
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+			return Backup{}, fmt.Errorf("failed to create backup directory %s: %w", opts.Dir, err)
+		}
+		backupPath = uniquePath(filepath.Join(opts.Dir, filepath.Base(sourcePath)+FolderPattern+timestamp), opts.Format)
+	}
+
+	gitDir, err := git.GetGitDir(ctx, sourcePath)
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to create backup of %s: %w", sourcePath, err)
+	}
+	if isWithin(gitDir, sourcePath) {
+		gitDir = ""
+	}
+
+	var files []string
+	if opts.TrackedOnly {
+		if files, err = git.GetTrackedFiles(ctx, sourcePath); err != nil {
+			return Backup{}, fmt.Errorf("failed to create backup of %s: %w", sourcePath, err)
+		}
+	}
+
+	manifest := newManifest(ctx, sourcePath, now, opts.TrackedOnly)
+	if opts.Format == FormatTarGz {
+		return createArchive(ctx, sourcePath, gitDir, files, manifest, backupPath+".tar.gz")
+	}
+
+	if opts.TrackedOnly {
+		if err := copyTracked(ctx, sourcePath, gitDir, files, backupPath); err != nil {
+			os.RemoveAll(backupPath)
+			return Backup{}, fmt.Errorf("failed to create backup of %s: %w", sourcePath, err)
+		}
+	} else if err := copyDir(ctx, sourcePath, backupPath); err != nil {
+		return Backup{}, fmt.Errorf("failed to create backup of %s: %w", sourcePath, err)
+	}
+
+	if gitDir != "" && !opts.TrackedOnly {
+		backupGitDir := filepath.Join(backupPath, ".git")
+		if err := os.Remove(backupGitDir); err != nil {
+			return Backup{}, fmt.Errorf("failed to replace .git file in backup %s: %w", backupPath, err)
+		}
+		if err := copyDir(ctx, gitDir, backupGitDir); err != nil {
+			return Backup{}, fmt.Errorf("failed to back up git directory %s: %w", gitDir, err)
+		}
+	}
+
+	if manifest.Files, err = countFiles(ctx, backupPath); err != nil {
+		return Backup{}, fmt.Errorf("failed to count files in backup %s: %w", backupPath, err)
+	}
+	if err := writeManifest(backupPath, manifest); err != nil {
+		return Backup{}, fmt.Errorf("failed to write manifest of backup %s: %w", backupPath, err)
+	}
+
+	size, err := Size(ctx, backupPath, 0)
+	if err != nil {
+		return Backup{}, err
+	}
+	return Backup{Path: backupPath, Size: size}, nil
+}
+
+// uniquePath returns backupPath, or backupPath with a counter when a backup of another repository with the same name
+// was made there in the same second
+func uniquePath(backupPath string, format Format) string {
+	suffix := ""
+	if format == FormatTarGz {
+		suffix = ".tar.gz"
+	}
+	candidate := backupPath
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(candidate + suffix); errors.Is(err, os.ErrNotExist) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", backupPath, i)
+	}
+}
+
+// List returns the backups Create made of a repository, next to it or in dir, oldest first. Backups in dir are
+// found by the repository's directory name, so they include those of other repositories with the same name. A
+// missing dir has no backups.
+func List(repoPath string, dir string) ([]string, error) {
+	prefix := filepath.Base(repoPath) + FolderPattern
+	var backups []string
+	for _, parent := range []string{filepath.Dir(repoPath), dir} {
+		if parent == "" {
+			continue
+		}
+		entries, err := os.ReadDir(parent)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups of %s: %w", repoPath, err)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), prefix) {
+				backups = append(backups, filepath.Join(parent, entry.Name()))
+			}
+		}
+	}
+	// The timestamp in the name sorts them by age, and dir may be the repository's parent directory
+	slices.SortFunc(backups, func(a, b string) int {
+		return cmp.Or(strings.Compare(filepath.Base(a), filepath.Base(b)), strings.Compare(a, b))
+	})
+	return slices.Compact(backups), nil
+}
+
+// Size returns the number of bytes Create would copy for a repository: every file in its work tree and in its git
+// directory. Counting stops as soon as the total exceeds limit, so checking a huge repository against a limit stays
+// quick; a limit of 0 counts everything.
+func Size(ctx context.Context, sourcePath string, limit int64) (int64, error) {
+	dirs := []string{sourcePath}
+	if gitDir, err := git.GetGitDir(ctx, sourcePath); err == nil && !isWithin(gitDir, sourcePath) {
+		dirs = append(dirs, gitDir)
+	}
+
+	var total int64
+	errLimit := errors.New("limit exceeded")
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+			if limit > 0 && total > limit {
+				return errLimit
+			}
+			return nil
+		})
+		if errors.Is(err, errLimit) {
+			return total, nil
+		}
+		if err != nil {
+			return total, fmt.Errorf("failed to measure %s: %w", dir, err)
+		}
+	}
+	return total, nil
+}
+
+// copyTracked copies the git directory and the tracked files of a repository to backupPath. gitDir is empty when
+// the git directory is the .git directory of the work tree.
+func copyTracked(ctx context.Context, sourcePath string, gitDir string, files []string, backupPath string) error {
+	if gitDir == "" {
+		gitDir = filepath.Join(sourcePath, ".git")
+	}
+	if err := os.MkdirAll(backupPath, 0755); err != nil {
+		return err
+	}
+	if err := copyDir(ctx, gitDir, filepath.Join(backupPath, ".git")); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.Join(sourcePath, filepath.FromSlash(file)), filepath.Join(backupPath, filepath.FromSlash(file))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies a regular file or symlink, creating the parent directories of dst. Files deleted from the work
+// tree and submodules, which are directories, are skipped.
+func copyFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyDir copies a directory recursively, keeping symlinks and file permissions. Sockets and other special files,
+// like the one of git's fsmonitor daemon, are skipped. It doesn't shell out to cp, which Windows doesn't have.
+func copyDir(ctx context.Context, src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		return copyFile(path, filepath.Join(dst, rel))
+	})
+}
+
+// isWithin reports whether path is dir or inside it, comparing resolved paths
+func isWithin(path, dir string) bool {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,448 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIsBackupFolder(t *testing.T) {
+	tests := []struct {
+		name     string
+		repoPath string
+		expected bool
+	}{
+		{
+			name:     "regular repository path",
+			repoPath: "/path/to/my-repo",
+			expected: false,
+		},
+		{
+			name:     "backup folder with timestamp",
+			repoPath: "/path/to/my-repo.backup-2024-01-15-14-30-45",
+			expected: true,
+		},
+		{
+			name:     "backup folder in nested path",
+			repoPath: "/home/user/workspace/project.backup-2024-01-15-14-30-45",
+			expected: true,
+		},
+		{
+			name:     "folder with backup in middle of name",
+			repoPath: "/path/to/my-backup-repo",
+			expected: false,
+		},
+		{
+			name:     "folder ending with backup pattern",
+			repoPath: "/path/to/something.backup-",
+			expected: true,
+		},
+		{
+			name:     "folder with backup pattern but no timestamp",
+			repoPath: "/path/to/repo.backup",
+			expected: false,
+		},
+		{
+			name:     "empty path",
+			repoPath: "",
+			expected: false,
+		},
+		{
+			name:     "just backup pattern",
+			repoPath: ".backup-2024-01-15",
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := IsBackupFolder(tt.repoPath)
+			if result != tt.expected {
+				t.Errorf("IsBackupFolder(%q) = %v, expected %v", tt.repoPath, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCreateSeparateGitDir(t *testing.T) {
+	ctx := context.Background()
+	parent := t.TempDir()
+	workTree := filepath.Join(parent, "repo")
+	separateGitDir := filepath.Join(t.TempDir(), "repo.git")
+
+	cmd := exec.Command("git", "init", "--quiet", "--separate-git-dir", separateGitDir, workTree)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\nOutput: %s", err, output)
+	}
+
+	created, err := Create(ctx, workTree, Options{})
+	if err != nil {
+		t.Fatalf("Error creating backup: %v", err)
+	}
+	backupPath := created.Path
+
+	// The backup must carry its own git directory instead of pointing at the original one
+	info, err := os.Lstat(filepath.Join(backupPath, ".git"))
+	if err != nil {
+		t.Fatalf("Backup has no .git: %v", err)
+	}
+	if !info.IsDir() {
+		t.Error("Expected backup .git to be a directory")
+	}
+	if _, err := os.Stat(filepath.Join(backupPath, ".git", "HEAD")); err != nil {
+		t.Errorf("Expected git directory contents in backup: %v", err)
+	}
+}
+
+func TestCreateInDir(t *testing.T) {
+	ctx := context.Background()
+	backupDir := filepath.Join(t.TempDir(), "backups")
+
+	// Two repositories with the same name, backed up within the same second
+	var paths []string
+	for _, parent := range []string{t.TempDir(), t.TempDir()} {
+		repo := filepath.Join(parent, "api")
+		if output, err := exec.Command("git", "init", "--quiet", repo).CombinedOutput(); err != nil {
+			t.Fatalf("git init failed: %v\nOutput: %s", err, output)
+		}
+		created, err := Create(ctx, repo, Options{Dir: backupDir})
+		if err != nil {
+			t.Fatalf("Error creating backup: %v", err)
+		}
+		if filepath.Dir(created.Path) != backupDir || !IsBackupFolder(created.Path) {
+			t.Errorf("Expected a backup folder in %s, got %s", backupDir, created.Path)
+		}
+		if matches, _ := filepath.Glob(repo + FolderPattern + "*"); len(matches) > 0 {
+			t.Errorf("Expected nothing next to the repository, got %v", matches)
+		}
+		paths = append(paths, created.Path)
+	}
+	if paths[0] == paths[1] {
+		t.Errorf("Expected separate backups, both went to %s", paths[0])
+	}
+}
+
+func TestList(t *testing.T) {
+	workspace, backupDir := t.TempDir(), filepath.Join(t.TempDir(), "backups")
+	repo := filepath.Join(workspace, "api")
+	for _, path := range []string{
+		repo,
+		repo + FolderPattern + "2024-01-09-10-00-00",
+		filepath.Join(workspace, "api-gateway"+FolderPattern+"2024-01-09-10-00-00"),
+		filepath.Join(backupDir, "api"+FolderPattern+"2024-01-08-10-00-00"),
+	} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(backupDir, "api"+FolderPattern+"2024-01-10-10-00-00.tar.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := List(repo, backupDir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	expected := []string{
+		filepath.Join(backupDir, "api"+FolderPattern+"2024-01-08-10-00-00"),
+		repo + FolderPattern + "2024-01-09-10-00-00",
+		filepath.Join(backupDir, "api"+FolderPattern+"2024-01-10-10-00-00.tar.gz"),
+	}
+	if !slices.Equal(backups, expected) {
+		t.Errorf("Expected %v, got %v", expected, backups)
+	}
+
+	// Listing the repository's own directory as BACKUP_DIR doesn't count its backups twice, and a missing directory
+	// has none
+	if backups, err := List(repo, workspace); err != nil || len(backups) != 1 {
+		t.Errorf("Expected 1 backup, got %v (%v)", backups, err)
+	}
+	if backups, err := List(repo, filepath.Join(workspace, "missing")); err != nil || len(backups) != 1 {
+		t.Errorf("Expected 1 backup, got %v (%v)", backups, err)
+	}
+}
+
+func TestCreateArchive(t *testing.T) {
+	ctx := context.Background()
+	parent := t.TempDir()
+	workTree := filepath.Join(parent, "repo")
+	separateGitDir := filepath.Join(t.TempDir(), "repo.git")
+
+	cmd := exec.Command("git", "init", "--quiet", "--separate-git-dir", separateGitDir, workTree)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\nOutput: %s", err, output)
+	}
+	os.WriteFile(filepath.Join(workTree, "main.go"), []byte("package main\n"), 0644)
+	symlink(t, "main.go", filepath.Join(workTree, "link.go"))
+
+	created, err := Create(ctx, workTree, Options{Format: FormatTarGz})
+	if err != nil {
+		t.Fatalf("Error creating backup: %v", err)
+	}
+	if !strings.HasSuffix(created.Path, ".tar.gz") || !IsBackupFolder(created.Path) {
+		t.Errorf("Unexpected archive path %s", created.Path)
+	}
+	if info, err := os.Stat(created.Path); err != nil || info.Size() != created.Size {
+		t.Errorf("Expected the reported size to match the archive, got %d and %v", created.Size, err)
+	}
+
+	entries := archiveEntries(t, created.Path)
+
+	// The separate git directory is stored as the repository's .git directory
+	if entries["repo/.git/"] == nil || entries["repo/.git/HEAD"] == nil {
+		t.Errorf("Expected the git directory in the archive, got %v", slices.Sorted(maps.Keys(entries)))
+	}
+	if entries["repo/main.go"] == nil {
+		t.Errorf("Expected the work tree in the archive, got %v", slices.Sorted(maps.Keys(entries)))
+	}
+	if link := entries["repo/link.go"]; link == nil || link.Typeflag != tar.TypeSymlink || link.Linkname != "main.go" {
+		t.Errorf("Expected the symlink to be kept, got %+v", link)
+	}
+}
+
+// archiveEntries reads the headers of a tar.gz archive, keyed by name
+func archiveEntries(t *testing.T, path string) map[string]*tar.Header {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening archive: %v", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Error reading archive: %v", err)
+	}
+	entries := map[string]*tar.Header{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("Error reading archive: %v", err)
+		}
+		entries[header.Name] = header
+	}
+}
+
+func TestCreateTrackedOnly(t *testing.T) {
+	ctx := context.Background()
+	repo := filepath.Join(t.TempDir(), "repo")
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, output)
+		}
+	}
+	if output, err := exec.Command("git", "init", "--quiet", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\nOutput: %s", err, output)
+	}
+	os.WriteFile(filepath.Join(repo, ".gitignore"), []byte("node_modules/\n"), 0644)
+	os.MkdirAll(filepath.Join(repo, "src"), 0755)
+	os.WriteFile(filepath.Join(repo, "src", "main.go"), []byte("package main\n"), 0644)
+	git("add", ".")
+	git("commit", "--quiet", "-m", "Initial commit")
+	os.MkdirAll(filepath.Join(repo, "node_modules", "left-pad"), 0755)
+	os.WriteFile(filepath.Join(repo, "node_modules", "left-pad", "index.js"), []byte("module.exports = 1\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "notes.txt"), []byte("untracked\n"), 0644)
+
+	created, err := Create(ctx, repo, Options{TrackedOnly: true})
+	if err != nil {
+		t.Fatalf("Error creating backup: %v", err)
+	}
+	for _, kept := range []string{".gitignore", "src/main.go", ".git/HEAD"} {
+		if _, err := os.Stat(filepath.Join(created.Path, kept)); err != nil {
+			t.Errorf("Expected %s in the backup: %v", kept, err)
+		}
+	}
+	for _, left := range []string{"node_modules", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(created.Path, left)); err == nil {
+			t.Errorf("Expected %s to be left out of the backup", left)
+		}
+	}
+
+	// The backup is a working repository
+	if output, err := exec.Command("git", "-C", created.Path, "status", "--porcelain").CombinedOutput(); err != nil || len(output) > 0 {
+		t.Errorf("Expected a clean backup, got %q, %v", output, err)
+	}
+
+	archive, err := Create(ctx, repo, Options{Format: FormatTarGz, TrackedOnly: true})
+	if err != nil {
+		t.Fatalf("Error creating archive: %v", err)
+	}
+	entries := archiveEntries(t, archive.Path)
+	if entries["repo/src/main.go"] == nil || entries["repo/.git/HEAD"] == nil || entries["repo/node_modules/"] != nil || entries["repo/notes.txt"] != nil {
+		t.Errorf("Expected only the tracked files and the git directory in the archive, got %v", slices.Sorted(maps.Keys(entries)))
+	}
+}
+
+func TestSize(t *testing.T) {
+	ctx := context.Background()
+	repo := filepath.Join(t.TempDir(), "repo")
+	if output, err := exec.Command("git", "init", "--quiet", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\nOutput: %s", err, output)
+	}
+	empty, err := Size(ctx, repo, 0)
+	if err != nil {
+		t.Fatalf("Error measuring repository: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(repo, "large.bin"), make([]byte, 1<<20), 0644)
+	size, err := Size(ctx, repo, 0)
+	if err != nil {
+		t.Fatalf("Error measuring repository: %v", err)
+	}
+	if size != empty+1<<20 {
+		t.Errorf("Expected %d bytes, got %d", empty+1<<20, size)
+	}
+
+	// Counting stops once the limit is exceeded
+	if size, err := Size(ctx, repo, 1); err != nil || size <= 1 || size > empty+1<<20 {
+		t.Errorf("Expected a total just over the limit, got %d, %v", size, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	repo := filepath.Join(t.TempDir(), "repo")
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	if output, err := exec.Command("git", "init", "--quiet", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\nOutput: %s", err, output)
+	}
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0644)
+	symlink(t, "main.go", filepath.Join(repo, "link.go"))
+	git(repo, "add", ".")
+	git(repo, "commit", "--quiet", "-m", "Initial commit")
+	head := git(repo, "rev-parse", "HEAD")
+
+	for _, format := range []Format{FormatCopy, FormatTarGz} {
+		t.Run(string(format), func(t *testing.T) {
+			created, err := Create(ctx, repo, Options{Format: format, Dir: t.TempDir()})
+			if err != nil {
+				t.Fatalf("Error creating backup: %v", err)
+			}
+			v, err := Verify(ctx, created.Path)
+			if err != nil {
+				t.Fatalf("Error verifying backup: %v", err)
+			}
+			if !v.OK() || v.Head != head || v.Files != 2 {
+				t.Errorf("Expected a restorable backup at %s with 2 files, got %+v", head, v)
+			}
+			if v.Manifest == nil || v.Manifest.Source != repo || v.Manifest.Head != head || v.Manifest.Files != 2 {
+				t.Errorf("Expected the manifest to record the repository, got %+v", v.Manifest)
+			}
+		})
+	}
+
+	t.Run("damaged", func(t *testing.T) {
+		created, err := Create(ctx, repo, Options{Dir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("Error creating backup: %v", err)
+		}
+		os.Remove(filepath.Join(created.Path, "main.go"))
+		objects, _ := filepath.Glob(filepath.Join(created.Path, ".git", "objects", "??", "*"))
+		for _, object := range objects {
+			os.Remove(object)
+		}
+
+		v, err := Verify(ctx, created.Path)
+		if err != nil {
+			t.Fatalf("Error verifying backup: %v", err)
+		}
+		if v.OK() {
+			t.Fatal("Expected a damaged backup to fail verification")
+		}
+		problems := strings.Join(v.Problems, "\n")
+		if !strings.Contains(problems, "fsck") || !strings.Contains(problems, "1 files, but 2 were backed up") {
+			t.Errorf("Expected fsck and file count problems, got %q", problems)
+		}
+	})
+
+	t.Run("moved HEAD", func(t *testing.T) {
+		created, err := Create(ctx, repo, Options{Dir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("Error creating backup: %v", err)
+		}
+		git(created.Path, "commit", "--quiet", "--allow-empty", "-m", "Later commit")
+
+		v, err := Verify(ctx, created.Path)
+		if err != nil {
+			t.Fatalf("Error verifying backup: %v", err)
+		}
+		if len(v.Problems) != 1 || !strings.Contains(v.Problems[0], "but "+head[:7]+" was recorded") {
+			t.Errorf("Expected a HEAD mismatch, got %q", v.Problems)
+		}
+	})
+
+	t.Run("bundle", func(t *testing.T) {
+		bundle := filepath.Join(t.TempDir(), "repo.bundle")
+		git(repo, "bundle", "create", "--quiet", bundle, "HEAD", "--all")
+
+		v, err := Verify(ctx, bundle)
+		if err != nil {
+			t.Fatalf("Error verifying bundle: %v", err)
+		}
+		if !v.OK() || v.Head != head || v.Files != 2 || v.Manifest != nil {
+			t.Errorf("Expected a restorable bundle at %s with 2 files, got %+v", head, v)
+		}
+
+		truncated := filepath.Join(t.TempDir(), "truncated.bundle")
+		data, _ := os.ReadFile(bundle)
+		os.WriteFile(truncated, data[:len(data)/2], 0644)
+		if v, err := Verify(ctx, truncated); err != nil || v.OK() {
+			t.Errorf("Expected a truncated bundle to fail verification, got %+v, %v", v, err)
+		}
+	})
+}
+
+func TestExtractArchiveThroughSymlink(t *testing.T) {
+	outside := t.TempDir()
+	archivePath := filepath.Join(t.TempDir(), "repo.backup.tar.gz")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "repo/", Typeflag: tar.TypeDir, Mode: 0755})
+	tw.WriteHeader(&tar.Header{Name: "repo/link", Typeflag: tar.TypeSymlink, Linkname: outside})
+	content := []byte("escaped\n")
+	tw.WriteHeader(&tar.Header{Name: "repo/link/file", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+	file.Close()
+
+	_, err = extractArchive(context.Background(), archivePath, t.TempDir())
+	if err == nil {
+		t.Error("Expected an entry below an extracted symlink to be refused")
+	}
+	if _, statErr := os.Stat(filepath.Join(outside, "file")); statErr == nil {
+		t.Errorf("Expected nothing to be written outside the extraction directory (%v)", err)
+	}
+}
+
+// symlink creates newname as a symlink to oldname, skipping the test where symlinks can't be created, as on Windows
+// without Developer Mode
+func symlink(t *testing.T, oldname, newname string) {
+	t.Helper()
+	if err := os.Symlink(oldname, newname); err != nil {
+		t.Skipf("Symlinks unavailable: %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// ManifestName is the file in the git directory of a backup that records what was backed up. Keeping it in the git
+// directory leaves the work tree exactly as it was.
+const ManifestName = "code-cadence-backup.json"
+
+// Manifest records the state of a repository when it was backed up, so Verify can tell a complete backup from a
+// damaged one
+type Manifest struct {
+	// Source is the repository that was backed up
+	Source string `json:"source"`
+	// CreatedAt is when the backup was made
+	CreatedAt time.Time `json:"created_at"`
+	// Head is the commit checked out at the time; empty for a repository without commits
+	Head string `json:"head,omitempty"`
+	// Files is the number of files and symlinks in the backed up work tree
+	Files int `json:"files"`
+	// TrackedOnly is set when untracked and ignored files were left out
+	TrackedOnly bool `json:"tracked_only,omitempty"`
+}
+
+// newManifest records the current HEAD of the repository at sourcePath
+func newManifest(ctx context.Context, sourcePath string, createdAt time.Time, trackedOnly bool) Manifest {
+	// A repository without commits has no HEAD to record
+	head, _ := git.GetHeadCommit(ctx, sourcePath)
+	return Manifest{Source: sourcePath, CreatedAt: createdAt, Head: head, TrackedOnly: trackedOnly}
+}
+
+// writeManifest writes manifest to the git directory of the backup folder at backupPath
+func writeManifest(backupPath string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(backupPath, ".git", ManifestName), append(data, '\n'), 0644)
+}
+
+// readManifest reads the manifest of the backup folder at backupPath. It returns nil without an error for backups
+// made before manifests were recorded.
+func readManifest(backupPath string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(backupPath, ".git", ManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestName, err)
+	}
+	return &manifest, nil
+}
+
+// countFiles returns the number of files and symlinks in the work tree at dir, leaving out its .git directory
+func countFiles(ctx context.Context, dir string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && filepath.Dir(path) == dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() || d.Type()&fs.ModeSymlink != 0 {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Verification is the outcome of checking a backup
+type Verification struct {
+	// Path is the backup that was checked
+	Path string
+	// Manifest is what was recorded when the backup was made; nil for bundles and for backups made before
+	// manifests were recorded
+	Manifest *Manifest
+	// Head is the commit the restored backup has checked out
+	Head string
+	// Files is the number of files and symlinks in the restored work tree
+	Files int
+	// Problems lists every check that failed; a backup without problems can be restored
+	Problems []string
+}
+
+// OK reports whether every check passed
+func (v Verification) OK() bool {
+	return len(v.Problems) == 0
+}
+
+func (v *Verification) problem(format string, args ...any) {
+	v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+}
+
+// IsBackup reports whether path looks like a backup Verify can check: a backup folder, a tar.gz backup or a git
+// bundle
+func IsBackup(path string) bool {
+	return IsBackupFolder(path) || strings.HasSuffix(path, ".bundle")
+}
+
+// Verify checks that the backup at path, a backup folder, a tar.gz backup or a git bundle, can be restored:
+// git fsck passes, HEAD is the commit recorded when the backup was made and the work tree holds as many files as
+// were backed up. Archives and bundles are restored to a temporary directory first. Failed checks are reported in
+// Problems; the error is only set when the checks could not be run at all.
+func Verify(ctx context.Context, path string) (Verification, error) {
+	v := Verification{Path: path}
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"):
+		tmp, err := os.MkdirTemp("", "code-cadence-verify-*")
+		if err != nil {
+			return v, err
+		}
+		defer os.RemoveAll(tmp)
+		root, err := extractArchive(ctx, path, tmp)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return v, ctxErr
+			}
+			v.problem("archive can't be extracted: %v", err)
+			return v, nil
+		}
+		return v, verifyManifestFolder(ctx, root, &v)
+
+	case strings.HasSuffix(path, ".bundle"):
+		tmp, err := os.MkdirTemp("", "code-cadence-verify-*")
+		if err != nil {
+			return v, err
+		}
+		defer os.RemoveAll(tmp)
+		clone := filepath.Join(tmp, "repo")
+		if err := git.CloneBundle(ctx, path, clone); err != nil {
+			v.problem("%v", err)
+			return v, ctx.Err()
+		}
+		// A bundle has no manifest, but records its HEAD, and its checkout must hold every tracked file
+		head, err := git.GetBundleHead(ctx, path)
+		if err != nil {
+			v.problem("%v", err)
+			return v, ctx.Err()
+		}
+		tracked, err := git.GetTrackedFiles(ctx, clone)
+		if err != nil {
+			v.problem("%v", err)
+			return v, ctx.Err()
+		}
+		return v, verifyFolder(ctx, clone, &Manifest{Head: head, Files: len(tracked)}, &v)
+
+	default:
+		return v, verifyManifestFolder(ctx, path, &v)
+	}
+}
+
+// verifyManifestFolder checks a restored backup folder against the manifest stored in it
+func verifyManifestFolder(ctx context.Context, dir string, v *Verification) error {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		v.problem("%v", err)
+	}
+	v.Manifest = manifest
+	return verifyFolder(ctx, dir, manifest, v)
+}
+
+// verifyFolder runs the checks against a restored backup folder. Without a manifest, only git fsck and HEAD are checked.
+func verifyFolder(ctx context.Context, dir string, manifest *Manifest, v *Verification) error {
+	if err := git.Fsck(ctx, dir); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		v.problem("%v", err)
+	}
+
+	head, err := git.GetHeadCommit(ctx, dir)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	v.Head = head
+	switch {
+	case err != nil && (manifest == nil || manifest.Head != ""):
+		v.problem("%v", err)
+	case manifest != nil && head != manifest.Head:
+		v.problem("HEAD is %s, but %s was recorded", shortHash(head), shortHash(manifest.Head))
+	}
+
+	files, err := countFiles(ctx, dir)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		v.problem("failed to count files: %v", err)
+		return nil
+	}
+	v.Files = files
+	if manifest != nil && files != manifest.Files {
+		v.problem("%d files, but %d were backed up", files, manifest.Files)
+	}
+	return nil
+}
+
+// extractArchive extracts a tar.gz backup into dir and returns the repository folder it contains
+func extractArchive(ctx context.Context, archivePath string, dir string) (string, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return "", err
+	}
+	tr := tar.NewReader(gz)
+
+	root := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if !filepath.IsLocal(name) {
+			return "", fmt.Errorf("entry %q is outside the archive", header.Name)
+		}
+		top, _, _ := strings.Cut(filepath.ToSlash(name), "/")
+		if root == "" {
+			root = top
+		} else if top != root {
+			return "", fmt.Errorf("entry %q is outside the repository folder %s", header.Name, root)
+		}
+
+		// Symlinks are extracted as they are, so an entry below one would be written wherever it points
+		if link := insideSymlink(dir, name); link != "" {
+			return "", fmt.Errorf("entry %q is inside the symlink %s", header.Name, filepath.ToSlash(link))
+		}
+
+		target := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				err = os.Symlink(header.Linkname, target)
+			}
+		case tar.TypeReg:
+			err = extractFile(tr, target, header.FileInfo().Mode().Perm())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if root == "" {
+		return "", errors.New("archive is empty")
+	}
+	return filepath.Join(dir, root), nil
+}
+
+// insideSymlink returns the first parent directory of name, relative to dir, that has been extracted as a symlink;
+// empty when there is none. The extracted files are checked rather than the entry names, so a differently cased name
+// on a case-insensitive filesystem can't get past it.
+func insideSymlink(dir string, name string) string {
+	parent := ""
+	for _, part := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if part == "." {
+			break
+		}
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(filepath.Join(dir, parent))
+		if err != nil {
+			// Nothing has been extracted below a path that doesn't exist yet
+			return ""
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return parent
+		}
+	}
+	return ""
+}
+
+// extractFile writes the current entry of tr to path
+func extractFile(tr *tar.Reader, path string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, tr); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// shortHash abbreviates a commit hash for messages
+func shortHash(hash string) string {
+	if hash == "" {
+		return "no commit"
+	}
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
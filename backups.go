@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/egor-markin/code-cadence/backup"
+)
+
+// backupJob gets a repository ready for its rewrite: the checks that leave it alone, then its backup when
+// CREATE_BACKUP is on. backupAhead runs jobs ahead of the rewrite, so done is closed once the job has finished.
+type backupJob struct {
+	repo string
+	done chan struct{}
+	// output collects what the job prints, which runCadence flushes once the job's repository is next
+	output repoOutput
+
+	// backupFolder is set for a backup created by an earlier run, which is never rewritten
+	backupFolder bool
+	// tooLarge is set for a repository over MAX_REPO_SIZE_MB
+	tooLarge  error
+	backup    backup.Backup
+	backupErr error
+}
+
+func newBackupJob(repo string) *backupJob {
+	return &backupJob{repo: repo, done: make(chan struct{})}
+}
+
+// run checks the repository and backs it up with the settings s
+func (job *backupJob) run(ctx context.Context, s *settings) {
+	defer close(job.done)
+
+	if backup.IsBackupFolder(job.repo) {
+		job.backupFolder = true
+		return
+	}
+	// MAX_REPO_SIZE_MB keeps the backup of a huge repository from filling the disk
+	if job.tooLarge = s.checkRepoSize(ctx, job.repo, &job.output); job.tooLarge != nil {
+		return
+	}
+	if s.CreateBackup {
+		job.backup, job.backupErr = backup.Create(ctx, job.repo, s.backupOptions())
+	}
+}
+
+// backupAhead yields a job for every repository, in order. With CREATE_BACKUP the jobs run BACKUP_WORKERS at a time
+// ahead of the caller, so the backups of the next repositories are made while the current one is rewritten; the
+// caller waits for done before using a job. Jobs are no longer started once stop is done, but those already
+// running always finish, since an interrupted backup is worse than none. What the STREAM_SCAN stages print while
+// the repositories are walked ahead is held back with the job of the next repository.
+func (b *batch) backupAhead(ctx context.Context, stop context.Context, gitRepos iter.Seq[string]) iter.Seq[*backupJob] {
+	return func(yield func(*backupJob) bool) {
+		if !b.CreateBackup || b.BackupWorkers <= 1 {
+			for repo := range gitRepos {
+				job := newBackupJob(repo)
+				if stop.Err() == nil {
+					job.run(ctx, b.settings)
+				} else {
+					close(job.done)
+				}
+				if !yield(job) {
+					return
+				}
+			}
+			return
+		}
+
+		// The buffer bounds how far ahead of the rewrite the scan and the backups run
+		jobs := make(chan *backupJob, b.BackupWorkers)
+		slots := make(chan struct{}, b.BackupWorkers)
+		quit := make(chan struct{})
+		var running sync.WaitGroup
+
+		// The stages run on the goroutine below, away from what the caller prints
+		var scanned repoOutput
+		b.scanOutput.held = &scanned
+		defer func() { b.scanOutput.held = nil }()
+
+		go func() {
+			defer close(jobs)
+			for repo := range gitRepos {
+				job := newBackupJob(repo)
+				scanned.buf.WriteTo(&job.output)
+				select {
+				case slots <- struct{}{}:
+				case <-quit:
+					return
+				}
+				if stop.Err() != nil {
+					<-slots
+					close(job.done)
+				} else {
+					running.Add(1)
+					go func() {
+						defer running.Done()
+						defer func() { <-slots }()
+						job.run(ctx, b.settings)
+					}()
+				}
+				select {
+				case jobs <- job:
+				case <-quit:
+					return
+				}
+			}
+		}()
+
+		defer running.Wait()
+		for job := range jobs {
+			if !yield(job) {
+				close(quit)
+				for range jobs {
+				}
+				return
+			}
+		}
+		// Repositories dropped after the last job have nothing to be printed with
+		scanned.Flush()
+	}
+}
+
+// backupOptions returns the backup settings from the configuration
+func (s *settings) backupOptions() backup.Options {
+	return backup.Options{
+		Format:      backup.Format(strings.ToLower(s.BackupFormat)),
+		Dir:         expandHome(s.BackupDir),
+		TrackedOnly: strings.EqualFold(s.BackupFiles, BackupFilesTracked),
+	}
+}
+
+// formatSize formats a byte count for people, e.g. "12.4 MB"
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// verifyBackups checks that the backup at path can be restored. Given a directory that isn't a backup itself, such
+// as BACKUP_DIR or a workspace, it checks every backup directly inside it.
+func verifyBackups(ctx context.Context, path string) error {
+	paths := []string{path}
+	if !backup.IsBackup(path) {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		paths = nil
+		for _, entry := range entries {
+			if backup.IsBackup(entry.Name()) {
+				paths = append(paths, filepath.Join(path, entry.Name()))
+			}
+		}
+		if len(paths) == 0 {
+			fmt.Printf("No backups found in %s\n", path)
+			return nil
+		}
+	}
+
+	failed := 0
+	for _, path := range paths {
+		v, err := backup.Verify(ctx, path)
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", path, err)
+		}
+		if !v.OK() {
+			failed++
+			fmt.Printf("❌ %s\n", path)
+			for _, problem := range v.Problems {
+				fmt.Printf("   %s\n", problem)
+			}
+			continue
+		}
+		head := v.Head
+		if len(head) > 7 {
+			head = head[:7]
+		}
+		detail := "no manifest to compare with"
+		if strings.HasSuffix(path, ".bundle") {
+			detail = "as recorded in the bundle"
+		} else if v.Manifest != nil {
+			detail = "as recorded " + v.Manifest.CreatedAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Printf("✅ %s: git fsck passed, HEAD %s, %d files (%s)\n", path, head, v.Files, detail)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d backups failed verification", failed, len(paths))
+	}
+	return nil
+}
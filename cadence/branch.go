@@ -0,0 +1,52 @@
+package cadence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BranchRule gives repositories whose path or remote URL matches Pattern a specific parent branch.
+// Patterns are matched like AuthorRule patterns.
+type BranchRule struct {
+	Pattern string
+	Branch  string
+}
+
+// BranchMap picks the parent branch unpushed commits are compared against for a repository. The first matching rule wins.
+type BranchMap []BranchRule
+
+// ParseBranchMap parses semicolon-separated "pattern=branch" rules, e.g.
+// "/home/me/work/legacy-*=origin/develop;*github.com*acme/*=origin/trunk"
+func ParseBranchMap(s string) (BranchMap, error) {
+	var branchMap BranchMap
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, branch, found := strings.Cut(entry, "=")
+		pattern, branch = strings.TrimSpace(pattern), strings.TrimSpace(branch)
+		if !found || pattern == "" || branch == "" || strings.ContainsAny(branch, " \t") {
+			return nil, fmt.Errorf("invalid parent branch rule %q: expected pattern=remote/branch", entry)
+		}
+
+		branchMap = append(branchMap, BranchRule{Pattern: pattern, Branch: branch})
+	}
+	return branchMap, nil
+}
+
+// Lookup returns the branch of the first rule matching the repository path or one of its remote URLs
+func (m BranchMap) Lookup(repoPath string, remoteURLs []string) (string, bool) {
+	for _, rule := range m {
+		if matchPattern(rule.Pattern, repoPath) {
+			return rule.Branch, true
+		}
+		for _, url := range remoteURLs {
+			if matchPattern(rule.Pattern, url) {
+				return rule.Branch, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,52 @@
+package cadence
+
+import "testing"
+
+func TestParseBranchMap(t *testing.T) {
+	branchMap, err := ParseBranchMap("/home/me/work/legacy-*=origin/develop; *github.com*acme/*=upstream/trunk;")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(branchMap) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(branchMap))
+	}
+
+	expected := BranchRule{Pattern: "*github.com*acme/*", Branch: "upstream/trunk"}
+	if branchMap[1] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, branchMap[1])
+	}
+
+	for _, invalid := range []string{"no-branch", "=origin/develop", "/work/*=", "/work/*=origin/my branch"} {
+		if _, err := ParseBranchMap(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestBranchMapLookup(t *testing.T) {
+	branchMap := BranchMap{
+		{Pattern: "/home/me/work/legacy-*", Branch: "origin/develop"},
+		{Pattern: "*github.com?acme/*", Branch: "origin/trunk"},
+	}
+
+	tests := []struct {
+		name     string
+		repoPath string
+		remotes  []string
+		expected string
+		found    bool
+	}{
+		{"path match", "/home/me/work/legacy-api", nil, "origin/develop", true},
+		{"remote match", "/home/me/oss/tool", []string{"git@github.com:acme/tool.git"}, "origin/trunk", true},
+		{"no match", "/home/me/work/api", []string{"https://gitlab.com/acme/api"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branch, found := branchMap.Lookup(tt.repoPath, tt.remotes)
+			if found != tt.found || branch != tt.expected {
+				t.Errorf("Expected %q (found=%t), got %q (found=%t)", tt.expected, tt.found, branch, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,708 @@
+// Package cadence computes work-hour schedules for unpushed commits and applies them to repositories.
+package cadence
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/holiday"
+)
+
+// Config controls how new commit times are generated
+type Config struct {
+	WorkDayStartHour int
+	WorkDayEndHour   int
+	JitterMinutes    int
+	JitterDays       bool
+	SkipWeekdays     map[time.Weekday]bool
+	// BlackoutDates are days, keyed as YYYY-MM-DD, that are skipped like SkipWeekdays, such as a vacation
+	BlackoutDates map[string]bool
+	// Holidays are the public holidays that are skipped like SkipWeekdays
+	Holidays holiday.Region
+	// Location is the time zone work hours and days are evaluated in. Nil keeps each commit's original zone.
+	Location *time.Location
+	// Busy are the meetings and other blocks generated commit times stay out of, sorted by start and not overlapping
+	Busy []Period
+	// MeetingGaps is the most gaps of one to two hours carved into each generated work day, so days don't show
+	// continuous activity; 0 disables them
+	MeetingGaps int
+	// WeeklyProfile is the relative commit volume of each weekday that PlanSpan spreads commits by when no Strategy
+	// is set. Nil uses AllocateAcrossDays instead.
+	WeeklyProfile map[time.Weekday]int
+	// Strategy decides how PlanSpan spreads commits over the days of the span. Nil uses Weekly with a WeeklyProfile
+	// and RandomJitter without one.
+	Strategy Strategy
+	// MaxSpanDays is the most eligible days PlanSpan spreads commits over, counted back from today; 0 means no limit
+	MaxSpanDays int
+	// Scheduled are the commit times planned for other repositories of the same run. Generated times stay a few
+	// minutes away from them; nil ignores other repositories.
+	Scheduled *Schedule
+	// MaxCommitsPerDay is the most commits PlanSpan puts on a day, counting the Scheduled ones; 0 means no limit
+	MaxCommitsPerDay int
+	// PreserveSpacing spreads the commits of a day in proportion to the gaps between their original times instead of
+	// evenly, so bursts of related commits stay together, and makes Historical the default Strategy
+	PreserveSpacing bool
+
+	// Rand is the source of randomness for jitter. Nil uses the math/rand global source.
+	Rand *rand.Rand
+	// Now returns the current time. Nil uses time.Now.
+	Now func() time.Time
+}
+
+// DefaultConfig returns the configuration used when nothing is overridden
+func DefaultConfig() Config {
+	return Config{
+		WorkDayStartHour: 10,
+		WorkDayEndHour:   19,
+		JitterMinutes:    30,
+		JitterDays:       true,
+		SkipWeekdays:     ParseWeekdays("Sat,Sun"),
+	}
+}
+
+// intn returns a random number in [0, n) from the configured source
+func (c Config) intn(n int) int {
+	if c.Rand != nil {
+		return c.Rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// now returns the current time from the configured clock
+func (c Config) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// commitTime returns the commit's author date in the zone commits are scheduled in
+func (c Config) commitTime(commit git.Commit) (time.Time, error) {
+	t, err := commit.Time()
+	if err != nil || c.Location == nil {
+		return t, err
+	}
+	return t.In(c.Location), nil
+}
+
+// skipsDay reports whether the day of t is a skipped weekday, a blackout date or a public holiday
+func (c Config) skipsDay(t time.Time) bool {
+	return c.SkipWeekdays[t.Weekday()] || c.BlackoutDates[t.Format(time.DateOnly)] || c.isHoliday(t)
+}
+
+// isHoliday reports whether the day of t is a public holiday
+func (c Config) isHoliday(t time.Time) bool {
+	_, ok := c.Holidays.Holiday(t)
+	return ok
+}
+
+// Period is the time from Start up to, but not including, End
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// busyAt returns the busy period t falls into
+func (c Config) busyAt(t time.Time) (Period, bool) {
+	i := sort.Search(len(c.Busy), func(i int) bool { return c.Busy[i].End.After(t) })
+	if i < len(c.Busy) && !c.Busy[i].Start.After(t) {
+		return c.Busy[i], true
+	}
+	return Period{}, false
+}
+
+// avoidBusy moves t out of the busy periods it falls into: to the end of the period when that is still before end,
+// otherwise to a minute before it when that is still after start. A time that has no free slot on either side stays
+// as it is.
+func (c Config) avoidBusy(t, start, end time.Time) time.Time {
+	later := t
+	for {
+		period, busy := c.busyAt(later)
+		if !busy {
+			return later
+		}
+		if later = period.End; !later.Before(end) {
+			break
+		}
+	}
+	earlier := t
+	for {
+		period, busy := c.busyAt(earlier)
+		if !busy {
+			return earlier
+		}
+		if earlier = period.Start.Add(-time.Minute); earlier.Before(start) {
+			return t
+		}
+	}
+}
+
+// meetingGaps carves between 1 and MeetingGaps gaps of one to two hours into [start, end). Gaps start on the half
+// hour and take up at most half of the time.
+func (c Config) meetingGaps(start, end time.Time) []Period {
+	const slot = 30 * time.Minute
+	first := start.Add(slot - time.Nanosecond).Truncate(slot)
+	budget := end.Sub(start) / 2
+	var gaps []Period
+	for range 1 + c.intn(c.MeetingGaps) {
+		length := time.Duration(60+c.intn(61)) * time.Minute
+		slots := int(end.Sub(first.Add(length)) / slot)
+		if length > budget || slots < 0 {
+			break
+		}
+		gapStart := first.Add(time.Duration(c.intn(slots+1)) * slot)
+		gaps = append(gaps, Period{Start: gapStart, End: gapStart.Add(length)})
+		budget -= length
+	}
+	return gaps
+}
+
+// freeDuration returns how much of [start, end) is outside the busy periods
+func (c Config) freeDuration(start, end time.Time) time.Duration {
+	free := end.Sub(start)
+	for _, period := range c.Busy {
+		from, to := period.Start, period.End
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			free -= to.Sub(from)
+		}
+	}
+	return free
+}
+
+// freeTime returns the time that is offset into the free time after start, skipping the busy periods
+func (c Config) freeTime(start time.Time, offset time.Duration) time.Time {
+	t := start
+	for _, period := range c.Busy {
+		if !period.End.After(t) {
+			continue
+		}
+		if free := period.Start.Sub(t); free > 0 {
+			if offset < free {
+				return t.Add(offset)
+			}
+			offset -= free
+		}
+		t = period.End
+	}
+	return t.Add(offset)
+}
+
+// MergePeriods sorts periods by start and merges the ones that overlap or touch, as Config.Busy expects them
+func MergePeriods(periods []Period) []Period {
+	sorted := slices.Clone(periods)
+	slices.SortFunc(sorted, func(a, b Period) int { return a.Start.Compare(b.Start) })
+	var merged []Period
+	for _, period := range sorted {
+		if !period.End.After(period.Start) {
+			continue
+		}
+		if n := len(merged); n > 0 && !period.Start.After(merged[n-1].End) {
+			if period.End.After(merged[n-1].End) {
+				merged[n-1].End = period.End
+			}
+			continue
+		}
+		merged = append(merged, period)
+	}
+	return merged
+}
+
+// Violation is why a commit time is outside the schedule
+type Violation string
+
+const (
+	// ViolationBlackoutDate means the commit was made on one of BlackoutDates
+	ViolationBlackoutDate Violation = "blackout date"
+	// ViolationHoliday means the commit was made on one of Holidays
+	ViolationHoliday Violation = "public holiday"
+	// ViolationSkippedDay means the commit was made on one of SkipWeekdays
+	ViolationSkippedDay Violation = "skipped weekday"
+	// ViolationOutsideHours means the commit was made on an allowed day, but outside work hours
+	ViolationOutsideHours Violation = "outside work hours"
+)
+
+// CheckTime returns why the commit was made outside the schedule, or "" when it was made within work hours on a day
+// that isn't skipped
+func (c Config) CheckTime(commit git.Commit) (Violation, error) {
+	t, err := c.commitTime(commit)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case c.BlackoutDates[t.Format(time.DateOnly)]:
+		return ViolationBlackoutDate, nil
+	case c.isHoliday(t):
+		return ViolationHoliday, nil
+	case c.SkipWeekdays[t.Weekday()]:
+		return ViolationSkippedDay, nil
+	case t.Hour() < c.WorkDayStartHour || t.Hour() >= c.WorkDayEndHour:
+		return ViolationOutsideHours, nil
+	}
+	return "", nil
+}
+
+// InWorkHours reports whether the commit was made within work hours on a day that isn't skipped
+func (c Config) InWorkHours(commit git.Commit) bool {
+	violation, err := c.CheckTime(commit)
+	return err == nil && violation == ""
+}
+
+// OnAllowedDay reports whether the commit was made on a day that isn't skipped, at any hour
+func (c Config) OnAllowedDay(commit git.Commit) bool {
+	t, err := c.commitTime(commit)
+	if err != nil {
+		return false
+	}
+	return !c.skipsDay(t)
+}
+
+// jitterWithin moves t by a random number of minutes within +/- JitterMinutes, staying within [lower, upper). A t
+// outside of the bounds is moved into them first, a time at upper to a minute before it.
+func (c Config) jitterWithin(t, lower, upper time.Time) time.Time {
+	if !upper.After(lower) {
+		return lower
+	}
+	if !t.Before(upper) {
+		t = upper.Add(-time.Minute)
+	}
+	if t.Before(lower) {
+		t = lower
+	}
+	if c.JitterMinutes <= 0 {
+		return t
+	}
+	earliest := max(-c.JitterMinutes, -int(t.Sub(lower)/time.Minute))
+	latest := min(c.JitterMinutes, int((upper.Sub(t)-1)/time.Minute))
+	if latest < earliest {
+		return t
+	}
+	return t.Add(time.Duration(earliest+c.intn(latest-earliest+1)) * time.Minute)
+}
+
+// GenerateCommitTimesForDay creates evenly distributed times across work day for a specific day
+func (c Config) GenerateCommitTimesForDay(day time.Time, commitCount int, earliestTime *time.Time) []time.Time {
+	return c.generateCommitTimes(day, commitCount, nil, earliestTime)
+}
+
+// GenerateCommitTimesLike creates times across the work day of day for commits originally made at originals, oldest
+// first. With PreserveSpacing the gaps between the new times keep the proportions of the original gaps, scaled to the
+// work day; otherwise the times are evenly distributed like GenerateCommitTimesForDay's.
+func (c Config) GenerateCommitTimesLike(day time.Time, originals []time.Time, earliestTime *time.Time) []time.Time {
+	if !c.PreserveSpacing {
+		return c.generateCommitTimes(day, len(originals), nil, earliestTime)
+	}
+	return c.generateCommitTimes(day, len(originals), originals, earliestTime)
+}
+
+// generateCommitTimes creates commitCount times across the work day, spaced like originals if they are set
+func (c Config) generateCommitTimes(day time.Time, commitCount int, originals []time.Time, earliestTime *time.Time) []time.Time {
+	if commitCount <= 0 {
+		return []time.Time{}
+	}
+
+	workDayStart := time.Date(day.Year(), day.Month(), day.Day(), c.WorkDayStartHour, 0, 0, 0, day.Location())
+	workDayEnd := time.Date(day.Year(), day.Month(), day.Day(), c.WorkDayEndHour, 0, 0, 0, day.Location())
+
+	// If earliestTime is provided, use it as the minimum start time
+	if earliestTime != nil && earliestTime.After(workDayStart) {
+		workDayStart = *earliestTime
+	}
+
+	// For current day, ensure workDayEnd doesn't exceed current time
+	now := c.now()
+	if day.Year() == now.Year() && day.Month() == now.Month() && day.Day() == now.Day() {
+		if workDayEnd.After(now) {
+			workDayEnd = now
+		}
+	}
+
+	workDayDuration := workDayEnd.Sub(workDayStart)
+
+	// Commits of other repositories are kept apart like meetings
+	if scheduled := c.Scheduled.periods(workDayStart, workDayEnd); len(scheduled) > 0 {
+		c.Busy = MergePeriods(append(slices.Clone(c.Busy), scheduled...))
+	}
+
+	// With meeting gaps the commits are spread over the time left between them
+	if c.MeetingGaps > 0 && workDayDuration > 0 {
+		gaps := c.meetingGaps(workDayStart, workDayEnd)
+		c.Busy = MergePeriods(append(slices.Clone(c.Busy), gaps...))
+		workDayDuration = c.freeDuration(workDayStart, workDayEnd)
+	}
+
+	times := make([]time.Time, commitCount)
+
+	if !workDayEnd.After(workDayStart) {
+		// No time left in the day, e.g. today before the work day starts
+		for i := range times {
+			times[i] = workDayStart
+		}
+	} else if commitCount == 1 {
+		// Single commit goes closer to evening (7 PM)
+		eveningTime := workDayEnd.Add(-time.Duration(c.intn(60)) * time.Minute) // Within 1 hour of end
+		times[0] = c.jitterWithin(eveningTime, workDayStart, workDayEnd)
+	} else {
+		// Multiple commits distributed evenly, or like the original ones
+		offsets := spacing(commitCount, workDayDuration, originals)
+
+		base := make([]time.Time, commitCount)
+		for i, offset := range offsets {
+			base[i] = workDayStart.Add(offset)
+			if c.MeetingGaps > 0 {
+				base[i] = c.freeTime(workDayStart, offset)
+			}
+		}
+		// Each commit's jitter is bounded by the midpoints to its neighbours and by the work day, so jitter can't
+		// reorder commits, bunch them up or push them out of work hours
+		for i := range base {
+			lower, upper := workDayStart, workDayEnd
+			if i > 0 {
+				lower = base[i-1].Add(base[i].Sub(base[i-1]) / 2)
+			}
+			if i < commitCount-1 {
+				upper = base[i].Add(base[i+1].Sub(base[i]) / 2)
+			}
+			times[i] = c.jitterWithin(base[i], lower, upper)
+		}
+	}
+
+	for i := range times {
+		times[i] = c.avoidBusy(times[i], workDayStart, workDayEnd)
+	}
+
+	// Sort times to ensure they're in chronological order
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+	c.spreadSeconds(times, workDayStart, workDayEnd)
+
+	return times
+}
+
+// spacing returns the offsets of commitCount commits from the start of a work day of the given length, the first at
+// 0 and the last at length. The commits are evenly spaced, unless originals holds their original times, oldest
+// first, in which case each offset is at the same relative position as its original time between the oldest and the
+// newest one. Original times out of order don't move a commit before the one preceding it.
+func spacing(commitCount int, length time.Duration, originals []time.Time) []time.Duration {
+	offsets := make([]time.Duration, commitCount)
+	if len(originals) == commitCount && commitCount > 1 {
+		if span := originals[commitCount-1].Sub(originals[0]); span > 0 {
+			for i, t := range originals {
+				offsets[i] = min(time.Duration(float64(length)*float64(t.Sub(originals[0]))/float64(span)), length)
+				if i > 0 {
+					offsets[i] = max(offsets[i], offsets[i-1])
+				}
+			}
+			return offsets
+		}
+	}
+	for i := range offsets {
+		offsets[i] = time.Duration(i) * (length / time.Duration(max(commitCount-1, 1)))
+	}
+	return offsets
+}
+
+// spreadSeconds gives sorted times random seconds, so they don't all fall on the full minute, and makes every time
+// later than the one before while keeping them in [start, end)
+func (c Config) spreadSeconds(times []time.Time, start, end time.Time) {
+	for i, t := range times {
+		t = t.Add(-time.Duration(t.Nanosecond()))
+		// Moving forward keeps a time clear of the busy period it was moved out of
+		if later := t.Add(time.Duration(c.intn(60)) * time.Second); later.Before(end) {
+			if _, busy := c.busyAt(later); !busy {
+				t = later
+			}
+		}
+		if i > 0 && !t.After(times[i-1]) {
+			t = times[i-1].Add(time.Duration(1+c.intn(59)) * time.Second)
+		}
+		times[i] = t
+	}
+
+	// Times made distinct at the end of the day can be pushed past it
+	if !end.After(start) {
+		return
+	}
+	latest := end.Add(-time.Second)
+	for i := len(times) - 1; i >= 0; i-- {
+		if times[i].After(latest) {
+			times[i] = latest
+		}
+		latest = times[i].Add(-time.Second)
+	}
+}
+
+// GroupCommitsByDay groups commits by their date (YYYY-MM-DD format) in each commit's own time zone
+func GroupCommitsByDay(commits []git.Commit) map[string][]git.Commit {
+	return Config{}.groupCommitsByDay(commits)
+}
+
+// groupCommitsByDay groups commits by their date in the configured time zone
+func (c Config) groupCommitsByDay(commits []git.Commit) map[string][]git.Commit {
+	commitsByDay := make(map[string][]git.Commit)
+
+	for _, commit := range commits {
+		// Parse the commit datetime in ISO format to extract the date
+		commitTime, err := c.commitTime(commit)
+		if err != nil {
+			// If parsing fails, use current date as fallback
+			commitTime = time.Now()
+		}
+
+		dayStr := commitTime.Format("2006-01-02")
+		commitsByDay[dayStr] = append(commitsByDay[dayStr], commit)
+	}
+
+	return commitsByDay
+}
+
+// ParseWeekdays converts a CSV of weekday names/numbers to a set
+// Accepts: "Sat,Sun", "Saturday, Sunday", "Mon", or digits 0-6 (0=Sunday)
+func ParseWeekdays(s string) map[time.Weekday]bool {
+	m := make(map[time.Weekday]bool)
+	if strings.TrimSpace(s) == "" {
+		return m
+	}
+	items := strings.Split(s, ",")
+	for _, raw := range items {
+		if day, ok := parseWeekday(raw); ok {
+			m[day] = true
+		}
+	}
+	return m
+}
+
+// parseWeekday converts a weekday name, abbreviation or digit 0-6 (0=Sunday) to a weekday
+func parseWeekday(s string) (time.Weekday, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "sun", "sunday", "0":
+		return time.Sunday, true
+	case "mon", "monday", "1":
+		return time.Monday, true
+	case "tue", "tues", "tuesday", "2":
+		return time.Tuesday, true
+	case "wed", "weds", "wednesday", "3":
+		return time.Wednesday, true
+	case "thu", "thur", "thurs", "thursday", "4":
+		return time.Thursday, true
+	case "fri", "friday", "5":
+		return time.Friday, true
+	case "sat", "saturday", "6":
+		return time.Saturday, true
+	}
+	return 0, false
+}
+
+// ParseWeeklyProfile converts a CSV of weekday=weight pairs to the relative commit volume of each weekday, e.g.
+// "Tue=3,Wed=3,Thu=3". Weekdays that aren't listed weigh 1. An empty string returns nil, which keeps the default
+// allocation.
+func ParseWeeklyProfile(s string) (map[time.Weekday]int, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	profile := make(map[time.Weekday]int, 7)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		profile[day] = 1
+	}
+	for _, raw := range strings.Split(s, ",") {
+		item := strings.TrimSpace(raw)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q, expected weekday=weight", item)
+		}
+		day, ok := parseWeekday(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", strings.TrimSpace(name))
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for %s, expected a whole number of 0 or more", strings.TrimSpace(value), day)
+		}
+		profile[day] = weight
+	}
+	return profile, nil
+}
+
+// maxBlackoutRange is the longest range of blackout dates accepted, which keeps a typo in a year from expanding into
+// thousands of days
+const maxBlackoutRange = 366
+
+// ParseDates converts a CSV of dates (YYYY-MM-DD) and inclusive date ranges (YYYY-MM-DD..YYYY-MM-DD) to a set keyed
+// by date, e.g. "2024-12-24,2024-12-27..2024-12-31"
+func ParseDates(s string) (map[string]bool, error) {
+	m := make(map[string]bool)
+	for _, raw := range strings.Split(s, ",") {
+		item := strings.TrimSpace(raw)
+		if item == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(item, "..")
+		start, err := time.Parse(time.DateOnly, strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", strings.TrimSpace(from))
+		}
+		end := start
+		if isRange {
+			if end, err = time.Parse(time.DateOnly, strings.TrimSpace(to)); err != nil {
+				return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", strings.TrimSpace(to))
+			}
+			if end.Before(start) {
+				return nil, fmt.Errorf("date range %q ends before it starts", item)
+			}
+			if end.Sub(start) >= maxBlackoutRange*24*time.Hour {
+				return nil, fmt.Errorf("date range %q is longer than %d days", item, maxBlackoutRange)
+			}
+		}
+		for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+			m[d.Format(time.DateOnly)] = true
+		}
+	}
+	return m, nil
+}
+
+// EnumerateDaysSkipping returns inclusive days [start..end], skipping any day whose Weekday() is in skip set.
+func EnumerateDaysSkipping(start, end time.Time, skip map[time.Weekday]bool) []time.Time {
+	var days []time.Time
+	for d := start; !d.After(end); d = d.Add(24 * time.Hour) {
+		if skip != nil && skip[d.Weekday()] {
+			continue
+		}
+		days = append(days, d)
+	}
+	return days
+}
+
+// AllocateAcrossDays spreads n items across m buckets with specific positioning rules. It is the RandomJitter
+// strategy.
+func (c Config) AllocateAcrossDays(n, m int) []int {
+	if m <= 0 {
+		return nil
+	}
+	out := make([]int, m)
+	if n <= 0 {
+		return out
+	}
+
+	// Special case: single commit goes to last day
+	if n == 1 {
+		out[m-1] = 1
+		return out
+	}
+
+	// For multiple commits:
+	// - First commit goes to first day
+	// - Last commit goes to last day
+	// - Middle commits are spread with jitter between first and last days
+
+	// Special case: only one day available
+	if m == 1 {
+		out[0] = n
+		return out
+	}
+
+	// Place first commit
+	out[0] = 1
+
+	// Place last commit
+	out[m-1] = 1
+
+	// Handle middle commits (n-2 remaining)
+	if n > 2 {
+		middleCommits := n - 2
+		availableDays := m - 2 // Days between first and last (exclusive)
+
+		if availableDays > 0 {
+			// Add jitter by using random distribution
+			for i := 0; i < middleCommits; i++ {
+				var dayOffset int
+				if c.JitterDays {
+					// Use random jitter
+					dayOffset = c.intn(availableDays)
+				} else {
+					// Use original deterministic distribution when no jitter
+					dayOffset = (i*7 + i*i) % availableDays
+				}
+				dayIndex := 1 + dayOffset // Start from day 1 (after first day)
+				out[dayIndex]++
+			}
+		} else {
+			// If no middle days available, distribute between first and last
+			for i := 0; i < middleCommits; i++ {
+				if i%2 == 0 {
+					out[0]++ // Even indices go to first day
+				} else {
+					out[m-1]++ // Odd indices go to last day
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// AllocateByProfile spreads n items across days in proportion to the WeeklyProfile weight of each day's weekday.
+// With JitterDays every item goes to a day drawn by weight; without it the shares are rounded by largest remainder,
+// ties going to the earlier day. Without a profile, or when every day weighs 0, it falls back to AllocateAcrossDays.
+func (c Config) AllocateByProfile(n int, days []time.Time) []int {
+	weights := make([]int, len(days))
+	total := 0
+	if c.WeeklyProfile != nil {
+		for i, day := range days {
+			weights[i] = c.WeeklyProfile[day.Weekday()]
+			total += weights[i]
+		}
+	}
+	if total == 0 {
+		return c.AllocateAcrossDays(n, len(days))
+	}
+	out := make([]int, len(days))
+	if n <= 0 {
+		return out
+	}
+
+	if c.JitterDays {
+		for range n {
+			pick := c.intn(total)
+			for i, weight := range weights {
+				if pick < weight {
+					out[i]++
+					break
+				}
+				pick -= weight
+			}
+		}
+		return out
+	}
+
+	remainders := make([]int, len(days))
+	assigned := 0
+	for i, weight := range weights {
+		out[i] = n * weight / total
+		remainders[i] = n * weight % total
+		assigned += out[i]
+	}
+	order := make([]int, len(days))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return remainders[b] - remainders[a] })
+	for _, i := range order[:n-assigned] {
+		out[i]++
+	}
+	return out
+}
@@ -1,10 +1,13 @@
-package main
+package cadence
 
 import (
+	"math/rand"
+	"slices"
 	"testing"
 	"time"
 
-	"code-cadence/git"
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/holiday"
 )
 
 func TestParseWeekdays(t *testing.T) {
@@ -106,7 +109,7 @@ func TestParseWeekdays(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			result := parseWeekdays(test.input)
+			result := ParseWeekdays(test.input)
 
 			if len(result) != len(test.expected) {
 				t.Errorf("Expected %d weekdays, got %d", len(test.expected), len(result))
@@ -128,6 +131,70 @@ func TestParseWeekdays(t *testing.T) {
 	}
 }
 
+func TestParseDates(t *testing.T) {
+	dates, err := ParseDates(" 2024-12-24, 2024-12-30..2025-01-02 ,")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"2024-12-24", "2024-12-30", "2024-12-31", "2025-01-01", "2025-01-02"}
+	if len(dates) != len(expected) {
+		t.Errorf("Expected %d dates, got %v", len(expected), dates)
+	}
+	for _, date := range expected {
+		if !dates[date] {
+			t.Errorf("Expected %s in %v", date, dates)
+		}
+	}
+
+	for _, invalid := range []string{"24.12.2024", "2024-12-24..", "2024-12-31..2024-12-24", "2024-01-01..2025-06-01"} {
+		if _, err := ParseDates(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestCheckTime(t *testing.T) {
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17, SkipWeekdays: ParseWeekdays("Sat,Sun"), BlackoutDates: map[string]bool{"2024-01-10": true}}
+
+	tests := []struct {
+		dateTime string
+		expected Violation
+	}{
+		{"2024-01-08 09:00:00 +0000", ""},
+		{"2024-01-08 16:59:59 +0100", ""},
+		{"2024-01-08 17:00:00 +0000", ViolationOutsideHours},
+		{"2024-01-08 08:59:00 +0000", ViolationOutsideHours},
+		{"2024-01-06 12:00:00 +0000", ViolationSkippedDay},
+		{"2024-01-10 12:00:00 +0000", ViolationBlackoutDate},
+	}
+	for _, test := range tests {
+		violation, err := cfg.CheckTime(git.Commit{DateTime: test.dateTime})
+		if err != nil || violation != test.expected {
+			t.Errorf("CheckTime(%s) = %q, %v, expected %q", test.dateTime, violation, err, test.expected)
+		}
+	}
+
+	// The blackout date is in the commit's own zone
+	if violation, _ := cfg.CheckTime(git.Commit{DateTime: "2024-01-09 23:30:00 -0200"}); violation != ViolationOutsideHours {
+		t.Errorf("Expected a Tuesday evening commit to be outside work hours, got %q", violation)
+	}
+
+	// Epiphany is a public holiday in Bavaria, but not in Berlin
+	var err error
+	if cfg.Holidays, err = holiday.Lookup("DE-BY"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if violation, _ := cfg.CheckTime(git.Commit{DateTime: "2025-01-06 12:00:00 +0100"}); violation != ViolationHoliday {
+		t.Errorf("Expected Epiphany to be a public holiday in DE-BY, got %q", violation)
+	}
+	if cfg.Holidays, err = holiday.Lookup("DE-BE"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if violation, _ := cfg.CheckTime(git.Commit{DateTime: "2025-01-06 12:00:00 +0100"}); violation != "" {
+		t.Errorf("Expected Epiphany to be a work day in DE-BE, got %q", violation)
+	}
+}
+
 func TestEnumerateDaysSkipping(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -188,7 +255,7 @@ func TestEnumerateDaysSkipping(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			result := enumerateDaysSkipping(test.start, test.end, test.skip)
+			result := EnumerateDaysSkipping(test.start, test.end, test.skip)
 
 			if len(result) != test.expected {
 				t.Errorf("Expected %d days, got %d", test.expected, len(result))
@@ -214,9 +281,7 @@ func TestEnumerateDaysSkipping(t *testing.T) {
 
 func TestAllocateAcrossDays(t *testing.T) {
 	// Test deterministic behavior (no jitter)
-	originalJitterDays := JitterDays
-	JitterDays = false
-	defer func() { JitterDays = originalJitterDays }()
+	cfg := Config{JitterDays: false}
 
 	tests := []struct {
 		name     string
@@ -306,7 +371,7 @@ func TestAllocateAcrossDays(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			result := allocateAcrossDays(test.n, test.m)
+			result := cfg.AllocateAcrossDays(test.n, test.m)
 
 			if test.expected == nil {
 				if result != nil {
@@ -357,9 +422,7 @@ func TestAllocateAcrossDays(t *testing.T) {
 
 func TestAllocateAcrossDaysWithJitter(t *testing.T) {
 	// Test jitter behavior
-	originalJitterDays := JitterDays
-	JitterDays = true // Enable jitter
-	defer func() { JitterDays = originalJitterDays }()
+	cfg := Config{JitterDays: true} // Enable jitter
 
 	tests := []struct {
 		name string
@@ -388,7 +451,7 @@ func TestAllocateAcrossDaysWithJitter(t *testing.T) {
 			// Run multiple times to test randomness
 			results := make([][]int, 10)
 			for i := 0; i < 10; i++ {
-				results[i] = allocateAcrossDays(test.n, test.m)
+				results[i] = cfg.AllocateAcrossDays(test.n, test.m)
 			}
 
 			// Verify all results have correct properties
@@ -440,6 +503,87 @@ func TestAllocateAcrossDaysWithJitter(t *testing.T) {
 	}
 }
 
+func TestParseWeeklyProfile(t *testing.T) {
+	profile, err := ParseWeeklyProfile(" Tue=3, wednesday=3,4=3,Fri=0 ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[time.Weekday]int{
+		time.Sunday: 1, time.Monday: 1, time.Tuesday: 3, time.Wednesday: 3, time.Thursday: 3, time.Friday: 0, time.Saturday: 1,
+	}
+	for day, weight := range expected {
+		if profile[day] != weight {
+			t.Errorf("Expected %s to weigh %d, got %d", day, weight, profile[day])
+		}
+	}
+
+	if profile, err := ParseWeeklyProfile(""); profile != nil || err != nil {
+		t.Errorf("Expected no profile for an empty string, got %v, %v", profile, err)
+	}
+	for _, invalid := range []string{"Tue", "Someday=2", "Tue=-1", "Tue=heavy"} {
+		if _, err := ParseWeeklyProfile(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestAllocateByProfile(t *testing.T) {
+	// Monday 2024-01-08 through Friday 2024-01-12
+	monday := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	days := make([]time.Time, 5)
+	for i := range days {
+		days[i] = monday.AddDate(0, 0, i)
+	}
+	profile, err := ParseWeeklyProfile("Mon=1,Tue=3,Wed=3,Thu=3,Fri=0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cfg := Config{WeeklyProfile: profile}
+	tests := []struct {
+		n        int
+		expected []int
+	}{
+		{10, []int{1, 3, 3, 3, 0}},
+		{12, []int{1, 4, 4, 3, 0}},
+		{1, []int{0, 1, 0, 0, 0}},
+		{0, []int{0, 0, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		if result := cfg.AllocateByProfile(test.n, days); !slicesEqual(result, test.expected) {
+			t.Errorf("AllocateByProfile(%d) = %v, expected %v", test.n, result, test.expected)
+		}
+	}
+
+	cfg.JitterDays = true
+	cfg.Rand = rand.New(rand.NewSource(1))
+	totals := make([]int, len(days))
+	for range 100 {
+		result := cfg.AllocateByProfile(10, days)
+		sum := 0
+		for i, count := range result {
+			sum += count
+			totals[i] += count
+		}
+		if sum != 10 {
+			t.Fatalf("Expected 10 items, got %v", result)
+		}
+	}
+	if totals[4] != 0 {
+		t.Errorf("Expected no items on a day weighing 0, got %d", totals[4])
+	}
+	if totals[0] >= totals[1] || totals[0] >= totals[2] || totals[0] >= totals[3] {
+		t.Errorf("Expected Tuesday to Thursday to get more items than Monday, got %v", totals)
+	}
+
+	// Without a profile, or with only days weighing 0, the default allocation is used
+	for _, cfg := range []Config{{}, {WeeklyProfile: map[time.Weekday]int{}}} {
+		if result := cfg.AllocateByProfile(3, days); !slicesEqual(result, cfg.AllocateAcrossDays(3, len(days))) {
+			t.Errorf("Expected the default allocation, got %v", result)
+		}
+	}
+}
+
 func slicesEqual(a, b []int) bool {
 	if len(a) != len(b) {
 		return false
@@ -531,7 +675,7 @@ func TestGroupCommitsByDay(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			result := groupCommitsByDay(test.commits)
+			result := GroupCommitsByDay(test.commits)
 
 			// Special handling for invalid datetime format test
 			if test.name == "invalid datetime format" {
@@ -569,9 +713,10 @@ func TestGroupCommitsByDay(t *testing.T) {
 
 func TestGenerateCommitTimesForDay(t *testing.T) {
 	// Set up test configuration
-	WorkDayStartHour = 9
-	WorkDayEndHour = 17
-	JitterMinutes = 0 // Disable jitter for predictable testing
+	cfg := Config{}
+	cfg.WorkDayStartHour = 9
+	cfg.WorkDayEndHour = 17
+	cfg.JitterMinutes = 0 // Disable jitter for predictable testing
 
 	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
@@ -604,7 +749,7 @@ func TestGenerateCommitTimesForDay(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			result := generateCommitTimesForDay(day, test.commitCount, nil)
+			result := cfg.GenerateCommitTimesForDay(day, test.commitCount, nil)
 
 			if len(result) != test.expected {
 				t.Errorf("Expected %d times, got %d", test.expected, len(result))
@@ -613,9 +758,9 @@ func TestGenerateCommitTimesForDay(t *testing.T) {
 			// Verify times are within work hours
 			for i, timeVal := range result {
 				hour := timeVal.Hour()
-				if hour < WorkDayStartHour || hour >= WorkDayEndHour {
+				if hour < cfg.WorkDayStartHour || hour >= cfg.WorkDayEndHour {
 					t.Errorf("Time %d (%s) is outside work hours (%d-%d)",
-						i, timeVal.Format("15:04"), WorkDayStartHour, WorkDayEndHour)
+						i, timeVal.Format("15:04"), cfg.WorkDayStartHour, cfg.WorkDayEndHour)
 				}
 			}
 
@@ -640,14 +785,15 @@ func TestGenerateCommitTimesForDay(t *testing.T) {
 
 func TestGenerateCommitTimesForDayWithJitter(t *testing.T) {
 	// Set up test configuration with jitter
-	WorkDayStartHour = 9
-	WorkDayEndHour = 17
-	JitterMinutes = 30
+	cfg := Config{}
+	cfg.WorkDayStartHour = 9
+	cfg.WorkDayEndHour = 17
+	cfg.JitterMinutes = 30
 
 	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
 	// Test with jitter enabled
-	result := generateCommitTimesForDay(day, 3, nil)
+	result := cfg.GenerateCommitTimesForDay(day, 3, nil)
 
 	if len(result) != 3 {
 		t.Errorf("Expected 3 times, got %d", len(result))
@@ -659,16 +805,16 @@ func TestGenerateCommitTimesForDayWithJitter(t *testing.T) {
 		minute := timeVal.Minute()
 
 		// Allow for jitter - times should be within work hours plus/minus jitter
-		if hour < WorkDayStartHour-1 || hour >= WorkDayEndHour+1 {
+		if hour < cfg.WorkDayStartHour-1 || hour >= cfg.WorkDayEndHour+1 {
 			t.Errorf("Time %d (%s) is outside work hours with jitter tolerance (%d-%d)",
-				i, timeVal.Format("15:04"), WorkDayStartHour, WorkDayEndHour)
+				i, timeVal.Format("15:04"), cfg.WorkDayStartHour, cfg.WorkDayEndHour)
 		}
 
 		// If it's at the boundary, check minutes
-		if hour == WorkDayStartHour-1 && minute < 30 {
+		if hour == cfg.WorkDayStartHour-1 && minute < 30 {
 			t.Errorf("Time %d (%s) is too early with jitter", i, timeVal.Format("15:04"))
 		}
-		if hour == WorkDayEndHour && minute > 30 {
+		if hour == cfg.WorkDayEndHour && minute > 30 {
 			t.Errorf("Time %d (%s) is too late with jitter", i, timeVal.Format("15:04"))
 		}
 	}
@@ -676,17 +822,18 @@ func TestGenerateCommitTimesForDayWithJitter(t *testing.T) {
 
 func TestGenerateCommitTimesForDayEdgeCases(t *testing.T) {
 	// Set up test configuration
-	WorkDayStartHour = 9
-	WorkDayEndHour = 17
-	JitterMinutes = 0
+	cfg := Config{}
+	cfg.WorkDayStartHour = 9
+	cfg.WorkDayEndHour = 17
+	cfg.JitterMinutes = 0
 
 	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
 	// Test with very short work day
-	WorkDayStartHour = 12
-	WorkDayEndHour = 13
+	cfg.WorkDayStartHour = 12
+	cfg.WorkDayEndHour = 13
 
-	result := generateCommitTimesForDay(day, 2, nil)
+	result := cfg.GenerateCommitTimesForDay(day, 2, nil)
 
 	if len(result) != 2 {
 		t.Errorf("Expected 2 times, got %d", len(result))
@@ -695,25 +842,25 @@ func TestGenerateCommitTimesForDayEdgeCases(t *testing.T) {
 	// Verify times are within the short work day
 	for i, timeVal := range result {
 		hour := timeVal.Hour()
-		if hour < WorkDayStartHour || hour >= WorkDayEndHour {
+		if hour < cfg.WorkDayStartHour || hour >= cfg.WorkDayEndHour {
 			t.Errorf("Time %d (%s) is outside short work hours (%d-%d)",
-				i, timeVal.Format("15:04"), WorkDayStartHour, WorkDayEndHour)
+				i, timeVal.Format("15:04"), cfg.WorkDayStartHour, cfg.WorkDayEndHour)
 		}
 	}
 
 	// Test with same start and end hour
-	WorkDayStartHour = 12
-	WorkDayEndHour = 12
+	cfg.WorkDayStartHour = 12
+	cfg.WorkDayEndHour = 12
 
-	result = generateCommitTimesForDay(day, 1, nil)
+	result = cfg.GenerateCommitTimesForDay(day, 1, nil)
 
 	if len(result) != 1 {
 		t.Errorf("Expected 1 time, got %d", len(result))
 	}
 
 	// The time should be at the start hour
-	if result[0].Hour() != WorkDayStartHour {
-		t.Errorf("Expected time to be at hour %d, got %d", WorkDayStartHour, result[0].Hour())
+	if result[0].Hour() != cfg.WorkDayStartHour {
+		t.Errorf("Expected time to be at hour %d, got %d", cfg.WorkDayStartHour, result[0].Hour())
 	}
 }
 
@@ -723,7 +870,7 @@ func BenchmarkParseWeekdays(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		parseWeekdays(input)
+		ParseWeekdays(input)
 	}
 }
 
@@ -734,16 +881,17 @@ func BenchmarkEnumerateDaysSkipping(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		enumerateDaysSkipping(start, end, skip)
+		EnumerateDaysSkipping(start, end, skip)
 	}
 }
 
 func BenchmarkAllocateAcrossDays(b *testing.B) {
 	n, m := 1000, 30
+	cfg := DefaultConfig()
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		allocateAcrossDays(n, m)
+		cfg.AllocateAcrossDays(n, m)
 	}
 }
 
@@ -758,16 +906,213 @@ func BenchmarkGroupCommitsByDay(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		groupCommitsByDay(commits)
+		GroupCommitsByDay(commits)
 	}
 }
 
 func BenchmarkGenerateCommitTimesForDay(b *testing.B) {
 	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := DefaultConfig()
 	commitCount := 10
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		generateCommitTimesForDay(day, commitCount, nil)
+		cfg.GenerateCommitTimesForDay(day, commitCount, nil)
+	}
+}
+
+func TestGenerateCommitTimesForDayBusy(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC) }
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17}
+	cfg.Busy = MergePeriods([]Period{
+		{at(16, 30), at(17, 30)},
+		{at(8, 30), at(9, 30)},
+		{at(12, 0), at(14, 0)},
+		// Touches the meeting before it, so a commit can't go between them
+		{at(14, 0), at(14, 30)},
+	})
+	if len(cfg.Busy) != 3 || !cfg.Busy[1].End.Equal(at(14, 30)) {
+		t.Fatalf("Expected touching periods to be merged, got %v", cfg.Busy)
+	}
+
+	// Without meetings the commits would be at 09:00, 13:00 and 16:59
+	times := cfg.GenerateCommitTimesForDay(at(0, 0), 3, nil)
+	// The last one has no room after its meeting before the work day ends, so it goes before it
+	expected := []time.Time{at(9, 30), at(14, 30), at(16, 29)}
+	for i := range expected {
+		if !times[i].Truncate(time.Minute).Equal(expected[i]) {
+			t.Errorf("Expected commit %d at %s, got %s", i, expected[i].Format("15:04"), times[i].Format("15:04:05"))
+		}
+	}
+
+	// A day that is busy from start to end leaves the times as they are
+	cfg.Busy = []Period{{at(8, 0), at(18, 0)}}
+	times = cfg.GenerateCommitTimesForDay(at(0, 0), 2, nil)
+	if !times[0].Equal(at(9, 0)) || !times[1].Equal(at(16, 59)) {
+		t.Errorf("Expected a fully busy day to keep the commits at 09:00 and 16:59, got %v", times)
+	}
+}
+
+func TestGenerateCommitTimesForDayJitterBounds(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	// Jitter far larger than the 48 minutes between commits
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17, JitterMinutes: 120}
+
+	for seed := range int64(200) {
+		cfg.Rand = rand.New(rand.NewSource(seed))
+		times := cfg.GenerateCommitTimesForDay(day, 11, nil)
+		for i, generated := range times {
+			// Commit i stays within 24 minutes of its base time at i*48 minutes
+			base := start.Add(time.Duration(i) * 48 * time.Minute)
+			lower, upper := base.Add(-24*time.Minute), base.Add(24*time.Minute)
+			if i == 0 {
+				lower = start
+			}
+			if i == len(times)-1 {
+				upper = start.Add(8 * time.Hour)
+			}
+			if generated.Before(lower) || !generated.Before(upper) {
+				t.Fatalf("Seed %d: commit %d at %s is outside %s-%s", seed, i, generated.Format(time.TimeOnly), lower.Format(time.TimeOnly), upper.Format(time.TimeOnly))
+			}
+		}
+	}
+}
+
+func TestGenerateCommitTimesForDaySeconds(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	start, end := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 10, JitterMinutes: 30, Rand: rand.New(rand.NewSource(1))}
+
+	// More commits than minutes in the work day, so many of them start out at the same minute
+	times := cfg.GenerateCommitTimesForDay(day, 90, nil)
+	onFullMinute := 0
+	for i, generated := range times {
+		if generated.Before(start) || !generated.Before(end) {
+			t.Errorf("Time %s is outside the work day", generated.Format(time.TimeOnly))
+		}
+		if i > 0 && !generated.After(times[i-1]) {
+			t.Errorf("Time %s is not after %s", generated.Format(time.TimeOnly), times[i-1].Format(time.TimeOnly))
+		}
+		if generated.Second() == 0 {
+			onFullMinute++
+		}
+	}
+	if onFullMinute > 10 {
+		t.Errorf("Expected random seconds, got %d of %d times on the full minute", onFullMinute, len(times))
+	}
+}
+
+func TestGenerateCommitTimesLike(t *testing.T) {
+	day := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	at := func(hour, minute int) time.Time { return time.Date(2024, 1, 5, hour, minute, 0, 0, time.UTC) }
+	// A burst of three commits and one more four hours later
+	originals := []time.Time{at(9, 0), at(9, 2), at(9, 4), at(13, 0)}
+
+	tests := []struct {
+		name     string
+		preserve bool
+		expected []string
+	}{
+		{"even", false, []string{"09:00", "11:40", "14:20", "16:59"}},
+		{"preserved spacing", true, []string{"09:00", "09:04", "09:08", "16:59"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17, PreserveSpacing: test.preserve, Rand: rand.New(rand.NewSource(1))}
+			times := cfg.GenerateCommitTimesLike(day, originals, nil)
+			var result []string
+			for _, generated := range times {
+				result = append(result, generated.Format("15:04"))
+			}
+			if !slices.Equal(result, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestSpacing(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2024, 1, 5, 9, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		name      string
+		originals []time.Time
+		expected  []time.Duration
+	}{
+		{"evenly without originals", nil, []time.Duration{0, 30 * time.Minute, time.Hour}},
+		{"scaled to the day", []time.Time{at(0), at(10), at(20)}, []time.Duration{0, 30 * time.Minute, time.Hour}},
+		{"burst", []time.Time{at(0), at(1), at(20)}, []time.Duration{0, 3 * time.Minute, time.Hour}},
+		{"same time falls back to even", []time.Time{at(5), at(5), at(5)}, []time.Duration{0, 30 * time.Minute, time.Hour}},
+		{"out of order", []time.Time{at(0), at(20), at(10), at(20)}, []time.Duration{0, time.Hour, time.Hour, time.Hour}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := max(len(test.originals), 3)
+			if result := spacing(n, time.Hour, test.originals); !slices.Equal(result, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestMeetingGaps(t *testing.T) {
+	start := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 8, 17, 0, 0, 0, time.UTC)
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17, MeetingGaps: 3}
+
+	for seed := int64(0); seed < 200; seed++ {
+		cfg.Rand = rand.New(rand.NewSource(seed))
+		gaps := cfg.meetingGaps(start, end)
+		if len(gaps) < 1 || len(gaps) > 3 {
+			t.Fatalf("Seed %d: expected 1 to 3 gaps, got %v", seed, gaps)
+		}
+		var total time.Duration
+		for _, gap := range gaps {
+			length := gap.End.Sub(gap.Start)
+			if length < time.Hour || length > 2*time.Hour || gap.Start.Minute()%30 != 0 || gap.Start.Before(start) || gap.End.After(end) {
+				t.Errorf("Seed %d: expected a gap of one to two hours starting on the half hour within work hours, got %v", seed, gap)
+			}
+			total += length
+		}
+		if total > 4*time.Hour {
+			t.Errorf("Seed %d: expected gaps to take up at most half the day, got %s", seed, total)
+		}
+
+		// Without a gap, ten commits in eight hours leave no hour without a commit, including at the start and the
+		// end of the day
+		times := cfg.GenerateCommitTimesForDay(start.Truncate(24*time.Hour), 10, nil)
+		longest := max(times[0].Sub(start), end.Sub(times[len(times)-1]))
+		for i := 1; i < len(times); i++ {
+			if times[i].Before(times[i-1]) {
+				t.Fatalf("Seed %d: expected times in order, got %v", seed, times)
+			}
+			longest = max(longest, times[i].Sub(times[i-1]))
+		}
+		if longest < time.Hour {
+			t.Errorf("Seed %d: expected a break of at least an hour, got %v", seed, times)
+		}
+		if times[0].Before(start) || !times[len(times)-1].Before(end) {
+			t.Errorf("Seed %d: expected times within work hours, got %v", seed, times)
+		}
+	}
+}
+
+func TestFreeTime(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2024, 1, 8, hour, minute, 0, 0, time.UTC) }
+	cfg := Config{Busy: []Period{{at(10, 0), at(11, 0)}, {at(13, 0), at(14, 30)}}}
+
+	if free := cfg.freeDuration(at(9, 0), at(17, 0)); free != 330*time.Minute {
+		t.Errorf("Expected 5h30m of free time, got %s", free)
+	}
+	for offset, expected := range map[time.Duration]time.Time{
+		0:                 at(9, 0),
+		30 * time.Minute:  at(9, 30),
+		time.Hour:         at(11, 0),
+		3 * time.Hour:     at(14, 30),
+		330 * time.Minute: at(17, 0),
+	} {
+		if got := cfg.freeTime(at(9, 0), offset); !got.Equal(expected) {
+			t.Errorf("freeTime(%s) = %s, expected %s", offset, got.Format("15:04"), expected.Format("15:04"))
+		}
 	}
 }
@@ -0,0 +1,53 @@
+package cadence
+
+import (
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// Events lets a program embedding the package follow a rewrite without wrapping Apply. Every callback is optional
+// and is called synchronously, so a slow callback slows the rewrite down.
+type Events struct {
+	// OnPlanComputed is called with the plan before anything is rewritten. AmendHead passes a plan with the one
+	// commit it amends.
+	OnPlanComputed func(target *Target, plan Plan)
+	// OnCommitRewritten is called for every commit recreated, after RewriteOptions.OnCommit
+	OnCommitRewritten func(target *Target, commit git.Commit, result git.ReplayResult)
+	// OnRepoDone is called when Apply or AmendHead returns, with the number of commits rewritten and the error if the
+	// rewrite was refused or failed
+	OnRepoDone func(target *Target, rewritten int, err error)
+}
+
+// planComputed calls OnPlanComputed if it is set
+func (e Events) planComputed(target *Target, plan Plan) {
+	if e.OnPlanComputed != nil {
+		e.OnPlanComputed(target, plan)
+	}
+}
+
+// repoDone calls OnRepoDone if it is set
+func (e Events) repoDone(target *Target, rewritten int, err error) {
+	if e.OnRepoDone != nil {
+		e.OnRepoDone(target, rewritten, err)
+	}
+}
+
+// onReplay returns the callback that tells OnCommit and OnCommitRewritten about every replayed commit of target
+func (opts RewriteOptions) onReplay(target *Target) func(commit git.Commit, result git.ReplayResult) {
+	if opts.Events.OnCommitRewritten == nil {
+		return opts.OnCommit
+	}
+	return func(commit git.Commit, result git.ReplayResult) {
+		if opts.OnCommit != nil {
+			opts.OnCommit(commit, result)
+		}
+		opts.Events.OnCommitRewritten(target, commit, result)
+	}
+}
+
+// amendPlan is the plan AmendHead reports: head on its new day at newTime
+func amendPlan(head git.Commit, newTime time.Time) Plan {
+	day := time.Date(newTime.Year(), newTime.Month(), newTime.Day(), 0, 0, 0, 0, newTime.Location())
+	return Plan{Days: []DayPlan{{Day: day, Commits: []git.Commit{head}, Times: []time.Time{newTime}}}}
+}
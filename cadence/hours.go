@@ -0,0 +1,69 @@
+package cadence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HoursRule gives repositories whose path or remote URL matches Pattern their own work hours. Patterns are matched
+// like AuthorRule patterns, except that a pattern not starting with / or * also matches the end of a path or URL, so
+// "clientA/*" matches every repository in a clientA directory.
+type HoursRule struct {
+	Pattern   string
+	StartHour int
+	EndHour   int
+}
+
+// HoursMap picks the work hours of a repository. The first matching rule wins.
+type HoursMap []HoursRule
+
+// ParseHoursMap parses semicolon-separated "pattern=start-end" rules, e.g. "clientA/*=9-17;oss/*=20-23"
+func ParseHoursMap(s string) (HoursMap, error) {
+	var hoursMap HoursMap
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, hours, found := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+		from, to, isRange := strings.Cut(strings.TrimSpace(hours), "-")
+		start, startErr := strconv.Atoi(strings.TrimSpace(from))
+		end, endErr := strconv.Atoi(strings.TrimSpace(to))
+		if !found || pattern == "" || !isRange || startErr != nil || endErr != nil {
+			return nil, fmt.Errorf("invalid work hours rule %q: expected pattern=start-end", entry)
+		}
+		if start < 0 || end > 24 || start >= end {
+			return nil, fmt.Errorf("invalid work hours in %q: the day must start at 0 or later, end at 24 or earlier and start before it ends", entry)
+		}
+
+		hoursMap = append(hoursMap, HoursRule{Pattern: pattern, StartHour: start, EndHour: end})
+	}
+	return hoursMap, nil
+}
+
+// Lookup returns the first rule matching the repository path or one of its remote URLs
+func (m HoursMap) Lookup(repoPath string, remoteURLs []string) (HoursRule, bool) {
+	for _, rule := range m {
+		pattern := rule.Pattern
+		if !strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "*") {
+			pattern = "*/" + pattern
+		}
+		if matchPattern(rule.Pattern, repoPath) || matchPattern(pattern, repoPath) {
+			return rule, true
+		}
+		for _, url := range remoteURLs {
+			if matchPattern(rule.Pattern, url) || matchPattern(pattern, url) {
+				return rule, true
+			}
+		}
+	}
+	return HoursRule{}, false
+}
+
+// String returns the rule's work hours as HH:00-HH:00
+func (r HoursRule) String() string {
+	return fmt.Sprintf("%02d:00-%02d:00", r.StartHour, r.EndHour)
+}
@@ -0,0 +1,68 @@
+package cadence
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestParseHoursMap(t *testing.T) {
+	hoursMap, err := ParseHoursMap("clientA/*=9-17; oss/* = 20 - 23;")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(hoursMap) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(hoursMap))
+	}
+
+	expected := HoursRule{Pattern: "oss/*", StartHour: 20, EndHour: 23}
+	if hoursMap[1] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, hoursMap[1])
+	}
+
+	for _, invalid := range []string{"clientA/*", "=9-17", "oss/*=20", "oss/*=late", "oss/*=22-2", "oss/*=20-25", "oss/*=-1-8"} {
+		if _, err := ParseHoursMap(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestHoursMapLookup(t *testing.T) {
+	hoursMap := HoursMap{
+		{Pattern: "clientA/*", StartHour: 9, EndHour: 17},
+		{Pattern: "/home/me/oss/*", StartHour: 20, EndHour: 23},
+		{Pattern: "*github.com?acme/*", StartHour: 8, EndHour: 12},
+	}
+
+	tests := []struct {
+		name     string
+		repoPath string
+		remotes  []string
+		expected int
+		found    bool
+	}{
+		{"relative path match", "/home/me/work/clientA/api", nil, 9, true},
+		{"absolute path match", "/home/me/oss/tool", nil, 20, true},
+		{"remote match", "/home/me/work/tool", []string{"git@github.com:acme/tool.git"}, 8, true},
+		{"partial directory name", "/home/me/work/otherclientA/api", nil, 0, false},
+		{"no match", "/home/me/work/api", []string{"https://gitlab.com/acme/api"}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, found := hoursMap.Lookup(tt.repoPath, tt.remotes)
+			if found != tt.found || rule.StartHour != tt.expected {
+				t.Errorf("Expected start hour %d (found=%t), got %+v (found=%t)", tt.expected, tt.found, rule, found)
+			}
+		})
+	}
+}
+
+func TestHoursMapLookupWindowsPath(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("backslashes only separate paths on Windows")
+	}
+	hoursMap := HoursMap{{Pattern: "clientA/*", StartHour: 9, EndHour: 17}}
+	if rule, found := hoursMap.Lookup(`C:\Users\me\work\clientA\api`, nil); !found || rule.StartHour != 9 {
+		t.Errorf("Expected the clientA rule, got %+v (found=%t)", rule, found)
+	}
+}
@@ -0,0 +1,215 @@
+package cadence
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// Identity is the name and email recorded as a commit's author
+type Identity = git.Identity
+
+// AuthorRule gives repositories whose path or remote URL matches Pattern a specific identity.
+// In patterns * matches any run of characters (including /) and ? matches a single character.
+type AuthorRule struct {
+	Pattern  string
+	Identity Identity
+}
+
+// AuthorMap picks the author identity for a repository. The first matching rule wins.
+type AuthorMap []AuthorRule
+
+// ParseAuthorMap parses semicolon-separated "pattern=Name <email>" rules, e.g.
+// "/home/me/work/*=Jane Doe <jane@corp.example>;*github.com*=Jane <jane@personal.example>"
+func ParseAuthorMap(s string) (AuthorMap, error) {
+	var authorMap AuthorMap
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, identity, found := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !found || pattern == "" {
+			return nil, fmt.Errorf("invalid author rule %q: expected pattern=Name <email>", entry)
+		}
+
+		parsed, err := ParseIdentity(identity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity in author rule %q: expected Name <email>", entry)
+		}
+
+		authorMap = append(authorMap, AuthorRule{Pattern: pattern, Identity: parsed})
+	}
+	return authorMap, nil
+}
+
+// ParseIdentity parses "Name <email>", requiring both parts
+func ParseIdentity(s string) (Identity, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(s))
+	if err != nil || address.Name == "" {
+		return Identity{}, fmt.Errorf("invalid identity %q: expected Name <email>", strings.TrimSpace(s))
+	}
+	return Identity{Name: address.Name, Email: address.Address}, nil
+}
+
+// ParseCoAuthors parses a semicolon-separated list of "Name <email>" identities
+func ParseCoAuthors(s string) ([]Identity, error) {
+	var coAuthors []Identity
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		identity, err := ParseIdentity(entry)
+		if err != nil {
+			return nil, err
+		}
+		coAuthors = append(coAuthors, identity)
+	}
+	return coAuthors, nil
+}
+
+// Lookup returns the identity of the first rule matching the repository path or one of its remote URLs
+func (m AuthorMap) Lookup(repoPath string, remoteURLs []string) (Identity, bool) {
+	for _, rule := range m {
+		if matchPattern(rule.Pattern, repoPath) {
+			return rule.Identity, true
+		}
+		for _, url := range remoteURLs {
+			if matchPattern(rule.Pattern, url) {
+				return rule.Identity, true
+			}
+		}
+	}
+	return Identity{}, false
+}
+
+// matchPattern reports whether the whole of s matches a glob pattern where * also matches /. Paths and patterns are
+// compared with forward slashes, so "clientA/*" also matches repositories below C:\work\clientA on Windows.
+func matchPattern(pattern, s string) bool {
+	pattern, s = filepath.ToSlash(pattern), filepath.ToSlash(s)
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String()).MatchString(s)
+}
+
+// mailmapAuthors returns an author override for git.ReplayOptions that keeps the original author of every
+// commit whose identity doesn't map to the same person as identity in the repository's .mailmap, so that
+// only your own commits are re-attributed. It returns nil when the repository has no mailmap.
+func mailmapAuthors(ctx context.Context, repoPath string, commits []git.Commit, identity Identity) (func(git.Commit) (Identity, bool), error) {
+	hasMailmap, err := git.HasMailmap(ctx, repoPath)
+	if err != nil || !hasMailmap {
+		return nil, err
+	}
+
+	identity, err = completeIdentity(ctx, repoPath, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	identities := []Identity{identity}
+	seen := map[Identity]bool{identity: true}
+	for _, commit := range commits {
+		author := Identity{Name: commit.Author, Email: commit.Email}
+		if !seen[author] {
+			seen[author] = true
+			identities = append(identities, author)
+		}
+	}
+
+	canonical, err := git.CheckMailmap(ctx, repoPath, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	mine := make(map[Identity]bool)
+	for i, author := range identities {
+		if strings.EqualFold(canonical[i].Email, canonical[0].Email) {
+			mine[author] = true
+		}
+	}
+
+	return func(commit git.Commit) (Identity, bool) {
+		author := Identity{Name: commit.Author, Email: commit.Email}
+		if mine[author] {
+			return Identity{}, false
+		}
+		return author, true
+	}, nil
+}
+
+// completeIdentity fills in whatever NEW_COMMIT_AUTHOR_* left out of identity the same way git will when the commits
+// are recreated
+func completeIdentity(ctx context.Context, repoPath string, identity Identity) (Identity, error) {
+	if identity.Name != "" && identity.Email != "" {
+		return identity, nil
+	}
+	configured, err := git.GetCommitterIdentity(ctx, repoPath)
+	if err != nil {
+		return identity, err
+	}
+	if identity.Name == "" {
+		identity.Name = configured.Name
+	}
+	if identity.Email == "" {
+		identity.Email = configured.Email
+	}
+	return identity, nil
+}
+
+// MismatchedAuthors returns the commits whose author isn't identity, with the fields identity leaves empty taken
+// from the repository's git config. When the repository has a mailmap, authors are compared in their canonical form,
+// so commits made under an alias the mailmap maps to identity are not reported.
+func MismatchedAuthors(ctx context.Context, repoPath string, commits []git.Commit, identity Identity) ([]git.Commit, error) {
+	identity, err := completeIdentity(ctx, repoPath, identity)
+	if err != nil {
+		return nil, err
+	}
+	canonicalOf := func(author Identity) Identity { return author }
+	hasMailmap, err := git.HasMailmap(ctx, repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if hasMailmap {
+		identities := []Identity{identity}
+		for _, commit := range commits {
+			identities = append(identities, Identity{Name: commit.Author, Email: commit.Email})
+		}
+		canonical, err := git.CheckMailmap(ctx, repoPath, identities)
+		if err != nil {
+			return nil, err
+		}
+		mapped := make(map[Identity]Identity)
+		for i, author := range identities {
+			mapped[author] = canonical[i]
+		}
+		canonicalOf = func(author Identity) Identity { return mapped[author] }
+	}
+
+	expected := canonicalOf(identity)
+	var mismatched []git.Commit
+	for _, commit := range commits {
+		author := canonicalOf(Identity{Name: commit.Author, Email: commit.Email})
+		if author.Name != expected.Name || !strings.EqualFold(author.Email, expected.Email) {
+			mismatched = append(mismatched, commit)
+		}
+	}
+	return mismatched, nil
+}
@@ -0,0 +1,164 @@
+package cadence
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+func TestParseAuthorMap(t *testing.T) {
+	authorMap, err := ParseAuthorMap("/home/me/work/*=Jane Doe <jane@corp.example>; *github.com*=Jane <jane@personal.example>;")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(authorMap) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(authorMap))
+	}
+
+	expected := AuthorRule{Pattern: "/home/me/work/*", Identity: Identity{Name: "Jane Doe", Email: "jane@corp.example"}}
+	if authorMap[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, authorMap[0])
+	}
+
+	for _, invalid := range []string{"no-identity", "=Jane <jane@example.com>", "/work/*=jane@example.com", "/work/*=Jane <not-an-email>"} {
+		if _, err := ParseAuthorMap(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseCoAuthors(t *testing.T) {
+	coAuthors, err := ParseCoAuthors("Sam Lee <sam@example.com>; Alex Kim <alex@example.com>;")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Identity{{Name: "Sam Lee", Email: "sam@example.com"}, {Name: "Alex Kim", Email: "alex@example.com"}}
+	if len(coAuthors) != len(expected) || coAuthors[0] != expected[0] || coAuthors[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, coAuthors)
+	}
+
+	if coAuthors, err := ParseCoAuthors(""); err != nil || len(coAuthors) != 0 {
+		t.Errorf("Expected no co-authors for an empty list, got %v (err %v)", coAuthors, err)
+	}
+	for _, invalid := range []string{"sam@example.com", "Sam Lee <not-an-email>", "Sam <sam@example.com>;Alex"} {
+		if _, err := ParseCoAuthors(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestAuthorMapLookup(t *testing.T) {
+	authorMap := AuthorMap{
+		{Pattern: "/home/me/work/*", Identity: Identity{Name: "Work", Email: "me@corp.example"}},
+		{Pattern: "*github.com?me/*", Identity: Identity{Name: "Personal", Email: "me@personal.example"}},
+	}
+
+	tests := []struct {
+		name     string
+		repoPath string
+		remotes  []string
+		expected string
+		found    bool
+	}{
+		{"path match", "/home/me/work/api", nil, "Work", true},
+		{"nested path match", "/home/me/work/clients/a/api", nil, "Work", true},
+		{"remote match", "/home/me/oss/tool", []string{"git@github.com:me/tool.git"}, "Personal", true},
+		{"first rule wins", "/home/me/work/fork", []string{"https://github.com/me/fork"}, "Work", true},
+		{"no match", "/home/me/oss/tool", []string{"https://gitlab.com/me/tool"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, found := authorMap.Lookup(tt.repoPath, tt.remotes)
+			if found != tt.found || identity.Name != tt.expected {
+				t.Errorf("Lookup(%q, %v) = %+v, %t; expected %q, %t", tt.repoPath, tt.remotes, identity, found, tt.expected, tt.found)
+			}
+		})
+	}
+}
+
+func TestMailmapAuthors(t *testing.T) {
+	ctx := context.Background()
+	repo := t.TempDir()
+	for _, args := range [][]string{{"init"}, {"config", "user.name", "Jane"}, {"config", "user.email", "jane@corp.example"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, output)
+		}
+	}
+
+	mine := git.Commit{Author: "jd", Email: "jane@old.example"}
+	current := git.Commit{Author: "Jane Doe", Email: "jane@corp.example"}
+	coworker := git.Commit{Author: "Bob", Email: "bob@example.com"}
+	commits := []git.Commit{mine, current, coworker}
+	identity := Identity{Name: "Jane Doe", Email: "jane@corp.example"}
+
+	author, err := mailmapAuthors(ctx, repo, commits, identity)
+	if err != nil || author != nil {
+		t.Fatalf("Expected no override without a mailmap (err %v)", err)
+	}
+
+	mailmap := "Jane Doe <jane@corp.example> <jane@old.example>\n"
+	if err := os.WriteFile(filepath.Join(repo, ".mailmap"), []byte(mailmap), 0644); err != nil {
+		t.Fatalf("Failed to write .mailmap: %v", err)
+	}
+
+	// Only the email is configured here; the name comes from git config
+	author, err = mailmapAuthors(ctx, repo, commits, Identity{Email: "jane@corp.example"})
+	if err != nil || author == nil {
+		t.Fatalf("Expected an author override (err %v)", err)
+	}
+
+	for _, commit := range []git.Commit{mine, current} {
+		if _, ok := author(commit); ok {
+			t.Errorf("Expected %s <%s> to be re-attributed", commit.Author, commit.Email)
+		}
+	}
+	kept, ok := author(coworker)
+	if !ok || kept != (Identity{Name: "Bob", Email: "bob@example.com"}) {
+		t.Errorf("Expected co-worker's commit to keep its author, got %v (%v)", kept, ok)
+	}
+}
+
+func TestMismatchedAuthors(t *testing.T) {
+	ctx := context.Background()
+	repo := t.TempDir()
+	for _, args := range [][]string{{"init"}, {"config", "user.name", "Jane Doe"}, {"config", "user.email", "jane@corp.example"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, output)
+		}
+	}
+
+	current := git.Commit{Hash: "a", Author: "Jane Doe", Email: "Jane@Corp.example"}
+	alias := git.Commit{Hash: "b", Author: "jd", Email: "jane@old.example"}
+	coworker := git.Commit{Hash: "c", Author: "Bob", Email: "bob@example.com"}
+	commits := []git.Commit{current, alias, coworker}
+
+	// Only the email is configured here; the name comes from git config
+	mismatched, err := MismatchedAuthors(ctx, repo, commits, Identity{Email: "jane@corp.example"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(mismatched) != 2 || mismatched[0].Hash != "b" || mismatched[1].Hash != "c" {
+		t.Errorf("Expected the alias and the co-worker without a mailmap, got %v", mismatched)
+	}
+
+	mailmap := "Jane Doe <jane@corp.example> <jane@old.example>\n"
+	if err := os.WriteFile(filepath.Join(repo, ".mailmap"), []byte(mailmap), 0644); err != nil {
+		t.Fatalf("Failed to write .mailmap: %v", err)
+	}
+	mismatched, err = MismatchedAuthors(ctx, repo, commits, Identity{Email: "jane@corp.example"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(mismatched) != 1 || mismatched[0].Hash != "c" {
+		t.Errorf("Expected only the co-worker with a mailmap, got %v", mismatched)
+	}
+}
@@ -0,0 +1,93 @@
+package cadence
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// ticketPattern finds an issue key such as ABC-123 in a branch name
+var ticketPattern = regexp.MustCompile(`[A-Z][A-Z0-9]+-[0-9]+`)
+
+// wipPattern matches work-in-progress markers at the start of a subject: "WIP", "WIP:", "[WIP]", "wip -" and similar
+var wipPattern = regexp.MustCompile(`(?i)^\s*(\[wip\]|\(wip\)|wip\b)\s*[:\-]?\s*`)
+
+// MessageData is what a message template is executed with
+type MessageData struct {
+	// Message is the full original commit message, Subject its first line and Body the rest
+	Message string
+	Subject string
+	Body    string
+	// Branch is the branch being rewritten and Ticket the first issue key (e.g. ABC-123) in its name
+	Branch string
+	Ticket string
+	Hash   string
+	Author string
+	Email  string
+}
+
+// MessageTemplate rewrites commit messages with a text/template
+type MessageTemplate struct {
+	tmpl *template.Template
+}
+
+// messageFuncs are the helpers available to message templates
+var messageFuncs = template.FuncMap{
+	"stripWIP":  StripWIP,
+	"hasPrefix": strings.HasPrefix,
+	"trim":      strings.TrimSpace,
+	"replace": func(pattern, replacement, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(s, replacement), nil
+	},
+}
+
+// ParseMessageTemplate parses a commit message template, e.g.
+// `{{if and .Ticket (not (hasPrefix .Subject .Ticket))}}{{.Ticket}}: {{end}}{{stripWIP .Message}}`.
+// An empty text returns nil, which leaves messages unchanged.
+func ParseMessageTemplate(text string) (*MessageTemplate, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("message").Funcs(messageFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
+	}
+	return &MessageTemplate{tmpl: tmpl}, nil
+}
+
+// Render executes the template for a commit whose current message is message
+func (t *MessageTemplate) Render(commit git.Commit, message string, branch string) (string, error) {
+	message = strings.TrimRight(message, "\n")
+	subject, body, _ := strings.Cut(message, "\n")
+	data := MessageData{
+		Message: message,
+		Subject: subject,
+		Body:    strings.TrimLeft(body, "\n"),
+		Branch:  branch,
+		Ticket:  ticketPattern.FindString(branch),
+		Hash:    commit.Hash,
+		Author:  commit.Author,
+		Email:   commit.Email,
+	}
+
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render message for %s: %w", commit.Hash, err)
+	}
+	if strings.TrimSpace(b.String()) == "" {
+		return "", fmt.Errorf("message template produced an empty message for %s", commit.Hash)
+	}
+	return b.String(), nil
+}
+
+// StripWIP removes a work-in-progress marker from the start of a message
+func StripWIP(message string) string {
+	return wipPattern.ReplaceAllString(message, "")
+}
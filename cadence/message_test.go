@@ -0,0 +1,69 @@
+package cadence
+
+import (
+	"testing"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+func TestStripWIP(t *testing.T) {
+	tests := map[string]string{
+		"WIP: add parser":     "add parser",
+		"[WIP] add parser":    "add parser",
+		"wip - add parser":    "add parser",
+		"(wip) add parser":    "add parser",
+		"Wipe the cache":      "Wipe the cache",
+		"Add WIP limit to UI": "Add WIP limit to UI",
+	}
+	for input, expected := range tests {
+		if got := StripWIP(input); got != expected {
+			t.Errorf("StripWIP(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestMessageTemplateRender(t *testing.T) {
+	tmpl, err := ParseMessageTemplate(`{{if and .Ticket (not (hasPrefix .Subject .Ticket))}}{{.Ticket}}: {{end}}{{stripWIP .Message}}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	commit := git.Commit{Hash: "abc123", Author: "Jane", Email: "jane@example.com"}
+	tests := []struct {
+		message  string
+		branch   string
+		expected string
+	}{
+		{"WIP: add parser\n\nHandles nested lists\n", "feature/PROJ-42-parser", "PROJ-42: add parser\n\nHandles nested lists"},
+		{"PROJ-42: add parser\n", "feature/PROJ-42-parser", "PROJ-42: add parser"},
+		{"add parser\n", "main", "add parser"},
+	}
+	for _, tt := range tests {
+		got, err := tmpl.Render(commit, tt.message, tt.branch)
+		if err != nil {
+			t.Fatalf("Render failed: %v", err)
+		}
+		if got != tt.expected {
+			t.Errorf("Render(%q, %q) = %q, expected %q", tt.message, tt.branch, got, tt.expected)
+		}
+	}
+
+	empty, err := ParseMessageTemplate(`{{stripWIP .Subject}}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := empty.Render(commit, "WIP\n", "main"); err == nil {
+		t.Error("Expected error for an empty rendered message")
+	}
+}
+
+func TestParseMessageTemplate(t *testing.T) {
+	if tmpl, err := ParseMessageTemplate("  "); tmpl != nil || err != nil {
+		t.Errorf("Expected no template for blank text, got %v (err %v)", tmpl, err)
+	}
+	for _, invalid := range []string{"{{.Subject", "{{unknownFunc .Subject}}"} {
+		if _, err := ParseMessageTemplate(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
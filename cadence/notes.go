@@ -0,0 +1,137 @@
+package cadence
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// NotesRef holds the notes code-cadence attaches to the commits it rewrote. git log only shows notes from
+// refs/notes/commits by default, so they stay out of the way unless asked for with --notes=code-cadence.
+const NotesRef = "refs/notes/code-cadence"
+
+// rewrittenNote is the note line that marks a commit as already rewritten
+const rewrittenNote = "Rewritten-By: code-cadence"
+
+// NoteOptions picks what the notes attached to rewritten commits record
+type NoteOptions struct {
+	// Mark marks the commits as rewritten, so later runs can leave them alone
+	Mark bool
+	// OriginalDates records the author and committer dates each commit was first made with, using the same keys
+	// as the git.OriginalDateTrailer and git.OriginalCommitterDateTrailer trailers
+	OriginalDates bool
+	// Identity records the notes commit; empty fields fall back to the identity git is configured with
+	Identity Identity
+}
+
+// Rewritten is a commit as it was before a rewrite and the hash of its recreated copy
+type Rewritten struct {
+	Original git.Commit
+	NewHash  string
+}
+
+// Marks are the commits marked as rewritten by code-cadence, by full hash
+type Marks []string
+
+// LoadMarks returns which of the commits code-cadence marked as rewritten
+func LoadMarks(ctx context.Context, repoPath string, commits []git.Commit) (Marks, error) {
+	notes, err := git.GetNotes(ctx, repoPath, NotesRef, commitHashes(commits))
+	if err != nil {
+		return nil, err
+	}
+	var marks Marks
+	for hash, note := range notes {
+		if strings.Contains(note, rewrittenNote) {
+			marks = append(marks, hash)
+		}
+	}
+	return marks, nil
+}
+
+// Has reports whether commit, whose hash may be abbreviated, is marked
+func (m Marks) Has(commit git.Commit) bool {
+	for _, hash := range m {
+		if commit.Hash != "" && strings.HasPrefix(hash, commit.Hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteNotes attaches a note to every commit a rewrite created. Original dates found in the note of the commit it was
+// recreated from are carried over, so they always are the dates the commit was first made with.
+func WriteNotes(ctx context.Context, repoPath string, rewritten []Rewritten, opts NoteOptions) error {
+	if !opts.Mark && !opts.OriginalDates {
+		return nil
+	}
+
+	var previous map[string]string
+	if opts.OriginalDates {
+		originals := make([]git.Commit, len(rewritten))
+		for i, r := range rewritten {
+			originals[i] = r.Original
+		}
+		var err error
+		if previous, err = git.GetNotes(ctx, repoPath, NotesRef, commitHashes(originals)); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range rewritten {
+		var lines []string
+		if opts.Mark {
+			lines = append(lines, rewrittenNote)
+		}
+		if opts.OriginalDates {
+			dates, err := originalDateLines(ctx, repoPath, r.Original, previous)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, dates...)
+		}
+		if err := git.AddNote(ctx, repoPath, NotesRef, r.NewHash, strings.Join(lines, "\n"), opts.Identity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// originalDateLines returns the note lines recording the original dates of commit, taken from its own note when an
+// earlier rewrite recorded them and from the commit itself otherwise
+func originalDateLines(ctx context.Context, repoPath string, commit git.Commit, previous map[string]string) ([]string, error) {
+	for hash, note := range previous {
+		if !strings.HasPrefix(hash, commit.Hash) {
+			continue
+		}
+		var lines []string
+		for _, line := range strings.Split(note, "\n") {
+			if strings.HasPrefix(line, git.OriginalDateTrailer+":") || strings.HasPrefix(line, git.OriginalCommitterDateTrailer+":") {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			return lines, nil
+		}
+	}
+
+	authorDate, committerDate, err := git.GetCommitDates(ctx, repoPath, commit.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record the original dates of %s: %w", commit.Hash, err)
+	}
+	return []string{
+		git.OriginalDateTrailer + ": " + authorDate.Format(time.RFC3339),
+		git.OriginalCommitterDateTrailer + ": " + committerDate.Format(time.RFC3339),
+	}, nil
+}
+
+// commitHashes returns the hashes of commits
+func commitHashes(commits []git.Commit) []string {
+	hashes := make([]string, len(commits))
+	for i, commit := range commits {
+		hashes[i] = commit.Hash
+	}
+	return hashes
+}
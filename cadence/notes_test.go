@@ -0,0 +1,21 @@
+package cadence
+
+import (
+	"testing"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+func TestMarksHas(t *testing.T) {
+	marks := Marks{"4a869ab1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7"}
+
+	if !marks.Has(git.Commit{Hash: "4a869ab"}) {
+		t.Error("Expected an abbreviated hash of a marked commit to match")
+	}
+	if marks.Has(git.Commit{Hash: "f64b4b2"}) {
+		t.Error("Expected an unmarked commit not to match")
+	}
+	if marks.Has(git.Commit{}) {
+		t.Error("Expected a commit without a hash not to match")
+	}
+}
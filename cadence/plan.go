@@ -0,0 +1,402 @@
+package cadence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// ErrNoEligibleDays is returned when every day of a span is excluded by the skipped weekdays
+var ErrNoEligibleDays = errors.New("no eligible days in range")
+
+// DayPlan holds the commits scheduled on a single day and their new times, oldest first
+type DayPlan struct {
+	Day     time.Time
+	Commits []git.Commit
+	Times   []time.Time
+}
+
+// Plan is the schedule of new times for a repository's unpushed commits
+type Plan struct {
+	Days []DayPlan
+}
+
+// Commits returns all planned commits in the order they will be recreated (oldest first)
+func (p Plan) Commits() []git.Commit {
+	var commits []git.Commit
+	for _, day := range p.Days {
+		commits = append(commits, day.Commits...)
+	}
+	return commits
+}
+
+// Times returns the new times matching Commits()
+func (p Plan) Times() []time.Time {
+	var times []time.Time
+	for _, day := range p.Days {
+		times = append(times, day.Times...)
+	}
+	return times
+}
+
+// PlanByDay keeps every commit on its original day and spreads the commits of each day across the work day, keeping
+// their original spacing with PreserveSpacing. Commits are expected newest first, as returned by git.GetUnpushedCommits.
+func (c Config) PlanByDay(commits []git.Commit) (Plan, error) {
+	commitsByDay := c.groupCommitsByDay(commits)
+
+	// Sort days to process them in chronological order (earliest to latest)
+	var sortedDays []string
+	for dayStr := range commitsByDay {
+		sortedDays = append(sortedDays, dayStr)
+	}
+	sort.Strings(sortedDays) // YYYY-MM-DD format sorts chronologically
+
+	var plan Plan
+	for _, dayStr := range sortedDays {
+		dayCommits := commitsByDay[dayStr]
+
+		// Get timezone from the first commit of the day
+		firstCommit := dayCommits[0]
+		firstCommitTime, err := c.commitTime(firstCommit)
+		if err != nil {
+			return Plan{}, fmt.Errorf("failed to parse commit time %s: %w", firstCommit.DateTime, err)
+		}
+
+		// Parse the day to get the actual date in the commit's timezone
+		day := time.Date(firstCommitTime.Year(), firstCommitTime.Month(), firstCommitTime.Day(), 0, 0, 0, 0, firstCommitTime.Location())
+
+		// Reverse commits so older commits get earlier times
+		reversedCommits := make([]git.Commit, len(dayCommits))
+		for i, commit := range dayCommits {
+			reversedCommits[len(dayCommits)-1-i] = commit
+		}
+
+		originals := make([]time.Time, len(reversedCommits))
+		for i, commit := range reversedCommits {
+			if originals[i], err = c.commitTime(commit); err != nil {
+				return Plan{}, fmt.Errorf("failed to parse commit time %s: %w", commit.DateTime, err)
+			}
+		}
+
+		plan.Days = append(plan.Days, DayPlan{
+			Day:     day,
+			Commits: reversedCommits,
+			Times:   c.GenerateCommitTimesLike(day, originals, nil),
+		})
+	}
+
+	return plan, nil
+}
+
+// PlanSpan spreads commits across all eligible days from the oldest commit's day through today,
+// skipping the configured weekdays, as the configured Strategy allocates them. Commits are expected
+// newest first. With MaxSpanDays only the most recent eligible days are used, and with MaxCommitsPerDay no day gets
+// more commits than the limit allows. With PreserveSpacing the commits of each day keep their original spacing. If lastPushed is set, no commit on the first day is scheduled before it.
+func (c Config) PlanSpan(commits []git.Commit, lastPushed *time.Time) (Plan, error) {
+	if len(commits) == 0 {
+		return Plan{}, nil
+	}
+
+	oldest := commits[len(commits)-1]
+	oldestTime, err := c.commitTime(oldest)
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to parse oldest commit time %s: %w", oldest.DateTime, err)
+	}
+	loc := oldestTime.Location()
+	now := c.now().In(loc)
+
+	startDay := time.Date(oldestTime.Year(), oldestTime.Month(), oldestTime.Day(), 0, 0, 0, 0, loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if now.Hour() < c.WorkDayStartHour && today.After(startDay) {
+		// Today's work day hasn't started, so it has no time left that isn't in the future
+		today = today.AddDate(0, 0, -1)
+	}
+
+	// Build list of eligible days [startDay..today], skipping configured weekdays and blackout dates
+	days := slices.DeleteFunc(EnumerateDaysSkipping(startDay, today, c.SkipWeekdays), func(day time.Time) bool {
+		return c.skipsDay(day)
+	})
+	if len(days) == 0 {
+		return Plan{}, ErrNoEligibleDays
+	}
+	if c.MaxSpanDays > 0 && len(days) > c.MaxSpanDays {
+		// Compress old commits into the most recent days rather than stretching them over months
+		days = days[len(days)-c.MaxSpanDays:]
+	}
+
+	// Order commits oldest -> newest for allocation
+	ordered := make([]git.Commit, len(commits))
+	for i := range commits {
+		ordered[i] = commits[len(commits)-1-i]
+	}
+
+	times := make([]time.Time, len(ordered))
+	for i, commit := range ordered {
+		if times[i], err = c.commitTime(commit); err != nil {
+			return Plan{}, fmt.Errorf("failed to parse commit time %s: %w", commit.DateTime, err)
+		}
+	}
+	alloc := c.strategy().Allocate(c, times, days)
+	if room := c.capacity(days); room != nil {
+		if err := limitAllocation(alloc, room); err != nil {
+			return Plan{}, err
+		}
+	}
+
+	var plan Plan
+	cursor := 0
+	for i, day := range days {
+		k := alloc[i]
+		if k == 0 {
+			continue
+		}
+		sub := ordered[cursor : cursor+k]
+		cursor += k
+
+		// For the first day, use the last pushed commit time as earliest time
+		var earliestTime *time.Time
+		if i == 0 && lastPushed != nil {
+			earliestTime = lastPushed
+		}
+
+		plan.Days = append(plan.Days, DayPlan{
+			Day:     day,
+			Commits: sub,
+			Times:   c.GenerateCommitTimesLike(day, times[cursor-k:cursor], earliestTime),
+		})
+	}
+
+	return plan, nil
+}
+
+// PlanWeekendShift moves only the commits made on skipped weekdays or blackout dates to the nearest eligible day,
+// keeping their time of day, and leaves every other commit at its original time. Ties between an earlier and a later
+// day go to the earlier one, and days after today are never used. Shifted commits are nudged a minute at a time where needed
+// so the history stays in its original order and, if earliest is set, after it. Commits are expected newest first.
+func (c Config) PlanWeekendShift(commits []git.Commit, earliest *time.Time) (Plan, error) {
+	if len(commits) == 0 {
+		return Plan{}, nil
+	}
+	if len(c.SkipWeekdays) >= 7 {
+		return Plan{}, ErrNoEligibleDays
+	}
+
+	// Order commits oldest -> newest and pair each with its original time
+	ordered := make([]git.Commit, len(commits))
+	original := make([]time.Time, len(commits))
+	for i := range commits {
+		commit := commits[len(commits)-1-i]
+		t, err := c.commitTime(commit)
+		if err != nil {
+			return Plan{}, fmt.Errorf("failed to parse commit time %s: %w", commit.DateTime, err)
+		}
+		ordered[i] = commit
+		original[i] = t
+	}
+
+	times := make([]time.Time, len(ordered))
+	prev := earliest
+	for i, t := range original {
+		if !c.skipsDay(t) {
+			times[i] = t
+			prev = &times[i]
+			continue
+		}
+
+		shifted := c.nearestEligibleDay(t)
+		if prev != nil && !shifted.After(*prev) {
+			shifted = prev.Add(time.Minute)
+		}
+		// Stay ahead of the next commit that keeps its time, leaving a minute for each shifted commit in between
+		for j := i + 1; j < len(original); j++ {
+			if !c.skipsDay(original[j]) {
+				if limit := original[j].Add(-time.Duration(j-i) * time.Minute); !shifted.Before(limit) {
+					shifted = limit
+				}
+				break
+			}
+		}
+		times[i] = shifted
+		prev = &times[i]
+	}
+
+	return planFromTimes(ordered, times), nil
+}
+
+// PlanShift moves every commit by the same offset, keeping the gaps between them and their timezone offsets.
+// It refuses to move a commit into the future. Commits are expected newest first.
+func (c Config) PlanShift(commits []git.Commit, by time.Duration) (Plan, error) {
+	now := c.now()
+	ordered := make([]git.Commit, len(commits))
+	times := make([]time.Time, len(commits))
+	for i := range commits {
+		commit := commits[len(commits)-1-i]
+		t, err := c.commitTime(commit)
+		if err != nil {
+			return Plan{}, fmt.Errorf("failed to parse commit time %s: %w", commit.DateTime, err)
+		}
+		shifted := t.Add(by)
+		if shifted.After(now) {
+			return Plan{}, fmt.Errorf("shifting %s by %s would move it into the future (%s)", commit.Hash, by, shifted.Format("2006-01-02 15:04:05"))
+		}
+		ordered[i] = commit
+		times[i] = shifted
+	}
+	return planFromTimes(ordered, times), nil
+}
+
+// PlanReorder gives new times only to the commits that break the chronological order of the history, such as
+// commits an interactive rebase moved, and keeps every other commit at its original time. The commits kept are the
+// longest sequence, not necessarily adjacent, whose times already never decrease, so as few commits as possible are
+// moved, and each moved commit is spread evenly between the kept commits around it in its own timezone. If earliest
+// is set, commits before it are moved too. Commits are expected newest first.
+func (c Config) PlanReorder(commits []git.Commit, earliest *time.Time) (Plan, error) {
+	ordered := make([]git.Commit, len(commits))
+	original := make([]time.Time, len(commits))
+	for i := range commits {
+		commit := commits[len(commits)-1-i]
+		t, err := c.commitTime(commit)
+		if err != nil {
+			return Plan{}, fmt.Errorf("failed to parse commit time %s: %w", commit.DateTime, err)
+		}
+		ordered[i] = commit
+		original[i] = t
+	}
+
+	keep := longestOrderedRun(original, earliest)
+	times := make([]time.Time, len(original))
+	for i := 0; i < len(original); {
+		if keep[i] {
+			times[i] = original[i]
+			i++
+			continue
+		}
+
+		// Commits i..end-1 are out of order and go between the kept commits around them
+		end := i
+		for end < len(original) && !keep[end] {
+			end++
+		}
+		n := end - i
+		var lower, upper time.Time
+		switch {
+		case i > 0:
+			lower = times[i-1]
+		case earliest != nil:
+			lower = *earliest
+		}
+		if end < len(original) {
+			upper = original[end]
+		} else {
+			upper = lower.Add(time.Duration(n+1) * time.Minute)
+			if now := c.now(); upper.After(now) && now.After(lower) {
+				upper = now
+			}
+		}
+		if lower.IsZero() {
+			lower = upper.Add(-time.Duration(n+1) * time.Minute)
+		}
+
+		step := upper.Sub(lower) / time.Duration(n+1)
+		for j := range n {
+			times[i+j] = lower.Add(step * time.Duration(j+1)).Truncate(time.Second).In(original[i+j].Location())
+		}
+		i = end
+	}
+
+	return planFromTimes(ordered, times), nil
+}
+
+// longestOrderedRun marks the longest sequence of times, oldest first, that never decreases and, if earliest is set,
+// doesn't start before it
+func longestOrderedRun(times []time.Time, earliest *time.Time) []bool {
+	// tails[k] is the index of the smallest last time of an ordered sequence of length k+1 found so far
+	var tails []int
+	prev := make([]int, len(times))
+	for i, t := range times {
+		prev[i] = -1
+		if earliest != nil && t.Before(*earliest) {
+			continue
+		}
+		k := sort.Search(len(tails), func(k int) bool { return times[tails[k]].After(t) })
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	keep := make([]bool, len(times))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			keep[i] = true
+		}
+	}
+	return keep
+}
+
+// Include returns the plan extended with the given commits (newest first) it doesn't schedule, kept at their
+// original times, so that a subset of the commits can be rescheduled while the rest are recreated unchanged
+func (p Plan) Include(commits []git.Commit) (Plan, error) {
+	planned := make(map[string]time.Time)
+	for _, day := range p.Days {
+		for i, commit := range day.Commits {
+			planned[commit.Hash] = day.Times[i]
+		}
+	}
+
+	ordered := make([]git.Commit, len(commits))
+	times := make([]time.Time, len(commits))
+	for i := range commits {
+		commit := commits[len(commits)-1-i]
+		t, ok := planned[commit.Hash]
+		if !ok {
+			var err error
+			if t, err = commit.Time(); err != nil {
+				return Plan{}, fmt.Errorf("failed to parse commit time %s: %w", commit.DateTime, err)
+			}
+		}
+		ordered[i] = commit
+		times[i] = t
+	}
+	return planFromTimes(ordered, times), nil
+}
+
+// planFromTimes groups commits, oldest first, and their already computed times into days
+func planFromTimes(ordered []git.Commit, times []time.Time) Plan {
+	var plan Plan
+	for i, commit := range ordered {
+		t := times[i]
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		if n := len(plan.Days); n == 0 || !plan.Days[n-1].Day.Equal(day) {
+			plan.Days = append(plan.Days, DayPlan{Day: day})
+		}
+		last := &plan.Days[len(plan.Days)-1]
+		last.Commits = append(last.Commits, commit)
+		last.Times = append(last.Times, t)
+	}
+	return plan
+}
+
+// nearestEligibleDay returns t moved by whole days to the closest day that isn't skipped, never into the future
+func (c Config) nearestEligibleDay(t time.Time) time.Time {
+	now := c.now()
+	// A run of blackout dates can cover more than a week
+	for d := 1; d < maxBlackoutRange+7; d++ {
+		// Check the earlier day first so it wins a tie
+		if before := t.AddDate(0, 0, -d); !c.skipsDay(before) {
+			return before
+		}
+		if after := t.AddDate(0, 0, d); !c.skipsDay(after) && !after.After(now) {
+			return after
+		}
+	}
+	return t
+}
@@ -0,0 +1,485 @@
+package cadence
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/holiday"
+)
+
+func TestPlanByDay(t *testing.T) {
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17, Rand: rand.New(rand.NewSource(1))}
+
+	// Newest first, as returned by git.GetUnpushedCommits
+	commits := []git.Commit{
+		{Hash: "c3", DateTime: "2024-01-02 23:00:00 +0200"},
+		{Hash: "c2", DateTime: "2024-01-01 22:00:00 +0200"},
+		{Hash: "c1", DateTime: "2024-01-01 02:00:00 +0200"},
+	}
+
+	plan, err := cfg.PlanByDay(commits)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(plan.Days) != 2 {
+		t.Fatalf("Expected 2 days, got %d", len(plan.Days))
+	}
+
+	planned := plan.Commits()
+	expectedOrder := []string{"c1", "c2", "c3"}
+	for i, hash := range expectedOrder {
+		if planned[i].Hash != hash {
+			t.Errorf("Expected commit %d to be %s, got %s", i, hash, planned[i].Hash)
+		}
+	}
+
+	times := plan.Times()
+	if len(times) != len(planned) {
+		t.Fatalf("Expected %d times, got %d", len(planned), len(times))
+	}
+	for i, tm := range times {
+		if tm.Hour() < 9 || tm.Hour() >= 17 {
+			t.Errorf("Time %d (%s) is outside work hours", i, tm.Format("15:04"))
+		}
+		if _, offset := tm.Zone(); offset != 2*60*60 {
+			t.Errorf("Time %d lost its original timezone offset: %s", i, tm)
+		}
+	}
+}
+
+func TestPlanByDayLocation(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17, Rand: rand.New(rand.NewSource(1)), Location: tokyo}
+
+	// Both commits fall on January 2nd in Tokyo
+	commits := []git.Commit{
+		{Hash: "c2", DateTime: "2024-01-02 05:00:00 +0000"},
+		{Hash: "c1", DateTime: "2024-01-01 22:00:00 +0200"},
+	}
+
+	plan, err := cfg.PlanByDay(commits)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(plan.Days) != 1 {
+		t.Fatalf("Expected 1 day, got %d", len(plan.Days))
+	}
+	if day := plan.Days[0].Day.Format("2006-01-02"); day != "2024-01-02" {
+		t.Errorf("Expected commits on 2024-01-02, got %s", day)
+	}
+	for i, tm := range plan.Times() {
+		if tm.Location() != tokyo {
+			t.Errorf("Time %d is not in the configured zone: %s", i, tm)
+		}
+		if tm.Hour() < 9 || tm.Hour() >= 17 {
+			t.Errorf("Time %d (%s) is outside work hours", i, tm.Format("15:04"))
+		}
+	}
+}
+
+func TestPlanSpan(t *testing.T) {
+	now := time.Date(2024, 1, 8, 18, 0, 0, 0, time.UTC) // Monday evening
+	cfg := Config{
+		WorkDayStartHour: 9,
+		WorkDayEndHour:   17,
+		SkipWeekdays:     ParseWeekdays("Sat,Sun"),
+		Now:              func() time.Time { return now },
+	}
+
+	commits := []git.Commit{
+		{Hash: "c3", DateTime: "2024-01-06 11:00:00 +0000"},
+		{Hash: "c2", DateTime: "2024-01-03 11:00:00 +0000"},
+		{Hash: "c1", DateTime: "2024-01-02 11:00:00 +0000"},
+	}
+
+	lastPushed := time.Date(2024, 1, 2, 13, 0, 0, 0, time.UTC)
+	plan, err := cfg.PlanSpan(commits, &lastPushed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	times := plan.Times()
+	if len(times) != 3 {
+		t.Fatalf("Expected 3 times, got %d", len(times))
+	}
+
+	for _, day := range plan.Days {
+		if day.Day.Weekday() == time.Saturday || day.Day.Weekday() == time.Sunday {
+			t.Errorf("Commits were scheduled on skipped day %s", day.Day.Format("2006-01-02"))
+		}
+	}
+
+	if times[0].Before(lastPushed) {
+		t.Errorf("First commit %s was scheduled before the last pushed commit %s", times[0], lastPushed)
+	}
+
+	if plan.Days[len(plan.Days)-1].Day.Day() != 8 {
+		t.Errorf("Expected the last commit on today, got %s", plan.Days[len(plan.Days)-1].Day.Format("2006-01-02"))
+	}
+}
+
+func TestPlanSpanBlackoutDates(t *testing.T) {
+	now := time.Date(2024, 1, 8, 18, 0, 0, 0, time.UTC) // Monday evening
+	germany, err := holiday.Lookup("DE")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg := Config{
+		WorkDayStartHour: 9,
+		WorkDayEndHour:   17,
+		SkipWeekdays:     ParseWeekdays("Sat,Sun"),
+		BlackoutDates:    map[string]bool{"2024-01-03": true, "2024-01-04": true, "2024-01-05": true},
+		// New Year's Day is a public holiday
+		Holidays: germany,
+		Now:      func() time.Time { return now },
+	}
+
+	commits := []git.Commit{
+		{Hash: "c3", DateTime: "2024-01-04 11:00:00 +0000"},
+		{Hash: "c2", DateTime: "2024-01-03 11:00:00 +0000"},
+		{Hash: "c1", DateTime: "2024-01-02 11:00:00 +0000"},
+		{Hash: "c0", DateTime: "2024-01-01 11:00:00 +0000"},
+	}
+
+	plan, err := cfg.PlanSpan(commits, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, day := range plan.Days {
+		if date := day.Day.Format("2006-01-02"); date != "2024-01-02" && date != "2024-01-08" {
+			t.Errorf("Commits were scheduled on %s, a blackout date, holiday or skipped day", date)
+		}
+	}
+}
+
+func TestPlanSpanMaxSpanDays(t *testing.T) {
+	now := time.Date(2024, 3, 11, 18, 0, 0, 0, time.UTC) // Monday evening
+	cfg := Config{
+		WorkDayStartHour: 9,
+		WorkDayEndHour:   17,
+		SkipWeekdays:     ParseWeekdays("Sat,Sun"),
+		MaxSpanDays:      3,
+		Now:              func() time.Time { return now },
+	}
+
+	commits := []git.Commit{
+		{Hash: "c3", DateTime: "2024-03-08 11:00:00 +0000"},
+		{Hash: "c2", DateTime: "2024-02-01 11:00:00 +0000"},
+		{Hash: "c1", DateTime: "2024-01-02 11:00:00 +0000"},
+	}
+
+	plan, err := cfg.PlanSpan(commits, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(plan.Times()) != 3 {
+		t.Fatalf("Expected 3 times, got %d", len(plan.Times()))
+	}
+	// The last three eligible days are Thursday, Friday and Monday
+	for _, day := range plan.Days {
+		if day.Day.Before(time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("Commits were scheduled on %s, before the last 3 eligible days", day.Day.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestPlanSpanBeforeWorkDay(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 40, 0, 0, time.UTC) // Wednesday, shortly after midnight
+	cfg := Config{
+		WorkDayStartHour: 9,
+		WorkDayEndHour:   17,
+		Now:              func() time.Time { return now },
+	}
+
+	commits := []git.Commit{
+		{Hash: "c2", DateTime: "2024-01-10 00:30:00 +0000"},
+		{Hash: "c1", DateTime: "2024-01-08 11:00:00 +0000"},
+	}
+
+	plan, err := cfg.PlanSpan(commits, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, tm := range plan.Times() {
+		if tm.Hour() < 9 || tm.Hour() >= 17 || tm.After(now) {
+			t.Errorf("Time %s is outside work hours or in the future", tm)
+		}
+	}
+}
+
+func TestPlanSpanNoEligibleDays(t *testing.T) {
+	now := time.Date(2024, 1, 7, 18, 0, 0, 0, time.UTC) // Sunday
+	cfg := Config{
+		WorkDayStartHour: 9,
+		WorkDayEndHour:   17,
+		SkipWeekdays:     ParseWeekdays("Sat,Sun"),
+		Now:              func() time.Time { return now },
+	}
+
+	commits := []git.Commit{{Hash: "c1", DateTime: "2024-01-06 11:00:00 +0000"}}
+
+	_, err := cfg.PlanSpan(commits, nil)
+	if !errors.Is(err, ErrNoEligibleDays) {
+		t.Errorf("Expected ErrNoEligibleDays, got %v", err)
+	}
+}
+
+func TestTargetLimit(t *testing.T) {
+	target := &Target{
+		ParentCommit: "root",
+		Commits: []git.Commit{
+			{Hash: "c3", Parents: []string{"c2-full"}},
+			{Hash: "c2", Parents: []string{"c1-full"}},
+			{Hash: "c1", Parents: []string{"root"}},
+		},
+	}
+
+	if skipped := target.Limit(0); skipped != 0 || len(target.Commits) != 3 {
+		t.Errorf("Expected no limit to keep all commits, got %d skipped", skipped)
+	}
+	if skipped := target.Limit(2); skipped != 1 {
+		t.Errorf("Expected 1 commit to be left out, got %d", skipped)
+	}
+	if len(target.Commits) != 2 || target.Commits[1].Hash != "c2" {
+		t.Errorf("Expected c3 and c2 to be kept, got %+v", target.Commits)
+	}
+	if target.ParentCommit != "c1-full" {
+		t.Errorf("Expected the rewrite to be anchored on c1, got %s", target.ParentCommit)
+	}
+}
+
+// mergedBranchTarget returns a target whose merge m2 brought in s2 and s1, listed after it by IncludeMergedBranches
+func mergedBranchTarget() *Target {
+	return &Target{
+		ParentCommit: "root",
+		Commits: []git.Commit{
+			{Hash: "c3", DateTime: "2024-01-09 23:00:00 +0000", Parents: []string{"m2-full"}},
+			{Hash: "m2", DateTime: "2024-01-09 22:00:00 +0000", Parents: []string{"c1-full", "s2-full"}, IsMerge: true},
+			{Hash: "s2", DateTime: "2024-01-09 21:00:00 +0000", Parents: []string{"s1-full"}},
+			{Hash: "s1", DateTime: "2024-01-08 14:00:00 +0000", Parents: []string{"root"}},
+			{Hash: "c1", DateTime: "2024-01-08 15:00:00 +0000", Parents: []string{"root"}},
+		},
+		sideBranch: map[string]bool{"s2": true, "s1": true},
+	}
+}
+
+func TestTargetLimitMergedBranches(t *testing.T) {
+	target := mergedBranchTarget()
+	if skipped := target.Limit(3); skipped != 2 {
+		t.Errorf("Expected 2 commits to be left out, got %d", skipped)
+	}
+	if target.ParentCommit != "c1-full" {
+		t.Errorf("Expected the rewrite to be anchored on the first parent of the merge, got %s", target.ParentCommit)
+	}
+}
+
+func TestSkipCompliantPrefixMergedBranches(t *testing.T) {
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17, SkipWeekdays: ParseWeekdays("Sat,Sun")}
+
+	target := mergedBranchTarget()
+	if skipped := target.SkipCompliantPrefix(cfg.InWorkHours); skipped != 2 {
+		t.Errorf("Expected c1 and s1 to be skipped, got %d", skipped)
+	}
+	if len(target.Commits) != 3 || target.ParentCommit != "c1-full" {
+		t.Errorf("Expected the rewrite of c3, m2 and s2 to be anchored on the first parent of the merge, got %d commits on %s", len(target.Commits), target.ParentCommit)
+	}
+}
+
+func TestSkipCompliantPrefix(t *testing.T) {
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17, SkipWeekdays: ParseWeekdays("Sat,Sun")}
+
+	// Newest first: Tuesday late evening, Tuesday morning, Monday afternoon
+	target := &Target{
+		ParentCommit: "root",
+		Commits: []git.Commit{
+			{Hash: "c3", DateTime: "2024-01-09 23:00:00 +0000", Parents: []string{"c2-full"}},
+			{Hash: "c2", DateTime: "2024-01-09 10:00:00 +0000", Parents: []string{"c1-full"}},
+			{Hash: "c1", DateTime: "2024-01-08 14:00:00 +0000", Parents: []string{"root"}},
+		},
+	}
+
+	if skipped := target.SkipCompliantPrefix(cfg.InWorkHours); skipped != 2 {
+		t.Errorf("Expected 2 compliant commits to be skipped, got %d", skipped)
+	}
+	if len(target.Commits) != 1 || target.Commits[0].Hash != "c3" {
+		t.Errorf("Expected only c3 to be left, got %+v", target.Commits)
+	}
+	if target.ParentCommit != "c2-full" {
+		t.Errorf("Expected the rewrite to be anchored on c2, got %s", target.ParentCommit)
+	}
+
+	// A Saturday commit is offending even within work hours
+	weekend := &Target{Commits: []git.Commit{{Hash: "c1", DateTime: "2024-01-06 10:00:00 +0000"}}}
+	if skipped := weekend.SkipCompliantPrefix(cfg.InWorkHours); skipped != 0 {
+		t.Errorf("Expected the weekend commit to be kept for rewriting, got %d skipped", skipped)
+	}
+}
+
+func TestPlanWeekendShift(t *testing.T) {
+	now := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	cfg := Config{SkipWeekdays: ParseWeekdays("Sat,Sun"), Now: func() time.Time { return now }}
+
+	// Newest first: Monday, Sunday, Saturday, Friday
+	commits := []git.Commit{
+		{Hash: "c4", DateTime: "2024-01-08 09:30:00 +0000"},
+		{Hash: "c3", DateTime: "2024-01-07 11:00:00 +0000"},
+		{Hash: "c2", DateTime: "2024-01-06 10:00:00 +0000"},
+		{Hash: "c1", DateTime: "2024-01-05 16:00:00 +0000"},
+	}
+
+	plan, err := cfg.PlanWeekendShift(commits, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []struct {
+		hash string
+		time string
+	}{
+		{"c1", "2024-01-05 16:00"}, // untouched
+		{"c2", "2024-01-05 16:01"}, // Saturday goes back to Friday, after c1
+		{"c3", "2024-01-08 09:29"}, // Sunday goes forward to Monday, before c4
+		{"c4", "2024-01-08 09:30"}, // untouched
+	}
+	planned, times := plan.Commits(), plan.Times()
+	if len(planned) != len(expected) {
+		t.Fatalf("Expected %d planned commits, got %d", len(expected), len(planned))
+	}
+	for i, want := range expected {
+		if planned[i].Hash != want.hash || times[i].Format("2006-01-02 15:04") != want.time {
+			t.Errorf("Expected %s at %s, got %s at %s", want.hash, want.time, planned[i].Hash, times[i].Format("2006-01-02 15:04"))
+		}
+	}
+	if len(plan.Days) != 2 {
+		t.Errorf("Expected the commits to land on 2 days, got %d", len(plan.Days))
+	}
+
+	// Monday is still in the future, so Sunday falls back to Friday
+	now = time.Date(2024, 1, 7, 20, 0, 0, 0, time.UTC)
+	plan, err = cfg.PlanWeekendShift(commits[1:2], nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := plan.Times()[0].Format("2006-01-02 15:04"); got != "2024-01-05 11:00" {
+		t.Errorf("Expected Sunday commit to move back to Friday, got %s", got)
+	}
+
+	allSkipped := Config{SkipWeekdays: ParseWeekdays("Mon,Tue,Wed,Thu,Fri,Sat,Sun")}
+	if _, err := allSkipped.PlanWeekendShift(commits, nil); !errors.Is(err, ErrNoEligibleDays) {
+		t.Errorf("Expected ErrNoEligibleDays, got %v", err)
+	}
+}
+
+func TestPlanShift(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	cfg := Config{Now: func() time.Time { return now }}
+
+	commits := []git.Commit{
+		{Hash: "c2", DateTime: "2024-01-09 01:30:00 +0200"},
+		{Hash: "c1", DateTime: "2024-01-08 23:00:00 +0200"},
+	}
+
+	plan, err := cfg.PlanShift(commits, -2*time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	times := plan.Times()
+	if got := times[0].Format("2006-01-02 15:04 -0700"); got != "2024-01-08 21:00 +0200" {
+		t.Errorf("Expected c1 at 2024-01-08 21:00 +0200, got %s", got)
+	}
+	if got := times[1].Format("2006-01-02 15:04 -0700"); got != "2024-01-08 23:30 +0200" {
+		t.Errorf("Expected c2 at 2024-01-08 23:30 +0200, got %s", got)
+	}
+	if len(plan.Days) != 1 {
+		t.Errorf("Expected both commits on one day, got %d", len(plan.Days))
+	}
+
+	if _, err := cfg.PlanShift(commits, 48*time.Hour); err == nil {
+		t.Error("Expected a shift into the future to be rejected")
+	}
+}
+
+func TestPlanReorder(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	cfg := Config{Now: func() time.Time { return now }}
+
+	// Newest first; an interactive rebase moved c2 after c3 to c5 and c6 before them all
+	commits := []git.Commit{
+		{Hash: "c6", DateTime: "2024-01-09 08:00:00 +0000"},
+		{Hash: "c5", DateTime: "2024-01-09 12:00:00 +0000"},
+		{Hash: "c4", DateTime: "2024-01-09 13:00:00 +0200"},
+		{Hash: "c3", DateTime: "2024-01-09 10:00:00 +0000"},
+		{Hash: "c2", DateTime: "2024-01-09 16:00:00 +0100"},
+		{Hash: "c1", DateTime: "2024-01-09 09:00:00 +0000"},
+	}
+
+	plan, err := cfg.PlanReorder(commits, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []struct {
+		hash string
+		time string
+	}{
+		{"c1", "2024-01-09 09:00 +0000"}, // untouched
+		{"c2", "2024-01-09 10:30 +0100"}, // halfway between c1 and c3, in its own timezone
+		{"c3", "2024-01-09 10:00 +0000"}, // untouched
+		{"c4", "2024-01-09 13:00 +0200"}, // untouched, 11:00 UTC
+		{"c5", "2024-01-09 12:00 +0000"}, // untouched
+		{"c6", "2024-01-09 12:01 +0000"}, // a minute after c5
+	}
+	planned, times := plan.Commits(), plan.Times()
+	if len(planned) != len(expected) {
+		t.Fatalf("Expected %d planned commits, got %d", len(expected), len(planned))
+	}
+	for i, want := range expected {
+		if planned[i].Hash != want.hash || times[i].Format("2006-01-02 15:04 -0700") != want.time {
+			t.Errorf("Expected %s at %s, got %s at %s", want.hash, want.time, planned[i].Hash, times[i].Format("2006-01-02 15:04 -0700"))
+		}
+	}
+
+	// Commits before the parent commit are moved after it, never into the future
+	earliest := time.Date(2024, 1, 10, 11, 59, 0, 0, time.UTC)
+	plan, err = cfg.PlanReorder(commits[4:], &earliest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	times = plan.Times()
+	if !times[0].After(earliest) || !times[1].After(times[0]) || times[1].After(now) {
+		t.Errorf("Expected both commits between %s and %s, got %v", earliest, now, times)
+	}
+}
+
+func TestPlanInclude(t *testing.T) {
+	commits := []git.Commit{
+		{Hash: "c3", DateTime: "2024-01-09 23:00:00 +0000"},
+		{Hash: "c2", DateTime: "2024-01-09 22:00:00 +0000"},
+		{Hash: "c1", DateTime: "2024-01-08 21:00:00 +0000"},
+	}
+	rescheduled := time.Date(2024, 1, 9, 15, 0, 0, 0, time.UTC)
+	plan := Plan{Days: []DayPlan{{
+		Day:     time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC),
+		Commits: []git.Commit{commits[0]},
+		Times:   []time.Time{rescheduled},
+	}}}
+
+	full, err := plan.Include(commits)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	planned, times := full.Commits(), full.Times()
+	expected := []string{"c1 2024-01-08 21:00", "c2 2024-01-09 22:00", "c3 2024-01-09 15:00"}
+	if len(planned) != len(expected) {
+		t.Fatalf("Expected %d commits, got %d", len(expected), len(planned))
+	}
+	for i, want := range expected {
+		if got := planned[i].Hash + " " + times[i].Format("2006-01-02 15:04"); got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package cadence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// DefaultRewriteBranchName is the temporary branch used while commits are replayed in a temporary worktree (RunHooks)
+const DefaultRewriteBranchName = "rewrite-history"
+
+// Target is a repository whose unpushed commits are about to be rescheduled
+type Target struct {
+	RepoPath string
+	// Commits are the unpushed commits, newest first
+	Commits []git.Commit
+	// Branch is the currently checked out branch that will be rewritten
+	Branch string
+	// ParentCommit is the commit the rewritten history is built on, empty when IsRoot
+	ParentCommit string
+	// IsRoot reports that the oldest unpushed commit is the repository's root commit. The rewritten history then
+	// starts with a new root commit instead of being built on a parent.
+	IsRoot bool
+
+	// sideBranch holds the hashes of the commits IncludeMergedBranches added, which aren't on the first-parent chain
+	sideBranch map[string]bool
+}
+
+// oldestFirstParent returns the index of the oldest commit of the branch's first-parent chain, which the rewrite is
+// built on, skipping the side branch commits that follow it; -1 when the target has none
+func (t *Target) oldestFirstParent() int {
+	for i := len(t.Commits) - 1; i >= 0; i-- {
+		if !t.sideBranch[t.Commits[i].Hash] {
+			return i
+		}
+	}
+	return -1
+}
+
+// anchor builds the rewrite on the first parent of the oldest first-parent commit left in the target
+func (t *Target) anchor() {
+	if i := t.oldestFirstParent(); i >= 0 && len(t.Commits[i].Parents) > 0 {
+		t.ParentCommit = t.Commits[i].Parents[0]
+		t.IsRoot = false
+	}
+}
+
+// LoadTarget collects the unpushed commits of a repository along with the branch and parent commit
+// needed to rewrite them. When there are no unpushed commits the returned target has no Commits.
+func LoadTarget(ctx context.Context, repoPath string, parentGitBranchName string) (*Target, error) {
+	commits, err := git.GetUnpushedCommits(ctx, repoPath, parentGitBranchName)
+	if err != nil {
+		return nil, err
+	}
+
+	target := &Target{RepoPath: repoPath, Commits: commits}
+	if len(commits) == 0 {
+		return target, nil
+	}
+
+	target.Branch, err = git.GetCurrentBranch(ctx, repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get current branch: %w", err)
+	}
+
+	// Find parent commit of the first unpushed commit (last in the slice since they're in reverse chronological order)
+	oldest := commits[len(commits)-1]
+	if len(oldest.Parents) == 0 {
+		target.IsRoot = true
+		return target, nil
+	}
+	target.ParentCommit, err = git.GetParentCommit(ctx, repoPath, oldest.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// IncludeMergedBranches adds the commits that merges brought in from other branches to the target, so that they
+// are rescheduled too instead of keeping their original dates. Each merge's side branch is rebuilt on top of its
+// rewritten base and the merge is recreated against it. Commits already on a remote are left alone.
+func (t *Target) IncludeMergedBranches(ctx context.Context) error {
+	var commits []git.Commit
+	for _, commit := range t.Commits {
+		commits = append(commits, commit)
+		if !commit.IsMerge {
+			continue
+		}
+
+		// Newest first, so they directly follow the merge that brought them in
+		side, err := git.GetSideBranchCommits(ctx, t.RepoPath, commit)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, side...)
+		for _, commit := range side {
+			if t.sideBranch == nil {
+				t.sideBranch = make(map[string]bool)
+			}
+			t.sideBranch[commit.Hash] = true
+		}
+	}
+	t.Commits = commits
+	return nil
+}
+
+// Limit keeps only the newest n commits in the target and anchors the rewrite on the parent of the oldest
+// first-parent commit kept, so older unpushed commits are left as they are. It returns the number of commits left out.
+func (t *Target) Limit(n int) int {
+	if n <= 0 || len(t.Commits) <= n {
+		return 0
+	}
+	skipped := len(t.Commits) - n
+	t.Commits = t.Commits[:n]
+	t.anchor()
+	return skipped
+}
+
+// SkipCompliantPrefix drops the oldest commits from the target as long as compliant reports true for them
+// (e.g. Config.InWorkHours), so they are kept byte-identical and the rewrite starts at the first offending commit.
+// It returns the number of commits dropped; when every commit complies the target is left with none.
+func (t *Target) SkipCompliantPrefix(compliant func(git.Commit) bool) int {
+	skipped := 0
+	for i := len(t.Commits) - 1; i >= 0; i-- {
+		commit := t.Commits[i]
+		if !compliant(commit) {
+			break
+		}
+		skipped++
+	}
+	if skipped == 0 {
+		return 0
+	}
+
+	// Side branch commits come after their merge, so they are dropped before it, and the rewrite is still built on
+	// the parent of the oldest first-parent commit left
+	t.Commits = t.Commits[:len(t.Commits)-skipped]
+	t.anchor()
+	return skipped
+}
+
+// ErrPublished is returned by Apply when commits about to be rewritten are already reachable from a remote-tracking ref
+var ErrPublished = errors.New("commits already exist on a remote")
+
+// ErrDiverged is returned by Apply when the remote branch has commits the local branch doesn't, which force-pushing
+// the rewritten branch would discard
+var ErrDiverged = errors.New("branch has diverged from its remote branch")
+
+// RewriteOptions controls how planned commits are recreated
+type RewriteOptions struct {
+	// RewriteBranchName is the temporary branch used when RunHooks replays commits in a temporary worktree.
+	// Empty uses DefaultRewriteBranchName.
+	RewriteBranchName string
+	// AuthorName and AuthorEmail replace the author and committer identity when set
+	AuthorName  string
+	AuthorEmail string
+	// RespectMailmap limits the author replacement to commits whose author maps to the same person as
+	// AuthorName/AuthorEmail in the repository's .mailmap. Without a mailmap every commit is re-attributed.
+	RespectMailmap bool
+	// PreserveAuthor keeps every commit's original author and author date; AuthorName/AuthorEmail then only
+	// replace the committer, and only the committer date is rescheduled
+	PreserveAuthor bool
+	// CoAuthors are credited with a Co-authored-by trailer on every rewritten commit
+	CoAuthors []Identity
+	// OriginalDates records each commit's original author and committer dates in trailers of its message
+	OriginalDates bool
+	// SignOff adds a Signed-off-by trailer for the recorded author to every rewritten commit and keeps existing sign-offs
+	SignOff bool
+	// MessageTemplate, when set, rewrites every commit message
+	MessageTemplate *MessageTemplate
+	// RunHooks replays commits in a temporary worktree so the repository's commit hooks run; by default commits are
+	// recreated from their trees without touching the working tree and no hooks run
+	RunHooks bool
+	// DropEmptyCommits leaves out commits that are or become empty when recreated; by default they are kept
+	DropEmptyCommits bool
+	// KeepDates recreates every commit with its original author and committer dates, ignoring the plan's times, for
+	// rewrites that only correct the identity
+	KeepDates bool
+	// KeepCommitterDate keeps every commit's original committer date, so only the author date is rescheduled
+	KeepCommitterDate bool
+	// OnCommit, when set, is told what happened to every commit
+	OnCommit func(commit git.Commit, result git.ReplayResult)
+	// Events are told about the plan, every rewritten commit and the outcome
+	Events Events
+	// AllowDiverged rewrites a branch even when its remote branch has commits it doesn't have
+	AllowDiverged bool
+}
+
+// Apply recreates the planned commits with their new times and moves the target branch to the result.
+// It returns the number of commits rewritten.
+func Apply(ctx context.Context, target *Target, plan Plan, opts RewriteOptions) (rewritten int, err error) {
+	defer func() { opts.Events.repoDone(target, rewritten, err) }()
+
+	commits := plan.Commits()
+	times := plan.Times()
+	if len(commits) != len(times) || len(commits) == 0 {
+		return 0, fmt.Errorf("internal error: mismatched allocation (commits=%d times=%d)", len(commits), len(times))
+	}
+
+	// The first-parent chain is on a remote as soon as any of its commits is, and then its oldest one is too. Side
+	// branch commits follow their merge, so the last commit isn't necessarily that one; without a chain every commit
+	// is checked.
+	unpublished := target.Commits
+	if i := target.oldestFirstParent(); i >= 0 {
+		unpublished = target.Commits[i : i+1]
+	}
+	for _, commit := range unpublished {
+		if err := checkUnpublished(ctx, target.RepoPath, commit); err != nil {
+			return 0, err
+		}
+	}
+	if !opts.AllowDiverged {
+		if err := checkNotDiverged(ctx, target.RepoPath); err != nil {
+			return 0, err
+		}
+	}
+
+	rewriteBranchName := opts.RewriteBranchName
+	if rewriteBranchName == "" {
+		rewriteBranchName = DefaultRewriteBranchName
+	}
+
+	replay, err := opts.replayOptions(ctx, target, commits)
+	if err != nil {
+		return 0, err
+	}
+	opts.Events.planComputed(target, plan)
+
+	return git.UpdateCommitTimes(ctx, target.RepoPath, commits, times, target.ParentCommit, target.Branch, rewriteBranchName, replay)
+}
+
+// AmendHead gives only the newest unpushed commit, which must be at HEAD, a new time with git commit --amend.
+// It is a lightweight alternative to Apply for a single commit and returns the new commit hash.
+func AmendHead(ctx context.Context, target *Target, newTime time.Time, opts RewriteOptions) (newHash string, err error) {
+	defer func() {
+		rewritten := 0
+		if newHash != "" {
+			rewritten = 1
+		}
+		opts.Events.repoDone(target, rewritten, err)
+	}()
+
+	if len(target.Commits) == 0 {
+		return "", fmt.Errorf("no unpushed commits to amend")
+	}
+	head := target.Commits[0]
+	if err := checkUnpublished(ctx, target.RepoPath, head); err != nil {
+		return "", err
+	}
+	if !opts.AllowDiverged {
+		if err := checkNotDiverged(ctx, target.RepoPath); err != nil {
+			return "", err
+		}
+	}
+
+	replay, err := opts.replayOptions(ctx, target, target.Commits[:1])
+	if err != nil {
+		return "", err
+	}
+	opts.Events.planComputed(target, amendPlan(head, newTime))
+	newHash, err = git.AmendHead(ctx, target.RepoPath, head, newTime, replay)
+	if err != nil {
+		return "", err
+	}
+	if replay.OnReplay != nil {
+		replay.OnReplay(head, git.ReplayResult{Status: git.ReplayRewritten, NewHash: newHash})
+	}
+	return newHash, nil
+}
+
+// checkUnpublished refuses to rewrite a commit a remote already has, which would break collaborators whatever the
+// upstream heuristics said
+func checkUnpublished(ctx context.Context, repoPath string, commit git.Commit) error {
+	refs, err := git.GetRemoteRefsContaining(ctx, repoPath, commit.Hash)
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 {
+		return fmt.Errorf("%w: %s is contained in %s", ErrPublished, commit.Hash, strings.Join(refs, ", "))
+	}
+	return nil
+}
+
+// checkNotDiverged refuses to rewrite a branch whose remote branch has commits it doesn't have, since the rewritten
+// branch can only be published by force-pushing over them
+func checkNotDiverged(ctx context.Context, repoPath string) error {
+	ref, count, err := git.GetUpstreamOnlyCommits(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s has %d commits that are not in the local branch", ErrDiverged, ref, count)
+	}
+	return nil
+}
+
+// replayOptions translates the options into what git needs to recreate commits of the target
+func (opts RewriteOptions) replayOptions(ctx context.Context, target *Target, commits []git.Commit) (git.ReplayOptions, error) {
+	replay := git.ReplayOptions{
+		Identity:          Identity{Name: opts.AuthorName, Email: opts.AuthorEmail},
+		PreserveAuthor:    opts.PreserveAuthor,
+		SignOff:           opts.SignOff,
+		OriginalDates:     opts.OriginalDates,
+		RunHooks:          opts.RunHooks,
+		DropEmpty:         opts.DropEmptyCommits,
+		KeepDates:         opts.KeepDates,
+		OnReplay:          opts.onReplay(target),
+		KeepCommitterDate: opts.KeepCommitterDate,
+	}
+	for _, coAuthor := range opts.CoAuthors {
+		replay.Trailers = append(replay.Trailers, "Co-authored-by: "+coAuthor.String())
+	}
+	if opts.MessageTemplate != nil {
+		replay.Message = func(commit git.Commit, message string) (string, error) {
+			return opts.MessageTemplate.Render(commit, message, target.Branch)
+		}
+	}
+	if opts.RespectMailmap && !opts.PreserveAuthor && (opts.AuthorName != "" || opts.AuthorEmail != "") {
+		author, err := mailmapAuthors(ctx, target.RepoPath, commits, replay.Identity)
+		if err != nil {
+			return git.ReplayOptions{}, err
+		}
+		replay.Author = author
+	}
+	return replay, nil
+}
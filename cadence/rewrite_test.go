@@ -0,0 +1,105 @@
+package cadence
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+func TestLoadTargetRootCommit(t *testing.T) {
+	ctx := context.Background()
+	repo := t.TempDir()
+	gitCmd := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	gitCmd("init", "--quiet", "--initial-branch=main")
+	gitCmd("config", "user.name", "Test")
+	gitCmd("config", "user.email", "test@example.com")
+	gitCmd("commit", "--quiet", "--allow-empty", "-m", "Initial commit")
+
+	target, err := LoadTarget(ctx, repo, "origin/main")
+	if err != nil {
+		t.Fatalf("LoadTarget failed: %v", err)
+	}
+	if len(target.Commits) != 1 || !target.IsRoot || target.ParentCommit != "" {
+		t.Errorf("Expected the single commit to be rewritten as a new root, got %d commits, IsRoot %t and parent %q", len(target.Commits), target.IsRoot, target.ParentCommit)
+	}
+
+	root := gitCmd("rev-parse", "HEAD")
+	if err := os.WriteFile(filepath.Join(repo, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd("add", "file.txt")
+	gitCmd("commit", "--quiet", "-m", "Second commit")
+	gitCmd("remote", "add", "origin", t.TempDir())
+	gitCmd("update-ref", "refs/remotes/origin/main", root)
+
+	target, err = LoadTarget(ctx, repo, "origin/main")
+	if err != nil {
+		t.Fatalf("LoadTarget failed: %v", err)
+	}
+	if len(target.Commits) != 1 || target.IsRoot || target.ParentCommit != root {
+		t.Errorf("Expected the rewrite to be built on the pushed root %s, got %d commits, IsRoot %t and parent %q", root, len(target.Commits), target.IsRoot, target.ParentCommit)
+	}
+}
+
+func TestApplyPublishedMergeWithMergedBranches(t *testing.T) {
+	ctx := context.Background()
+	repo := t.TempDir()
+	gitCmd := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	gitCmd("init", "--quiet", "--initial-branch=main")
+	gitCmd("config", "user.name", "Test")
+	gitCmd("config", "user.email", "test@example.com")
+	gitCmd("commit", "--quiet", "--allow-empty", "-m", "Pushed commit")
+	gitCmd("remote", "add", "origin", t.TempDir())
+	gitCmd("update-ref", "refs/remotes/origin/main", "HEAD")
+	gitCmd("checkout", "--quiet", "-b", "feature")
+	gitCmd("commit", "--quiet", "--allow-empty", "-m", "Feature commit")
+	gitCmd("checkout", "--quiet", "main")
+	gitCmd("merge", "--quiet", "--no-ff", "-m", "Merge feature", "feature")
+
+	// The merge is the oldest unpushed commit of main, and its side branch follows it once merged branches are included
+	target, err := LoadTarget(ctx, repo, "origin/main")
+	if err != nil {
+		t.Fatalf("LoadTarget failed: %v", err)
+	}
+	if err := target.IncludeMergedBranches(ctx); err != nil {
+		t.Fatalf("IncludeMergedBranches failed: %v", err)
+	}
+	if len(target.Commits) != 2 || !target.Commits[0].IsMerge {
+		t.Fatalf("Expected the merge followed by the feature commit, got %+v", target.Commits)
+	}
+	merge := target.Commits[0]
+
+	// Published in the meantime, e.g. by a push from another clone
+	gitCmd("update-ref", "refs/remotes/origin/release", merge.Hash)
+	plan := Plan{Days: []DayPlan{{
+		Commits: []git.Commit{target.Commits[1], target.Commits[0]},
+		Times:   []time.Time{time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Hour)},
+	}}}
+	_, err = Apply(ctx, target, plan, RewriteOptions{})
+	if !errors.Is(err, ErrPublished) || !strings.Contains(err.Error(), merge.Hash+" is contained in") {
+		t.Errorf("Expected the merge to be reported as published, got %v", err)
+	}
+}
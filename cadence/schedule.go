@@ -0,0 +1,83 @@
+package cadence
+
+import (
+	"errors"
+	"time"
+)
+
+// scheduleGap is how far generated times stay from a commit another repository was scheduled at
+const scheduleGap = 10 * time.Minute
+
+// ErrDailyLimit is returned when the commits don't fit into a span without exceeding MaxCommitsPerDay
+var ErrDailyLimit = errors.New("not enough room under the daily commit limit")
+
+// Schedule collects the commit times planned for the repositories of a run, so the plans of the following ones keep
+// their distance from them and share the daily limit. The zero Schedule is empty and ready to use.
+type Schedule struct {
+	times []time.Time
+}
+
+// Add records times as taken
+func (s *Schedule) Add(times []time.Time) {
+	s.times = append(s.times, times...)
+}
+
+// Count returns how many recorded times fall on day, in day's location
+func (s *Schedule) Count(day time.Time) int {
+	if s == nil {
+		return 0
+	}
+	count := 0
+	for _, t := range s.times {
+		if t = t.In(day.Location()); t.Year() == day.Year() && t.YearDay() == day.YearDay() {
+			count++
+		}
+	}
+	return count
+}
+
+// periods returns the time around each recorded time in [start, end) as busy
+func (s *Schedule) periods(start, end time.Time) []Period {
+	if s == nil {
+		return nil
+	}
+	var periods []Period
+	for _, t := range s.times {
+		if t.After(start.Add(-scheduleGap)) && t.Before(end.Add(scheduleGap)) {
+			periods = append(periods, Period{Start: t.Add(-scheduleGap), End: t.Add(scheduleGap)})
+		}
+	}
+	return periods
+}
+
+// capacity returns how many more commits each of days takes under MaxCommitsPerDay, or nil without a limit
+func (c Config) capacity(days []time.Time) []int {
+	if c.MaxCommitsPerDay <= 0 {
+		return nil
+	}
+	room := make([]int, len(days))
+	for i, day := range days {
+		room[i] = max(c.MaxCommitsPerDay-c.Scheduled.Count(day), 0)
+	}
+	return room
+}
+
+// limitAllocation moves the commits alloc puts on days beyond their room to the following days, and what is left
+// over at the end to the preceding ones
+func limitAllocation(alloc, room []int) error {
+	carry := 0
+	for i := range alloc {
+		alloc[i] += carry
+		carry = max(alloc[i]-room[i], 0)
+		alloc[i] -= carry
+	}
+	for i := len(alloc) - 1; i >= 0 && carry > 0; i-- {
+		moved := min(room[i]-alloc[i], carry)
+		alloc[i] += moved
+		carry -= moved
+	}
+	if carry > 0 {
+		return ErrDailyLimit
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package cadence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+func TestScheduleKeepsDistance(t *testing.T) {
+	day := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	schedule := &Schedule{}
+	schedule.Add([]time.Time{
+		time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 8, 13, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 8, 16, 55, 0, 0, time.UTC),
+	})
+	cfg := Config{WorkDayStartHour: 9, WorkDayEndHour: 17, Scheduled: schedule}
+
+	times := cfg.GenerateCommitTimesForDay(day, 3, nil)
+	for _, generated := range times {
+		for _, taken := range schedule.times {
+			if distance := generated.Sub(taken).Abs(); distance < scheduleGap {
+				t.Errorf("Generated %s only %s away from another repository's commit at %s", generated.Format(time.TimeOnly), distance, taken.Format(time.TimeOnly))
+			}
+		}
+	}
+	if schedule.Count(day) != 3 || schedule.Count(day.AddDate(0, 0, 1)) != 0 {
+		t.Errorf("Expected 3 commits on the day and none after it, got %d and %d", schedule.Count(day), schedule.Count(day.AddDate(0, 0, 1)))
+	}
+
+	// A nil schedule is empty
+	var none *Schedule
+	if none.Count(day) != 0 || none.periods(day, day.AddDate(0, 0, 1)) != nil {
+		t.Errorf("Expected a nil schedule to be empty")
+	}
+}
+
+func TestPlanSpanMaxCommitsPerDay(t *testing.T) {
+	now := time.Date(2024, 1, 10, 18, 0, 0, 0, time.UTC) // Wednesday evening
+	schedule := &Schedule{}
+	// Another repository already took two commits on Tuesday
+	schedule.Add([]time.Time{
+		time.Date(2024, 1, 9, 10, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 9, 15, 0, 0, 0, time.UTC),
+	})
+	cfg := Config{
+		WorkDayStartHour: 9,
+		WorkDayEndHour:   17,
+		Scheduled:        schedule,
+		MaxCommitsPerDay: 2,
+		Now:              func() time.Time { return now },
+	}
+
+	commits := []git.Commit{
+		{Hash: "c4", DateTime: "2024-01-10 11:00:00 +0000"},
+		{Hash: "c3", DateTime: "2024-01-09 11:00:00 +0000"},
+		{Hash: "c2", DateTime: "2024-01-09 10:00:00 +0000"},
+		{Hash: "c1", DateTime: "2024-01-08 11:00:00 +0000"},
+	}
+	plan, err := cfg.PlanSpan(commits, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	counts := make(map[int]int)
+	for _, day := range plan.Days {
+		counts[day.Day.Day()] += len(day.Commits)
+	}
+	if counts[8] != 2 || counts[9] != 0 || counts[10] != 2 {
+		t.Errorf("Expected 2 commits on Monday, none on the full Tuesday and 2 on Wednesday, got %v", counts)
+	}
+
+	cfg.MaxCommitsPerDay = 1
+	if _, err := cfg.PlanSpan(commits, nil); err != ErrDailyLimit {
+		t.Errorf("Expected ErrDailyLimit for 4 commits in room for 2, got %v", err)
+	}
+}
+
+func TestLimitAllocation(t *testing.T) {
+	tests := []struct {
+		alloc    []int
+		room     []int
+		expected []int
+	}{
+		{[]int{1, 1, 1}, []int{2, 2, 2}, []int{1, 1, 1}},
+		{[]int{4, 0, 0}, []int{2, 2, 2}, []int{2, 2, 0}},
+		{[]int{0, 0, 5}, []int{2, 2, 2}, []int{1, 2, 2}},
+		{[]int{3, 0, 1}, []int{1, 0, 3}, []int{1, 0, 3}},
+	}
+	for _, test := range tests {
+		alloc := append([]int{}, test.alloc...)
+		if err := limitAllocation(alloc, test.room); err != nil || !slicesEqual(alloc, test.expected) {
+			t.Errorf("limitAllocation(%v, %v) = %v, %v, expected %v", test.alloc, test.room, alloc, err, test.expected)
+		}
+	}
+	if err := limitAllocation([]int{3, 3}, []int{2, 2}); err != ErrDailyLimit {
+		t.Errorf("Expected ErrDailyLimit, got %v", err)
+	}
+}
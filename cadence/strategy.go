@@ -0,0 +1,158 @@
+package cadence
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Strategy decides how many commits PlanSpan puts on each day of a span
+type Strategy interface {
+	// Allocate returns the number of commits for each of days, in order. times are the original times of the
+	// commits, oldest first; c supplies the randomness and the other settings a strategy may use.
+	Allocate(c Config, times []time.Time, days []time.Time) []int
+}
+
+// DAY_ALLOCATION_STRATEGY names
+const (
+	StrategyEven         = "even"
+	StrategyFrontLoaded  = "front-loaded"
+	StrategyBackLoaded   = "back-loaded"
+	StrategyRandomJitter = "random-jitter"
+	StrategyHistorical   = "historical"
+)
+
+// strategies maps the names of the strategies to their implementations
+var strategies = map[string]Strategy{
+	StrategyEven:         Even{},
+	StrategyFrontLoaded:  FrontLoaded{},
+	StrategyBackLoaded:   BackLoaded{},
+	StrategyRandomJitter: RandomJitter{},
+	StrategyHistorical:   Historical{},
+}
+
+// ParseStrategy returns the strategy with the given name. An empty name returns nil, which lets Config pick the
+// default.
+func ParseStrategy(name string) (Strategy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return nil, nil
+	}
+	strategy, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown allocation strategy %q, expected %s, %s, %s, %s or %s", name,
+			StrategyEven, StrategyFrontLoaded, StrategyBackLoaded, StrategyRandomJitter, StrategyHistorical)
+	}
+	return strategy, nil
+}
+
+// strategy returns the configured Strategy: Historical with PreserveSpacing, Weekly with a WeeklyProfile, otherwise
+// RandomJitter
+func (c Config) strategy() Strategy {
+	switch {
+	case c.Strategy != nil:
+		return c.Strategy
+	case c.PreserveSpacing:
+		return Historical{}
+	case c.WeeklyProfile != nil:
+		return Weekly{}
+	default:
+		return RandomJitter{}
+	}
+}
+
+// RandomJitter puts the oldest commit on the first day and the newest on the last, and scatters the rest randomly
+// over the days in between, or in a fixed pattern without JitterDays. See Config.AllocateAcrossDays.
+type RandomJitter struct{}
+
+// Allocate implements Strategy
+func (RandomJitter) Allocate(c Config, times []time.Time, days []time.Time) []int {
+	return c.AllocateAcrossDays(len(times), len(days))
+}
+
+// Weekly spreads the commits by the weights of Config.WeeklyProfile. See Config.AllocateByProfile.
+type Weekly struct{}
+
+// Allocate implements Strategy
+func (Weekly) Allocate(c Config, times []time.Time, days []time.Time) []int {
+	return c.AllocateByProfile(len(times), days)
+}
+
+// Even spaces the commits evenly from the first day to the last. A single commit goes on the last day.
+type Even struct{}
+
+// Allocate implements Strategy
+func (Even) Allocate(c Config, times []time.Time, days []time.Time) []int {
+	return allocateAlong(len(times), len(days), func(x float64) float64 { return x })
+}
+
+// FrontLoaded puts most commits on the first days of the span and thins them out towards the last day, like work
+// that started in earnest and tailed off. A single commit goes on the first day.
+type FrontLoaded struct{}
+
+// Allocate implements Strategy
+func (FrontLoaded) Allocate(c Config, times []time.Time, days []time.Time) []int {
+	if len(times) == 1 && len(days) > 0 {
+		out := make([]int, len(days))
+		out[0] = 1
+		return out
+	}
+	return allocateAlong(len(times), len(days), func(x float64) float64 { return x * x })
+}
+
+// BackLoaded mirrors FrontLoaded: few commits on the first days and most towards the last, like a push before a
+// deadline. A single commit goes on the last day.
+type BackLoaded struct{}
+
+// Allocate implements Strategy
+func (BackLoaded) Allocate(c Config, times []time.Time, days []time.Time) []int {
+	return allocateAlong(len(times), len(days), func(x float64) float64 { return 1 - (1-x)*(1-x) })
+}
+
+// Historical keeps the shape of the original history: each commit goes on the day at the same relative position
+// in the span as its original time between the oldest and the newest commit, so bursts and quiet stretches survive
+// the move. Commits made at the same time go on the last day.
+type Historical struct{}
+
+// Allocate implements Strategy
+func (Historical) Allocate(c Config, times []time.Time, days []time.Time) []int {
+	if len(days) == 0 {
+		return nil
+	}
+	out := make([]int, len(days))
+	if len(times) == 0 {
+		return out
+	}
+	first, last := times[0], times[len(times)-1]
+	span := last.Sub(first)
+	for _, t := range times {
+		index := len(days) - 1
+		if span > 0 {
+			index = int(math.Round(float64(t.Sub(first)) / float64(span) * float64(len(days)-1)))
+		}
+		out[min(max(index, 0), len(days)-1)]++
+	}
+	return out
+}
+
+// allocateAlong places n commits on m days at the positions curve gives for evenly spaced points in [0, 1]; the
+// first commit goes on the first day and the last on the last day. A single commit goes on the last day.
+func allocateAlong(n, m int, curve func(float64) float64) []int {
+	if m <= 0 {
+		return nil
+	}
+	out := make([]int, m)
+	if n <= 0 {
+		return out
+	}
+	if n == 1 {
+		out[m-1] = 1
+		return out
+	}
+	for i := range n {
+		index := int(math.Round(curve(float64(i)/float64(n-1)) * float64(m-1)))
+		out[min(max(index, 0), m-1)]++
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+package cadence
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// hourly returns n times an hour apart
+func hourly(n int) []time.Time {
+	base := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = base.Add(time.Duration(i) * time.Hour)
+	}
+	return times
+}
+
+// weekdays returns m consecutive days starting on Monday 2024-01-08
+func weekdays(m int) []time.Time {
+	days := make([]time.Time, m)
+	for i := range days {
+		days[i] = time.Date(2024, 1, 8+i, 0, 0, 0, 0, time.UTC)
+	}
+	return days
+}
+
+func TestParseStrategy(t *testing.T) {
+	for name, expected := range map[string]Strategy{
+		"even": Even{}, " Front-Loaded ": FrontLoaded{}, "back-loaded": BackLoaded{}, "random-jitter": RandomJitter{}, "historical": Historical{},
+	} {
+		if strategy, err := ParseStrategy(name); err != nil || strategy != expected {
+			t.Errorf("ParseStrategy(%q) = %v, %v, expected %v", name, strategy, err, expected)
+		}
+	}
+	if strategy, err := ParseStrategy(""); strategy != nil || err != nil {
+		t.Errorf("Expected no strategy for an empty name, got %v, %v", strategy, err)
+	}
+	if _, err := ParseStrategy("lumpy"); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	cfg := Config{}
+	tests := []struct {
+		name     string
+		strategy Strategy
+		n        int
+		m        int
+		expected []int
+	}{
+		{"even", Even{}, 5, 5, []int{1, 1, 1, 1, 1}},
+		{"even with more commits than days", Even{}, 7, 3, []int{2, 3, 2}},
+		{"even single commit", Even{}, 1, 3, []int{0, 0, 1}},
+		{"even single day", Even{}, 4, 1, []int{4}},
+		{"front-loaded", FrontLoaded{}, 9, 5, []int{3, 2, 2, 1, 1}},
+		{"front-loaded single commit", FrontLoaded{}, 1, 3, []int{1, 0, 0}},
+		{"back-loaded", BackLoaded{}, 9, 5, []int{1, 1, 2, 2, 3}},
+		{"back-loaded single commit", BackLoaded{}, 1, 3, []int{0, 0, 1}},
+		{"random-jitter without jitter", RandomJitter{}, 6, 3, []int{1, 4, 1}},
+		{"no commits", Even{}, 0, 3, []int{0, 0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.strategy.Allocate(cfg, hourly(test.n), weekdays(test.m))
+			if !slicesEqual(result, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestHistoricalStrategy(t *testing.T) {
+	// A burst of three commits, a quiet week and two more at the end
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	times := []time.Time{
+		base, base.Add(time.Hour), base.Add(2 * time.Hour),
+		base.AddDate(0, 0, 8), base.AddDate(0, 0, 10),
+	}
+	result := Historical{}.Allocate(Config{}, times, weekdays(6))
+	expected := []int{3, 0, 0, 0, 1, 1}
+	if !slicesEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	// Commits made at the same moment have no shape to keep
+	same := []time.Time{base, base}
+	if result := (Historical{}).Allocate(Config{}, same, weekdays(3)); !slicesEqual(result, []int{0, 0, 2}) {
+		t.Errorf("Expected both commits on the last day, got %v", result)
+	}
+}
+
+func TestConfigStrategy(t *testing.T) {
+	tests := []struct {
+		cfg      Config
+		expected Strategy
+	}{
+		{Config{}, RandomJitter{}},
+		{Config{WeeklyProfile: map[time.Weekday]int{time.Tuesday: 2}}, Weekly{}},
+		{Config{WeeklyProfile: map[time.Weekday]int{time.Tuesday: 2}, Strategy: Even{}}, Even{}},
+		{Config{WeeklyProfile: map[time.Weekday]int{time.Tuesday: 2}, PreserveSpacing: true}, Historical{}},
+		{Config{PreserveSpacing: true, Strategy: Even{}}, Even{}},
+	}
+	for _, test := range tests {
+		if strategy := test.cfg.strategy(); strategy != test.expected {
+			t.Errorf("Expected %T, got %T", test.expected, strategy)
+		}
+	}
+
+	// Every strategy allocates every commit
+	cfg := Config{JitterDays: true, Rand: rand.New(rand.NewSource(1)), WeeklyProfile: map[time.Weekday]int{time.Monday: 1}}
+	for name, strategy := range strategies {
+		for _, n := range []int{1, 2, 10, 40} {
+			total := 0
+			for _, count := range strategy.Allocate(cfg, hourly(n), weekdays(7)) {
+				total += count
+			}
+			if total != n {
+				t.Errorf("%s allocated %d of %d commits", name, total, n)
+			}
+		}
+	}
+}
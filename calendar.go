@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/ical"
+)
+
+// Commits less than sessionGap apart belong to the same work session, which starts sessionLead before its first commit
+const (
+	sessionGap  = 2 * time.Hour
+	sessionLead = 30 * time.Minute
+)
+
+// calendar collects the work sessions --ics exports; nil when no export was asked for
+var calendar *calendarExport
+
+// calendarExport is the schedule of a run as calendar events, one per work session and repository
+type calendarExport struct {
+	events []ical.Event
+}
+
+// add records the work sessions implied by commits of repo made at times, which match commits one to one
+func (c *calendarExport) add(repo string, commits []git.Commit, times []time.Time) {
+	order := make([]int, len(commits))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return times[a].Compare(times[b]) })
+
+	var session []int
+	flush := func() {
+		if len(session) == 0 {
+			return
+		}
+		first, last := times[session[0]], times[session[len(session)-1]]
+		subjects := make([]string, len(session))
+		for i, index := range session {
+			subjects[i] = fmt.Sprintf("%s %s", commits[index].Hash, commits[index].Subject)
+		}
+		c.events = append(c.events, ical.Event{
+			UID:         fmt.Sprintf("%x@code-cadence", sha256.Sum256([]byte(repo+"\x00"+first.UTC().String()))),
+			Start:       first.Add(-sessionLead),
+			End:         last,
+			Summary:     fmt.Sprintf("%s (%d commits)", filepath.Base(repo), len(session)),
+			Description: repo + "\n" + strings.Join(subjects, "\n"),
+		})
+		session = nil
+	}
+	for _, index := range order {
+		if len(session) > 0 && times[index].Sub(times[session[len(session)-1]]) >= sessionGap {
+			flush()
+		}
+		session = append(session, index)
+	}
+	flush()
+}
+
+// write saves the collected sessions to path
+func (c *calendarExport) write(path string) error {
+	slices.SortStableFunc(c.events, func(a, b ical.Event) int { return a.Start.Compare(b.Start) })
+	return ical.WriteFile(path, c.events)
+}
+
+// writeCalendar saves the sessions of the run to the --ics file, if one was given
+func writeCalendar() {
+	if calendar == nil {
+		return
+	}
+	path := expandHome(ICSFile)
+	if err := calendar.write(path); err != nil {
+		fmt.Printf("Warning: Failed to write the calendar: %v\n", err)
+		return
+	}
+	fmt.Printf("📅 Wrote %d work sessions to %s\n", len(calendar.events), path)
+}
+
+// addCommitTimes records the work sessions implied by the current times of commits
+func addCommitTimes(repo string, commits []git.Commit) {
+	var dated []git.Commit
+	var times []time.Time
+	for _, commit := range commits {
+		t, err := commit.Time()
+		if err != nil {
+			fmt.Printf("Warning: Could not parse the time of %s in %s: %v\n", commit.Hash, repo, err)
+			continue
+		}
+		dated = append(dated, commit)
+		times = append(times, t)
+	}
+	calendar.add(repo, dated, times)
+}
+
+// loadBusyCalendar reads the meetings and other busy times of the BUSY_CALENDAR file at path. Recurring events are
+// expanded up to tomorrow, since no commit is scheduled later than now.
+func loadBusyCalendar(path string) ([]cadence.Period, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	periods, err := ical.Busy(data, time.Now().AddDate(0, 0, 1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	busy := make([]cadence.Period, len(periods))
+	for i, period := range periods {
+		busy[i] = cadence.Period{Start: period.Start, End: period.End}
+	}
+	return cadence.MergePeriods(busy), nil
+}
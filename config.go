@@ -0,0 +1,770 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/backup"
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/holiday"
+
+	"github.com/joho/godotenv"
+)
+
+// settings is the configuration loaded from the environment and the .env files. loadConfig builds it and the CLI
+// passes it down to everything that reads a setting, which passes it on to the library packages explicitly; watch
+// loads a new one when the files change, so a run never sees its settings change.
+type settings struct {
+	WorkDayStartHour      int
+	WorkDayEndHour        int
+	RepoOverrides         string
+	JitterMinutes         int
+	JitterDays            bool
+	DayAllocation         string
+	PreserveSpacing       bool
+	MeetingGaps           int
+	MaxSpanDays           int
+	MaxCommitsPerDay      int
+	ParentGitBranchName   string
+	ParentBranchMap       string
+	NewCommitAuthorName   string
+	NewCommitAuthorEmail  string
+	CreateBackup          bool
+	BackupFormat          string
+	BackupDir             string
+	BackupFiles           string
+	BackupWorkers         int
+	GitCommandTimeout     time.Duration
+	RepoTimeout           time.Duration
+	ScanCache             bool
+	StreamScan            bool
+	NestedRepos           string
+	NetworkRepos          string
+	WatchInterval         time.Duration
+	FetchBefore           bool
+	FetchTimeout          time.Duration
+	AuthorMap             string
+	RespectMailmap        bool
+	PreserveAuthor        bool
+	PreserveCommitterDate bool
+	CoAuthors             string
+	SignOff               bool
+	MessageTemplate       string
+	MaxRewriteCommits     int
+	MaxRepoSizeMB         int
+	CommitTimezone        string
+	RewriteMergedBranches bool
+	EmptyCommits          string
+	Housekeeping          string
+	RewriteReflogKeepDays int
+	PostRewriteHook       string
+	RunGitHooks           bool
+	MarkRewritten         bool
+	RecordOriginalDates   string
+	PushBlockMode         string
+	Notify                bool
+	NotifyMinDuration     time.Duration
+	SummaryFile           string
+	OnRepoError           string
+	SMTPHost              string
+	SMTPPort              int
+	SMTPUsername          string
+	SMTPPassword          string
+	SMTPFrom              string
+	ReportEmailTo         string
+	SkipWeekDays          string
+	WeeklyProfile         string
+	BlackoutDates         string
+	HolidayRegion         string
+	BusyCalendar          string
+
+	// Parsed forms of the settings above
+	skipWeekdays  map[time.Weekday]bool
+	weeklyProfile map[time.Weekday]int
+	blackoutDates map[string]bool
+	holidayRegion holiday.Region
+	busyPeriods   []cadence.Period
+	// busyCalendarErr is why BUSY_CALENDAR couldn't be read
+	busyCalendarErr error
+	authorMap       cadence.AuthorMap
+	parentBranchMap cadence.BranchMap
+	repoOverrides   cadence.HoursMap
+	dayAllocation   cadence.Strategy
+	coAuthors       []cadence.Identity
+	messageTemplate *cadence.MessageTemplate
+
+	// files holds the settings read from the .env files. When several files define a key, the first one wins.
+	files map[string]configValue
+}
+
+// .env file locations to try in order
+var envFileLocations = []string{
+	".env",                             // Current directory
+	"~/.config/code-cadence/.env",      // User config
+	"/opt/code-cadence/.env",           // Application directory
+	"/usr/local/etc/code-cadence/.env", // System-wide config
+}
+
+// configSetting is a setting loaded by loadConfig, listed by config show
+type configSetting struct {
+	Key string
+	// Value formats the effective value after loading
+	Value func(s *settings) string
+	// Valid reports whether a raw value can be parsed; nil accepts anything. Unparseable values fall back to the default.
+	Valid func(raw string) bool
+}
+
+// secretSettings are never shown by config show or when watch reloads the configuration
+var secretSettings = []string{"SMTP_PASSWORD"}
+
+// settingDisplayValue formats the value of a setting for display, hiding secrets
+func settingDisplayValue(key string, value string) string {
+	if value != "" && slices.Contains(secretSettings, key) {
+		return "********"
+	}
+	return displayValue(value)
+}
+
+// reportRecipients returns the addresses in REPORT_EMAIL_TO
+func (s *settings) reportRecipients() []string {
+	var recipients []string
+	for _, address := range strings.Split(s.ReportEmailTo, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	return recipients
+}
+
+// configSettings lists every setting in the order it is documented
+var configSettings = []configSetting{
+	{"WORK_DAY_START_HOUR", func(s *settings) string { return strconv.Itoa(s.WorkDayStartHour) }, isIntString},
+	{"WORK_DAY_END_HOUR", func(s *settings) string { return strconv.Itoa(s.WorkDayEndHour) }, isIntString},
+	{"REPO_OVERRIDES", func(s *settings) string { return s.RepoOverrides }, nil},
+	{"JITTER_MINUTES", func(s *settings) string { return strconv.Itoa(s.JitterMinutes) }, isIntString},
+	{"MEETING_GAPS", func(s *settings) string { return strconv.Itoa(s.MeetingGaps) }, isIntString},
+	{"JITTER_DAYS", func(s *settings) string { return strconv.FormatBool(s.JitterDays) }, isBoolString},
+	{"DAY_ALLOCATION_STRATEGY", func(s *settings) string { return s.DayAllocation }, nil},
+	{"PRESERVE_SPACING", func(s *settings) string { return strconv.FormatBool(s.PreserveSpacing) }, isBoolString},
+	{"PARENT_GIT_BRANCH_NAME", func(s *settings) string { return s.ParentGitBranchName }, nil},
+	{"PARENT_BRANCH_MAP", func(s *settings) string { return s.ParentBranchMap }, nil},
+	{"NEW_COMMIT_AUTHOR_NAME", func(s *settings) string { return s.NewCommitAuthorName }, nil},
+	{"NEW_COMMIT_AUTHOR_EMAIL", func(s *settings) string { return s.NewCommitAuthorEmail }, nil},
+	{"REWRITE_MERGED_BRANCHES", func(s *settings) string { return strconv.FormatBool(s.RewriteMergedBranches) }, isBoolString},
+	{"EMPTY_COMMITS", func(s *settings) string { return s.EmptyCommits }, nil},
+	{"RUN_GIT_HOOKS", func(s *settings) string { return strconv.FormatBool(s.RunGitHooks) }, isBoolString},
+	{"HOUSEKEEPING", func(s *settings) string { return s.Housekeeping }, nil},
+	{"REWRITE_REFLOG_KEEP_DAYS", func(s *settings) string { return strconv.Itoa(s.RewriteReflogKeepDays) }, isIntString},
+	{"POST_REWRITE_HOOK", func(s *settings) string { return s.PostRewriteHook }, nil},
+	{"MARK_REWRITTEN", func(s *settings) string { return strconv.FormatBool(s.MarkRewritten) }, isBoolString},
+	{"RECORD_ORIGINAL_DATES", func(s *settings) string { return s.RecordOriginalDates }, nil},
+	{"COMMIT_TIMEZONE", func(s *settings) string { return s.CommitTimezone }, nil},
+	{"SKIP_WEEK_DAYS", func(s *settings) string { return s.SkipWeekDays }, nil},
+	{"WEEKLY_PROFILE", func(s *settings) string { return s.WeeklyProfile }, nil},
+	{"MAX_SPAN_DAYS", func(s *settings) string { return strconv.Itoa(s.MaxSpanDays) }, isIntString},
+	{"MAX_COMMITS_PER_DAY", func(s *settings) string { return strconv.Itoa(s.MaxCommitsPerDay) }, isIntString},
+	{"BLACKOUT_DATES", func(s *settings) string { return s.BlackoutDates }, nil},
+	{"HOLIDAY_REGION", func(s *settings) string { return s.HolidayRegion }, nil},
+	{"BUSY_CALENDAR", func(s *settings) string { return s.BusyCalendar }, nil},
+	{"CREATE_BACKUP", func(s *settings) string { return strconv.FormatBool(s.CreateBackup) }, isBoolString},
+	{"BACKUP_FORMAT", func(s *settings) string { return s.BackupFormat }, nil},
+	{"BACKUP_DIR", func(s *settings) string { return s.BackupDir }, nil},
+	{"BACKUP_FILES", func(s *settings) string { return s.BackupFiles }, nil},
+	{"BACKUP_WORKERS", func(s *settings) string { return strconv.Itoa(s.BackupWorkers) }, isIntString},
+	{"MAX_REWRITE_COMMITS", func(s *settings) string { return strconv.Itoa(s.MaxRewriteCommits) }, isIntString},
+	{"MAX_REPO_SIZE_MB", func(s *settings) string { return strconv.Itoa(s.MaxRepoSizeMB) }, isIntString},
+	{"GIT_COMMAND_TIMEOUT", func(s *settings) string { return s.GitCommandTimeout.String() }, isDurationString},
+	{"REPO_TIMEOUT", func(s *settings) string { return s.RepoTimeout.String() }, isDurationString},
+	{"SCAN_CACHE", func(s *settings) string { return strconv.FormatBool(s.ScanCache) }, isBoolString},
+	{"STREAM_SCAN", func(s *settings) string { return strconv.FormatBool(s.StreamScan) }, isBoolString},
+	{"NESTED_REPOS", func(s *settings) string { return s.NestedRepos }, nil},
+	{"NETWORK_REPOS", func(s *settings) string { return s.NetworkRepos }, nil},
+	{"WATCH_INTERVAL", func(s *settings) string { return s.WatchInterval.String() }, isDurationString},
+	{"FETCH_BEFORE", func(s *settings) string { return strconv.FormatBool(s.FetchBefore) }, isBoolString},
+	{"FETCH_TIMEOUT", func(s *settings) string { return s.FetchTimeout.String() }, isDurationString},
+	{"AUTHOR_MAP", func(s *settings) string { return s.AuthorMap }, nil},
+	{"RESPECT_MAILMAP", func(s *settings) string { return strconv.FormatBool(s.RespectMailmap) }, isBoolString},
+	{"PRESERVE_AUTHOR", func(s *settings) string { return strconv.FormatBool(s.PreserveAuthor) }, isBoolString},
+	{"PRESERVE_COMMITTER_DATE", func(s *settings) string { return strconv.FormatBool(s.PreserveCommitterDate) }, isBoolString},
+	{"CO_AUTHORS", func(s *settings) string { return s.CoAuthors }, nil},
+	{"SIGN_OFF", func(s *settings) string { return strconv.FormatBool(s.SignOff) }, isBoolString},
+	{"MESSAGE_TEMPLATE", func(s *settings) string { return s.MessageTemplate }, nil},
+	{"PUSH_BLOCK_MODE", func(s *settings) string { return s.PushBlockMode }, nil},
+	{"NOTIFY", func(s *settings) string { return strconv.FormatBool(s.Notify) }, isBoolString},
+	{"NOTIFY_MIN_DURATION", func(s *settings) string { return s.NotifyMinDuration.String() }, isDurationString},
+	{"SUMMARY_FILE", func(s *settings) string { return s.SummaryFile }, nil},
+	{"ON_REPO_ERROR", func(s *settings) string { return s.OnRepoError }, nil},
+	{"SMTP_HOST", func(s *settings) string { return s.SMTPHost }, nil},
+	{"SMTP_PORT", func(s *settings) string { return strconv.Itoa(s.SMTPPort) }, isIntString},
+	{"SMTP_USERNAME", func(s *settings) string { return s.SMTPUsername }, nil},
+	{"SMTP_PASSWORD", func(s *settings) string { return s.SMTPPassword }, nil},
+	{"SMTP_FROM", func(s *settings) string { return s.SMTPFrom }, nil},
+	{"REPORT_EMAIL_TO", func(s *settings) string { return s.ReportEmailTo }, nil},
+}
+
+// useConfigFile replaces the .env search locations with a single file, so different workspaces can use
+// completely different settings. Environment variables still take precedence over the file.
+func useConfigFile(path string, mustExist bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if !mustExist && errors.Is(err, os.ErrNotExist) {
+			envFileLocations = []string{path}
+			return nil
+		}
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("config file %s is a directory", path)
+	}
+	envFileLocations = []string{path}
+	return nil
+}
+
+// configValue is a setting read from a .env file
+type configValue struct {
+	Value string
+	File  string
+	Line  int
+}
+
+// loadConfig loads configuration from .env file with defaults
+func loadConfig() *settings {
+	// Try to load .env file from multiple locations (ignore errors if files don't exist)
+	s := &settings{files: readEnvFiles(envFileLocations)}
+
+	// Load with defaults
+	s.WorkDayStartHour = s.getEnvInt("WORK_DAY_START_HOUR", 10)
+	s.WorkDayEndHour = s.getEnvInt("WORK_DAY_END_HOUR", 19)
+	// Per-repository work hours; invalid overrides are reported by config validate and ignored
+	s.RepoOverrides = s.getEnvString("REPO_OVERRIDES", "")
+	s.repoOverrides, _ = parseHoursMap(s.RepoOverrides)
+	s.JitterMinutes = s.getEnvInt("JITTER_MINUTES", 30)
+	s.MeetingGaps = s.getEnvInt("MEETING_GAPS", 0)
+	s.JitterDays = s.getEnvBool("JITTER_DAYS", true)
+	// An unknown strategy is reported by config validate and the default is used
+	s.DayAllocation = s.getEnvString("DAY_ALLOCATION_STRATEGY", "")
+	s.dayAllocation, _ = cadence.ParseStrategy(s.DayAllocation)
+	s.PreserveSpacing = s.getEnvBool("PRESERVE_SPACING", false)
+	s.ParentGitBranchName = s.getEnvString("PARENT_GIT_BRANCH_NAME", git.AutoParentBranch)
+	// Per-repository parent branches; an invalid map is reported by config validate and ignored
+	s.ParentBranchMap = s.getEnvString("PARENT_BRANCH_MAP", "")
+	s.parentBranchMap, _ = parseBranchMap(s.ParentBranchMap)
+	s.NewCommitAuthorName = s.getEnvString("NEW_COMMIT_AUTHOR_NAME", "")
+	s.NewCommitAuthorEmail = s.getEnvString("NEW_COMMIT_AUTHOR_EMAIL", "")
+	s.CreateBackup = s.getEnvBool("CREATE_BACKUP", false)
+	s.BackupFormat = s.getEnvString("BACKUP_FORMAT", string(backup.FormatCopy))
+	s.BackupDir = s.getEnvString("BACKUP_DIR", "")
+	s.BackupFiles = s.getEnvString("BACKUP_FILES", BackupFilesAll)
+	s.BackupWorkers = s.getEnvInt("BACKUP_WORKERS", 4)
+	s.MaxRewriteCommits = s.getEnvInt("MAX_REWRITE_COMMITS", 200)
+	s.MaxRepoSizeMB = s.getEnvInt("MAX_REPO_SIZE_MB", 0)
+	s.GitCommandTimeout = s.getEnvDuration("GIT_COMMAND_TIMEOUT", 5*time.Minute)
+	s.RepoTimeout = s.getEnvDuration("REPO_TIMEOUT", 0)
+	s.ScanCache = s.getEnvBool("SCAN_CACHE", true)
+	s.StreamScan = s.getEnvBool("STREAM_SCAN", false)
+	s.NestedRepos = s.getEnvString("NESTED_REPOS", "")
+	s.NetworkRepos = s.getEnvString("NETWORK_REPOS", "warn")
+	s.WatchInterval = s.getEnvDuration("WATCH_INTERVAL", time.Hour)
+	s.FetchBefore = s.getEnvBool("FETCH_BEFORE", false)
+	s.FetchTimeout = s.getEnvDuration("FETCH_TIMEOUT", 30*time.Second)
+
+	// Per-repository author identities; an invalid map is reported by config validate and ignored
+	s.AuthorMap = s.getEnvString("AUTHOR_MAP", "")
+	s.authorMap, _ = parseAuthorMap(s.AuthorMap)
+	s.RespectMailmap = s.getEnvBool("RESPECT_MAILMAP", true)
+	s.PreserveAuthor = s.getEnvBool("PRESERVE_AUTHOR", false)
+	s.PreserveCommitterDate = s.getEnvBool("PRESERVE_COMMITTER_DATE", false)
+	s.CoAuthors = s.getEnvString("CO_AUTHORS", "")
+	s.coAuthors, _ = cadence.ParseCoAuthors(s.CoAuthors)
+	s.SignOff = s.getEnvBool("SIGN_OFF", false)
+	s.MessageTemplate = s.getEnvString("MESSAGE_TEMPLATE", "")
+	s.messageTemplate, _ = cadence.ParseMessageTemplate(s.MessageTemplate)
+
+	s.CommitTimezone = s.getEnvString("COMMIT_TIMEZONE", TimezoneOriginal)
+	s.RewriteMergedBranches = s.getEnvBool("REWRITE_MERGED_BRANCHES", false)
+	s.EmptyCommits = s.getEnvString("EMPTY_COMMITS", EmptyCommitsKeep)
+	s.RunGitHooks = s.getEnvBool("RUN_GIT_HOOKS", false)
+	s.Housekeeping = s.getEnvString("HOUSEKEEPING", HousekeepingOff)
+	s.RewriteReflogKeepDays = s.getEnvInt("REWRITE_REFLOG_KEEP_DAYS", 0)
+	s.PostRewriteHook = s.getEnvString("POST_REWRITE_HOOK", "")
+	s.MarkRewritten = s.getEnvBool("MARK_REWRITTEN", false)
+	s.RecordOriginalDates = s.getEnvString("RECORD_ORIGINAL_DATES", OriginalDatesOff)
+	s.PushBlockMode = s.getEnvString("PUSH_BLOCK_MODE", PushBlockHook)
+	s.Notify = s.getEnvBool("NOTIFY", false)
+	s.NotifyMinDuration = s.getEnvDuration("NOTIFY_MIN_DURATION", 0)
+	s.SummaryFile = s.getEnvString("SUMMARY_FILE", "")
+	s.OnRepoError = s.getEnvString("ON_REPO_ERROR", OnRepoErrorContinue)
+	s.SMTPHost = s.getEnvString("SMTP_HOST", "")
+	s.SMTPPort = s.getEnvInt("SMTP_PORT", 587)
+	s.SMTPUsername = s.getEnvString("SMTP_USERNAME", "")
+	s.SMTPPassword = s.getEnvString("SMTP_PASSWORD", "")
+	s.SMTPFrom = s.getEnvString("SMTP_FROM", "")
+	s.ReportEmailTo = s.getEnvString("REPORT_EMAIL_TO", "")
+
+	// Weekday skipping configuration for commit_cadence_span
+	s.SkipWeekDays = s.getEnvString("SKIP_WEEK_DAYS", "Sat,Sun")
+	s.skipWeekdays = cadence.ParseWeekdays(s.SkipWeekDays)
+	// An invalid profile is reported by config validate and ignored
+	s.WeeklyProfile = s.getEnvString("WEEKLY_PROFILE", "")
+	s.weeklyProfile, _ = cadence.ParseWeeklyProfile(s.WeeklyProfile)
+	s.MaxSpanDays = s.getEnvInt("MAX_SPAN_DAYS", 0)
+	s.MaxCommitsPerDay = s.getEnvInt("MAX_COMMITS_PER_DAY", 0)
+	s.BlackoutDates = s.getEnvString("BLACKOUT_DATES", "")
+	s.blackoutDates, _ = cadence.ParseDates(s.BlackoutDates)
+	s.HolidayRegion = s.getEnvString("HOLIDAY_REGION", "")
+	if s.HolidayRegion != "" {
+		s.holidayRegion, _ = holiday.Lookup(s.HolidayRegion)
+	}
+	s.BusyCalendar = s.getEnvString("BUSY_CALENDAR", "")
+	s.busyPeriods, s.busyCalendarErr = loadBusyCalendar(s.BusyCalendar)
+
+	if s.JitterMinutes < 0 {
+		s.JitterMinutes = 0
+	}
+	if s.MeetingGaps < 0 {
+		s.MeetingGaps = 0
+	}
+	if s.MaxSpanDays < 0 {
+		s.MaxSpanDays = 0
+	}
+	if s.MaxCommitsPerDay < 0 {
+		s.MaxCommitsPerDay = 0
+	}
+	if s.RewriteReflogKeepDays < 0 {
+		s.RewriteReflogKeepDays = 0
+	}
+	if s.GitCommandTimeout < 0 {
+		s.GitCommandTimeout = 0
+	}
+	if s.RepoTimeout < 0 {
+		s.RepoTimeout = 0
+	}
+
+	return s
+}
+
+// readEnvFiles reads every existing .env file and records where each key was defined
+func readEnvFiles(locations []string) map[string]configValue {
+	values := make(map[string]configValue)
+
+	for _, location := range locations {
+		path := expandHome(location)
+		parsed, err := godotenv.Read(path)
+		if err != nil {
+			continue
+		}
+
+		lines := envFileKeyLines(path)
+		for key, value := range parsed {
+			if _, exists := values[key]; !exists {
+				values[key] = configValue{Value: value, File: path, Line: lines[key]}
+			}
+		}
+	}
+
+	return values
+}
+
+// envFileKeyLines returns the line number on which each key of a .env file is assigned (the last assignment wins,
+// matching how the file is parsed)
+func envFileKeyLines(path string) map[string]int {
+	lines := make(map[string]int)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return lines
+	}
+
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "export "))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, _, found := strings.Cut(line, "="); found {
+			lines[strings.TrimSpace(key)] = i + 1
+		}
+	}
+
+	return lines
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// EnvPrefix namespaces the settings to avoid collisions with generic variable names used by other tools.
+// CODE_CADENCE_JITTER_MINUTES takes precedence over JITTER_MINUTES.
+const EnvPrefix = "CODE_CADENCE_"
+
+// settingSource describes where the value of a setting came from
+type settingSource struct {
+	// File and Line locate the .env assignment; both are empty for the environment and defaults
+	File string
+	Line int
+	// Env reports that the value came from the process environment
+	Env bool
+	// Prefixed reports that the value was set through the CODE_CADENCE_ variant of the name
+	Prefixed bool
+}
+
+// String formats the source for messages
+func (s settingSource) String() string {
+	var source string
+	switch {
+	case s.Env:
+		source = "environment"
+	case s.File != "":
+		source = fmt.Sprintf("%s:%d", s.File, s.Line)
+	default:
+		return "default"
+	}
+	if s.Prefixed {
+		source += ", " + EnvPrefix + " prefix"
+	}
+	return source
+}
+
+// lookupSetting returns the raw value of a setting and where it came from. The process environment takes
+// precedence over .env files, and within each the CODE_CADENCE_ prefixed name takes precedence over the plain one.
+func (s *settings) lookupSetting(key string) (string, settingSource) {
+	if value := os.Getenv(EnvPrefix + key); value != "" {
+		return value, settingSource{Env: true, Prefixed: true}
+	}
+	if value := os.Getenv(key); value != "" {
+		return value, settingSource{Env: true}
+	}
+	if value, ok := s.files[EnvPrefix+key]; ok && value.Value != "" {
+		return value.Value, settingSource{File: value.File, Line: value.Line, Prefixed: true}
+	}
+	if value, ok := s.files[key]; ok && value.Value != "" {
+		return value.Value, settingSource{File: value.File, Line: value.Line}
+	}
+	return "", settingSource{}
+}
+
+// getEnvString gets environment variable with default
+func (s *settings) getEnvString(key, defaultValue string) string {
+	if value, _ := s.lookupSetting(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt gets environment variable as int with default
+func (s *settings) getEnvInt(key string, defaultValue int) int {
+	if value, _ := s.lookupSetting(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvBool gets environment variable as bool with default
+func (s *settings) getEnvBool(key string, defaultValue bool) bool {
+	if value, _ := s.lookupSetting(key); value != "" {
+		return parseBool(value, defaultValue)
+	}
+	return defaultValue
+}
+
+// parseBool converts common boolean representations, returning defaultValue if the value isn't one
+func parseBool(value string, defaultValue bool) bool {
+	// Handle common boolean representations
+	lowerValue := strings.ToLower(strings.TrimSpace(value))
+	switch lowerValue {
+	case "true", "1", "yes", "on", "enabled":
+		return true
+	case "false", "0", "no", "off", "disabled":
+		return false
+	}
+	// Fall back to strconv.ParseBool for other formats
+	if boolValue, err := strconv.ParseBool(value); err == nil {
+		return boolValue
+	}
+	return defaultValue
+}
+
+// getEnvDuration gets environment variable as duration with default.
+// Accepts Go duration strings ("90s", "5m") or a plain number of seconds.
+func (s *settings) getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, _ := s.lookupSetting(key); value != "" {
+		value = strings.TrimSpace(value)
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// scheduleConfig builds the scheduling configuration from the settings of the batch, scheduling around the commit
+// times it planned so far
+func (b *batch) scheduleConfig() cadence.Config {
+	return cadence.Config{
+		WorkDayStartHour: b.WorkDayStartHour,
+		WorkDayEndHour:   b.WorkDayEndHour,
+		JitterMinutes:    b.JitterMinutes,
+		MeetingGaps:      b.MeetingGaps,
+		JitterDays:       b.JitterDays,
+		SkipWeekdays:     b.skipWeekdays,
+		WeeklyProfile:    b.weeklyProfile,
+		Strategy:         b.dayAllocation,
+		PreserveSpacing:  b.PreserveSpacing,
+		MaxSpanDays:      b.MaxSpanDays,
+		Scheduled:        b.schedule,
+		MaxCommitsPerDay: b.MaxCommitsPerDay,
+		BlackoutDates:    b.blackoutDates,
+		Holidays:         b.holidayRegion,
+		Busy:             b.busyPeriods,
+		Location:         b.scheduleLocation(),
+	}
+}
+
+// EMPTY_COMMITS values
+const (
+	// EmptyCommitsKeep recreates commits that are or become empty during the rewrite
+	EmptyCommitsKeep = "keep"
+	// EmptyCommitsDrop leaves them out of the rewritten history
+	EmptyCommitsDrop = "drop"
+)
+
+// HOUSEKEEPING values
+const (
+	// HousekeepingOff leaves the garbage a rewrite creates to git's own automatic gc
+	HousekeepingOff = "off"
+	// HousekeepingGC runs git gc --auto after every rewrite
+	HousekeepingGC = "gc"
+	// HousekeepingMaintenance runs git maintenance run --auto after every rewrite
+	HousekeepingMaintenance = "maintenance"
+)
+
+// BACKUP_FILES values
+const (
+	// BackupFilesAll backs up the whole repository directory
+	BackupFilesAll = "all"
+	// BackupFilesTracked backs up the git directory and the tracked files only
+	BackupFilesTracked = "tracked"
+)
+
+// ON_REPO_ERROR values
+const (
+	// OnRepoErrorContinue reports a repository that fails or times out and goes on with the next one
+	OnRepoErrorContinue = "continue"
+	// OnRepoErrorStop ends the run at the first repository that fails or times out
+	OnRepoErrorStop = "stop"
+)
+
+// PUSH_BLOCK_MODE values
+const (
+	// PushBlockHook blocks pushes with a pre-push hook
+	PushBlockHook = "hook"
+	// PushBlockPushURL blocks pushes by replacing the push URL of every remote, which --no-verify can't bypass
+	PushBlockPushURL = "pushurl"
+)
+
+// RECORD_ORIGINAL_DATES values
+const (
+	// OriginalDatesOff doesn't record the original dates
+	OriginalDatesOff = "off"
+	// OriginalDatesTrailer records them in trailers of the rewritten commit messages
+	OriginalDatesTrailer = "trailer"
+	// OriginalDatesNote records them in a note under cadence.NotesRef
+	OriginalDatesNote = "note"
+)
+
+// COMMIT_TIMEZONE values
+const (
+	// TimezoneOriginal schedules each commit in the time zone it was originally made in
+	TimezoneOriginal = "original"
+	// TimezoneLocal schedules every commit in this machine's time zone
+	TimezoneLocal = "local"
+)
+
+// scheduleLocation returns the time zone commits are rescheduled in, or nil to keep each commit's own
+func (s *settings) scheduleLocation() *time.Location {
+	if strings.EqualFold(s.CommitTimezone, TimezoneLocal) {
+		return time.Local
+	}
+	return nil
+}
+
+// traceOutput receives the git commands traced with --trace; nil when they aren't traced
+var traceOutput io.Writer
+
+// gitRunner builds the git command runner from the loaded settings
+func (s *settings) gitRunner() git.Runner {
+	var runner git.Runner = git.ExecRunner{Timeout: s.GitCommandTimeout}
+	if traceOutput != nil {
+		runner = git.TraceRunner{Runner: runner, W: traceOutput}
+	}
+	return runner
+}
+
+// openTrace returns where --trace writes the git commands: stderr, or the file given, which is appended to
+func openTrace(target traceFlag) (io.Writer, error) {
+	if target == traceToStderr {
+		return os.Stderr, nil
+	}
+	file, err := os.OpenFile(string(target), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the trace file: %w", err)
+	}
+	return file, nil
+}
+
+// parseAuthorMap parses AUTHOR_MAP, expanding ~ in path patterns
+func parseAuthorMap(s string) (cadence.AuthorMap, error) {
+	authorMap, err := cadence.ParseAuthorMap(s)
+	if err != nil {
+		return nil, err
+	}
+	for i := range authorMap {
+		authorMap[i].Pattern = expandHome(authorMap[i].Pattern)
+	}
+	return authorMap, nil
+}
+
+// parseBranchMap parses PARENT_BRANCH_MAP, expanding ~ in path patterns
+func parseBranchMap(s string) (cadence.BranchMap, error) {
+	branchMap, err := cadence.ParseBranchMap(s)
+	if err != nil {
+		return nil, err
+	}
+	for i := range branchMap {
+		branchMap[i].Pattern = expandHome(branchMap[i].Pattern)
+	}
+	return branchMap, nil
+}
+
+// parseHoursMap parses REPO_OVERRIDES, expanding ~ in path patterns
+func parseHoursMap(s string) (cadence.HoursMap, error) {
+	hoursMap, err := cadence.ParseHoursMap(s)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hoursMap {
+		hoursMap[i].Pattern = filepath.ToSlash(expandHome(hoursMap[i].Pattern))
+	}
+	return hoursMap, nil
+}
+
+// repoHours returns the first REPO_OVERRIDES rule matching the path or a remote URL of repo
+func (s *settings) repoHours(ctx context.Context, repo string) (cadence.HoursRule, bool) {
+	if len(s.repoOverrides) == 0 {
+		return cadence.HoursRule{}, false
+	}
+	repoPath, err := filepath.Abs(repo)
+	if err != nil {
+		repoPath = repo
+	}
+	remoteURLs, err := git.GetRemoteURLs(ctx, repo)
+	if err != nil {
+		fmt.Printf("   ⚠️  Warning: Could not read remotes for REPO_OVERRIDES: %v\n", err)
+	}
+	return s.repoOverrides.Lookup(filepath.ToSlash(repoPath), remoteURLs)
+}
+
+// repoScheduleConfig builds the scheduling configuration for repo, with the work hours of a matching REPO_OVERRIDES
+// rule in place of WORK_DAY_START_HOUR and WORK_DAY_END_HOUR
+func (b *batch) repoScheduleConfig(ctx context.Context, repo string) cadence.Config {
+	cfg := b.scheduleConfig()
+	if hours, ok := b.repoHours(ctx, repo); ok {
+		cfg.WorkDayStartHour, cfg.WorkDayEndHour = hours.StartHour, hours.EndHour
+	}
+	return cfg
+}
+
+// RepoParentBranchKey is the git config key a repository can set to choose its own parent branch
+const RepoParentBranchKey = "code-cadence.parentBranch"
+
+// parentBranch returns the branch the unpushed commits of repo are compared against when it has no upstream:
+// the repository's own code-cadence.parentBranch git config, then the first PARENT_BRANCH_MAP rule matching its
+// path or a remote URL, then PARENT_GIT_BRANCH_NAME
+func (s *settings) parentBranch(ctx context.Context, repo string) string {
+	return s.parentBranchWarning(ctx, repo, os.Stdout)
+}
+
+// parentBranchWarning is parentBranch writing its warnings to w
+func (s *settings) parentBranchWarning(ctx context.Context, repo string, w io.Writer) string {
+	if branch, err := git.GetConfigValue(ctx, repo, RepoParentBranchKey); err != nil {
+		fmt.Fprintf(w, "   ⚠️  Warning: Could not read %s: %v\n", RepoParentBranchKey, err)
+	} else if branch != "" {
+		return branch
+	}
+
+	if len(s.parentBranchMap) == 0 {
+		return s.ParentGitBranchName
+	}
+
+	repoPath, err := filepath.Abs(repo)
+	if err != nil {
+		repoPath = repo
+	}
+	remoteURLs, err := git.GetRemoteURLs(ctx, repo)
+	if err != nil {
+		fmt.Fprintf(w, "   ⚠️  Warning: Could not read remotes for PARENT_BRANCH_MAP: %v\n", err)
+	}
+	if branch, ok := s.parentBranchMap.Lookup(repoPath, remoteURLs); ok {
+		return branch
+	}
+	return s.ParentGitBranchName
+}
+
+// rewriteOptions builds the rewrite options for a repository from the loaded settings.
+// An AUTHOR_MAP rule matching the repository's path or one of its remote URLs overrides NEW_COMMIT_AUTHOR_*.
+func (s *settings) rewriteOptions(ctx context.Context, repo string) cadence.RewriteOptions {
+	opts := cadence.RewriteOptions{
+		RewriteBranchName: RewriteBranchName,
+		AuthorName:        s.NewCommitAuthorName,
+		AuthorEmail:       s.NewCommitAuthorEmail,
+		RespectMailmap:    s.RespectMailmap,
+		PreserveAuthor:    s.PreserveAuthor,
+		KeepCommitterDate: s.PreserveCommitterDate,
+		CoAuthors:         s.coAuthors,
+		SignOff:           s.SignOff,
+		MessageTemplate:   s.messageTemplate,
+		RunHooks:          s.RunGitHooks,
+		OriginalDates:     strings.EqualFold(s.RecordOriginalDates, OriginalDatesTrailer),
+		DropEmptyCommits:  strings.EqualFold(s.EmptyCommits, EmptyCommitsDrop),
+		AllowDiverged:     AllowDiverged,
+	}
+	if len(s.authorMap) == 0 {
+		return opts
+	}
+
+	repoPath, err := filepath.Abs(repo)
+	if err != nil {
+		repoPath = repo
+	}
+	remoteURLs, err := git.GetRemoteURLs(ctx, repo)
+	if err != nil {
+		fmt.Printf("   ⚠️  Warning: Could not read remotes for AUTHOR_MAP: %v\n", err)
+	}
+
+	if identity, ok := s.authorMap.Lookup(repoPath, remoteURLs); ok {
+		opts.AuthorName = identity.Name
+		opts.AuthorEmail = identity.Email
+	}
+
+	return opts
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config subcommands
+const (
+	ConfigCmdValidate = "validate"
+	ConfigCmdInit     = "init"
+	ConfigCmdShow     = "show"
+)
+
+// Valid config subcommands
+var validConfigCommands = []string{
+	ConfigCmdValidate,
+	ConfigCmdInit,
+	ConfigCmdShow,
+}
+
+// CmdConfig groups the subcommands that inspect the configuration; they take no directory
+const CmdConfig = "config"
+
+// runConfigCommand runs a config subcommand on the settings cfg and returns the process exit code
+func runConfigCommand(cfg *settings, args []string) int {
+	if len(args) != 1 {
+		fmt.Printf("Usage: code-cadence config <%s>\n", strings.Join(validConfigCommands, "|"))
+		return 1
+	}
+
+	switch args[0] {
+	case ConfigCmdValidate:
+		return runConfigValidate(cfg)
+	case ConfigCmdShow:
+		return runConfigShow(cfg)
+	case ConfigCmdInit:
+		return runConfigInit(os.Stdin, os.Stdout, envFileLocations)
+	}
+
+	fmt.Printf("Error: Invalid config command '%s'. Valid config commands are: %s\n", args[0], strings.Join(validConfigCommands, ", "))
+	return 1
+}
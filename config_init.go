@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/egor-markin/code-cadence/cadence"
+)
+
+// initAnswers are the settings collected by config init
+type initAnswers struct {
+	Path             string
+	WorkDayStartHour int
+	WorkDayEndHour   int
+	SkipWeekDays     string
+	AuthorName       string
+	AuthorEmail      string
+	CreateBackup     bool
+}
+
+// prompter asks questions on a terminal and re-asks until the answer is valid
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints a question with its default and returns the validated answer. An empty answer selects the default.
+func (p *prompter) ask(question, defaultValue string, validate func(string) error) (string, error) {
+	for {
+		if defaultValue != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, defaultValue)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+
+		line, readErr := p.in.ReadString('\n')
+		if readErr != nil && (line == "" || !errors.Is(readErr, io.EOF)) {
+			return "", readErr
+		}
+
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = defaultValue
+		}
+
+		if validate != nil {
+			if err := validate(answer); err != nil {
+				fmt.Fprintf(p.out, "  ❌ %v\n", err)
+				if readErr != nil {
+					return "", readErr // No more input to ask again
+				}
+				continue
+			}
+		}
+
+		return answer, nil
+	}
+}
+
+// validateHour returns a validator accepting whole hours in [min, max]
+func validateHour(min, max int) func(string) error {
+	return func(s string) error {
+		hour, err := strconv.Atoi(s)
+		if err != nil || hour < min || hour > max {
+			return fmt.Errorf("enter a whole hour between %d and %d", min, max)
+		}
+		return nil
+	}
+}
+
+// validateYesNo accepts the boolean spellings understood by the configuration
+func validateYesNo(s string) error {
+	if !isBoolString(s) {
+		return fmt.Errorf("answer yes or no")
+	}
+	return nil
+}
+
+// runConfigInit asks for the most important settings and writes them to one of the .env locations.
+// It returns the exit code.
+func runConfigInit(in io.Reader, out io.Writer, locations []string) int {
+	p := &prompter{in: bufio.NewReader(in), out: out}
+
+	answers, err := askInitQuestions(p, locations)
+	if err != nil {
+		fmt.Fprintf(out, "\nError: %v\n", err)
+		return 1
+	}
+
+	if _, err := os.Stat(answers.Path); err == nil {
+		overwrite, err := p.ask(fmt.Sprintf("%s already exists. Overwrite it?", answers.Path), "no", validateYesNo)
+		if err != nil {
+			fmt.Fprintf(out, "\nError: %v\n", err)
+			return 1
+		}
+		if !parseBool(overwrite, false) {
+			fmt.Fprintln(out, "Nothing written")
+			return 0
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(answers.Path), 0755); err != nil {
+		fmt.Fprintf(out, "Error: Failed to create %s: %v\n", filepath.Dir(answers.Path), err)
+		return 1
+	}
+	if err := os.WriteFile(answers.Path, []byte(renderEnvFile(answers)), 0644); err != nil {
+		fmt.Fprintf(out, "Error: Failed to write %s: %v\n", answers.Path, err)
+		return 1
+	}
+
+	fmt.Fprintf(out, "\n✅ Configuration written to %s\n", answers.Path)
+	fmt.Fprintln(out, "Run 'code-cadence config validate' to check the result")
+	return 0
+}
+
+// askInitQuestions walks through the wizard
+func askInitQuestions(p *prompter, locations []string) (initAnswers, error) {
+	var answers initAnswers
+
+	fmt.Fprintln(p.out, "Where should the configuration be written?")
+	for i, location := range locations {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, expandHome(location))
+	}
+	choice, err := p.ask("Location", "1", func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > len(locations) {
+			return fmt.Errorf("enter a number between 1 and %d", len(locations))
+		}
+		return nil
+	})
+	if err != nil {
+		return answers, err
+	}
+	n, _ := strconv.Atoi(choice)
+	answers.Path = expandHome(locations[n-1])
+
+	start, err := p.ask("Work day start hour (0-23)", "10", validateHour(0, 23))
+	if err != nil {
+		return answers, err
+	}
+	answers.WorkDayStartHour, _ = strconv.Atoi(start)
+
+	end, err := p.ask("Work day end hour (1-24)", "19", func(s string) error {
+		if err := validateHour(1, 24)(s); err != nil {
+			return err
+		}
+		if hour, _ := strconv.Atoi(s); hour <= answers.WorkDayStartHour {
+			return fmt.Errorf("the work day must end after it starts (%d)", answers.WorkDayStartHour)
+		}
+		return nil
+	})
+	if err != nil {
+		return answers, err
+	}
+	answers.WorkDayEndHour, _ = strconv.Atoi(end)
+
+	answers.SkipWeekDays, err = p.ask("Weekdays to skip (e.g. Sat,Sun; 'none' for none)", "Sat,Sun", func(s string) error {
+		if strings.EqualFold(s, "none") {
+			return nil
+		}
+		for _, token := range strings.Split(s, ",") {
+			if token = strings.TrimSpace(token); token != "" && len(cadence.ParseWeekdays(token)) == 0 {
+				return fmt.Errorf("unknown weekday %q", token)
+			}
+		}
+		if len(cadence.ParseWeekdays(s)) == 7 {
+			return fmt.Errorf("at least one weekday must remain")
+		}
+		return nil
+	})
+	if err != nil {
+		return answers, err
+	}
+	if strings.EqualFold(answers.SkipWeekDays, "none") {
+		answers.SkipWeekDays = ""
+	}
+
+	answers.AuthorName, err = p.ask("Author name for rewritten commits (empty keeps the original)", "", nil)
+	if err != nil {
+		return answers, err
+	}
+
+	answers.AuthorEmail, err = p.ask("Author email for rewritten commits (empty keeps the original)", "", func(s string) error {
+		if s == "" {
+			return nil
+		}
+		if address, err := mail.ParseAddress(s); err != nil || address.Address != s {
+			return fmt.Errorf("%q is not a valid email address", s)
+		}
+		return nil
+	})
+	if err != nil {
+		return answers, err
+	}
+
+	backup, err := p.ask("Create backups before rewriting history?", "yes", validateYesNo)
+	if err != nil {
+		return answers, err
+	}
+	answers.CreateBackup = parseBool(backup, true)
+
+	return answers, nil
+}
+
+// renderEnvFile formats the answers as a commented .env file
+func renderEnvFile(a initAnswers) string {
+	var b strings.Builder
+
+	b.WriteString("# Code Cadence Configuration\n")
+	b.WriteString("# Generated by 'code-cadence config init'. See env.example for all available settings.\n\n")
+
+	b.WriteString("# Work day configuration (24-hour format)\n")
+	fmt.Fprintf(&b, "WORK_DAY_START_HOUR=%d\n", a.WorkDayStartHour)
+	fmt.Fprintf(&b, "WORK_DAY_END_HOUR=%d\n\n", a.WorkDayEndHour)
+
+	b.WriteString("# Weekdays skipped by commit_cadence_span (comma-separated)\n")
+	fmt.Fprintf(&b, "SKIP_WEEK_DAYS=%s\n\n", a.SkipWeekDays)
+
+	b.WriteString("# Commit author override (leave empty to keep original author)\n")
+	if a.AuthorName != "" {
+		fmt.Fprintf(&b, "NEW_COMMIT_AUTHOR_NAME=%s\n", quoteEnvValue(a.AuthorName))
+	} else {
+		b.WriteString("# NEW_COMMIT_AUTHOR_NAME=Your Name\n")
+	}
+	if a.AuthorEmail != "" {
+		fmt.Fprintf(&b, "NEW_COMMIT_AUTHOR_EMAIL=%s\n\n", a.AuthorEmail)
+	} else {
+		b.WriteString("# NEW_COMMIT_AUTHOR_EMAIL=your.email@example.com\n\n")
+	}
+
+	b.WriteString("# Create backup copies of repositories before running commit_cadence commands\n")
+	fmt.Fprintf(&b, "CREATE_BACKUP=%t\n", a.CreateBackup)
+
+	return b.String()
+}
+
+// quoteEnvValue quotes a value for a .env file when it contains characters the parser treats specially
+func quoteEnvValue(value string) string {
+	if strings.ContainsAny(value, " #\"'\\$") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunConfigInit(t *testing.T) {
+	tempDir := t.TempDir()
+	target := filepath.Join(tempDir, "config", ".env")
+	locations := []string{filepath.Join(tempDir, "other.env"), target}
+
+	// Invalid answers are asked again: end hour before start, unknown weekday, bad email
+	input := strings.Join([]string{
+		"2",            // location
+		"9",            // start hour
+		"8",            // end hour (rejected)
+		"17",           // end hour
+		"Sat,Caturday", // weekdays (rejected)
+		"Fri,Sat,Sun",  // weekdays
+		"Jane Doe",     // author name
+		"not-an-email", // author email (rejected)
+		"jane@example.com",
+		"no", // backups
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	if code := runConfigInit(strings.NewReader(input), &out, locations); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d\nOutput:\n%s", code, out.String())
+	}
+
+	for _, rejected := range []string{"must end after it starts", "unknown weekday", "not a valid email address"} {
+		if !strings.Contains(out.String(), rejected) {
+			t.Errorf("Expected output to mention %q", rejected)
+		}
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("Expected configuration file to be written: %v", err)
+	}
+
+	values := readEnvFiles([]string{target})
+	expected := map[string]string{
+		"WORK_DAY_START_HOUR":     "9",
+		"WORK_DAY_END_HOUR":       "17",
+		"SKIP_WEEK_DAYS":          "Fri,Sat,Sun",
+		"NEW_COMMIT_AUTHOR_NAME":  "Jane Doe",
+		"NEW_COMMIT_AUTHOR_EMAIL": "jane@example.com",
+		"CREATE_BACKUP":           "false",
+	}
+	for key, value := range expected {
+		if values[key].Value != value {
+			t.Errorf("Expected %s=%s, got %q\nFile:\n%s", key, value, values[key].Value, content)
+		}
+	}
+}
+
+func TestRunConfigInitKeepsExistingFile(t *testing.T) {
+	target := filepath.Join(t.TempDir(), ".env")
+	os.WriteFile(target, []byte("JITTER_MINUTES=5\n"), 0644)
+
+	// Accept every default, then decline to overwrite
+	input := strings.Repeat("\n", 7) + "no\n"
+
+	var out strings.Builder
+	if code := runConfigInit(strings.NewReader(input), &out, []string{target}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d\nOutput:\n%s", code, out.String())
+	}
+
+	content, _ := os.ReadFile(target)
+	if string(content) != "JITTER_MINUTES=5\n" {
+		t.Errorf("Expected existing file to be kept, got:\n%s", content)
+	}
+}
+
+func TestRunConfigInitEndOfInput(t *testing.T) {
+	target := filepath.Join(t.TempDir(), ".env")
+
+	var out strings.Builder
+	if code := runConfigInit(strings.NewReader("1\n25"), &out, []string{target}); code == 0 {
+		t.Error("Expected failure when input ends with an invalid answer")
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("Expected no file to be written")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// printConfigFiles lists the .env locations in order of precedence and whether each exists
+func printConfigFiles() {
+	fmt.Println("Configuration files (in order of precedence):")
+	for _, location := range envFileLocations {
+		path := expandHome(location)
+		if _, err := os.Stat(path); err == nil {
+			fmt.Printf("  ✓ %s\n", path)
+		} else {
+			fmt.Printf("  - %s (not found)\n", path)
+		}
+	}
+	fmt.Println()
+}
+
+// runConfigShow prints the effective value of every setting and flag together with where it came from.
+// It returns the exit code.
+func runConfigShow(cfg *settings) int {
+	printConfigFiles()
+
+	fmt.Println("Settings:")
+	for _, setting := range configSettings {
+		raw, source := cfg.lookupSetting(setting.Key)
+		origin := source.String()
+		if raw != "" && setting.Valid != nil && !setting.Valid(raw) {
+			origin = fmt.Sprintf("default, invalid value %q from %s ignored", raw, source)
+		}
+		fmt.Printf("  %-24s = %-20s (%s)\n", setting.Key, settingDisplayValue(setting.Key, setting.Value(cfg)), origin)
+	}
+
+	fmt.Println()
+	fmt.Println("Flags:")
+	fs := cliFlags
+	if fs == nil {
+		fs = newFlagSet()
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	fs.VisitAll(func(f *flag.Flag) {
+		source := "default"
+		if given[f.Name] {
+			source = "flag"
+		}
+		fmt.Printf("  --%-22s = %-20s (%s)\n", f.Name, displayValue(f.Value.String()), source)
+	})
+
+	return 0
+}
+
+// displayValue makes empty values visible
+func displayValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	return value
+}
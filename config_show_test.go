@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestRunConfigShow(t *testing.T) {
+	helper := NewTestHelper(t)
+
+	envFile := filepath.Join(helper.TempDir, "test.env")
+	os.WriteFile(envFile, []byte("WORK_DAY_START_HOUR=8\nJITTER_MINUTES=lots\n"), 0644)
+
+	oldLocations := envFileLocations
+	envFileLocations = []string{envFile}
+	defer func() {
+		envFileLocations = oldLocations
+	}()
+
+	t.Setenv("WORK_DAY_END_HOUR", "16")
+	cfg := loadConfig()
+
+	if _, err := parseArgs([]string{"--refresh", "config", "show"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() { RefreshCache = false }()
+
+	output := helper.CaptureOutput(func() { runConfigShow(cfg) })
+
+	expected := []string{
+		`WORK_DAY_START_HOUR\s+= 8\s+\(` + regexp.QuoteMeta(envFile) + `:1\)`,
+		`WORK_DAY_END_HOUR\s+= 16\s+\(environment\)`,
+		`JITTER_MINUTES\s+= 30\s+\(default, invalid value "lots" from ` + regexp.QuoteMeta(envFile) + `:2 ignored\)`,
+		`JITTER_DAYS\s+= true\s+\(default\)`,
+		`--refresh\s+= true\s+\(flag\)`,
+		`--changed-only\s+= false\s+\(default\)`,
+	}
+	for _, pattern := range expected {
+		if !regexp.MustCompile(pattern).MatchString(output) {
+			t.Errorf("Expected output to match %q\nOutput:\n%s", pattern, output)
+		}
+	}
+}
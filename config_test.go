@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -63,42 +66,42 @@ func TestConfigurationLoading(t *testing.T) {
 	}()
 
 	// Test default configuration
-	loadConfig()
+	cfg := loadConfig()
 
 	// Verify default values
-	if WorkDayStartHour != 10 {
-		t.Errorf("Expected WorkDayStartHour to be 10, got %d", WorkDayStartHour)
+	if cfg.WorkDayStartHour != 10 {
+		t.Errorf("Expected WorkDayStartHour to be 10, got %d", cfg.WorkDayStartHour)
 	}
-	if WorkDayEndHour != 19 {
-		t.Errorf("Expected WorkDayEndHour to be 19, got %d", WorkDayEndHour)
+	if cfg.WorkDayEndHour != 19 {
+		t.Errorf("Expected WorkDayEndHour to be 19, got %d", cfg.WorkDayEndHour)
 	}
-	if JitterMinutes != 30 {
-		t.Errorf("Expected JitterMinutes to be 30, got %d", JitterMinutes)
+	if cfg.JitterMinutes != 30 {
+		t.Errorf("Expected JitterMinutes to be 30, got %d", cfg.JitterMinutes)
 	}
-	if ParentGitBranchName != "origin/main" {
-		t.Errorf("Expected ParentGitBranchName to be 'origin/main', got '%s'", ParentGitBranchName)
+	if cfg.ParentGitBranchName != "auto" {
+		t.Errorf("Expected ParentGitBranchName to be 'auto', got '%s'", cfg.ParentGitBranchName)
 	}
-	if NewCommitAuthorName != "" {
-		t.Errorf("Expected NewCommitAuthorName to be empty, got '%s'", NewCommitAuthorName)
+	if cfg.NewCommitAuthorName != "" {
+		t.Errorf("Expected NewCommitAuthorName to be empty, got '%s'", cfg.NewCommitAuthorName)
 	}
-	if NewCommitAuthorEmail != "" {
-		t.Errorf("Expected NewCommitAuthorEmail to be empty, got '%s'", NewCommitAuthorEmail)
+	if cfg.NewCommitAuthorEmail != "" {
+		t.Errorf("Expected NewCommitAuthorEmail to be empty, got '%s'", cfg.NewCommitAuthorEmail)
 	}
-	if CreateBackup != false {
-		t.Errorf("Expected CreateBackup to be false, got %t", CreateBackup)
+	if cfg.CreateBackup != false {
+		t.Errorf("Expected CreateBackup to be false, got %t", cfg.CreateBackup)
 	}
-	if SkipWeekDays != "Sat,Sun" {
-		t.Errorf("Expected SkipWeekDays to be 'Sat,Sun', got '%s'", SkipWeekDays)
+	if cfg.SkipWeekDays != "Sat,Sun" {
+		t.Errorf("Expected SkipWeekDays to be 'Sat,Sun', got '%s'", cfg.SkipWeekDays)
 	}
 
 	// Verify skipWeekdaysSet is populated
-	if skipWeekdaysSet == nil {
+	if cfg.skipWeekdays == nil {
 		t.Error("Expected skipWeekdaysSet to be populated")
 	}
-	if !skipWeekdaysSet[time.Saturday] {
+	if !cfg.skipWeekdays[time.Saturday] {
 		t.Error("Expected Saturday to be in skipWeekdaysSet")
 	}
-	if !skipWeekdaysSet[time.Sunday] {
+	if !cfg.skipWeekdays[time.Sunday] {
 		t.Error("Expected Sunday to be in skipWeekdaysSet")
 	}
 }
@@ -170,45 +173,45 @@ func TestConfigurationWithCustomValues(t *testing.T) {
 	os.Setenv("SKIP_WEEK_DAYS", "Fri,Sat,Sun")
 
 	// Load configuration
-	loadConfig()
+	cfg := loadConfig()
 
 	// Verify custom values
-	if WorkDayStartHour != 8 {
-		t.Errorf("Expected WorkDayStartHour to be 8, got %d", WorkDayStartHour)
+	if cfg.WorkDayStartHour != 8 {
+		t.Errorf("Expected WorkDayStartHour to be 8, got %d", cfg.WorkDayStartHour)
 	}
-	if WorkDayEndHour != 18 {
-		t.Errorf("Expected WorkDayEndHour to be 18, got %d", WorkDayEndHour)
+	if cfg.WorkDayEndHour != 18 {
+		t.Errorf("Expected WorkDayEndHour to be 18, got %d", cfg.WorkDayEndHour)
 	}
-	if JitterMinutes != 15 {
-		t.Errorf("Expected JitterMinutes to be 15, got %d", JitterMinutes)
+	if cfg.JitterMinutes != 15 {
+		t.Errorf("Expected JitterMinutes to be 15, got %d", cfg.JitterMinutes)
 	}
-	if ParentGitBranchName != "origin/develop" {
-		t.Errorf("Expected ParentGitBranchName to be 'origin/develop', got '%s'", ParentGitBranchName)
+	if cfg.ParentGitBranchName != "origin/develop" {
+		t.Errorf("Expected ParentGitBranchName to be 'origin/develop', got '%s'", cfg.ParentGitBranchName)
 	}
-	if NewCommitAuthorName != "Custom User" {
-		t.Errorf("Expected NewCommitAuthorName to be 'Custom User', got '%s'", NewCommitAuthorName)
+	if cfg.NewCommitAuthorName != "Custom User" {
+		t.Errorf("Expected NewCommitAuthorName to be 'Custom User', got '%s'", cfg.NewCommitAuthorName)
 	}
-	if NewCommitAuthorEmail != "custom@example.com" {
-		t.Errorf("Expected NewCommitAuthorEmail to be 'custom@example.com', got '%s'", NewCommitAuthorEmail)
+	if cfg.NewCommitAuthorEmail != "custom@example.com" {
+		t.Errorf("Expected NewCommitAuthorEmail to be 'custom@example.com', got '%s'", cfg.NewCommitAuthorEmail)
 	}
-	if CreateBackup != true {
-		t.Errorf("Expected CreateBackup to be true, got %t", CreateBackup)
+	if cfg.CreateBackup != true {
+		t.Errorf("Expected CreateBackup to be true, got %t", cfg.CreateBackup)
 	}
-	if SkipWeekDays != "Fri,Sat,Sun" {
-		t.Errorf("Expected SkipWeekDays to be 'Fri,Sat,Sun', got '%s'", SkipWeekDays)
+	if cfg.SkipWeekDays != "Fri,Sat,Sun" {
+		t.Errorf("Expected SkipWeekDays to be 'Fri,Sat,Sun', got '%s'", cfg.SkipWeekDays)
 	}
 
 	// Verify skipWeekdaysSet is updated
-	if !skipWeekdaysSet[time.Friday] {
+	if !cfg.skipWeekdays[time.Friday] {
 		t.Error("Expected Friday to be in skipWeekdaysSet")
 	}
-	if !skipWeekdaysSet[time.Saturday] {
+	if !cfg.skipWeekdays[time.Saturday] {
 		t.Error("Expected Saturday to be in skipWeekdaysSet")
 	}
-	if !skipWeekdaysSet[time.Sunday] {
+	if !cfg.skipWeekdays[time.Sunday] {
 		t.Error("Expected Sunday to be in skipWeekdaysSet")
 	}
-	if skipWeekdaysSet[time.Monday] {
+	if cfg.skipWeekdays[time.Monday] {
 		t.Error("Expected Monday to not be in skipWeekdaysSet")
 	}
 }
@@ -276,20 +279,20 @@ func TestConfigurationWithInvalidValues(t *testing.T) {
 	os.Setenv("CREATE_BACKUP", "maybe")
 
 	// Load configuration
-	loadConfig()
+	cfg := loadConfig()
 
 	// Verify default values are used for invalid inputs
-	if WorkDayStartHour != 10 {
-		t.Errorf("Expected WorkDayStartHour to be 10 (default), got %d", WorkDayStartHour)
+	if cfg.WorkDayStartHour != 10 {
+		t.Errorf("Expected WorkDayStartHour to be 10 (default), got %d", cfg.WorkDayStartHour)
 	}
-	if WorkDayEndHour != 19 {
-		t.Errorf("Expected WorkDayEndHour to be 19 (default), got %d", WorkDayEndHour)
+	if cfg.WorkDayEndHour != 19 {
+		t.Errorf("Expected WorkDayEndHour to be 19 (default), got %d", cfg.WorkDayEndHour)
 	}
-	if JitterMinutes != 30 {
-		t.Errorf("Expected JitterMinutes to be 30 (default), got %d", JitterMinutes)
+	if cfg.JitterMinutes != 30 {
+		t.Errorf("Expected JitterMinutes to be 30 (default), got %d", cfg.JitterMinutes)
 	}
-	if CreateBackup != false {
-		t.Errorf("Expected CreateBackup to be false (default), got %t", CreateBackup)
+	if cfg.CreateBackup != false {
+		t.Errorf("Expected CreateBackup to be false (default), got %t", cfg.CreateBackup)
 	}
 }
 
@@ -351,26 +354,26 @@ func TestConfigurationJitterMinutesValidation(t *testing.T) {
 
 	// Test negative jitter minutes
 	os.Setenv("JITTER_MINUTES", "-5")
-	loadConfig()
+	cfg := loadConfig()
 
-	if JitterMinutes != 0 {
-		t.Errorf("Expected JitterMinutes to be 0 (clamped), got %d", JitterMinutes)
+	if cfg.JitterMinutes != 0 {
+		t.Errorf("Expected JitterMinutes to be 0 (clamped), got %d", cfg.JitterMinutes)
 	}
 
 	// Test zero jitter minutes
 	os.Setenv("JITTER_MINUTES", "0")
-	loadConfig()
+	cfg = loadConfig()
 
-	if JitterMinutes != 0 {
-		t.Errorf("Expected JitterMinutes to be 0, got %d", JitterMinutes)
+	if cfg.JitterMinutes != 0 {
+		t.Errorf("Expected JitterMinutes to be 0, got %d", cfg.JitterMinutes)
 	}
 
 	// Test positive jitter minutes
 	os.Setenv("JITTER_MINUTES", "45")
-	loadConfig()
+	cfg = loadConfig()
 
-	if JitterMinutes != 45 {
-		t.Errorf("Expected JitterMinutes to be 45, got %d", JitterMinutes)
+	if cfg.JitterMinutes != 45 {
+		t.Errorf("Expected JitterMinutes to be 45, got %d", cfg.JitterMinutes)
 	}
 }
 
@@ -432,26 +435,26 @@ func TestConfigurationJitterDaysValidation(t *testing.T) {
 
 	// Test false jitter days
 	os.Setenv("JITTER_DAYS", "false")
-	loadConfig()
+	cfg := loadConfig()
 
-	if JitterDays != false {
-		t.Errorf("Expected JitterDays to be false, got %t", JitterDays)
+	if cfg.JitterDays != false {
+		t.Errorf("Expected JitterDays to be false, got %t", cfg.JitterDays)
 	}
 
 	// Test true jitter days
 	os.Setenv("JITTER_DAYS", "true")
-	loadConfig()
+	cfg = loadConfig()
 
-	if JitterDays != true {
-		t.Errorf("Expected JitterDays to be true, got %t", JitterDays)
+	if cfg.JitterDays != true {
+		t.Errorf("Expected JitterDays to be true, got %t", cfg.JitterDays)
 	}
 
 	// Test default value (no env var set)
 	os.Unsetenv("JITTER_DAYS")
-	loadConfig()
+	cfg = loadConfig()
 
-	if !JitterDays {
-		t.Errorf("Expected JitterDays to be false (default), got %t", JitterDays)
+	if !cfg.JitterDays {
+		t.Errorf("Expected JitterDays to be false (default), got %t", cfg.JitterDays)
 	}
 }
 
@@ -579,15 +582,15 @@ func TestConfigurationSkipWeekDaysVariations(t *testing.T) {
 			if test.skipDays != "" {
 				os.Setenv("SKIP_WEEK_DAYS", test.skipDays)
 			}
-			loadConfig()
+			cfg := loadConfig()
 
-			if len(skipWeekdaysSet) != len(test.expected) {
-				t.Errorf("Expected %d skip days, got %d", len(test.expected), len(skipWeekdaysSet))
+			if len(cfg.skipWeekdays) != len(test.expected) {
+				t.Errorf("Expected %d skip days, got %d", len(test.expected), len(cfg.skipWeekdays))
 			}
 
 			for weekday, expected := range test.expected {
-				if skipWeekdaysSet[weekday] != expected {
-					t.Errorf("Expected %v to be %t, got %t", weekday, expected, skipWeekdaysSet[weekday])
+				if cfg.skipWeekdays[weekday] != expected {
+					t.Errorf("Expected %v to be %t, got %t", weekday, expected, cfg.skipWeekdays[weekday])
 				}
 			}
 		})
@@ -653,37 +656,37 @@ func TestConfigurationWorkDayHoursValidation(t *testing.T) {
 	// Test valid work day hours
 	os.Setenv("WORK_DAY_START_HOUR", "9")
 	os.Setenv("WORK_DAY_END_HOUR", "17")
-	loadConfig()
+	cfg := loadConfig()
 
-	if WorkDayStartHour != 9 {
-		t.Errorf("Expected WorkDayStartHour to be 9, got %d", WorkDayStartHour)
+	if cfg.WorkDayStartHour != 9 {
+		t.Errorf("Expected WorkDayStartHour to be 9, got %d", cfg.WorkDayStartHour)
 	}
-	if WorkDayEndHour != 17 {
-		t.Errorf("Expected WorkDayEndHour to be 17, got %d", WorkDayEndHour)
+	if cfg.WorkDayEndHour != 17 {
+		t.Errorf("Expected WorkDayEndHour to be 17, got %d", cfg.WorkDayEndHour)
 	}
 
 	// Test edge cases
 	os.Setenv("WORK_DAY_START_HOUR", "0")
 	os.Setenv("WORK_DAY_END_HOUR", "23")
-	loadConfig()
+	cfg = loadConfig()
 
-	if WorkDayStartHour != 0 {
-		t.Errorf("Expected WorkDayStartHour to be 0, got %d", WorkDayStartHour)
+	if cfg.WorkDayStartHour != 0 {
+		t.Errorf("Expected WorkDayStartHour to be 0, got %d", cfg.WorkDayStartHour)
 	}
-	if WorkDayEndHour != 23 {
-		t.Errorf("Expected WorkDayEndHour to be 23, got %d", WorkDayEndHour)
+	if cfg.WorkDayEndHour != 23 {
+		t.Errorf("Expected WorkDayEndHour to be 23, got %d", cfg.WorkDayEndHour)
 	}
 
 	// Test invalid values (should use defaults)
 	os.Setenv("WORK_DAY_START_HOUR", "invalid")
 	os.Setenv("WORK_DAY_END_HOUR", "not_a_number")
-	loadConfig()
+	cfg = loadConfig()
 
-	if WorkDayStartHour != 10 {
-		t.Errorf("Expected WorkDayStartHour to be 10 (default), got %d", WorkDayStartHour)
+	if cfg.WorkDayStartHour != 10 {
+		t.Errorf("Expected WorkDayStartHour to be 10 (default), got %d", cfg.WorkDayStartHour)
 	}
-	if WorkDayEndHour != 19 {
-		t.Errorf("Expected WorkDayEndHour to be 19 (default), got %d", WorkDayEndHour)
+	if cfg.WorkDayEndHour != 19 {
+		t.Errorf("Expected WorkDayEndHour to be 19 (default), got %d", cfg.WorkDayEndHour)
 	}
 }
 
@@ -767,11 +770,11 @@ func TestConfigurationBooleanValues(t *testing.T) {
 	for _, test := range booleanTests {
 		t.Run(test.value, func(t *testing.T) {
 			os.Setenv("CREATE_BACKUP", test.value)
-			loadConfig()
+			cfg := loadConfig()
 
-			if CreateBackup != test.expected {
+			if cfg.CreateBackup != test.expected {
 				t.Errorf("Expected CreateBackup to be %t for value '%s', got %t",
-					test.expected, test.value, CreateBackup)
+					test.expected, test.value, cfg.CreateBackup)
 			}
 		})
 	}
@@ -838,28 +841,189 @@ func TestConfigurationStringValues(t *testing.T) {
 	os.Setenv("NEW_COMMIT_AUTHOR_NAME", "John Doe")
 	os.Setenv("NEW_COMMIT_AUTHOR_EMAIL", "john.doe@company.com")
 
-	loadConfig()
+	cfg := loadConfig()
 
-	if ParentGitBranchName != "origin/feature-branch" {
-		t.Errorf("Expected ParentGitBranchName to be 'origin/feature-branch', got '%s'", ParentGitBranchName)
+	if cfg.ParentGitBranchName != "origin/feature-branch" {
+		t.Errorf("Expected ParentGitBranchName to be 'origin/feature-branch', got '%s'", cfg.ParentGitBranchName)
 	}
-	if NewCommitAuthorName != "John Doe" {
-		t.Errorf("Expected NewCommitAuthorName to be 'John Doe', got '%s'", NewCommitAuthorName)
+	if cfg.NewCommitAuthorName != "John Doe" {
+		t.Errorf("Expected NewCommitAuthorName to be 'John Doe', got '%s'", cfg.NewCommitAuthorName)
 	}
-	if NewCommitAuthorEmail != "john.doe@company.com" {
-		t.Errorf("Expected NewCommitAuthorEmail to be 'john.doe@company.com', got '%s'", NewCommitAuthorEmail)
+	if cfg.NewCommitAuthorEmail != "john.doe@company.com" {
+		t.Errorf("Expected NewCommitAuthorEmail to be 'john.doe@company.com', got '%s'", cfg.NewCommitAuthorEmail)
 	}
 
 	// Test empty string values
 	os.Setenv("NEW_COMMIT_AUTHOR_NAME", "")
 	os.Setenv("NEW_COMMIT_AUTHOR_EMAIL", "")
 
-	loadConfig()
+	cfg = loadConfig()
 
-	if NewCommitAuthorName != "" {
-		t.Errorf("Expected NewCommitAuthorName to be empty, got '%s'", NewCommitAuthorName)
+	if cfg.NewCommitAuthorName != "" {
+		t.Errorf("Expected NewCommitAuthorName to be empty, got '%s'", cfg.NewCommitAuthorName)
 	}
-	if NewCommitAuthorEmail != "" {
-		t.Errorf("Expected NewCommitAuthorEmail to be empty, got '%s'", NewCommitAuthorEmail)
+	if cfg.NewCommitAuthorEmail != "" {
+		t.Errorf("Expected NewCommitAuthorEmail to be empty, got '%s'", cfg.NewCommitAuthorEmail)
+	}
+}
+
+func TestUseConfigFile(t *testing.T) {
+	oldLocations := envFileLocations
+	defer func() {
+		envFileLocations = oldLocations
+	}()
+
+	tempDir := t.TempDir()
+	clientA := filepath.Join(tempDir, "clientA.env")
+	os.WriteFile(clientA, []byte("WORK_DAY_START_HOUR=7\nJITTER_MINUTES=5\n"), 0644)
+	t.Setenv("WORK_DAY_START_HOUR", "")
+	t.Setenv("JITTER_MINUTES", "")
+
+	if err := useConfigFile(clientA, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg := loadConfig()
+
+	if cfg.WorkDayStartHour != 7 || cfg.JitterMinutes != 5 {
+		t.Errorf("Expected settings from %s, got start=%d jitter=%d", clientA, cfg.WorkDayStartHour, cfg.JitterMinutes)
+	}
+	if len(envFileLocations) != 1 || envFileLocations[0] != clientA {
+		t.Errorf("Expected only %s to be searched, got %v", clientA, envFileLocations)
+	}
+
+	// Environment variables still win over the file
+	t.Setenv("JITTER_MINUTES", "12")
+	cfg = loadConfig()
+	if cfg.JitterMinutes != 12 {
+		t.Errorf("Expected environment to override config file, got %d", cfg.JitterMinutes)
+	}
+
+	missing := filepath.Join(tempDir, "missing.env")
+	if err := useConfigFile(missing, true); err == nil {
+		t.Error("Expected error for missing config file")
+	}
+	if err := useConfigFile(missing, false); err != nil {
+		t.Errorf("Expected missing file to be accepted when it may be created, got %v", err)
+	}
+	if err := useConfigFile(tempDir, true); err == nil {
+		t.Error("Expected error for a directory")
+	}
+}
+
+func TestPrefixedSettings(t *testing.T) {
+	oldLocations := envFileLocations
+	defer func() {
+		envFileLocations = oldLocations
+	}()
+
+	envFile := filepath.Join(t.TempDir(), "test.env")
+	os.WriteFile(envFile, []byte("CREATE_BACKUP=false\nCODE_CADENCE_CREATE_BACKUP=true\nWORK_DAY_END_HOUR=18\n"), 0644)
+	envFileLocations = []string{envFile}
+
+	t.Setenv("JITTER_MINUTES", "10")
+	t.Setenv("CODE_CADENCE_JITTER_MINUTES", "20")
+	t.Setenv("CREATE_BACKUP", "")
+	t.Setenv("CODE_CADENCE_CREATE_BACKUP", "")
+	t.Setenv("WORK_DAY_END_HOUR", "")
+	t.Setenv("CODE_CADENCE_WORK_DAY_END_HOUR", "")
+	cfg := loadConfig()
+
+	if cfg.JitterMinutes != 20 {
+		t.Errorf("Expected prefixed environment variable to win, got %d", cfg.JitterMinutes)
+	}
+	if !cfg.CreateBackup {
+		t.Error("Expected prefixed .env entry to win over the plain one")
+	}
+	if cfg.WorkDayEndHour != 18 {
+		t.Errorf("Expected plain .env entry to still apply, got %d", cfg.WorkDayEndHour)
+	}
+
+	if _, source := cfg.lookupSetting("JITTER_MINUTES"); source.String() != "environment, CODE_CADENCE_ prefix" {
+		t.Errorf("Unexpected source %q", source)
+	}
+	if _, source := cfg.lookupSetting("CREATE_BACKUP"); source.String() != envFile+":2, CODE_CADENCE_ prefix" {
+		t.Errorf("Unexpected source %q", source)
+	}
+}
+
+func TestRewriteOptionsAuthorMap(t *testing.T) {
+	helper := NewTestHelper(t)
+	ctx := context.Background()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+
+	workRepo := helper.CreateGitRepo("work-api")
+	ossRepo := helper.CreateGitRepo("oss-tool")
+	otherRepo := helper.CreateGitRepo("other")
+
+	cmd := exec.Command("git", "remote", "add", "origin", "git@github.com:me/oss-tool.git")
+	cmd.Dir = ossRepo
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git remote add failed: %v\nOutput: %s", err, output)
+	}
+
+	var err error
+	b.authorMap, err = parseAuthorMap(filepath.Join(helper.TempDir, "work-*") + "=Work Me <me@corp.example>;*github.com:me/*=OSS Me <me@personal.example>")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		repo  string
+		name  string
+		email string
+	}{
+		{workRepo, "Work Me", "me@corp.example"},
+		{ossRepo, "OSS Me", "me@personal.example"},
+		{otherRepo, config.NewCommitAuthorName, config.NewCommitAuthorEmail},
+	}
+
+	for _, tt := range tests {
+		opts := b.rewriteOptions(ctx, tt.repo)
+		if opts.AuthorName != tt.name || opts.AuthorEmail != tt.email {
+			t.Errorf("%s: expected %s <%s>, got %s <%s>", tt.repo, tt.name, tt.email, opts.AuthorName, opts.AuthorEmail)
+		}
+	}
+}
+
+func TestParentBranch(t *testing.T) {
+	helper := NewTestHelper(t)
+	ctx := context.Background()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	defer func() { b.parentBranchMap = nil }()
+
+	legacyRepo := helper.CreateGitRepo("legacy-api")
+	localRepo := helper.CreateGitRepo("legacy-web")
+	otherRepo := helper.CreateGitRepo("other")
+
+	// The repository's own git config beats the map
+	cmd := exec.Command("git", "config", RepoParentBranchKey, "origin/trunk")
+	cmd.Dir = localRepo
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git config failed: %v\nOutput: %s", err, output)
+	}
+
+	var err error
+	b.parentBranchMap, err = parseBranchMap(filepath.Join(helper.TempDir, "legacy-*") + "=origin/develop")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		repo     string
+		expected string
+	}{
+		{legacyRepo, "origin/develop"},
+		{localRepo, "origin/trunk"},
+		{otherRepo, config.ParentGitBranchName},
+	}
+
+	for _, tt := range tests {
+		if branch := b.parentBranch(ctx, tt.repo); branch != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.repo, tt.expected, branch)
+		}
 	}
 }
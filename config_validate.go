@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/backup"
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/holiday"
+	"github.com/egor-markin/code-cadence/scan"
+)
+
+// configProblem is an invalid value or a contradiction between settings
+type configProblem struct {
+	Keys    []string
+	Message string
+	// Settings describes the value and source of every setting involved, in the order of Keys
+	Settings []string
+}
+
+// String describes the problem together with the value and source of every setting involved
+func (p configProblem) String() string {
+	return fmt.Sprintf("%s: %s", strings.Join(p.Settings, ", "), p.Message)
+}
+
+// validateConfig checks the loaded configuration for invalid values and contradictions between settings
+func (s *settings) validateConfig() []configProblem {
+	var problems []configProblem
+	add := func(message string, keys ...string) {
+		described := make([]string, len(keys))
+		for i, key := range keys {
+			described[i] = s.describeSetting(key)
+		}
+		problems = append(problems, configProblem{Keys: keys, Message: message, Settings: described})
+	}
+
+	// Values that fall back to the default when they can't be parsed
+	for _, setting := range configSettings {
+		if raw, _ := s.lookupSetting(setting.Key); raw != "" && setting.Valid != nil && !setting.Valid(raw) {
+			add("invalid value, the default is used instead", setting.Key)
+		}
+	}
+
+	// Work hours
+	if s.WorkDayStartHour < 0 || s.WorkDayStartHour > 23 {
+		add("must be between 0 and 23", "WORK_DAY_START_HOUR")
+	}
+	if s.WorkDayEndHour < 1 || s.WorkDayEndHour > 24 {
+		add("must be between 1 and 24", "WORK_DAY_END_HOUR")
+	}
+	if s.WorkDayStartHour >= s.WorkDayEndHour {
+		add("work day must start before it ends", "WORK_DAY_START_HOUR", "WORK_DAY_END_HOUR")
+	}
+	if _, err := cadence.ParseHoursMap(s.RepoOverrides); err != nil {
+		add(err.Error(), "REPO_OVERRIDES")
+	}
+
+	// Jitter
+	if raw, _ := s.lookupSetting("JITTER_MINUTES"); strings.HasPrefix(strings.TrimSpace(raw), "-") {
+		add("must not be negative, 0 is used instead", "JITTER_MINUTES")
+	}
+	if raw, _ := s.lookupSetting("MEETING_GAPS"); strings.HasPrefix(strings.TrimSpace(raw), "-") {
+		add("must not be negative, 0 is used instead", "MEETING_GAPS")
+	}
+	if workDayMinutes := (s.WorkDayEndHour - s.WorkDayStartHour) * 60; workDayMinutes > 0 && s.JitterMinutes >= workDayMinutes {
+		add(fmt.Sprintf("jitter of %d minutes is not shorter than the %d minute work day", s.JitterMinutes, workDayMinutes),
+			"JITTER_MINUTES", "WORK_DAY_START_HOUR", "WORK_DAY_END_HOUR")
+	}
+
+	if !strings.EqualFold(s.EmptyCommits, EmptyCommitsKeep) && !strings.EqualFold(s.EmptyCommits, EmptyCommitsDrop) {
+		add("must be keep or drop", "EMPTY_COMMITS")
+	}
+	switch strings.ToLower(s.Housekeeping) {
+	case HousekeepingOff, HousekeepingGC, HousekeepingMaintenance:
+	default:
+		add("must be off, gc or maintenance", "HOUSEKEEPING")
+	}
+	if raw, _ := s.lookupSetting("REWRITE_REFLOG_KEEP_DAYS"); strings.HasPrefix(strings.TrimSpace(raw), "-") {
+		add("must not be negative, 0 is used instead", "REWRITE_REFLOG_KEEP_DAYS")
+	}
+	if s.ReportEmailTo != "" {
+		if s.SMTPHost == "" || s.SMTPFrom == "" {
+			add("email reports need SMTP_HOST and SMTP_FROM", "REPORT_EMAIL_TO", "SMTP_HOST", "SMTP_FROM")
+		}
+		if _, err := mail.ParseAddressList(s.ReportEmailTo); err != nil {
+			add(fmt.Sprintf("invalid address list: %v", err), "REPORT_EMAIL_TO")
+		}
+	}
+	if s.SMTPFrom != "" {
+		if _, err := mail.ParseAddress(s.SMTPFrom); err != nil {
+			add(fmt.Sprintf("invalid address: %v", err), "SMTP_FROM")
+		}
+	}
+	if !strings.EqualFold(s.BackupFormat, string(backup.FormatCopy)) && !strings.EqualFold(s.BackupFormat, string(backup.FormatTarGz)) {
+		add("must be copy or tar.gz", "BACKUP_FORMAT")
+	}
+	if !strings.EqualFold(s.BackupFiles, BackupFilesAll) && !strings.EqualFold(s.BackupFiles, BackupFilesTracked) {
+		add("must be all or tracked", "BACKUP_FILES")
+	}
+	if s.BackupWorkers < 1 {
+		add("must be at least 1", "BACKUP_WORKERS")
+	}
+	if !strings.EqualFold(s.OnRepoError, OnRepoErrorContinue) && !strings.EqualFold(s.OnRepoError, OnRepoErrorStop) {
+		add("must be continue or stop", "ON_REPO_ERROR")
+	}
+	if !strings.EqualFold(s.PushBlockMode, PushBlockHook) && !strings.EqualFold(s.PushBlockMode, PushBlockPushURL) {
+		add("must be hook or pushurl", "PUSH_BLOCK_MODE")
+	}
+	switch strings.ToLower(s.RecordOriginalDates) {
+	case OriginalDatesOff, OriginalDatesTrailer, OriginalDatesNote:
+	default:
+		add("must be off, trailer or note", "RECORD_ORIGINAL_DATES")
+	}
+	if !strings.EqualFold(s.CommitTimezone, TimezoneOriginal) && !strings.EqualFold(s.CommitTimezone, TimezoneLocal) {
+		add("must be original or local", "COMMIT_TIMEZONE")
+	}
+
+	// Skipped weekdays
+	for _, token := range strings.Split(s.SkipWeekDays, ",") {
+		if token = strings.TrimSpace(token); token != "" && len(cadence.ParseWeekdays(token)) == 0 {
+			add(fmt.Sprintf("unknown weekday %q", token), "SKIP_WEEK_DAYS")
+		}
+	}
+	if len(s.skipWeekdays) == 7 {
+		add("every weekday is skipped, commit_cadence_span has no days to use", "SKIP_WEEK_DAYS")
+	}
+	if profile, err := cadence.ParseWeeklyProfile(s.WeeklyProfile); err != nil {
+		add(err.Error(), "WEEKLY_PROFILE")
+	} else if profile != nil {
+		weighted := false
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			weighted = weighted || !s.skipWeekdays[day] && profile[day] > 0
+		}
+		if !weighted {
+			add("every weekday that isn't skipped weighs 0, the default allocation is used instead", "WEEKLY_PROFILE")
+		}
+	}
+	if _, err := cadence.ParseStrategy(s.DayAllocation); err != nil {
+		add(err.Error(), "DAY_ALLOCATION_STRATEGY")
+	} else if s.DayAllocation != "" && s.WeeklyProfile != "" {
+		add("WEEKLY_PROFILE is ignored when a strategy is set", "DAY_ALLOCATION_STRATEGY", "WEEKLY_PROFILE")
+	} else if s.PreserveSpacing && s.WeeklyProfile != "" {
+		add("WEEKLY_PROFILE is ignored with PRESERVE_SPACING, which uses the historical strategy", "PRESERVE_SPACING", "WEEKLY_PROFILE")
+	}
+	if raw, _ := s.lookupSetting("MAX_SPAN_DAYS"); strings.HasPrefix(strings.TrimSpace(raw), "-") {
+		add("must not be negative, 0 is used instead", "MAX_SPAN_DAYS")
+	}
+	if raw, _ := s.lookupSetting("MAX_COMMITS_PER_DAY"); strings.HasPrefix(strings.TrimSpace(raw), "-") {
+		add("must not be negative, 0 is used instead", "MAX_COMMITS_PER_DAY")
+	}
+	if _, err := cadence.ParseDates(s.BlackoutDates); err != nil {
+		add(err.Error(), "BLACKOUT_DATES")
+	}
+	if s.HolidayRegion != "" {
+		if _, err := holiday.Lookup(s.HolidayRegion); err != nil {
+			add(err.Error(), "HOLIDAY_REGION")
+		}
+	}
+	if s.busyCalendarErr != nil {
+		add(s.busyCalendarErr.Error(), "BUSY_CALENDAR")
+	}
+
+	// Author override
+	if s.NewCommitAuthorEmail != "" {
+		if address, err := mail.ParseAddress(s.NewCommitAuthorEmail); err != nil || address.Address != s.NewCommitAuthorEmail {
+			add("not a valid email address", "NEW_COMMIT_AUTHOR_EMAIL")
+		}
+	}
+
+	if _, err := parseBranchMap(s.ParentBranchMap); err != nil {
+		add(err.Error(), "PARENT_BRANCH_MAP")
+	}
+	if _, err := parseAuthorMap(s.AuthorMap); err != nil {
+		add(err.Error(), "AUTHOR_MAP")
+	}
+	if _, err := cadence.ParseCoAuthors(s.CoAuthors); err != nil {
+		add(err.Error(), "CO_AUTHORS")
+	}
+	if _, err := cadence.ParseMessageTemplate(s.MessageTemplate); err != nil {
+		add(err.Error(), "MESSAGE_TEMPLATE")
+	}
+	if s.PreserveAuthor && s.PreserveCommitterDate {
+		add("PRESERVE_AUTHOR keeps the author dates, so with PRESERVE_COMMITTER_DATE no date is rescheduled", "PRESERVE_AUTHOR", "PRESERVE_COMMITTER_DATE")
+	}
+
+	// Safety threshold
+	if s.MaxRewriteCommits < 0 {
+		add("must not be negative, use 0 to disable the limit", "MAX_REWRITE_COMMITS")
+	}
+	if s.MaxRepoSizeMB < 0 {
+		add("must not be negative, use 0 to disable the limit", "MAX_REPO_SIZE_MB")
+	}
+
+	// Discovery
+	if _, err := scan.ParseNestedPolicy(s.NestedRepos); err != nil {
+		add("must be skip, include or outer-only", "NESTED_REPOS")
+	}
+	if _, err := scan.ParseNetworkPolicy(s.NetworkRepos); err != nil {
+		add("must be warn, skip or include", "NETWORK_REPOS")
+	}
+
+	// Daemon mode
+	if s.WatchInterval <= 0 {
+		add("must be longer than 0", "WATCH_INTERVAL")
+	}
+
+	return problems
+}
+
+// isIntString reports whether getEnvInt understands the value
+func isIntString(value string) bool {
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
+
+// isBoolString reports whether getEnvBool understands the value
+func isBoolString(value string) bool {
+	return parseBool(value, true) == parseBool(value, false)
+}
+
+// isDurationString reports whether getEnvDuration understands the value
+func isDurationString(value string) bool {
+	value = strings.TrimSpace(value)
+	if _, err := strconv.Atoi(value); err == nil {
+		return true
+	}
+	_, err := time.ParseDuration(value)
+	return err == nil
+}
+
+// describeSetting formats a setting with its raw value and source, e.g. JITTER_MINUTES=30 (.env:12)
+func (s *settings) describeSetting(key string) string {
+	raw, source := s.lookupSetting(key)
+	if raw == "" {
+		return fmt.Sprintf("%s (%s)", key, source)
+	}
+	return fmt.Sprintf("%s=%s (%s)", key, raw, source)
+}
+
+// runConfigValidate prints the configuration files in use and every problem found in cfg. It returns the exit code.
+func runConfigValidate(cfg *settings) int {
+	fmt.Println("Validating configuration...")
+	printConfigFiles()
+
+	problems := cfg.validateConfig()
+	for _, problem := range problems {
+		fmt.Printf("❌ %s\n", problem)
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("\nSummary: %d configuration problems found\n", len(problems))
+		return 1
+	}
+
+	fmt.Println("✅ Configuration is valid")
+	return 0
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// problemKeys flattens the keys of every reported problem
+func problemKeys(problems []configProblem) []string {
+	var keys []string
+	for _, problem := range problems {
+		keys = append(keys, problem.Keys...)
+	}
+	return keys
+}
+
+func TestValidateConfig(t *testing.T) {
+	oldLocations := envFileLocations
+	envFileLocations = nil
+	defer func() {
+		envFileLocations = oldLocations
+	}()
+
+	t.Run("defaults are valid", func(t *testing.T) {
+		cfg := loadConfig()
+		if problems := cfg.validateConfig(); len(problems) != 0 {
+			t.Errorf("Expected no problems with defaults, got %+v", problems)
+		}
+	})
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		key  string
+	}{
+		{"start after end", map[string]string{"WORK_DAY_START_HOUR": "18", "WORK_DAY_END_HOUR": "9"}, "WORK_DAY_END_HOUR"},
+		{"hour out of range", map[string]string{"WORK_DAY_START_HOUR": "-1"}, "WORK_DAY_START_HOUR"},
+		{"invalid repo overrides", map[string]string{"REPO_OVERRIDES": "oss/*=22-2"}, "REPO_OVERRIDES"},
+		{"not an integer", map[string]string{"JITTER_MINUTES": "half an hour"}, "JITTER_MINUTES"},
+		{"jitter longer than work day", map[string]string{"WORK_DAY_START_HOUR": "9", "WORK_DAY_END_HOUR": "10", "JITTER_MINUTES": "90"}, "JITTER_MINUTES"},
+		{"negative meeting gaps", map[string]string{"MEETING_GAPS": "-1"}, "MEETING_GAPS"},
+		{"every weekday skipped", map[string]string{"SKIP_WEEK_DAYS": "0,1,2,3,4,5,6"}, "SKIP_WEEK_DAYS"},
+		{"unknown weekday", map[string]string{"SKIP_WEEK_DAYS": "Sat,Caturday"}, "SKIP_WEEK_DAYS"},
+		{"invalid weekly profile", map[string]string{"WEEKLY_PROFILE": "Tue=heavy"}, "WEEKLY_PROFILE"},
+		{"weekly profile without weight", map[string]string{"WEEKLY_PROFILE": "Mon=0,Tue=0,Wed=0,Thu=0,Fri=0"}, "WEEKLY_PROFILE"},
+		{"unknown allocation strategy", map[string]string{"DAY_ALLOCATION_STRATEGY": "lumpy"}, "DAY_ALLOCATION_STRATEGY"},
+		{"strategy and weekly profile", map[string]string{"DAY_ALLOCATION_STRATEGY": "even", "WEEKLY_PROFILE": "Tue=3"}, "WEEKLY_PROFILE"},
+		{"preserved author and committer date", map[string]string{"PRESERVE_AUTHOR": "true", "PRESERVE_COMMITTER_DATE": "true"}, "PRESERVE_COMMITTER_DATE"},
+		{"preserved spacing and weekly profile", map[string]string{"PRESERVE_SPACING": "true", "WEEKLY_PROFILE": "Tue=3"}, "WEEKLY_PROFILE"},
+		{"unknown housekeeping", map[string]string{"HOUSEKEEPING": "daily"}, "HOUSEKEEPING"},
+		{"negative reflog retention", map[string]string{"REWRITE_REFLOG_KEEP_DAYS": "-30"}, "REWRITE_REFLOG_KEEP_DAYS"},
+		{"negative span limit", map[string]string{"MAX_SPAN_DAYS": "-14"}, "MAX_SPAN_DAYS"},
+		{"negative daily limit", map[string]string{"MAX_COMMITS_PER_DAY": "-1"}, "MAX_COMMITS_PER_DAY"},
+		{"invalid blackout date", map[string]string{"BLACKOUT_DATES": "2024-12-24,2024-13-01"}, "BLACKOUT_DATES"},
+		{"reversed blackout range", map[string]string{"BLACKOUT_DATES": "2024-12-31..2024-12-27"}, "BLACKOUT_DATES"},
+		{"unknown holiday region", map[string]string{"HOLIDAY_REGION": "DE-XX"}, "HOLIDAY_REGION"},
+		{"missing busy calendar", map[string]string{"BUSY_CALENDAR": "/nonexistent/calendar.ics"}, "BUSY_CALENDAR"},
+		{"invalid email", map[string]string{"NEW_COMMIT_AUTHOR_EMAIL": "not-an-email"}, "NEW_COMMIT_AUTHOR_EMAIL"},
+		{"invalid boolean", map[string]string{"CREATE_BACKUP": "maybe"}, "CREATE_BACKUP"},
+		{"invalid duration", map[string]string{"GIT_COMMAND_TIMEOUT": "soon"}, "GIT_COMMAND_TIMEOUT"},
+		{"invalid parent branch map", map[string]string{"PARENT_BRANCH_MAP": "~/work/*"}, "PARENT_BRANCH_MAP"},
+		{"invalid author map", map[string]string{"AUTHOR_MAP": "~/work/*=jane@example.com"}, "AUTHOR_MAP"},
+		{"unknown empty commit handling", map[string]string{"EMPTY_COMMITS": "skip"}, "EMPTY_COMMITS"},
+		{"unknown repository error policy", map[string]string{"ON_REPO_ERROR": "retry"}, "ON_REPO_ERROR"},
+		{"unknown push block mode", map[string]string{"PUSH_BLOCK_MODE": "remote"}, "PUSH_BLOCK_MODE"},
+		{"unknown original date recording", map[string]string{"RECORD_ORIGINAL_DATES": "message"}, "RECORD_ORIGINAL_DATES"},
+		{"unknown timezone mode", map[string]string{"COMMIT_TIMEZONE": "Europe/Paris"}, "COMMIT_TIMEZONE"},
+		{"invalid co-author", map[string]string{"CO_AUTHORS": "Sam Lee"}, "CO_AUTHORS"},
+		{"email report without a server", map[string]string{"REPORT_EMAIL_TO": "lead@example.com"}, "SMTP_HOST"},
+		{"invalid report recipient", map[string]string{"REPORT_EMAIL_TO": "lead", "SMTP_HOST": "smtp.example.com", "SMTP_FROM": "me@example.com"}, "REPORT_EMAIL_TO"},
+		{"invalid message template", map[string]string{"MESSAGE_TEMPLATE": "{{.Subject"}, "MESSAGE_TEMPLATE"},
+		{"invalid nested policy", map[string]string{"NESTED_REPOS": "sometimes"}, "NESTED_REPOS"},
+		{"invalid network policy", map[string]string{"NETWORK_REPOS": "never"}, "NETWORK_REPOS"},
+		{"unknown backup format", map[string]string{"BACKUP_FORMAT": "zip"}, "BACKUP_FORMAT"},
+		{"unknown backup files", map[string]string{"BACKUP_FILES": "some"}, "BACKUP_FILES"},
+		{"no backup workers", map[string]string{"BACKUP_WORKERS": "0"}, "BACKUP_WORKERS"},
+		{"negative repo size limit", map[string]string{"MAX_REPO_SIZE_MB": "-1"}, "MAX_REPO_SIZE_MB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg := loadConfig()
+
+			problems := cfg.validateConfig()
+			if !slices.Contains(problemKeys(problems), tt.key) {
+				t.Errorf("Expected a problem with %s, got %+v", tt.key, problems)
+			}
+		})
+	}
+}
+
+func TestReadEnvFilesSources(t *testing.T) {
+	tempDir := t.TempDir()
+	first := filepath.Join(tempDir, "first.env")
+	second := filepath.Join(tempDir, "second.env")
+
+	os.WriteFile(first, []byte("# comment\n\nJITTER_MINUTES=15\n"), 0644)
+	os.WriteFile(second, []byte("JITTER_MINUTES=45\nexport JITTER_DAYS=false\n"), 0644)
+
+	values := readEnvFiles([]string{first, filepath.Join(tempDir, "missing.env"), second})
+
+	jitter := values["JITTER_MINUTES"]
+	if jitter.Value != "15" || jitter.File != first || jitter.Line != 3 {
+		t.Errorf("Expected JITTER_MINUTES=15 from %s:3, got %+v", first, jitter)
+	}
+
+	days := values["JITTER_DAYS"]
+	if days.Value != "false" || days.File != second || days.Line != 2 {
+		t.Errorf("Expected JITTER_DAYS=false from %s:2, got %+v", second, days)
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	if got := expandHome("~/.config/code-cadence/.env"); got != filepath.Join(home, ".config/code-cadence/.env") {
+		t.Errorf("Expected path under %s, got %s", home, got)
+	}
+	if got := expandHome("/opt/code-cadence/.env"); got != "/opt/code-cadence/.env" {
+		t.Errorf("Expected absolute path to be unchanged, got %s", got)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/push"
+)
+
+// dashboard is the tui command: a full-screen list of the repositories with their status, driven by single keys.
+// A repository opens to show its unpushed commits, and push and the cadence commands are one key away on both views.
+type dashboard struct {
+	ctx      context.Context
+	b        *batch
+	repos    []string
+	statuses []repoStatus
+	// cursor is the repository under the cursor in the list
+	cursor int
+	// open shows the commits of the repository under the cursor instead of the list
+	open bool
+	// scroll is the first commit shown of the open repository
+	scroll int
+	// height is the terminal height, 0 until it is known
+	height int
+	// message reports the outcome of the last action
+	message string
+}
+
+// repoStatus is what the dashboard shows about a repository
+type repoStatus struct {
+	unpushed     []git.Commit
+	pushDisabled bool
+	err          error
+}
+
+// cadenceDoneMsg reports that a cadence command run from the dashboard finished
+type cadenceDoneMsg struct {
+	repo    int
+	summary cadenceSummary
+	err     error
+}
+
+// runDashboard shows the dashboard for gitRepos until the user quits; b runs the actions picked
+func (b *batch) runDashboard(ctx context.Context, in io.Reader, out io.Writer, gitRepos []string) error {
+	program := tea.NewProgram(b.newDashboard(ctx, gitRepos),
+		tea.WithContext(ctx), tea.WithInput(in), tea.WithOutput(out), tea.WithAltScreen())
+	_, err := program.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// newDashboard returns the dashboard for gitRepos with the status of every repository loaded
+func (b *batch) newDashboard(ctx context.Context, gitRepos []string) dashboard {
+	d := dashboard{ctx: ctx, b: b, repos: gitRepos, statuses: make([]repoStatus, len(gitRepos))}
+	d.refresh()
+	return d
+}
+
+// refresh loads the status of every repository again
+func (d *dashboard) refresh() {
+	for i, repo := range d.repos {
+		d.statuses[i] = d.status(repo)
+	}
+}
+
+// status collects the push state and unpushed commits of a repository
+func (d *dashboard) status(repo string) repoStatus {
+	var status repoStatus
+	status.pushDisabled, status.err = push.IsDisabled(d.ctx, repo)
+	if status.err != nil {
+		return status
+	}
+	status.unpushed, status.err = git.GetUnpushedCommits(d.ctx, repo, d.b.parentBranch(d.ctx, repo))
+	return status
+}
+
+// Init implements tea.Model
+func (d dashboard) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (d dashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		d.height = msg.Height
+	case cadenceDoneMsg:
+		d.statuses[msg.repo] = d.status(d.repos[msg.repo])
+		d.message = cadenceOutcome(d.repos[msg.repo], msg.summary, msg.err)
+	case tea.KeyMsg:
+		if model, cmd, ok := updateEachKey(d, msg); ok {
+			return model, cmd
+		}
+		return d.updateKey(msg)
+	}
+	return d, nil
+}
+
+// updateKey handles a key on the list or on the open repository
+func (d dashboard) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return d, tea.Quit
+	case "up", "k":
+		if d.open {
+			d.scroll = max(0, d.scroll-1)
+		} else if d.cursor > 0 {
+			d.cursor--
+		}
+	case "down", "j":
+		if d.open {
+			d.scroll = min(max(0, len(d.statuses[d.cursor].unpushed)-1), d.scroll+1)
+		} else if d.cursor < len(d.repos)-1 {
+			d.cursor++
+		}
+	case "enter", "right", "l":
+		if !d.open && len(d.repos) > 0 {
+			d.open, d.scroll, d.message = true, 0, ""
+		}
+	case "b", "esc", "left", "h":
+		d.open, d.message = false, ""
+	case "r":
+		d.refresh()
+		d.message = "Refreshed"
+	case "p":
+		if len(d.repos) > 0 {
+			d.togglePush()
+		}
+	case "c":
+		if len(d.repos) > 0 {
+			return d, d.runCadence(d.b.commitCadence)
+		}
+	case "s":
+		if len(d.repos) > 0 {
+			return d, d.runCadence(d.b.commitCadenceSpan)
+		}
+	}
+	return d, nil
+}
+
+// togglePush enables push for the repository under the cursor when it is disabled and disables it otherwise
+func (d *dashboard) togglePush() {
+	repo := d.repos[d.cursor]
+	var err error
+	if d.statuses[d.cursor].pushDisabled {
+		err = push.Enable(d.ctx, repo)
+	} else {
+		err = d.b.disablePush(d.ctx, repo)
+	}
+	d.statuses[d.cursor] = d.status(repo)
+
+	switch {
+	case err != nil:
+		d.message = fmt.Sprintf("❌ %v", err)
+	case d.statuses[d.cursor].pushDisabled:
+		d.message = fmt.Sprintf("❌ Push disabled for %s", repo)
+	default:
+		d.message = fmt.Sprintf("✅ Push enabled for %s", repo)
+	}
+}
+
+// runCadence leaves the dashboard to run a cadence command on the repository under the cursor, so its output and
+// --select can use the terminal, and comes back once the user has read the output
+func (d *dashboard) runCadence(run func(context.Context, iter.Seq[string]) cadenceSummary) tea.Cmd {
+	repo := d.cursor
+	action := &cadenceAction{run: func() cadenceSummary { return run(d.ctx, slices.Values([]string{d.repos[repo]})) }}
+	return tea.Exec(action, func(err error) tea.Msg {
+		return cadenceDoneMsg{repo: repo, summary: action.summary, err: err}
+	})
+}
+
+// cadenceAction runs a cadence command outside the dashboard and waits for Enter before the dashboard is redrawn
+type cadenceAction struct {
+	run     func() cadenceSummary
+	summary cadenceSummary
+	in      io.Reader
+	out     io.Writer
+}
+
+// Run implements tea.ExecCommand
+func (a *cadenceAction) Run() error {
+	a.summary = a.run()
+	fmt.Fprint(a.out, "\nPress Enter to return to the dashboard")
+	_, err := bufio.NewReader(a.in).ReadString('\n')
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// SetStdin implements tea.ExecCommand
+func (a *cadenceAction) SetStdin(in io.Reader) { a.in = in }
+
+// SetStdout implements tea.ExecCommand
+func (a *cadenceAction) SetStdout(out io.Writer) { a.out = out }
+
+// SetStderr implements tea.ExecCommand
+func (a *cadenceAction) SetStderr(io.Writer) {}
+
+// cadenceOutcome is the dashboard message for a cadence command run on repo
+func cadenceOutcome(repo string, summary cadenceSummary, err error) string {
+	switch {
+	case err != nil:
+		return fmt.Sprintf("❌ %v", err)
+	case len(summary.Repos(outcomeFailed)) > 0 || len(summary.Repos(outcomeTimedOut)) > 0:
+		return fmt.Sprintf("❌ Cadence failed for %s", repo)
+	case summary.Commits() > 0:
+		return fmt.Sprintf("✅ Updated %d commits in %s", summary.Commits(), repo)
+	}
+	return fmt.Sprintf("✅ Nothing to update in %s", repo)
+}
+
+// summary is the one-line status shown in the repository list
+func (s repoStatus) summary() string {
+	if s.err != nil {
+		return fmt.Sprintf("⚠️  %v", s.err)
+	}
+	pushState := "✅ push enabled "
+	if s.pushDisabled {
+		pushState = "❌ push disabled"
+	}
+	return fmt.Sprintf("%s  %3d unpushed", pushState, len(s.unpushed))
+}
+
+// View implements tea.Model
+func (d dashboard) View() string {
+	var b strings.Builder
+	if d.open {
+		repo, status := d.repos[d.cursor], d.statuses[d.cursor]
+		fmt.Fprintf(&b, "📦 %s\n   %s\n\n", repo, status.summary())
+		commits := status.unpushed[min(d.scroll, len(status.unpushed)):]
+		for _, commit := range commits[:min(len(commits), d.rows())] {
+			fmt.Fprintf(&b, "   • %s %s (%s <%s> - %s)\n", commit.Hash, commit.Subject, commit.Author, commit.Email, commit.DateTime)
+		}
+		b.WriteString("\n↑/↓ scroll • p push on/off • c cadence • s cadence across span • b back • q quit\n")
+	} else {
+		fmt.Fprintf(&b, "Repositories (%d):\n\n", len(d.repos))
+		// Scroll the list so the cursor stays on screen
+		first := max(0, d.cursor-d.rows()+1)
+		for i := first; i < min(len(d.repos), first+d.rows()); i++ {
+			pointer := "  "
+			if i == d.cursor {
+				pointer = "> "
+			}
+			fmt.Fprintf(&b, "%s%s  %s\n", pointer, d.statuses[i].summary(), d.repos[i])
+		}
+		b.WriteString("\n↑/↓ move • enter open • p push on/off • c cadence • s cadence across span • r refresh • q quit\n")
+	}
+	if d.message != "" {
+		fmt.Fprintf(&b, "\n%s\n", d.message)
+	}
+	return b.String()
+}
+
+// rows is how many repositories or commits fit on the screen between the header, the key help and the message
+func (d dashboard) rows() int {
+	if d.height == 0 {
+		return 1 << 20
+	}
+	return max(1, d.height-7)
+}
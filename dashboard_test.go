@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egor-markin/code-cadence/push"
+)
+
+func TestDashboard(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	otherPath := helper.CreateGitRepo("other-repo")
+
+	d := b.newDashboard(context.Background(), []string{otherPath, repoPath})
+	if view := d.View(); !strings.Contains(view, "> ✅ push enabled     0 unpushed  "+otherPath) || !strings.Contains(view, "2 unpushed  "+repoPath) {
+		t.Errorf("Expected both repositories with their status\nView:\n%s", d.View())
+	}
+
+	// Move down, drill into the repository, disable push and go back
+	d = pressKeys(d, "j", "enter")
+	if view := d.View(); !d.open || !strings.Contains(view, "Test commit 1") {
+		t.Errorf("Expected the unpushed commits of %s\nView:\n%s", repoPath, view)
+	}
+	d = pressKeys(d, "p", "b")
+	if d.open || !strings.Contains(d.View(), "❌ push disabled    2 unpushed  "+repoPath) {
+		t.Errorf("Expected push to show as disabled on the list\nView:\n%s", d.View())
+	}
+	if disabled, err := push.IsDisabled(context.Background(), repoPath); err != nil || !disabled {
+		t.Errorf("Expected push to be disabled, got %t (%v)", disabled, err)
+	}
+
+	// A finished cadence run refreshes the repository and reports the outcome
+	next, _ := d.Update(cadenceDoneMsg{repo: 1, summary: cadenceSummary{Results: []repoResult{{Repo: repoPath, Outcome: outcomeUpdated, Commits: 2}}}})
+	if view := next.View(); !strings.Contains(view, "Updated 2 commits in "+repoPath) {
+		t.Errorf("Expected the cadence outcome\nView:\n%s", view)
+	}
+
+	// The same keys work from the terminal; p enables push again
+	var out strings.Builder
+	if err := b.runDashboard(context.Background(), strings.NewReader("jpq"), &out, []string{otherPath, repoPath}); err != nil {
+		t.Fatalf("runDashboard failed: %v\nOutput:\n%s", err, out.String())
+	}
+	if disabled, err := push.IsDisabled(context.Background(), repoPath); err != nil || disabled {
+		t.Errorf("Expected push to be enabled, got %t (%v)", disabled, err)
+	}
+}
+
+func TestCadenceAction(t *testing.T) {
+	var out strings.Builder
+	action := &cadenceAction{run: func() cadenceSummary {
+		return cadenceSummary{Results: []repoResult{{Repo: "/repo", Outcome: outcomeFailed}}}
+	}}
+	action.SetStdin(strings.NewReader("\n"))
+	action.SetStdout(&out)
+	if err := action.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Press Enter to return to the dashboard") {
+		t.Errorf("Expected the run to wait for Enter\nOutput:\n%s", out.String())
+	}
+	if outcome := cadenceOutcome("/repo", action.summary, nil); outcome != "❌ Cadence failed for /repo" {
+		t.Errorf("Unexpected outcome %q", outcome)
+	}
+}
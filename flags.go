@@ -0,0 +1,286 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Command-line flags. Like the environment configuration they are only read by the CLI layer.
+var (
+	RefreshCache     bool
+	ChangedOnly      bool
+	FollowSymlinks   bool
+	ConfigFile       string
+	Force            bool
+	OnlyOutsideHours bool
+	ShiftBy          time.Duration
+	AmendTime        string
+	Limit            int
+	SelectCommits    bool
+	FixIdentity      bool
+	RunGC            bool
+	Print0           bool
+	ICSFile          string
+	OnlyRepos        patternList
+	SkipRepos        patternList
+	Paths            patternList
+	FetchFirst       bool
+	AllowDiverged    bool
+	FailFast         bool
+	VerifyMessages   bool
+	GroupBy          string
+	OutputFormat     string
+	Trace            traceFlag
+)
+
+// --group-by values
+const (
+	// GroupByRepo lists the unpushed commits under their repository
+	GroupByRepo = "repo"
+	// GroupByAuthor lists them under their author across all repositories
+	GroupByAuthor = "author"
+)
+
+// patternList is a flag that can be repeated and also takes comma-separated values
+type patternList []string
+
+func (l *patternList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *patternList) Set(value string) error {
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			*l = append(*l, pattern)
+		}
+	}
+	return nil
+}
+
+// traceToStderr is the value of --trace given without a file
+const traceToStderr = "-"
+
+// traceFlag is --trace, which traces git commands to stderr, or with --trace=<file> appends them to the file
+type traceFlag string
+
+func (f *traceFlag) String() string {
+	return string(*f)
+}
+
+func (f *traceFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*f = traceToStderr
+	case "false":
+		*f = ""
+	default:
+		*f = traceFlag(value)
+	}
+	return nil
+}
+
+// IsBoolFlag lets --trace be given without a value
+func (f *traceFlag) IsBoolFlag() bool {
+	return true
+}
+
+// cliFlags is the flag set parsed by parseArgs, kept to report which flags were given
+var cliFlags *flag.FlagSet
+
+// newFlagSet declares every command-line flag
+func newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("code-cadence", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() { printUsage(fs) }
+
+	fs.StringVar(&ConfigFile, "config", "", "read settings from this .env file instead of the default locations")
+	fs.BoolVar(&RefreshCache, "refresh", false, "ignore the repository discovery cache and rescan the directory")
+	fs.BoolVar(&FetchFirst, "fetch", false, "fetch every repository before looking for unpushed commits (same as FETCH_BEFORE=true)")
+	fs.BoolVar(&ChangedOnly, "changed-only", false, "only process repositories whose HEAD moved since the last status or cadence run")
+	fs.BoolVar(&FollowSymlinks, "follow-symlinks", false, "descend into symlinked directories while scanning")
+	fs.BoolVar(&OnlyOutsideHours, "only-outside-hours", false, "leave the oldest commits alone while they are already within work hours on allowed days")
+	OnlyRepos, SkipRepos = nil, nil
+	fs.Var(&OnlyRepos, "only", "only process repositories whose directory name matches one of these patterns, e.g. \"service-*\"")
+	fs.Var(&SkipRepos, "skip", "skip repositories whose directory name matches one of these patterns, e.g. \"legacy-*\"")
+	Paths = nil
+	fs.Var(&Paths, "paths", "only reschedule commits touching these paths, e.g. \"src/**\"; the others keep their times")
+	fs.IntVar(&Limit, "limit", 0, "only rewrite the newest N unpushed commits of each repository (0 rewrites all)")
+	fs.BoolVar(&SelectCommits, "select", false, "choose the repositories and commits to rewrite in a terminal UI and review each plan before applying it")
+	fs.BoolVar(&AllowDiverged, "allow-diverged", false, "rewrite branches whose remote branch has commits they don't have")
+	fs.BoolVar(&FailFast, "fail-fast", false, "stop at the first repository that fails or times out (same as ON_REPO_ERROR=stop)")
+	Trace = ""
+	fs.Var(&Trace, "trace", "print every git command with its directory, environment, duration and exit status to stderr, or with --trace=<file> append it to the file")
+	fs.BoolVar(&VerifyMessages, "verify-messages", false, "after a rewrite, compare the message of every rewritten commit with the original byte for byte and show what changed")
+	fs.BoolVar(&Force, "force", false, "rewrite repositories with more unpushed commits than MAX_REWRITE_COMMITS or larger than MAX_REPO_SIZE_MB")
+	fs.BoolVar(&FixIdentity, "fix", false, "with lint_identity, correct the author of the commits it reports, keeping their dates")
+	fs.BoolVar(&RunGC, "gc", false, "with repo_health, run git gc in the repositories it recommends a repack for")
+	fs.BoolVar(&Print0, "print0", false, "with list_repos, end every path with a NUL instead of a newline, for xargs -0")
+	fs.StringVar(&ICSFile, "ics", "", "write the work sessions implied by the commit times to this .ics file (commit_status and cadence commands)")
+	fs.StringVar(&OutputFormat, "format", "", "print each commit of commit_status or repository of list_repos with this Go template, e.g. '{{.Name}} {{.Hash}} {{.Subject}}', and print nothing else")
+	fs.StringVar(&AmendTime, "time", "", "new time of day for amend_last as HH:MM or HH:MM:SS; default picks one within work hours")
+	GroupBy = GroupByRepo
+	fs.Func("group-by", "list the unpushed commits of commit_status by \"repo\" (default) or by \"author\" across all repositories", func(s string) error {
+		if s != GroupByRepo && s != GroupByAuthor {
+			return fmt.Errorf("expected %s or %s", GroupByRepo, GroupByAuthor)
+		}
+		GroupBy = s
+		return nil
+	})
+	ShiftBy = 0
+	fs.Func("by", "offset for the shift command, e.g. 3h, -2d or 1d12h", func(s string) error {
+		d, err := parseDayDuration(s)
+		if err != nil {
+			return err
+		}
+		ShiftBy = d
+		return nil
+	})
+
+	return fs
+}
+
+// dayDurationPattern splits an optional sign and day count from the rest of a duration
+var dayDurationPattern = regexp.MustCompile(`^([+-]?)(?:(\d+)d)?(.*)$`)
+
+// parseDayDuration parses a time.ParseDuration string that may also start with a number of days, e.g. -2d or 1d12h
+func parseDayDuration(s string) (time.Duration, error) {
+	m := dayDurationPattern.FindStringSubmatch(s)
+	if m == nil || (m[2] == "" && m[3] == "") {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var d time.Duration
+	if m[2] != "" {
+		days, err := strconv.Atoi(m[2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	}
+	if m[3] != "" {
+		if m[3][0] == '-' || m[3][0] == '+' {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		rest, err := time.ParseDuration(m[3])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += rest
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseArgs parses flags given anywhere on the command line and returns the remaining positional arguments
+func parseArgs(args []string) ([]string, error) {
+	fs := newFlagSet()
+	cliFlags = fs
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	return positional, nil
+}
+
+// usageSynopses are the ways to call code-cadence, after its name
+var usageSynopses = []string{
+	"[flags] <command> <directory_path>",
+	"[flags] <command> - < repository_list",
+	"[flags] watch <command> <directory_path>",
+	"config <validate|init|show>",
+	"push_global <disable|enable|status>",
+}
+
+// commandHelp describes a command for the usage text and the generated documentation
+type commandHelp struct {
+	// Usage is the command with its own arguments and flags, e.g. "repo_health [--gc]"
+	Usage   string
+	Summary string
+}
+
+// commandHelps lists the commands in the order the usage text shows them; an empty entry separates the commands that
+// work on a directory from the others
+var commandHelps = []commandHelp{
+	{"push_disable", "Disable git push for all repositories"},
+	{"push_enable", "Enable git push for all repositories"},
+	{"push_status", "Show push status for all repositories"},
+	{"push_hook_upgrade", "Rewrite pre-push hooks installed by older versions with the current one"},
+	{"commit_status", "Show unpushed commits for all repositories"},
+	{"summary", "One-screen overview: unpushed work, oldest unpushed commit, push status, dirty trees, backups"},
+	{"repo_health [--gc]", "Run git fsck and count loose objects and packs, --gc repacks where needed"},
+	{"list_repos [--print0]", "Print only the paths of the repositories found, --print0 NUL-terminates them for xargs -0"},
+	{"lint_identity [--fix]", "List unpushed commits whose author isn't the configured identity, --fix corrects them"},
+	{"audit_hours", "List commits made outside work hours, on skipped weekdays or on blackout dates"},
+	{"email_report", "Email a digest of unpushed commits and the last cadence run to REPORT_EMAIL_TO"},
+	{"commit_cadence", "Redistribute unpushed commit times across work day"},
+	{"commit_cadence_span", "Redistribute unpushed commit times across all days since last push (skips configured weekdays)"},
+	{"commit_shift_weekends", "Move only unpushed commits made on skipped weekdays to the nearest workday"},
+	{"shift --by <offset>", "Move all unpushed commit times by a fixed offset, e.g. --by 3h or --by -2d"},
+	{"reorder", "Move only unpushed commits that are out of chronological order, e.g. after an interactive rebase"},
+	{"fix_author", "Give all unpushed commits the configured author, keeping every date and message"},
+	{"amend_last [--time t]", "Amend only the time of HEAD in the given repository, e.g. --time 17:42"},
+	{"verify_backup", "Check that a backup, or every backup in the given directory, can be restored"},
+	{"tui", "Full-screen dashboard: repository status, unpushed commits, push toggle and cadence, one key each"},
+	{},
+	{"watch <command>", "Rerun a command every WATCH_INTERVAL, reloading the configuration when it changes"},
+	{"config validate", "Check the configuration for invalid values and contradictions"},
+	{"config init", "Interactively create a .env configuration file"},
+	{"config show", "Show the effective value of every setting and where it came from"},
+	{"push_global disable", "Install the blocking pre-push hook into git's template directory for new repositories"},
+	{"push_global enable", "Remove it from the template directory again"},
+	{"push_global status", "Show whether new repositories start with push disabled"},
+}
+
+// usageExamples are example command lines
+var usageExamples = []string{
+	"code-cadence commit_status /home/user/workspace/",
+	"code-cadence --config ./clientA.env commit_cadence .",
+	"code-cadence shift /home/user/workspace/ --by -2h",
+	"find ~/src -maxdepth 2 -name .git -print0 | code-cadence commit_status -",
+}
+
+// printUsage prints the command summary followed by the available flags
+func printUsage(fs *flag.FlagSet) {
+	for i, synopsis := range usageSynopses {
+		if i == 0 {
+			fmt.Println("Usage: code-cadence " + synopsis)
+		} else {
+			fmt.Println("       code-cadence " + synopsis)
+		}
+	}
+	fmt.Println("Commands:")
+	for _, command := range commandHelps {
+		if command.Usage == "" {
+			fmt.Println("")
+		} else {
+			fmt.Printf("  %-21s - %s\n", command.Usage, command.Summary)
+		}
+	}
+	fmt.Println("")
+	fmt.Println("Flags:")
+	fs.PrintDefaults()
+	fmt.Println("")
+	for i, example := range usageExamples {
+		if i == 0 {
+			fmt.Println("Example: " + example)
+		} else {
+			fmt.Println("         " + example)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/egor-markin/code-cadence/backup"
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/scan"
+)
+
+// outputFormat is the --format template records are written with; nil prints the usual output
+var outputFormat *template.Template
+
+// commitRecord is what --format is executed with for every unpushed commit commit_status finds
+type commitRecord struct {
+	// Repo is the path of the repository and Name its directory name
+	Repo    string
+	Name    string
+	Hash    string
+	Subject string
+	Author  string
+	Email   string
+	// Date is the author date in the commit's own timezone, e.g. {{.Date.Format "2006-01-02"}}
+	Date  time.Time
+	Merge bool
+}
+
+// repoRecord is what --format is executed with for every repository list_repos finds
+type repoRecord struct {
+	Repo string
+	Name string
+}
+
+// newCommitRecord returns the record of commit in repo
+func newCommitRecord(repo string, commit git.Commit) commitRecord {
+	// A date git printed always parses; should it not, the template sees the zero time
+	date, _ := commit.Time()
+	return commitRecord{
+		Repo:    repo,
+		Name:    filepath.Base(repo),
+		Hash:    commit.Hash,
+		Subject: commit.Subject,
+		Author:  commit.Author,
+		Email:   commit.Email,
+		Date:    date,
+		Merge:   commit.IsMerge,
+	}
+}
+
+// newRepoRecord returns the record of repo
+func newRepoRecord(repo string) repoRecord {
+	return repoRecord{Repo: repo, Name: filepath.Base(repo)}
+}
+
+// formatCommands are the commands --format works with, with an example of the record each is executed with
+var formatCommands = map[string]any{
+	CmdCommitStatus: commitRecord{},
+	CmdListRepos:    repoRecord{},
+}
+
+// parseOutputFormat parses a --format template for command, e.g. `{{.Name}}{{"\t"}}{{.Hash}} {{.Subject}}`. Since
+// a misspelled field only fails when the template is executed, it is tried on an empty record first.
+func parseOutputFormat(text string, command string) (*template.Template, error) {
+	record, ok := formatCommands[command]
+	if !ok {
+		return nil, fmt.Errorf("--format only works with %s and %s", CmdCommitStatus, CmdListRepos)
+	}
+	tmpl, err := template.New("format").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format template: %w", err)
+	}
+	if err := tmpl.Execute(io.Discard, record); err != nil {
+		return nil, fmt.Errorf("invalid --format template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// writeRecord executes outputFormat for record and writes the result followed by terminator in one go
+func writeRecord(w io.Writer, record any, terminator string) error {
+	var b strings.Builder
+	if err := outputFormat.Execute(&b, record); err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+	b.WriteString(terminator)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatCommitStatus is commit_status with --format: it writes a record for every unpushed commit of the
+// repositories under rootDir, or listed on stdin, to w and nothing else. Repositories that can't be checked are
+// reported to stderr, so the records can be piped on their own.
+func (s *settings) formatCommitStatus(ctx context.Context, rootDir string, w io.Writer) error {
+	var repos []string
+	if rootDir == StdinRepoList {
+		var err error
+		if repos, err = readRepoList(os.Stdin); err != nil {
+			return err
+		}
+	} else {
+		opts, err := s.scanOptions()
+		if err != nil {
+			return err
+		}
+		result, _, err := s.discoverRepositories(rootDir, opts)
+		if err != nil {
+			return err
+		}
+		repos = result.Repos
+	}
+	if len(OnlyRepos) > 0 || len(SkipRepos) > 0 {
+		var err error
+		if repos, err = scan.FilterByName(repos, OnlyRepos, SkipRepos); err != nil {
+			return err
+		}
+	}
+
+	for _, repo := range repos {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if backup.IsBackupFolder(repo) {
+			continue
+		}
+		commits, err := git.GetUnpushedCommits(ctx, repo, s.parentBranchWarning(ctx, repo, os.Stderr))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not check commits for %s: %v\n", repo, err)
+			continue
+		}
+		for _, commit := range commits {
+			if err := writeRecord(w, newCommitRecord(repo, commit), "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
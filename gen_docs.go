@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CmdGenDocs writes the man page and the markdown CLI reference for packaging. It is left out of the usage text.
+const CmdGenDocs = "gen-docs"
+
+// Files written by gen-docs
+const (
+	manPageFile      = "code-cadence.1"
+	cliReferenceFile = "code-cadence.md"
+)
+
+// runGenDocs runs gen-docs <directory>, generating the documentation from the synopses, commands, flags and examples
+// of the usage text so they can't drift apart, and returns the exit code
+func runGenDocs(fs *flag.FlagSet, args []string) int {
+	if len(args) != 1 {
+		fmt.Printf("Usage: code-cadence %s <directory>\n", CmdGenDocs)
+		return 1
+	}
+	dir := args[0]
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	for name, content := range map[string]string{manPageFile: manPage(fs), cliReferenceFile: cliReference(fs)} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+	return 0
+}
+
+// docFlag is a command-line flag as the documentation shows it
+type docFlag struct {
+	// Name is the flag with its argument, e.g. "--limit <int>"
+	Name  string
+	Usage string
+}
+
+// docFlags returns the flags of fs in alphabetical order
+func docFlags(fs *flag.FlagSet) []docFlag {
+	var flags []docFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		arg, usage := flag.UnquoteUsage(f)
+		name := "--" + f.Name
+		if arg != "" {
+			name += " <" + arg + ">"
+		}
+		flags = append(flags, docFlag{Name: name, Usage: usage})
+	})
+	return flags
+}
+
+// manPage returns the man page in roff. It has no date, so a rebuild of the same version produces the same file.
+func manPage(fs *flag.FlagSet) string {
+	var b strings.Builder
+	b.WriteString(".TH CODE-CADENCE 1 \"\" \"code-cadence\" \"User Commands\"\n")
+	b.WriteString(".SH NAME\n")
+	b.WriteString("code\\-cadence \\- redistribute the times of unpushed git commits across work hours\n")
+
+	b.WriteString(".SH SYNOPSIS\n.nf\n")
+	for _, synopsis := range usageSynopses {
+		fmt.Fprintf(&b, "\\fBcode\\-cadence\\fR %s\n", roffEscape(synopsis))
+	}
+	b.WriteString(".fi\n")
+
+	b.WriteString(".SH DESCRIPTION\n")
+	b.WriteString("Code Cadence redistributes the times of the unpushed commits of every git repository below a directory " +
+		"across the configured work hours, and manages a pre-push hook that keeps them from being pushed before that. " +
+		"Settings are read from a .env file; \\fBcode\\-cadence config show\\fR lists them with their effective values.\n")
+
+	b.WriteString(".SH COMMANDS\n")
+	for _, command := range commandHelps {
+		if command.Usage == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ".TP\n\\fB%s\\fR\n%s\n", roffEscape(command.Usage), roffEscape(command.Summary))
+	}
+
+	b.WriteString(".SH OPTIONS\n")
+	for _, f := range docFlags(fs) {
+		fmt.Fprintf(&b, ".TP\n\\fB%s\\fR\n%s\n", roffEscape(f.Name), roffEscape(f.Usage))
+	}
+
+	b.WriteString(".SH EXAMPLES\n.nf\n")
+	for _, example := range usageExamples {
+		fmt.Fprintf(&b, "%s\n", roffEscape(example))
+	}
+	b.WriteString(".fi\n")
+
+	b.WriteString(".SH SEE ALSO\n.BR git (1)\n")
+	return b.String()
+}
+
+// roffEscape escapes text for a roff line: backslashes and hyphens, which roff would otherwise turn into dashes that
+// can't be copied into a terminal, and a leading dot or quote, which would start a request
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// cliReference returns the CLI reference in markdown
+func cliReference(fs *flag.FlagSet) string {
+	var b strings.Builder
+	b.WriteString("# code-cadence CLI reference\n\n")
+	fmt.Fprintf(&b, "<!-- Generated by code-cadence %s, do not edit -->\n\n", CmdGenDocs)
+
+	b.WriteString("## Usage\n\n```\n")
+	for _, synopsis := range usageSynopses {
+		fmt.Fprintf(&b, "code-cadence %s\n", synopsis)
+	}
+	b.WriteString("```\n\n")
+
+	b.WriteString("## Commands\n\n| Command | Description |\n|---------|-------------|\n")
+	for _, command := range commandHelps {
+		if command.Usage == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "| `%s` | %s |\n", markdownCell(command.Usage), markdownCell(command.Summary))
+	}
+
+	b.WriteString("\n## Flags\n\n| Flag | Description |\n|------|-------------|\n")
+	for _, f := range docFlags(fs) {
+		fmt.Fprintf(&b, "| `%s` | %s |\n", markdownCell(f.Name), markdownCell(f.Usage))
+	}
+
+	b.WriteString("\n## Examples\n\n```bash\n")
+	for _, example := range usageExamples {
+		fmt.Fprintf(&b, "%s\n", example)
+	}
+	b.WriteString("```\n")
+	return b.String()
+}
+
+// markdownCell escapes the pipes that would end a table cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenDocs(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+	dir := filepath.Join(helper.TempDir, "docs")
+
+	var code int
+	helper.CaptureOutput(func() { code = runGenDocs(newFlagSet(), []string{dir}) })
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	manPage, err := os.ReadFile(filepath.Join(dir, manPageFile))
+	if err != nil {
+		t.Fatalf("Failed to read the man page: %v", err)
+	}
+	reference, err := os.ReadFile(filepath.Join(dir, cliReferenceFile))
+	if err != nil {
+		t.Fatalf("Failed to read the CLI reference: %v", err)
+	}
+
+	for _, command := range commandHelps {
+		if command.Usage == "" {
+			continue
+		}
+		if !strings.Contains(string(manPage), roffEscape(command.Usage)) {
+			t.Errorf("Expected %q in the man page", command.Usage)
+		}
+		if !strings.Contains(string(reference), "`"+command.Usage+"`") {
+			t.Errorf("Expected %q in the CLI reference", command.Usage)
+		}
+	}
+	for _, flag := range []string{"--limit <int>", "--print0", "--group-by <value>"} {
+		if !strings.Contains(string(manPage), roffEscape(flag)) || !strings.Contains(string(reference), "`"+flag+"`") {
+			t.Errorf("Expected the %s flag in both documents", flag)
+		}
+	}
+	if strings.Contains(string(reference), "| `gen-docs") {
+		t.Error("Expected gen-docs to stay hidden")
+	}
+
+	helper.CaptureOutput(func() { code = runGenDocs(newFlagSet(), nil) })
+	if code != 1 {
+		t.Errorf("Expected exit code 1 without a directory, got %d", code)
+	}
+}
+
+func TestRoffEscape(t *testing.T) {
+	tests := map[string]string{
+		"shift --by <offset>": `shift \-\-by <offset>`,
+		`C:\Users`:            `C:\eUsers`,
+		".env files":          `\&.env files`,
+		"'quoted'":            `\&'quoted'`,
+		"plain text, a.b":     "plain text, a.b",
+	}
+	for input, expected := range tests {
+		if got := roffEscape(input); got != expected {
+			t.Errorf("roffEscape(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package git
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Latin1 is the name git uses for the encoding most commits that aren't UTF-8 are written in
+const Latin1 = "ISO-8859-1"
+
+// utf8Output makes git log convert messages and identities to UTF-8 whatever encoding a commit is stored in, so
+// repositories with i18n.logOutputEncoding or i18n.commitEncoding set are read the same way as others
+const utf8Output = "--encoding=UTF-8"
+
+// detectEncoding returns the encoding the text of a commit is stored in: header, its encoding header, or Latin1 when
+// it has none and texts, read from it as they are stored, aren't valid UTF-8. An empty result means UTF-8.
+func detectEncoding(header string, texts ...string) string {
+	if header != "" {
+		return header
+	}
+	for _, text := range texts {
+		if !utf8.ValidString(text) {
+			return Latin1
+		}
+	}
+	return ""
+}
+
+// isLatin1 reports whether encoding is one of the names of ISO-8859-1
+func isLatin1(encoding string) bool {
+	switch strings.ToUpper(encoding) {
+	case "ISO-8859-1", "ISO8859-1", "ISO_8859-1", "LATIN1", "LATIN-1", "L1", "CP819":
+		return true
+	}
+	return false
+}
+
+// decodeText converts s, text of a commit stored in encoding, to UTF-8. Only Latin-1 is converted; text that is
+// already valid UTF-8 is returned as it is.
+func decodeText(s string, encoding string) string {
+	if !isLatin1(encoding) || utf8.ValidString(s) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		b.WriteRune(rune(s[i]))
+	}
+	return b.String()
+}
+
+// encodeText converts s from UTF-8 to encoding so it can be written into a commit stored in that encoding. Only
+// Latin-1 is converted, with characters it can't represent replaced by '?'; s is returned as it is otherwise.
+func encodeText(s string, encoding string) string {
+	if !isLatin1(encoding) || !utf8.ValidString(s) {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
+
+// encodingConfig makes git write a commit with the encoding header header, or none when it is empty. Without it
+// git would use i18n.commitEncoding, so a recreated commit could gain, lose or change the header of the original.
+func encodingConfig(header string) []string {
+	if header == "" {
+		header = "UTF-8"
+	}
+	return []string{"-c", "i18n.commitEncoding=" + header}
+}
+
+// encodeIdentity converts identity from UTF-8 to encoding like encodeText
+func encodeIdentity(identity Identity, encoding string) Identity {
+	return Identity{Name: encodeText(identity.Name, encoding), Email: encodeText(identity.Email, encoding)}
+}
@@ -1,15 +1,27 @@
 package git
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// emptyTreeHash is the SHA-1 hash of the empty tree object in Git
-const emptyTreeHash = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+// EmptyTreeHash is the SHA-1 hash of the empty tree object in Git, which a root commit is compared with
+const EmptyTreeHash = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// EmptyTreeHashSHA256 is the hash of the empty tree object in repositories using SHA-256 object names
+const EmptyTreeHashSHA256 = "6ef19b41225c5369f1c104d45d8d85efa9b057b53b14b4b9b939dd74decc5321"
+
+// rollbackTimeout bounds the cleanup commands run after a failed or cancelled rewrite
+const rollbackTimeout = 30 * time.Second
 
 // GitError represents a git command error with captured output
 type GitError struct {
@@ -23,31 +35,122 @@ func (e *GitError) Error() string {
 	return fmt.Sprintf("git command '%s' failed: %v\nstdout: %s\nstderr: %s", e.Command, e.Err, e.Stdout, e.Stderr)
 }
 
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// DateTimeLayout is the layout of Commit.DateTime as produced by git's iso date format
+const DateTimeLayout = "2006-01-02 15:04:05 -0700"
+
 // Commit represents a git commit with detailed information
 type Commit struct {
-	Hash      string
-	Subject   string
-	Author    string
-	Email     string
-	DateTime  string
-	IsMerge   bool
-	MergeFrom string // For merge commits, this contains the hash of the merged commit
+	Hash     string
+	Subject  string
+	Author   string
+	Email    string
+	DateTime string
+	// CommitterDateTime is the committer date in the same format as DateTime; empty when it wasn't read
+	CommitterDateTime string
+	IsMerge           bool
+	MergeFrom         string // For merge commits, this contains the hash of the merged commit
+	// Parents are the full hashes of the commit's parents, first parent first
+	Parents []string
+	// Encoding is the encoding the commit's message and identities are stored in, empty for UTF-8. Subject, Author
+	// and Email are always UTF-8.
+	Encoding string
+}
+
+// Identity is the name and email recorded as a commit's author or committer
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// String formats the identity as "Name <email>"
+func (i Identity) String() string {
+	return fmt.Sprintf("%s <%s>", i.Name, i.Email)
+}
+
+// ReplayOptions controls the identity recorded on commits recreated by UpdateCommitTimes
+type ReplayOptions struct {
+	// Identity replaces the author and committer of every replayed commit. Empty fields fall back to
+	// the identity git is configured with.
+	Identity Identity
+	// Author, when set, can give a replayed commit a different author than Identity by returning true
+	Author func(Commit) (Identity, bool)
+	// PreserveAuthor keeps each commit's original author name, email and date, so only the committer
+	// identity and date are replaced. Author is ignored.
+	PreserveAuthor bool
+	// Trailers are added to every replayed commit's message, e.g. "Co-authored-by: Name <email>".
+	// A trailer the message already contains is not added again.
+	Trailers []string
+	// OriginalDates adds OriginalDateTrailer and OriginalCommitterDateTrailer trailers with the commit's original
+	// author and committer dates. A commit that has them from an earlier rewrite keeps them, so they always record
+	// the dates the commit was first made with.
+	OriginalDates bool
+	// SignOff adds a Signed-off-by trailer for the identity recorded as the commit's author, or its committer when
+	// PreserveAuthor keeps the original author. Sign-offs already in the message are kept, also when Message rewrites it.
+	SignOff bool
+	// Message, when set, returns the new message of a replayed commit given its current one
+	Message func(commit Commit, message string) (string, error)
+	// RunHooks replays the commits in a temporary worktree with checkout, cherry-pick and commit --amend so the
+	// repository's hooks (pre-commit, commit-msg, post-checkout...) run. By default commits are recreated with
+	// commit-tree, which runs no hooks, since hooks that format files or check messages can change or reject commits
+	// that were already accepted when they were first made.
+	RunHooks bool
+	// DropEmpty drops commits that are empty or become empty when replayed instead of keeping them
+	DropEmpty bool
+	// KeepDates recreates every commit with its original author and committer dates and ignores the new times, so
+	// only the identity changes
+	KeepDates bool
+	// KeepCommitterDate keeps each commit's original committer date, so only the author date is replaced with the
+	// new time
+	KeepCommitterDate bool
+	// OnReplay, when set, is called with the outcome of every commit replayed
+	OnReplay func(commit Commit, result ReplayResult)
+}
+
+// ReplayStatus is what happened to a replayed commit
+type ReplayStatus int
+
+const (
+	// ReplayRewritten means the commit was recreated with its new time
+	ReplayRewritten ReplayStatus = iota
+	// ReplayKeptEmpty means the commit was recreated although it has no changes
+	ReplayKeptEmpty
+	// ReplayDropped means the commit had no changes left and was left out of the rewritten history
+	ReplayDropped
+)
+
+// ReplayResult is the outcome of replaying a single commit
+type ReplayResult struct {
+	Status ReplayStatus
+	// NewHash is the full hash of the recreated commit; empty when the commit was dropped
+	NewHash string
+}
+
+// report passes the outcome of a replayed commit to OnReplay
+func (o ReplayOptions) report(commit Commit, result ReplayResult) {
+	if o.OnReplay != nil {
+		o.OnReplay(commit, result)
+	}
+}
+
+// Time parses the commit's author date, keeping its original timezone offset
+func (c Commit) Time() (time.Time, error) {
+	return time.Parse(DateTimeLayout, c.DateTime)
 }
 
 // CheckGitAvailability verifies that git command is available and working
-func CheckGitAvailability() error {
+func CheckGitAvailability(ctx context.Context) error {
 	// Check if git command exists
-	cmd := exec.Command("git", "--version")
-	var stdout, stderr strings.Builder
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("git command not found or not working: %v\nstdout: %s\nstderr: %s", err, stdout.String(), stderr.String())
+	output, err := runGitCommand(ctx, "", "--version")
+	if err != nil {
+		return fmt.Errorf("git command not found or not working: %w", err)
 	}
 
 	// Verify git version output looks reasonable
-	versionOutput := strings.TrimSpace(stdout.String())
+	versionOutput := strings.TrimSpace(output)
 	if !strings.HasPrefix(versionOutput, "git version") {
 		return fmt.Errorf("unexpected git version output: %s", versionOutput)
 	}
@@ -56,68 +159,80 @@ func CheckGitAvailability() error {
 }
 
 // runGitCommand executes a git command in a specific directory
-func runGitCommand(dir string, args ...string) (string, error) {
+func runGitCommand(ctx context.Context, dir string, args ...string) (string, error) {
+	return runGitCommandWithEnv(ctx, dir, nil, args...)
+}
+
+// runGitCommandWithEnv executes a git command in a specific directory with additional environment variables
+func runGitCommandWithEnv(ctx context.Context, dir string, env []string, args ...string) (string, error) {
 	if len(args) == 0 {
 		return "", fmt.Errorf("no git command arguments provided")
 	}
 
-	cmd := exec.Command("git", args...)
-	cmd.Dir = dir
-
-	var stdout, stderr strings.Builder
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
+	return RunnerFromContext(ctx).Run(ctx, dir, env, args...)
+}
 
-	if err != nil {
-		return "", &GitError{
-			Command: fmt.Sprintf("git %s (in %s)", strings.Join(args, " "), dir),
-			Err:     err,
-			Stdout:  stdout.String(),
-			Stderr:  stderr.String(),
-		}
-	}
+// Separators of the commit log format. Commit subjects and author names can contain any printable
+// character, so fields are delimited by NUL and each record is terminated by \x01.
+const (
+	fieldSeparator   = "\x00"
+	recordTerminator = "\x01"
+)
 
-	return stdout.String(), nil
+// commitLogFormat returns the --pretty argument producing the fields parsed by parseCommitsWithMergeInfo,
+// with hashPlaceholder (%h or %H) as the hash
+func commitLogFormat(hashPlaceholder string) string {
+	return "--pretty=format:" + hashPlaceholder + "%x00%s%x00%an%x00%ae%x00%ad%x00%P%x00%cd%x00%e%x01"
 }
 
-// parseCommitsWithMergeInfo parses git log output with merge information and returns a slice of Commit structs
+// parseCommitsWithMergeInfo parses git log output in commitLogFormat and returns a slice of Commit structs.
+// Malformed records are skipped.
 func parseCommitsWithMergeInfo(output string) []Commit {
-	if len(output) == 0 {
-		return []Commit{}
-	}
-
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	if len(lines) == 1 && lines[0] == "" {
-		return []Commit{}
-	}
-
-	commits := make([]Commit, 0, len(lines))
-	for _, line := range lines {
-		// Parse commit format: hash|subject|author|email|datetime|parents
-		parts := strings.Split(line, "|")
-		if len(parts) >= 6 {
-			parents := parts[5]
-			parentHashes := strings.Fields(parents)
-
-			commit := Commit{
-				Hash:      parts[0],
-				Subject:   parts[1],
-				Author:    parts[2],
-				Email:     parts[3],
-				DateTime:  parts[4],
-				IsMerge:   len(parentHashes) > 1,
-				MergeFrom: "",
-			}
-
-			// For merge commits, the second parent is typically the merged branch
-			if commit.IsMerge && len(parentHashes) >= 2 {
-				commit.MergeFrom = parentHashes[1]
-			}
+	commits := []Commit{}
+	for _, record := range strings.Split(output, recordTerminator) {
+		// git log puts a newline between records
+		record = strings.TrimPrefix(record, "\n")
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
 
-			commits = append(commits, commit)
+		// Fields: hash, subject, author, email, datetime, parents and, when present, the committer date and the
+		// encoding header
+		parts := strings.Split(record, fieldSeparator)
+		if len(parts) < 6 || len(parts) > 8 {
+			continue
+		}
+		parentHashes := strings.Fields(parts[5])
+
+		commit := Commit{
+			Hash:      parts[0],
+			Subject:   parts[1],
+			Author:    parts[2],
+			Email:     parts[3],
+			DateTime:  parts[4],
+			IsMerge:   len(parentHashes) > 1,
+			MergeFrom: "",
+			Parents:   parentHashes,
+		}
+		if len(parts) >= 7 {
+			commit.CommitterDateTime = parts[6]
+		}
+		var header string
+		if len(parts) == 8 {
+			header = parts[7]
+		}
+		// Text with an encoding header has been converted to UTF-8 by git, text without one is as it is stored
+		commit.Encoding = detectEncoding(header, commit.Subject, commit.Author, commit.Email)
+		commit.Subject = decodeText(commit.Subject, commit.Encoding)
+		commit.Author = decodeText(commit.Author, commit.Encoding)
+		commit.Email = decodeText(commit.Email, commit.Encoding)
+
+		// For merge commits, the second parent is typically the merged branch
+		if commit.IsMerge && len(parentHashes) >= 2 {
+			commit.MergeFrom = parentHashes[1]
 		}
+
+		commits = append(commits, commit)
 	}
 
 	return commits
@@ -125,15 +240,15 @@ func parseCommitsWithMergeInfo(output string) []Commit {
 
 // getCommitsFirstParentWithMerges executes git log constrained to the branch's first-parent history,
 // including merge commits. This returns commits made on the current branch including merge commits.
-func getCommitsFirstParentWithMerges(repoPath string, commitRange string) ([]Commit, error) {
+func getCommitsFirstParentWithMerges(ctx context.Context, repoPath string, commitRange string) ([]Commit, error) {
 	var args []string
 	if commitRange == "" {
-		args = []string{"log", "--first-parent", "--pretty=format:%h|%s|%an|%ae|%ad|%P", "--date=iso"}
+		args = []string{"log", "--first-parent", utf8Output, commitLogFormat("%h"), "--date=iso"}
 	} else {
-		args = []string{"log", "--first-parent", "--pretty=format:%h|%s|%an|%ae|%ad|%P", "--date=iso", commitRange}
+		args = []string{"log", "--first-parent", utf8Output, commitLogFormat("%h"), "--date=iso", commitRange}
 	}
 
-	output, err := runGitCommand(repoPath, args...)
+	output, err := runGitCommand(ctx, repoPath, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -142,10 +257,25 @@ func getCommitsFirstParentWithMerges(repoPath string, commitRange string) ([]Com
 	return parseCommitsWithMergeInfo(output), nil
 }
 
+// GetAuthorCommits returns every commit reachable from HEAD, pushed or not, newest first. When email is set, only
+// the commits whose author has that email are returned.
+func GetAuthorCommits(ctx context.Context, repoPath string, email string) ([]Commit, error) {
+	args := []string{"log", utf8Output, commitLogFormat("%h"), "--date=iso"}
+	if email != "" {
+		// Matching the brackets too keeps other addresses ending in the same text out
+		args = append(args, "--fixed-strings", "--author=<"+email+">")
+	}
+	output, err := runGitCommand(ctx, repoPath, append(args, "HEAD")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits: %w", err)
+	}
+	return parseCommitsWithMergeInfo(output), nil
+}
+
 // GetUnpushedCommits finds unpushed commits in a repository
-func GetUnpushedCommits(repoPath string, parentGitBranchName string) ([]Commit, error) {
+func GetUnpushedCommits(ctx context.Context, repoPath string, parentGitBranchName string) ([]Commit, error) {
 	// Get the current branch
-	branchOutput, err := runGitCommand(repoPath, "branch", "--show-current")
+	branchOutput, err := runGitCommand(ctx, repoPath, "branch", "--show-current")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current branch: %w", err)
 	}
@@ -157,21 +287,21 @@ func GetUnpushedCommits(repoPath string, parentGitBranchName string) ([]Commit,
 	}
 
 	// First check if there are any commits at all
-	if _, err := runGitCommand(repoPath, "rev-parse", "HEAD"); err != nil {
+	if _, err := runGitCommand(ctx, repoPath, "rev-parse", "HEAD"); err != nil {
 		// No commits in the repository
 		return []Commit{}, nil
 	}
 
 	// Check if the current branch has an upstream tracking branch
-	upstreamOutput, err := runGitCommand(repoPath, "rev-parse", "--abbrev-ref", fmt.Sprintf("%s@{upstream}", currentBranch))
+	upstreamOutput, err := runGitCommand(ctx, repoPath, "rev-parse", "--abbrev-ref", fmt.Sprintf("%s@{upstream}", currentBranch))
 
 	if err != nil {
 		// No upstream branch configured, check if there are any remotes
-		remotesOutput, remotesErr := runGitCommand(repoPath, "remote")
+		remotesOutput, remotesErr := runGitCommand(ctx, repoPath, "remote")
 
 		if remotesErr != nil || strings.TrimSpace(remotesOutput) == "" {
 			// No remotes configured; return commits made on this branch's first-parent history including merges
-			commits, err := getCommitsFirstParentWithMerges(repoPath, "")
+			commits, err := getCommitsFirstParentWithMerges(ctx, repoPath, "")
 			if err != nil {
 				return []Commit{}, nil
 			}
@@ -181,9 +311,9 @@ func GetUnpushedCommits(repoPath string, parentGitBranchName string) ([]Commit,
 		// There are remotes but no upstream branch, try different strategies to find unpushed commits
 
 		// Strategy 1: Check against origin/<branch> if it exists
-		if _, originErr := runGitCommand(repoPath, "rev-parse", "--verify", fmt.Sprintf("origin/%s", currentBranch)); originErr == nil {
+		if _, originErr := runGitCommand(ctx, repoPath, "rev-parse", "--verify", fmt.Sprintf("origin/%s", currentBranch)); originErr == nil {
 			// origin/<branch> exists, compare against it, including merge commits
-			commits, err := getCommitsFirstParentWithMerges(repoPath, fmt.Sprintf("origin/%s..%s", currentBranch, currentBranch))
+			commits, err := getCommitsFirstParentWithMerges(ctx, repoPath, fmt.Sprintf("origin/%s..%s", currentBranch, currentBranch))
 			if err != nil {
 				return nil, fmt.Errorf("failed to get unpushed commits: %w", err)
 			}
@@ -193,9 +323,9 @@ func GetUnpushedCommits(repoPath string, parentGitBranchName string) ([]Commit,
 		// Strategy 2: Check against any remote branches that match current branch name
 		remotesList := strings.Fields(strings.TrimSpace(remotesOutput))
 		for _, remote := range remotesList {
-			if _, remoteBranchErr := runGitCommand(repoPath, "rev-parse", "--verify", fmt.Sprintf("%s/%s", remote, currentBranch)); remoteBranchErr == nil {
+			if _, remoteBranchErr := runGitCommand(ctx, repoPath, "rev-parse", "--verify", fmt.Sprintf("%s/%s", remote, currentBranch)); remoteBranchErr == nil {
 				// Found matching remote branch, compare against it including merge commits
-				commits, err := getCommitsFirstParentWithMerges(repoPath, fmt.Sprintf("%s/%s..%s", remote, currentBranch, currentBranch))
+				commits, err := getCommitsFirstParentWithMerges(ctx, repoPath, fmt.Sprintf("%s/%s..%s", remote, currentBranch, currentBranch))
 				if err != nil {
 					return nil, fmt.Errorf("failed to get unpushed commits: %w", err)
 				}
@@ -204,13 +334,14 @@ func GetUnpushedCommits(repoPath string, parentGitBranchName string) ([]Commit,
 		}
 
 		// Strategy 3: Find the actual parent/base branch dynamically
-		commits, err := getCommitsFirstParentWithMerges(repoPath, fmt.Sprintf("%s..%s", parentGitBranchName, currentBranch))
+		parentGitBranchName = resolveParentBranch(ctx, repoPath, parentGitBranchName, remotesOutput)
+		commits, err := getCommitsFirstParentWithMerges(ctx, repoPath, fmt.Sprintf("%s..%s", parentGitBranchName, currentBranch))
 		if err == nil {
 			return commits, nil
 		}
 
 		// Strategy 4: If all else fails, assume all commits are unpushed (fallback)
-		commits, err = getCommitsFirstParentWithMerges(repoPath, "")
+		commits, err = getCommitsFirstParentWithMerges(ctx, repoPath, "")
 		if err != nil {
 			return []Commit{}, nil
 		}
@@ -219,7 +350,7 @@ func GetUnpushedCommits(repoPath string, parentGitBranchName string) ([]Commit,
 
 	// Upstream branch exists, compare against it
 	upstream := strings.TrimSpace(upstreamOutput)
-	commits, err := getCommitsFirstParentWithMerges(repoPath, fmt.Sprintf("%s..%s", upstream, currentBranch))
+	commits, err := getCommitsFirstParentWithMerges(ctx, repoPath, fmt.Sprintf("%s..%s", upstream, currentBranch))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get unpushed commits: %w", err)
 	}
@@ -227,10 +358,240 @@ func GetUnpushedCommits(repoPath string, parentGitBranchName string) ([]Commit,
 	return commits, nil
 }
 
+// AutoParentBranch is the parent branch name that asks for the remote's default branch to be detected
+const AutoParentBranch = "auto"
+
+// fallbackParentBranch is used when the parent branch is auto-detected but no remote records its default branch
+const fallbackParentBranch = "origin/main"
+
+// resolveParentBranch returns parentGitBranchName, or for AutoParentBranch the default branch of origin, or else
+// of the first of remotes (as listed by git remote) that records one
+func resolveParentBranch(ctx context.Context, repoPath string, parentGitBranchName string, remotes string) string {
+	if parentGitBranchName != AutoParentBranch {
+		return parentGitBranchName
+	}
+
+	candidates := strings.Fields(remotes)
+	if i := slices.Index(candidates, "origin"); i > 0 {
+		candidates = slices.Concat([]string{"origin"}, slices.Delete(candidates, i, i+1))
+	}
+	for _, remote := range candidates {
+		if branch, err := GetRemoteDefaultBranch(ctx, repoPath, remote); err == nil && branch != "" {
+			return branch
+		}
+	}
+	return fallbackParentBranch
+}
+
+// GetRemoteDefaultBranch returns the remote's default branch, e.g. origin/main, as recorded in refs/remotes/<remote>/HEAD
+// by git clone or git remote set-head. It returns "" when the remote has no HEAD recorded.
+func GetRemoteDefaultBranch(ctx context.Context, repoPath string, remote string) (string, error) {
+	output, err := runGitCommand(ctx, repoPath, "symbolic-ref", "--quiet", "--short", "refs/remotes/"+remote+"/HEAD")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read default branch of %s: %w", remote, err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// GetUpstreamOnlyCommits counts the commits on the remote branch the current branch pushes to that the local branch
+// doesn't have, i.e. how far it has diverged. The remote branch is the upstream, or else origin/<branch>; ref is
+// empty when neither exists.
+func GetUpstreamOnlyCommits(ctx context.Context, repoPath string) (ref string, count int, err error) {
+	branchOutput, err := runGitCommand(ctx, repoPath, "branch", "--show-current")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get current branch: %w", err)
+	}
+	currentBranch := strings.TrimSpace(branchOutput)
+	if currentBranch == "" {
+		return "", 0, nil
+	}
+
+	if upstream, err := runGitCommand(ctx, repoPath, "rev-parse", "--abbrev-ref", currentBranch+"@{upstream}"); err == nil {
+		ref = strings.TrimSpace(upstream)
+	} else if _, err := runGitCommand(ctx, repoPath, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+currentBranch); err == nil {
+		ref = "origin/" + currentBranch
+	} else {
+		return "", 0, nil
+	}
+
+	output, err := runGitCommand(ctx, repoPath, "rev-list", "--count", "HEAD.."+ref)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to compare with %s: %w", ref, err)
+	}
+	count, err = strconv.Atoi(strings.TrimSpace(output))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to compare with %s: %w", ref, err)
+	}
+	return ref, count, nil
+}
+
+// TrackingStatus describes the current branch relative to its upstream
+type TrackingStatus struct {
+	// Branch is the current branch, empty when HEAD is detached
+	Branch string
+	// Upstream is the branch's upstream, e.g. origin/main, empty when it has none
+	Upstream string
+	// Ahead and Behind count the commits only on the branch and only on its upstream
+	Ahead  int
+	Behind int
+}
+
+// GetTrackingStatus returns the upstream of the current branch and how far the branch is ahead of and behind it
+func GetTrackingStatus(ctx context.Context, repoPath string) (TrackingStatus, error) {
+	var status TrackingStatus
+	branchOutput, err := runGitCommand(ctx, repoPath, "branch", "--show-current")
+	if err != nil {
+		return status, fmt.Errorf("failed to get current branch: %w", err)
+	}
+	status.Branch = strings.TrimSpace(branchOutput)
+	if status.Branch == "" {
+		return status, nil
+	}
+
+	upstream, err := runGitCommand(ctx, repoPath, "rev-parse", "--abbrev-ref", status.Branch+"@{upstream}")
+	if err != nil {
+		// No upstream configured, or it points at a remote branch that is gone
+		return status, nil
+	}
+	status.Upstream = strings.TrimSpace(upstream)
+
+	output, err := runGitCommand(ctx, repoPath, "rev-list", "--left-right", "--count", "HEAD..."+status.Upstream)
+	if err != nil {
+		return status, fmt.Errorf("failed to compare with %s: %w", status.Upstream, err)
+	}
+	if _, err := fmt.Sscan(output, &status.Ahead, &status.Behind); err != nil {
+		return status, fmt.Errorf("failed to compare with %s: %w", status.Upstream, err)
+	}
+	return status, nil
+}
+
+// WorkingTreeStatus counts the changes of a repository that aren't committed yet
+type WorkingTreeStatus struct {
+	// Staged counts files with changes in the index
+	Staged int
+	// Modified counts tracked files with changes that aren't staged
+	Modified int
+	// Untracked counts files git doesn't track and doesn't ignore
+	Untracked int
+	// Stashes counts the entries of the stash
+	Stashes int
+}
+
+// Dirty reports whether the working tree or the index have changes
+func (s WorkingTreeStatus) Dirty() bool {
+	return s.Staged > 0 || s.Modified > 0 || s.Untracked > 0
+}
+
+// GetWorkingTreeStatus counts the staged, modified and untracked files of a repository and its stash entries. A file
+// with both staged and unstaged changes counts as both.
+func GetWorkingTreeStatus(ctx context.Context, repoPath string) (WorkingTreeStatus, error) {
+	var status WorkingTreeStatus
+	output, err := runGitCommand(ctx, repoPath, "status", "--porcelain", "-z")
+	if err != nil {
+		return status, fmt.Errorf("failed to get working tree status: %w", err)
+	}
+	entries := strings.Split(output, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 3 {
+			continue
+		}
+		index, worktree := entry[0], entry[1]
+		switch {
+		case index == '?':
+			status.Untracked++
+			continue
+		case index == '!':
+			continue
+		}
+		if index != ' ' {
+			status.Staged++
+		}
+		if worktree != ' ' {
+			status.Modified++
+		}
+		// Renames and copies are followed by the path they came from
+		if index == 'R' || index == 'C' {
+			i++
+		}
+	}
+
+	// rev-list fails when there is no stash at all
+	if _, err := runGitCommand(ctx, repoPath, "rev-parse", "--verify", "--quiet", "refs/stash"); err != nil {
+		return status, nil
+	}
+	stashes, err := runGitCommand(ctx, repoPath, "rev-list", "--walk-reflogs", "--count", "refs/stash")
+	if err != nil {
+		return status, fmt.Errorf("failed to count stash entries: %w", err)
+	}
+	if status.Stashes, err = strconv.Atoi(strings.TrimSpace(stashes)); err != nil {
+		return status, fmt.Errorf("failed to count stash entries: %w", err)
+	}
+	return status, nil
+}
+
+// GetSideBranchCommits returns the commits a merge brought in through its second parent that are neither
+// reachable from its first parent nor from any remote-tracking ref, newest first in topological order
+func GetSideBranchCommits(ctx context.Context, repoPath string, merge Commit) ([]Commit, error) {
+	if !merge.IsMerge || len(merge.Parents) < 2 {
+		return nil, nil
+	}
+
+	output, err := runGitCommand(ctx, repoPath, "log", "--topo-order", utf8Output, commitLogFormat("%h"), "--date=iso",
+		merge.Parents[1], "--not", merge.Parents[0], "--remotes")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits merged by %s: %w", merge.Hash, err)
+	}
+	return parseCommitsWithMergeInfo(output), nil
+}
+
+// argBatchSize is how many commits or objects are passed to a single git command, keeping the command line short
+// enough for Windows
+const argBatchSize = 500
+
+// GetCommitsTouchingPaths returns which of the given commits change a file matching one of the pathspecs, such as
+// "src/**", relative to the repository root. A merge commit counts only if it differs from each of its parents
+// there, and a root commit if it adds such a file.
+func GetCommitsTouchingPaths(ctx context.Context, repoPath string, hashes []string, pathspecs []string) (map[string]bool, error) {
+	touching := make(map[string]bool)
+	for start := 0; start < len(hashes); start += argBatchSize {
+		batch := hashes[start:min(start+argBatchSize, len(hashes))]
+		args := append([]string{"log", "--no-walk=unsorted", "--format=%h"}, batch...)
+		output, err := runGitCommand(ctx, repoPath, append(append(args, "--"), pathspecs...)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list commits touching %s: %w", strings.Join(pathspecs, ", "), err)
+		}
+		for _, hash := range strings.Fields(output) {
+			touching[hash] = true
+		}
+	}
+	return touching, nil
+}
+
+// GetEmptyTree returns the hash of the empty tree in the object format of the repository, SHA-1 or SHA-256
+func GetEmptyTree(ctx context.Context, repoPath string) (string, error) {
+	output, err := runGitCommand(ctx, repoPath, "rev-parse", "--show-object-format")
+	if err != nil {
+		return "", fmt.Errorf("failed to get object format: %w", err)
+	}
+	switch format := strings.TrimSpace(output); format {
+	case "sha1":
+		return EmptyTreeHash, nil
+	case "sha256":
+		return EmptyTreeHashSHA256, nil
+	default:
+		return "", fmt.Errorf("unsupported object format %q", format)
+	}
+}
+
 // GetParentCommit finds the parent commit of the first unpushed commit
-func GetParentCommit(repoPath string, firstUnpushedCommitHash string) (string, error) {
+func GetParentCommit(ctx context.Context, repoPath string, firstUnpushedCommitHash string) (string, error) {
 	// Get parent commit hash using git rev-parse
-	parentOutput, err := runGitCommand(repoPath, "rev-parse", fmt.Sprintf("%s^", firstUnpushedCommitHash))
+	parentOutput, err := runGitCommand(ctx, repoPath, "rev-parse", fmt.Sprintf("%s^", firstUnpushedCommitHash))
 	if err != nil {
 		return "", fmt.Errorf("failed to get parent commit: %w", err)
 	}
@@ -239,10 +600,40 @@ func GetParentCommit(repoPath string, firstUnpushedCommitHash string) (string, e
 	return parentHash, nil
 }
 
+// GetCommitTime returns the author date of a commit
+func GetCommitTime(ctx context.Context, repoPath string, commitHash string) (time.Time, error) {
+	output, err := runGitCommand(ctx, repoPath, "log", "-1", "--format=%aI", commitHash)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get commit time of %s: %w", commitHash, err)
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(output))
+}
+
+// GetCommitDates returns the author and committer dates of a commit, each in the offset it was recorded with
+func GetCommitDates(ctx context.Context, repoPath string, commitHash string) (time.Time, time.Time, error) {
+	output, err := runGitCommand(ctx, repoPath, "log", "-1", "--format=%aI %cI", commitHash)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get the dates of %s: %w", commitHash, err)
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get the dates of %s: unexpected %q", commitHash, output)
+	}
+	authorDate, err := time.Parse(time.RFC3339, fields[0])
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to parse the author date of %s: %w", commitHash, err)
+	}
+	committerDate, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to parse the committer date of %s: %w", commitHash, err)
+	}
+	return authorDate, committerDate, nil
+}
+
 // GetLastPushedCommit gets the last pushed commit for a repository
-func GetLastPushedCommit(repoPath string, parentGitBranchName string) (*Commit, error) {
+func GetLastPushedCommit(ctx context.Context, repoPath string, parentGitBranchName string) (*Commit, error) {
 	// Get the current branch
-	branchOutput, err := runGitCommand(repoPath, "branch", "--show-current")
+	branchOutput, err := runGitCommand(ctx, repoPath, "branch", "--show-current")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current branch: %w", err)
 	}
@@ -254,17 +645,17 @@ func GetLastPushedCommit(repoPath string, parentGitBranchName string) (*Commit,
 	}
 
 	// First check if there are any commits at all
-	if _, err := runGitCommand(repoPath, "rev-parse", "HEAD"); err != nil {
+	if _, err := runGitCommand(ctx, repoPath, "rev-parse", "HEAD"); err != nil {
 		// No commits in the repository
 		return nil, nil
 	}
 
 	// Check if the current branch has an upstream tracking branch
-	upstreamOutput, err := runGitCommand(repoPath, "rev-parse", "--abbrev-ref", fmt.Sprintf("%s@{upstream}", currentBranch))
+	upstreamOutput, err := runGitCommand(ctx, repoPath, "rev-parse", "--abbrev-ref", fmt.Sprintf("%s@{upstream}", currentBranch))
 
 	if err != nil {
 		// No upstream branch configured, check if there are any remotes
-		remotesOutput, remotesErr := runGitCommand(repoPath, "remote")
+		remotesOutput, remotesErr := runGitCommand(ctx, repoPath, "remote")
 
 		if remotesErr != nil || strings.TrimSpace(remotesOutput) == "" {
 			// No remotes configured; no pushed commits
@@ -274,9 +665,9 @@ func GetLastPushedCommit(repoPath string, parentGitBranchName string) (*Commit,
 		// There are remotes but no upstream branch, try different strategies to find last pushed commit
 
 		// Strategy 1: Check against origin/<branch> if it exists
-		if _, originErr := runGitCommand(repoPath, "rev-parse", "--verify", fmt.Sprintf("origin/%s", currentBranch)); originErr == nil {
+		if _, originErr := runGitCommand(ctx, repoPath, "rev-parse", "--verify", fmt.Sprintf("origin/%s", currentBranch)); originErr == nil {
 			// origin/<branch> exists, get the last commit on it
-			output, err := runGitCommand(repoPath, "log", "-1", "--pretty=format:%H|%s|%an|%ae|%ad|%P", "--date=format:%Y-%m-%d %H:%M:%S %z", fmt.Sprintf("origin/%s", currentBranch))
+			output, err := runGitCommand(ctx, repoPath, "log", "-1", utf8Output, commitLogFormat("%H"), "--date=format:%Y-%m-%d %H:%M:%S %z", fmt.Sprintf("origin/%s", currentBranch))
 			if err != nil {
 				return nil, nil
 			}
@@ -290,9 +681,9 @@ func GetLastPushedCommit(repoPath string, parentGitBranchName string) (*Commit,
 		// Strategy 2: Check against any remote branches that match current branch name
 		remotesList := strings.Fields(strings.TrimSpace(remotesOutput))
 		for _, remote := range remotesList {
-			if _, remoteBranchErr := runGitCommand(repoPath, "rev-parse", "--verify", fmt.Sprintf("%s/%s", remote, currentBranch)); remoteBranchErr == nil {
+			if _, remoteBranchErr := runGitCommand(ctx, repoPath, "rev-parse", "--verify", fmt.Sprintf("%s/%s", remote, currentBranch)); remoteBranchErr == nil {
 				// Found matching remote branch, get the last commit on it
-				output, err := runGitCommand(repoPath, "log", "-1", "--pretty=format:%H|%s|%an|%ae|%ad|%P", "--date=format:%Y-%m-%d %H:%M:%S %z", fmt.Sprintf("%s/%s", remote, currentBranch))
+				output, err := runGitCommand(ctx, repoPath, "log", "-1", utf8Output, commitLogFormat("%H"), "--date=format:%Y-%m-%d %H:%M:%S %z", fmt.Sprintf("%s/%s", remote, currentBranch))
 				if err != nil {
 					continue
 				}
@@ -304,7 +695,8 @@ func GetLastPushedCommit(repoPath string, parentGitBranchName string) (*Commit,
 		}
 
 		// Strategy 3: Try against parent branch
-		output, err := runGitCommand(repoPath, "log", "-1", "--pretty=format:%H|%s|%an|%ae|%ad|%P", "--date=format:%Y-%m-%d %H:%M:%S %z", parentGitBranchName)
+		parentGitBranchName = resolveParentBranch(ctx, repoPath, parentGitBranchName, remotesOutput)
+		output, err := runGitCommand(ctx, repoPath, "log", "-1", utf8Output, commitLogFormat("%H"), "--date=format:%Y-%m-%d %H:%M:%S %z", parentGitBranchName)
 		if err == nil {
 			commits := parseCommitsWithMergeInfo(output)
 			if len(commits) > 0 {
@@ -318,7 +710,7 @@ func GetLastPushedCommit(repoPath string, parentGitBranchName string) (*Commit,
 
 	// Upstream branch exists, get the last commit on it
 	upstream := strings.TrimSpace(upstreamOutput)
-	output, err := runGitCommand(repoPath, "log", "-1", "--pretty=format:%H|%s|%an|%ae|%ad|%P", "--date=format:%Y-%m-%d %H:%M:%S %z", upstream)
+	output, err := runGitCommand(ctx, repoPath, "log", "-1", utf8Output, commitLogFormat("%H"), "--date=format:%Y-%m-%d %H:%M:%S %z", upstream)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last pushed commit: %w", err)
 	}
@@ -332,9 +724,9 @@ func GetLastPushedCommit(repoPath string, parentGitBranchName string) (*Commit,
 }
 
 // GetCurrentBranch gets the current branch name for the repository
-func GetCurrentBranch(repoPath string) (string, error) {
+func GetCurrentBranch(ctx context.Context, repoPath string) (string, error) {
 	// Get the current branch
-	branchOutput, err := runGitCommand(repoPath, "branch", "--show-current")
+	branchOutput, err := runGitCommand(ctx, repoPath, "branch", "--show-current")
 	if err != nil {
 		return "", fmt.Errorf("failed to get current branch: %w", err)
 	}
@@ -347,181 +739,1134 @@ func GetCurrentBranch(repoPath string) (string, error) {
 	return currentBranch, nil
 }
 
-// GetCommitMessage gets the full commit message for a given commit hash
-func GetCommitMessage(repoPath string, commitHash string) (string, error) {
-	output, err := runGitCommand(repoPath, "log", "--format=%B", "-n", "1", commitHash)
+// GetHeadCommit returns the full hash of the commit currently checked out
+func GetHeadCommit(ctx context.Context, repoPath string) (string, error) {
+	output, err := runGitCommand(ctx, repoPath, "rev-parse", "HEAD")
 	if err != nil {
-		return "", fmt.Errorf("failed to get commit message for %s: %w", commitHash, err)
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
 	}
-	return output, nil
+	return strings.TrimSpace(output), nil
 }
 
-// extractBranchNameFromMergeMessage extracts the branch name from a merge commit message
-// Handles formats like "Merge branch 'feature-branch' into main" or "Merge commit abc123 into main"
-func extractBranchNameFromMergeMessage(message string) string {
-	lines := strings.Split(strings.TrimSpace(message), "\n")
-	if len(lines) == 0 {
-		return ""
+// ResolveCommits returns the full hashes of the given commits, which may be abbreviated, in the same order
+func ResolveCommits(ctx context.Context, repoPath string, hashes []string) ([]string, error) {
+	var full []string
+	for start := 0; start < len(hashes); start += argBatchSize {
+		args := []string{"rev-parse"}
+		for _, hash := range hashes[start:min(start+argBatchSize, len(hashes))] {
+			args = append(args, hash+"^{commit}")
+		}
+		output, err := runGitCommand(ctx, repoPath, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve commits: %w", err)
+		}
+		full = append(full, strings.Fields(output)...)
 	}
+	return full, nil
+}
 
-	firstLine := lines[0]
+// GetGitDir returns the absolute path of the repository's git directory. Unlike assuming <repo>/.git,
+// this handles repositories created with --separate-git-dir, worktrees and a GIT_DIR environment override.
+func GetGitDir(ctx context.Context, repoPath string) (string, error) {
+	output, err := runGitCommand(ctx, repoPath, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve git directory: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
 
-	// Look for patterns like "Merge branch 'branch-name' into target"
-	if strings.Contains(firstLine, "Merge branch '") {
-		start := strings.Index(firstLine, "Merge branch '") + len("Merge branch '")
-		end := strings.Index(firstLine[start:], "'")
-		if end != -1 {
-			return firstLine[start : start+end]
+// GetTrackedFiles returns the paths of the files in the index, relative to the work tree root and slash-separated
+func GetTrackedFiles(ctx context.Context, repoPath string) ([]string, error) {
+	output, err := runGitCommand(ctx, repoPath, "ls-files", "-z", "--full-name", ":/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tracked files: %w", err)
+	}
+	var files []string
+	for _, file := range strings.Split(output, "\x00") {
+		if file != "" {
+			files = append(files, file)
 		}
 	}
+	return files, nil
+}
 
-	// Look for patterns like "Merge branch branch-name into target" (without quotes)
-	if strings.Contains(firstLine, "Merge branch ") {
-		parts := strings.Fields(firstLine)
-		for i, part := range parts {
-			if part == "branch" && i+1 < len(parts) {
-				nextPart := parts[i+1]
-				// Remove "into" if it's the next word
-				if nextPart == "into" {
-					continue
-				}
-				return nextPart
-			}
-		}
+// Fsck checks the connectivity and validity of every object in the repository. Dangling objects are normal after
+// a rewrite and are not reported.
+func Fsck(ctx context.Context, repoPath string) error {
+	if _, err := runGitCommand(ctx, repoPath, "fsck", "--no-progress", "--no-dangling"); err != nil {
+		return fmt.Errorf("git fsck failed: %w", err)
 	}
+	return nil
+}
 
-	// If we can't extract a branch name, return empty string
-	return ""
+// Housekeeping thresholds, git's own defaults for gc.auto and gc.autoPackLimit
+const (
+	LooseObjectLimit = 6700
+	PackLimit        = 50
+)
+
+// ObjectCounts is the object storage of a repository as reported by git count-objects
+type ObjectCounts struct {
+	// Loose is the number of loose objects and LooseSize the bytes they take
+	Loose     int
+	LooseSize int64
+	// InPack is the number of packed objects, spread over Packs packs that take PackSize bytes
+	InPack   int
+	Packs    int
+	PackSize int64
+	// Garbage counts files in the object directory that are neither valid loose objects nor packs
+	Garbage int
+}
+
+// NeedsRepack reports whether there are more loose objects or packs than git gc --auto tolerates, as after many
+// rewrites
+func (c ObjectCounts) NeedsRepack() bool {
+	return c.Loose > LooseObjectLimit || c.Packs > PackLimit
 }
 
-// UpdateCommitTimes updates the commit times by processing all commits in a single git filter-repo run
-func UpdateCommitTimes(repoPath string, commits []Commit, newTimes []time.Time, parentCommitHash string, branchName string, rewriteBranchName string, newCommitAuthorName string, newCommitAuthorEmail string) (int, error) {
-	// Checkout the parent commit (skip if it's the empty tree hash)
-	if parentCommitHash != emptyTreeHash {
-		if _, err := runGitCommand(repoPath, "checkout", parentCommitHash); err != nil {
-			return 0, fmt.Errorf("failed to checkout parent commit %s: %w", parentCommitHash, err)
+// CountObjects returns the object counts of the repository
+func CountObjects(ctx context.Context, repoPath string) (ObjectCounts, error) {
+	output, err := runGitCommand(ctx, repoPath, "count-objects", "-v")
+	if err != nil {
+		return ObjectCounts{}, fmt.Errorf("failed to count objects: %w", err)
+	}
+	var counts ObjectCounts
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "count":
+			counts.Loose = int(n)
+		case "size":
+			counts.LooseSize = n * 1024
+		case "in-pack":
+			counts.InPack = int(n)
+		case "packs":
+			counts.Packs = int(n)
+		case "size-pack":
+			counts.PackSize = n * 1024
+		case "garbage":
+			counts.Garbage = int(n)
 		}
 	}
+	return counts, nil
+}
 
-	// Create and checkout the rewrite branch
-	if _, err := runGitCommand(repoPath, "checkout", "-b", rewriteBranchName); err != nil {
-		return 0, fmt.Errorf("failed to create rewrite branch %s: %w", rewriteBranchName, err)
+// GC runs git gc, packing loose objects and removing unreachable ones older than gc.pruneExpire
+func GC(ctx context.Context, repoPath string) error {
+	if _, err := runGitCommand(ctx, repoPath, "gc", "--quiet"); err != nil {
+		return fmt.Errorf("git gc failed: %w", err)
 	}
+	return nil
+}
 
-	successfulUpdates := 0
+// GCAuto runs git gc --auto, which only packs and prunes when there are more loose objects or packs than the
+// repository's gc.auto and gc.autoPackLimit allow. Commits still in a reflog are kept.
+func GCAuto(ctx context.Context, repoPath string) error {
+	if _, err := runGitCommand(ctx, repoPath, "gc", "--auto", "--quiet"); err != nil {
+		return fmt.Errorf("git gc --auto failed: %w", err)
+	}
+	return nil
+}
 
-	// Process each commit and update its metadata (commits are already in correct order)
-	for i, commit := range commits {
-		newTime := newTimes[i]
+// RunMaintenance runs git maintenance run --auto, which runs the repository's configured maintenance tasks that are
+// due, by default the same as git gc --auto
+func RunMaintenance(ctx context.Context, repoPath string) error {
+	if _, err := runGitCommand(ctx, repoPath, "maintenance", "run", "--auto", "--quiet"); err != nil {
+		return fmt.Errorf("git maintenance run failed: %w", err)
+	}
+	return nil
+}
 
-		if commit.IsMerge {
-			// Handle merge commits by merging the original merged commit
-			if commit.MergeFrom == "" {
-				return successfulUpdates, fmt.Errorf("merge commit %s has no merge source", commit.Hash)
-			}
+// reflogExpiry are the config keys that control how long reflog entries are kept, with git's defaults in days: the
+// entries of commits the ref still reaches, and the others, such as the commits a rewrite replaced
+var reflogExpiry = []struct {
+	key         string
+	defaultDays int
+}{
+	{"gc.reflogExpire", 90},
+	{"gc.reflogExpireUnreachable", 30},
+}
 
-			// Get the original merge commit message to extract branch information
-			originalMessage, err := GetCommitMessage(repoPath, commit.Hash)
-			if err != nil {
-				return successfulUpdates, fmt.Errorf("failed to get original merge commit message for %s: %w", commit.Hash, err)
-			}
+// expiryUnits are the units of the expiry values parseExpiryDays understands, in days
+var expiryUnits = map[string]int{"day": 1, "week": 7, "month": 30, "year": 365}
+
+// EnsureReflogRetention makes the repository keep its reflog entries for at least days days, so the commits a rewrite
+// replaced stay recoverable with git reflog that long. gc.reflogExpire and gc.reflogExpireUnreachable are only ever
+// raised: values that already keep entries longer, including never, and values parseExpiryDays doesn't understand
+// are left as they are. It returns the keys it changed.
+func EnsureReflogRetention(ctx context.Context, repoPath string, days int) ([]string, error) {
+	var changed []string
+	for _, expiry := range reflogExpiry {
+		value, err := GetConfigValue(ctx, repoPath, expiry.key)
+		if err != nil {
+			return changed, err
+		}
+		current, ok := expiry.defaultDays, true
+		if value != "" {
+			current, ok = parseExpiryDays(value)
+		}
+		if !ok || current >= days {
+			continue
+		}
+		if err := SetConfigValues(ctx, repoPath, expiry.key, []string{fmt.Sprintf("%d.days.ago", days)}); err != nil {
+			return changed, err
+		}
+		changed = append(changed, expiry.key)
+	}
+	return changed, nil
+}
 
-			// Extract the original branch name from the merge message
-			originalBranchName := extractBranchNameFromMergeMessage(originalMessage)
-			if originalBranchName == "" {
-				// Fallback: use the commit hash if we can't extract branch name
-				originalBranchName = commit.MergeFrom[:8] // Use short hash
-			}
+// parseExpiryDays returns how many days a gc expiry value such as "90.days.ago", "2 weeks ago" or "never" keeps
+// entries, math.MaxInt for never. Dates and other approxidate forms are not understood.
+func parseExpiryDays(value string) (int, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "never", "false":
+		return math.MaxInt, true
+	case "now", "all":
+		return 0, true
+	}
 
-			// Create a custom merge message with proper branch names
-			customMergeMessage := fmt.Sprintf("Merge branch '%s' into %s", originalBranchName, branchName)
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == '.' || r == ' ' })
+	if len(fields) == 3 && fields[2] == "ago" {
+		fields = fields[:2]
+	}
+	if len(fields) != 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(fields[0])
+	unit, known := expiryUnits[strings.TrimSuffix(fields[1], "s")]
+	if err != nil || !known || n < 0 {
+		return 0, false
+	}
+	return n * unit, true
+}
 
-			// Merge the commit that was originally merged with custom message
-			if _, err := runGitCommand(repoPath, "merge", "-m", customMergeMessage, commit.MergeFrom); err != nil {
-				return successfulUpdates, fmt.Errorf("failed to merge commit %s: %w", commit.MergeFrom, err)
-			}
+// CloneBundle clones the bundle at bundlePath into dest, which must not exist yet
+func CloneBundle(ctx context.Context, bundlePath string, dest string) error {
+	if _, err := runGitCommand(ctx, filepath.Dir(dest), "clone", "--quiet", bundlePath, dest); err != nil {
+		return fmt.Errorf("failed to clone bundle %s: %w", bundlePath, err)
+	}
+	return nil
+}
 
-			// For merge commits, use the provided newTime (which should be same or later than original)
-			// This ensures merge commits maintain chronological order with the rewrite branch
-		} else {
-			// Handle regular commits by cherry-picking
-			// Try cherry-pick first
-			_, err := runGitCommand(repoPath, "cherry-pick", commit.Hash)
-			if err != nil {
-				// Check if we're in a cherry-pick state by looking at git status
-				status, statusErr := runGitCommand(repoPath, "status")
-				if statusErr == nil && strings.Contains(status, "cherry-picking") {
-					// We're in a cherry-pick state, try to continue
-					_, continueErr := runGitCommand(repoPath, "cherry-pick", "--continue")
-					if continueErr != nil {
-						// If continue fails, try to skip the commit
-						_, skipErr := runGitCommand(repoPath, "cherry-pick", "--skip")
-						if skipErr != nil {
-							// If skip also fails, abort and try with --allow-empty
-							runGitCommand(repoPath, "cherry-pick", "--abort")
-							if _, allowEmptyErr := runGitCommand(repoPath, "cherry-pick", "--allow-empty", commit.Hash); allowEmptyErr != nil {
-								return successfulUpdates, fmt.Errorf("failed to cherry-pick commit %s: %w", commit.Hash, err)
-							}
-						}
-					}
-				} else {
-					// Not in cherry-pick state, try with --allow-empty
-					if _, allowEmptyErr := runGitCommand(repoPath, "cherry-pick", "--allow-empty", commit.Hash); allowEmptyErr != nil {
-						return successfulUpdates, fmt.Errorf("failed to cherry-pick commit %s: %w", commit.Hash, err)
-					}
-				}
-			}
+// GetBundleHead returns the commit the bundle at bundlePath records as its HEAD, or "" when it records none
+func GetBundleHead(ctx context.Context, bundlePath string) (string, error) {
+	output, err := runGitCommand(ctx, filepath.Dir(bundlePath), "bundle", "list-heads", bundlePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bundle %s: %w", bundlePath, err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if hash, ref, ok := strings.Cut(strings.TrimSpace(line), " "); ok && ref == "HEAD" {
+			return hash, nil
 		}
+	}
+	return "", nil
+}
 
-		// Format the time for git environment variables
-		newTimeStr := newTime.Format("2006-01-02T15:04:05")
-
-		// Update commit metadata using git commit --amend with environment variables
-		cmd := exec.Command("git", "commit", "--amend", "--no-edit", "--reset-author")
-		cmd.Dir = repoPath
+// Fetch updates the remote-tracking refs of every remote
+func Fetch(ctx context.Context, repoPath string) error {
+	if _, err := runGitCommand(ctx, repoPath, "fetch", "--quiet", "--all"); err != nil {
+		return fmt.Errorf("failed to fetch: %w", err)
+	}
+	return nil
+}
 
-		// Build environment variables
-		env := os.Environ()
-		env = append(env, fmt.Sprintf("GIT_AUTHOR_DATE=%s", newTimeStr))
-		env = append(env, fmt.Sprintf("GIT_COMMITTER_DATE=%s", newTimeStr))
+// GetRemoteURLs returns the URLs of every remote configured for the repository
+func GetRemoteURLs(ctx context.Context, repoPath string) ([]string, error) {
+	output, err := runGitCommand(ctx, repoPath, "config", "--get-regexp", `^remote\..*\.url$`)
+	if err != nil {
+		// git config exits with status 1 when nothing matches
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list remotes: %w", err)
+	}
 
-		// Only set author name and email if they're provided
-		if newCommitAuthorName != "" {
-			env = append(env, fmt.Sprintf("GIT_AUTHOR_NAME=%s", newCommitAuthorName))
-			env = append(env, fmt.Sprintf("GIT_COMMITTER_NAME=%s", newCommitAuthorName))
+	var urls []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if _, url, found := strings.Cut(line, " "); found {
+			urls = append(urls, url)
 		}
-		if newCommitAuthorEmail != "" {
-			env = append(env, fmt.Sprintf("GIT_AUTHOR_EMAIL=%s", newCommitAuthorEmail))
-			env = append(env, fmt.Sprintf("GIT_COMMITTER_EMAIL=%s", newCommitAuthorEmail))
+	}
+	return urls, nil
+}
+
+// GetRemotes returns the names of the remotes configured for the repository
+func GetRemotes(ctx context.Context, repoPath string) ([]string, error) {
+	output, err := runGitCommand(ctx, repoPath, "remote")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remotes: %w", err)
+	}
+	return strings.Fields(output), nil
+}
+
+// GetConfigValues returns every value of a multi-valued key in the repository's configuration
+func GetConfigValues(ctx context.Context, repoPath string, key string) ([]string, error) {
+	output, err := runGitCommand(ctx, repoPath, "config", "--get-all", key)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n"), nil
+}
 
-		cmd.Env = env
+// SetConfigValues replaces every value of key in the repository's configuration with values; no values unset it
+func SetConfigValues(ctx context.Context, repoPath string, key string, values []string) error {
+	if _, err := runGitCommand(ctx, repoPath, "config", "--unset-all", key); err != nil {
+		// Exit status 5 means the key wasn't set
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 5 {
+			return fmt.Errorf("failed to unset %s: %w", key, err)
+		}
+	}
+	for _, value := range values {
+		if _, err := runGitCommand(ctx, repoPath, "config", "--add", key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	return nil
+}
 
-		var stdout, stderr strings.Builder
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
+// GetCommitterIdentity returns the identity git would record as committer in the repository,
+// honouring user.name/user.email and the GIT_COMMITTER_* environment
+func GetCommitterIdentity(ctx context.Context, repoPath string) (Identity, error) {
+	output, err := runGitCommand(ctx, repoPath, "var", "GIT_COMMITTER_IDENT")
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to resolve committer identity: %w", err)
+	}
+	// The output is "Name <email> timestamp offset"
+	identity, ok := parseIdentity(strings.TrimSpace(output))
+	if !ok {
+		return Identity{}, fmt.Errorf("unexpected committer identity %q", strings.TrimSpace(output))
+	}
+	return identity, nil
+}
 
-		if err := cmd.Run(); err != nil {
-			return successfulUpdates, &GitError{
-				Command: fmt.Sprintf("git commit --amend (in %s)", repoPath),
-				Err:     err,
-				Stdout:  stdout.String(),
-				Stderr:  stderr.String(),
-			}
+// GetConfigValue returns the value of a git config key as seen from the repository, or "" when it isn't set
+func GetConfigValue(ctx context.Context, repoPath string, key string) (string, error) {
+	output, err := runGitCommand(ctx, repoPath, "config", "--get", key)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
 		}
+		return "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return strings.TrimSpace(output), nil
+}
 
-		successfulUpdates++
+// GetGlobalConfigValue returns the value of key in the user's global git configuration, or "" when it isn't set
+func GetGlobalConfigValue(ctx context.Context, key string) (string, error) {
+	output, err := runGitCommand(ctx, "", "config", "--global", "--get", key)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read global %s: %w", key, err)
 	}
+	return strings.TrimSpace(output), nil
+}
 
-	// Checkout to the original branch (force create)
-	if _, err := runGitCommand(repoPath, "checkout", "-B", branchName); err != nil {
-		return successfulUpdates, fmt.Errorf("failed to checkout branch %s: %w", branchName, err)
+// SetGlobalConfigValue sets key in the user's global git configuration
+func SetGlobalConfigValue(ctx context.Context, key string, value string) error {
+	if _, err := runGitCommand(ctx, "", "config", "--global", key, value); err != nil {
+		return fmt.Errorf("failed to set global %s: %w", key, err)
 	}
+	return nil
+}
 
-	// Delete the rewrite-history branch
-	if _, err := runGitCommand(repoPath, "branch", "-D", rewriteBranchName); err != nil {
-		return successfulUpdates, fmt.Errorf("failed to delete rewrite branch %s: %w", rewriteBranchName, err)
+// UnsetGlobalConfigValue removes key from the user's global git configuration; a key that isn't set is not an error
+func UnsetGlobalConfigValue(ctx context.Context, key string) error {
+	if _, err := runGitCommand(ctx, "", "config", "--global", "--unset", key); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 5 {
+			return nil
+		}
+		return fmt.Errorf("failed to unset global %s: %w", key, err)
 	}
+	return nil
+}
 
-	return successfulUpdates, nil
+// GetCheckoutFilters returns the filter drivers, such as Git LFS's "lfs", that the .gitattributes files at HEAD
+// assign to paths and that have a smudge or process command configured, i.e. the filters every checkout runs
+func GetCheckoutFilters(ctx context.Context, repoPath string) ([]string, error) {
+	output, err := runGitCommand(ctx, repoPath, "grep", "-h", "-o", "-I", "-E", `(^|[[:space:]])filter=[^[:space:]]+`, "HEAD", "--", ":(glob)**/.gitattributes")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read .gitattributes: %w", err)
+	}
+
+	var filters []string
+	for _, line := range strings.Split(output, "\n") {
+		_, name, found := strings.Cut(strings.TrimSpace(line), "filter=")
+		if !found || slices.Contains(filters, name) {
+			continue
+		}
+		for _, command := range []string{"process", "smudge"} {
+			value, err := GetConfigValue(ctx, repoPath, "filter."+name+"."+command)
+			if err != nil {
+				return nil, err
+			}
+			if value != "" {
+				filters = append(filters, name)
+				break
+			}
+		}
+	}
+	return filters, nil
+}
+
+// PromisorRemote returns the remote a partial clone (git clone --filter) fetches missing objects from on demand, or
+// "" for a complete clone
+func PromisorRemote(ctx context.Context, repoPath string) (string, error) {
+	output, err := runGitCommand(ctx, repoPath, "config", "--get-regexp", `^remote\..*\.promisor$`)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return "", fmt.Errorf("failed to read promisor remotes: %w", err)
+		}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if promisor, err := strconv.ParseBool(value); err == nil && promisor {
+			return strings.TrimSuffix(strings.TrimPrefix(key, "remote."), ".promisor"), nil
+		}
+	}
+
+	// Clones made by git before 2.24 only record the remote here
+	return GetConfigValue(ctx, repoPath, "extensions.partialClone")
+}
+
+// GetMissingObjects returns the objects reachable from the revisions, e.g. "main" and "^origin/main", that a partial
+// clone hasn't fetched yet. Listing them doesn't fetch them.
+func GetMissingObjects(ctx context.Context, repoPath string, revisions ...string) ([]string, error) {
+	args := append([]string{"rev-list", "--objects", "--missing=print"}, revisions...)
+	output, err := runGitCommand(ctx, repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list missing objects: %w", err)
+	}
+
+	var missing []string
+	for _, line := range strings.Split(output, "\n") {
+		if oid, found := strings.CutPrefix(strings.TrimSpace(line), "?"); found {
+			missing = append(missing, oid)
+		}
+	}
+	return missing, nil
+}
+
+// FetchObjects fetches the given objects from the promisor remote of a partial clone in batches of argBatchSize,
+// the way git fetches a missing object on demand but with one request per batch instead of one per object
+func FetchObjects(ctx context.Context, repoPath string, remote string, oids []string) error {
+	for start := 0; start < len(oids); start += argBatchSize {
+		batch := oids[start:min(start+argBatchSize, len(oids))]
+		args := append([]string{"-c", "fetch.negotiationAlgorithm=noop", "fetch", "--quiet", "--no-tags", "--no-write-fetch-head",
+			"--recurse-submodules=no", "--filter=blob:none", remote}, batch...)
+		if _, err := runGitCommand(ctx, repoPath, args...); err != nil {
+			return fmt.Errorf("failed to fetch %d objects from %s: %w", len(oids), remote, err)
+		}
+	}
+	return nil
+}
+
+// SparseCheckout is the sparse-checkout configuration of a work tree
+type SparseCheckout struct {
+	Enabled bool
+	// Cone reports cone mode, in which Patterns name directories instead of gitignore-style patterns
+	Cone bool
+	// Patterns is the content of the work tree's sparse-checkout file
+	Patterns string
+}
+
+// GetSparseCheckout returns the sparse-checkout configuration of the repository's work tree
+func GetSparseCheckout(ctx context.Context, repoPath string) (SparseCheckout, error) {
+	var sparse SparseCheckout
+	for key, value := range map[string]*bool{"core.sparseCheckout": &sparse.Enabled, "core.sparseCheckoutCone": &sparse.Cone} {
+		output, err := runGitCommand(ctx, repoPath, "config", "--type=bool", "--get", key)
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+				continue
+			}
+			return SparseCheckout{}, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		*value = strings.TrimSpace(output) == "true"
+	}
+	if !sparse.Enabled {
+		return SparseCheckout{}, nil
+	}
+
+	gitDir, err := GetGitDir(ctx, repoPath)
+	if err != nil {
+		return SparseCheckout{}, err
+	}
+	patterns, err := os.ReadFile(filepath.Join(gitDir, "info", "sparse-checkout"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return SparseCheckout{}, fmt.Errorf("failed to read the sparse-checkout patterns: %w", err)
+	}
+	sparse.Patterns = string(patterns)
+	return sparse, nil
+}
+
+// RestoreSparseCheckout brings back a configuration returned by GetSparseCheckout and reapplies it to the work tree
+func RestoreSparseCheckout(ctx context.Context, repoPath string, sparse SparseCheckout) error {
+	if !sparse.Enabled {
+		if _, err := runGitCommand(ctx, repoPath, "sparse-checkout", "disable"); err != nil {
+			return fmt.Errorf("failed to disable sparse checkout: %w", err)
+		}
+		return nil
+	}
+
+	mode := "--no-cone"
+	if sparse.Cone {
+		mode = "--cone"
+	}
+	if _, err := runGitCommand(ctx, repoPath, "sparse-checkout", "init", mode); err != nil {
+		return fmt.Errorf("failed to enable sparse checkout: %w", err)
+	}
+	gitDir, err := GetGitDir(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "info", "sparse-checkout"), []byte(sparse.Patterns), 0644); err != nil {
+		return fmt.Errorf("failed to write the sparse-checkout patterns: %w", err)
+	}
+	if _, err := runGitCommand(ctx, repoPath, "sparse-checkout", "reapply", mode); err != nil {
+		return fmt.Errorf("failed to reapply the sparse-checkout patterns: %w", err)
+	}
+	return nil
+}
+
+// HasMailmap reports whether the repository has a .mailmap in its work tree or configures mailmap.file or mailmap.blob
+func HasMailmap(ctx context.Context, repoPath string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(repoPath, ".mailmap")); err == nil {
+		return true, nil
+	}
+
+	_, err := runGitCommand(ctx, repoPath, "config", "--get-regexp", `^mailmap\.(file|blob)$`)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read mailmap configuration: %w", err)
+	}
+	return true, nil
+}
+
+// CheckMailmap returns the canonical form of each identity according to the repository's mailmap.
+// Identities the mailmap doesn't mention are returned unchanged.
+func CheckMailmap(ctx context.Context, repoPath string, identities []Identity) ([]Identity, error) {
+	if len(identities) == 0 {
+		return nil, nil
+	}
+
+	args := []string{"check-mailmap"}
+	for _, identity := range identities {
+		if identity.Name == "" {
+			args = append(args, fmt.Sprintf("<%s>", identity.Email))
+		} else {
+			args = append(args, identity.String())
+		}
+	}
+	output, err := runGitCommand(ctx, repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check mailmap: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) != len(identities) {
+		return nil, fmt.Errorf("unexpected check-mailmap output for %d identities: %q", len(identities), output)
+	}
+	canonical := make([]Identity, len(lines))
+	for i, line := range lines {
+		identity, ok := parseIdentity(line)
+		if !ok {
+			return nil, fmt.Errorf("unexpected check-mailmap output %q", line)
+		}
+		canonical[i] = identity
+	}
+	return canonical, nil
+}
+
+// parseIdentity parses "Name <email>", ignoring anything after the closing bracket
+func parseIdentity(s string) (Identity, bool) {
+	open := strings.LastIndex(s, "<")
+	if open < 0 {
+		return Identity{}, false
+	}
+	end := strings.Index(s[open:], ">")
+	if end < 0 {
+		return Identity{}, false
+	}
+	return Identity{
+		Name:  strings.TrimSpace(s[:open]),
+		Email: s[open+1 : open+end],
+	}, true
+}
+
+// GetRemoteRefsContaining returns the remote-tracking refs (refs/remotes/*) whose history contains the commit
+func GetRemoteRefsContaining(ctx context.Context, repoPath string, commitHash string) ([]string, error) {
+	output, err := runGitCommand(ctx, repoPath, "for-each-ref", "--contains", commitHash, "--format=%(refname:short)", "refs/remotes")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check remote refs containing %s: %w", commitHash, err)
+	}
+	return strings.Fields(output), nil
+}
+
+// GetNotes returns the notes in notesRef of the given commits by full hash; commits without a note are left out
+func GetNotes(ctx context.Context, repoPath string, notesRef string, commitHashes []string) (map[string]string, error) {
+	notes := make(map[string]string)
+	if len(commitHashes) == 0 {
+		return notes, nil
+	}
+
+	args := []string{"log", "--no-walk=unsorted", "--notes=" + notesRef, "--format=%H%x00%N%x01"}
+	output, err := runGitCommand(ctx, repoPath, append(args, commitHashes...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes in %s: %w", notesRef, err)
+	}
+	for _, record := range strings.Split(output, recordTerminator) {
+		hash, note, found := strings.Cut(strings.TrimLeft(record, "\n"), fieldSeparator)
+		if found && strings.TrimSpace(note) != "" {
+			notes[hash] = note
+		}
+	}
+	return notes, nil
+}
+
+// AddNote attaches message to a commit as its note in notesRef, replacing an existing note. The notes commit is
+// recorded under identity, whose empty fields fall back to the identity git is configured with.
+func AddNote(ctx context.Context, repoPath string, notesRef string, commitHash string, message string, identity Identity) error {
+	env := appendIdentityEnv(appendIdentityEnv(nil, "AUTHOR", identity), "COMMITTER", identity)
+	if _, err := runGitCommandWithEnv(ctx, repoPath, env, "notes", "--ref", notesRef, "add", "-f", "-m", message, commitHash); err != nil {
+		return fmt.Errorf("failed to add note to %s: %w", commitHash, err)
+	}
+	return nil
+}
+
+// GetCommitMessage gets the full commit message for a given commit hash
+func GetCommitMessage(ctx context.Context, repoPath string, commitHash string) (string, error) {
+	output, err := runGitCommand(ctx, repoPath, "log", utf8Output, "--format=%B", "-n", "1", commitHash)
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit message for %s: %w", commitHash, err)
+	}
+	return output, nil
+}
+
+// UpdateCommitTimes recreates commits with their new times and moves branchName to the result. Commits are created
+// directly from their trees without touching the working tree, unless RunHooks asks for them to be replayed; then
+// they are cherry-picked onto a temporary rewriteBranchName created from parentCommitHash in a temporary worktree,
+// so the user's working tree, index and checked-out branch are still never touched. An empty parentCommitHash means
+// the oldest commit is the root commit; the temporary branch then starts as an orphan at its recreated copy.
+// If any step fails or ctx is cancelled, branchName is left where it was.
+func UpdateCommitTimes(ctx context.Context, repoPath string, commits []Commit, newTimes []time.Time, parentCommitHash string, branchName string, rewriteBranchName string, opts ReplayOptions) (int, error) {
+	if !opts.RunHooks {
+		return rewriteCommits(ctx, repoPath, commits, newTimes, branchName, opts)
+	}
+
+	originalTip, err := runGitCommand(ctx, repoPath, "rev-parse", "refs/heads/"+branchName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve branch %s: %w", branchName, err)
+	}
+	originalTip = strings.TrimSpace(originalTip)
+
+	start := parentCommitHash
+	if start == "" {
+		if len(commits) == 0 {
+			return 0, nil
+		}
+		// replayCommits recreates the root the same way and finds it already checked out
+		if start, err = recreateCommit(ctx, repoPath, commits[0], nil, newTimes[0], opts); err != nil {
+			return 0, err
+		}
+	}
+	worktree, err := os.MkdirTemp("", "code-cadence-rewrite-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create rewrite worktree: %w", err)
+	}
+	if _, err := runGitCommand(ctx, repoPath, "worktree", "add", "-b", rewriteBranchName, worktree, start); err != nil {
+		_ = os.RemoveAll(worktree)
+		return 0, fmt.Errorf("failed to create rewrite branch %s: %w", rewriteBranchName, err)
+	}
+
+	successfulUpdates, err := replayCommits(ctx, worktree, commits, newTimes, branchName, opts)
+	if err == nil {
+		var tip string
+		if tip, err = runGitCommand(ctx, worktree, "rev-parse", "HEAD"); err != nil {
+			err = fmt.Errorf("failed to resolve HEAD: %w", err)
+		} else if _, err = runGitCommand(ctx, repoPath, "update-ref", "-m", "code-cadence: rewrite commit times", "refs/heads/"+branchName, strings.TrimSpace(tip), originalTip); err != nil {
+			// Passing the original tip makes the update fail instead of discarding commits made in the meantime
+			err = fmt.Errorf("failed to update branch %s: %w", branchName, err)
+		}
+	}
+	if cleanupErr := removeRewriteWorktree(ctx, repoPath, worktree, rewriteBranchName); cleanupErr != nil {
+		if err != nil {
+			return successfulUpdates, fmt.Errorf("%w (cleanup failed: %v)", err, cleanupErr)
+		}
+		return successfulUpdates, cleanupErr
+	}
+	return successfulUpdates, err
+}
+
+// removeRewriteWorktree removes the temporary worktree, including any cherry-pick or merge in progress in it, and
+// deletes the temporary rewrite branch. It runs even if ctx has been cancelled, so that Ctrl-C leaves nothing behind.
+func removeRewriteWorktree(ctx context.Context, repoPath string, worktree string, rewriteBranchName string) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	if _, err := runGitCommand(ctx, repoPath, "worktree", "remove", "--force", worktree); err != nil {
+		// Fall back to deleting the directory and forgetting the worktree
+		_ = os.RemoveAll(worktree)
+		if _, err := runGitCommand(ctx, repoPath, "worktree", "prune"); err != nil {
+			return fmt.Errorf("failed to remove rewrite worktree %s: %w", worktree, err)
+		}
+	}
+
+	if _, err := runGitCommand(ctx, repoPath, "rev-parse", "--verify", "--quiet", "refs/heads/"+rewriteBranchName); err == nil {
+		if _, err := runGitCommand(ctx, repoPath, "branch", "-D", rewriteBranchName); err != nil {
+			return fmt.Errorf("failed to delete rewrite branch %s: %w", rewriteBranchName, err)
+		}
+	}
+	return nil
+}
+
+// rewrittenCommits maps the hash of each replayed commit, as listed in the commits being replayed, to its new full hash
+type rewrittenCommits map[string]string
+
+// lookup returns the new hash of a replayed commit given its full or abbreviated original hash
+func (r rewrittenCommits) lookup(hash string) (string, bool) {
+	for original, rewritten := range r {
+		if strings.HasPrefix(hash, original) || strings.HasPrefix(original, hash) {
+			return rewritten, true
+		}
+	}
+	return "", false
+}
+
+// resolve maps a parent hash to the commit it must be replaced with. Parents that are not being replayed are
+// kept; a parent that is replayed later than its child means the commits are not in topological order.
+func (r rewrittenCommits) resolve(hash string, pending []Commit) (string, error) {
+	if rewritten, ok := r.lookup(hash); ok {
+		return rewritten, nil
+	}
+	for _, commit := range pending {
+		if strings.HasPrefix(hash, commit.Hash) {
+			return "", fmt.Errorf("commit %s is scheduled before its parent %s", commit.Hash, hash)
+		}
+	}
+	return hash, nil
+}
+
+// replayCommits recreates each commit on top of its rewritten first parent with its new time and returns the
+// number of commits replayed. Merges point at the rewritten side branch when its commits are replayed too.
+// On success HEAD is at the rewritten tip of branchName.
+func replayCommits(ctx context.Context, repoPath string, commits []Commit, newTimes []time.Time, branchName string, opts ReplayOptions) (int, error) {
+	successfulUpdates := 0
+	rewritten := rewrittenCommits{}
+
+	originalTip, err := runGitCommand(ctx, repoPath, "rev-parse", "refs/heads/"+branchName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve branch %s: %w", branchName, err)
+	}
+	head, err := runGitCommand(ctx, repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	head = strings.TrimSpace(head)
+
+	// Process each commit and update its metadata (commits are already in topological order, oldest first)
+	for i, commit := range commits {
+		if err := ctx.Err(); err != nil {
+			return successfulUpdates, err
+		}
+		newTime := newTimes[i]
+
+		if commit.IsMerge || len(commit.Parents) == 0 {
+			// A merge is recreated from its original tree rather than merged again, which could conflict where the
+			// original merge went through cleanly or its conflicts were already resolved. A root commit has nothing to
+			// be applied on top of. Both are amended afterwards like a cherry-picked commit, so the hooks run for them.
+			parents := make([]string, len(commit.Parents))
+			for j, parent := range commit.Parents {
+				if parents[j], err = rewritten.resolve(parent, commits[i:]); err != nil {
+					return successfulUpdates, err
+				}
+			}
+			recreated, err := recreateCommit(ctx, repoPath, commit, parents, newTime, opts)
+			if err != nil {
+				return successfulUpdates, err
+			}
+			if recreated != head {
+				if _, err := runGitCommand(ctx, repoPath, "checkout", "--detach", recreated); err != nil {
+					return successfulUpdates, fmt.Errorf("failed to checkout %s: %w", recreated, err)
+				}
+			}
+		} else {
+			// Move to the commit's first parent when the previous commit replayed isn't it, e.g. at the start of a
+			// side branch
+			base, err := rewritten.resolve(commit.Parents[0], commits[i:])
+			if err != nil {
+				return successfulUpdates, err
+			}
+			if base != head {
+				if _, err := runGitCommand(ctx, repoPath, "checkout", "--detach", base); err != nil {
+					return successfulUpdates, fmt.Errorf("failed to checkout %s: %w", base, err)
+				}
+				head = base
+			}
+
+			// Handle regular commits by cherry-picking
+			dropped, err := cherryPick(ctx, repoPath, commit, opts.DropEmpty)
+			if err != nil {
+				return successfulUpdates, err
+			}
+			if dropped {
+				// Children of the dropped commit are attached to its parent instead
+				rewritten[commit.Hash] = head
+				opts.report(commit, ReplayResult{Status: ReplayDropped})
+				continue
+			}
+		}
+
+		if err := amendHead(ctx, repoPath, commit, newTime, opts); err != nil {
+			return successfulUpdates, err
+		}
+
+		head, err = runGitCommand(ctx, repoPath, "rev-parse", "HEAD")
+		if err != nil {
+			return successfulUpdates, fmt.Errorf("failed to resolve HEAD: %w", err)
+		}
+		head = strings.TrimSpace(head)
+		rewritten[commit.Hash] = head
+
+		result := ReplayResult{Status: ReplayRewritten, NewHash: head}
+		if !commit.IsMerge {
+			if empty, err := isEmptyCommit(ctx, repoPath, head); err == nil && empty {
+				result.Status = ReplayKeptEmpty
+			}
+		}
+		opts.report(commit, result)
+
+		successfulUpdates++
+	}
+
+	// The branch tip is normally the last commit replayed, but make sure in case side branch commits came last
+	if tip, ok := rewritten.lookup(strings.TrimSpace(originalTip)); ok && tip != head {
+		if _, err := runGitCommand(ctx, repoPath, "checkout", "--detach", tip); err != nil {
+			return successfulUpdates, fmt.Errorf("failed to checkout %s: %w", tip, err)
+		}
+	}
+
+	return successfulUpdates, nil
+}
+
+// recreateCommit recreates a commit from its original tree and message with commit-tree on top of parents, with the
+// time and identity of its replayed copy, so the same commit is returned each time
+func recreateCommit(ctx context.Context, repoPath string, commit Commit, parents []string, newTime time.Time, opts ReplayOptions) (string, error) {
+	object, err := readCommitObject(ctx, repoPath, commit.Hash)
+	if err != nil {
+		return "", err
+	}
+	recreated, err := commitTree(ctx, repoPath, commitEnv(commit, newTime, opts), object, parents, object.Message)
+	if err != nil {
+		return "", fmt.Errorf("failed to recreate commit %s: %w", commit.Hash, err)
+	}
+	return recreated, nil
+}
+
+// AmendHead gives the commit at HEAD a new time with a single git commit --amend, without the temporary branch and
+// cherry-picks of UpdateCommitTimes, and returns the new HEAD. commit must describe HEAD. Staged changes are refused
+// because the amend would fold them into the commit.
+func AmendHead(ctx context.Context, repoPath string, commit Commit, newTime time.Time, opts ReplayOptions) (string, error) {
+	if !opts.RunHooks {
+		ctx = withoutHooks(ctx)
+	}
+
+	head, err := runGitCommand(ctx, repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(head), commit.Hash) {
+		return "", fmt.Errorf("commit %s is not at HEAD", commit.Hash)
+	}
+	if _, err := runGitCommand(ctx, repoPath, "diff", "--cached", "--quiet"); err != nil {
+		return "", fmt.Errorf("refusing to amend %s: the index has staged changes", commit.Hash)
+	}
+
+	if err := amendHead(ctx, repoPath, commit, newTime, opts); err != nil {
+		return "", err
+	}
+	head, err = runGitCommand(ctx, repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	return strings.TrimSpace(head), nil
+}
+
+// amendHead amends the commit at HEAD, a recreated copy of commit, with its new time, identity, message and trailers
+func amendHead(ctx context.Context, repoPath string, commit Commit, newTime time.Time, opts ReplayOptions) error {
+	// Update commit metadata using git commit --amend with environment variables
+	env := commitEnv(commit, newTime, opts)
+
+	// The amend keeps the encoding header of the original, and git converts the reused message to it
+	object, err := readCommitObject(ctx, repoPath, commit.Hash)
+	if err != nil {
+		return err
+	}
+	args := append(slices.Concat(trailerConfig, encodingConfig(object.Encoding)), "commit", "--amend", "--allow-empty", "--reset-author", "--cleanup=verbatim")
+	message, err := replayMessage(ctx, repoPath, commit, opts)
+	if err != nil {
+		return err
+	}
+	var replaced string
+	if message != "" {
+		// Like the commit-tree path, a generated message is tidied, while a kept one stays byte for byte
+		args = append(args, "-m", encodeText(cleanupMessage(message), commit.Encoding))
+		if opts.SignOff {
+			if replaced, err = GetCommitMessage(ctx, repoPath, "HEAD"); err != nil {
+				return err
+			}
+		}
+	} else {
+		args = append(args, "--no-edit")
+	}
+	trailers, err := replayTrailers(ctx, repoPath, commit, env, opts, replaced)
+	if err != nil {
+		return err
+	}
+	for _, trailer := range trailers {
+		args = append(args, "--trailer", trailer)
+	}
+	_, err = runGitCommandWithEnv(ctx, repoPath, env, args...)
+	return err
+}
+
+// commitEnv returns the environment that gives a recreated copy of commit its new time and identity
+func commitEnv(commit Commit, newTime time.Time, opts ReplayOptions) []string {
+	// Include the offset so git doesn't interpret the time in the machine's local zone
+	authorDate := newTime.Format(time.RFC3339)
+	committerDate := authorDate
+	if opts.KeepDates {
+		authorDate, committerDate = commit.DateTime, commit.CommitterDateTime
+		if committerDate == "" {
+			committerDate = commit.DateTime
+		}
+	} else if opts.KeepCommitterDate {
+		committerDate = commit.CommitterDateTime
+		if committerDate == "" {
+			committerDate = commit.DateTime
+		}
+	}
+
+	var env []string
+	env = append(env, fmt.Sprintf("GIT_COMMITTER_DATE=%s", committerDate))
+
+	author := opts.Identity
+	if opts.PreserveAuthor {
+		// The original author is restored explicitly rather than relying on git to keep it
+		author = Identity{Name: commit.Author, Email: commit.Email}
+		env = append(env, fmt.Sprintf("GIT_AUTHOR_DATE=%s", commit.DateTime))
+	} else {
+		env = append(env, fmt.Sprintf("GIT_AUTHOR_DATE=%s", authorDate))
+		if opts.Author != nil {
+			if override, ok := opts.Author(commit); ok {
+				author = override
+			}
+		}
+	}
+	// Identities are written into the commit as they are, so they have to be in the encoding of its text
+	env = appendIdentityEnv(env, "AUTHOR", encodeIdentity(author, commit.Encoding))
+	env = appendIdentityEnv(env, "COMMITTER", encodeIdentity(opts.Identity, commit.Encoding))
+	return env
+}
+
+// Trailers recording the dates a commit was originally made with (ReplayOptions.OriginalDates)
+const (
+	OriginalDateTrailer          = "X-Original-Date"
+	OriginalCommitterDateTrailer = "X-Original-Committer-Date"
+)
+
+// trailerConfig makes git add a trailer unless the message already has the same one, except for the original dates,
+// which are only added when the message has none
+var trailerConfig = []string{
+	"-c", "trailer.ifexists=addIfDifferent",
+	"-c", "trailer." + OriginalDateTrailer + ".ifexists=doNothing",
+	"-c", "trailer." + OriginalCommitterDateTrailer + ".ifexists=doNothing",
+}
+
+// replayTrailers returns the trailers to add to the recreated copy of commit created with env: the configured ones,
+// the original dates when OriginalDates is set and the sign-offs when SignOff is set. replaced is the message being
+// replaced by Message, empty when it is kept.
+func replayTrailers(ctx context.Context, repoPath string, commit Commit, env []string, opts ReplayOptions, replaced string) ([]string, error) {
+	trailers := slices.Clone(opts.Trailers)
+	if opts.OriginalDates {
+		dates, err := originalDateTrailers(ctx, repoPath, commit, replaced)
+		if err != nil {
+			return nil, err
+		}
+		trailers = append(trailers, dates...)
+	}
+	if opts.SignOff {
+		signOffs, err := signOffTrailers(ctx, repoPath, env, opts.PreserveAuthor, replaced)
+		if err != nil {
+			return nil, err
+		}
+		trailers = append(trailers, signOffs...)
+	}
+	return trailers, nil
+}
+
+// originalDateTrailers returns the original date trailers of commit. The ones of replaced, the message being replaced,
+// win, since the commit's own dates are already rewritten when it was rewritten before.
+func originalDateTrailers(ctx context.Context, repoPath string, commit Commit, replaced string) ([]string, error) {
+	authorDate, committerDate, err := GetCommitDates(ctx, repoPath, commit.Hash)
+	if err != nil {
+		return nil, err
+	}
+	trailer := func(key string, date time.Time) string {
+		if values := trailerValues(replaced, key); len(values) > 0 {
+			return key + ": " + values[0]
+		}
+		return key + ": " + date.Format(time.RFC3339)
+	}
+	return []string{trailer(OriginalDateTrailer, authorDate), trailer(OriginalCommitterDateTrailer, committerDate)}, nil
+}
+
+// trailerValues returns the values of the lines of message that start with the trailer key, ignoring case
+func trailerValues(message string, key string) []string {
+	var values []string
+	prefix := strings.ToLower(key) + ":"
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(strings.ToLower(line), prefix) {
+			values = append(values, strings.TrimSpace(line[len(prefix):]))
+		}
+	}
+	return values
+}
+
+// cherryPick applies a non-merge commit on top of HEAD. A commit that is or becomes empty is kept unless dropEmpty
+// is set, in which case it is skipped and true is returned. Conflicts are returned as errors.
+func cherryPick(ctx context.Context, repoPath string, commit Commit, dropEmpty bool) (bool, error) {
+	if !dropEmpty {
+		if _, err := runGitCommand(ctx, repoPath, "cherry-pick", "--allow-empty", "--keep-redundant-commits", commit.Hash); err != nil {
+			return false, fmt.Errorf("failed to cherry-pick commit %s: %w", commit.Hash, err)
+		}
+		return false, nil
+	}
+
+	_, err := runGitCommand(ctx, repoPath, "cherry-pick", commit.Hash)
+	if err == nil {
+		return false, nil
+	}
+
+	// An empty cherry-pick stops with nothing staged, while a conflict leaves unmerged or staged paths behind
+	status, statusErr := runGitCommand(ctx, repoPath, "status", "--porcelain", "--untracked-files=no")
+	if statusErr != nil || strings.TrimSpace(status) != "" {
+		return false, fmt.Errorf("failed to cherry-pick commit %s: %w", commit.Hash, err)
+	}
+	if _, skipErr := runGitCommand(ctx, repoPath, "cherry-pick", "--skip"); skipErr != nil {
+		return false, fmt.Errorf("failed to skip empty commit %s: %w", commit.Hash, skipErr)
+	}
+	return true, nil
+}
+
+// isEmptyCommit reports whether a non-merge commit has the same tree as its parent, or a root commit the empty tree
+func isEmptyCommit(ctx context.Context, repoPath string, hash string) (bool, error) {
+	output, err := runGitCommand(ctx, repoPath, "log", "-1", "--format=%T %P", hash)
+	if err != nil {
+		return false, err
+	}
+	fields := strings.Fields(output)
+	switch len(fields) {
+	case 1:
+		emptyTree, err := GetEmptyTree(ctx, repoPath)
+		if err != nil {
+			return false, err
+		}
+		return fields[0] == emptyTree, nil
+	case 2:
+		parentTree, err := runGitCommand(ctx, repoPath, "rev-parse", fields[1]+"^{tree}")
+		if err != nil {
+			return false, err
+		}
+		return strings.TrimSpace(parentTree) == fields[0], nil
+	default:
+		return false, nil
+	}
+}
+
+// replayMessage returns the message opts.Message gives the replayed commit at HEAD, or "" to keep its message
+func replayMessage(ctx context.Context, repoPath string, commit Commit, opts ReplayOptions) (string, error) {
+	if opts.Message == nil {
+		return "", nil
+	}
+
+	current, err := GetCommitMessage(ctx, repoPath, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	current = decodeText(current, commit.Encoding)
+	message, err := opts.Message(commit, current)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(message) == strings.TrimSpace(current) {
+		return "", nil
+	}
+	return message, nil
+}
+
+// signOffPrefix starts a Developer Certificate of Origin sign-off trailer
+const signOffPrefix = "Signed-off-by: "
+
+// signOffTrailers returns the Signed-off-by trailers for a commit recreated with env: the sign-offs of replaced, the
+// message being replaced (empty when it is kept), followed by one for the identity the commit is recorded under
+func signOffTrailers(ctx context.Context, repoPath string, env []string, preserveAuthor bool, replaced string) ([]string, error) {
+	var trailers []string
+	for _, signer := range trailerValues(replaced, strings.TrimSuffix(signOffPrefix, ": ")) {
+		trailers = append(trailers, signOffPrefix+signer)
+	}
+
+	// git var resolves the identity the same way commit does, including the fallback to user.name and user.email
+	role := "GIT_AUTHOR_IDENT"
+	if preserveAuthor {
+		role = "GIT_COMMITTER_IDENT"
+	}
+	output, err := runGitCommandWithEnv(ctx, repoPath, env, "var", role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the sign-off identity: %w", err)
+	}
+	ident := strings.TrimSpace(output)
+	end := strings.LastIndex(ident, ">")
+	if end < 0 {
+		return nil, fmt.Errorf("failed to resolve the sign-off identity: unexpected %q", ident)
+	}
+	return append(trailers, signOffPrefix+ident[:end+1]), nil
+}
+
+// appendIdentityEnv sets GIT_<role>_NAME and GIT_<role>_EMAIL for the identity's non-empty fields
+func appendIdentityEnv(env []string, role string, identity Identity) []string {
+	if identity.Name != "" {
+		env = append(env, fmt.Sprintf("GIT_%s_NAME=%s", role, identity.Name))
+	}
+	if identity.Email != "" {
+		env = append(env, fmt.Sprintf("GIT_%s_EMAIL=%s", role, identity.Email))
+	}
+	return env
 }
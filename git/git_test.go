@@ -1,11 +1,18 @@
 package git
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestGitError(t *testing.T) {
@@ -29,7 +36,7 @@ func TestGitError(t *testing.T) {
 }
 
 func TestCheckGitAvailability(t *testing.T) {
-	err := CheckGitAvailability()
+	err := CheckGitAvailability(context.Background())
 	if err != nil {
 		t.Errorf("Git should be available in test environment, got error: %v", err)
 	}
@@ -37,13 +44,13 @@ func TestCheckGitAvailability(t *testing.T) {
 
 func TestRunGitCommand(t *testing.T) {
 	// Test with invalid directory
-	_, err := runGitCommand("/nonexistent/directory", "status")
+	_, err := runGitCommand(context.Background(), "/nonexistent/directory", "status")
 	if err == nil {
 		t.Error("Expected error for invalid directory")
 	}
 
 	// Test with no arguments
-	_, err = runGitCommand(".", "")
+	_, err = runGitCommand(context.Background(), ".", "")
 	if err == nil {
 		t.Error("Expected error for no arguments")
 	}
@@ -57,7 +64,7 @@ func TestRunGitCommand(t *testing.T) {
 		t.Fatalf("Failed to initialize git repository: %v", err)
 	}
 
-	output, err := runGitCommand(tempDir, "status")
+	output, err := runGitCommand(context.Background(), tempDir, "status")
 	if err != nil {
 		t.Errorf("Unexpected error for valid git command: %v", err)
 	}
@@ -84,7 +91,7 @@ func TestParseCommitsWithMergeInfo(t *testing.T) {
 		},
 		{
 			name:  "regular commit",
-			input: "abc123|Fix bug|John Doe|john@example.com|2024-01-01 10:00:00 +0000|def456",
+			input: "abc123\x00Fix bug\x00John Doe\x00john@example.com\x002024-01-01 10:00:00 +0000\x00def456\x01",
 			expected: []Commit{
 				{
 					Hash:      "abc123",
@@ -99,7 +106,7 @@ func TestParseCommitsWithMergeInfo(t *testing.T) {
 		},
 		{
 			name:  "merge commit",
-			input: "abc123|Merge branch 'feature'|John Doe|john@example.com|2024-01-01 10:00:00 +0000|def456 ghi789",
+			input: "abc123\x00Merge branch 'feature'\x00John Doe\x00john@example.com\x002024-01-01 10:00:00 +0000\x00def456 ghi789\x01",
 			expected: []Commit{
 				{
 					Hash:      "abc123",
@@ -114,7 +121,7 @@ func TestParseCommitsWithMergeInfo(t *testing.T) {
 		},
 		{
 			name:  "multiple commits",
-			input: "abc123|First commit|John|john@example.com|2024-01-01 10:00:00 +0000|def456\ndef456|Second commit|Jane|jane@example.com|2024-01-01 11:00:00 +0000|ghi789",
+			input: "abc123\x00First commit\x00John\x00john@example.com\x002024-01-01 10:00:00 +0000\x00def456\x01\ndef456\x00Second commit\x00Jane\x00jane@example.com\x002024-01-01 11:00:00 +0000\x00ghi789\x01",
 			expected: []Commit{
 				{
 					Hash:      "abc123",
@@ -136,9 +143,64 @@ func TestParseCommitsWithMergeInfo(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "subject and author containing separators of the old format",
+			input: "abc123\x00Fix a|b parsing | again\x00O'Brien | Team\x00ob@example.com\x002024-01-01 10:00:00 +0000\x00def456\x01",
+			expected: []Commit{
+				{
+					Hash:     "abc123",
+					Subject:  "Fix a|b parsing | again",
+					Author:   "O'Brien | Team",
+					Email:    "ob@example.com",
+					DateTime: "2024-01-01 10:00:00 +0000",
+				},
+			},
+		},
+		{
+			name:  "unicode and newlines",
+			input: "abc123\x00Ünïcødé 修复 🐛\nsecond line\x00Zoë Ångström\x00zoe@example.com\x002024-01-01 10:00:00 +0000\x00def456\x01\ndef456\x00Next\x00Jane\x00jane@example.com\x002024-01-01 11:00:00 +0000\x00\x01",
+			expected: []Commit{
+				{
+					Hash:     "abc123",
+					Subject:  "Ünïcødé 修复 🐛\nsecond line",
+					Author:   "Zoë Ångström",
+					Email:    "zoe@example.com",
+					DateTime: "2024-01-01 10:00:00 +0000",
+				},
+				{
+					Hash:     "def456",
+					Subject:  "Next",
+					Author:   "Jane",
+					Email:    "jane@example.com",
+					DateTime: "2024-01-01 11:00:00 +0000",
+				},
+			},
+		},
+		{
+			name:  "encodings",
+			input: "abc123\x00Caf\xe9\x00Jos\xe9\x00jose@example.com\x002024-01-01 10:00:00 +0000\x00def456\x002024-01-01 10:00:00 +0000\x00\x01\ndef456\x00Café\x00José\x00jose@example.com\x002024-01-01 11:00:00 +0000\x00\x002024-01-01 11:00:00 +0000\x00ISO-8859-1\x01",
+			expected: []Commit{
+				{
+					Hash:     "abc123",
+					Subject:  "Café",
+					Author:   "José",
+					Email:    "jose@example.com",
+					DateTime: "2024-01-01 10:00:00 +0000",
+					Encoding: Latin1,
+				},
+				{
+					Hash:     "def456",
+					Subject:  "Café",
+					Author:   "José",
+					Email:    "jose@example.com",
+					DateTime: "2024-01-01 11:00:00 +0000",
+					Encoding: Latin1,
+				},
+			},
+		},
 		{
 			name:     "invalid format",
-			input:    "abc123|Incomplete",
+			input:    "abc123\x00Incomplete\x01",
 			expected: []Commit{},
 		},
 	}
@@ -171,6 +233,9 @@ func TestParseCommitsWithMergeInfo(t *testing.T) {
 				if result[i].IsMerge != expected.IsMerge {
 					t.Errorf("Commit %d: expected IsMerge %t, got %t", i, expected.IsMerge, result[i].IsMerge)
 				}
+				if result[i].Encoding != expected.Encoding {
+					t.Errorf("Commit %d: expected Encoding %q, got %q", i, expected.Encoding, result[i].Encoding)
+				}
 				if result[i].MergeFrom != expected.MergeFrom {
 					t.Errorf("Commit %d: expected MergeFrom %s, got %s", i, expected.MergeFrom, result[i].MergeFrom)
 				}
@@ -179,54 +244,6 @@ func TestParseCommitsWithMergeInfo(t *testing.T) {
 	}
 }
 
-func TestExtractBranchNameFromMergeMessage(t *testing.T) {
-	tests := []struct {
-		name     string
-		message  string
-		expected string
-	}{
-		{
-			name:     "standard merge message with quotes",
-			message:  "Merge branch 'feature-branch' into main",
-			expected: "feature-branch",
-		},
-		{
-			name:     "merge message without quotes",
-			message:  "Merge branch feature-branch into main",
-			expected: "feature-branch",
-		},
-		{
-			name:     "merge commit message",
-			message:  "Merge commit abc123 into main",
-			expected: "",
-		},
-		{
-			name:     "empty message",
-			message:  "",
-			expected: "",
-		},
-		{
-			name:     "non-merge message",
-			message:  "Regular commit message",
-			expected: "",
-		},
-		{
-			name:     "merge message with multiple lines",
-			message:  "Merge branch 'feature' into main\n\nThis is a merge commit",
-			expected: "feature",
-		},
-	}
-
-	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			result := extractBranchNameFromMergeMessage(test.message)
-			if result != test.expected {
-				t.Errorf("Expected '%s', got '%s'", test.expected, result)
-			}
-		})
-	}
-}
-
 func TestGetCurrentBranch(t *testing.T) {
 	// Create a temporary git repository
 	tempDir := t.TempDir()
@@ -261,7 +278,7 @@ func TestGetCurrentBranch(t *testing.T) {
 	}
 
 	// Test getting current branch
-	branch, err := GetCurrentBranch(tempDir)
+	branch, err := GetCurrentBranch(context.Background(), tempDir)
 	if err != nil {
 		t.Fatalf("Failed to get current branch: %v", err)
 	}
@@ -321,7 +338,7 @@ func TestGetCurrentBranchDetachedHead(t *testing.T) {
 	}
 
 	// Test getting current branch in detached HEAD state
-	_, err = GetCurrentBranch(tempDir)
+	_, err = GetCurrentBranch(context.Background(), tempDir)
 	if err == nil {
 		t.Error("Expected error for detached HEAD state")
 	}
@@ -342,7 +359,7 @@ func TestGetCurrentBranchNoCommits(t *testing.T) {
 	// Test getting current branch with no commits
 	// Note: Modern git versions may return a default branch name even for empty repos
 	// So we'll just verify the function doesn't crash
-	branch, err := GetCurrentBranch(tempDir)
+	branch, err := GetCurrentBranch(context.Background(), tempDir)
 	if err != nil {
 		// This is expected for some git versions
 		t.Logf("GetCurrentBranch returned error as expected: %v", err)
@@ -396,7 +413,7 @@ func TestGetCommitMessage(t *testing.T) {
 	commitHash := strings.TrimSpace(string(output))
 
 	// Test getting commit message
-	message, err := GetCommitMessage(tempDir, commitHash)
+	message, err := GetCommitMessage(context.Background(), tempDir, commitHash)
 	if err != nil {
 		t.Fatalf("Failed to get commit message: %v", err)
 	}
@@ -479,7 +496,7 @@ func TestGetParentCommit(t *testing.T) {
 	secondCommitHash := strings.TrimSpace(string(output))
 
 	// Test getting parent commit
-	parentHash, err := GetParentCommit(tempDir, secondCommitHash)
+	parentHash, err := GetParentCommit(context.Background(), tempDir, secondCommitHash)
 	if err != nil {
 		t.Fatalf("Failed to get parent commit: %v", err)
 	}
@@ -544,7 +561,7 @@ func TestGetUnpushedCommits(t *testing.T) {
 	}
 
 	// Test getting unpushed commits (should return all commits since no remote)
-	commits, err := GetUnpushedCommits(tempDir, "origin/main")
+	commits, err := GetUnpushedCommits(context.Background(), tempDir, "origin/main")
 	if err != nil {
 		t.Fatalf("Failed to get unpushed commits: %v", err)
 	}
@@ -562,6 +579,71 @@ func TestGetUnpushedCommits(t *testing.T) {
 	}
 }
 
+func TestGetUnpushedCommitsSpecialCharacters(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 1)
+
+	if err := os.WriteFile(filepath.Join(repo, "special.txt"), []byte("special"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if _, err := runGitCommand(ctx, repo, "add", "special.txt"); err != nil {
+		t.Fatalf("git add failed: %v", err)
+	}
+	env := []string{"GIT_AUTHOR_NAME=O'Brien | Team", "GIT_AUTHOR_EMAIL=ob@example.com"}
+	if _, err := runGitCommandWithEnv(ctx, repo, env, "commit", "-m", "Fix a|b parsing 修复 🐛"); err != nil {
+		t.Fatalf("git commit failed: %v", err)
+	}
+
+	commits, err := GetUnpushedCommits(ctx, repo, "origin/main")
+	if err != nil {
+		t.Fatalf("GetUnpushedCommits failed: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("Expected 2 commits, got %d: %+v", len(commits), commits)
+	}
+	if commits[0].Subject != "Fix a|b parsing 修复 🐛" || commits[0].Author != "O'Brien | Team" || commits[0].Email != "ob@example.com" {
+		t.Errorf("Unexpected commit %+v", commits[0])
+	}
+	if _, err := commits[0].Time(); err != nil {
+		t.Errorf("Commit date %q did not parse: %v", commits[0].DateTime, err)
+	}
+}
+
+func TestGetUnpushedCommitsDefaultBranch(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 3)
+
+	for _, args := range [][]string{
+		{"remote", "add", "origin", "https://example.com/repo.git"},
+		{"update-ref", "refs/remotes/origin/develop", "HEAD~1"},
+		{"checkout", "-q", "-b", "feature"},
+	} {
+		if _, err := runGitCommand(ctx, repo, args...); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+
+	// Without a recorded default branch, auto falls back to origin/main, which doesn't exist here
+	if branch, err := GetRemoteDefaultBranch(ctx, repo, "origin"); err != nil || branch != "" {
+		t.Errorf("Expected no default branch, got %q (%v)", branch, err)
+	}
+	commits, err := GetUnpushedCommits(ctx, repo, AutoParentBranch)
+	if err != nil || len(commits) != 3 {
+		t.Errorf("Expected all 3 commits to be unpushed, got %d (%v)", len(commits), err)
+	}
+
+	if _, err := runGitCommand(ctx, repo, "symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/develop"); err != nil {
+		t.Fatalf("symbolic-ref failed: %v", err)
+	}
+	if branch, err := GetRemoteDefaultBranch(ctx, repo, "origin"); err != nil || branch != "origin/develop" {
+		t.Errorf("Expected origin/develop, got %q (%v)", branch, err)
+	}
+	commits, err = GetUnpushedCommits(ctx, repo, AutoParentBranch)
+	if err != nil || len(commits) != 1 || commits[0].Subject != "Commit 2" {
+		t.Errorf("Expected only Commit 2 to be unpushed against origin/develop, got %+v (%v)", commits, err)
+	}
+}
+
 func TestGetUnpushedCommitsNoCommits(t *testing.T) {
 	// Create a temporary git repository
 	tempDir := t.TempDir()
@@ -575,7 +657,7 @@ func TestGetUnpushedCommitsNoCommits(t *testing.T) {
 	}
 
 	// Test getting unpushed commits with no commits
-	commits, err := GetUnpushedCommits(tempDir, "origin/main")
+	commits, err := GetUnpushedCommits(context.Background(), tempDir, "origin/main")
 	if err != nil {
 		t.Fatalf("Failed to get unpushed commits: %v", err)
 	}
@@ -587,29 +669,1804 @@ func TestGetUnpushedCommitsNoCommits(t *testing.T) {
 
 func TestGetUnpushedCommitsInvalidDirectory(t *testing.T) {
 	// Test with invalid directory
-	_, err := GetUnpushedCommits("/nonexistent/directory", "origin/main")
+	_, err := GetUnpushedCommits(context.Background(), "/nonexistent/directory", "origin/main")
 	if err == nil {
 		t.Error("Expected error for invalid directory")
 	}
 }
 
-// Benchmark tests
-func BenchmarkParseCommitsWithMergeInfo(b *testing.B) {
-	input := `abc123|First commit|John|john@example.com|2024-01-01 10:00:00 +0000|def456
-def456|Second commit|Jane|jane@example.com|2024-01-01 11:00:00 +0000|ghi789
-ghi789|Merge branch 'feature'|John|john@example.com|2024-01-01 12:00:00 +0000|jkl012 mno345`
+func TestRunGitCommandCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		parseCommitsWithMergeInfo(input)
+	_, err := runGitCommand(ctx, t.TempDir(), "status")
+	if err == nil {
+		t.Fatal("Expected error for cancelled context")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
 	}
 }
 
-func BenchmarkExtractBranchNameFromMergeMessage(b *testing.B) {
-	message := "Merge branch 'feature-branch' into main\n\nThis is a merge commit"
+func TestRunGitCommandTimeout(t *testing.T) {
+	ctx := WithRunner(context.Background(), ExecRunner{Timeout: time.Nanosecond})
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		extractBranchNameFromMergeMessage(message)
+	_, err := runGitCommand(ctx, t.TempDir(), "status")
+	if err == nil {
+		t.Fatal("Expected error for timed out command")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestPlatformArgs(t *testing.T) {
+	if args := platformArgs("windows"); strings.Join(args, " ") != "-c core.longpaths=true" {
+		t.Errorf("Expected core.longpaths on Windows, got %v", args)
+	}
+	for _, goos := range []string{"linux", "darwin"} {
+		if args := platformArgs(goos); args != nil {
+			t.Errorf("Expected no options on %s, got %v", goos, args)
+		}
+	}
+}
+
+func TestTraceRunner(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 1)
+	var trace strings.Builder
+	runner := TraceRunner{Runner: ExecRunner{}, W: &trace}
+
+	if _, err := runner.Run(ctx, repo, []string{"GIT_AUTHOR_NAME=Jane Doe"}, "log", "-1", "--format=%an <%ae>"); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := runner.Run(ctx, repo, nil, "rev-parse", "--verify", "missing"); err == nil {
+		t.Fatal("Expected resolving a missing ref to fail")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a line per command, got %q", trace.String())
+	}
+	prefix := fmt.Sprintf(`[trace] git log -1 "--format=%%an <%%ae>" | dir %s | env "GIT_AUTHOR_NAME=Jane Doe" | `, quoteTraceArg(repo))
+	if !strings.HasPrefix(lines[0], prefix) || !strings.HasSuffix(lines[0], " | exit 0") {
+		t.Errorf("Expected %q followed by the duration and exit 0, got %q", prefix, lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "[trace] git rev-parse --verify missing | dir ") || !strings.Contains(lines[1], " | exit 128 | stderr \"fatal: ") {
+		t.Errorf("Expected the failure with its exit status and stderr, got %q", lines[1])
+	}
+}
+
+func TestRunnerFromContext(t *testing.T) {
+	if _, ok := RunnerFromContext(context.Background()).(ExecRunner); !ok {
+		t.Error("Expected ExecRunner to be the default runner")
+	}
+
+	var calls [][]string
+	mock := RunnerFunc(func(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+		calls = append(calls, args)
+		switch strings.Join(args, " ") {
+		case "branch --show-current":
+			return "feature\n", nil
+		default:
+			return "", &GitError{Command: strings.Join(args, " "), Err: errors.New("unexpected command")}
+		}
+	})
+
+	ctx := WithRunner(context.Background(), mock)
+	branch, err := GetCurrentBranch(ctx, "/mocked/repo")
+	if err != nil {
+		t.Fatalf("Unexpected error from mocked runner: %v", err)
+	}
+	if branch != "feature" {
+		t.Errorf("Expected branch 'feature', got '%s'", branch)
+	}
+	if len(calls) != 1 {
+		t.Errorf("Expected 1 git call, got %d", len(calls))
+	}
+}
+
+func TestGetUnpushedCommitsWithMockRunner(t *testing.T) {
+	mock := RunnerFunc(func(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+		switch args[0] {
+		case "branch":
+			return "main\n", nil
+		case "rev-parse":
+			if args[1] == "HEAD" {
+				return "abc1234\n", nil
+			}
+			if args[1] == "--abbrev-ref" {
+				return "origin/main\n", nil
+			}
+		case "log":
+			if args[len(args)-1] != "origin/main..main" {
+				t.Errorf("Expected log range origin/main..main, got %s", args[len(args)-1])
+			}
+			return "abc1234\x00Second\x00Dev\x00dev@example.com\x002024-01-01 12:00:00 +0000\x00def5678\x01\n" +
+				"def5678\x00First\x00Dev\x00dev@example.com\x002024-01-01 11:00:00 +0000\x000000000\x01", nil
+		}
+		return "", &GitError{Command: strings.Join(args, " "), Err: errors.New("unexpected command")}
+	})
+
+	commits, err := GetUnpushedCommits(WithRunner(context.Background(), mock), "/mocked/repo", "origin/main")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("Expected 2 commits, got %d", len(commits))
+	}
+	if commits[0].Subject != "Second" || commits[1].Subject != "First" {
+		t.Errorf("Unexpected commits: %+v", commits)
+	}
+}
+
+func TestUpdateCommitTimesRollback(t *testing.T) {
+	tempDir := initTestRepo(t, 2)
+
+	branch, err := GetCurrentBranch(context.Background(), tempDir)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	headBefore, err := runGitCommand(context.Background(), tempDir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to get HEAD: %v", err)
+	}
+	parent, err := runGitCommand(context.Background(), tempDir, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+
+	// A commit that doesn't exist makes the rewrite fail midway, whether it is replayed in the working tree or not
+	commits := []Commit{{Hash: "0000000000000000000000000000000000000000"}}
+	for _, opts := range []ReplayOptions{{}, {RunHooks: true}} {
+		_, err = UpdateCommitTimes(context.Background(), tempDir, commits, []time.Time{time.Now()}, strings.TrimSpace(parent), branch, "rewrite-history", opts)
+		if err == nil {
+			t.Fatal("Expected error for nonexistent commit")
+		}
+
+		currentBranch, err := GetCurrentBranch(context.Background(), tempDir)
+		if err != nil {
+			t.Fatalf("Repository was left detached after rollback: %v", err)
+		}
+		if currentBranch != branch {
+			t.Errorf("Expected to be back on %s, got %s", branch, currentBranch)
+		}
+
+		headAfter, _ := runGitCommand(context.Background(), tempDir, "rev-parse", "HEAD")
+		if headAfter != headBefore {
+			t.Errorf("Expected HEAD to be unchanged, got %s (was %s)", headAfter, headBefore)
+		}
+
+		if _, err := runGitCommand(context.Background(), tempDir, "rev-parse", "--verify", "--quiet", "refs/heads/rewrite-history"); err == nil {
+			t.Error("Expected rewrite branch to be deleted after rollback")
+		}
+	}
+}
+
+func TestUpdateCommitTimesWorkingTreeUntouched(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 3)
+
+	branch, err := GetCurrentBranch(ctx, repo)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~2")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	// A message git commit -m would have reformatted must be kept byte for byte
+	message := "Subject  \n\n\n    indented body\n\nChange-Id: I0123456789abcdef\n"
+	if _, err := runGitCommand(ctx, repo, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--amend", "--cleanup=verbatim", "-m", message); err != nil {
+		t.Fatalf("Failed to amend: %v", err)
+	}
+
+	// Uncommitted work, staged and unstaged, that a checkout-based rewrite would trip over
+	if err := os.WriteFile(filepath.Join(repo, "staged.txt"), []byte("staged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGitCommand(ctx, repo, "add", "staged.txt"); err != nil {
+		t.Fatalf("Failed to stage: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "file1.txt"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	statusBefore, err := runGitCommand(ctx, repo, "status", "--porcelain")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	treeBefore, _ := runGitCommand(ctx, repo, "rev-parse", "HEAD^{tree}")
+
+	commits, err := getCommitsFirstParentWithMerges(ctx, repo, strings.TrimSpace(parent)+"..HEAD")
+	if err != nil || len(commits) != 2 {
+		t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+	}
+	slices.Reverse(commits)
+	newTime := time.Date(2024, 3, 4, 11, 0, 0, 0, time.UTC)
+	if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{newTime, newTime.Add(time.Hour)}, strings.TrimSpace(parent), branch, "rewrite-history", ReplayOptions{}); err != nil {
+		t.Fatalf("UpdateCommitTimes failed: %v", err)
+	}
+
+	if current, err := GetCurrentBranch(ctx, repo); err != nil || current != branch {
+		t.Errorf("Expected to still be on %s, got %q (%v)", branch, current, err)
+	}
+	if statusAfter, _ := runGitCommand(ctx, repo, "status", "--porcelain"); statusAfter != statusBefore {
+		t.Errorf("Expected the working tree and index to be untouched, status was\n%s\nand is\n%s", statusBefore, statusAfter)
+	}
+	if treeAfter, _ := runGitCommand(ctx, repo, "rev-parse", "HEAD^{tree}"); treeAfter != treeBefore {
+		t.Errorf("Expected the tree to be unchanged, got %s (was %s)", treeAfter, treeBefore)
+	}
+	if date, _ := GetCommitTime(ctx, repo, "HEAD~1"); !date.Equal(newTime) {
+		t.Errorf("Expected HEAD~1 at %s, got %s", newTime, date)
+	}
+	object, err := readCommitObject(ctx, repo, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to read HEAD: %v", err)
+	}
+	if object.Message != message {
+		t.Errorf("Expected message %q, got %q", message, object.Message)
+	}
+}
+
+func TestUpdateCommitTimesPreserveAuthor(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 2)
+
+	branch, err := GetCurrentBranch(ctx, repo)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+	}
+
+	// A zone that differs from the machine's must survive the rewrite
+	newTime := time.Date(2024, 2, 1, 10, 30, 0, 0, time.FixedZone("", 5*60*60+30*60))
+	opts := ReplayOptions{Identity: Identity{Name: "Committer", Email: "committer@example.com"}, PreserveAuthor: true}
+	if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{newTime}, strings.TrimSpace(parent), branch, "rewrite-history", opts); err != nil {
+		t.Fatalf("UpdateCommitTimes failed: %v", err)
+	}
+
+	output, err := runGitCommand(ctx, repo, "log", "-1", "--date=iso", "--format=%an|%ae|%ad|%cn|%ce|%cd")
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	parts := strings.Split(strings.TrimSpace(output), "|")
+	if parts[0] != "Test" || parts[1] != "test@example.com" || parts[2] != commits[0].DateTime {
+		t.Errorf("Expected original author Test <test@example.com> at %s, got %v", commits[0].DateTime, parts[:3])
+	}
+	if parts[3] != "Committer" || parts[4] != "committer@example.com" || parts[5] != newTime.Format(DateTimeLayout) {
+		t.Errorf("Expected committer Committer <committer@example.com> at %s, got %v", newTime.Format(DateTimeLayout), parts[3:])
+	}
+}
+
+func TestUpdateCommitTimesKeepCommitterDate(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 2)
+
+	branch, err := GetCurrentBranch(ctx, repo)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+	}
+	if commits[0].CommitterDateTime == "" {
+		t.Fatal("Expected the committer date to be read")
+	}
+
+	newTime := time.Date(2024, 2, 1, 10, 30, 0, 0, time.FixedZone("", 2*60*60))
+	opts := ReplayOptions{KeepCommitterDate: true}
+	if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{newTime}, strings.TrimSpace(parent), branch, "rewrite-history", opts); err != nil {
+		t.Fatalf("UpdateCommitTimes failed: %v", err)
+	}
+
+	output, err := runGitCommand(ctx, repo, "log", "-1", "--date=iso", "--format=%ad|%cd")
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	parts := strings.Split(strings.TrimSpace(output), "|")
+	if parts[0] != newTime.Format(DateTimeLayout) {
+		t.Errorf("Expected author date %s, got %s", newTime.Format(DateTimeLayout), parts[0])
+	}
+	if parts[1] != commits[0].CommitterDateTime {
+		t.Errorf("Expected original committer date %s, got %s", commits[0].CommitterDateTime, parts[1])
+	}
+}
+
+func TestUpdateCommitTimesTrailers(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 2)
+
+	branch, err := GetCurrentBranch(ctx, repo)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+
+	trailer := "Co-authored-by: Sam Lee <sam@example.com>"
+	opts := ReplayOptions{Trailers: []string{trailer}}
+
+	// Rewriting twice must not duplicate the trailer
+	for i := 0; i < 2; i++ {
+		commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+		if err != nil || len(commits) != 1 {
+			t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+		}
+		if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{time.Now()}, strings.TrimSpace(parent), branch, "rewrite-history", opts); err != nil {
+			t.Fatalf("UpdateCommitTimes failed: %v", err)
+		}
+	}
+
+	message, err := GetCommitMessage(ctx, repo, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to get commit message: %v", err)
+	}
+	if count := strings.Count(message, trailer); count != 1 {
+		t.Errorf("Expected the trailer once, found it %d times in %q", count, message)
+	}
+	if !strings.HasPrefix(message, "Commit 1") {
+		t.Errorf("Expected the original message to be kept, got %q", message)
+	}
+}
+
+func TestUpdateCommitTimesMessagesVerbatim(t *testing.T) {
+	messages := map[string]string{
+		"paragraphs":  "Add the billing export\n\nThe export runs nightly.\nIt writes CSV.\n\nFailures are retried twice.\n",
+		"change-id":   "Fix the retry loop\n\nChange-Id: I0123456789abcdef0123456789abcdef01234567\nSigned-off-by: Sam Lee <sam@example.com>\n",
+		"trailers":    "Bump the SDK\n\nReviewed-by: Kim <kim@example.com>\nCo-authored-by: Sam Lee <sam@example.com>\n",
+		"whitespace":  "Subject with trailing spaces  \n\n\n\n    indented code\n\tand a tab\n\n# not a comment\n\n",
+		"no-body-eol": "Subject only",
+	}
+	for name, message := range messages {
+		for _, opts := range []ReplayOptions{{}, {RunHooks: true}, {Trailers: []string{"Co-authored-by: Alex <alex@example.com>"}}, {RunHooks: true, SignOff: true, Identity: Identity{Name: "Test", Email: "test@example.com"}}} {
+			t.Run(fmt.Sprintf("%s/runHooks=%t/trailers=%t", name, opts.RunHooks, len(opts.Trailers) > 0 || opts.SignOff), func(t *testing.T) {
+				ctx := context.Background()
+				repo := initTestRepo(t, 1)
+				if _, err := runGitCommand(ctx, repo, "commit", "--quiet", "--allow-empty", "--cleanup=verbatim", "-m", message); err != nil {
+					t.Fatalf("git commit failed: %v", err)
+				}
+				branch, err := GetCurrentBranch(ctx, repo)
+				if err != nil {
+					t.Fatalf("Failed to get current branch: %v", err)
+				}
+				parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+				if err != nil {
+					t.Fatalf("Failed to get parent: %v", err)
+				}
+				commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+				if err != nil || len(commits) != 1 {
+					t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+				}
+				original, err := readCommitObject(ctx, repo, commits[0].Hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var newHash string
+				opts.OnReplay = func(commit Commit, result ReplayResult) { newHash = result.NewHash }
+				if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{time.Now()}, strings.TrimSpace(parent), branch, "rewrite-history", opts); err != nil {
+					t.Fatalf("UpdateCommitTimes failed: %v", err)
+				}
+
+				rewritten, err := readCommitObject(ctx, repo, newHash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(opts.Trailers) == 0 && !opts.SignOff && rewritten.Message != original.Message {
+					t.Errorf("Expected the message byte for byte, got %q instead of %q", rewritten.Message, original.Message)
+				}
+				if diff, err := CompareMessages(ctx, repo, commits[0].Hash, newHash); err != nil || diff != "" {
+					t.Errorf("Expected the message to be kept, got diff\n%s(%v)", diff, err)
+				}
+			})
+		}
+	}
+}
+
+func TestCompareMessages(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 1)
+	commit := func(message string) string {
+		t.Helper()
+		if _, err := runGitCommand(ctx, repo, "commit", "--quiet", "--allow-empty", "--cleanup=verbatim", "-m", message); err != nil {
+			t.Fatalf("git commit failed: %v", err)
+		}
+		hash, _ := runGitCommand(ctx, repo, "rev-parse", "HEAD")
+		return strings.TrimSpace(hash)
+	}
+	original := commit("Subject\n\nBody  \n\nChange-Id: I0123\n")
+
+	tests := []struct {
+		name      string
+		rewritten string
+		diff      string
+	}{
+		{"kept", "Subject\n\nBody  \n\nChange-Id: I0123\n", ""},
+		{"trailer added", "Subject\n\nBody  \n\nChange-Id: I0123\nCo-authored-by: Alex <alex@example.com>\n", ""},
+		{"whitespace stripped", "Subject\n\nBody\n\nChange-Id: I0123\n", "- \"Body  \\n\"\n+ \"Body\\n\"\n"},
+		{"trailer removed", "Subject\n\nBody  \n", "- \"\\n\"\n- \"Change-Id: I0123\\n\"\n"},
+		{"text added", "Subject\n\nBody  \nMore text\n\nChange-Id: I0123\n", "+ \"More text\\n\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := CompareMessages(ctx, repo, original, commit(tt.rewritten))
+			if err != nil || diff != tt.diff {
+				t.Errorf("Expected diff %q, got %q (%v)", tt.diff, diff, err)
+			}
+		})
+	}
+}
+
+func TestUpdateCommitTimesEncodings(t *testing.T) {
+	const (
+		latin1Name    = "Jos\xe9 Mu\xf1oz"
+		latin1Message = "Caf\xe9 cr\xe8me\n\nR\xe9sum\xe9 of the na\xefve fa\xe7ade\n"
+	)
+	for _, header := range []string{Latin1, ""} {
+		for _, opts := range []ReplayOptions{{}, {RunHooks: true}, {PreserveAuthor: true}, {RunHooks: true, PreserveAuthor: true}, {Identity: Identity{Name: "René", Email: "rene@example.com"}}} {
+			t.Run(fmt.Sprintf("header=%q/runHooks=%t/preserveAuthor=%t", header, opts.RunHooks, opts.PreserveAuthor), func(t *testing.T) {
+				ctx := context.Background()
+				repo := initTestRepo(t, 1)
+				// git commit would convert Latin-1 text without an encoding header, as other tools may leave it, to UTF-8
+				tree, err := runGitCommand(ctx, repo, "rev-parse", "HEAD^{tree}")
+				if err != nil {
+					t.Fatal(err)
+				}
+				head, err := runGitCommand(ctx, repo, "rev-parse", "HEAD")
+				if err != nil {
+					t.Fatal(err)
+				}
+				object := fmt.Sprintf("tree %s\nparent %s\nauthor %s <test@example.com> 1700000000 +0000\ncommitter Test <test@example.com> 1700000000 +0000\n", strings.TrimSpace(tree), strings.TrimSpace(head), latin1Name)
+				if header != "" {
+					object += "encoding " + header + "\n"
+				}
+				path := filepath.Join(t.TempDir(), "commit")
+				if err := os.WriteFile(path, []byte(object+"\n"+latin1Message), 0644); err != nil {
+					t.Fatal(err)
+				}
+				hash, err := runGitCommand(ctx, repo, "hash-object", "-t", "commit", "-w", path)
+				if err != nil {
+					t.Fatalf("git hash-object failed: %v", err)
+				}
+				if _, err := runGitCommand(ctx, repo, "reset", "--quiet", "--soft", strings.TrimSpace(hash)); err != nil {
+					t.Fatal(err)
+				}
+				branch, err := GetCurrentBranch(ctx, repo)
+				if err != nil {
+					t.Fatalf("Failed to get current branch: %v", err)
+				}
+				parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+				if err != nil {
+					t.Fatalf("Failed to get parent: %v", err)
+				}
+				commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+				if err != nil || len(commits) != 1 {
+					t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+				}
+				if commits[0].Encoding != Latin1 || commits[0].Subject != "Café crème" || commits[0].Author != "José Muñoz" {
+					t.Fatalf("Expected the commit to be read as Latin-1, got encoding %q, subject %q and author %q", commits[0].Encoding, commits[0].Subject, commits[0].Author)
+				}
+
+				var newHash string
+				opts.OnReplay = func(commit Commit, result ReplayResult) { newHash = result.NewHash }
+				if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{time.Now()}, strings.TrimSpace(parent), branch, "rewrite-history", opts); err != nil {
+					t.Fatalf("UpdateCommitTimes failed: %v", err)
+				}
+
+				rewritten, err := readCommitObject(ctx, repo, newHash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// With a header the text is kept byte for byte, without one git stores it as UTF-8
+				want := func(text string) string {
+					if header == "" {
+						return decodeText(text, Latin1)
+					}
+					return text
+				}
+				if rewritten.Encoding != header {
+					t.Errorf("Expected encoding header %q, got %q", header, rewritten.Encoding)
+				}
+				if rewritten.Message != want(latin1Message) {
+					t.Errorf("Expected message %q, got %q", want(latin1Message), rewritten.Message)
+				}
+				raw, err := runGitCommand(ctx, repo, "cat-file", "commit", newHash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				author := "author Test <test@example.com>"
+				if opts.PreserveAuthor {
+					author = "author " + latin1Name + " <test@example.com>"
+				} else if opts.Identity.Name != "" {
+					author = "author Ren\xe9 <rene@example.com>"
+				}
+				if author = want(author); !strings.Contains(raw, "\n"+author+" ") {
+					t.Errorf("Expected %q in the rewritten commit, got\n%s", author, raw)
+				}
+			})
+		}
+	}
+}
+
+func TestUpdateCommitTimesHooks(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 2)
+
+	branch, err := GetCurrentBranch(ctx, repo)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	// A hook like lint-staged that rejects every commit
+	hook := filepath.Join(repo, ".git", "hooks", "pre-commit")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+
+	commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+	}
+	if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{time.Now()}, strings.TrimSpace(parent), branch, "rewrite-history", ReplayOptions{RunHooks: true}); err == nil {
+		t.Fatal("Expected the pre-commit hook to reject the rewrite when hooks run")
+	}
+
+	if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{time.Now()}, strings.TrimSpace(parent), branch, "rewrite-history", ReplayOptions{}); err != nil {
+		t.Errorf("Expected hooks to be skipped by default, got %v", err)
+	}
+}
+
+func TestUpdateCommitTimesReplayWorktree(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 3)
+
+	branch, err := GetCurrentBranch(ctx, repo)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~2")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	// The hook records where it ran
+	hook := filepath.Join(repo, ".git", "hooks", "pre-commit")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\npwd >> \"$(git rev-parse --git-common-dir)/hook-runs\"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "file1.txt"), []byte("uncommitted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	statusBefore, _ := runGitCommand(ctx, repo, "status", "--porcelain")
+
+	commits, err := getCommitsFirstParentWithMerges(ctx, repo, strings.TrimSpace(parent)+"..HEAD")
+	if err != nil || len(commits) != 2 {
+		t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+	}
+	slices.Reverse(commits)
+	newTime := time.Date(2024, 3, 4, 11, 0, 0, 0, time.UTC)
+	if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{newTime, newTime.Add(time.Hour)}, strings.TrimSpace(parent), branch, "rewrite-history", ReplayOptions{RunHooks: true}); err != nil {
+		t.Fatalf("UpdateCommitTimes failed: %v", err)
+	}
+
+	if date, _ := GetCommitTime(ctx, repo, "HEAD"); !date.Equal(newTime.Add(time.Hour)) {
+		t.Errorf("Expected HEAD at %s, got %s", newTime.Add(time.Hour), date)
+	}
+	if statusAfter, _ := runGitCommand(ctx, repo, "status", "--porcelain"); statusAfter != statusBefore {
+		t.Errorf("Expected the working tree to be untouched, status was\n%s\nand is\n%s", statusBefore, statusAfter)
+	}
+	runs, err := os.ReadFile(filepath.Join(repo, ".git", "hook-runs"))
+	if err != nil {
+		t.Fatalf("Expected the hook to run: %v", err)
+	}
+	for _, dir := range strings.Fields(string(runs)) {
+		if resolved, _ := filepath.EvalSymlinks(repo); dir == repo || dir == resolved {
+			t.Errorf("Expected the hook to run in a temporary worktree, it ran in %s", dir)
+		}
+	}
+	if worktrees, _ := runGitCommand(ctx, repo, "worktree", "list", "--porcelain"); strings.Count(worktrees, "worktree ") != 1 {
+		t.Errorf("Expected the temporary worktree to be removed, got\n%s", worktrees)
+	}
+	if _, err := runGitCommand(ctx, repo, "rev-parse", "--verify", "--quiet", "refs/heads/rewrite-history"); err == nil {
+		t.Error("Expected the rewrite branch to be deleted")
+	}
+}
+
+func TestUpdateCommitTimesSignOff(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 2)
+
+	branch, err := GetCurrentBranch(ctx, repo)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	existing := "Signed-off-by: Other Dev <other@example.com>"
+	if _, err := runGitCommand(ctx, repo, "commit", "-q", "--amend", "-m", "Commit 1\n\n"+existing); err != nil {
+		t.Fatalf("Failed to amend: %v", err)
+	}
+
+	// The first rewrite replaces the message, which must not lose the existing sign-off; the second must not
+	// sign off twice
+	opts := ReplayOptions{
+		Identity: Identity{Name: "Dev", Email: "dev@example.com"},
+		SignOff:  true,
+		Message:  func(commit Commit, message string) (string, error) { return "Rewritten", nil },
+	}
+	for i := 0; i < 2; i++ {
+		commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+		if err != nil || len(commits) != 1 {
+			t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+		}
+		if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{time.Now()}, strings.TrimSpace(parent), branch, "rewrite-history", opts); err != nil {
+			t.Fatalf("UpdateCommitTimes failed: %v", err)
+		}
+		opts.Message = nil
+	}
+
+	message, err := GetCommitMessage(ctx, repo, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to get commit message: %v", err)
+	}
+	expected := "Rewritten\n\n" + existing + "\nSigned-off-by: Dev <dev@example.com>"
+	if strings.TrimSpace(message) != expected {
+		t.Errorf("Expected message %q, got %q", expected, message)
+	}
+}
+
+func TestUpdateCommitTimesOriginalDates(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 2)
+
+	branch, err := GetCurrentBranch(ctx, repo)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	authorDate, committerDate, err := GetCommitDates(ctx, repo, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to get commit dates: %v", err)
+	}
+
+	// The second rewrite must keep the dates recorded by the first, not the ones it gave the commit
+	opts := ReplayOptions{OriginalDates: true}
+	for i := 0; i < 2; i++ {
+		commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+		if err != nil || len(commits) != 1 {
+			t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+		}
+		newTime := time.Date(2024, 2, 1+i, 10, 0, 0, 0, time.UTC)
+		if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{newTime}, strings.TrimSpace(parent), branch, "rewrite-history", opts); err != nil {
+			t.Fatalf("UpdateCommitTimes failed: %v", err)
+		}
+	}
+
+	message, err := GetCommitMessage(ctx, repo, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to get commit message: %v", err)
+	}
+	expected := "Commit 1\n\n" +
+		OriginalDateTrailer + ": " + authorDate.Format(time.RFC3339) + "\n" +
+		OriginalCommitterDateTrailer + ": " + committerDate.Format(time.RFC3339)
+	if strings.TrimSpace(message) != expected {
+		t.Errorf("Expected message %q, got %q", expected, message)
+	}
+}
+
+func TestNotes(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 2)
+	const ref = "refs/notes/test"
+
+	head, err := runGitCommand(ctx, repo, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to resolve HEAD: %v", err)
+	}
+	head = strings.TrimSpace(head)
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to resolve HEAD~1: %v", err)
+	}
+	parent = strings.TrimSpace(parent)
+
+	// Adding a note twice replaces it
+	for _, message := range []string{"first", "Key: value\nOther: line"} {
+		if err := AddNote(ctx, repo, ref, head, message, Identity{Name: "Notes", Email: "notes@example.com"}); err != nil {
+			t.Fatalf("AddNote failed: %v", err)
+		}
+	}
+
+	notes, err := GetNotes(ctx, repo, ref, []string{head, parent})
+	if err != nil {
+		t.Fatalf("GetNotes failed: %v", err)
+	}
+	if len(notes) != 1 || strings.TrimSpace(notes[head]) != "Key: value\nOther: line" {
+		t.Errorf("Expected only the note of %s, got %q", head, notes)
+	}
+
+	author, err := runGitCommand(ctx, repo, "log", "-1", "--format=%an <%ae>", ref)
+	if err != nil || strings.TrimSpace(author) != "Notes <notes@example.com>" {
+		t.Errorf("Expected the notes commit to be made by the given identity, got %q (%v)", author, err)
+	}
+}
+
+func TestUpdateCommitTimesMessage(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 2)
+
+	branch, err := GetCurrentBranch(ctx, repo)
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+	}
+
+	opts := ReplayOptions{Message: func(commit Commit, message string) (string, error) {
+		return "PROJ-1: " + message, nil
+	}}
+	if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{time.Now()}, strings.TrimSpace(parent), branch, "rewrite-history", opts); err != nil {
+		t.Fatalf("UpdateCommitTimes failed: %v", err)
+	}
+
+	message, err := GetCommitMessage(ctx, repo, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to get commit message: %v", err)
+	}
+	if strings.TrimSpace(message) != "PROJ-1: Commit 1" {
+		t.Errorf("Expected rewritten message, got %q", message)
+	}
+}
+
+func TestGetEmptyTree(t *testing.T) {
+	ctx := context.Background()
+	for _, format := range []string{"sha1", "sha256"} {
+		repo := t.TempDir()
+		if _, err := runGitCommand(ctx, repo, "init", "--quiet", "--object-format="+format); err != nil {
+			t.Fatalf("git init failed: %v", err)
+		}
+		cmd := exec.Command("git", "hash-object", "-t", "tree", "--stdin")
+		cmd.Dir = repo
+		expected, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git hash-object failed: %v", err)
+		}
+
+		if emptyTree, err := GetEmptyTree(ctx, repo); err != nil || emptyTree != strings.TrimSpace(string(expected)) {
+			t.Errorf("Expected the %s empty tree %s, got %s (%v)", format, strings.TrimSpace(string(expected)), emptyTree, err)
+		}
+	}
+}
+
+func TestUpdateCommitTimesRootCommit(t *testing.T) {
+	for _, format := range []string{"sha1", "sha256"} {
+		for _, runHooks := range []bool{false, true} {
+			for _, commitCount := range []int{1, 3} {
+				t.Run(fmt.Sprintf("%s/runHooks=%t/commits=%d", format, runHooks, commitCount), func(t *testing.T) {
+					ctx := context.Background()
+					repo := t.TempDir()
+					for _, args := range [][]string{{"init", "--quiet", "--object-format=" + format}, {"config", "user.name", "Test"}, {"config", "user.email", "test@example.com"}} {
+						if _, err := runGitCommand(ctx, repo, args...); err != nil {
+							t.Fatalf("git %v failed: %v", args, err)
+						}
+					}
+					for i := 0; i < commitCount; i++ {
+						fileName := fmt.Sprintf("file%d.txt", i)
+						if err := os.WriteFile(filepath.Join(repo, fileName), []byte(fileName), 0644); err != nil {
+							t.Fatal(err)
+						}
+						if _, err := runGitCommand(ctx, repo, "add", fileName); err != nil {
+							t.Fatalf("git add failed: %v", err)
+						}
+						if _, err := runGitCommand(ctx, repo, "commit", "--quiet", "-m", fmt.Sprintf("Commit %d", i)); err != nil {
+							t.Fatalf("git commit failed: %v", err)
+						}
+					}
+					trees, _ := runGitCommand(ctx, repo, "log", "--format=%T")
+
+					branch, err := GetCurrentBranch(ctx, repo)
+					if err != nil {
+						t.Fatalf("Failed to get current branch: %v", err)
+					}
+					commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD")
+					if err != nil || len(commits) != commitCount {
+						t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+					}
+					slices.Reverse(commits)
+					if len(commits[0].Parents) != 0 {
+						t.Fatalf("Expected the oldest commit to be the root, got parents %v", commits[0].Parents)
+					}
+					newTimes := make([]time.Time, commitCount)
+					for i := range newTimes {
+						newTimes[i] = time.Date(2024, 3, 4, 10+i, 0, 0, 0, time.UTC)
+					}
+
+					updated, err := UpdateCommitTimes(ctx, repo, commits, newTimes, "", branch, "rewrite-history", ReplayOptions{RunHooks: runHooks})
+					if err != nil || updated != commitCount {
+						t.Fatalf("Expected %d commits to be rewritten, got %d (%v)", commitCount, updated, err)
+					}
+
+					history, err := runGitCommand(ctx, repo, "log", "--format=%at %P")
+					if err != nil {
+						t.Fatalf("git log failed: %v", err)
+					}
+					lines := strings.Split(strings.TrimSpace(history), "\n")
+					if len(lines) != commitCount {
+						t.Fatalf("Expected %d commits in history, got\n%s", commitCount, history)
+					}
+					if root := strings.Fields(lines[len(lines)-1]); len(root) != 1 || root[0] != strconv.FormatInt(newTimes[0].Unix(), 10) {
+						t.Errorf("Expected a new root commit at %s without parents, got %q", newTimes[0], lines[len(lines)-1])
+					}
+					if date := strings.Fields(lines[0])[0]; date != strconv.FormatInt(newTimes[commitCount-1].Unix(), 10) {
+						t.Errorf("Expected HEAD at %s, got %s", newTimes[commitCount-1], date)
+					}
+					if rewrittenTrees, _ := runGitCommand(ctx, repo, "log", "--format=%T"); rewrittenTrees != trees {
+						t.Errorf("Expected the trees to be unchanged, got\n%s\ninstead of\n%s", rewrittenTrees, trees)
+					}
+					if status, _ := runGitCommand(ctx, repo, "status", "--porcelain"); status != "" {
+						t.Errorf("Expected a clean working tree, got\n%s", status)
+					}
+					if worktrees, _ := runGitCommand(ctx, repo, "worktree", "list", "--porcelain"); strings.Count(worktrees, "worktree ") != 1 {
+						t.Errorf("Expected the temporary worktree to be removed, got\n%s", worktrees)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestUpdateCommitTimesEmptyRootCommit(t *testing.T) {
+	for _, runHooks := range []bool{false, true} {
+		t.Run(fmt.Sprintf("runHooks=%t", runHooks), func(t *testing.T) {
+			ctx := context.Background()
+			repo := t.TempDir()
+			for _, args := range [][]string{{"init", "--quiet"}, {"config", "user.name", "Test"}, {"config", "user.email", "test@example.com"}, {"commit", "--quiet", "--allow-empty", "-m", "Initial commit"}} {
+				if _, err := runGitCommand(ctx, repo, args...); err != nil {
+					t.Fatalf("git %v failed: %v", args, err)
+				}
+			}
+			branch, err := GetCurrentBranch(ctx, repo)
+			if err != nil {
+				t.Fatalf("Failed to get current branch: %v", err)
+			}
+			commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD")
+			if err != nil || len(commits) != 1 {
+				t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+			}
+
+			var status ReplayStatus
+			opts := ReplayOptions{RunHooks: runHooks, DropEmpty: true, OnReplay: func(commit Commit, result ReplayResult) {
+				status = result.Status
+			}}
+			if _, err := UpdateCommitTimes(ctx, repo, commits, []time.Time{time.Now()}, "", branch, "rewrite-history", opts); err != nil {
+				t.Fatalf("UpdateCommitTimes failed: %v", err)
+			}
+			if status != ReplayKeptEmpty {
+				t.Errorf("Expected the empty root commit to be kept even when dropping empty commits, got %v", status)
+			}
+			if subjects, _ := runGitCommand(ctx, repo, "log", "--format=%s"); strings.TrimSpace(subjects) != "Initial commit" {
+				t.Errorf("Expected the root commit to stay in history, got %q", subjects)
+			}
+		})
+	}
+}
+
+func TestUpdateCommitTimesResolvedMergeConflict(t *testing.T) {
+	for _, runHooks := range []bool{false, true} {
+		t.Run(fmt.Sprintf("runHooks=%t", runHooks), func(t *testing.T) {
+			ctx := context.Background()
+			repo := initTestRepo(t, 1)
+			branch, err := GetCurrentBranch(ctx, repo)
+			if err != nil {
+				t.Fatalf("Failed to get current branch: %v", err)
+			}
+			base, err := runGitCommand(ctx, repo, "rev-parse", "HEAD")
+			if err != nil {
+				t.Fatalf("Failed to get base: %v", err)
+			}
+			commitFile := func(content string, message string) {
+				t.Helper()
+				if err := os.WriteFile(filepath.Join(repo, "file0.txt"), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+				for _, args := range [][]string{{"add", "file0.txt"}, {"commit", "--quiet", "-m", message}} {
+					if _, err := runGitCommand(ctx, repo, args...); err != nil {
+						t.Fatalf("git %v failed: %v", args, err)
+					}
+				}
+			}
+
+			// Both branches change the same line, and the conflict of the merge is resolved by hand
+			if _, err := runGitCommand(ctx, repo, "checkout", "--quiet", "-b", "feature"); err != nil {
+				t.Fatalf("git checkout failed: %v", err)
+			}
+			commitFile("feature", "Feature change")
+			if _, err := runGitCommand(ctx, repo, "checkout", "--quiet", branch); err != nil {
+				t.Fatalf("git checkout failed: %v", err)
+			}
+			commitFile("main", "Main change")
+			if _, err := runGitCommand(ctx, repo, "merge", "feature"); err == nil {
+				t.Fatal("Expected the merge to conflict")
+			}
+			commitFile("resolved", "Merge branch 'feature'")
+
+			merge, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+			if err != nil || len(merge) != 1 || !merge[0].IsMerge {
+				t.Fatalf("Failed to get the merge: %v (%v)", err, merge)
+			}
+			mainChange, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~2..HEAD~1")
+			if err != nil || len(mainChange) != 1 {
+				t.Fatalf("Failed to get the main change: %v (%v)", err, mainChange)
+			}
+			side, err := GetSideBranchCommits(ctx, repo, merge[0])
+			if err != nil || len(side) != 1 {
+				t.Fatalf("Failed to get the side branch: %v (%v)", err, side)
+			}
+			commits := []Commit{mainChange[0], side[0], merge[0]}
+			newTime := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+			newTimes := []time.Time{newTime, newTime.Add(time.Hour), newTime.Add(2 * time.Hour)}
+
+			updated, err := UpdateCommitTimes(ctx, repo, commits, newTimes, strings.TrimSpace(base), branch, "rewrite-history", ReplayOptions{RunHooks: runHooks})
+			if err != nil || updated != 3 {
+				t.Fatalf("Expected the rewrite to go through without conflicts, got %d commits rewritten (%v)", updated, err)
+			}
+
+			if content, _ := runGitCommand(ctx, repo, "show", "HEAD:file0.txt"); content != "resolved" {
+				t.Errorf("Expected the merge to keep its resolution, got %q", content)
+			}
+			parents, _ := runGitCommand(ctx, repo, "log", "-1", "--format=%P", "HEAD")
+			if fields := strings.Fields(parents); len(fields) != 2 || fields[1] == side[0].Hash {
+				t.Errorf("Expected the merge to be recreated against the rewritten side branch, got parents %q", parents)
+			}
+			if subject, _ := runGitCommand(ctx, repo, "log", "-1", "--format=%s", "HEAD"); strings.TrimSpace(subject) != "Merge branch 'feature'" {
+				t.Errorf("Expected the merge to keep its message, got %q", subject)
+			}
+			if status, _ := runGitCommand(ctx, repo, "status", "--porcelain"); status != "" {
+				t.Errorf("Expected a clean working tree, got\n%s", status)
+			}
+		})
+	}
+}
+
+func TestUpdateCommitTimesDroppedSideBranchCommit(t *testing.T) {
+	// The side branch commits, oldest first; the empty one is dropped
+	branches := map[string][]string{
+		"only":  {"Empty"},
+		"first": {"Empty", "Feature change"},
+		"tip":   {"Feature change", "Empty"},
+	}
+	for _, runHooks := range []bool{false, true} {
+		for name, sideCommits := range branches {
+			t.Run(fmt.Sprintf("runHooks=%t/%s", runHooks, name), func(t *testing.T) {
+				ctx := context.Background()
+				repo := initTestRepo(t, 1)
+				branch, err := GetCurrentBranch(ctx, repo)
+				if err != nil {
+					t.Fatalf("Failed to get current branch: %v", err)
+				}
+				base, err := runGitCommand(ctx, repo, "rev-parse", "HEAD")
+				if err != nil {
+					t.Fatalf("Failed to get base: %v", err)
+				}
+				git := func(args ...string) {
+					t.Helper()
+					if _, err := runGitCommand(ctx, repo, args...); err != nil {
+						t.Fatalf("git %v failed: %v", args, err)
+					}
+				}
+				commitFile := func(name string, message string) {
+					t.Helper()
+					if err := os.WriteFile(filepath.Join(repo, name), []byte(name), 0644); err != nil {
+						t.Fatal(err)
+					}
+					git("add", name)
+					git("commit", "--quiet", "-m", message)
+				}
+
+				git("checkout", "--quiet", "-b", "feature")
+				for _, subject := range sideCommits {
+					if subject == "Empty" {
+						git("commit", "--quiet", "--allow-empty", "-m", subject)
+					} else {
+						commitFile("feature.txt", subject)
+					}
+				}
+				git("checkout", "--quiet", branch)
+				commitFile("main.txt", "Main change")
+				git("merge", "--quiet", "--no-ff", "-m", "Merge branch 'feature'", "feature")
+
+				merge, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+				if err != nil || len(merge) != 1 || !merge[0].IsMerge {
+					t.Fatalf("Failed to get the merge: %v (%v)", err, merge)
+				}
+				mainChange, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~2..HEAD~1")
+				if err != nil || len(mainChange) != 1 {
+					t.Fatalf("Failed to get the main change: %v (%v)", err, mainChange)
+				}
+				side, err := GetSideBranchCommits(ctx, repo, merge[0])
+				if err != nil || len(side) != len(sideCommits) {
+					t.Fatalf("Failed to get the side branch: %v (%v)", err, side)
+				}
+				slices.Reverse(side)
+				commits := append(append([]Commit{mainChange[0]}, side...), merge[0])
+				newTimes := make([]time.Time, len(commits))
+				for i := range newTimes {
+					newTimes[i] = time.Date(2024, 3, 4, 10+i, 0, 0, 0, time.UTC)
+				}
+
+				opts := ReplayOptions{RunHooks: runHooks, DropEmpty: true}
+				if _, err := UpdateCommitTimes(ctx, repo, commits, newTimes, strings.TrimSpace(base), branch, "rewrite-history", opts); err != nil {
+					t.Fatalf("UpdateCommitTimes failed: %v", err)
+				}
+
+				// Without its empty commit the side branch ends at the feature change, or at the base when nothing is left
+				expectedTip := strings.TrimSpace(base)
+				if len(sideCommits) > 1 {
+					expectedTip = "Feature change"
+				}
+				if _, err := runGitCommand(ctx, repo, "merge-base", "--is-ancestor", "HEAD^1", "HEAD^2"); err == nil {
+					t.Error("Expected the recreated merge to keep the side branch off the main line")
+				}
+				if tip, _ := runGitCommand(ctx, repo, "log", "-1", "--format=%H %s", "HEAD^2"); !strings.Contains(tip, expectedTip) {
+					t.Errorf("Expected the side branch to end at %s, got %q", expectedTip, tip)
+				}
+			})
+		}
+	}
+}
+
+func TestUpdateCommitTimesEmptyCommits(t *testing.T) {
+	for _, dropEmpty := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dropEmpty=%t", dropEmpty), func(t *testing.T) {
+			ctx := context.Background()
+			repo := initTestRepo(t, 1)
+
+			if _, err := runGitCommand(ctx, repo, "commit", "--allow-empty", "-m", "Empty"); err != nil {
+				t.Fatalf("git commit failed: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(repo, "after.txt"), []byte("after"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if _, err := runGitCommand(ctx, repo, "add", "after.txt"); err != nil {
+				t.Fatalf("git add failed: %v", err)
+			}
+			if _, err := runGitCommand(ctx, repo, "commit", "-m", "After"); err != nil {
+				t.Fatalf("git commit failed: %v", err)
+			}
+
+			branch, err := GetCurrentBranch(ctx, repo)
+			if err != nil {
+				t.Fatalf("Failed to get current branch: %v", err)
+			}
+			parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~2")
+			if err != nil {
+				t.Fatalf("Failed to get parent: %v", err)
+			}
+			commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~2..HEAD")
+			if err != nil || len(commits) != 2 {
+				t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+			}
+			commits[0], commits[1] = commits[1], commits[0] // oldest first
+
+			statuses := map[string]ReplayStatus{}
+			opts := ReplayOptions{DropEmpty: dropEmpty, OnReplay: func(commit Commit, result ReplayResult) {
+				statuses[commit.Subject] = result.Status
+			}}
+			times := []time.Time{time.Now().Add(-time.Hour), time.Now()}
+			updated, err := UpdateCommitTimes(ctx, repo, commits, times, strings.TrimSpace(parent), branch, "rewrite-history", opts)
+			if err != nil {
+				t.Fatalf("UpdateCommitTimes failed: %v", err)
+			}
+
+			subjects, err := runGitCommand(ctx, repo, "log", "--format=%s")
+			if err != nil {
+				t.Fatalf("git log failed: %v", err)
+			}
+			if dropEmpty {
+				if updated != 1 || statuses["Empty"] != ReplayDropped || statuses["After"] != ReplayRewritten {
+					t.Errorf("Expected the empty commit to be dropped, got %d updated and %v", updated, statuses)
+				}
+				if strings.Fields(subjects)[1] != "Commit" {
+					t.Errorf("Expected the empty commit to be gone from history, got %q", subjects)
+				}
+			} else {
+				if updated != 2 || statuses["Empty"] != ReplayKeptEmpty || statuses["After"] != ReplayRewritten {
+					t.Errorf("Expected the empty commit to be kept, got %d updated and %v", updated, statuses)
+				}
+				if strings.Fields(subjects)[1] != "Empty" {
+					t.Errorf("Expected the empty commit to stay in history, got %q", subjects)
+				}
+			}
+		})
+	}
+}
+
+func TestAmendHead(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 2)
+
+	commits, err := getCommitsFirstParentWithMerges(ctx, repo, "HEAD~1..HEAD")
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("Failed to get commits: %v (%d commits)", err, len(commits))
+	}
+	parent, err := runGitCommand(ctx, repo, "rev-parse", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+
+	// Staged changes would end up in the amended commit
+	if err := os.WriteFile(filepath.Join(repo, "staged.txt"), []byte("staged"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if _, err := runGitCommand(ctx, repo, "add", "staged.txt"); err != nil {
+		t.Fatalf("git add failed: %v", err)
+	}
+	newTime := time.Date(2024, 1, 2, 17, 42, 0, 0, time.FixedZone("", 2*60*60))
+	if _, err := AmendHead(ctx, repo, commits[0], newTime, ReplayOptions{}); err == nil {
+		t.Fatal("Expected staged changes to be refused")
+	}
+	if _, err := runGitCommand(ctx, repo, "reset", "-q"); err != nil {
+		t.Fatalf("git reset failed: %v", err)
+	}
+
+	newHash, err := AmendHead(ctx, repo, commits[0], newTime, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("AmendHead failed: %v", err)
+	}
+	output, err := runGitCommand(ctx, repo, "log", "-1", "--date=iso", "--format=%H|%P|%ad|%cd|%s")
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	parts := strings.Split(strings.TrimSpace(output), "|")
+	if parts[0] != newHash || parts[1] != strings.TrimSpace(parent) {
+		t.Errorf("Expected HEAD %s on parent %s, got %v", newHash, strings.TrimSpace(parent), parts[:2])
+	}
+	if want := newTime.Format(DateTimeLayout); parts[2] != want || parts[3] != want {
+		t.Errorf("Expected author and committer date %s, got %v", want, parts[2:4])
+	}
+	if parts[4] != "Commit 1" {
+		t.Errorf("Expected the message to be kept, got %q", parts[4])
+	}
+
+	if _, err := AmendHead(ctx, repo, commits[0], newTime, ReplayOptions{}); err == nil {
+		t.Error("Expected a commit that is no longer HEAD to be refused")
+	}
+}
+
+// initPartialClone returns a clone of a two-commit repository that was made with --filter=blob:none and no checkout,
+// so it has none of the files' contents
+func initPartialClone(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+	upstream := initTestRepo(t, 2)
+	if _, err := runGitCommand(ctx, upstream, "config", "uploadpack.allowFilter", "true"); err != nil {
+		t.Fatalf("config failed: %v", err)
+	}
+	if _, err := runGitCommand(ctx, upstream, "config", "uploadpack.allowAnySHA1InWant", "true"); err != nil {
+		t.Fatalf("config failed: %v", err)
+	}
+	clone := filepath.Join(t.TempDir(), "clone")
+	if _, err := runGitCommand(ctx, filepath.Dir(clone), "clone", "-q", "--no-checkout", "--filter=blob:none", "file://"+filepath.ToSlash(upstream), clone); err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+	return clone
+}
+
+func TestPromisorRemote(t *testing.T) {
+	ctx := context.Background()
+
+	remote, err := PromisorRemote(ctx, initTestRepo(t, 1))
+	if err != nil || remote != "" {
+		t.Errorf("Expected no promisor remote in a complete repository, got %q (%v)", remote, err)
+	}
+
+	remote, err = PromisorRemote(ctx, initPartialClone(t))
+	if err != nil || remote != "origin" {
+		t.Errorf("Expected origin as the promisor remote of a partial clone, got %q (%v)", remote, err)
+	}
+}
+
+func TestFetchObjects(t *testing.T) {
+	ctx := context.Background()
+	clone := initPartialClone(t)
+
+	missing, err := GetMissingObjects(ctx, clone, "HEAD")
+	if err != nil {
+		t.Fatalf("GetMissingObjects failed: %v", err)
+	}
+	if len(missing) != 2 {
+		t.Fatalf("Expected the 2 files' contents to be missing, got %v", missing)
+	}
+
+	// Only the newest commit's own file
+	missing, err = GetMissingObjects(ctx, clone, "HEAD", "^HEAD~1")
+	if err != nil || len(missing) != 1 {
+		t.Fatalf("Expected 1 missing object in HEAD~1..HEAD, got %v (%v)", missing, err)
+	}
+
+	if err := FetchObjects(ctx, clone, "origin", missing); err != nil {
+		t.Fatalf("FetchObjects failed: %v", err)
+	}
+	if missing, err = GetMissingObjects(ctx, clone, "HEAD", "^HEAD~1"); err != nil || len(missing) != 0 {
+		t.Errorf("Expected no missing objects after fetching, got %v (%v)", missing, err)
+	}
+	if missing, err = GetMissingObjects(ctx, clone, "HEAD"); err != nil || len(missing) != 1 {
+		t.Errorf("Expected the older file to still be missing, got %v (%v)", missing, err)
+	}
+}
+
+func TestSparseCheckout(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 1)
+	if err := os.MkdirAll(filepath.Join(repo, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "docs", "guide.md"), []byte("guide"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGitCommand(ctx, repo, "add", "docs"); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if _, err := runGitCommand(ctx, repo, "commit", "-q", "-m", "Add docs"); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	if sparse, err := GetSparseCheckout(ctx, repo); err != nil || sparse.Enabled {
+		t.Fatalf("Expected sparse checkout to be disabled, got %+v (%v)", sparse, err)
+	}
+
+	if _, err := runGitCommand(ctx, repo, "sparse-checkout", "set", "--cone", "src"); err != nil {
+		t.Fatalf("sparse-checkout set failed: %v", err)
+	}
+	sparse, err := GetSparseCheckout(ctx, repo)
+	if err != nil {
+		t.Fatalf("GetSparseCheckout failed: %v", err)
+	}
+	if !sparse.Enabled || !sparse.Cone || !strings.Contains(sparse.Patterns, "/src/") {
+		t.Fatalf("Expected cone mode with src, got %+v", sparse)
+	}
+
+	if _, err := runGitCommand(ctx, repo, "sparse-checkout", "disable"); err != nil {
+		t.Fatalf("sparse-checkout disable failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "docs", "guide.md")); err != nil {
+		t.Fatalf("Expected docs to be checked out without sparse checkout: %v", err)
+	}
+	if err := RestoreSparseCheckout(ctx, repo, sparse); err != nil {
+		t.Fatalf("RestoreSparseCheckout failed: %v", err)
+	}
+	if restored, err := GetSparseCheckout(ctx, repo); err != nil || restored != sparse {
+		t.Errorf("Expected %+v to be restored, got %+v (%v)", sparse, restored, err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "docs", "guide.md")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected docs to be removed from the work tree again, got %v", err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+	upstream := initTestRepo(t, 2)
+	clone := filepath.Join(t.TempDir(), "clone")
+	if _, err := runGitCommand(ctx, filepath.Dir(clone), "clone", "-q", upstream, clone); err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+
+	if _, err := runGitCommand(ctx, upstream, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "New upstream commit"); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	head, err := GetHeadCommit(ctx, upstream)
+	if err != nil {
+		t.Fatalf("Failed to get upstream HEAD: %v", err)
+	}
+
+	if err := Fetch(ctx, clone); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	fetched, err := runGitCommand(ctx, clone, "rev-parse", "origin/HEAD")
+	if err != nil {
+		t.Fatalf("rev-parse failed: %v", err)
+	}
+	if strings.TrimSpace(fetched) != head {
+		t.Errorf("Expected origin/HEAD to be %s after fetching, got %s", head, strings.TrimSpace(fetched))
+	}
+
+	if _, err := runGitCommand(ctx, clone, "remote", "set-url", "origin", filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Fatalf("set-url failed: %v", err)
+	}
+	if err := Fetch(ctx, clone); err == nil {
+		t.Error("Expected fetching from a missing remote to fail")
+	}
+}
+
+func TestGetUpstreamOnlyCommits(t *testing.T) {
+	ctx := context.Background()
+	upstream := initTestRepo(t, 2)
+	clone := filepath.Join(t.TempDir(), "clone")
+	if _, err := runGitCommand(ctx, filepath.Dir(clone), "clone", "-q", upstream, clone); err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+
+	ref, count, err := GetUpstreamOnlyCommits(ctx, clone)
+	if err != nil || ref == "" || count != 0 {
+		t.Fatalf("Expected an up-to-date upstream, got %q %d (%v)", ref, count, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := runGitCommand(ctx, upstream, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "Coworker commit"); err != nil {
+			t.Fatalf("commit failed: %v", err)
+		}
+	}
+	if err := Fetch(ctx, clone); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	ref, count, err = GetUpstreamOnlyCommits(ctx, clone)
+	if err != nil {
+		t.Fatalf("GetUpstreamOnlyCommits failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 commits only on %s, got %d", ref, count)
+	}
+
+	// A branch without an upstream or a remote namesake has nothing to diverge from
+	if _, err := runGitCommand(ctx, clone, "switch", "-q", "-c", "local-only"); err != nil {
+		t.Fatalf("switch failed: %v", err)
+	}
+	if ref, count, err := GetUpstreamOnlyCommits(ctx, clone); err != nil || ref != "" || count != 0 {
+		t.Errorf("Expected no remote branch, got %q %d (%v)", ref, count, err)
+	}
+}
+
+func TestGetCommitsTouchingPaths(t *testing.T) {
+	ctx := context.Background()
+	repoPath := initTestRepo(t, 3)
+	if err := os.MkdirAll(filepath.Join(repoPath, "src", "billing"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, "src", "billing", "invoice.go"), []byte("package billing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGitCommand(ctx, repoPath, "add", "."); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if _, err := runGitCommand(ctx, repoPath, "commit", "-q", "-m", "Add invoices"); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	output, err := runGitCommand(ctx, repoPath, "log", "--format=%h")
+	if err != nil {
+		t.Fatalf("log failed: %v", err)
+	}
+	hashes := strings.Fields(output) // newest first: invoices, Commit 2, Commit 1, Commit 0
+
+	tests := []struct {
+		pathspecs []string
+		expected  []string
+	}{
+		{[]string{"src/**"}, []string{hashes[0]}},
+		{[]string{"src/billing"}, []string{hashes[0]}},
+		{[]string{"file0.txt", "file2.txt"}, []string{hashes[1], hashes[3]}},
+		{[]string{"docs"}, nil},
+	}
+	for _, test := range tests {
+		touching, err := GetCommitsTouchingPaths(ctx, repoPath, hashes, test.pathspecs)
+		if err != nil {
+			t.Fatalf("GetCommitsTouchingPaths(%v) failed: %v", test.pathspecs, err)
+		}
+		if len(touching) != len(test.expected) {
+			t.Errorf("GetCommitsTouchingPaths(%v) = %v, expected %v", test.pathspecs, touching, test.expected)
+		}
+		for _, hash := range test.expected {
+			if !touching[hash] {
+				t.Errorf("GetCommitsTouchingPaths(%v) is missing %s", test.pathspecs, hash)
+			}
+		}
+	}
+}
+
+func TestCountObjects(t *testing.T) {
+	ctx := context.Background()
+	repoPath := initTestRepo(t, 3)
+
+	// A blob, a tree and a commit for every commit
+	counts, err := CountObjects(ctx, repoPath)
+	if err != nil {
+		t.Fatalf("CountObjects failed: %v", err)
+	}
+	if counts.Loose != 9 || counts.LooseSize == 0 || counts.Packs != 0 || counts.NeedsRepack() {
+		t.Errorf("Expected 9 loose objects and no packs, got %+v", counts)
+	}
+
+	if err := GC(ctx, repoPath); err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if counts, err = CountObjects(ctx, repoPath); err != nil || counts.Loose != 0 || counts.InPack != 9 || counts.Packs != 1 {
+		t.Errorf("Expected all 9 objects in a single pack, got %+v (%v)", counts, err)
+	}
+
+	if !(ObjectCounts{Loose: LooseObjectLimit + 1}).NeedsRepack() || !(ObjectCounts{Packs: PackLimit + 1}).NeedsRepack() {
+		t.Error("Expected too many loose objects or packs to need a repack")
+	}
+}
+
+func TestParseExpiryDays(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int
+		ok       bool
+	}{
+		{"90.days.ago", 90, true},
+		{"2 weeks ago", 14, true},
+		{"3.months", 90, true},
+		{"1.year.ago", 365, true},
+		{"Never", math.MaxInt, true},
+		{"false", math.MaxInt, true},
+		{"now", 0, true},
+		{"2024-01-01", 0, false},
+		{"90.fortnights.ago", 0, false},
+	}
+	for _, test := range tests {
+		if days, ok := parseExpiryDays(test.value); days != test.expected || ok != test.ok {
+			t.Errorf("parseExpiryDays(%q) = %d, %v, expected %d, %v", test.value, days, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestEnsureReflogRetention(t *testing.T) {
+	ctx := context.Background()
+	repoPath := initTestRepo(t, 1)
+
+	// The defaults of 90 and 30 days are raised only where they are shorter
+	changed, err := EnsureReflogRetention(ctx, repoPath, 60)
+	if err != nil || !slices.Equal(changed, []string{"gc.reflogExpireUnreachable"}) {
+		t.Fatalf("Expected only gc.reflogExpireUnreachable to change, got %v (%v)", changed, err)
+	}
+	if value, _ := GetConfigValue(ctx, repoPath, "gc.reflogExpireUnreachable"); value != "60.days.ago" {
+		t.Errorf("Expected 60.days.ago, got %q", value)
+	}
+	if changed, err := EnsureReflogRetention(ctx, repoPath, 60); err != nil || len(changed) != 0 {
+		t.Errorf("Expected nothing left to change, got %v (%v)", changed, err)
+	}
+
+	// Longer and unknown values are kept
+	if err := SetConfigValues(ctx, repoPath, "gc.reflogExpire", []string{"never"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfigValues(ctx, repoPath, "gc.reflogExpireUnreachable", []string{"2024-01-01"}); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := EnsureReflogRetention(ctx, repoPath, 365); err != nil || len(changed) != 0 {
+		t.Errorf("Expected never and a date to be left alone, got %v (%v)", changed, err)
+	}
+}
+
+func TestGetTrackingStatus(t *testing.T) {
+	ctx := context.Background()
+	upstream := initTestRepo(t, 2)
+	clone := filepath.Join(t.TempDir(), "clone")
+	if _, err := runGitCommand(ctx, filepath.Dir(clone), "clone", "-q", upstream, clone); err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+
+	commit := func(repo string, message string) {
+		if _, err := runGitCommand(ctx, repo, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", message); err != nil {
+			t.Fatalf("commit failed: %v", err)
+		}
+	}
+	commit(clone, "Local commit")
+	commit(upstream, "Coworker commit 1")
+	commit(upstream, "Coworker commit 2")
+	if err := Fetch(ctx, clone); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	status, err := GetTrackingStatus(ctx, clone)
+	if err != nil {
+		t.Fatalf("GetTrackingStatus failed: %v", err)
+	}
+	if status.Upstream != "origin/"+status.Branch || status.Ahead != 1 || status.Behind != 2 {
+		t.Errorf("Expected 1 ahead and 2 behind origin/%s, got %+v", status.Branch, status)
+	}
+
+	if _, err := runGitCommand(ctx, clone, "switch", "-q", "-c", "local-only"); err != nil {
+		t.Fatalf("switch failed: %v", err)
+	}
+	if status, err := GetTrackingStatus(ctx, clone); err != nil || status.Branch != "local-only" || status.Upstream != "" {
+		t.Errorf("Expected local-only without an upstream, got %+v (%v)", status, err)
+	}
+
+	if _, err := runGitCommand(ctx, clone, "switch", "-q", "--detach"); err != nil {
+		t.Fatalf("switch failed: %v", err)
+	}
+	if status, err := GetTrackingStatus(ctx, clone); err != nil || status.Branch != "" {
+		t.Errorf("Expected a detached HEAD, got %+v (%v)", status, err)
+	}
+}
+
+func TestGetWorkingTreeStatus(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 3)
+
+	status, err := GetWorkingTreeStatus(ctx, repo)
+	if err != nil || status != (WorkingTreeStatus{}) || status.Dirty() {
+		t.Fatalf("Expected a clean repository, got %+v (%v)", status, err)
+	}
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		if _, err := runGitCommand(ctx, repo, append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+
+	// Two stash entries, then file0 staged and modified again, file1 renamed, file2 modified and one untracked file
+	for i := 0; i < 2; i++ {
+		write("file0.txt", fmt.Sprintf("stashed %d", i))
+		git("stash", "-q")
+	}
+	write("file0.txt", "staged")
+	git("add", "file0.txt")
+	write("file0.txt", "modified after staging")
+	git("mv", "file1.txt", "renamed.txt")
+	write("file2.txt", "modified")
+	write("new.txt", "untracked")
+
+	status, err = GetWorkingTreeStatus(ctx, repo)
+	if err != nil {
+		t.Fatalf("GetWorkingTreeStatus failed: %v", err)
+	}
+	expected := WorkingTreeStatus{Staged: 2, Modified: 2, Untracked: 1, Stashes: 2}
+	if status != expected || !status.Dirty() {
+		t.Errorf("Expected %+v, got %+v", expected, status)
+	}
+}
+
+func TestGetCheckoutFilters(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 1)
+
+	filters, err := GetCheckoutFilters(ctx, repo)
+	if err != nil || len(filters) != 0 {
+		t.Fatalf("Expected no filters without .gitattributes, got %v (%v)", filters, err)
+	}
+
+	// lfs is configured, crypt is assigned but has no driver and is ignored by git
+	if err := os.MkdirAll(filepath.Join(repo, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".gitattributes"), []byte("*.psd filter=lfs diff=lfs merge=lfs -text\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "assets", ".gitattributes"), []byte("*.key filter=crypt\n*.bin filter=lfs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"config", "filter.lfs.process", "git-lfs filter-process"},
+		{"add", "."},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Track assets"},
+	} {
+		if _, err := runGitCommand(ctx, repo, args...); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+
+	filters, err = GetCheckoutFilters(ctx, repo)
+	if err != nil {
+		t.Fatalf("GetCheckoutFilters failed: %v", err)
+	}
+	if len(filters) != 1 || filters[0] != "lfs" {
+		t.Errorf("Expected [lfs], got %v", filters)
+	}
+}
+
+func TestGetHeadCommit(t *testing.T) {
+	repo := initTestRepo(t, 2)
+
+	head, err := GetHeadCommit(context.Background(), repo)
+	if err != nil {
+		t.Fatalf("GetHeadCommit failed: %v", err)
+	}
+	if len(head) != 40 {
+		t.Errorf("Expected full 40-character hash, got %q", head)
+	}
+
+	if _, err := GetHeadCommit(context.Background(), t.TempDir()); err == nil {
+		t.Error("Expected error outside a repository")
+	}
+}
+
+func TestResolveCommits(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 3)
+	output, err := runGitCommand(ctx, repo, "log", "--format=%H")
+	if err != nil {
+		t.Fatalf("log failed: %v", err)
+	}
+	expected := strings.Fields(output)
+
+	full, err := ResolveCommits(ctx, repo, []string{expected[2][:7], expected[0], expected[1][:10]})
+	if err != nil {
+		t.Fatalf("ResolveCommits failed: %v", err)
+	}
+	if !slices.Equal(full, []string{expected[2], expected[0], expected[1]}) {
+		t.Errorf("Expected %v, got %v", []string{expected[2], expected[0], expected[1]}, full)
+	}
+
+	if _, err := ResolveCommits(ctx, repo, []string{"0000000"}); err == nil {
+		t.Error("Expected an error for an unknown commit")
+	}
+}
+
+func TestGetRemoteURLs(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 1)
+
+	urls, err := GetRemoteURLs(ctx, repo)
+	if err != nil {
+		t.Fatalf("GetRemoteURLs failed: %v", err)
+	}
+	if len(urls) != 0 {
+		t.Errorf("Expected no remotes, got %v", urls)
+	}
+
+	for _, remote := range [][2]string{{"origin", "git@github.com:me/tool.git"}, {"upstream", "https://example.com/team/tool.git"}} {
+		cmd := exec.Command("git", "remote", "add", remote[0], remote[1])
+		cmd.Dir = repo
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git remote add failed: %v\nOutput: %s", err, output)
+		}
+	}
+
+	urls, err = GetRemoteURLs(ctx, repo)
+	if err != nil {
+		t.Fatalf("GetRemoteURLs failed: %v", err)
+	}
+	if len(urls) != 2 || urls[0] != "git@github.com:me/tool.git" || urls[1] != "https://example.com/team/tool.git" {
+		t.Errorf("Unexpected remote URLs %v", urls)
+	}
+}
+
+func TestGetRemoteRefsContaining(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 3)
+
+	refs, err := GetRemoteRefsContaining(ctx, repo, "HEAD~1")
+	if err != nil {
+		t.Fatalf("GetRemoteRefsContaining failed: %v", err)
+	}
+	if len(refs) != 0 {
+		t.Errorf("Expected no remote refs, got %v", refs)
+	}
+
+	if _, err := runGitCommand(ctx, repo, "update-ref", "refs/remotes/upstream/feature", "HEAD~1"); err != nil {
+		t.Fatalf("update-ref failed: %v", err)
+	}
+
+	refs, err = GetRemoteRefsContaining(ctx, repo, "HEAD~2")
+	if err != nil {
+		t.Fatalf("GetRemoteRefsContaining failed: %v", err)
+	}
+	if len(refs) != 1 || refs[0] != "upstream/feature" {
+		t.Errorf("Expected [upstream/feature], got %v", refs)
+	}
+
+	if refs, _ := GetRemoteRefsContaining(ctx, repo, "HEAD"); len(refs) != 0 {
+		t.Errorf("Expected HEAD to be on no remote, got %v", refs)
+	}
+}
+
+func TestCheckMailmap(t *testing.T) {
+	ctx := context.Background()
+	repo := initTestRepo(t, 1)
+
+	hasMailmap, err := HasMailmap(ctx, repo)
+	if err != nil || hasMailmap {
+		t.Fatalf("Expected no mailmap, got %v (err %v)", hasMailmap, err)
+	}
+
+	mailmap := "Jane Doe <jane@corp.example> <jane@old.example>\n"
+	if err := os.WriteFile(filepath.Join(repo, ".mailmap"), []byte(mailmap), 0644); err != nil {
+		t.Fatalf("Failed to write .mailmap: %v", err)
+	}
+	hasMailmap, err = HasMailmap(ctx, repo)
+	if err != nil || !hasMailmap {
+		t.Fatalf("Expected mailmap to be found, got %v (err %v)", hasMailmap, err)
+	}
+
+	canonical, err := CheckMailmap(ctx, repo, []Identity{
+		{Name: "jd", Email: "jane@old.example"},
+		{Name: "Bob", Email: "bob@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("CheckMailmap failed: %v", err)
+	}
+	expected := []Identity{{Name: "Jane Doe", Email: "jane@corp.example"}, {Name: "Bob", Email: "bob@example.com"}}
+	if len(canonical) != len(expected) || canonical[0] != expected[0] || canonical[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, canonical)
+	}
+}
+
+func TestGetCommitterIdentity(t *testing.T) {
+	repo := initTestRepo(t, 0)
+
+	identity, err := GetCommitterIdentity(context.Background(), repo)
+	if err != nil {
+		t.Fatalf("GetCommitterIdentity failed: %v", err)
+	}
+	if identity != (Identity{Name: "Test", Email: "test@example.com"}) {
+		t.Errorf("Unexpected identity %v", identity)
+	}
+}
+
+// initTestRepo creates a temporary repository with the given number of commits on its default branch
+func initTestRepo(t *testing.T, commitCount int) string {
+	t.Helper()
+	tempDir := t.TempDir()
+
+	gitCmd := func(env []string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = tempDir
+		cmd.Env = append(os.Environ(), env...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\nOutput: %s", strings.Join(args, " "), err, string(output))
+		}
+	}
+
+	gitCmd(nil, "init")
+	gitCmd(nil, "config", "user.name", "Test")
+	gitCmd(nil, "config", "user.email", "test@example.com")
+
+	for i := 0; i < commitCount; i++ {
+		fileName := fmt.Sprintf("file%d.txt", i)
+		if err := os.WriteFile(filepath.Join(tempDir, fileName), []byte(fmt.Sprintf("content %d", i)), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		gitCmd(nil, "add", fileName)
+		date := fmt.Sprintf("2024-01-0%dT12:00:00", i%9+1)
+		gitCmd([]string{"GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date}, "commit", "-m", fmt.Sprintf("Commit %d", i))
+	}
+
+	return tempDir
+}
+
+// Benchmark tests
+func BenchmarkParseCommitsWithMergeInfo(b *testing.B) {
+	input := "abc123\x00First commit\x00John\x00john@example.com\x002024-01-01 10:00:00 +0000\x00def456\x01\n" +
+		"def456\x00Second commit\x00Jane\x00jane@example.com\x002024-01-01 11:00:00 +0000\x00ghi789\x01\n" +
+		"ghi789\x00Merge branch 'feature'\x00John\x00john@example.com\x002024-01-01 12:00:00 +0000\x00jkl012 mno345\x01"
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parseCommitsWithMergeInfo(input)
 	}
 }
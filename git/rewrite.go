@@ -0,0 +1,289 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commitObject is the part of a raw commit object a rewrite reuses
+type commitObject struct {
+	Tree    string
+	Parents []string
+	// Message is the message exactly as stored, including its trailing newline
+	Message string
+	// Encoding is the value of the encoding header, empty when the commit has none
+	Encoding string
+}
+
+// readCommitObject reads the tree, parents and message of a commit from the object database
+func readCommitObject(ctx context.Context, repoPath string, hash string) (commitObject, error) {
+	output, err := runGitCommand(ctx, repoPath, "cat-file", "commit", hash)
+	if err != nil {
+		return commitObject{}, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+
+	header, message, _ := strings.Cut(output, "\n\n")
+	object := commitObject{Message: message}
+	for _, line := range strings.Split(header, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			object.Tree = value
+		case "parent":
+			object.Parents = append(object.Parents, value)
+		case "encoding":
+			object.Encoding = value
+		}
+	}
+	if object.Tree == "" {
+		return commitObject{}, fmt.Errorf("failed to read commit %s: no tree", hash)
+	}
+	return object, nil
+}
+
+// rewriteCommits recreates each commit with git commit-tree from its original tree, pointing it at its rewritten
+// parents, then moves branchName to the rewritten tip with a single update-ref. Since only metadata changes, every
+// tree is reused as it is: nothing can conflict, and the working tree, index and HEAD are never touched. An error
+// leaves the branch where it was. It returns the number of commits recreated.
+func rewriteCommits(ctx context.Context, repoPath string, commits []Commit, newTimes []time.Time, branchName string, opts ReplayOptions) (int, error) {
+	successfulUpdates := 0
+	rewritten := rewrittenCommits{}
+
+	originalTip, err := runGitCommand(ctx, repoPath, "rev-parse", "refs/heads/"+branchName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve branch %s: %w", branchName, err)
+	}
+	originalTip = strings.TrimSpace(originalTip)
+	head := originalTip
+
+	// Commits are already in topological order, oldest first
+	for i, commit := range commits {
+		if err := ctx.Err(); err != nil {
+			return successfulUpdates, err
+		}
+
+		object, err := readCommitObject(ctx, repoPath, commit.Hash)
+		if err != nil {
+			return successfulUpdates, err
+		}
+		parents := make([]string, len(object.Parents))
+		for j, parent := range object.Parents {
+			if parents[j], err = rewritten.resolve(parent, commits[i:]); err != nil {
+				return successfulUpdates, err
+			}
+		}
+
+		// A commit is empty when it has the same tree as its parent, and a root commit when it has the empty tree.
+		// Merges never are.
+		empty := false
+		switch len(parents) {
+		case 0:
+			emptyTree, err := GetEmptyTree(ctx, repoPath)
+			if err != nil {
+				return successfulUpdates, err
+			}
+			empty = object.Tree == emptyTree
+		case 1:
+			parentTree, err := runGitCommand(ctx, repoPath, "rev-parse", parents[0]+"^{tree}")
+			if err != nil {
+				return successfulUpdates, fmt.Errorf("failed to resolve the tree of %s: %w", parents[0], err)
+			}
+			empty = strings.TrimSpace(parentTree) == object.Tree
+		}
+		// An empty root commit is kept, since its children would have nothing to be attached to
+		if empty && opts.DropEmpty && len(parents) == 1 {
+			// Children of the dropped commit are attached to its parent instead
+			rewritten[commit.Hash] = parents[0]
+			head = parents[0]
+			opts.report(commit, ReplayResult{Status: ReplayDropped})
+			continue
+		}
+
+		env := commitEnv(commit, newTimes[i], opts)
+		message, err := rewriteMessage(ctx, repoPath, commit, object.Message, env, opts)
+		if err != nil {
+			return successfulUpdates, err
+		}
+		head, err = commitTree(ctx, repoPath, env, object, parents, message)
+		if err != nil {
+			return successfulUpdates, fmt.Errorf("failed to recreate commit %s: %w", commit.Hash, err)
+		}
+		rewritten[commit.Hash] = head
+
+		result := ReplayResult{Status: ReplayRewritten, NewHash: head}
+		if empty {
+			result.Status = ReplayKeptEmpty
+		}
+		opts.report(commit, result)
+
+		successfulUpdates++
+	}
+
+	// The branch tip is normally the last commit recreated, but side branch commits can come last
+	tip := head
+	if rewrittenTip, ok := rewritten.lookup(originalTip); ok {
+		tip = rewrittenTip
+	}
+	// Passing the original tip makes the update fail instead of discarding commits made in the meantime
+	if _, err := runGitCommand(ctx, repoPath, "update-ref", "-m", "code-cadence: rewrite commit times", "refs/heads/"+branchName, tip, originalTip); err != nil {
+		return successfulUpdates, fmt.Errorf("failed to update branch %s: %w", branchName, err)
+	}
+	return successfulUpdates, nil
+}
+
+// rewriteMessage returns the message of the recreated copy of commit: original as it is, or as rewritten by Message,
+// with the trailers added
+func rewriteMessage(ctx context.Context, repoPath string, commit Commit, original string, env []string, opts ReplayOptions) (string, error) {
+	message := original
+	var replaced string
+	if opts.Message != nil {
+		decoded := decodeText(original, commit.Encoding)
+		rendered, err := opts.Message(commit, decoded)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(rendered) != strings.TrimSpace(decoded) {
+			message = encodeText(cleanupMessage(rendered), commit.Encoding)
+			replaced = original
+		}
+	}
+
+	trailers, err := replayTrailers(ctx, repoPath, commit, env, opts, replaced)
+	if err != nil || len(trailers) == 0 {
+		return message, err
+	}
+	args := append(slices.Clone(trailerConfig), "interpret-trailers")
+	for _, trailer := range trailers {
+		args = append(args, "--trailer", trailer)
+	}
+	return withMessageFile(message, func(path string) (string, error) {
+		output, err := runGitCommand(ctx, repoPath, append(args, path)...)
+		if err != nil {
+			return "", fmt.Errorf("failed to add trailers to %s: %w", commit.Hash, err)
+		}
+		return output, nil
+	})
+}
+
+// commitTree creates a commit object for the tree of object with the given parents and message and the encoding
+// header of object, and returns its hash
+func commitTree(ctx context.Context, repoPath string, env []string, object commitObject, parents []string, message string) (string, error) {
+	return withMessageFile(message, func(path string) (string, error) {
+		args := append(encodingConfig(object.Encoding), "commit-tree", object.Tree)
+		for _, parent := range parents {
+			args = append(args, "-p", parent)
+		}
+		// -F stores the message byte for byte, where -m would reformat it
+		output, err := runGitCommandWithEnv(ctx, repoPath, env, append(args, "-F", path)...)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(output), nil
+	})
+}
+
+// withMessageFile writes message to a temporary file for the duration of fn
+func withMessageFile(message string, fn func(path string) (string, error)) (string, error) {
+	file, err := os.CreateTemp("", "code-cadence-message-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write commit message: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(message); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write commit message: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write commit message: %w", err)
+	}
+	return fn(file.Name())
+}
+
+// cleanupMessage tidies a generated message the way git commit -m does: trailing whitespace is removed, runs of
+// blank lines are collapsed and the message ends with a single newline
+func cleanupMessage(message string) string {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// CompareMessages compares the message of rewrittenHash, the rewritten copy of originalHash, with the original byte for
+// byte. It returns a line diff of the two, or "" when the message was kept. Trailers added to the message, such as
+// co-authors, sign-offs or the original dates, don't count as changes.
+func CompareMessages(ctx context.Context, repoPath string, originalHash string, rewrittenHash string) (string, error) {
+	original, err := readCommitObject(ctx, repoPath, originalHash)
+	if err != nil {
+		return "", err
+	}
+	rewritten, err := readCommitObject(ctx, repoPath, rewrittenHash)
+	if err != nil {
+		return "", err
+	}
+
+	removed, added := diffLines(original.Message, rewritten.Message)
+	if len(removed) == 0 && onlyTrailers(added) {
+		return "", nil
+	}
+	var diff strings.Builder
+	for _, line := range removed {
+		diff.WriteString("- " + strconv.Quote(line) + "\n")
+	}
+	for _, line := range added {
+		diff.WriteString("+ " + strconv.Quote(line) + "\n")
+	}
+	return diff.String(), nil
+}
+
+// diffLines returns the lines of two messages left after their common leading and trailing lines. Lines keep their
+// newline, so a change in the line ending shows too.
+func diffLines(original, rewritten string) (removed []string, added []string) {
+	before, after := splitLines(original), splitLines(rewritten)
+	for len(before) > 0 && len(after) > 0 && before[0] == after[0] {
+		before, after = before[1:], after[1:]
+	}
+	for len(before) > 0 && len(after) > 0 && before[len(before)-1] == after[len(after)-1] {
+		before, after = before[:len(before)-1], after[:len(after)-1]
+	}
+	return before, after
+}
+
+// splitLines splits a message after each newline
+func splitLines(message string) []string {
+	lines := strings.SplitAfter(message, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// onlyTrailers reports whether lines are nothing but trailers, such as "Signed-off-by: Name <email>", and blank lines
+func onlyTrailers(lines []string) bool {
+	for _, line := range lines {
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			continue
+		}
+		key, _, found := strings.Cut(line, ": ")
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return false
+		}
+	}
+	return true
+}
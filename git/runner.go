@@ -0,0 +1,180 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner executes git commands. Every function in this package goes through a Runner,
+// so tests can mock git output and alternative backends (remote execution, go-git)
+// can be plugged in without changing callers.
+type Runner interface {
+	// Run executes git with args in dir, adding env to the environment, and returns stdout.
+	// Failures should be reported as *GitError.
+	Run(ctx context.Context, dir string, env []string, args ...string) (string, error)
+}
+
+// RunnerFunc adapts a function to the Runner interface
+type RunnerFunc func(ctx context.Context, dir string, env []string, args ...string) (string, error)
+
+// Run calls f
+func (f RunnerFunc) Run(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	return f(ctx, dir, env, args...)
+}
+
+// ExecRunner runs the local git binary
+type ExecRunner struct {
+	// Timeout limits how long a single git invocation may run. Zero disables the limit.
+	Timeout time.Duration
+}
+
+// Run executes git in dir. The command is killed when ctx is cancelled or Timeout elapses.
+func (r ExecRunner) Run(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "git", append(platformArgs(runtime.GOOS), args...)...)
+	cmd.Dir = dir
+	cmd.WaitDelay = time.Second
+
+	// Never let git block on an interactive credential prompt
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Env = append(cmd.Env, env...)
+
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %w", r.Timeout, ctx.Err())
+		} else if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return "", &GitError{
+			Command: fmt.Sprintf("git %s (in %s)", strings.Join(args, " "), dir),
+			Err:     err,
+			Stdout:  stdout.String(),
+			Stderr:  stderr.String(),
+		}
+	}
+
+	return stdout.String(), nil
+}
+
+// platformArgs returns the options git needs on goos before every command. Git for Windows is limited to paths of
+// 260 characters unless core.longpaths is set, which deep work trees and worktrees below the repository exceed.
+func platformArgs(goos string) []string {
+	if goos == "windows" {
+		return []string{"-c", "core.longpaths=true"}
+	}
+	return nil
+}
+
+// DefaultRunner is used when the context carries no Runner
+var DefaultRunner Runner = ExecRunner{}
+
+type runnerKey struct{}
+
+// WithRunner returns a context whose git commands are executed by r
+func WithRunner(ctx context.Context, r Runner) context.Context {
+	return context.WithValue(ctx, runnerKey{}, r)
+}
+
+// RunnerFromContext returns the Runner carried by ctx, or DefaultRunner
+func RunnerFromContext(ctx context.Context) Runner {
+	if r, ok := ctx.Value(runnerKey{}).(Runner); ok && r != nil {
+		return r
+	}
+	return DefaultRunner
+}
+
+// withoutHooks returns a context whose git commands run with the repository's hooks disabled, so commits recreated
+// internally don't trigger pre-commit or commit-msg hooks that may change files or reject them
+func withoutHooks(ctx context.Context) context.Context {
+	r := RunnerFromContext(ctx)
+	return WithRunner(ctx, RunnerFunc(func(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+		return r.Run(ctx, dir, env, append([]string{"-c", "core.hooksPath=" + os.DevNull}, args...)...)
+	}))
+}
+
+// TraceRunner passes every command to Runner and writes a line about it to W: its arguments, directory, the
+// environment it adds, how long it took and how it ended, with the first line of stderr when it failed
+type TraceRunner struct {
+	Runner Runner
+	W      io.Writer
+}
+
+// traceMu keeps the lines of commands run concurrently, possibly by several TraceRunners, from interleaving
+var traceMu sync.Mutex
+
+// Run runs the command with Runner and traces it
+func (r TraceRunner) Run(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	start := time.Now()
+	output, err := r.Runner.Run(ctx, dir, env, args...)
+	elapsed := time.Since(start)
+
+	var b strings.Builder
+	b.WriteString("[trace] git")
+	for _, arg := range args {
+		b.WriteString(" " + quoteTraceArg(arg))
+	}
+	fmt.Fprintf(&b, " | dir %s", quoteTraceArg(dir))
+	if len(env) > 0 {
+		b.WriteString(" | env")
+		for _, variable := range env {
+			b.WriteString(" " + quoteTraceArg(variable))
+		}
+	}
+	fmt.Fprintf(&b, " | %s | %s\n", elapsed.Round(time.Microsecond), traceStatus(err))
+
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	io.WriteString(r.W, b.String())
+	return output, err
+}
+
+// traceStatus describes how a command ended: its exit code, or why it didn't exit by itself
+func traceStatus(err error) string {
+	if err == nil {
+		return "exit 0"
+	}
+	var gitErr *GitError
+	if !errors.As(err, &gitErr) {
+		return "error: " + err.Error()
+	}
+	status := "error: " + gitErr.Err.Error()
+	var exitErr *exec.ExitError
+	if errors.As(gitErr.Err, &exitErr) {
+		status = fmt.Sprintf("exit %d", exitErr.ExitCode())
+	}
+	if line, _, _ := strings.Cut(strings.TrimSpace(gitErr.Stderr), "\n"); line != "" {
+		status += " | stderr " + strconv.Quote(line)
+	}
+	return status
+}
+
+// quoteTraceArg quotes an argument when it is empty or contains anything but letters, digits and common punctuation,
+// so every argument of a traced command can be told apart
+func quoteTraceArg(arg string) string {
+	if arg == "" || strings.ContainsFunc(arg, func(r rune) bool {
+		return r <= ' ' || r > '~' || strings.ContainsRune(`"'\$`+"`", r)
+	}) {
+		return strconv.Quote(arg)
+	}
+	return arg
+}
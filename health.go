@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"github.com/egor-markin/code-cadence/backup"
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// CmdRepoHealth checks the object database of every repository, which rewrites fill with unreachable objects
+const CmdRepoHealth = "repo_health"
+
+// repoHealth runs git fsck and counts the objects of every repository, recommending a repack where git gc --auto
+// would run one. With --gc it runs git gc in those repositories.
+func (b *batch) repoHealth(ctx context.Context, gitRepos iter.Seq[string]) {
+	fmt.Println("Checking the health of all repositories...")
+	fmt.Println()
+
+	healthy, needsRepack, broken, cleaned := 0, 0, 0, 0
+	for repo := range gitRepos {
+		if ctx.Err() != nil {
+			break
+		}
+		if backup.IsBackupFolder(repo) {
+			continue
+		}
+
+		if err := git.Fsck(ctx, repo); err != nil {
+			broken++
+			fmt.Printf("❌ %s: %v\n", repo, err)
+			continue
+		}
+		counts, err := git.CountObjects(ctx, repo)
+		if err != nil {
+			broken++
+			fmt.Printf("❌ %s: %v\n", repo, err)
+			continue
+		}
+
+		if !counts.NeedsRepack() {
+			healthy++
+			fmt.Printf("✅ %s: %s\n", repo, objectSummary(counts))
+			continue
+		}
+		needsRepack++
+		fmt.Printf("🧹 %s: %s, repack recommended\n", repo, objectSummary(counts))
+		if !RunGC {
+			continue
+		}
+		if err := git.GC(ctx, repo); err != nil {
+			fmt.Printf("   ❌ %v\n", err)
+			continue
+		}
+		cleaned++
+		if after, err := git.CountObjects(ctx, repo); err == nil {
+			fmt.Printf("   ✨ After git gc: %s\n", objectSummary(after))
+		}
+	}
+
+	fmt.Printf("\nSummary: %d repositories are healthy, %d need a repack, %d failed the checks\n", healthy, needsRepack, broken)
+	if RunGC {
+		fmt.Printf("🧹 Ran git gc in %d repositories\n", cleaned)
+	} else if needsRepack > 0 {
+		fmt.Println("Run repo_health --gc to repack them")
+	}
+}
+
+// objectSummary describes the object storage of a repository, e.g. "120 loose objects (480 KB), 2 packs (12.0 MB)"
+func objectSummary(counts git.ObjectCounts) string {
+	summary := fmt.Sprintf("%d loose objects (%s), %d packs (%s)", counts.Loose, formatSize(counts.LooseSize), counts.Packs, formatSize(counts.PackSize))
+	if counts.Garbage > 0 {
+		summary += fmt.Sprintf(", %d garbage files", counts.Garbage)
+	}
+	return summary
+}
@@ -0,0 +1,165 @@
+// Package holiday knows the public holidays of a set of countries and regions, so schedules can skip them without a
+// calendar file to maintain.
+package holiday
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Region is the set of public holidays of a country or one of its regions. The zero Region has no holidays.
+type Region struct {
+	code  string
+	rules []rule
+}
+
+// rule returns the date of a holiday in year; ok is false for years it isn't observed
+type rule struct {
+	name string
+	date func(year int) (date time.Time, ok bool)
+}
+
+// Lookup returns the region with the given ISO 3166 code, e.g. "DE" or "DE-BY". Codes are case-insensitive.
+func Lookup(code string) (Region, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	rules, ok := regions[code]
+	if !ok {
+		return Region{}, fmt.Errorf("unknown holiday region %q, known regions are %s", code, strings.Join(Codes(), ", "))
+	}
+	return Region{code: code, rules: rules}, nil
+}
+
+// Codes lists the known region codes in alphabetical order
+func Codes() []string {
+	codes := make([]string, 0, len(regions))
+	for code := range regions {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// Code returns the ISO 3166 code of the region, or "" for the zero Region
+func (r Region) Code() string {
+	return r.code
+}
+
+// Holiday returns the name of the public holiday on the day of t, in t's location
+func (r Region) Holiday(t time.Time) (string, bool) {
+	day := date(t.Year(), t.Month(), t.Day())
+	for _, rule := range r.rules {
+		// A holiday observed on another day can move into the year before, like New Year's Day on a Saturday
+		for _, year := range []int{t.Year(), t.Year() + 1} {
+			if d, ok := rule.date(year); ok && d.Equal(day) {
+				return rule.name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// fixed is a holiday on the same date every year
+func fixed(month time.Month, day int) func(int) (time.Time, bool) {
+	return func(year int) (time.Time, bool) {
+		return date(year, month, day), true
+	}
+}
+
+// since limits a holiday to the years from first on
+func since(first int, holiday func(int) (time.Time, bool)) func(int) (time.Time, bool) {
+	return func(year int) (time.Time, bool) {
+		if year < first {
+			return time.Time{}, false
+		}
+		return holiday(year)
+	}
+}
+
+// only limits a holiday to a single year
+func only(year int, holiday func(int) (time.Time, bool)) func(int) (time.Time, bool) {
+	return func(y int) (time.Time, bool) {
+		if y != year {
+			return time.Time{}, false
+		}
+		return holiday(y)
+	}
+}
+
+// easter is a holiday offset days from Easter Sunday
+func easter(offset int) func(int) (time.Time, bool) {
+	return func(year int) (time.Time, bool) {
+		return easterSunday(year).AddDate(0, 0, offset), true
+	}
+}
+
+// nthWeekday is the nth weekday of month, counting from the end of the month for negative n
+func nthWeekday(month time.Month, weekday time.Weekday, n int) func(int) (time.Time, bool) {
+	return func(year int) (time.Time, bool) {
+		if n > 0 {
+			first := date(year, month, 1)
+			offset := (int(weekday) - int(first.Weekday()) + 7) % 7
+			return first.AddDate(0, 0, offset+7*(n-1)), true
+		}
+		last := date(year, month+1, 0)
+		offset := (int(last.Weekday()) - int(weekday) + 7) % 7
+		return last.AddDate(0, 0, -offset+7*(n+1)), true
+	}
+}
+
+// observedUS moves a holiday on a Saturday to the Friday before and one on a Sunday to the Monday after
+func observedUS(holiday func(int) (time.Time, bool)) func(int) (time.Time, bool) {
+	return func(year int) (time.Time, bool) {
+		d, ok := holiday(year)
+		switch d.Weekday() {
+		case time.Saturday:
+			return d.AddDate(0, 0, -1), ok
+		case time.Sunday:
+			return d.AddDate(0, 0, 1), ok
+		}
+		return d, ok
+	}
+}
+
+// substituteGB moves a holiday on a weekend to the next weekday that isn't already a holiday; Christmas and
+// Boxing Day on a weekend take the following Monday and Tuesday
+func substituteGB(holiday func(int) (time.Time, bool), taken ...func(int) (time.Time, bool)) func(int) (time.Time, bool) {
+	return func(year int) (time.Time, bool) {
+		d, ok := holiday(year)
+		for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday || slices.ContainsFunc(taken, func(other func(int) (time.Time, bool)) bool {
+			o, _ := other(year)
+			return o.Equal(d)
+		}) {
+			d = d.AddDate(0, 0, 1)
+		}
+		return d, ok
+	}
+}
+
+// repentanceDay is Buß- und Bettag, the Wednesday before November 23
+func repentanceDay(year int) (time.Time, bool) {
+	d := date(year, time.November, 22)
+	return d.AddDate(0, 0, -((int(d.Weekday()) - int(time.Wednesday) + 7) % 7)), true
+}
+
+// date returns midnight UTC of a date; only its year, month and day are compared
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// easterSunday computes the date of Easter Sunday in the Gregorian calendar (anonymous Gregorian algorithm)
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return date(year, time.Month(month), day)
+}
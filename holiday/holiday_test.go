@@ -0,0 +1,65 @@
+package holiday
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEasterSunday(t *testing.T) {
+	for year, expected := range map[int]string{2019: "2019-04-21", 2024: "2024-03-31", 2025: "2025-04-20", 2038: "2038-04-25"} {
+		if got := easterSunday(year).Format(time.DateOnly); got != expected {
+			t.Errorf("Expected Easter %d on %s, got %s", year, expected, got)
+		}
+	}
+}
+
+func TestHoliday(t *testing.T) {
+	tests := []struct {
+		region string
+		day    string
+		name   string
+	}{
+		{"DE", "2024-10-03", "Tag der Deutschen Einheit"},
+		{"DE", "2024-03-29", "Karfreitag"},
+		{"DE", "2017-10-31", "Reformationstag"},
+		{"DE", "2024-10-31", ""},
+		{"de-by", "2024-05-30", "Fronleichnam"},
+		{"DE-BY", "2024-08-15", "Mariä Himmelfahrt"},
+		{"DE-BE", "2024-05-30", ""},
+		{"DE-BE", "2018-03-08", ""},
+		{"DE-BE", "2019-03-08", "Internationaler Frauentag"},
+		{"DE-HH", "2024-10-31", "Reformationstag"},
+		{"DE-SN", "2024-11-20", "Buß- und Bettag"},
+		{"AT", "2024-12-08", "Mariä Empfängnis"},
+		{"FR", "2024-07-14", "Fête nationale"},
+		{"US", "2024-11-28", "Thanksgiving Day"},
+		{"US", "2024-05-27", "Memorial Day"},
+		{"US", "2020-06-19", ""},
+		// Observed on the Friday before, in the previous year
+		{"US", "2021-12-31", "New Year's Day"},
+		{"US", "2022-01-01", ""},
+		// Christmas on a Saturday and Boxing Day on a Sunday move to Monday and Tuesday
+		{"GB-ENG", "2021-12-27", "Christmas Day"},
+		{"GB-ENG", "2021-12-28", "Boxing Day"},
+		{"GB-ENG", "2021-12-25", ""},
+		{"GB-WLS", "2024-08-26", "Summer bank holiday"},
+	}
+	for _, tt := range tests {
+		region, err := Lookup(tt.region)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", tt.region, err)
+		}
+		day, _ := time.Parse(time.DateOnly, tt.day)
+		name, ok := region.Holiday(day)
+		if name != tt.name || ok != (tt.name != "") {
+			t.Errorf("%s %s: expected %q, got %q (%v)", tt.region, tt.day, tt.name, name, ok)
+		}
+	}
+
+	if _, err := Lookup("DE-XX"); err == nil {
+		t.Error("Expected error for an unknown region")
+	}
+	if _, ok := (Region{}).Holiday(time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC)); ok {
+		t.Error("Expected the zero region to have no holidays")
+	}
+}
@@ -0,0 +1,122 @@
+package holiday
+
+import "time"
+
+// German holidays, shared by the country and its states
+var (
+	deNewYear       = rule{"Neujahr", fixed(time.January, 1)}
+	deEpiphany      = rule{"Heilige Drei Könige", fixed(time.January, 6)}
+	deWomensDay     = rule{"Internationaler Frauentag", since(2019, fixed(time.March, 8))}
+	deGoodFriday    = rule{"Karfreitag", easter(-2)}
+	deEasterSunday  = rule{"Ostersonntag", easter(0)}
+	deEasterMonday  = rule{"Ostermontag", easter(1)}
+	deLabourDay     = rule{"Tag der Arbeit", fixed(time.May, 1)}
+	deAscension     = rule{"Christi Himmelfahrt", easter(39)}
+	deWhitSunday    = rule{"Pfingstsonntag", easter(49)}
+	deWhitMonday    = rule{"Pfingstmontag", easter(50)}
+	deCorpusChristi = rule{"Fronleichnam", easter(60)}
+	deAssumption    = rule{"Mariä Himmelfahrt", fixed(time.August, 15)}
+	deChildrensDay  = rule{"Weltkindertag", since(2019, fixed(time.September, 20))}
+	deUnity         = rule{"Tag der Deutschen Einheit", fixed(time.October, 3)}
+	deReformation   = rule{"Reformationstag", fixed(time.October, 31)}
+	deAllSaints     = rule{"Allerheiligen", fixed(time.November, 1)}
+	deRepentance    = rule{"Buß- und Bettag", repentanceDay}
+	deChristmas     = rule{"1. Weihnachtstag", fixed(time.December, 25)}
+	deBoxingDay     = rule{"2. Weihnachtstag", fixed(time.December, 26)}
+	// The 500th anniversary of the Reformation was a holiday in every state
+	deReformation2017 = rule{"Reformationstag", only(2017, fixed(time.October, 31))}
+	// Reformation Day became a holiday in the northern states in 2018
+	deReformationNorth = rule{"Reformationstag", since(2018, fixed(time.October, 31))}
+)
+
+// de are the holidays observed in all of Germany
+var de = []rule{deNewYear, deGoodFriday, deEasterMonday, deLabourDay, deAscension, deWhitMonday, deUnity, deChristmas, deBoxingDay}
+
+// deState adds the holidays of a German state to the national ones
+func deState(rules ...rule) []rule {
+	return append(append([]rule{}, de...), rules...)
+}
+
+// Bank holidays of England and Wales
+var (
+	gbChristmas = substituteGB(fixed(time.December, 25))
+	gbBoxingDay = substituteGB(fixed(time.December, 26), gbChristmas)
+	gbEngWls    = []rule{
+		{"New Year's Day", substituteGB(fixed(time.January, 1))},
+		{"Good Friday", easter(-2)},
+		{"Easter Monday", easter(1)},
+		{"Early May bank holiday", nthWeekday(time.May, time.Monday, 1)},
+		{"Spring bank holiday", nthWeekday(time.May, time.Monday, -1)},
+		{"Summer bank holiday", nthWeekday(time.August, time.Monday, -1)},
+		{"Christmas Day", gbChristmas},
+		{"Boxing Day", gbBoxingDay},
+	}
+)
+
+// regions maps ISO 3166 codes to their public holidays
+var regions = map[string][]rule{
+	"DE":    deState(deReformation2017),
+	"DE-BW": deState(deEpiphany, deCorpusChristi, deAllSaints, deReformation2017),
+	"DE-BY": deState(deEpiphany, deCorpusChristi, deAssumption, deAllSaints, deReformation2017),
+	"DE-BE": deState(deWomensDay, deReformation2017),
+	"DE-BB": deState(deEasterSunday, deWhitSunday, deReformation),
+	"DE-HB": deState(deReformation2017, deReformationNorth),
+	"DE-HH": deState(deReformation2017, deReformationNorth),
+	"DE-HE": deState(deCorpusChristi, deReformation2017),
+	"DE-MV": deState(deReformation, rule{"Internationaler Frauentag", since(2023, fixed(time.March, 8))}),
+	"DE-NI": deState(deReformation2017, deReformationNorth),
+	"DE-NW": deState(deCorpusChristi, deAllSaints, deReformation2017),
+	"DE-RP": deState(deCorpusChristi, deAllSaints, deReformation2017),
+	"DE-SL": deState(deCorpusChristi, deAssumption, deAllSaints, deReformation2017),
+	"DE-SN": deState(deReformation, deRepentance),
+	"DE-ST": deState(deEpiphany, deReformation),
+	"DE-SH": deState(deReformation2017, deReformationNorth),
+	"DE-TH": deState(deReformation, deChildrensDay),
+
+	"AT": {
+		{"Neujahr", fixed(time.January, 1)},
+		{"Heilige Drei Könige", fixed(time.January, 6)},
+		{"Ostermontag", easter(1)},
+		{"Staatsfeiertag", fixed(time.May, 1)},
+		{"Christi Himmelfahrt", easter(39)},
+		{"Pfingstmontag", easter(50)},
+		{"Fronleichnam", easter(60)},
+		{"Mariä Himmelfahrt", fixed(time.August, 15)},
+		{"Nationalfeiertag", fixed(time.October, 26)},
+		{"Allerheiligen", fixed(time.November, 1)},
+		{"Mariä Empfängnis", fixed(time.December, 8)},
+		{"Christtag", fixed(time.December, 25)},
+		{"Stefanitag", fixed(time.December, 26)},
+	},
+
+	"FR": {
+		{"Jour de l'an", fixed(time.January, 1)},
+		{"Lundi de Pâques", easter(1)},
+		{"Fête du Travail", fixed(time.May, 1)},
+		{"Victoire 1945", fixed(time.May, 8)},
+		{"Ascension", easter(39)},
+		{"Lundi de Pentecôte", easter(50)},
+		{"Fête nationale", fixed(time.July, 14)},
+		{"Assomption", fixed(time.August, 15)},
+		{"Toussaint", fixed(time.November, 1)},
+		{"Armistice 1918", fixed(time.November, 11)},
+		{"Noël", fixed(time.December, 25)},
+	},
+
+	"GB-ENG": gbEngWls,
+	"GB-WLS": gbEngWls,
+
+	"US": {
+		{"New Year's Day", observedUS(fixed(time.January, 1))},
+		{"Martin Luther King Jr. Day", nthWeekday(time.January, time.Monday, 3)},
+		{"Washington's Birthday", nthWeekday(time.February, time.Monday, 3)},
+		{"Memorial Day", nthWeekday(time.May, time.Monday, -1)},
+		{"Juneteenth", since(2021, observedUS(fixed(time.June, 19)))},
+		{"Independence Day", observedUS(fixed(time.July, 4))},
+		{"Labor Day", nthWeekday(time.September, time.Monday, 1)},
+		{"Columbus Day", nthWeekday(time.October, time.Monday, 2)},
+		{"Veterans Day", observedUS(fixed(time.November, 11))},
+		{"Thanksgiving Day", nthWeekday(time.November, time.Thursday, 4)},
+		{"Christmas Day", observedUS(fixed(time.December, 25))},
+	},
+}
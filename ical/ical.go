@@ -0,0 +1,91 @@
+// Package ical writes calendar events in the iCalendar format (RFC 5545).
+package ical
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Event is a single calendar entry
+type Event struct {
+	// UID identifies the event and must be unique
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+}
+
+// timeFormat is the UTC form of an iCalendar DATE-TIME
+const timeFormat = "20060102T150405Z"
+
+// Encode returns events as an iCalendar document stamped with now
+func Encode(events []Event, now time.Time) []byte {
+	var b strings.Builder
+	line := func(content string) {
+		b.WriteString(fold(content))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//code-cadence//code-cadence//EN")
+	line("CALSCALE:GREGORIAN")
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + escape(event.UID))
+		line("DTSTAMP:" + now.UTC().Format(timeFormat))
+		line("DTSTART:" + event.Start.UTC().Format(timeFormat))
+		line("DTEND:" + event.End.UTC().Format(timeFormat))
+		line("SUMMARY:" + escape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION:" + escape(event.Description))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
+
+// WriteFile writes events to path as an iCalendar document, replacing the file atomically
+func WriteFile(path string, events []Event) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, Encode(events, time.Now()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// escape escapes the characters TEXT values can't hold literally
+func escape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// fold splits a content line into lines of at most 75 octets, continued with a leading space, without splitting a
+// UTF-8 sequence
+func fold(content string) string {
+	const limit = 75
+	if len(content) <= limit {
+		return content
+	}
+	var b strings.Builder
+	width := limit
+	for len(content) > width {
+		cut := width
+		for cut > 0 && content[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(content[:cut])
+		b.WriteString("\r\n ")
+		content = content[cut:]
+		// The leading space of a continuation line counts towards its length
+		width = limit - 1
+	}
+	b.WriteString(content)
+	return b.String()
+}
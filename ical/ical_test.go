@@ -0,0 +1,172 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	start := time.Date(2024, 1, 5, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+	events := []Event{{
+		UID:         "abc@code-cadence",
+		Start:       start,
+		End:         start.Add(90 * time.Minute),
+		Summary:     "api (2 commits)",
+		Description: "Fix parser; add tests, docs\nRefactor " + strings.Repeat("ü", 40),
+	}}
+	doc := string(Encode(events, time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC)))
+
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"UID:abc@code-cadence\r\n",
+		"DTSTAMP:20240106T120000Z\r\n",
+		"DTSTART:20240105T083000Z\r\n",
+		"DTEND:20240105T100000Z\r\n",
+		"SUMMARY:api (2 commits)\r\n",
+		`DESCRIPTION:Fix parser\; add tests\, docs\nRefactor `,
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(doc, expected) {
+			t.Errorf("Expected %q in\n%s", expected, doc)
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(doc, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Expected lines of at most 75 octets, got %d: %q", len(line), line)
+		}
+		if strings.ToValidUTF8(line, "?") != line {
+			t.Errorf("Expected folding to keep UTF-8 sequences whole: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(doc, "\r\n ", "")
+	if !strings.Contains(unfolded, "Refactor "+strings.Repeat("ü", 40)+"\r\n") {
+		t.Errorf("Expected the folded description to unfold to the original\n%s", unfolded)
+	}
+}
+
+func TestBusy(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("No time zone database: %v", err)
+	}
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		// A one-off meeting with a folded summary
+		"BEGIN:VEVENT",
+		"UID:review",
+		"DTSTART;TZID=Europe/Berlin:20240105T140000",
+		"DTEND;TZID=Europe/Berlin:20240105T150000",
+		"SUMMARY:Design review with a long summary that some calendar applications fold",
+		"  across lines",
+		"BEGIN:VALARM",
+		"TRIGGER:-PT15M",
+		"END:VALARM",
+		"END:VEVENT",
+		// A stand-up on Monday, Wednesday and Friday, with Wednesday off and Friday moved
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"DTSTART:20240108T090000Z",
+		"DURATION:PT15M",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=3",
+		"EXDATE:20240110T090000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"RECURRENCE-ID:20240112T090000Z",
+		"DTSTART:20240112T100000Z",
+		"DTEND:20240112T101500Z",
+		"END:VEVENT",
+		// Neither blocks any time
+		"BEGIN:VEVENT",
+		"UID:focus",
+		"DTSTART:20240105T080000Z",
+		"DTEND:20240105T090000Z",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:cancelled",
+		"DTSTART:20240105T100000Z",
+		"DTEND:20240105T110000Z",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:holiday",
+		"DTSTART;VALUE=DATE:20240101",
+		"DTEND;VALUE=DATE:20240102",
+		"END:VEVENT",
+		"BEGIN:VFREEBUSY",
+		"FREEBUSY:20240109T130000Z/PT1H,20240109T150000Z/20240109T153000Z",
+		"FREEBUSY;FBTYPE=FREE:20240109T160000Z/PT1H",
+		"END:VFREEBUSY",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	periods, err := Busy([]byte(calendar), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	utc := func(day, hour, minute int) time.Time { return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC) }
+	expected := []Period{
+		{time.Date(2024, 1, 5, 14, 0, 0, 0, berlin), time.Date(2024, 1, 5, 15, 0, 0, 0, berlin)},
+		{utc(8, 9, 0), utc(8, 9, 15)},
+		{utc(9, 13, 0), utc(9, 14, 0)},
+		{utc(9, 15, 0), utc(9, 15, 30)},
+		{utc(12, 10, 0), utc(12, 10, 15)},
+	}
+	if len(periods) != len(expected) {
+		t.Fatalf("Expected %d periods, got %v", len(expected), periods)
+	}
+	for i, period := range periods {
+		if !period.Start.Equal(expected[i].Start) || !period.End.Equal(expected[i].End) {
+			t.Errorf("Expected period %d to be %v, got %v", i, expected[i], period)
+		}
+	}
+
+	for _, invalid := range []string{
+		"not a calendar",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:tomorrow\r\nEND:VEVENT\r\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20240105T080000Z\r\nDURATION:PT1H\r\nRRULE:FREQ=DAILY;INTERVAL=0\r\nEND:VEVENT\r\nEND:VCALENDAR",
+	} {
+		if _, err := Busy([]byte(invalid), time.Now()); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestBusyRecurrence(t *testing.T) {
+	event := func(rule string) string {
+		return "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:x\nDTSTART:20240131T090000Z\nDURATION:PT1H\nRRULE:" + rule + "\nEND:VEVENT\nEND:VCALENDAR\n"
+	}
+	until := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		rule  string
+		count int
+		last  time.Time
+	}{
+		{"FREQ=DAILY;UNTIL=20240204T090000Z", 5, time.Date(2024, 2, 4, 9, 0, 0, 0, time.UTC)},
+		{"FREQ=DAILY;INTERVAL=2;COUNT=3", 3, time.Date(2024, 2, 4, 9, 0, 0, 0, time.UTC)},
+		// Months without a 31st have no occurrence
+		{"FREQ=MONTHLY", 3, time.Date(2024, 5, 31, 9, 0, 0, 0, time.UTC)},
+		// Expanded only up to until
+		{"FREQ=WEEKLY", 18, time.Date(2024, 5, 29, 9, 0, 0, 0, time.UTC)},
+		// Unsupported rules block their first occurrence only
+		{"FREQ=MONTHLY;BYDAY=-1FR", 1, time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		periods, err := Busy([]byte(event(tt.rule)), until)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.rule, err)
+			continue
+		}
+		if len(periods) != tt.count || !periods[len(periods)-1].Start.Equal(tt.last) {
+			t.Errorf("%s: expected %d occurrences ending %v, got %v", tt.rule, tt.count, tt.last, periods)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is the time from Start up to, but not including, End
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// maxOccurrences bounds the expansion of a single recurring event
+const maxOccurrences = 100000
+
+// property is a content line: NAME;PARAM=value:VALUE
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// event is what Busy needs to know about a VEVENT
+type event struct {
+	uid          string
+	start        time.Time
+	allDay       bool
+	end          time.Time
+	duration     time.Duration
+	hasEnd       bool
+	transparent  bool
+	cancelled    bool
+	rrule        string
+	exdates      []time.Time
+	recurrenceID time.Time
+}
+
+// Busy returns the periods the calendar in data blocks up to until: the events that are neither transparent nor
+// cancelled, with daily, weekly, monthly and yearly recurrences expanded, and the busy times of free/busy components.
+// All-day events are left out. Recurrence rules with BYMONTHDAY, BYSETPOS and the like only block their first
+// occurrence.
+func Busy(data []byte, until time.Time) ([]Period, error) {
+	lines := unfold(string(data))
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "BEGIN:VCALENDAR") {
+		return nil, errors.New("not an iCalendar file, expected BEGIN:VCALENDAR")
+	}
+
+	var events []event
+	var periods []Period
+	var components []string
+	var current *event
+	for number, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number+1, err)
+		}
+
+		switch prop.name {
+		case "BEGIN":
+			components = append(components, strings.ToUpper(prop.value))
+			if components[len(components)-1] == "VEVENT" {
+				current = &event{}
+			}
+			continue
+		case "END":
+			if len(components) == 0 {
+				return nil, fmt.Errorf("line %d: END:%s without BEGIN", number+1, prop.value)
+			}
+			if components[len(components)-1] == "VEVENT" && current != nil {
+				events = append(events, *current)
+				current = nil
+			}
+			components = components[:len(components)-1]
+			continue
+		}
+		if len(components) == 0 {
+			continue
+		}
+
+		switch components[len(components)-1] {
+		case "VEVENT":
+			if err := current.set(prop); err != nil {
+				return nil, fmt.Errorf("line %d: %w", number+1, err)
+			}
+		case "VFREEBUSY":
+			if prop.name != "FREEBUSY" || strings.EqualFold(prop.params["FBTYPE"], "FREE") {
+				continue
+			}
+			for _, value := range strings.Split(prop.value, ",") {
+				period, err := parsePeriod(value, prop.params)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", number+1, err)
+				}
+				periods = append(periods, period)
+			}
+		}
+	}
+
+	// Occurrences moved or cancelled individually replace the ones the rule generates
+	overridden := make(map[string]bool)
+	for _, e := range events {
+		if !e.recurrenceID.IsZero() {
+			overridden[e.uid+"\x00"+e.recurrenceID.UTC().Format(timeFormat)] = true
+		}
+	}
+
+	for _, e := range events {
+		if e.start.IsZero() {
+			return nil, fmt.Errorf("event %q has no DTSTART", e.uid)
+		}
+		if e.allDay || e.transparent || e.cancelled {
+			continue
+		}
+		length := e.duration
+		if e.hasEnd {
+			length = e.end.Sub(e.start)
+		}
+		if length <= 0 {
+			continue
+		}
+		starts, err := e.occurrences(until)
+		if err != nil {
+			return nil, fmt.Errorf("event %q: %w", e.uid, err)
+		}
+		for _, start := range starts {
+			if e.recurrenceID.IsZero() && overridden[e.uid+"\x00"+start.UTC().Format(timeFormat)] {
+				continue
+			}
+			periods = append(periods, Period{Start: start, End: start.Add(length)})
+		}
+	}
+
+	slices.SortFunc(periods, func(a, b Period) int { return a.Start.Compare(b.Start) })
+	return periods, nil
+}
+
+// set records a property of the event
+func (e *event) set(prop property) error {
+	var err error
+	switch prop.name {
+	case "UID":
+		e.uid = prop.value
+	case "DTSTART":
+		e.start, e.allDay, err = parseTime(prop.value, prop.params)
+	case "DTEND":
+		e.end, _, err = parseTime(prop.value, prop.params)
+		e.hasEnd = true
+	case "DURATION":
+		e.duration, err = parseDuration(prop.value)
+	case "TRANSP":
+		e.transparent = strings.EqualFold(prop.value, "TRANSPARENT")
+	case "STATUS":
+		e.cancelled = strings.EqualFold(prop.value, "CANCELLED")
+	case "RRULE":
+		e.rrule = prop.value
+	case "EXDATE":
+		for _, value := range strings.Split(prop.value, ",") {
+			t, _, err := parseTime(value, prop.params)
+			if err != nil {
+				return fmt.Errorf("invalid EXDATE: %w", err)
+			}
+			e.exdates = append(e.exdates, t)
+		}
+	case "RECURRENCE-ID":
+		e.recurrenceID, _, err = parseTime(prop.value, prop.params)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", prop.name, err)
+	}
+	return nil
+}
+
+// occurrences returns the start of every occurrence of the event up to until
+func (e event) occurrences(until time.Time) ([]time.Time, error) {
+	if e.rrule == "" {
+		return []time.Time{e.start}, nil
+	}
+	rule := make(map[string]string)
+	for _, part := range strings.Split(e.rrule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		rule[strings.ToUpper(key)] = value
+	}
+	freq := strings.ToUpper(rule["FREQ"])
+
+	interval := 1
+	if value, ok := rule["INTERVAL"]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid RRULE INTERVAL %q", value)
+		}
+		interval = n
+	}
+	count := maxOccurrences
+	if value, ok := rule["COUNT"]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid RRULE COUNT %q", value)
+		}
+		count = min(n, maxOccurrences)
+	}
+	if value, ok := rule["UNTIL"]; ok {
+		t, allDay, err := parseTime(value, map[string]string{"TZID": e.start.Location().String()})
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE UNTIL: %w", err)
+		}
+		if allDay {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		if t.Before(until) {
+			until = t
+		}
+	}
+	for key := range rule {
+		if key != "FREQ" && key != "INTERVAL" && key != "COUNT" && key != "UNTIL" && key != "WKST" && !(key == "BYDAY" && freq == "WEEKLY") {
+			return []time.Time{e.start}, nil
+		}
+	}
+
+	// Each period of the rule, starting with the one DTSTART is in, holds the occurrences at these day offsets
+	offsets := []int{0}
+	first := e.start
+	var step func(t time.Time, n int) time.Time
+	switch freq {
+	case "DAILY":
+		step = func(t time.Time, n int) time.Time { return t.AddDate(0, 0, n*interval) }
+	case "WEEKLY":
+		step = func(t time.Time, n int) time.Time { return t.AddDate(0, 0, 7*n*interval) }
+		if value, ok := rule["BYDAY"]; ok {
+			days, err := parseWeekdays(value)
+			if err != nil {
+				return nil, err
+			}
+			// Weeks start on Monday
+			monday := (int(e.start.Weekday()) + 6) % 7
+			first = e.start.AddDate(0, 0, -monday)
+			offsets = nil
+			for _, day := range days {
+				offsets = append(offsets, (int(day)+6)%7)
+			}
+			slices.Sort(offsets)
+		}
+	case "MONTHLY":
+		step = func(t time.Time, n int) time.Time { return t.AddDate(0, n*interval, 0) }
+	case "YEARLY":
+		step = func(t time.Time, n int) time.Time { return t.AddDate(n*interval, 0, 0) }
+	default:
+		return []time.Time{e.start}, nil
+	}
+
+	var starts []time.Time
+	found := 0
+	for n := 0; found < count && n < maxOccurrences; n++ {
+		period := step(first, n)
+		if period.After(until) {
+			break
+		}
+		for _, offset := range offsets {
+			start := period.AddDate(0, 0, offset)
+			// AddDate normalizes Jan 31 + 1 month to Mar 2; such months have no occurrence
+			if (freq == "MONTHLY" || freq == "YEARLY") && start.Day() != e.start.Day() {
+				continue
+			}
+			if start.Before(e.start) {
+				continue
+			}
+			if start.After(until) || found >= count {
+				break
+			}
+			found++
+			if !slices.ContainsFunc(e.exdates, start.Equal) {
+				starts = append(starts, start)
+			}
+		}
+	}
+	return starts, nil
+}
+
+// unfold joins continuation lines, which start with a space or a tab, to the line before them
+func unfold(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.TrimPrefix(data, "\ufeff")
+	var lines []string
+	for _, line := range strings.Split(data, "\n") {
+		if n := len(lines); n > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[n-1] += line[1:]
+			continue
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+	return lines
+}
+
+// parseLine splits a content line into its name, parameters and value. Parameter values may be quoted.
+func parseLine(line string) (property, error) {
+	prop := property{params: make(map[string]string)}
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("invalid content line %q", line)
+	}
+	prop.value = line[colon+1:]
+	parts := strings.Split(line[:colon], ";")
+	prop.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// parseTime parses a DATE or DATE-TIME value: UTC with a trailing Z, in the zone of the TZID parameter, or floating
+// in the local zone. Zones Go doesn't know, such as Windows zone names, are taken as the local zone.
+func parseTime(value string, params map[string]string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(params["VALUE"], "DATE") || len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(timeFormat, value)
+		return t, false, err
+	}
+	loc := time.Local
+	if tzid := strings.TrimPrefix(params["TZID"], "/"); tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// durationPattern matches the DURATION values of RFC 5545, e.g. PT1H30M, P1D or P2W
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration parses a DURATION value
+func parseDuration(value string) (time.Duration, error) {
+	match := durationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if match[i+2] != "" {
+			n, _ := strconv.Atoi(match[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if match[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// parsePeriod parses a PERIOD value, start/end or start/duration
+func parsePeriod(value string, params map[string]string) (Period, error) {
+	from, to, ok := strings.Cut(value, "/")
+	if !ok {
+		return Period{}, fmt.Errorf("invalid period %q", value)
+	}
+	start, _, err := parseTime(from, params)
+	if err != nil {
+		return Period{}, fmt.Errorf("invalid period %q: %w", value, err)
+	}
+	if strings.HasPrefix(to, "P") || strings.HasPrefix(to, "+P") {
+		d, err := parseDuration(to)
+		if err != nil {
+			return Period{}, err
+		}
+		return Period{Start: start, End: start.Add(d)}, nil
+	}
+	end, _, err := parseTime(to, params)
+	if err != nil {
+		return Period{}, fmt.Errorf("invalid period %q: %w", value, err)
+	}
+	return Period{Start: start, End: end}, nil
+}
+
+// parseWeekdays parses the BYDAY list of a weekly rule, e.g. MO,WE,FR
+func parseWeekdays(value string) ([]time.Weekday, error) {
+	names := map[string]time.Weekday{"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+		"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday}
+	var days []time.Weekday
+	for _, name := range strings.Split(value, ",") {
+		day, ok := names[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("invalid RRULE BYDAY %q", value)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"slices"
+
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// lintIdentity lists the unpushed commits whose author isn't the configured identity: NEW_COMMIT_AUTHOR_NAME/EMAIL,
+// the AUTHOR_MAP entry of the repository or, for whatever they leave out, the repository's git config. With --fix
+// the author of those repositories' unpushed commits is corrected and nothing else changes.
+func (b *batch) lintIdentity(ctx context.Context, command string, gitRepos iter.Seq[string]) {
+	fmt.Println("Checking the author of unpushed commits...")
+	fmt.Println()
+
+	var flagged []string
+	checked, flaggedCommits := 0, 0
+	for repo := range gitRepos {
+		if ctx.Err() != nil {
+			break
+		}
+
+		commits, err := git.GetUnpushedCommits(ctx, repo, b.parentBranch(ctx, repo))
+		if err != nil {
+			fmt.Printf("Warning: Could not check commits for %s: %v\n", repo, err)
+			continue
+		}
+		opts := b.rewriteOptions(ctx, repo)
+		identity := cadence.Identity{Name: opts.AuthorName, Email: opts.AuthorEmail}
+		mismatched, err := cadence.MismatchedAuthors(ctx, repo, commits, identity)
+		if err != nil {
+			fmt.Printf("Warning: Could not check the authors of %s: %v\n", repo, err)
+			continue
+		}
+		checked++
+
+		if len(mismatched) == 0 {
+			fmt.Printf("✅ %s: All %d unpushed commits have the expected author\n", repo, len(commits))
+			continue
+		}
+		flagged = append(flagged, repo)
+		flaggedCommits += len(mismatched)
+		fmt.Printf("❌ %s: %d of %d unpushed commits have a different author\n", repo, len(mismatched), len(commits))
+		for _, commit := range mismatched {
+			fmt.Printf("   • %s %s <%s> - %s\n", commit.Hash, commit.Author, commit.Email, commit.Subject)
+		}
+	}
+
+	fmt.Printf("\nSummary: %d unpushed commits in %d of %d repositories have a different author\n", flaggedCommits, len(flagged), checked)
+	if len(flagged) == 0 || ctx.Err() != nil {
+		return
+	}
+	if !FixIdentity {
+		fmt.Println("Rerun with --fix to correct them")
+		return
+	}
+
+	fmt.Println()
+	b.reportCadence(ctx, command, b.fixAuthors(ctx, slices.Values(flagged)))
+}
+
+// identityOnlyOptions returns opts for a rewrite that only corrects the author, keeping every date and message
+// exactly as they are
+func identityOnlyOptions(opts cadence.RewriteOptions) cadence.RewriteOptions {
+	opts.KeepDates = true
+	opts.PreserveAuthor, opts.RespectMailmap, opts.KeepCommitterDate = false, false, false
+	opts.CoAuthors, opts.SignOff, opts.MessageTemplate, opts.OriginalDates = nil, false, nil, false
+	return opts
+}
+
+// fixAuthors recreates the unpushed commits of every repository with the configured author, keeping their dates and
+// messages exactly as they are. It is the fix_author command and lint_identity --fix.
+func (b *batch) fixAuthors(ctx context.Context, gitRepos iter.Seq[string]) cadenceSummary {
+	fmt.Println("Correcting the author of unpushed commits...")
+
+	fix := *b
+	fix.identityOnly = true
+	return fix.runCadence(ctx, gitRepos, nil, func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return cadence.Plan{}.Include(target.Commits)
+	})
+}
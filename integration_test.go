@@ -1,13 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
-	"code-cadence/git"
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/push"
+	"github.com/egor-markin/code-cadence/scan"
 )
 
 func TestIntegrationCommitCadence(t *testing.T) {
@@ -16,8 +27,7 @@ func TestIntegrationCommitCadence(t *testing.T) {
 
 	// Apply test configuration
 	config := DefaultTestConfig()
-	config.ApplyTestConfig()
-	defer config.RestoreConfig()
+	b := config.Batch()
 
 	// Create test repository
 	repoPath := helper.CreateGitRepo("test-repo")
@@ -35,7 +45,7 @@ func TestIntegrationCommitCadence(t *testing.T) {
 
 	// Run commit cadence
 	gitRepos := []string{repoPath}
-	commitCadence(gitRepos)
+	b.commitCadence(context.Background(), slices.Values(gitRepos))
 
 	// Verify commits were updated
 	updatedCommits := helper.GetCommits(repoPath)
@@ -49,27 +59,98 @@ func TestIntegrationCommitCadence(t *testing.T) {
 		}
 
 		hour := commitTime.Hour()
-		if hour < WorkDayStartHour || hour >= WorkDayEndHour {
+		if hour < b.WorkDayStartHour || hour >= b.WorkDayEndHour {
 			t.Errorf("Commit %d time %s is outside work hours (%d-%d)",
-				i, commitTime.Format("15:04"), WorkDayStartHour, WorkDayEndHour)
+				i, commitTime.Format("15:04"), b.WorkDayStartHour, b.WorkDayEndHour)
 		}
 	}
 }
 
+func TestIntegrationMaxRewriteCommits(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	config.MaxRewriteCommits = 2
+	b := config.Batch()
+	defer func() { Force = false }()
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	baseTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	helper.CreateTestCommits(repoPath, 3, baseTime)
+	before := helper.GetCommits(repoPath)
+
+	planByDay := func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return b.scheduleConfig().PlanByDay(target.Commits)
+	}
+
+	if _, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout); err == nil {
+		t.Fatal("Expected the repository to be skipped above MAX_REWRITE_COMMITS")
+	}
+	if after := helper.GetCommits(repoPath); after[0].Hash != before[0].Hash {
+		t.Error("Expected the skipped repository to be left untouched")
+	}
+
+	Force = true
+	updated, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout)
+	if err != nil {
+		t.Fatalf("Expected --force to rewrite the repository: %v", err)
+	}
+	if updated != 3 {
+		t.Errorf("Expected 3 commits updated, got %d", updated)
+	}
+}
+
+func TestIntegrationPublishedCommitsNotRewritten(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	baseTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	helper.CreateTestCommits(repoPath, 3, baseTime)
+
+	// The commits look unpushed relative to origin/main, but a co-worker's branch already has one of them
+	cmd := exec.Command("git", "update-ref", "refs/remotes/origin/feature", "HEAD~1")
+	cmd.Dir = repoPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("update-ref failed: %v\nOutput: %s", err, output)
+	}
+	before := helper.GetCommits(repoPath)
+
+	planByDay := func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return b.scheduleConfig().PlanByDay(target.Commits)
+	}
+	_, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout)
+	if !errors.Is(err, cadence.ErrPublished) {
+		t.Fatalf("Expected ErrPublished, got %v", err)
+	}
+	if after := helper.GetCommits(repoPath); after[0].Hash != before[0].Hash {
+		t.Error("Expected the repository to be left untouched")
+	}
+}
+
 func TestIntegrationCommitCadenceSpan(t *testing.T) {
 	helper := NewTestHelper(t)
 	defer helper.Cleanup()
 
 	// Apply test configuration
 	config := DefaultTestConfig()
-	config.ApplyTestConfig()
-	defer config.RestoreConfig()
+	b := config.Batch()
 
 	// Create test repository
 	repoPath := helper.CreateGitRepo("test-repo")
 
-	// Create initial commit first
+	// Create initial commit first, dated before the test commits so the span starts there
 	helper.CreateCommit(repoPath, "initial.txt", "initial content", "Initial commit")
+	cmd := exec.Command("git", "commit", "--amend", "--no-edit", "--date=2023-12-29T12:00:00")
+	cmd.Dir = repoPath
+	cmd.Env = append(os.Environ(), "GIT_COMMITTER_DATE=2023-12-29T12:00:00")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to backdate initial commit: %v\nOutput: %s", err, output)
+	}
 
 	// Create test commits spanning multiple days
 	baseTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
@@ -81,7 +162,7 @@ func TestIntegrationCommitCadenceSpan(t *testing.T) {
 
 	// Run commit cadence span
 	gitRepos := []string{repoPath}
-	commitCadenceSpan(gitRepos)
+	b.commitCadenceSpan(context.Background(), slices.Values(gitRepos))
 
 	// Verify commits were updated
 	updatedCommits := helper.GetCommits(repoPath)
@@ -100,9 +181,9 @@ func TestIntegrationCommitCadenceSpan(t *testing.T) {
 
 		// Verify time is within work hours
 		hour := commitTime.Hour()
-		if hour < WorkDayStartHour || hour >= WorkDayEndHour {
+		if hour < b.WorkDayStartHour || hour >= b.WorkDayEndHour {
 			t.Errorf("Commit time %s is outside work hours (%d-%d)",
-				commitTime.Format("15:04"), WorkDayStartHour, WorkDayEndHour)
+				commitTime.Format("15:04"), b.WorkDayStartHour, b.WorkDayEndHour)
 		}
 	}
 
@@ -112,19 +193,133 @@ func TestIntegrationCommitCadenceSpan(t *testing.T) {
 	}
 }
 
+func TestIntegrationCrossRepoSchedule(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+
+	// Without jitter both repositories would get exactly the same times
+	var gitRepos []string
+	for _, name := range []string{"api", "web"} {
+		repoPath := helper.CreateGitRepo(name)
+		helper.CreateTestCommits(repoPath, 3, time.Date(2024, 1, 8, 5, 0, 0, 0, time.UTC))
+		gitRepos = append(gitRepos, repoPath)
+	}
+
+	helper.CaptureOutput(func() {
+		b.run(context.Background(), CmdCommitCadence, helper.TempDir, slices.Values(gitRepos))
+	})
+	if b.schedule != nil {
+		t.Errorf("Expected the schedule to end with the run")
+	}
+
+	var times [2][]time.Time
+	for i, repoPath := range gitRepos {
+		for _, commit := range helper.GetCommits(repoPath) {
+			commitTime, err := commit.Time()
+			if err != nil {
+				t.Fatalf("Failed to parse commit time: %v", err)
+			}
+			times[i] = append(times[i], commitTime)
+		}
+	}
+	for _, api := range times[0] {
+		for _, web := range times[1] {
+			if distance := api.Sub(web).Abs(); distance < 10*time.Minute {
+				t.Errorf("Commits at %s and %s are only %s apart across repositories", api.Format(time.TimeOnly), web.Format(time.TimeOnly), distance)
+			}
+		}
+	}
+}
+
+func TestIntegrationRepoOverrides(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.RepoOverrides = "oss/*=20-23"
+	b.repoOverrides, _ = parseHoursMap(b.RepoOverrides)
+
+	work := helper.CreateGitRepo(filepath.Join("clientA", "api"))
+	oss := helper.CreateGitRepo(filepath.Join("oss", "tool"))
+	for _, repoPath := range []string{work, oss} {
+		helper.CreateTestCommits(repoPath, 3, time.Date(2024, 1, 8, 5, 0, 0, 0, time.UTC))
+	}
+
+	output := helper.CaptureOutput(func() {
+		b.commitCadence(context.Background(), slices.Values([]string{work, oss}))
+	})
+	if !strings.Contains(output, "Work hours: 20:00-23:00 (REPO_OVERRIDES oss/*)") {
+		t.Errorf("Expected the overridden work hours to be shown\nOutput:\n%s", output)
+	}
+
+	for repoPath, hours := range map[string][2]int{work: {9, 17}, oss: {20, 23}} {
+		for _, commit := range helper.GetCommits(repoPath) {
+			commitTime, err := commit.Time()
+			if err != nil {
+				t.Fatalf("Failed to parse commit time: %v", err)
+			}
+			if commitTime.Hour() < hours[0] || commitTime.Hour() >= hours[1] {
+				t.Errorf("Commit %s of %s at %s is outside %d-%d", commit.Hash, repoPath, commitTime.Format(time.TimeOnly), hours[0], hours[1])
+			}
+		}
+	}
+}
+
+func TestIntegrationPaths(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	Paths = patternList{"file1.txt", "file2.txt"}
+	defer func() { Paths = nil }()
+
+	repoPath := helper.CreateGitRepo("monorepo")
+	helper.CreateTestCommits(repoPath, 3, time.Date(2024, 1, 8, 5, 0, 0, 0, time.UTC))
+
+	output := helper.CaptureOutput(func() {
+		b.commitCadence(context.Background(), slices.Values([]string{repoPath}))
+	})
+	if !strings.Contains(output, "Keeping the times of 1 commits not touching file1.txt,file2.txt (--paths)") {
+		t.Errorf("Expected the commit outside the paths to be reported\nOutput:\n%s", output)
+	}
+
+	for _, commit := range helper.GetCommits(repoPath) {
+		commitTime, err := commit.Time()
+		if err != nil {
+			t.Fatalf("Failed to parse commit time: %v", err)
+		}
+		switch commit.Subject {
+		case "Test commit 0":
+			if commitTime.Hour() != 5 {
+				t.Errorf("Expected the commit outside the paths to keep 05:00, got %s", commitTime.Format(time.TimeOnly))
+			}
+		case "Test commit 1", "Test commit 2":
+			if commitTime.Hour() < 9 || commitTime.Hour() >= 17 {
+				t.Errorf("Expected %q to be rescheduled into work hours, got %s", commit.Subject, commitTime.Format(time.TimeOnly))
+			}
+		}
+	}
+}
+
 func TestIntegrationPushDisableEnable(t *testing.T) {
 	helper := NewTestHelper(t)
 	defer helper.Cleanup()
+	b := &batch{settings: loadConfig()}
 
 	// Create test repository
 	repoPath := helper.CreateGitRepo("test-repo")
 
 	// Test disabling push
 	gitRepos := []string{repoPath}
-	disablePushForAll(gitRepos)
+	b.disablePushForAll(context.Background(), slices.Values(gitRepos))
 
 	// Verify push is disabled
-	isDisabled, err := isPushDisabled(repoPath)
+	isDisabled, err := push.IsDisabled(context.Background(), repoPath)
 	if err != nil {
 		t.Fatalf("Failed to check push status: %v", err)
 	}
@@ -133,10 +328,10 @@ func TestIntegrationPushDisableEnable(t *testing.T) {
 	}
 
 	// Test enabling push
-	enablePushForAll(gitRepos)
+	b.enablePushForAll(context.Background(), slices.Values(gitRepos))
 
 	// Verify push is enabled
-	isDisabled, err = isPushDisabled(repoPath)
+	isDisabled, err = push.IsDisabled(context.Background(), repoPath)
 	if err != nil {
 		t.Fatalf("Failed to check push status: %v", err)
 	}
@@ -148,21 +343,22 @@ func TestIntegrationPushDisableEnable(t *testing.T) {
 func TestIntegrationPushStatus(t *testing.T) {
 	helper := NewTestHelper(t)
 	defer helper.Cleanup()
+	b := &batch{settings: loadConfig()}
 
 	// Create test repositories
 	repo1 := helper.CreateGitRepo("repo1")
 	repo2 := helper.CreateGitRepo("repo2")
 
 	// Disable push for repo1
-	disableGitPush(repo1)
+	push.Disable(context.Background(), repo1)
 
 	// Test push status
 	gitRepos := []string{repo1, repo2}
-	showPushStatus(gitRepos)
+	b.showPushStatus(context.Background(), slices.Values(gitRepos))
 
 	// Verify status
-	isDisabled1, _ := isPushDisabled(repo1)
-	isDisabled2, _ := isPushDisabled(repo2)
+	isDisabled1, _ := push.IsDisabled(context.Background(), repo1)
+	isDisabled2, _ := push.IsDisabled(context.Background(), repo2)
 
 	if !isDisabled1 {
 		t.Error("Expected repo1 to have push disabled")
@@ -175,6 +371,7 @@ func TestIntegrationPushStatus(t *testing.T) {
 func TestIntegrationCommitStatus(t *testing.T) {
 	helper := NewTestHelper(t)
 	defer helper.Cleanup()
+	b := &batch{settings: loadConfig()}
 
 	// Create test repository
 	repoPath := helper.CreateGitRepo("test-repo")
@@ -188,7 +385,7 @@ func TestIntegrationCommitStatus(t *testing.T) {
 
 	// Test commit status
 	gitRepos := []string{repoPath}
-	showCommitStatus(gitRepos)
+	b.showCommitStatus(context.Background(), slices.Values(gitRepos))
 
 	// Verify commits exist (should be 4: initial + 3 test commits)
 	commits := helper.GetCommits(repoPath)
@@ -214,7 +411,7 @@ func TestIntegrationFindGitRepositories(t *testing.T) {
 	os.MkdirAll(nonRepo, 0755)
 
 	// Test finding repositories
-	repos, err := findGitRepositories(helper.TempDir)
+	repos, err := scan.FindRepositories(helper.TempDir, scan.Options{})
 	if err != nil {
 		t.Fatalf("Failed to find git repositories: %v", err)
 	}
@@ -243,11 +440,6 @@ func TestIntegrationMergeCommits(t *testing.T) {
 	helper := NewTestHelper(t)
 	defer helper.Cleanup()
 
-	// Apply test configuration
-	config := DefaultTestConfig()
-	config.ApplyTestConfig()
-	defer config.RestoreConfig()
-
 	// Create test repository
 	repoPath := helper.CreateGitRepo("test-repo")
 
@@ -293,6 +485,74 @@ func TestIntegrationMergeCommits(t *testing.T) {
 	}
 }
 
+func TestIntegrationRewriteMergedBranches(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.RewriteMergedBranches = true
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	gitCmd := func(date string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoPath
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	commitFile := func(name, date string) {
+		if err := os.WriteFile(filepath.Join(repoPath, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		gitCmd(date, "add", name)
+		gitCmd(date, "commit", "-m", "Add "+name)
+	}
+
+	// A pushed base, then a late-night commit on a feature branch merged the next day
+	commitFile("base.txt", "2024-01-01T12:00:00+0000")
+	mainBranch := gitCmd("", "branch", "--show-current")
+	gitCmd("", "remote", "add", "origin", filepath.Join(helper.TempDir, "origin.git"))
+	gitCmd("", "update-ref", "refs/remotes/origin/"+mainBranch, "HEAD")
+	commitFile("main.txt", "2024-01-02T12:00:00+0000")
+	gitCmd("", "checkout", "-b", "feature")
+	commitFile("feature.txt", "2024-01-02T23:30:00+0000")
+	originalFeature := gitCmd("", "rev-parse", "HEAD")
+	gitCmd("", "checkout", mainBranch)
+	commitFile("other.txt", "2024-01-03T12:00:00+0000")
+	gitCmd("2024-01-03T13:00:00+0000", "merge", "--no-ff", "-m", "Merge feature", "feature")
+
+	b.commitCadence(context.Background(), slices.Values([]string{repoPath}))
+
+	parents := strings.Fields(gitCmd("", "log", "-1", "--format=%P"))
+	if len(parents) != 2 {
+		t.Fatalf("Expected HEAD to still be a merge, got parents %v", parents)
+	}
+	if parents[1] == originalFeature {
+		t.Fatal("Expected the merged feature commit to be rewritten")
+	}
+	if files := gitCmd("", "show", "--format=", "--name-only", parents[1]); files != "feature.txt" {
+		t.Errorf("Expected the rewritten feature commit to keep its changes, got %q", files)
+	}
+
+	hour, err := strconv.Atoi(gitCmd("", "log", "-1", "--format=%ad", "--date=format:%H", parents[1]))
+	if err != nil {
+		t.Fatalf("Failed to read commit hour: %v", err)
+	}
+	if hour < b.WorkDayStartHour || hour >= b.WorkDayEndHour {
+		t.Errorf("Expected the feature commit within work hours, got %d:00", hour)
+	}
+
+	// The rewritten feature commit must sit on the rewritten main.txt commit, not on the original one
+	base := gitCmd("", "rev-parse", parents[1]+"^")
+	if expected := gitCmd("", "rev-parse", "HEAD^1^"); base != expected {
+		t.Errorf("Expected the feature commit to be based on the rewritten %s, got %s", expected, base)
+	}
+}
+
 func TestIntegrationBackupCreation(t *testing.T) {
 	helper := NewTestHelper(t)
 	defer helper.Cleanup()
@@ -300,8 +560,7 @@ func TestIntegrationBackupCreation(t *testing.T) {
 	// Apply test configuration with backup enabled
 	config := DefaultTestConfig()
 	config.CreateBackup = true
-	config.ApplyTestConfig()
-	defer config.RestoreConfig()
+	b := config.Batch()
 
 	// Create test repository
 	repoPath := helper.CreateGitRepo("test-repo")
@@ -309,7 +568,7 @@ func TestIntegrationBackupCreation(t *testing.T) {
 
 	// Test backup creation
 	gitRepos := []string{repoPath}
-	err := createBackupsForRepos(gitRepos)
+	err := b.createBackupsForRepos(context.Background(), gitRepos)
 	if err != nil {
 		t.Fatalf("Failed to create backups: %v", err)
 	}
@@ -343,14 +602,13 @@ func TestIntegrationWeekdaySkipping(t *testing.T) {
 	// Apply test configuration with weekend skipping
 	config := DefaultTestConfig()
 	config.SkipWeekDays = "Sat,Sun"
-	config.ApplyTestConfig()
-	defer config.RestoreConfig()
+	b := config.Batch()
 
 	// Test weekday enumeration
 	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) // Monday
 	end := time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)   // Sunday
 
-	days := enumerateDaysSkipping(start, end, skipWeekdaysSet)
+	days := cadence.EnumerateDaysSkipping(start, end, b.skipWeekdays)
 
 	// Should have 5 weekdays (Mon-Fri)
 	if len(days) != 5 {
@@ -372,12 +630,11 @@ func TestIntegrationCommitTimeGeneration(t *testing.T) {
 	// Apply test configuration
 	config := DefaultTestConfig()
 	config.JitterMinutes = 0 // Disable jitter for predictable testing
-	config.ApplyTestConfig()
-	defer config.RestoreConfig()
+	b := config.Batch()
 
 	// Test single commit
 	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
-	times := generateCommitTimesForDay(day, 1, nil)
+	times := b.scheduleConfig().GenerateCommitTimesForDay(day, 1, nil)
 
 	if len(times) != 1 {
 		t.Errorf("Expected 1 time, got %d", len(times))
@@ -385,13 +642,13 @@ func TestIntegrationCommitTimeGeneration(t *testing.T) {
 
 	// Verify time is within work hours
 	hour := times[0].Hour()
-	if hour < WorkDayStartHour || hour >= WorkDayEndHour {
+	if hour < b.WorkDayStartHour || hour >= b.WorkDayEndHour {
 		t.Errorf("Time %s is outside work hours (%d-%d)",
-			times[0].Format("15:04"), WorkDayStartHour, WorkDayEndHour)
+			times[0].Format("15:04"), b.WorkDayStartHour, b.WorkDayEndHour)
 	}
 
 	// Test multiple commits
-	times = generateCommitTimesForDay(day, 3, nil)
+	times = b.scheduleConfig().GenerateCommitTimesForDay(day, 3, nil)
 
 	if len(times) != 3 {
 		t.Errorf("Expected 3 times, got %d", len(times))
@@ -408,9 +665,9 @@ func TestIntegrationCommitTimeGeneration(t *testing.T) {
 	// Verify all times are within work hours
 	for i, timeVal := range times {
 		hour := timeVal.Hour()
-		if hour < WorkDayStartHour || hour >= WorkDayEndHour {
+		if hour < b.WorkDayStartHour || hour >= b.WorkDayEndHour {
 			t.Errorf("Time %d (%s) is outside work hours (%d-%d)",
-				i, timeVal.Format("15:04"), WorkDayStartHour, WorkDayEndHour)
+				i, timeVal.Format("15:04"), b.WorkDayStartHour, b.WorkDayEndHour)
 		}
 	}
 }
@@ -423,13 +680,13 @@ func TestIntegrationErrorHandling(t *testing.T) {
 	invalidDir := "/nonexistent/directory"
 
 	// Test finding repositories in invalid directory
-	_, err := findGitRepositories(invalidDir)
+	_, err := scan.FindRepositories(invalidDir, scan.Options{})
 	if err == nil {
 		t.Error("Expected error for invalid directory")
 	}
 
 	// Test git operations on invalid directory
-	_, err = git.GetUnpushedCommits(invalidDir, "origin/main")
+	_, err = git.GetUnpushedCommits(context.Background(), invalidDir, "origin/main")
 	if err == nil {
 		t.Error("Expected error for git operations on invalid directory")
 	}
@@ -438,7 +695,7 @@ func TestIntegrationErrorHandling(t *testing.T) {
 	emptyDir := filepath.Join(helper.TempDir, "empty")
 	os.MkdirAll(emptyDir, 0755)
 
-	repos, err := findGitRepositories(emptyDir)
+	repos, err := scan.FindRepositories(emptyDir, scan.Options{})
 	if err != nil {
 		t.Fatalf("Unexpected error for empty directory: %v", err)
 	}
@@ -451,6 +708,7 @@ func TestIntegrationErrorHandling(t *testing.T) {
 func TestIntegrationConcurrentOperations(t *testing.T) {
 	helper := NewTestHelper(t)
 	defer helper.Cleanup()
+	b := &batch{settings: loadConfig()}
 
 	// Create multiple repositories
 	var repos []string
@@ -461,11 +719,11 @@ func TestIntegrationConcurrentOperations(t *testing.T) {
 	}
 
 	// Test concurrent push operations
-	disablePushForAll(repos)
+	b.disablePushForAll(context.Background(), slices.Values(repos))
 
 	// Verify all repositories have push disabled
 	for _, repo := range repos {
-		isDisabled, err := isPushDisabled(repo)
+		isDisabled, err := push.IsDisabled(context.Background(), repo)
 		if err != nil {
 			t.Fatalf("Failed to check push status for %s: %v", repo, err)
 		}
@@ -475,11 +733,11 @@ func TestIntegrationConcurrentOperations(t *testing.T) {
 	}
 
 	// Test concurrent push enable
-	enablePushForAll(repos)
+	b.enablePushForAll(context.Background(), slices.Values(repos))
 
 	// Verify all repositories have push enabled
 	for _, repo := range repos {
-		isDisabled, err := isPushDisabled(repo)
+		isDisabled, err := push.IsDisabled(context.Background(), repo)
 		if err != nil {
 			t.Fatalf("Failed to check push status for %s: %v", repo, err)
 		}
@@ -495,8 +753,7 @@ func TestIntegrationBackupFolderSkipping(t *testing.T) {
 
 	// Apply test configuration
 	config := DefaultTestConfig()
-	config.ApplyTestConfig()
-	defer config.RestoreConfig()
+	b := config.Batch()
 
 	// Create a regular repository
 	regularRepo := helper.CreateGitRepo("regular-repo")
@@ -517,7 +774,7 @@ func TestIntegrationBackupFolderSkipping(t *testing.T) {
 
 	// Capture output to verify backup folders are skipped
 	// Note: In a real test, you might want to capture stdout to verify the skip messages
-	commitCadence(gitRepos)
+	b.commitCadence(context.Background(), slices.Values(gitRepos))
 
 	// Verify that regular repo was processed (commits should be redistributed)
 	regularCommits := helper.GetCommits(regularRepo)
@@ -531,7 +788,7 @@ func TestIntegrationBackupFolderSkipping(t *testing.T) {
 	helper.AssertCommitCount(backupCommits2, 1)
 
 	// Test commit_cadence_span with mixed repositories
-	commitCadenceSpan(gitRepos)
+	b.commitCadenceSpan(context.Background(), slices.Values(gitRepos))
 
 	// Verify results are the same (backup folders should still be skipped)
 	regularCommitsAfter := helper.GetCommits(regularRepo)
@@ -543,3 +800,340 @@ func TestIntegrationBackupFolderSkipping(t *testing.T) {
 	backupCommits2After := helper.GetCommits(backupRepo2)
 	helper.AssertCommitCount(backupCommits2After, 1)
 }
+
+func TestIntegrationAmendLast(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	baseTime := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	helper.CreateTestCommits(repoPath, 3, baseTime)
+	before := helper.GetCommits(repoPath)
+
+	if err := b.amendLast(context.Background(), repoPath, "17:42"); err != nil {
+		t.Fatalf("amendLast failed: %v", err)
+	}
+
+	after := helper.GetCommits(repoPath)
+	helper.AssertCommitCount(after, 3)
+	if after[0].Hash == before[0].Hash {
+		t.Error("Expected HEAD to be amended")
+	}
+	for i := 1; i < len(after); i++ {
+		if after[i].Hash != before[i].Hash {
+			t.Errorf("Expected commit %d to be untouched, %s became %s", i, before[i].Hash, after[i].Hash)
+		}
+	}
+
+	headTime, err := after[0].Time()
+	if err != nil {
+		t.Fatalf("Failed to parse commit time: %v", err)
+	}
+	originalTime, _ := before[0].Time()
+	if headTime.Format("15:04") != "17:42" || headTime.Format("2006-01-02") != originalTime.Format("2006-01-02") {
+		t.Errorf("Expected HEAD at 17:42 on %s, got %s", originalTime.Format("2006-01-02"), after[0].DateTime)
+	}
+
+	if err := b.amendLast(context.Background(), repoPath, "5pm"); err == nil {
+		t.Error("Expected an invalid --time to be rejected")
+	}
+}
+
+func TestIntegrationLimit(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	Limit = 1
+	defer func() { Limit = 0 }()
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateCommit(repoPath, "initial.txt", "initial content", "Initial commit")
+	baseTime := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	helper.CreateTestCommits(repoPath, 3, baseTime)
+	before := helper.GetCommits(repoPath)
+
+	planByDay := func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return b.scheduleConfig().PlanByDay(target.Commits)
+	}
+	updated, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout)
+	if err != nil {
+		t.Fatalf("cadenceRepo failed: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("Expected only the newest commit to be updated, got %d", updated)
+	}
+
+	after := helper.GetCommits(repoPath)
+	helper.AssertCommitCount(after, len(before))
+	if after[0].Hash == before[0].Hash {
+		t.Error("Expected the newest commit to be rewritten")
+	}
+	for i := 1; i < len(after); i++ {
+		if after[i].Hash != before[i].Hash {
+			t.Errorf("Expected commit %d to be untouched, %s became %s", i, before[i].Hash, after[i].Hash)
+		}
+	}
+}
+
+func TestIntegrationSelectCommits(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	defer func() { selector = nil }()
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateCommit(repoPath, "initial.txt", "initial content", "Initial commit")
+	baseTime := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	helper.CreateTestCommits(repoPath, 3, baseTime)
+	before := helper.GetCommits(repoPath)
+
+	planByDay := func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return b.scheduleConfig().PlanByDay(target.Commits)
+	}
+
+	// Declining the plan leaves the repository alone
+	selector = newCommitSelector(strings.NewReader("\rn"), &strings.Builder{}, nil)
+	if updated, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout); err != nil || updated != 0 {
+		t.Fatalf("Expected nothing to be applied, got %d (%v)", updated, err)
+	}
+	if after := helper.GetCommits(repoPath); after[0].Hash != before[0].Hash {
+		t.Fatal("Expected the declined plan to leave HEAD untouched")
+	}
+
+	// Leave out the middle commit, which is recreated at its original time, then look at the plan and apply it
+	selector = newCommitSelector(strings.NewReader("jj \ry"), &strings.Builder{}, nil)
+	if _, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout); err != nil {
+		t.Fatalf("cadenceRepo failed: %v", err)
+	}
+
+	after := helper.GetCommits(repoPath)
+	helper.AssertCommitCount(after, len(before))
+	if after[1].DateTime != before[1].DateTime {
+		t.Errorf("Expected the excluded commit to keep %s, got %s", before[1].DateTime, after[1].DateTime)
+	}
+	if after[0].DateTime == before[0].DateTime {
+		t.Errorf("Expected the selected commit to be rescheduled from %s", before[0].DateTime)
+	}
+}
+
+func TestIntegrationDivergedBranchNotRewritten(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	defer func() { AllowDiverged = false }()
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	gitCmd := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoPath
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	// A co-worker pushed a commit after the shared base that was never pulled
+	gitCmd("remote", "add", "origin", "https://example.com/repo.git")
+	helper.CreateCommit(repoPath, "base.txt", "base", "Base commit")
+	branch := gitCmd("branch", "--show-current")
+	helper.CreateBranch(repoPath, "coworker")
+	helper.CreateCommit(repoPath, "remote.txt", "remote", "Remote commit")
+	gitCmd("update-ref", "refs/remotes/origin/"+branch, "HEAD")
+	helper.SwitchBranch(repoPath, branch)
+	gitCmd("branch", "-D", "coworker")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC))
+	before := helper.GetCommits(repoPath)
+
+	planByDay := func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return b.scheduleConfig().PlanByDay(target.Commits)
+	}
+	_, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout)
+	if !errors.Is(err, cadence.ErrDiverged) {
+		t.Fatalf("Expected ErrDiverged, got %v", err)
+	}
+	if after := helper.GetCommits(repoPath); after[0].Hash != before[0].Hash {
+		t.Error("Expected the repository to be left untouched")
+	}
+
+	AllowDiverged = true
+	updated, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout)
+	if err != nil {
+		t.Fatalf("Expected --allow-diverged to rewrite the branch: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("Expected 2 commits updated, got %d", updated)
+	}
+}
+
+func TestIntegrationMarkRewritten(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.MarkRewritten = true
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC))
+
+	planByDay := func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return b.scheduleConfig().PlanByDay(target.Commits)
+	}
+	if updated, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout); err != nil || updated != 2 {
+		t.Fatalf("Expected the first run to update 2 commits, got %d (%v)", updated, err)
+	}
+	marks, err := cadence.LoadMarks(context.Background(), repoPath, helper.GetCommits(repoPath))
+	if err != nil || len(marks) != 2 {
+		t.Fatalf("Expected 2 marked commits, got %v (%v)", marks, err)
+	}
+	before := helper.GetCommits(repoPath)
+
+	// A second run only touches the commit made since
+	helper.CreateCommit(repoPath, "later.txt", "later content", "Later commit")
+	if updated, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout); err != nil || updated != 1 {
+		t.Fatalf("Expected the second run to update 1 commit, got %d (%v)", updated, err)
+	}
+	after := helper.GetCommits(repoPath)
+	helper.AssertCommitCount(after, len(before)+1)
+	for i := range before {
+		if after[i+1].Hash != before[i].Hash {
+			t.Errorf("Expected marked commit %s to be untouched, got %s", before[i].Hash, after[i+1].Hash)
+		}
+	}
+}
+
+func TestIntegrationRecordOriginalDatesNote(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.RecordOriginalDates = OriginalDatesNote
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC))
+	original, _, err := git.GetCommitDates(context.Background(), repoPath, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to get commit dates: %v", err)
+	}
+
+	// Rewriting twice must keep the dates the commits were first made with
+	planByDay := func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return b.scheduleConfig().PlanByDay(target.Commits)
+	}
+	for i := 0; i < 2; i++ {
+		if updated, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, os.Stdout); err != nil || updated != 2 {
+			t.Fatalf("Expected run %d to update 2 commits, got %d (%v)", i+1, updated, err)
+		}
+	}
+
+	head, err := git.GetCommitMessage(context.Background(), repoPath, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to get commit message: %v", err)
+	}
+	if strings.Contains(head, git.OriginalDateTrailer) {
+		t.Errorf("Expected the message to be left alone in note mode, got %q", head)
+	}
+	cmd := exec.Command("git", "notes", "--ref", cadence.NotesRef, "show", "HEAD")
+	cmd.Dir = repoPath
+	note, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed to show the note of HEAD: %v", err)
+	}
+	expected := git.OriginalDateTrailer + ": " + original.Format(time.RFC3339)
+	if !strings.Contains(string(note), expected) {
+		t.Errorf("Expected the note to contain %q, got %q", expected, note)
+	}
+	if strings.Contains(string(note), "Rewritten-By") {
+		t.Errorf("Expected no rewrite mark without MARK_REWRITTEN, got %q", note)
+	}
+}
+
+func TestIntegrationPostRewriteHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook is a POSIX shell command")
+	}
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC))
+	hookOutput := filepath.Join(helper.TempDir, "hook.txt")
+	b.PostRewriteHook = `{ echo "$CODE_CADENCE_REWRITTEN $(basename "$CODE_CADENCE_REPO") $(pwd -P)"; cat; } > "` + hookOutput + `"; ` +
+		`echo "notes: $(git notes --ref=` + cadence.NotesRef + ` list | wc -l | tr -d ' ') error: $CODE_CADENCE_ERROR"`
+	// The hook runs after the notes are written
+	b.MarkRewritten = true
+
+	planByDay := func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return b.scheduleConfig().PlanByDay(target.Commits)
+	}
+	before := helper.GetCommits(repoPath)
+	var out bytes.Buffer
+	if updated, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, &out); err != nil || updated != 2 {
+		t.Fatalf("Expected 2 commits to be updated, got %d (%v)", updated, err)
+	}
+	after := helper.GetCommits(repoPath)
+
+	// What the hook prints goes to the repository's output
+	if got := strings.TrimSpace(out.String()); got != "notes: 2 error:" {
+		t.Errorf("Expected the hook to see both notes and no error, got %q", got)
+	}
+
+	output, err := os.ReadFile(hookOutput)
+	if err != nil {
+		t.Fatalf("Expected the hook to run: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	realRepo, _ := filepath.EvalSymlinks(repoPath)
+	if len(lines) != 3 || lines[0] != "2 test-repo "+realRepo {
+		t.Fatalf("Expected the count, repository and 2 rewritten commits, got %q", lines)
+	}
+	// The oldest commit is rewritten first, and both hashes are full
+	for i, line := range lines[1:] {
+		original, rewritten, _ := strings.Cut(line, " ")
+		if len(original) != 40 || len(rewritten) != 40 {
+			t.Errorf("Expected full hashes, got %q", line)
+		}
+		if !strings.HasPrefix(original, before[len(before)-1-i].Hash) || !strings.HasPrefix(rewritten, after[len(after)-1-i].Hash) {
+			t.Errorf("Unexpected line %q, expected %s -> %s", line, before[len(before)-1-i].Hash, after[len(after)-1-i].Hash)
+		}
+	}
+
+	// Nothing to rewrite runs no hook
+	os.Remove(hookOutput)
+	if _, err := b.cadenceRepo(context.Background(), repoPath, func(context.Context, string) func(git.Commit) bool {
+		return func(git.Commit) bool { return true }
+	}, planByDay, os.Stdout); err != nil {
+		t.Fatalf("cadenceRepo failed: %v", err)
+	}
+	if _, err := os.Stat(hookOutput); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no hook run without rewritten commits, got %v", err)
+	}
+
+	// A repository that fails before the rewrite, here over MAX_REWRITE_COMMITS once the marks no longer keep its
+	// commits, still runs the hook with the error
+	b.MarkRewritten, b.MaxRewriteCommits = false, 1
+	out.Reset()
+	if _, err := b.cadenceRepo(context.Background(), repoPath, nil, planByDay, &out); err == nil {
+		t.Fatal("Expected MAX_REWRITE_COMMITS to fail the repository")
+	}
+	if got := out.String(); !strings.Contains(got, "error: ") || !strings.Contains(got, "MAX_REWRITE_COMMITS=1") {
+		t.Errorf("Expected the hook to get the error, got %q", got)
+	}
+	if output, err := os.ReadFile(hookOutput); err != nil || strings.TrimSpace(string(output)) != "0 test-repo "+realRepo {
+		t.Errorf("Expected the hook to run without rewritten commits, got %q (%v)", output, err)
+	}
+}
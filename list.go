@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/egor-markin/code-cadence/backup"
+	"github.com/egor-markin/code-cadence/scan"
+)
+
+// CmdListRepos prints the paths of the repositories found and nothing else
+const CmdListRepos = "list_repos"
+
+// listRepos writes the repositories under rootDir that --only/--skip leave in to w, one per line or NUL-terminated
+// with --print0, so paths with spaces or newlines survive xargs -0, or with the --format template when one is given.
+// Backup folders aren't listed, and nothing else is written, also not what the scan found out about nested or network
+// repositories.
+func (s *settings) listRepos(rootDir string, w io.Writer) error {
+	opts, err := s.scanOptions()
+	if err != nil {
+		return err
+	}
+	result, _, err := s.discoverRepositories(rootDir, opts)
+	if err != nil {
+		return err
+	}
+
+	repos := result.Repos
+	if len(OnlyRepos) > 0 || len(SkipRepos) > 0 {
+		if repos, err = scan.FilterByName(repos, OnlyRepos, SkipRepos); err != nil {
+			return err
+		}
+	}
+
+	terminator := "\n"
+	if Print0 {
+		terminator = "\x00"
+	}
+	for _, repo := range repos {
+		if backup.IsBackupFolder(repo) {
+			continue
+		}
+		if outputFormat != nil {
+			if err := writeRecord(w, newRepoRecord(repo), terminator); err != nil {
+				return err
+			}
+		} else if _, err := fmt.Fprint(w, repo, terminator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
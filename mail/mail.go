@@ -0,0 +1,114 @@
+// Package mail sends plain text email through an SMTP server.
+package mail
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config describes the SMTP server and the sender
+type Config struct {
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN auth; no username sends without authenticating
+	Username string
+	Password string
+	From     string
+}
+
+// Send emails a plain text message to every address in to. Port 465 connects with implicit TLS; any other port
+// upgrades the connection with STARTTLS when the server offers it.
+func Send(cfg Config, to []string, subject string, body string) error {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", cfg.From, err)
+	}
+	recipients := make([]string, len(to))
+	for i, address := range to {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", address, err)
+		}
+		recipients[i] = parsed.Address
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	message := Compose(cfg.From, to, subject, body, time.Now())
+
+	if cfg.Port != 465 {
+		if err := smtp.SendMail(addr, auth, from.Address, recipients, message); err != nil {
+			return fmt.Errorf("failed to send email through %s: %w", addr, err)
+		}
+		return nil
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: cfg.Host})
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer client.Close()
+	if err := deliver(client, auth, from.Address, recipients, message); err != nil {
+		return fmt.Errorf("failed to send email through %s: %w", addr, err)
+	}
+	return nil
+}
+
+// deliver sends message over an established SMTP connection
+func deliver(client *smtp.Client, auth smtp.Auth, from string, to []string, message []byte) error {
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Compose builds a UTF-8 plain text message with the headers mail clients expect and CRLF line endings
+func Compose(from string, to []string, subject string, body string, date time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
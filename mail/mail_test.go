@@ -0,0 +1,107 @@
+package mail
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompose(t *testing.T) {
+	date := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	message := string(Compose("Cadence <cadence@example.com>", []string{"a@example.com", "b@example.com"}, "Rapport für heute", "line 1\nline 2\n", date))
+
+	for _, expected := range []string{
+		"From: Cadence <cadence@example.com>\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: =?utf-8?q?Rapport_f=C3=BCr_heute?=\r\n",
+		"Date: Tue, 02 Jan 2024 09:00:00 +0000\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("Expected message to contain %q, got:\n%s", expected, message)
+		}
+	}
+}
+
+// fakeSMTPServer accepts one SMTP session without TLS or authentication and returns what it received
+func fakeSMTPServer(t *testing.T) (int, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var session strings.Builder
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			session.WriteString(line)
+			switch {
+			case inData:
+				if line == ".\r\n" {
+					inData = false
+					reply("250 OK")
+				}
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				reply("354 Go ahead")
+			case strings.HasPrefix(line, "QUIT"):
+				reply("221 Bye")
+				received <- session.String()
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+		received <- session.String()
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSend(t *testing.T) {
+	port, received := fakeSMTPServer(t)
+
+	cfg := Config{Host: "127.0.0.1", Port: port, From: "Cadence <cadence@example.com>"}
+	if err := Send(cfg, []string{"Lead <lead@example.com>"}, "Weekly report", "All pushed\n"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	session := <-received
+	for _, expected := range []string{"MAIL FROM:<cadence@example.com>", "RCPT TO:<lead@example.com>", "Subject: Weekly report\r\n", "All pushed\r\n"} {
+		if !strings.Contains(session, expected) {
+			t.Errorf("Expected session to contain %q, got:\n%s", expected, session)
+		}
+	}
+}
+
+func TestSendInvalidAddress(t *testing.T) {
+	cfg := Config{Host: "127.0.0.1", Port: 25, From: "not an address"}
+	if err := Send(cfg, []string{"lead@example.com"}, "Report", ""); err == nil || !strings.Contains(err.Error(), "invalid sender") {
+		t.Errorf("Expected an invalid sender error, got %v", err)
+	}
+	cfg.From = "cadence@example.com"
+	if err := Send(cfg, []string{"lead"}, "Report", ""); err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+		t.Errorf("Expected an invalid recipient error, got %v", err)
+	}
+}
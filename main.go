@@ -1,119 +1,47 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"math/rand"
+	"io"
+	"iter"
+	"maps"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"slices"
-	"sort"
-	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"code-cadence/git"
-
-	"github.com/joho/godotenv"
-)
-
-// Configuration variables loaded from environment
-var (
-	WorkDayStartHour     int
-	WorkDayEndHour       int
-	JitterMinutes        int
-	JitterDays           bool
-	ParentGitBranchName  string
-	NewCommitAuthorName  string
-	NewCommitAuthorEmail string
-	CreateBackup         bool
-)
-
-// Additional configuration
-var (
-	SkipWeekDays    string
-	skipWeekdaysSet map[time.Weekday]bool
+	"github.com/egor-markin/code-cadence/backup"
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/push"
+	"github.com/egor-markin/code-cadence/scan"
+	"github.com/egor-markin/code-cadence/state"
 )
 
-// .env file locations to try in order
-var envFileLocations = []string{
-	".env",                             // Current directory
-	"~/.config/code-cadence/.env",      // User config
-	"/opt/code-cadence/.env",           // Application directory
-	"/usr/local/etc/code-cadence/.env", // System-wide config
-}
-
-// loadConfig loads configuration from .env file with defaults
-func loadConfig() {
-	// Try to load .env file from multiple locations (ignore errors if files don't exist)
-	for _, envFile := range envFileLocations {
-		_ = godotenv.Load(envFile)
-	}
-
-	// Load with defaults
-	WorkDayStartHour = getEnvInt("WORK_DAY_START_HOUR", 10)
-	WorkDayEndHour = getEnvInt("WORK_DAY_END_HOUR", 19)
-	JitterMinutes = getEnvInt("JITTER_MINUTES", 30)
-	JitterDays = getEnvBool("JITTER_DAYS", true)
-	ParentGitBranchName = getEnvString("PARENT_GIT_BRANCH_NAME", "origin/main")
-	NewCommitAuthorName = getEnvString("NEW_COMMIT_AUTHOR_NAME", "")
-	NewCommitAuthorEmail = getEnvString("NEW_COMMIT_AUTHOR_EMAIL", "")
-	CreateBackup = getEnvBool("CREATE_BACKUP", false)
-
-	// Weekday skipping configuration for commit_cadence_span
-	SkipWeekDays = getEnvString("SKIP_WEEK_DAYS", "Sat,Sun")
-	skipWeekdaysSet = parseWeekdays(SkipWeekDays)
-
-	if JitterMinutes < 0 {
-		JitterMinutes = 0
-	}
-}
-
-// getEnvString gets environment variable with default
-func getEnvString(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-// getEnvInt gets environment variable as int with default
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
-}
-
-// getEnvBool gets environment variable as bool with default
-func getEnvBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		// Handle common boolean representations
-		lowerValue := strings.ToLower(strings.TrimSpace(value))
-		switch lowerValue {
-		case "true", "1", "yes", "on", "enabled":
-			return true
-		case "false", "0", "no", "off", "disabled":
-			return false
-		}
-		// Fall back to strconv.ParseBool for other formats
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
-		}
-	}
-	return defaultValue
-}
-
 // Command constants
 const (
 	CmdPushDisable       = "push_disable"
 	CmdPushEnable        = "push_enable"
 	CmdPushStatus        = "push_status"
+	CmdPushHookUpgrade   = "push_hook_upgrade"
 	CmdCommitStatus      = "commit_status"
 	CmdCommitCadence     = "commit_cadence"
 	CmdCommitCadenceSpan = "commit_cadence_span"
+	CmdShiftWeekends     = "commit_shift_weekends"
+	CmdShift             = "shift"
+	CmdReorder           = "reorder"
+	CmdFixAuthor         = "fix_author"
+	CmdAuditHours        = "audit_hours"
+	CmdLintIdentity      = "lint_identity"
+	CmdAmendLast         = "amend_last"
+	CmdVerifyBackup      = "verify_backup"
+	CmdTui               = "tui"
 )
 
 // Valid commands slice
@@ -121,51 +49,100 @@ var validCommands = []string{
 	CmdPushDisable,
 	CmdPushEnable,
 	CmdPushStatus,
+	CmdPushHookUpgrade,
+	CmdCommitStatus,
+	CmdSummary,
+	CmdRepoHealth,
+	CmdListRepos,
+	CmdAuditHours,
+	CmdLintIdentity,
+	CmdEmailReport,
+	CmdCommitCadence,
+	CmdCommitCadenceSpan,
+	CmdShiftWeekends,
+	CmdShift,
+	CmdReorder,
+	CmdFixAuthor,
+	CmdAmendLast,
+	CmdVerifyBackup,
+	CmdTui,
+}
+
+// Commands that record each repository's HEAD and honor --changed-only
+var incrementalCommands = []string{
 	CmdCommitStatus,
 	CmdCommitCadence,
 	CmdCommitCadenceSpan,
+	CmdShiftWeekends,
+	CmdShift,
+	CmdReorder,
+	CmdFixAuthor,
 }
 
+// StdinRepoList as the directory path reads the repositories from stdin instead of scanning for them
+const StdinRepoList = "-"
+
 // RewriteBranchName The temporary Git branch name that is used for rewriting commit times
-const RewriteBranchName = "rewrite-history"
+const RewriteBranchName = cadence.DefaultRewriteBranchName
 
-// BackupFolderPattern is the pattern used to identify backup folders created by this tool
-const BackupFolderPattern = ".backup-"
+func main() {
+	args, err := parseArgs(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
 
-// Directories to skip when scanning for git repositories
-var skipDirs = []string{
-	"node_modules",
-	"vendor",
-	"target",
-	"build",
-}
+	if len(args) > 0 && args[0] == CmdGenDocs {
+		os.Exit(runGenDocs(cliFlags, args[1:]))
+	}
 
-const prePushHookContent = `#!/bin/sh
-echo "Error: git push is disabled for this repository"
-echo "This repository has been configured to prevent pushing changes"
-exit 1
-`
+	if Trace != "" {
+		if traceOutput, err = openTrace(Trace); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// A config file given on the command line replaces the .env search locations.
+	// config init may create it, every other command needs it to exist.
+	if ConfigFile != "" {
+		creating := slices.Equal(args, []string{CmdConfig, ConfigCmdInit})
+		if err := useConfigFile(ConfigFile, !creating); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-func main() {
 	// Load configuration from environment
-	loadConfig()
-
-	if len(os.Args) != 3 {
-		fmt.Println("Usage: code-cadence <command> <directory_path>")
-		fmt.Println("Commands:")
-		fmt.Println("  push_disable        - Disable git push for all repositories")
-		fmt.Println("  push_enable         - Enable git push for all repositories")
-		fmt.Println("  push_status         - Show push status for all repositories")
-		fmt.Println("  commit_status       - Show unpushed commits for all repositories")
-		fmt.Println("  commit_cadence      - Redistribute unpushed commit times across work day")
-		fmt.Println("  commit_cadence_span - Redistribute unpushed commit times across all days since last push (skips configured weekdays)")
-		fmt.Println("")
-		fmt.Println("Example: code-cadence commit_status /home/user/workspace/")
+	cfg := loadConfig()
+
+	if len(args) > 0 && args[0] == CmdConfig {
+		os.Exit(runConfigCommand(cfg, args[1:]))
+	}
+	if len(args) > 0 && args[0] == CmdPushGlobal {
+		os.Exit(runPushGlobalCommand(git.WithRunner(context.Background(), cfg.gitRunner()), args[1:]))
+	}
+
+	// watch <command> <directory_path> reruns a command until interrupted
+	watching := len(args) > 0 && args[0] == CmdWatch
+	if watching {
+		args = args[1:]
+	}
+
+	if len(args) != 2 {
+		printUsage(cliFlags)
 		os.Exit(1)
 	}
 
-	command := os.Args[1]
-	rootDir := os.Args[2]
+	command := args[0]
+	rootDir := args[1]
+
+	// Cancel running git commands on Ctrl-C so in-flight rewrites are rolled back
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = git.WithRunner(ctx, cfg.gitRunner())
 
 	// Validate command
 	if !slices.Contains(validCommands, command) {
@@ -173,29 +150,135 @@ func main() {
 		os.Exit(1)
 	}
 
+	if watching && (command == CmdAmendLast || command == CmdTui) {
+		fmt.Printf("Error: %s can't be watched\n", command)
+		os.Exit(1)
+	}
+
+	if rootDir == StdinRepoList {
+		if watching || command == CmdAmendLast || command == CmdVerifyBackup || command == CmdTui || command == CmdListRepos {
+			fmt.Printf("Error: %s needs a directory, it can't read the repositories from stdin\n", command)
+			os.Exit(1)
+		}
+		if SelectCommits {
+			fmt.Println("Error: --select reads its keys from stdin, so the repositories can't be read from it")
+			os.Exit(1)
+		}
+	}
+
+	if SelectCommits {
+		selector = newCommitSelector(os.Stdin, os.Stdout, stop)
+	}
+
+	if Limit < 0 {
+		fmt.Println("Error: --limit must not be negative")
+		os.Exit(1)
+	}
+
+	if ICSFile != "" && !exportsCalendar(command) {
+		fmt.Printf("Error: --ics doesn't work with %s\n", command)
+		os.Exit(1)
+	}
+
+	if OutputFormat != "" {
+		tmpl, err := parseOutputFormat(OutputFormat, command)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if watching || ICSFile != "" || FetchFirst || ChangedOnly {
+			fmt.Println("Error: --format prints only the records, so it can't be combined with watch, --ics, --fetch or --changed-only")
+			os.Exit(1)
+		}
+		outputFormat = tmpl
+	}
+
+	if command == CmdShift && ShiftBy == 0 {
+		fmt.Println("Error: shift needs a non-zero offset, e.g. --by 3h or --by -2d")
+		os.Exit(1)
+	}
+
 	// Check if directory exists
-	if _, err := os.Stat(rootDir); os.IsNotExist(err) {
+	if _, err := os.Stat(rootDir); os.IsNotExist(err) && rootDir != StdinRepoList {
 		fmt.Printf("Error: Directory '%s' does not exist\n", rootDir)
 		os.Exit(1)
 	}
 
 	// Check git availability
-	if err := git.CheckGitAvailability(); err != nil {
+	if err := git.CheckGitAvailability(ctx); err != nil {
 		fmt.Printf("Error: Git is not available or not working properly: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Scanning directory: %s\n", rootDir)
-
-	gitRepos, err := findGitRepositories(rootDir)
-	if err != nil {
-		fmt.Printf("Error scanning directory: %v\n", err)
+	if watching {
+		runWatch(ctx, cfg, command, rootDir)
+	} else if err := runCommand(ctx, &batch{settings: cfg}, command, rootDir); err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
+	if ctx.Err() != nil {
+		fmt.Println("\nInterrupted")
+		os.Exit(130)
+	}
+}
+
+// runCommand scans rootDir and runs command on every repository found with the batch b
+func runCommand(ctx context.Context, b *batch, command string, rootDir string) error {
+	// Settings may have been reloaded since the context was created
+	ctx = git.WithRunner(ctx, b.gitRunner())
+
+	// amend_last works on the one repository it is given rather than on everything below it
+	if command == CmdAmendLast {
+		return b.amendLast(ctx, rootDir, AmendTime)
+	}
+	// list_repos prints nothing but the repositories, so its output can be piped
+	if command == CmdListRepos {
+		return b.listRepos(rootDir, os.Stdout)
+	}
+	// So does commit_status with --format
+	if command == CmdCommitStatus && outputFormat != nil {
+		return b.formatCommitStatus(ctx, rootDir, os.Stdout)
+	}
+	// verify_backup checks backups, which a scan skips
+	if command == CmdVerifyBackup {
+		return verifyBackups(ctx, rootDir)
+	}
+
+	var gitRepos []string
+	var err error
+	if rootDir == StdinRepoList {
+		fmt.Println("Reading the repository list from stdin")
+		if gitRepos, err = readRepoList(os.Stdin); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Scanning directory: %s\n", rootDir)
+
+		// The dashboard needs the full list up front, so it never streams
+		if b.StreamScan && command != CmdTui {
+			return b.streamCommand(ctx, command, rootDir)
+		}
+
+		if gitRepos, err = b.findRepositories(rootDir); err != nil {
+			return fmt.Errorf("failed to scan %s: %w", rootDir, err)
+		}
+	}
+
 	if len(gitRepos) == 0 {
 		fmt.Println("No Git repositories found in the specified directory")
-		os.Exit(0)
+		return nil
+	}
+
+	if len(OnlyRepos) > 0 || len(SkipRepos) > 0 {
+		gitRepos, err = scan.FilterByName(gitRepos, OnlyRepos, SkipRepos)
+		if err != nil {
+			return err
+		}
+		if len(gitRepos) == 0 {
+			fmt.Println("No Git repositories match --only/--skip")
+			return nil
+		}
 	}
 
 	fmt.Printf("Found %d Git repositories:\n", len(gitRepos))
@@ -205,63 +288,440 @@ func main() {
 
 	fmt.Println()
 
+	// Stale remote-tracking refs make pushed commits look unpushed
+	if b.fetchesFirst(command) {
+		b.fetchRepos(ctx, gitRepos)
+	}
+
+	// Incremental mode only applies to commands that inspect commits
+	if slices.Contains(incrementalCommands, command) {
+		b.state = loadRepoState()
+		if ChangedOnly {
+			gitRepos = b.filterChangedRepos(ctx, gitRepos)
+			if len(gitRepos) == 0 {
+				fmt.Println("No repositories changed since the last run")
+				return nil
+			}
+		}
+	}
+
+	if command == CmdTui {
+		if err := b.runDashboard(ctx, os.Stdin, os.Stdout, gitRepos); err != nil && ctx.Err() == nil {
+			return err
+		}
+	} else {
+		b.run(ctx, command, rootDir, slices.Values(gitRepos))
+	}
+
+	b.saveRepoState()
+
+	return nil
+}
+
+// streamCommand is runCommand with STREAM_SCAN: every repository is passed on as soon as the scan finds it, so work
+// starts right away and the repository list of a huge workspace is never built
+func (b *batch) streamCommand(ctx context.Context, command string, rootDir string) error {
+	// Checks the patterns once instead of for every repository
+	if _, err := scan.FilterByName(nil, OnlyRepos, SkipRepos); err != nil {
+		return err
+	}
+
+	found := 0
+	var scanned scan.Result
+	var scanErr error
+	repos := func(yield func(string) bool) {
+		scanned, scanErr = b.streamRepositories(rootDir, func(repo string) bool {
+			found++
+			if kept, _ := scan.FilterByName([]string{repo}, OnlyRepos, SkipRepos); len(kept) == 0 {
+				return true
+			}
+			return yield(repo)
+		})
+	}
+
+	fmt.Println("Processing repositories as they are found (STREAM_SCAN)")
+	fmt.Println()
+
+	var gitRepos iter.Seq[string] = repos
+	if b.fetchesFirst(command) {
+		gitRepos = b.fetchingRepos(ctx, gitRepos)
+	}
+
+	if slices.Contains(incrementalCommands, command) {
+		b.state = loadRepoState()
+		if ChangedOnly {
+			gitRepos = b.changedRepos(ctx, gitRepos)
+		}
+	}
+
+	b.run(ctx, command, rootDir, gitRepos)
+
+	b.saveRepoState()
+
+	// Without a list up front, what the scan found out is reported at the end
+	fmt.Println()
+	if opts, err := b.scanOptions(); err == nil {
+		printNestedRepos(scanned, opts.NestedRepos)
+		printNetworkRepos(scanned, opts.NetworkRepos)
+	}
+
+	if scanErr != nil {
+		return fmt.Errorf("failed to scan %s: %w", rootDir, scanErr)
+	}
+	if found == 0 {
+		fmt.Println("No Git repositories found in the specified directory")
+	}
+	return nil
+}
+
+// fetchesFirst reports whether command fetches every repository before looking at it (--fetch, FETCH_BEFORE)
+func (s *settings) fetchesFirst(command string) bool {
+	// Stale remote-tracking refs make pushed commits look unpushed
+	return (FetchFirst || s.FetchBefore) && (slices.Contains(incrementalCommands, command) || command == CmdTui || command == CmdSummary || command == CmdEmailReport || command == CmdAuditHours || command == CmdLintIdentity)
+}
+
+// exportsCalendar reports whether command can write its commit times to an --ics file: commit_status writes the
+// current times, the cadence commands the times they applied
+func exportsCalendar(command string) bool {
+	return slices.Contains([]string{CmdCommitStatus, CmdCommitCadence, CmdCommitCadenceSpan, CmdShiftWeekends, CmdShift, CmdReorder, CmdFixAuthor}, command)
+}
+
+// batch runs a command over a set of repositories with the settings it was started with and keeps track of what the
+// run needs across repositories
+type batch struct {
+	*settings
+	// state tracks the HEAD each repository had when it was last processed; nil disables tracking
+	state *state.Store
+	// schedule collects the commit times planned during a run, so repositories are scheduled around each other; nil
+	// outside of a run
+	schedule *cadence.Schedule
+	// identityOnly makes the rewrites only correct the author of commits, as fix_author does
+	identityOnly bool
+	// watched is set when watch started the run
+	watched bool
+	// scanOutput is where the STREAM_SCAN stages print
+	scanOutput scanOutput
+}
+
+// run runs one of the commands that work through every repository in turn
+func (b *batch) run(ctx context.Context, command string, rootDir string, gitRepos iter.Seq[string]) {
+	b.schedule = &cadence.Schedule{}
+	defer func() { b.schedule = nil }()
+
+	// Every run, including each one of watch, exports only its own sessions
+	if ICSFile != "" {
+		calendar = &calendarExport{}
+		defer func() {
+			writeCalendar()
+			calendar = nil
+		}()
+	}
+
 	switch command {
 	case CmdPushDisable:
-		disablePushForAll(gitRepos)
+		b.disablePushForAll(ctx, gitRepos)
 	case CmdPushEnable:
-		enablePushForAll(gitRepos)
+		b.enablePushForAll(ctx, gitRepos)
 	case CmdPushStatus:
-		showPushStatus(gitRepos)
+		b.showPushStatus(ctx, gitRepos)
+	case CmdPushHookUpgrade:
+		b.upgradePushHooks(ctx, gitRepos)
 	case CmdCommitStatus:
-		showCommitStatus(gitRepos)
+		b.showCommitStatus(ctx, gitRepos)
+	case CmdSummary:
+		b.showSummary(ctx, rootDir, gitRepos)
+	case CmdRepoHealth:
+		b.repoHealth(ctx, gitRepos)
+	case CmdAuditHours:
+		b.auditHours(ctx, gitRepos)
+	case CmdLintIdentity:
+		b.lintIdentity(ctx, command, gitRepos)
+	case CmdEmailReport:
+		if err := b.emailReport(ctx, rootDir, gitRepos); err != nil {
+			fmt.Printf("Error: Failed to send the report: %v\n", err)
+		}
 	case CmdCommitCadence:
-		commitCadence(gitRepos)
+		b.reportCadence(ctx, command, b.commitCadence(ctx, gitRepos))
 	case CmdCommitCadenceSpan:
-		commitCadenceSpan(gitRepos)
+		b.reportCadence(ctx, command, b.commitCadenceSpan(ctx, gitRepos))
+	case CmdShiftWeekends:
+		b.reportCadence(ctx, command, b.shiftWeekends(ctx, gitRepos))
+	case CmdShift:
+		b.reportCadence(ctx, command, b.shiftCommits(ctx, gitRepos, ShiftBy))
+	case CmdReorder:
+		b.reportCadence(ctx, command, b.reorderCommits(ctx, gitRepos))
+	case CmdFixAuthor:
+		b.reportCadence(ctx, command, b.fixAuthors(ctx, gitRepos))
 	}
 }
 
-func findGitRepositories(rootDir string) ([]string, error) {
-	var gitRepos []string
+// saveRepoState writes the repository state back after a run in incremental mode
+func (b *batch) saveRepoState() {
+	if b.state != nil {
+		if err := b.state.Save(); err != nil {
+			fmt.Printf("Warning: Failed to save repository state: %v\n", err)
+		}
+	}
+}
 
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// findRepositories discovers repositories under rootDir, going through the discovery cache when it is enabled
+func (s *settings) findRepositories(rootDir string) ([]string, error) {
+	opts, err := s.scanOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	result, cached, err := s.discoverRepositories(rootDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if cached {
+		fmt.Println("Using cached repository list (run with --refresh to rescan)")
+	}
+
+	printNestedRepos(result, opts.NestedRepos)
+	printNetworkRepos(result, opts.NetworkRepos)
+
+	return result.Repos, nil
+}
+
+// discoverRepositories is findRepositories without any output. cached reports that the result came from the cache.
+func (s *settings) discoverRepositories(rootDir string, opts scan.Options) (result scan.Result, cached bool, err error) {
+	cacheDir, cacheErr := scan.DefaultCacheDir()
+	if s.ScanCache && cacheErr == nil {
+		return scan.Cache{Dir: cacheDir}.Discover(rootDir, opts, RefreshCache)
+	}
+	result, err = scan.Discover(rootDir, opts)
+	return result, false, err
+}
+
+// readRepoList reads the repositories given as "-" from r, one path per line or NUL-terminated as find -print0 and
+// list_repos --print0 write them. A path to a .git directory stands for its repository, paths that aren't
+// directories are reported and left out, and a repository given twice is only processed once.
+func readRepoList(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the repository list: %w", err)
+	}
+
+	separator := "\n"
+	if strings.Contains(string(data), "\x00") {
+		separator = "\x00"
+	}
+	var repos []string
+	seen := make(map[string]bool)
+	for _, path := range strings.Split(string(data), separator) {
+		if separator == "\n" {
+			path = strings.TrimSuffix(path, "\r")
+		}
+		if strings.TrimSpace(path) == "" {
+			continue
 		}
+		path = filepath.Clean(path)
+		if filepath.Base(path) == ".git" {
+			path = filepath.Dir(path)
+		}
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			fmt.Printf("Warning: Skipping %s: not a directory\n", path)
+			continue
+		}
+		if !seen[path] {
+			seen[path] = true
+			repos = append(repos, path)
+		}
+	}
+	return repos, nil
+}
 
-		// Skip hidden directories and common non-repo directories
-		if info.IsDir() {
-			name := info.Name()
-			if strings.HasPrefix(name, ".") && name != ".git" {
-				return filepath.SkipDir
-			}
+// streamRepositories is findRepositories for STREAM_SCAN: yield is called with every repository as soon as it is
+// found. The returned result has no repositories, only what the walk found out about nested and network ones.
+func (s *settings) streamRepositories(rootDir string, yield func(repo string) bool) (scan.Result, error) {
+	opts, err := s.scanOptions()
+	if err != nil {
+		return scan.Result{}, err
+	}
 
-			// Skip common directories that are unlikely to be repos
-			if slices.Contains(skipDirs, name) {
-				return filepath.SkipDir
-			}
+	cacheDir, cacheErr := scan.DefaultCacheDir()
+	if s.ScanCache && cacheErr == nil {
+		result, cached, err := scan.Cache{Dir: cacheDir}.Stream(rootDir, opts, RefreshCache, yield)
+		if cached {
+			fmt.Println("Used the cached repository list (run with --refresh to rescan)")
 		}
+		return result, err
+	}
+	return scan.Stream(rootDir, opts, yield)
+}
+
+// scanOptions returns the discovery options set by the configuration
+func (s *settings) scanOptions() (scan.Options, error) {
+	nestedPolicy, err := scan.ParseNestedPolicy(s.NestedRepos)
+	if err != nil {
+		return scan.Options{}, err
+	}
+	networkPolicy, err := scan.ParseNetworkPolicy(s.NetworkRepos)
+	if err != nil {
+		return scan.Options{}, err
+	}
+	return scan.Options{FollowSymlinks: FollowSymlinks, NestedRepos: nestedPolicy, NetworkRepos: networkPolicy}, nil
+}
 
-		// Check if this is a .git directory
-		if info.IsDir() && info.Name() == ".git" {
-			// Get the parent directory (the actual repository root)
-			repoPath := filepath.Dir(path)
-			gitRepos = append(gitRepos, repoPath)
-			return filepath.SkipDir // Don't traverse into .git directory
+// printNestedRepos reports repositories found inside other repositories and what NESTED_REPOS did with them
+func printNestedRepos(result scan.Result, policy scan.NestedPolicy) {
+	if len(result.Nested) == 0 {
+		return
+	}
+
+	fmt.Printf("Found %d nested repositories (NESTED_REPOS=%s):\n", len(result.Nested), policy)
+	for _, nested := range result.Nested {
+		fmt.Printf("  - %s (inside %s)\n", nested.Path, nested.Outer)
+	}
+	for _, repo := range result.Excluded {
+		fmt.Printf("⏭️  Excluded by NESTED_REPOS: %s\n", repo)
+	}
+	fmt.Println()
+}
+
+// printNetworkRepos reports the repositories on network filesystems, or the network directories NETWORK_REPOS=skip
+// left out of the scan
+func printNetworkRepos(result scan.Result, policy scan.NetworkPolicy) {
+	if len(result.Network) == 0 {
+		return
+	}
+
+	for _, network := range result.Network {
+		if policy == scan.NetworkSkip {
+			fmt.Printf("⏭️  Skipped network filesystem (%s): %s\n", network.Filesystem, network.Path)
+		} else {
+			fmt.Printf("⚠️  %s is on a network filesystem (%s), rewriting it is slow and an interrupted rewrite is harder to recover (NETWORK_REPOS=skip leaves it out)\n", network.Path, network.Filesystem)
 		}
+	}
+	fmt.Println()
+}
 
+// loadRepoState opens the state file used by incremental mode. Tracking is disabled if it can't be read.
+func loadRepoState() *state.Store {
+	path, err := state.DefaultPath()
+	if err != nil {
+		fmt.Printf("Warning: Repository state is unavailable: %v\n", err)
 		return nil
-	})
+	}
+
+	store, err := state.Load(path)
+	if err != nil {
+		fmt.Printf("Warning: Could not read repository state %s: %v\n", path, err)
+		return nil
+	}
 
-	return gitRepos, err
+	return store
 }
 
-func disablePushForAll(gitRepos []string) {
-	fmt.Println("Disabling git push for all repositories...")
+// fetchRepos fetches every repository with FETCH_TIMEOUT per repository. Failures only produce a warning, and after
+// a timeout the remaining repositories are not fetched, assuming the machine is offline; the existing remote-tracking
+// refs are used instead.
+func (s *settings) fetchRepos(ctx context.Context, gitRepos []string) {
+	fmt.Println("Fetching remotes...")
+	for _, repo := range gitRepos {
+		if ctx.Err() != nil || !s.fetchRepo(ctx, repo, os.Stdout) {
+			return
+		}
+	}
+	fmt.Println()
+}
 
-	disabledCount := 0
+// fetchingRepos is fetchRepos for STREAM_SCAN: every repository is fetched just before it is passed on
+func (b *batch) fetchingRepos(ctx context.Context, gitRepos iter.Seq[string]) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		online := true
+		for repo := range gitRepos {
+			if online && ctx.Err() == nil {
+				online = b.fetchRepo(ctx, repo, &b.scanOutput)
+			}
+			if !yield(repo) {
+				return
+			}
+		}
+	}
+}
+
+// fetchRepo fetches a single repository, printing its warnings to out, and reports false when it timed out, which is
+// taken to mean the machine is offline
+func (s *settings) fetchRepo(ctx context.Context, repo string, out io.Writer) bool {
+	fetchCtx, cancel := context.WithTimeout(ctx, s.FetchTimeout)
+	err := git.Fetch(fetchCtx, repo)
+	timedOut := errors.Is(fetchCtx.Err(), context.DeadlineExceeded)
+	cancel()
+
+	if timedOut {
+		fmt.Fprintf(out, "⚠️  Fetching %s timed out after %s, assuming offline and using existing remote-tracking refs\n", repo, s.FetchTimeout)
+		return false
+	}
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(out, "⚠️  %s: %v (using existing remote-tracking refs)\n", repo, err)
+	}
+	return true
+}
+
+// filterChangedRepos drops repositories whose HEAD hasn't moved since they were last processed
+func (b *batch) filterChangedRepos(ctx context.Context, gitRepos []string) []string {
+	if b.state == nil {
+		return gitRepos
+	}
+
+	var changed []string
 	for _, repo := range gitRepos {
-		if err := disableGitPush(repo); err != nil {
+		if b.repoChanged(ctx, repo) {
+			changed = append(changed, repo)
+		}
+	}
+
+	if skipped := len(gitRepos) - len(changed); skipped > 0 {
+		fmt.Printf("Skipping %d unchanged repositories (HEAD has not moved since the last run)\n\n", skipped)
+	}
+
+	return changed
+}
+
+// changedRepos is filterChangedRepos for STREAM_SCAN
+func (b *batch) changedRepos(ctx context.Context, gitRepos iter.Seq[string]) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for repo := range gitRepos {
+			if b.state != nil && !b.repoChanged(ctx, repo) {
+				fmt.Fprintf(&b.scanOutput, "⏭️  Unchanged since the last run: %s\n", repo)
+				continue
+			}
+			if !yield(repo) {
+				return
+			}
+		}
+	}
+}
+
+// repoChanged reports whether the HEAD of a repository moved since it was last processed
+func (b *batch) repoChanged(ctx context.Context, repo string) bool {
+	head, err := git.GetHeadCommit(ctx, repo)
+	return err != nil || b.state.Changed(repo, head)
+}
+
+// markProcessed records the current HEAD of a repository so --changed-only can skip it next time
+func (b *batch) markProcessed(ctx context.Context, repo string) {
+	if b.state == nil {
+		return
+	}
+
+	head, err := git.GetHeadCommit(ctx, repo)
+	if err != nil {
+		return
+	}
+	b.state.MarkProcessed(repo, head)
+}
+
+func (b *batch) disablePushForAll(ctx context.Context, gitRepos iter.Seq[string]) {
+	fmt.Println("Disabling git push for all repositories...")
+
+	disabledCount, total := 0, 0
+	for repo := range gitRepos {
+		total++
+		if err := b.disablePush(ctx, repo); err != nil {
 			fmt.Printf("Warning: Failed to disable git push for %s: %v\n", repo, err)
 		} else {
 			disabledCount++
@@ -269,654 +729,1024 @@ func disablePushForAll(gitRepos []string) {
 		}
 	}
 
-	fmt.Printf("\nSummary: Successfully disabled git push for %d/%d repositories\n", disabledCount, len(gitRepos))
-}
-
-func enablePushForAll(gitRepos []string) {
-	fmt.Println("Enabling git push for all repositories...")
-
-	enabledCount := 0
-	for _, repo := range gitRepos {
-		if err := enableGitPush(repo); err != nil {
-			fmt.Printf("Warning: Failed to enable git push for %s: %v\n", repo, err)
-		} else {
-			enabledCount++
-			fmt.Printf("✓ Enabled git push for: %s\n", repo)
+	fmt.Printf("\nSummary: Successfully disabled git push for %d/%d repositories\n", disabledCount, total)
+}
+
+// disablePush blocks pushes from repo the way PUSH_BLOCK_MODE asks for
+func (s *settings) disablePush(ctx context.Context, repo string) error {
+	if strings.EqualFold(s.PushBlockMode, PushBlockPushURL) {
+		return push.DisablePushURL(ctx, repo)
+	}
+	return push.Disable(ctx, repo)
+}
+
+func (b *batch) enablePushForAll(ctx context.Context, gitRepos iter.Seq[string]) {
+	fmt.Println("Enabling git push for all repositories...")
+
+	enabledCount, total := 0, 0
+	for repo := range gitRepos {
+		total++
+		if err := push.Enable(ctx, repo); err != nil {
+			fmt.Printf("Warning: Failed to enable git push for %s: %v\n", repo, err)
+		} else {
+			enabledCount++
+			fmt.Printf("✓ Enabled git push for: %s\n", repo)
+		}
+	}
+
+	fmt.Printf("\nSummary: Successfully enabled git push for %d/%d repositories\n", enabledCount, total)
+}
+
+func (b *batch) upgradePushHooks(ctx context.Context, gitRepos iter.Seq[string]) {
+	fmt.Println("Upgrading outdated pre-push hooks in all repositories...")
+
+	upgradedCount, total := 0, 0
+	for repo := range gitRepos {
+		total++
+		upgraded, err := push.Upgrade(ctx, repo)
+		if err != nil {
+			fmt.Printf("Warning: Failed to upgrade the pre-push hook of %s: %v\n", repo, err)
+		} else if upgraded {
+			upgradedCount++
+			fmt.Printf("✓ Upgraded pre-push hook to version %d: %s\n", push.HookVersion, repo)
+		}
+	}
+
+	fmt.Printf("\nSummary: Upgraded the pre-push hook of %d/%d repositories\n", upgradedCount, total)
+}
+
+func (b *batch) showPushStatus(ctx context.Context, gitRepos iter.Seq[string]) {
+	fmt.Println("Checking push status for all repositories...")
+
+	disabledCount := 0
+	enabledCount := 0
+	foreignCount := 0
+
+	for repo := range gitRepos {
+		status, err := push.GetStatus(ctx, repo)
+		if err != nil {
+			fmt.Printf("Warning: Could not check status for %s: %v\n", repo, err)
+			continue
+		}
+
+		switch status.State {
+		case push.StateDisabled:
+			disabledCount++
+			if status.PushURL {
+				fmt.Printf("❌ Push DISABLED: %s (push URL)\n", repo)
+			} else {
+				fmt.Printf("❌ Push DISABLED: %s\n", repo)
+			}
+		case push.StateOutdated:
+			disabledCount++
+			fmt.Printf("❌ Push DISABLED: %s (hook version %d, current is %d)\n", repo, status.Version, push.HookVersion)
+		case push.StateForeign:
+			foreignCount++
+			fmt.Printf("🚧 Push blocked by another hook: %s\n", repo)
+			for _, line := range status.Preview {
+				fmt.Printf("   | %s\n", line)
+			}
+		default:
+			enabledCount++
+			fmt.Printf("✅ Push ENABLED:  %s\n", repo)
+		}
+	}
+
+	fmt.Printf("\nSummary: %d repositories have push enabled, %d have push disabled, %d are blocked by another hook\n", enabledCount, disabledCount, foreignCount)
+}
+
+func (b *batch) showCommitStatus(ctx context.Context, gitRepos iter.Seq[string]) {
+	fmt.Println("Checking for unpushed commits in all repositories...")
+
+	reposWithUnpushedCommits := 0
+	totalUnpushedCommits := 0
+	reposWithUncommittedWork := 0
+	byAuthor := authorGroups{}
+
+	for repo := range gitRepos {
+		if ctx.Err() != nil {
+			break
+		}
+
+		unpushedCommits, err := git.GetUnpushedCommits(ctx, repo, b.parentBranch(ctx, repo))
+		if err != nil {
+			fmt.Printf("Warning: Could not check commits for %s: %v\n", repo, err)
+			continue
+		}
+		b.markProcessed(ctx, repo)
+
+		tracking := "tracking unknown"
+		if status, err := git.GetTrackingStatus(ctx, repo); err != nil {
+			fmt.Printf("Warning: Could not check the upstream of %s: %v\n", repo, err)
+		} else {
+			tracking = trackingSummary(status)
+		}
+		worktree, err := git.GetWorkingTreeStatus(ctx, repo)
+		if err != nil {
+			fmt.Printf("Warning: Could not check the working tree of %s: %v\n", repo, err)
+		}
+		if worktree.Dirty() || worktree.Stashes > 0 {
+			reposWithUncommittedWork++
+		}
+
+		if len(unpushedCommits) > 0 {
+			reposWithUnpushedCommits++
+			totalUnpushedCommits += len(unpushedCommits)
+			if GroupBy == GroupByAuthor {
+				// The commits are listed under their authors after the last repository
+				fmt.Printf("📦 %s: %d unpushed commits [%s]\n", repo, len(unpushedCommits), tracking)
+				byAuthor.add(repo, unpushedCommits)
+			} else {
+				fmt.Printf("\n📦 %s (%d unpushed commits) [%s]:\n", repo, len(unpushedCommits), tracking)
+				for _, commit := range unpushedCommits {
+					fmt.Printf("   • %s %s (%s <%s> - %s)\n", commit.Hash, commit.Subject, commit.Author, commit.Email, commit.DateTime)
+				}
+			}
+			if calendar != nil {
+				addCommitTimes(repo, unpushedCommits)
+			}
+		} else {
+			fmt.Printf("✅ %s: All commits pushed [%s]\n", repo, tracking)
+		}
+		if worktree.Dirty() || worktree.Stashes > 0 {
+			fmt.Printf("   📝 Uncommitted work: %s\n", workingTreeSummary(worktree))
+		}
+	}
+
+	for _, group := range byAuthor.sorted() {
+		fmt.Printf("\n👤 %s (%d unpushed commits in %d repositories):\n", group.Author, group.Count(), len(group.Repos))
+		for _, repo := range group.Repos {
+			fmt.Printf("   📦 %s\n", repo)
+			for _, commit := range group.Commits[repo] {
+				fmt.Printf("      • %s %s (%s)\n", commit.Hash, commit.Subject, commit.DateTime)
+			}
+		}
+	}
+
+	fmt.Printf("\nSummary: %d repositories have unpushed commits (%d total unpushed commits), %d have uncommitted changes or stashes\n",
+		reposWithUnpushedCommits, totalUnpushedCommits, reposWithUncommittedWork)
+}
+
+// authorGroup holds the unpushed commits of one author, newest first within each repository
+type authorGroup struct {
+	Author git.Identity
+	// Repos are the repositories with commits of the author, in the order they were reported
+	Repos   []string
+	Commits map[string][]git.Commit
+}
+
+// Count returns the number of commits of the author across all repositories
+func (g *authorGroup) Count() int {
+	count := 0
+	for _, commits := range g.Commits {
+		count += len(commits)
+	}
+	return count
+}
+
+// authorGroups collects unpushed commits by author for commit_status --group-by=author, keyed by the lowercased
+// email, so the same person committing under different capitalizations or names is listed once
+type authorGroups map[string]*authorGroup
+
+// add records the commits of repo under their authors
+func (g authorGroups) add(repo string, commits []git.Commit) {
+	for _, commit := range commits {
+		key := strings.ToLower(commit.Email)
+		group, ok := g[key]
+		if !ok {
+			group = &authorGroup{Author: git.Identity{Name: commit.Author, Email: commit.Email}, Commits: make(map[string][]git.Commit)}
+			g[key] = group
+		}
+		if _, ok := group.Commits[repo]; !ok {
+			group.Repos = append(group.Repos, repo)
+		}
+		group.Commits[repo] = append(group.Commits[repo], commit)
+	}
+}
+
+// sorted returns the groups with the most commits first, and authors with as many commits by email
+func (g authorGroups) sorted() []*authorGroup {
+	groups := slices.Collect(maps.Values(g))
+	slices.SortFunc(groups, func(a, b *authorGroup) int {
+		if a.Count() != b.Count() {
+			return b.Count() - a.Count()
+		}
+		return strings.Compare(strings.ToLower(a.Author.Email), strings.ToLower(b.Author.Email))
+	})
+	return groups
+}
+
+// trackingSummary describes how the current branch relates to its upstream, e.g. "main → origin/main: 2 ahead, 1 behind"
+func trackingSummary(status git.TrackingStatus) string {
+	switch {
+	case status.Branch == "":
+		return "detached HEAD"
+	case status.Upstream == "":
+		return status.Branch + ": no upstream"
+	default:
+		return fmt.Sprintf("%s → %s: %d ahead, %d behind", status.Branch, status.Upstream, status.Ahead, status.Behind)
+	}
+}
+
+// workingTreeSummary lists the uncommitted changes and stash entries of a repository, e.g. "2 staged, 1 untracked, 1 stash"
+func workingTreeSummary(status git.WorkingTreeStatus) string {
+	var parts []string
+	for _, count := range []struct {
+		n    int
+		what string
+	}{
+		{status.Staged, "staged"},
+		{status.Modified, "modified"},
+		{status.Untracked, "untracked"},
+		{status.Stashes, "stash"},
+	} {
+		if count.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count.n, count.what))
+		}
+	}
+	if len(parts) == 0 {
+		return "clean"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// planFunc computes the new schedule for a loaded repository
+type planFunc func(ctx context.Context, target *cadence.Target) (cadence.Plan, error)
+
+// complianceFunc returns the check for the commits of a repository that need no changes, or nil to check none
+type complianceFunc func(ctx context.Context, repo string) func(git.Commit) bool
+
+// commitCadence redistributes unpushed commit times across work day
+func (b *batch) commitCadence(ctx context.Context, gitRepos iter.Seq[string]) cadenceSummary {
+	fmt.Println("Redistributing unpushed commit times across work day...")
+
+	fmt.Println()
+
+	return b.runCadence(ctx, gitRepos, b.outsideHoursFilter, func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return b.repoScheduleConfig(ctx, target.RepoPath).PlanByDay(target.Commits)
+	})
+}
+
+// commitCadenceSpan redistributes unpushed commit times across all days from oldest unpushed commit through today.
+// It skips weekdays configured via SKIP_WEEK_DAYS and keeps commits within work hours.
+func (b *batch) commitCadenceSpan(ctx context.Context, gitRepos iter.Seq[string]) cadenceSummary {
+	fmt.Println("Redistributing unpushed commit times across all days since last push...")
+
+	return b.runCadence(ctx, gitRepos, b.outsideHoursFilter, func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		// Use the last pushed commit as the earliest time for the first day
+		var lastPushedTime *time.Time
+		lastPushedCommit, err := git.GetLastPushedCommit(ctx, target.RepoPath, b.parentBranch(ctx, target.RepoPath))
+		if err != nil {
+			fmt.Printf("   ⚠️  Warning: Could not get last pushed commit: %v\n", err)
+		} else if lastPushedCommit != nil {
+			if t, err := lastPushedCommit.Time(); err == nil {
+				lastPushedTime = &t
+			}
+		}
+
+		plan, err := b.repoScheduleConfig(ctx, target.RepoPath).PlanSpan(target.Commits, lastPushedTime)
+		if errors.Is(err, cadence.ErrNoEligibleDays) {
+			return plan, fmt.Errorf("no eligible days in range after applying SKIP_WEEK_DAYS=%q", b.SkipWeekDays)
+		}
+		if errors.Is(err, cadence.ErrDailyLimit) {
+			return plan, fmt.Errorf("%d commits don't fit into the span with MAX_COMMITS_PER_DAY=%d across all repositories", len(target.Commits), b.MaxCommitsPerDay)
+		}
+		return plan, err
+	})
+}
+
+// shiftWeekends moves only commits made on skipped weekdays to the nearest eligible day, keeping their time of day
+// and leaving all other commits untouched
+func (b *batch) shiftWeekends(ctx context.Context, gitRepos iter.Seq[string]) cadenceSummary {
+	fmt.Println("Moving unpushed commits made on skipped weekdays to the nearest workday...")
+
+	cfg := b.scheduleConfig()
+	onAllowedDay := func(ctx context.Context, repo string) func(git.Commit) bool { return cfg.OnAllowedDay }
+	return b.runCadence(ctx, gitRepos, onAllowedDay, func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		// Shifted commits must stay after the commit they are rebuilt on
+		var earliest *time.Time
+		if !target.IsRoot {
+			if t, err := git.GetCommitTime(ctx, target.RepoPath, target.ParentCommit); err != nil {
+				fmt.Printf("   ⚠️  Warning: Could not get parent commit time: %v\n", err)
+			} else {
+				earliest = &t
+			}
+		}
+
+		plan, err := cfg.PlanWeekendShift(target.Commits, earliest)
+		if errors.Is(err, cadence.ErrNoEligibleDays) {
+			return plan, fmt.Errorf("no eligible days after applying SKIP_WEEK_DAYS=%q", b.SkipWeekDays)
+		}
+		return plan, err
+	})
+}
+
+// shiftCommits moves every unpushed commit by the same offset without redistributing them
+func (b *batch) shiftCommits(ctx context.Context, gitRepos iter.Seq[string], by time.Duration) cadenceSummary {
+	fmt.Printf("Shifting unpushed commit times by %s...\n", by)
+
+	cfg := b.scheduleConfig()
+	return b.runCadence(ctx, gitRepos, nil, func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		return cfg.PlanShift(target.Commits, by)
+	})
+}
+
+// reorderCommits gives new times only to the unpushed commits that are out of chronological order, such as after an
+// interactive rebase, and leaves every other commit at its original time
+func (b *batch) reorderCommits(ctx context.Context, gitRepos iter.Seq[string]) cadenceSummary {
+	fmt.Println("Moving unpushed commits that are out of chronological order...")
+
+	cfg := b.scheduleConfig()
+	return b.runCadence(ctx, gitRepos, nil, func(ctx context.Context, target *cadence.Target) (cadence.Plan, error) {
+		// Reordered commits must stay after the commit they are rebuilt on
+		var earliest *time.Time
+		if !target.IsRoot {
+			if t, err := git.GetCommitTime(ctx, target.RepoPath, target.ParentCommit); err != nil {
+				fmt.Printf("   ⚠️  Warning: Could not get parent commit time: %v\n", err)
+			} else {
+				earliest = &t
+			}
+		}
+		return cfg.PlanReorder(target.Commits, earliest)
+	})
+}
+
+// amendLast gives only HEAD of repo a new time with git commit --amend. clock is the new time of day as HH:MM or
+// HH:MM:SS on the commit's day; when empty a time within work hours after the parent commit is picked.
+func (b *batch) amendLast(ctx context.Context, repo string, clock string) (err error) {
+	cfg := b.repoScheduleConfig(ctx, repo)
+
+	target, err := cadence.LoadTarget(ctx, repo, b.parentBranch(ctx, repo))
+	if err != nil {
+		return fmt.Errorf("could not check commits for %s: %w", repo, err)
+	}
+
+	// POST_REWRITE_HOOK runs last on every way out, as it does for cadenceRepo
+	var rewritten []cadence.Rewritten
+	var followUp error
+	amended := 0
+	defer func() { b.postRewriteHook(ctx, target, rewritten, amended, errors.Join(err, followUp), os.Stdout) }()
+
+	if len(target.Commits) == 0 {
+		fmt.Printf("✅ %s: No unpushed commits to amend\n", repo)
+		return nil
+	}
+
+	head := target.Commits[0]
+	headTime, err := head.Time()
+	if err != nil {
+		return fmt.Errorf("failed to parse commit time %s: %w", head.DateTime, err)
+	}
+	if cfg.Location != nil {
+		headTime = headTime.In(cfg.Location)
+	}
+	day := time.Date(headTime.Year(), headTime.Month(), headTime.Day(), 0, 0, 0, 0, headTime.Location())
+
+	var newTime time.Time
+	if clock != "" {
+		newTime, err = timeOnDay(day, clock)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Stay after the parent so the history keeps its order
+		var earliest *time.Time
+		if len(head.Parents) > 0 {
+			if t, err := git.GetCommitTime(ctx, repo, head.Parents[0]); err == nil {
+				earliest = &t
+			}
+		}
+		newTime = cfg.GenerateCommitTimesForDay(day, 1, earliest)[0]
+	}
+	if newTime.After(time.Now()) {
+		return fmt.Errorf("%s would move %s into the future", newTime.Format("2006-01-02 15:04:05"), head.Hash)
+	}
+
+	if err := b.checkRepoSize(ctx, repo, os.Stdout); err != nil {
+		return err
+	}
+	if err := b.createBackupsForRepos(ctx, []string{repo}); err != nil {
+		fmt.Printf("Warning: Failed to create backups: %v\n", err)
+	}
+
+	fmt.Printf("\n📦 %s\n", repo)
+	fmt.Printf("   • Will update %s: %s -> %s\n", head.Hash, head.DateTime, newTime.Format("2006-01-02 15:04:05"))
+
+	opts := b.rewriteOptions(ctx, repo)
+	opts.OnCommit = printReplayResult
+	b.keepReflog(ctx, repo)
+	collectRewritten(&opts, &rewritten)
+	verifySparseCheckout := guardSparseCheckout(ctx, repo)
+	_, err = cadence.AmendHead(ctx, target, newTime, opts)
+	followUp = verifySparseCheckout()
+	if err != nil {
+		if errors.Is(err, cadence.ErrDiverged) {
+			return fmt.Errorf("%s: skipping, %w (pull first or rerun with --allow-diverged)", repo, err)
+		}
+		return fmt.Errorf("failed to amend %s: %w", head.Hash, err)
+	}
+	amended = 1
+	followUp = errors.Join(followUp, b.noteRewrittenCommits(ctx, repo, opts, rewritten), verifyMessages(ctx, repo, opts, rewritten), b.housekeep(ctx, repo))
+	return nil
+}
+
+// keepReflog makes repo keep its reflog entries for REWRITE_REFLOG_KEEP_DAYS before it is rewritten, so the
+// original commits stay recoverable at least that long. A failure is only a warning.
+func (s *settings) keepReflog(ctx context.Context, repo string) {
+	if s.RewriteReflogKeepDays <= 0 {
+		return
+	}
+	changed, err := git.EnsureReflogRetention(ctx, repo, s.RewriteReflogKeepDays)
+	if err != nil {
+		fmt.Printf("   Warning: Could not extend the reflog retention: %v\n", err)
+	}
+	if len(changed) > 0 {
+		fmt.Printf("   🕰️  Keeping reflog entries for %d days (REWRITE_REFLOG_KEEP_DAYS): set %s\n", s.RewriteReflogKeepDays, strings.Join(changed, ", "))
+	}
+}
+
+// prefetchObjects fetches the objects of the commits about to be rewritten that a partial clone hasn't fetched yet,
+// so the rewrite doesn't stop halfway when git fetches one on demand and the remote can't be reached. Replaying in a
+// worktree (RUN_GIT_HOOKS) checks out every commit and needs the files' contents, so a failed fetch skips the
+// repository then; recreating commits from their trees doesn't read them, and it is only a warning.
+func prefetchObjects(ctx context.Context, target *cadence.Target, needsContents bool) error {
+	remote, err := git.PromisorRemote(ctx, target.RepoPath)
+	if err != nil {
+		fmt.Printf("   Warning: Could not check for a partial clone: %v\n", err)
+		return nil
+	}
+	if remote == "" {
+		return nil
+	}
+
+	revisions := []string{target.Branch}
+	if !target.IsRoot {
+		revisions = append(revisions, "^"+target.ParentCommit)
+	}
+	missing, err := git.GetMissingObjects(ctx, target.RepoPath, revisions...)
+	if err != nil {
+		fmt.Printf("   Warning: Could not check the partial clone for missing objects: %v\n", err)
+		return nil
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	fmt.Printf("   📥 Partial clone: fetching %d missing objects from %s\n", len(missing), remote)
+	if err := git.FetchObjects(ctx, target.RepoPath, remote, missing); err != nil {
+		if needsContents {
+			return fmt.Errorf("%s: skipping, the partial clone is missing %d objects the rewrite needs: %w", target.RepoPath, len(missing), err)
 		}
+		fmt.Printf("   ⚠️  %v; continuing, since recreating commits from their trees doesn't read the missing files\n", err)
 	}
-
-	fmt.Printf("\nSummary: Successfully enabled git push for %d/%d repositories\n", enabledCount, len(gitRepos))
+	return nil
 }
 
-func showPushStatus(gitRepos []string) {
-	fmt.Println("Checking push status for all repositories...")
-
-	disabledCount := 0
-	enabledCount := 0
+// guardSparseCheckout records the sparse-checkout configuration of repo before it is rewritten and returns a function
+// that verifies it is still intact afterwards, restoring it when the rewrite changed it. The function returns the
+// problem it warned about, if any.
+func guardSparseCheckout(ctx context.Context, repo string) func() error {
+	before, err := git.GetSparseCheckout(ctx, repo)
+	if err != nil {
+		fmt.Printf("   Warning: Could not read the sparse-checkout configuration: %v\n", err)
+		return func() error { return nil }
+	}
+	if before.Enabled {
+		mode := "non-cone"
+		if before.Cone {
+			mode = "cone"
+		}
+		fmt.Printf("   🌿 Sparse checkout (%s mode) is kept\n", mode)
+	}
 
-	for _, repo := range gitRepos {
-		isDisabled, err := isPushDisabled(repo)
+	// Also verified when the rewrite was interrupted and rolled back
+	return func() error {
+		ctx := context.WithoutCancel(ctx)
+		after, err := git.GetSparseCheckout(ctx, repo)
 		if err != nil {
-			fmt.Printf("Warning: Could not check status for %s: %v\n", repo, err)
-			continue
+			fmt.Printf("   Warning: Could not verify the sparse-checkout configuration: %v\n", err)
+			return fmt.Errorf("could not verify the sparse-checkout configuration: %w", err)
 		}
-
-		if isDisabled {
-			disabledCount++
-			fmt.Printf("❌ Push DISABLED: %s\n", repo)
-		} else {
-			enabledCount++
-			fmt.Printf("✅ Push ENABLED:  %s\n", repo)
+		if after == before {
+			return nil
+		}
+		if err := git.RestoreSparseCheckout(ctx, repo, before); err != nil {
+			fmt.Printf("   ⚠️  The sparse-checkout configuration changed during the rewrite and could not be restored: %v\n", err)
+			return fmt.Errorf("the sparse-checkout configuration changed during the rewrite and could not be restored: %w", err)
 		}
+		fmt.Printf("   🌿 The sparse-checkout configuration changed during the rewrite and was restored\n")
+		return nil
 	}
-
-	fmt.Printf("\nSummary: %d repositories have push enabled, %d have push disabled\n", enabledCount, disabledCount)
 }
 
-func disableGitPush(repoPath string) error {
-	hooksDir := filepath.Join(repoPath, ".git", "hooks")
-	prePushHookPath := filepath.Join(hooksDir, "pre-push")
-
-	// Create hooks directory if it doesn't exist
-	if err := os.MkdirAll(hooksDir, 0755); err != nil {
-		return fmt.Errorf("failed to create hooks directory: %w", err)
+// housekeep runs the housekeeping HOUSEKEEPING asks for after a successful rewrite. A failure is only a warning, the
+// rewrite itself is done; it is returned for POST_REWRITE_HOOK.
+func (s *settings) housekeep(ctx context.Context, repo string) error {
+	var err error
+	switch strings.ToLower(s.Housekeeping) {
+	case HousekeepingGC:
+		err = git.GCAuto(ctx, repo)
+	case HousekeepingMaintenance:
+		err = git.RunMaintenance(ctx, repo)
+	default:
+		return nil
 	}
-
-	// Write the pre-push hook
-	if err := os.WriteFile(prePushHookPath, []byte(prePushHookContent), 0755); err != nil {
-		return fmt.Errorf("failed to write pre-push hook: %w", err)
+	if err != nil {
+		fmt.Printf("   Warning: Housekeeping failed: %v\n", err)
+		return fmt.Errorf("housekeeping failed: %w", err)
 	}
-
 	return nil
 }
 
-func enableGitPush(repoPath string) error {
-	hooksDir := filepath.Join(repoPath, ".git", "hooks")
-	prePushHookPath := filepath.Join(hooksDir, "pre-push")
-
-	// Remove the pre-push hook if it exists
-	if err := os.Remove(prePushHookPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove pre-push hook: %w", err)
+// noteRewrittenCommits attaches the notes MARK_REWRITTEN and RECORD_ORIGINAL_DATES=note ask for to the commits a
+// successful rewrite with opts created. It returns the problem it warned about, if any.
+func (s *settings) noteRewrittenCommits(ctx context.Context, repo string, opts cadence.RewriteOptions, rewritten []cadence.Rewritten) error {
+	noteOpts := cadence.NoteOptions{
+		Mark:          s.MarkRewritten,
+		OriginalDates: strings.EqualFold(s.RecordOriginalDates, OriginalDatesNote),
+		Identity:      cadence.Identity{Name: opts.AuthorName, Email: opts.AuthorEmail},
+	}
+	if !noteOpts.Mark && !noteOpts.OriginalDates {
+		return nil
 	}
 
+	if err := cadence.WriteNotes(ctx, repo, rewritten, noteOpts); err != nil {
+		fmt.Printf("   ⚠️  Could not add notes to the rewritten commits: %v\n", err)
+		return fmt.Errorf("could not add notes to the rewritten commits: %w", err)
+	}
 	return nil
 }
 
-func isPushDisabled(repoPath string) (bool, error) {
-	hooksDir := filepath.Join(repoPath, ".git", "hooks")
-	prePushHookPath := filepath.Join(hooksDir, "pre-push")
-
-	// Check if pre-push hook exists
-	if _, err := os.Stat(prePushHookPath); os.IsNotExist(err) {
-		return false, nil // Push is enabled (no hook exists)
-	} else if err != nil {
-		return false, fmt.Errorf("failed to check pre-push hook: %w", err)
-	}
-
-	// Read the hook content to verify it's our disable hook
-	content, err := os.ReadFile(prePushHookPath)
-	if err != nil {
-		return false, fmt.Errorf("failed to read pre-push hook: %w", err)
+// collectRewritten has opts add every commit the rewrite recreates to rewritten, after whatever opts.OnCommit already
+// does. It is collected once per repository for the steps after the rewrite.
+func collectRewritten(opts *cadence.RewriteOptions, rewritten *[]cadence.Rewritten) {
+	onCommit := opts.OnCommit
+	opts.OnCommit = func(commit git.Commit, result git.ReplayResult) {
+		if onCommit != nil {
+			onCommit(commit, result)
+		}
+		if result.NewHash != "" {
+			*rewritten = append(*rewritten, cadence.Rewritten{Original: commit, NewHash: result.NewHash})
+		}
 	}
-
-	// Check if it contains our disable message
-	return strings.Contains(string(content), "git push is disabled for this repository"), nil
 }
 
-func showCommitStatus(gitRepos []string) {
-	fmt.Println("Checking for unpushed commits in all repositories...")
-
-	reposWithUnpushedCommits := 0
-	totalUnpushedCommits := 0
+// verifyMessages compares the messages of the commits a successful rewrite with opts created with the original ones
+// when --verify-messages is given, showing the lines of every message that changed. Messages MESSAGE_TEMPLATE
+// rewrites on purpose aren't compared. It returns an error when a message changed or couldn't be compared.
+func verifyMessages(ctx context.Context, repo string, opts cadence.RewriteOptions, rewritten []cadence.Rewritten) error {
+	if !VerifyMessages {
+		return nil
+	}
+	if opts.MessageTemplate != nil {
+		fmt.Println("   ⚠️  --verify-messages: MESSAGE_TEMPLATE rewrites the messages, so they aren't compared")
+		return nil
+	}
 
-	for _, repo := range gitRepos {
-		unpushedCommits, err := git.GetUnpushedCommits(repo, ParentGitBranchName)
+	changed, failed := 0, 0
+	for _, commit := range rewritten {
+		diff, err := git.CompareMessages(ctx, repo, commit.Original.Hash, commit.NewHash)
 		if err != nil {
-			fmt.Printf("Warning: Could not check commits for %s: %v\n", repo, err)
+			fmt.Printf("   ⚠️  Could not verify the message of %s: %v\n", commit.Original.Hash, err)
+			failed++
 			continue
 		}
-
-		if len(unpushedCommits) > 0 {
-			reposWithUnpushedCommits++
-			totalUnpushedCommits += len(unpushedCommits)
-			fmt.Printf("\n📦 %s (%d unpushed commits):\n", repo, len(unpushedCommits))
-			for _, commit := range unpushedCommits {
-				fmt.Printf("   • %s %s (%s <%s> - %s)\n", commit.Hash, commit.Subject, commit.Author, commit.Email, commit.DateTime)
-			}
-		} else {
-			fmt.Printf("✅ %s: All commits pushed\n", repo)
+		if diff == "" {
+			continue
+		}
+		changed++
+		fmt.Printf("   ❌ Message of %s changed in %.7s:\n", commit.Original.Hash, commit.NewHash)
+		for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+			fmt.Printf("      %s\n", line)
 		}
 	}
+	switch {
+	case changed > 0:
+		return fmt.Errorf("%d commit messages changed", changed)
+	case failed > 0:
+		return fmt.Errorf("could not verify %d commit messages", failed)
+	}
+	fmt.Printf("   🔍 Verified %d commit messages, all kept byte for byte\n", len(rewritten))
+	return nil
+}
 
-	fmt.Printf("\nSummary: %d repositories have unpushed commits (%d total unpushed commits)\n",
-		reposWithUnpushedCommits, totalUnpushedCommits)
+// timeOnDay returns the clock time, HH:MM or HH:MM:SS, on day in day's location
+func timeOnDay(day time.Time, clock string) (time.Time, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, clock); err == nil {
+			return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, day.Location()), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected HH:MM or HH:MM:SS", clock)
 }
 
-// isBackupFolder checks if a git repository path matches the backup folder pattern
-func isBackupFolder(repoPath string) bool {
-	baseName := filepath.Base(repoPath)
-	return strings.Contains(baseName, BackupFolderPattern)
+// outsideHoursFilter returns the check for commits of repo --only-outside-hours leaves alone, or nil to rewrite every
+// commit
+func (b *batch) outsideHoursFilter(ctx context.Context, repo string) func(git.Commit) bool {
+	if !OnlyOutsideHours {
+		return nil
+	}
+	return b.repoScheduleConfig(ctx, repo).InWorkHours
 }
 
-// commitCadence redistributes unpushed commit times across work day
-func commitCadence(gitRepos []string) {
-	fmt.Println("Redistributing unpushed commit times across work day...")
+// runCadence plans and applies new commit times for every repository, printing progress and a summary.
+// When compliant is set, the oldest commits it accepts are kept as they are.
+func (b *batch) runCadence(ctx context.Context, gitRepos iter.Seq[string], compliant complianceFunc, plan planFunc) cadenceSummary {
+	summary := cadenceSummary{StartedAt: time.Now()}
 
 	fmt.Println()
-
-	// Create backups if enabled
-	if err := createBackupsForRepos(gitRepos); err != nil {
-		fmt.Printf("Warning: Failed to create backups: %v\n", err)
+	if b.busyCalendarErr != nil {
+		fmt.Printf("Warning: Ignoring BUSY_CALENDAR, commits may be scheduled during meetings: %v\n\n", b.busyCalendarErr)
 	}
 
-	fmt.Println()
-
-	processedRepos := 0
-	totalCommitsUpdated := 0
+	// After a failure with --fail-fast the remaining repositories are only recorded as not run
+	failFast := FailFast || strings.EqualFold(b.OnRepoError, OnRepoErrorStop)
+	stopped := false
+	stopCtx, stopBackups := context.WithCancel(ctx)
+	defer stopBackups()
+	for job := range b.backupAhead(ctx, stopCtx, gitRepos) {
+		repo := job.repo
+		if ctx.Err() != nil {
+			break
+		}
+		if failFast && (len(summary.Repos(outcomeFailed)) > 0 || len(summary.Repos(outcomeTimedOut)) > 0) {
+			stopped = true
+			stopBackups()
+		}
+		if stopped {
+			summary.Results = append(summary.Results, repoResult{Repo: repo, Outcome: outcomeNotRun})
+			continue
+		}
 
-	for _, repo := range gitRepos {
-		// Skip backup folders
-		if isBackupFolder(repo) {
+		<-job.done
+		// What the job printed while the previous repositories were processed comes first
+		job.output.Flush()
+		if job.backupFolder {
 			fmt.Printf("⏭️  Skipping backup folder: %s\n", repo)
+			summary.Results = append(summary.Results, repoResult{Repo: repo, Outcome: outcomeSkipped})
 			continue
 		}
-
-		unpushedCommits, err := git.GetUnpushedCommits(repo, ParentGitBranchName)
-		if err != nil {
-			fmt.Printf("Warning: Could not check commits for %s: %v\n", repo, err)
+		if job.tooLarge != nil {
+			fmt.Printf("⚠️  %v\n", job.tooLarge)
+			summary.Results = append(summary.Results, repoResult{Repo: repo, Outcome: outcomeSkipped, Err: job.tooLarge})
 			continue
 		}
+		if job.backupErr != nil {
+			fmt.Printf("Warning: %v\n", job.backupErr)
+		} else if job.backup.Path != "" {
+			fmt.Printf("💾 Created backup: %s (%s)\n", job.backup.Path, formatSize(job.backup.Size))
+		}
 
-		if len(unpushedCommits) == 0 {
-			fmt.Printf("✅ %s: No unpushed commits to redistribute\n", repo)
+		// REPO_TIMEOUT keeps a single pathological repository from stalling the batch
+		repoStart := time.Now()
+		repoCtx, cancel := ctx, context.CancelFunc(func() {})
+		if b.RepoTimeout > 0 {
+			repoCtx, cancel = context.WithTimeout(ctx, b.RepoTimeout)
+		}
+		updatedCount, err := b.cadenceRepo(repoCtx, repo, compliant, plan, &job.output)
+		job.output.Flush()
+		// A rewrite that finished just before the deadline still counts
+		expired := errors.Is(repoCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil && (err != nil || updatedCount == 0)
+		cancel()
+		result := repoResult{Repo: repo, Outcome: outcomeUnchanged, Commits: updatedCount, Duration: time.Since(repoStart), Backup: job.backup}
+		if expired {
+			fmt.Printf("   ⏱️  %s: timed out after %s (REPO_TIMEOUT), left unchanged\n", repo, b.RepoTimeout)
+			result.Outcome, result.Commits, result.Err = outcomeTimedOut, 0, err
+			summary.Results = append(summary.Results, result)
 			continue
 		}
-
-		fmt.Printf("\n📦 %s (%d unpushed commits):\n", repo, len(unpushedCommits))
-
-		// Get current branch name
-		currentBranch, err := git.GetCurrentBranch(repo)
 		if err != nil {
-			fmt.Printf("   ❌ Error: Could not get current branch for %s: %v\n", repo, err)
-			os.Exit(1)
+			fmt.Printf("   ❌ %v\n", err)
+			result.Outcome, result.Err = outcomeFailed, err
+			summary.Results = append(summary.Results, result)
+			continue
 		}
-		fmt.Printf("   🌿 Current branch: %s\n", currentBranch)
+		b.markProcessed(ctx, repo)
 
-		// Find parent commit of the first unpushed commit (last in the slice since they're in reverse chronological order)
-		firstUnpushedCommit := unpushedCommits[len(unpushedCommits)-1]
-		parentCommitHash, err := git.GetParentCommit(repo, firstUnpushedCommit.Hash)
-		if err != nil {
-			// If this is the first commit in the repository, use empty tree as parent
-			fmt.Printf("   ⚠️  First commit in repository, using empty tree as parent\n")
-			parentCommitHash = "4b825dc642cb6eb9a060e54bf8d69288fbee4904" // Empty tree hash
-		} else {
-			fmt.Printf("   📍 Parent commit: %s\n", parentCommitHash)
+		if updatedCount > 0 {
+			result.Outcome = outcomeUpdated
+			fmt.Printf("   ✅ Successfully updated %d commits total\n", updatedCount)
 		}
+		summary.Results = append(summary.Results, result)
+	}
 
-		// Group commits by day
-		commitsByDay := groupCommitsByDay(unpushedCommits)
-
-		// Collect all commits and their new times across all days
-		var allCommits []git.Commit
-		var allNewTimes []time.Time
+	if stopped {
+		fmt.Printf("\n🛑 Stopping at the first failure, %d repositories were not processed\n", len(summary.Repos(outcomeNotRun)))
+	}
 
-		// Sort days to process them in chronological order (earliest to latest)
-		var sortedDays []string
-		for dayStr := range commitsByDay {
-			sortedDays = append(sortedDays, dayStr)
+	fmt.Printf("\nSummary: Updated %d commits across %d repositories\n", summary.Commits(), len(summary.Repos(outcomeUpdated)))
+	if backups, size := summary.Backups(); backups > 0 {
+		fmt.Printf("💾 Created %d backups, %s in total\n", backups, formatSize(size))
+	}
+	if timedOut := summary.Repos(outcomeTimedOut); len(timedOut) > 0 {
+		fmt.Printf("⏱️  %d repositories timed out and were skipped:\n", len(timedOut))
+		for _, repo := range timedOut {
+			fmt.Printf("   - %s\n", repo)
 		}
-		sort.Strings(sortedDays) // YYYY-MM-DD format sorts chronologically
-
-		for _, dayStr := range sortedDays {
-			dayCommits := commitsByDay[dayStr]
-			fmt.Printf("   📅 %s (%d commits):\n", dayStr, len(dayCommits))
+	}
 
-			// Get timezone from the first commit of the day
-			firstCommit := dayCommits[0]
-			firstCommitTime, err := time.Parse("2006-01-02 15:04:05 -0700", firstCommit.DateTime)
-			if err != nil {
-				fmt.Printf("      ❌ Failed to parse commit time %s: %v\n", firstCommit.DateTime, err)
-				continue
-			}
+	summary.Duration = time.Since(summary.StartedAt)
+	summary.Interrupted = ctx.Err() != nil
+	return summary
+}
 
-			// Parse the day to get the actual date in the commit's timezone
-			day := time.Date(firstCommitTime.Year(), firstCommitTime.Month(), firstCommitTime.Day(), 0, 0, 0, 0, firstCommitTime.Location())
+// cadenceRepo loads, plans and rewrites a single repository and returns the number of commits updated. What
+// POST_REWRITE_HOOK prints goes to out, the repository's output.
+func (b *batch) cadenceRepo(ctx context.Context, repo string, compliance complianceFunc, plan planFunc, out io.Writer) (updatedCount int, err error) {
+	target, err := cadence.LoadTarget(ctx, repo, b.parentBranch(ctx, repo))
+	if err != nil {
+		fmt.Printf("Warning: Could not check commits for %s: %v\n", repo, err)
+		return 0, nil
+	}
 
-			// Reverse commits so older commits get earlier times
-			reversedCommits := make([]git.Commit, len(dayCommits))
-			for i, commit := range dayCommits {
-				reversedCommits[len(dayCommits)-1-i] = commit
-			}
+	// POST_REWRITE_HOOK runs last on every way out, told what was rewritten and everything that failed before, in
+	// or after the rewrite
+	var rewritten []cadence.Rewritten
+	var followUp error
+	defer func() { b.postRewriteHook(ctx, target, rewritten, updatedCount, errors.Join(err, followUp), out) }()
 
-			// Generate new commit times for this specific day
-			newTimes := generateCommitTimesForDay(day, len(reversedCommits), nil)
+	if len(target.Commits) == 0 {
+		fmt.Printf("✅ %s: No unpushed commits to redistribute\n", repo)
+		return 0, nil
+	}
 
-			// Add to the collection for batch processing
-			allCommits = append(allCommits, reversedCommits...)
-			allNewTimes = append(allNewTimes, newTimes...)
+	if skipped := target.Limit(Limit); skipped > 0 {
+		fmt.Printf("✅ %s: Keeping %d older unpushed commits, only rewriting the newest %d (--limit)\n", repo, skipped, Limit)
+	}
 
-			// Show what will be updated for this day
-			for i, commit := range reversedCommits {
-				newTime := newTimes[i]
-				if commit.IsMerge {
-					fmt.Printf("      • Will update merge %s: %s -> %s\n", commit.Hash, commit.DateTime, newTime.Format("2006-01-02 15:04:05"))
-				} else {
-					fmt.Printf("      • Will update %s: %s -> %s\n", commit.Hash, commit.DateTime, newTime.Format("2006-01-02 15:04:05"))
-				}
-			}
+	if b.RewriteMergedBranches {
+		if err := target.IncludeMergedBranches(ctx); err != nil {
+			return 0, fmt.Errorf("%s: could not list commits of merged branches: %w", repo, err)
 		}
+	}
 
-		// Update all commits in a single operation
-		repoUpdatedCount := 0
-		if len(allCommits) > 0 {
-			updatedCount, err := git.UpdateCommitTimes(repo, allCommits, allNewTimes, parentCommitHash, currentBranch, RewriteBranchName, NewCommitAuthorName, NewCommitAuthorEmail)
-			if err != nil {
-				fmt.Printf("   ❌ Failed to update commits: %v\n", err)
-			} else {
-				repoUpdatedCount = updatedCount
+	var compliant func(git.Commit) bool
+	if compliance != nil {
+		compliant = compliance(ctx, repo)
+	}
+
+	// Commits an earlier run rewrote (MARK_REWRITTEN) are left as they are
+	var marks cadence.Marks
+	if b.MarkRewritten {
+		if marks, err = cadence.LoadMarks(ctx, repo, target.Commits); err != nil {
+			fmt.Printf("Warning: Could not read the code-cadence notes of %s: %v\n", repo, err)
+		}
+		if len(marks) > 0 {
+			unmarked := compliant
+			compliant = func(commit git.Commit) bool {
+				return marks.Has(commit) || (unmarked != nil && unmarked(commit))
 			}
 		}
+	}
 
-		if repoUpdatedCount > 0 {
-			processedRepos++
-			totalCommitsUpdated += repoUpdatedCount
-			fmt.Printf("   ✅ Successfully updated %d commits total\n", repoUpdatedCount)
+	if compliant != nil {
+		if skipped := target.SkipCompliantPrefix(compliant); skipped > 0 {
+			fmt.Printf("✅ %s: Keeping %d commits that need no changes\n", repo, skipped)
+		}
+		if len(target.Commits) == 0 {
+			return 0, nil
 		}
 	}
 
-	fmt.Printf("\nSummary: Updated %d commits across %d repositories\n", totalCommitsUpdated, processedRepos)
-}
-
-// generateCommitTimesForDay creates evenly distributed times across work day for a specific day
-func generateCommitTimesForDay(day time.Time, commitCount int, earliestTime *time.Time) []time.Time {
-	if commitCount <= 0 {
-		return []time.Time{}
+	// A misdetected upstream can make the entire history look unpushed
+	if b.MaxRewriteCommits > 0 && len(target.Commits) > b.MaxRewriteCommits && !Force {
+		return 0, fmt.Errorf("%s: skipping, %d unpushed commits exceeds MAX_REWRITE_COMMITS=%d (check PARENT_GIT_BRANCH_NAME or rerun with --force)",
+			repo, len(target.Commits), b.MaxRewriteCommits)
 	}
 
-	workDayStart := time.Date(day.Year(), day.Month(), day.Day(), WorkDayStartHour, 0, 0, 0, day.Location())
-	workDayEnd := time.Date(day.Year(), day.Month(), day.Day(), WorkDayEndHour, 0, 0, 0, day.Location())
-
-	// If earliestTime is provided, use it as the minimum start time
-	if earliestTime != nil && earliestTime.After(workDayStart) {
-		workDayStart = *earliestTime
+	fmt.Printf("\n📦 %s (%d unpushed commits):\n", repo, len(target.Commits))
+	fmt.Printf("   🌿 Current branch: %s\n", target.Branch)
+	if hours, ok := b.repoHours(ctx, repo); ok {
+		fmt.Printf("   ⏰ Work hours: %s (REPO_OVERRIDES %s)\n", hours, hours.Pattern)
 	}
-
-	// For current day, ensure workDayEnd doesn't exceed current time
-	now := time.Now()
-	if day.Year() == now.Year() && day.Month() == now.Month() && day.Day() == now.Day() {
-		if workDayEnd.After(now) {
-			workDayEnd = now
-		}
+	if target.IsRoot {
+		fmt.Printf("   🌱 First commit in repository, recreating it as a new root commit\n")
+	} else {
+		fmt.Printf("   📍 Parent commit: %s\n", target.ParentCommit)
 	}
 
-	workDayDuration := workDayEnd.Sub(workDayStart)
+	// The commits that are recreated at their original times instead of being rescheduled
+	excluded := make(map[string]bool)
 
-	times := make([]time.Time, commitCount)
-
-	if commitCount == 1 {
-		// Single commit goes closer to evening (7 PM)
-		eveningTime := workDayEnd.Add(-time.Duration(rand.Intn(60)) * time.Minute) // Within 1 hour of end
-		var jitter time.Duration
-		if JitterMinutes > 0 {
-			jitter = time.Duration(rand.Intn(JitterMinutes*2)-JitterMinutes) * time.Minute
+	// With --paths only the commits touching them are rescheduled, e.g. one component's commits in a monorepo
+	if len(Paths) > 0 {
+		hashes := make([]string, len(target.Commits))
+		for i, commit := range target.Commits {
+			hashes[i] = commit.Hash
 		}
-		times[0] = eveningTime.Add(jitter)
-	} else {
-		// Multiple commits distributed evenly
-		interval := workDayDuration / time.Duration(commitCount-1)
-
-		for i := 0; i < commitCount; i++ {
-			baseTime := workDayStart.Add(time.Duration(i) * interval)
-			var jitter time.Duration
-			if JitterMinutes > 0 {
-				jitter = time.Duration(rand.Intn(JitterMinutes*2)-JitterMinutes) * time.Minute
+		touching, err := git.GetCommitsTouchingPaths(ctx, repo, hashes, Paths)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", repo, err)
+		}
+		outside := 0
+		for _, commit := range target.Commits {
+			if !touching[commit.Hash] {
+				excluded[commit.Hash] = true
+				outside++
 			}
-			times[i] = baseTime.Add(jitter)
+		}
+		if outside > 0 {
+			fmt.Printf("   📂 Keeping the times of %d commits not touching %s (--paths)\n", outside, Paths.String())
 		}
 	}
 
-	// Ensure all times are within work hours and after earliestTime
-	for i, timeVal := range times {
-		if timeVal.Before(workDayStart) {
-			times[i] = workDayStart
-		} else if timeVal.After(workDayEnd) || timeVal.Equal(workDayEnd) {
-			times[i] = workDayEnd.Add(-time.Minute) // Just before end of work day
+	// Marked commits after the first unmarked one are recreated, but keep their times
+	kept := 0
+	for _, commit := range target.Commits {
+		if marks.Has(commit) && !excluded[commit.Hash] {
+			excluded[commit.Hash] = true
+			kept++
 		}
 	}
+	if kept > 0 {
+		fmt.Printf("   🔖 Keeping the times of %d commits rewritten before (MARK_REWRITTEN)\n", kept)
+	}
+	if len(excluded) == len(target.Commits) {
+		fmt.Printf("✅ %s: Nothing left to rewrite\n", repo)
+		return 0, nil
+	}
 
-	// Sort times to ensure they're in chronological order
-	sort.Slice(times, func(i, j int) bool {
-		return times[i].Before(times[j])
-	})
-
-	return times
-}
-
-// groupCommitsByDay groups commits by their date (YYYY-MM-DD format)
-func groupCommitsByDay(commits []git.Commit) map[string][]git.Commit {
-	commitsByDay := make(map[string][]git.Commit)
-
-	for _, commit := range commits {
-		// Parse the commit datetime in ISO format to extract the date
-		commitTime, err := time.Parse("2006-01-02 15:04:05 -0700", commit.DateTime)
+	// planWithout plans the rewrite with the commits in excluded left at their original times
+	planWithout := func(excluded map[string]bool) (cadence.Plan, error) {
+		if len(excluded) == 0 {
+			return plan(ctx, target)
+		}
+		subset := *target
+		subset.Commits = nil
+		for _, commit := range target.Commits {
+			if !excluded[commit.Hash] {
+				subset.Commits = append(subset.Commits, commit)
+			}
+		}
+		newPlan, err := plan(ctx, &subset)
 		if err != nil {
-			// If parsing fails, use current date as fallback
-			commitTime = time.Now()
+			return cadence.Plan{}, err
 		}
+		return newPlan.Include(target.Commits)
+	}
 
-		dayStr := commitTime.Format("2006-01-02")
-		commitsByDay[dayStr] = append(commitsByDay[dayStr], commit)
+	// With --select the user picks which of the remaining commits are rescheduled and applies the plan they were
+	// shown, since jitter makes every plan different
+	var newPlan cadence.Plan
+	if selector != nil {
+		var candidates []git.Commit
+		for _, commit := range target.Commits {
+			if !excluded[commit.Hash] {
+				candidates = append(candidates, commit)
+			}
+		}
+		var apply bool
+		newPlan, apply, err = selector.selectCommits(ctx, repo, candidates, func(deselected map[string]bool) (cadence.Plan, error) {
+			merged := maps.Clone(excluded)
+			maps.Copy(merged, deselected)
+			return planWithout(merged)
+		})
+		if err != nil {
+			return 0, fmt.Errorf("%s: selection aborted: %w", repo, err)
+		}
+		if !apply {
+			fmt.Printf("⏭️  Skipping %s\n", repo)
+			return 0, nil
+		}
+	} else if newPlan, err = planWithout(excluded); err != nil {
+		return 0, err
 	}
 
-	return commitsByDay
-}
+	writePlan(os.Stdout, newPlan)
 
-// parseWeekdays converts a CSV of weekday names/numbers to a set
-// Accepts: "Sat,Sun", "Saturday, Sunday", "Mon", or digits 0-6 (0=Sunday)
-func parseWeekdays(s string) map[time.Weekday]bool {
-	m := make(map[time.Weekday]bool)
-	if strings.TrimSpace(s) == "" {
-		return m
+	opts := b.rewriteOptions(ctx, repo)
+	if b.identityOnly {
+		opts = identityOnlyOptions(opts)
 	}
-	items := strings.Split(s, ",")
-	for _, raw := range items {
-		t := strings.TrimSpace(raw)
-		if t == "" {
-			continue
+	if opts.PreserveAuthor {
+		fmt.Printf("   👤 Keeping original authors and author dates, rescheduling committer dates only\n")
+		if opts.AuthorName != "" || opts.AuthorEmail != "" {
+			fmt.Printf("   👤 Committer: %s <%s>\n", opts.AuthorName, opts.AuthorEmail)
 		}
-		l := strings.ToLower(t)
-		switch l {
-		case "sun", "sunday", "0":
-			m[time.Sunday] = true
-		case "mon", "monday", "1":
-			m[time.Monday] = true
-		case "tue", "tues", "tuesday", "2":
-			m[time.Tuesday] = true
-		case "wed", "weds", "wednesday", "3":
-			m[time.Wednesday] = true
-		case "thu", "thur", "thurs", "thursday", "4":
-			m[time.Thursday] = true
-		case "fri", "friday", "5":
-			m[time.Friday] = true
-		case "sat", "saturday", "6":
-			m[time.Saturday] = true
-		}
-	}
-	return m
-}
-
-// enumerateDaysSkipping returns inclusive days [start..end], skipping any day whose Weekday() is in skip set.
-func enumerateDaysSkipping(start, end time.Time, skip map[time.Weekday]bool) []time.Time {
-	var days []time.Time
-	for d := start; !d.After(end); d = d.Add(24 * time.Hour) {
-		if skip != nil && skip[d.Weekday()] {
-			continue
+	} else if opts.AuthorName != "" || opts.AuthorEmail != "" {
+		fmt.Printf("   👤 Author: %s <%s>\n", opts.AuthorName, opts.AuthorEmail)
+	}
+	if opts.KeepCommitterDate && !opts.PreserveAuthor {
+		fmt.Printf("   🕰️  Keeping original committer dates, rescheduling author dates only\n")
+	}
+	opts.OnCommit = printReplayResult
+
+	// Replaying in a worktree checks out every commit, and with it every file the commit touches passes
+	// through the filters
+	if opts.RunHooks {
+		if filters, err := git.GetCheckoutFilters(ctx, repo); err != nil {
+			fmt.Printf("   ⚠️  Could not check for checkout filters: %v\n", err)
+		} else {
+			for _, filter := range filters {
+				fmt.Printf("   ⚠️  Files use the %s filter: checking out the replayed commits runs it for every changed file, which is slow and fails offline for content that isn't cached locally\n", filter)
+			}
 		}
-		days = append(days, d)
 	}
-	return days
-}
 
-// allocateAcrossDays spreads n items across m buckets with specific positioning rules.
-func allocateAcrossDays(n, m int) []int {
-	if m <= 0 {
-		return nil
+	if err := prefetchObjects(ctx, target, opts.RunHooks); err != nil {
+		return 0, err
+	}
+	b.keepReflog(ctx, repo)
+	collectRewritten(&opts, &rewritten)
+	verifySparseCheckout := guardSparseCheckout(ctx, repo)
+	updatedCount, err = cadence.Apply(ctx, target, newPlan, opts)
+	followUp = verifySparseCheckout()
+	if err != nil {
+		if errors.Is(err, cadence.ErrDiverged) {
+			err = fmt.Errorf("%s: skipping, %w (pull first or rerun with --allow-diverged)", repo, err)
+		} else {
+			err = fmt.Errorf("failed to update commits: %w", err)
+		}
+		return 0, err
 	}
-	out := make([]int, m)
-	if n <= 0 {
-		return out
+	// POST_REWRITE_HOOK sees the repository as the run leaves it and is told what went wrong after the rewrite
+	followUp = errors.Join(followUp, b.noteRewrittenCommits(ctx, repo, opts, rewritten), verifyMessages(ctx, repo, opts, rewritten))
+	if updatedCount > 0 {
+		followUp = errors.Join(followUp, b.housekeep(ctx, repo))
 	}
-
-	// Special case: single commit goes to last day
-	if n == 1 {
-		out[m-1] = 1
-		return out
+	if b.schedule != nil && updatedCount > 0 {
+		b.schedule.Add(newPlan.Times())
 	}
-
-	// For multiple commits:
-	// - First commit goes to first day
-	// - Last commit goes to last day
-	// - Middle commits are spread with jitter between first and last days
-
-	// Special case: only one day available
-	if m == 1 {
-		out[0] = n
-		return out
+	if calendar != nil && updatedCount > 0 {
+		calendar.add(repo, newPlan.Commits(), newPlan.Times())
 	}
 
-	// Place first commit
-	out[0] = 1
-
-	// Place last commit
-	out[m-1] = 1
+	return updatedCount, nil
+}
 
-	// Handle middle commits (n-2 remaining)
-	if n > 2 {
-		middleCommits := n - 2
-		availableDays := m - 2 // Days between first and last (exclusive)
+// printReplayResult reports what happened to a single commit during the rewrite
+func printReplayResult(commit git.Commit, result git.ReplayResult) {
+	switch result.Status {
+	case git.ReplayDropped:
+		fmt.Printf("      🗑️  Dropped %s: %s (no changes left, EMPTY_COMMITS=drop)\n", commit.Hash, commit.Subject)
+	case git.ReplayKeptEmpty:
+		fmt.Printf("      ⚪ Rewrote %s -> %.7s: %s (empty commit kept)\n", commit.Hash, result.NewHash, commit.Subject)
+	default:
+		fmt.Printf("      ✔️  Rewrote %s -> %.7s: %s\n", commit.Hash, result.NewHash, commit.Subject)
+	}
+}
 
-		if availableDays > 0 {
-			// Add jitter by using random distribution
-			for i := 0; i < middleCommits; i++ {
-				var dayOffset int
-				if JitterDays {
-					// Use random jitter
-					dayOffset = rand.Intn(availableDays)
-				} else {
-					// Use original deterministic distribution when no jitter
-					dayOffset = (i*7 + i*i) % availableDays
-				}
-				dayIndex := 1 + dayOffset // Start from day 1 (after first day)
-				out[dayIndex]++
-			}
-		} else {
-			// If no middle days available, distribute between first and last
-			for i := 0; i < middleCommits; i++ {
-				if i%2 == 0 {
-					out[0]++ // Even indices go to first day
-				} else {
-					out[m-1]++ // Odd indices go to last day
-				}
+// writePlan writes what will be updated for each planned day to w
+func writePlan(w io.Writer, plan cadence.Plan) {
+	for _, day := range plan.Days {
+		fmt.Fprintf(w, "   📅 %s (%d commits):\n", day.Day.Format("2006-01-02"), len(day.Commits))
+		for i, commit := range day.Commits {
+			if commit.IsMerge {
+				fmt.Fprintf(w, "      • Will update merge %s: %s -> %s\n", commit.Hash, commit.DateTime, day.Times[i].Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Fprintf(w, "      • Will update %s: %s -> %s\n", commit.Hash, commit.DateTime, day.Times[i].Format("2006-01-02 15:04:05"))
 			}
 		}
 	}
-
-	return out
 }
 
-// createBackup creates a timestamped backup of a directory
-func createBackup(sourcePath string) (string, error) {
-	// Generate timestamp for backup folder name
-	timestamp := time.Now().Format("2006-01-02-15-04-05")
-	backupPath := fmt.Sprintf("%s%s%s", sourcePath, BackupFolderPattern, timestamp)
-
-	// Use cp command to copy the directory recursively
-	cmd := exec.Command("cp", "-r", sourcePath, backupPath)
-	var stdout, stderr strings.Builder
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to create backup of %s: %v\nstdout: %s\nstderr: %s", sourcePath, err, stdout.String(), stderr.String())
+// checkRepoSize returns an error for a repository larger than MAX_REPO_SIZE_MB, unless --force is given. A size that
+// can't be determined is reported to out.
+func (s *settings) checkRepoSize(ctx context.Context, repo string, out io.Writer) error {
+	if s.MaxRepoSizeMB <= 0 || Force {
+		return nil
 	}
 
-	return backupPath, nil
+	limit := int64(s.MaxRepoSizeMB) << 20
+	size, err := backup.Size(ctx, repo, limit)
+	if err != nil {
+		fmt.Fprintf(out, "Warning: Could not check the size of %s: %v\n", repo, err)
+		return nil
+	}
+	if size > limit {
+		return fmt.Errorf("%s: skipping, larger than MAX_REPO_SIZE_MB=%d (rerun with --force to back up and rewrite it anyway)", repo, s.MaxRepoSizeMB)
+	}
+	return nil
 }
 
 // createBackupsForRepos creates backups for all repositories if backup is enabled
-func createBackupsForRepos(gitRepos []string) error {
-	if !CreateBackup {
+func (s *settings) createBackupsForRepos(ctx context.Context, gitRepos []string) error {
+	if !s.CreateBackup {
 		return nil // Backup is disabled
 	}
 
 	fmt.Println("Creating backups of repositories...")
 	backupCount := 0
+	var totalSize int64
 
 	for _, repo := range gitRepos {
-		backupPath, err := createBackup(repo)
+		if ctx.Err() != nil {
+			break
+		}
+
+		created, err := backup.Create(ctx, repo, s.backupOptions())
 		if err != nil {
 			fmt.Printf("Warning: Failed to create backup for %s: %v\n", repo, err)
 			continue
 		}
 		backupCount++
-		fmt.Printf("✓ Created backup: %s\n", backupPath)
+		totalSize += created.Size
+		fmt.Printf("✓ Created backup: %s (%s)\n", created.Path, formatSize(created.Size))
 	}
 
 	if backupCount > 0 {
-		fmt.Printf("Successfully created %d backups\n", backupCount)
+		fmt.Printf("Successfully created %d backups (%s)\n", backupCount, formatSize(totalSize))
 	}
 
 	return nil
 }
-
-// commitCadenceSpan redistributes unpushed commit times across all days from oldest unpushed commit through today.
-// It skips weekdays configured via SKIP_WEEK_DAYS and keeps commits within work hours.
-func commitCadenceSpan(gitRepos []string) {
-	fmt.Println("Redistributing unpushed commit times across all days since last push...")
-
-	// Create backups if enabled
-	if err := createBackupsForRepos(gitRepos); err != nil {
-		fmt.Printf("Warning: Failed to create backups: %v\n", err)
-	}
-
-	fmt.Println()
-
-	processedRepos := 0
-	totalCommitsUpdated := 0
-
-	now := time.Now()
-
-	for _, repo := range gitRepos {
-		// Skip backup folders
-		if isBackupFolder(repo) {
-			fmt.Printf("⏭️  Skipping backup folder: %s\n", repo)
-			continue
-		}
-
-		unpushedCommits, err := git.GetUnpushedCommits(repo, ParentGitBranchName)
-		if err != nil {
-			fmt.Printf("Warning: Could not check commits for %s: %v\n", repo, err)
-			continue
-		}
-		if len(unpushedCommits) == 0 {
-			fmt.Printf("✅ %s: No unpushed commits to redistribute\n", repo)
-			continue
-		}
-
-		fmt.Printf("\n📦 %s (%d unpushed commits):\n", repo, len(unpushedCommits))
-
-		currentBranch, err := git.GetCurrentBranch(repo)
-		if err != nil {
-			fmt.Printf("   ❌ Error: Could not get current branch for %s: %v\n", repo, err)
-			continue
-		}
-		fmt.Printf("   🌿 Current branch: %s\n", currentBranch)
-
-		oldestUnpushed := unpushedCommits[len(unpushedCommits)-1]
-		parentCommitHash, err := git.GetParentCommit(repo, oldestUnpushed.Hash)
-		if err != nil {
-			// If this is the first commit in the repository, use empty tree as parent
-			fmt.Printf("   ⚠️  First commit in repository, using empty tree as parent\n")
-			parentCommitHash = "4b825dc642cb6eb9a060e54bf8d69288fbee4904" // Empty tree hash
-		} else {
-			fmt.Printf("   📍 Parent commit: %s\n", parentCommitHash)
-		}
-
-		oldestTime, err := time.Parse("2006-01-02 15:04:05 -0700", oldestUnpushed.DateTime)
-		if err != nil {
-			fmt.Printf("   ❌ Failed to parse oldest commit time %s: %v\n", oldestUnpushed.DateTime, err)
-			continue
-		}
-		loc := oldestTime.Location()
-
-		startDay := time.Date(oldestTime.Year(), oldestTime.Month(), oldestTime.Day(), 0, 0, 0, 0, loc)
-		today := time.Date(now.In(loc).Year(), now.In(loc).Month(), now.In(loc).Day(), 0, 0, 0, 0, loc)
-
-		// Build list of eligible days [startDay..today], skipping configured weekdays
-		days := enumerateDaysSkipping(startDay, today, skipWeekdaysSet)
-		if len(days) == 0 {
-			fmt.Printf("   ⚠️ No eligible days in range after applying SKIP_WEEK_DAYS=%q\n", SkipWeekDays)
-			continue
-		}
-
-		// Order commits oldest -> newest for allocation
-		ordered := make([]git.Commit, len(unpushedCommits))
-		for i := range unpushedCommits {
-			ordered[i] = unpushedCommits[len(unpushedCommits)-1-i]
-		}
-
-		alloc := allocateAcrossDays(len(ordered), len(days))
-
-		var allCommits []git.Commit
-		var allNewTimes []time.Time
-
-		// Get the last pushed commit to use as earliest time for the first day
-		var lastPushedCommit *git.Commit
-		if len(days) > 0 {
-			lastPushedCommit, err = git.GetLastPushedCommit(repo, ParentGitBranchName)
-			if err != nil {
-				fmt.Printf("   ⚠️  Warning: Could not get last pushed commit: %v\n", err)
-			}
-		}
-
-		cursor := 0
-		for i, day := range days {
-			k := alloc[i]
-			if k == 0 {
-				continue
-			}
-			sub := ordered[cursor : cursor+k]
-			cursor += k
-
-			// For the first day, use the last pushed commit time as earliest time
-			var earliestTime *time.Time
-			if i == 0 && lastPushedCommit != nil {
-				lastPushedTime, err := time.Parse("2006-01-02 15:04:05 -0700", lastPushedCommit.DateTime)
-				if err == nil {
-					earliestTime = &lastPushedTime
-				}
-			}
-
-			newTimes := generateCommitTimesForDay(day, len(sub), earliestTime)
-
-			fmt.Printf("   📅 %s (%d commits):\n", day.Format("2006-01-02"), len(sub))
-			for j := range sub {
-				if sub[j].IsMerge {
-					fmt.Printf("      • Will update merge %s: %s -> %s\n",
-						sub[j].Hash,
-						sub[j].DateTime,
-						newTimes[j].Format("2006-01-02 15:04:05"),
-					)
-				} else {
-					fmt.Printf("      • Will update %s: %s -> %s\n",
-						sub[j].Hash,
-						sub[j].DateTime,
-						newTimes[j].Format("2006-01-02 15:04:05"),
-					)
-				}
-			}
-
-			allCommits = append(allCommits, sub...)
-			allNewTimes = append(allNewTimes, newTimes...)
-		}
-
-		if len(allCommits) != len(allNewTimes) || len(allCommits) == 0 {
-			fmt.Printf("   ❌ Internal error: mismatched allocation (commits=%d times=%d)\n", len(allCommits), len(allNewTimes))
-			continue
-		}
-
-		updatedCount, err := git.UpdateCommitTimes(repo, allCommits, allNewTimes, parentCommitHash, currentBranch, RewriteBranchName, NewCommitAuthorName, NewCommitAuthorEmail)
-		if err != nil {
-			fmt.Printf("   ❌ Failed to update commits: %v\n", err)
-			continue
-		}
-
-		if updatedCount > 0 {
-			processedRepos++
-			totalCommitsUpdated += updatedCount
-			fmt.Printf("   ✅ Successfully updated %d commits total\n", updatedCount)
-		}
-	}
-
-	fmt.Printf("\nSummary: Updated %d commits across %d repositories\n", totalCommitsUpdated, processedRepos)
-}
@@ -1,10 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/egor-markin/code-cadence/backup"
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/push"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -64,25 +76,25 @@ func TestLoadConfig(t *testing.T) {
 	}()
 
 	// Test default values
-	loadConfig()
+	cfg := loadConfig()
 
-	if WorkDayStartHour != 10 {
-		t.Errorf("Expected WorkDayStartHour to be 10, got %d", WorkDayStartHour)
+	if cfg.WorkDayStartHour != 10 {
+		t.Errorf("Expected WorkDayStartHour to be 10, got %d", cfg.WorkDayStartHour)
 	}
-	if WorkDayEndHour != 19 {
-		t.Errorf("Expected WorkDayEndHour to be 19, got %d", WorkDayEndHour)
+	if cfg.WorkDayEndHour != 19 {
+		t.Errorf("Expected WorkDayEndHour to be 19, got %d", cfg.WorkDayEndHour)
 	}
-	if JitterMinutes != 30 {
-		t.Errorf("Expected JitterMinutes to be 30, got %d", JitterMinutes)
+	if cfg.JitterMinutes != 30 {
+		t.Errorf("Expected JitterMinutes to be 30, got %d", cfg.JitterMinutes)
 	}
-	if ParentGitBranchName != "origin/main" {
-		t.Errorf("Expected ParentGitBranchName to be 'origin/main', got '%s'", ParentGitBranchName)
+	if cfg.ParentGitBranchName != "auto" {
+		t.Errorf("Expected ParentGitBranchName to be 'auto', got '%s'", cfg.ParentGitBranchName)
 	}
-	if CreateBackup != false {
-		t.Errorf("Expected CreateBackup to be false, got %t", CreateBackup)
+	if cfg.CreateBackup != false {
+		t.Errorf("Expected CreateBackup to be false, got %t", cfg.CreateBackup)
 	}
-	if SkipWeekDays != "Sat,Sun" {
-		t.Errorf("Expected SkipWeekDays to be 'Sat,Sun', got '%s'", SkipWeekDays)
+	if cfg.SkipWeekDays != "Sat,Sun" {
+		t.Errorf("Expected SkipWeekDays to be 'Sat,Sun', got '%s'", cfg.SkipWeekDays)
 	}
 
 	// Test custom values
@@ -95,300 +107,1274 @@ func TestLoadConfig(t *testing.T) {
 	os.Setenv("CREATE_BACKUP", "true")
 	os.Setenv("SKIP_WEEK_DAYS", "Fri,Sat,Sun")
 
-	loadConfig()
+	cfg = loadConfig()
 
-	if WorkDayStartHour != 9 {
-		t.Errorf("Expected WorkDayStartHour to be 9, got %d", WorkDayStartHour)
+	if cfg.WorkDayStartHour != 9 {
+		t.Errorf("Expected WorkDayStartHour to be 9, got %d", cfg.WorkDayStartHour)
 	}
-	if WorkDayEndHour != 17 {
-		t.Errorf("Expected WorkDayEndHour to be 17, got %d", WorkDayEndHour)
+	if cfg.WorkDayEndHour != 17 {
+		t.Errorf("Expected WorkDayEndHour to be 17, got %d", cfg.WorkDayEndHour)
 	}
-	if JitterMinutes != 15 {
-		t.Errorf("Expected JitterMinutes to be 15, got %d", JitterMinutes)
+	if cfg.JitterMinutes != 15 {
+		t.Errorf("Expected JitterMinutes to be 15, got %d", cfg.JitterMinutes)
 	}
-	if ParentGitBranchName != "origin/develop" {
-		t.Errorf("Expected ParentGitBranchName to be 'origin/develop', got '%s'", ParentGitBranchName)
+	if cfg.ParentGitBranchName != "origin/develop" {
+		t.Errorf("Expected ParentGitBranchName to be 'origin/develop', got '%s'", cfg.ParentGitBranchName)
 	}
-	if NewCommitAuthorName != "Test User" {
-		t.Errorf("Expected NewCommitAuthorName to be 'Test User', got '%s'", NewCommitAuthorName)
+	if cfg.NewCommitAuthorName != "Test User" {
+		t.Errorf("Expected NewCommitAuthorName to be 'Test User', got '%s'", cfg.NewCommitAuthorName)
 	}
-	if NewCommitAuthorEmail != "test@example.com" {
-		t.Errorf("Expected NewCommitAuthorEmail to be 'test@example.com', got '%s'", NewCommitAuthorEmail)
+	if cfg.NewCommitAuthorEmail != "test@example.com" {
+		t.Errorf("Expected NewCommitAuthorEmail to be 'test@example.com', got '%s'", cfg.NewCommitAuthorEmail)
 	}
-	if CreateBackup != true {
-		t.Errorf("Expected CreateBackup to be true, got %t", CreateBackup)
+	if cfg.CreateBackup != true {
+		t.Errorf("Expected CreateBackup to be true, got %t", cfg.CreateBackup)
 	}
-	if SkipWeekDays != "Fri,Sat,Sun" {
-		t.Errorf("Expected SkipWeekDays to be 'Fri,Sat,Sun', got '%s'", SkipWeekDays)
+	if cfg.SkipWeekDays != "Fri,Sat,Sun" {
+		t.Errorf("Expected SkipWeekDays to be 'Fri,Sat,Sun', got '%s'", cfg.SkipWeekDays)
 	}
 }
 
 func TestGetEnvString(t *testing.T) {
+	cfg := loadConfig()
+
 	// Test with existing environment variable
 	os.Setenv("TEST_VAR", "test_value")
 	defer os.Unsetenv("TEST_VAR")
 
-	result := getEnvString("TEST_VAR", "default")
+	result := cfg.getEnvString("TEST_VAR", "default")
 	if result != "test_value" {
 		t.Errorf("Expected 'test_value', got '%s'", result)
 	}
 
 	// Test with non-existing environment variable
-	result = getEnvString("NON_EXISTING_VAR", "default_value")
+	result = cfg.getEnvString("NON_EXISTING_VAR", "default_value")
 	if result != "default_value" {
 		t.Errorf("Expected 'default_value', got '%s'", result)
 	}
 
 	// Test with empty environment variable
 	os.Setenv("EMPTY_VAR", "")
-	result = getEnvString("EMPTY_VAR", "default")
+	result = cfg.getEnvString("EMPTY_VAR", "default")
 	if result != "default" {
 		t.Errorf("Expected 'default', got '%s'", result)
 	}
 }
 
 func TestGetEnvInt(t *testing.T) {
+	cfg := loadConfig()
+
 	// Test with valid integer
 	os.Setenv("TEST_INT", "42")
 	defer os.Unsetenv("TEST_INT")
 
-	result := getEnvInt("TEST_INT", 0)
+	result := cfg.getEnvInt("TEST_INT", 0)
 	if result != 42 {
 		t.Errorf("Expected 42, got %d", result)
 	}
 
 	// Test with invalid integer
 	os.Setenv("INVALID_INT", "not_a_number")
-	result = getEnvInt("INVALID_INT", 10)
+	result = cfg.getEnvInt("INVALID_INT", 10)
 	if result != 10 {
 		t.Errorf("Expected 10, got %d", result)
 	}
 
 	// Test with non-existing variable
-	result = getEnvInt("NON_EXISTING", 5)
+	result = cfg.getEnvInt("NON_EXISTING", 5)
 	if result != 5 {
 		t.Errorf("Expected 5, got %d", result)
 	}
 }
 
 func TestGetEnvBool(t *testing.T) {
+	cfg := loadConfig()
+
 	// Test with true
 	os.Setenv("TEST_BOOL", "true")
 	defer os.Unsetenv("TEST_BOOL")
 
-	result := getEnvBool("TEST_BOOL", false)
+	result := cfg.getEnvBool("TEST_BOOL", false)
 	if result != true {
 		t.Errorf("Expected true, got %t", result)
 	}
 
 	// Test with false
 	os.Setenv("TEST_BOOL", "false")
-	result = getEnvBool("TEST_BOOL", true)
+	result = cfg.getEnvBool("TEST_BOOL", true)
 	if result != false {
 		t.Errorf("Expected false, got %t", result)
 	}
 
 	// Test with invalid boolean
 	os.Setenv("INVALID_BOOL", "maybe")
-	result = getEnvBool("INVALID_BOOL", true)
+	result = cfg.getEnvBool("INVALID_BOOL", true)
 	if result != true {
 		t.Errorf("Expected true, got %t", result)
 	}
 
 	// Test with non-existing variable
-	result = getEnvBool("NON_EXISTING", false)
+	result = cfg.getEnvBool("NON_EXISTING", false)
 	if result != false {
 		t.Errorf("Expected false, got %t", result)
 	}
 }
 
-func TestFindGitRepositories(t *testing.T) {
-	// Create a temporary directory structure
-	tempDir := t.TempDir()
+func TestGetEnvDuration(t *testing.T) {
+	cfg := loadConfig()
 
-	// Create some directories
-	repo1 := filepath.Join(tempDir, "repo1")
-	repo2 := filepath.Join(tempDir, "repo2")
-	nonRepo := filepath.Join(tempDir, "non-repo")
+	// Test with Go duration string
+	os.Setenv("TEST_DURATION", "90s")
+	defer os.Unsetenv("TEST_DURATION")
 
-	os.MkdirAll(repo1, 0755)
-	os.MkdirAll(repo2, 0755)
-	os.MkdirAll(nonRepo, 0755)
+	result := cfg.getEnvDuration("TEST_DURATION", time.Minute)
+	if result != 90*time.Second {
+		t.Errorf("Expected 90s, got %s", result)
+	}
 
-	// Create .git directories
-	os.MkdirAll(filepath.Join(repo1, ".git"), 0755)
-	os.MkdirAll(filepath.Join(repo2, ".git"), 0755)
+	// Test with plain number of seconds
+	os.Setenv("TEST_DURATION", "120")
+	result = cfg.getEnvDuration("TEST_DURATION", time.Minute)
+	if result != 2*time.Minute {
+		t.Errorf("Expected 2m0s, got %s", result)
+	}
 
-	// Create a nested repo
-	nestedRepo := filepath.Join(tempDir, "parent", "nested-repo")
-	os.MkdirAll(filepath.Join(nestedRepo, ".git"), 0755)
+	// Test with invalid duration
+	os.Setenv("TEST_DURATION", "soon")
+	result = cfg.getEnvDuration("TEST_DURATION", time.Minute)
+	if result != time.Minute {
+		t.Errorf("Expected 1m0s, got %s", result)
+	}
 
-	// Test finding repositories
-	repos, err := findGitRepositories(tempDir)
-	if err != nil {
-		t.Fatalf("Error finding git repositories: %v", err)
+	// Test with non-existing variable
+	result = cfg.getEnvDuration("NON_EXISTING", 5*time.Second)
+	if result != 5*time.Second {
+		t.Errorf("Expected 5s, got %s", result)
 	}
+}
 
-	if len(repos) != 3 {
-		t.Errorf("Expected 3 repositories, got %d", len(repos))
+func TestValidCommands(t *testing.T) {
+	expectedCommands := []string{
+		CmdPushDisable,
+		CmdPushEnable,
+		CmdPushStatus,
+		CmdPushHookUpgrade,
+		CmdCommitStatus,
+		CmdSummary,
+		CmdRepoHealth,
+		CmdListRepos,
+		CmdAuditHours,
+		CmdLintIdentity,
+		CmdEmailReport,
+		CmdCommitCadence,
+		CmdCommitCadenceSpan,
+		CmdShiftWeekends,
+		CmdShift,
+		CmdReorder,
+		CmdFixAuthor,
+		CmdAmendLast,
+		CmdVerifyBackup,
+		CmdTui,
 	}
 
-	// Verify all expected repos are found
-	expectedRepos := []string{repo1, repo2, nestedRepo}
-	for _, expected := range expectedRepos {
+	if len(validCommands) != len(expectedCommands) {
+		t.Errorf("Expected %d valid commands, got %d", len(expectedCommands), len(validCommands))
+	}
+
+	for _, expected := range expectedCommands {
 		found := false
-		for _, repo := range repos {
-			if repo == expected {
+		for _, cmd := range validCommands {
+			if cmd == expected {
 				found = true
 				break
 			}
 		}
 		if !found {
-			t.Errorf("Expected to find repository %s", expected)
+			t.Errorf("Expected command '%s' not found in validCommands", expected)
 		}
 	}
 }
 
-func TestDisableEnableGitPush(t *testing.T) {
-	// Create a temporary directory with .git structure
-	tempDir := t.TempDir()
-	gitDir := filepath.Join(tempDir, ".git", "hooks")
-	os.MkdirAll(gitDir, 0755)
+func TestParseArgs(t *testing.T) {
+	defer func() { RefreshCache = false }()
 
-	// Test disabling push
-	err := disableGitPush(tempDir)
+	args, err := parseArgs([]string{"commit_status", "--refresh", "/tmp/workspace"})
 	if err != nil {
-		t.Fatalf("Error disabling git push: %v", err)
+		t.Fatalf("Unexpected error: %v", err)
 	}
-
-	// Verify hook was created
-	hookPath := filepath.Join(gitDir, "pre-push")
-	if _, err := os.Stat(hookPath); os.IsNotExist(err) {
-		t.Error("Pre-push hook was not created")
+	if len(args) != 2 || args[0] != "commit_status" || args[1] != "/tmp/workspace" {
+		t.Errorf("Expected positional arguments [commit_status /tmp/workspace], got %v", args)
+	}
+	if !RefreshCache {
+		t.Error("Expected --refresh to be set")
 	}
 
-	// Verify hook content
-	content, err := os.ReadFile(hookPath)
+	RefreshCache = false
+	args, err = parseArgs([]string{"push_status", "."})
 	if err != nil {
-		t.Fatalf("Error reading hook content: %v", err)
+		t.Fatalf("Unexpected error: %v", err)
 	}
+	if len(args) != 2 || RefreshCache {
+		t.Errorf("Expected no flags, got args=%v refresh=%t", args, RefreshCache)
+	}
+}
 
-	if !strings.Contains(string(content), "git push is disabled for this repository") {
-		t.Error("Hook content does not contain expected disable message")
+func TestParseDayDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"3h", 3 * time.Hour, false},
+		{"-2d", -48 * time.Hour, false},
+		{"+1d12h", 36 * time.Hour, false},
+		{"-1d30m", -(24*time.Hour + 30*time.Minute), false},
+		{"90m", 90 * time.Minute, false},
+		{"", 0, true},
+		{"2", 0, true},
+		{"1d-2h", 0, true},
+		{"abc", 0, true},
 	}
 
-	// Test checking if push is disabled
-	isDisabled, err := isPushDisabled(tempDir)
+	for _, tt := range tests {
+		got, err := parseDayDuration(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDayDuration(%q) error = %v, wantErr %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("parseDayDuration(%q) = %s, expected %s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestParseArgsShiftBy(t *testing.T) {
+	defer func() { ShiftBy = 0 }()
+
+	args, err := parseArgs([]string{"shift", "/tmp/workspace", "--by", "-2d"})
 	if err != nil {
-		t.Fatalf("Error checking push status: %v", err)
+		t.Fatalf("Unexpected error: %v", err)
 	}
-	if !isDisabled {
-		t.Error("Expected push to be disabled")
+	if len(args) != 2 || ShiftBy != -48*time.Hour {
+		t.Errorf("Expected shift by -48h, got args=%v by=%s", args, ShiftBy)
 	}
 
-	// Test enabling push
-	err = enableGitPush(tempDir)
+	if _, err := parseArgs([]string{"shift", ".", "--by", "soon"}); err == nil {
+		t.Error("Expected an invalid --by value to be rejected")
+	}
+}
+
+func TestParseArgsRepoPatterns(t *testing.T) {
+	defer func() { OnlyRepos, SkipRepos = nil, nil }()
+
+	_, err := parseArgs([]string{"commit_status", ".", "--only", "service-*, api", "--only", "web", "--skip", "legacy-*"})
 	if err != nil {
-		t.Fatalf("Error enabling git push: %v", err)
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !slices.Equal(OnlyRepos, patternList{"service-*", "api", "web"}) {
+		t.Errorf("Expected --only to collect every pattern, got %v", OnlyRepos)
+	}
+	if !slices.Equal(SkipRepos, patternList{"legacy-*"}) {
+		t.Errorf("Expected --skip legacy-*, got %v", SkipRepos)
 	}
+}
+
+func TestRunCadenceRepoTimeout(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.RepoTimeout = 200 * time.Millisecond
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	// Every git command in the slow repository hangs, the other one works normally
+	slow := filepath.Join(helper.TempDir, "slow-repo")
+	runner := git.RunnerFunc(func(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+		if dir == slow {
+			<-ctx.Done()
+			return "", &git.GitError{Command: strings.Join(args, " "), Err: ctx.Err()}
+		}
+		return git.ExecRunner{}.Run(ctx, dir, env, args...)
+	})
+	ctx := git.WithRunner(context.Background(), runner)
 
-	// Verify hook was removed
-	if _, err := os.Stat(hookPath); !os.IsNotExist(err) {
-		t.Error("Pre-push hook was not removed")
+	output := helper.CaptureOutput(func() { b.commitCadence(ctx, slices.Values([]string{slow, repoPath})) })
+
+	for _, expected := range []string{"timed out after 200ms", "Updated 2 commits across 1 repositories", "1 repositories timed out and were skipped:\n   - " + slow} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q\nOutput:\n%s", expected, output)
+		}
 	}
+}
 
-	// Test checking if push is enabled
-	isDisabled, err = isPushDisabled(tempDir)
-	if err != nil {
-		t.Fatalf("Error checking push status: %v", err)
+func TestRunCadenceFailFast(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	defer func() { FailFast = false }()
+
+	// The first repository has too many unpushed commits to be rewritten
+	failing := helper.CreateGitRepo("failing-repo")
+	helper.CreateTestCommits(failing, 3, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	b.MaxRewriteCommits = 2
+
+	summary := b.commitCadence(context.Background(), slices.Values([]string{failing, repoPath}))
+	if !slices.Equal(summary.Repos(outcomeFailed), []string{failing}) || summary.Commits() != 2 {
+		t.Errorf("Expected the run to go on after the failure by default, got %+v", summary.Results)
+	}
+
+	FailFast = true
+	var output string
+	output = helper.CaptureOutput(func() { summary = b.commitCadence(context.Background(), slices.Values([]string{failing, repoPath})) })
+	if !slices.Equal(summary.Repos(outcomeNotRun), []string{repoPath}) || summary.Commits() != 0 {
+		t.Errorf("Expected --fail-fast to stop after the failure, got %+v", summary.Results)
 	}
-	if isDisabled {
-		t.Error("Expected push to be enabled")
+	if !strings.Contains(output, "Stopping at the first failure, 1 repositories were not processed") {
+		t.Errorf("Expected the stop to be reported\nOutput:\n%s", output)
 	}
 }
 
-func TestValidCommands(t *testing.T) {
-	expectedCommands := []string{
-		CmdPushDisable,
-		CmdPushEnable,
-		CmdPushStatus,
-		CmdCommitStatus,
-		CmdCommitCadence,
-		CmdCommitCadenceSpan,
+func TestRunCadenceMaxRepoSize(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	defer func() { Force = false }()
+	b.CreateBackup = true
+	b.MaxRepoSizeMB = 1
+
+	repoPath := helper.CreateGitRepo("large-repo")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	os.WriteFile(filepath.Join(repoPath, "large.bin"), make([]byte, 2<<20), 0644)
+
+	var summary cadenceSummary
+	output := helper.CaptureOutput(func() { summary = b.commitCadence(context.Background(), slices.Values([]string{repoPath})) })
+	if !slices.Equal(summary.Repos(outcomeSkipped), []string{repoPath}) || summary.Commits() != 0 {
+		t.Errorf("Expected the repository to be skipped, got %+v", summary.Results)
+	}
+	if !strings.Contains(output, "larger than MAX_REPO_SIZE_MB=1") {
+		t.Errorf("Expected a warning about the size\nOutput:\n%s", output)
+	}
+	if backups, _ := filepath.Glob(repoPath + ".backup-*"); len(backups) > 0 {
+		t.Errorf("Expected no backup of the skipped repository, got %v", backups)
 	}
 
-	if len(validCommands) != len(expectedCommands) {
-		t.Errorf("Expected %d valid commands, got %d", len(expectedCommands), len(validCommands))
+	// --force backs up and rewrites it anyway
+	Force = true
+	helper.CaptureOutput(func() { summary = b.commitCadence(context.Background(), slices.Values([]string{repoPath})) })
+	if summary.Commits() != 2 {
+		t.Errorf("Expected --force to rewrite the repository, got %+v", summary.Results)
 	}
+}
 
-	for _, expected := range expectedCommands {
-		found := false
-		for _, cmd := range validCommands {
-			if cmd == expected {
-				found = true
-				break
+func TestRunCadenceParallelBackups(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.CreateBackup, b.BackupFormat, b.BackupWorkers = true, "tar.gz", 2
+
+	var repos []string
+	for i := range 3 {
+		repo := helper.CreateGitRepo(fmt.Sprintf("repo-%d", i))
+		helper.CreateTestCommits(repo, 1, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		repos = append(repos, repo)
+	}
+
+	var summary cadenceSummary
+	output := helper.CaptureOutput(func() { summary = b.commitCadence(context.Background(), slices.Values(repos)) })
+
+	// Results keep the order of the repositories, whatever order the backups finished in
+	for i, result := range summary.Results {
+		if result.Repo != repos[i] || result.Outcome != outcomeUpdated {
+			t.Errorf("Expected %s to be updated, got %+v", repos[i], result)
+		}
+		if !strings.HasPrefix(result.Backup.Path, repos[i]+".backup-") || !strings.HasSuffix(result.Backup.Path, ".tar.gz") {
+			t.Errorf("Expected an archive backup of %s, got %q", repos[i], result.Backup.Path)
+		}
+	}
+	if count, size := summary.Backups(); count != 3 || size == 0 {
+		t.Errorf("Expected 3 backups with a total size, got %d backups of %d bytes", count, size)
+	}
+	if !strings.Contains(output, "Created 3 backups") {
+		t.Errorf("Expected the total backup size in the summary\nOutput:\n%s", output)
+	}
+}
+
+func TestRepoOutput(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	// Two backup jobs running ahead write in turns
+	var api, web repoOutput
+	fmt.Fprintln(&api, "api: checking size")
+	fmt.Fprintln(&web, "web: checking size")
+	fmt.Fprintln(&api, "api: backed up")
+	fmt.Fprintln(&web, "web: backed up")
+
+	output := helper.CaptureOutput(func() {
+		web.Flush()
+		fmt.Println("web: rewritten")
+		api.Flush()
+		api.Flush()
+	})
+	if expected := "web: checking size\nweb: backed up\nweb: rewritten\napi: checking size\napi: backed up\n"; output != expected {
+		t.Errorf("Expected the output grouped by repository, got %q", output)
+	}
+}
+
+func TestBackupAheadScanOutput(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.CreateBackup, b.BackupWorkers = true, 2
+	b.BackupDir = filepath.Join(helper.TempDir, "backups")
+
+	repos := []string{helper.CreateGitRepo("api"), helper.CreateGitRepo("web")}
+	// A stage like the fetch of STREAM_SCAN prints about every repository it passes on, and about the last one it drops
+	gitRepos := func(yield func(string) bool) {
+		for _, repo := range repos {
+			fmt.Fprintf(&b.scanOutput, "fetched %s\n", repo)
+			if !yield(repo) {
+				return
 			}
 		}
-		if !found {
-			t.Errorf("Expected command '%s' not found in validCommands", expected)
+		fmt.Fprintln(&b.scanOutput, "unchanged legacy")
+	}
+
+	ctx := context.Background()
+	output := helper.CaptureOutput(func() {
+		for job := range b.backupAhead(ctx, ctx, gitRepos) {
+			<-job.done
+			job.output.Flush()
+			fmt.Printf("rewritten %s\n", job.repo)
+		}
+	})
+	expected := fmt.Sprintf("fetched %[1]s\nrewritten %[1]s\nfetched %[2]s\nrewritten %[2]s\nunchanged legacy\n", repos[0], repos[1])
+	if output != expected {
+		t.Errorf("Expected the scan output with the repository it belongs to\nExpected:\n%s\nGot:\n%s", expected, output)
+	}
+	if b.scanOutput.held != nil {
+		t.Error("Expected the scan output to print directly again after the run")
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for bytes, expected := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KB", 5 << 20: "5.0 MB", 3 << 30: "3.0 GB"} {
+		if got := formatSize(bytes); got != expected {
+			t.Errorf("formatSize(%d) = %q, want %q", bytes, got, expected)
+		}
+	}
+}
+
+func TestVerifyBackups(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.BackupDir = filepath.Join(helper.TempDir, "backups")
+
+	repoPath := helper.CreateGitRepo("api")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	ctx := context.Background()
+	good, err := backup.Create(ctx, repoPath, b.backupOptions())
+	if err != nil {
+		t.Fatalf("Error creating backup: %v", err)
+	}
+	b.BackupFormat = string(backup.FormatTarGz)
+	if _, err := backup.Create(ctx, repoPath, b.backupOptions()); err != nil {
+		t.Fatalf("Error creating backup: %v", err)
+	}
+
+	output := helper.CaptureOutput(func() { err = verifyBackups(ctx, b.BackupDir) })
+	if err != nil || strings.Count(output, "✅") != 2 {
+		t.Errorf("Expected both backups to pass, got %v\nOutput:\n%s", err, output)
+	}
+
+	os.WriteFile(filepath.Join(good.Path, "extra.txt"), []byte("not backed up\n"), 0644)
+	output = helper.CaptureOutput(func() { err = verifyBackups(ctx, good.Path) })
+	if err == nil || !strings.Contains(output, "❌ "+good.Path) {
+		t.Errorf("Expected the changed backup to fail, got %v\nOutput:\n%s", err, output)
+	}
+}
+
+func TestAuditHours(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.BlackoutDates = "2024-01-10"
+	b.blackoutDates, _ = cadence.ParseDates(b.BlackoutDates)
+
+	// Friday 15:00 to 18:00, the last two after work hours end at 17:00
+	late := helper.CreateGitRepo("late")
+	helper.CreateTestCommits(late, 4, time.Date(2024, 1, 5, 15, 0, 0, 0, time.Local))
+	// Friday 23:00 and Saturday 00:00
+	weekend := helper.CreateGitRepo("weekend")
+	helper.CreateTestCommits(weekend, 2, time.Date(2024, 1, 5, 23, 0, 0, 0, time.Local))
+	vacation := helper.CreateGitRepo("vacation")
+	helper.CreateTestCommits(vacation, 2, time.Date(2024, 1, 10, 10, 0, 0, 0, time.Local))
+	clean := helper.CreateGitRepo("clean")
+	helper.CreateTestCommits(clean, 2, time.Date(2024, 1, 8, 10, 0, 0, 0, time.Local))
+
+	output := helper.CaptureOutput(func() {
+		b.auditHours(context.Background(), slices.Values([]string{late, weekend, vacation, clean}))
+	})
+
+	for _, expected := range []string{
+		late + ": 2 of 4 commits outside the schedule (2 outside work hours)",
+		weekend + ": 2 of 2 commits outside the schedule (1 outside work hours, 1 skipped weekday)",
+		vacation + ": 2 of 2 commits outside the schedule (2 blackout date)",
+		clean + ": All 2 commits within work hours",
+		"Summary: 6 commits in 3 of 4 repositories are outside the schedule, 6 of them unpushed",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q\nOutput:\n%s", expected, output)
 		}
 	}
 }
 
-func TestIsBackupFolder(t *testing.T) {
+func TestWorkspaceOverview(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+
+	oldest := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+	api := helper.CreateGitRepo("api")
+	helper.CreateTestCommits(api, 2, oldest)
+	if err := push.Disable(context.Background(), api); err != nil {
+		t.Fatalf("Failed to disable push: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(api, "notes.txt"), []byte("todo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	web := helper.CreateGitRepo("web")
+	helper.CreateTestCommits(web, 1, oldest.AddDate(0, 0, 2))
+	backupFolder := filepath.Join(helper.TempDir, "web"+backup.FolderPattern+"2024-01-08-10-00-00")
+	if err := os.Mkdir(backupFolder, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	overview := b.collectOverview(context.Background(), slices.Values([]string{api, web, backupFolder}))
+	expected := workspaceOverview{
+		Repos: 2, ReposWithUnpushed: 2, Unpushed: 3, Oldest: oldest, OldestRepo: api,
+		PushDisabled: 1, Dirty: 1, ReposWithBackups: 1, Backups: 1,
+	}
+	if !overview.Oldest.Equal(expected.Oldest) {
+		t.Errorf("Expected the oldest unpushed commit at %s, got %s", expected.Oldest, overview.Oldest)
+	}
+	overview.Oldest = expected.Oldest
+	if overview != expected {
+		t.Errorf("Expected %+v, got %+v", expected, overview)
+	}
+
+	output := overview.format("/workspace", oldest.Add(50*time.Hour))
+	for _, line := range []string{
+		"With unpushed commits:   2 (3 commits)",
+		"Oldest unpushed commit:  2 days ago (" + api + ")",
+		"Push disabled:           1 of 2",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected %q\nOutput:\n%s", line, output)
+		}
+	}
+}
+
+func TestRepoHealth(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+	b := &batch{settings: loadConfig()}
+
+	repoPath := helper.CreateGitRepo("api")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC))
+	missing := filepath.Join(helper.TempDir, "missing")
+
+	output := helper.CaptureOutput(func() {
+		b.repoHealth(context.Background(), slices.Values([]string{repoPath, missing}))
+	})
+	for _, expected := range []string{
+		repoPath + ": 6 loose objects (",
+		"❌ " + missing + ": git fsck failed",
+		"Summary: 1 repositories are healthy, 0 need a repack, 1 failed the checks",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q\nOutput:\n%s", expected, output)
+		}
+	}
+}
+
+func TestHousekeep(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+	cfg := loadConfig()
+	missing := filepath.Join(helper.TempDir, "missing")
+
+	cfg.Housekeeping = HousekeepingOff
+	if output := helper.CaptureOutput(func() { cfg.housekeep(context.Background(), missing) }); output != "" {
+		t.Errorf("Expected no housekeeping, got %q", output)
+	}
+
+	for _, housekeeping := range []string{HousekeepingGC, HousekeepingMaintenance} {
+		cfg.Housekeeping = housekeeping
+		repoPath := helper.CreateGitRepo("repo-" + housekeeping)
+		helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC))
+		if output := helper.CaptureOutput(func() { cfg.housekeep(context.Background(), repoPath) }); output != "" {
+			t.Errorf("Expected %s housekeeping to succeed quietly, got %q", housekeeping, output)
+		}
+		if output := helper.CaptureOutput(func() { cfg.housekeep(context.Background(), missing) }); !strings.Contains(output, "Warning: Housekeeping failed") {
+			t.Errorf("Expected a warning for a missing repository, got %q", output)
+		}
+	}
+}
+
+func TestKeepReflog(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+	cfg := loadConfig()
+
+	repoPath := helper.CreateGitRepo("api")
+	helper.CreateTestCommits(repoPath, 1, time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC))
+
+	cfg.RewriteReflogKeepDays = 120
+	output := helper.CaptureOutput(func() { cfg.keepReflog(context.Background(), repoPath) })
+	if !strings.Contains(output, "Keeping reflog entries for 120 days (REWRITE_REFLOG_KEEP_DAYS): set gc.reflogExpire, gc.reflogExpireUnreachable") {
+		t.Errorf("Expected both expiry settings to be raised, got %q", output)
+	}
+	if value, _ := git.GetConfigValue(context.Background(), repoPath, "gc.reflogExpire"); value != "120.days.ago" {
+		t.Errorf("Expected gc.reflogExpire=120.days.ago, got %q", value)
+	}
+}
+
+func TestPrefetchObjects(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+	ctx := context.Background()
+
+	upstream := helper.CreateGitRepo("upstream")
+	helper.CreateTestCommits(upstream, 2, time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC))
+	gitCmd := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	gitCmd(upstream, "config", "uploadpack.allowFilter", "true")
+	gitCmd(upstream, "config", "uploadpack.allowAnySHA1InWant", "true")
+
+	// A partial clone without a checkout has none of the files' contents; moving origin's branch back makes the
+	// newest commit an unpushed one whose file is missing
+	partialClone := func(name string) *cadence.Target {
+		clone := filepath.Join(helper.TempDir, name)
+		gitCmd(helper.TempDir, "clone", "-q", "--no-checkout", "--filter=blob:none", "file://"+filepath.ToSlash(upstream), clone)
+		gitCmd(clone, "update-ref", "refs/remotes/origin/"+gitCmd(clone, "branch", "--show-current"), "HEAD~1")
+		target, err := cadence.LoadTarget(ctx, clone, "origin/"+gitCmd(clone, "branch", "--show-current"))
+		if err != nil || len(target.Commits) != 1 {
+			t.Fatalf("Failed to load the unpushed commit: %v", err)
+		}
+		return target
+	}
+
+	target := partialClone("clone")
+	output := helper.CaptureOutput(func() {
+		if err := prefetchObjects(ctx, target, true); err != nil {
+			t.Errorf("prefetchObjects failed: %v", err)
+		}
+	})
+	if !strings.Contains(output, "Partial clone: fetching 1 missing objects from origin") {
+		t.Errorf("Expected the missing object to be fetched, got %q", output)
+	}
+	if missing, err := git.GetMissingObjects(ctx, target.RepoPath, target.Branch, "^"+target.ParentCommit); err != nil || len(missing) != 0 {
+		t.Errorf("Expected no missing objects after prefetching, got %v (%v)", missing, err)
+	}
+	if output := helper.CaptureOutput(func() { _ = prefetchObjects(ctx, target, true) }); output != "" {
+		t.Errorf("Expected nothing left to fetch, got %q", output)
+	}
+
+	// Offline, only a rewrite that checks the commits out is refused
+	target = partialClone("offline")
+	gitCmd(target.RepoPath, "remote", "set-url", "origin", "file://"+filepath.ToSlash(filepath.Join(helper.TempDir, "missing")))
+	output = helper.CaptureOutput(func() {
+		if err := prefetchObjects(ctx, target, false); err != nil {
+			t.Errorf("Expected only a warning, got %v", err)
+		}
+	})
+	if !strings.Contains(output, "continuing") {
+		t.Errorf("Expected a warning, got %q", output)
+	}
+	helper.CaptureOutput(func() {
+		if err := prefetchObjects(ctx, target, true); err == nil || !strings.Contains(err.Error(), "missing 1 objects") {
+			t.Errorf("Expected the repository to be skipped, got %v", err)
+		}
+	})
+}
+
+func TestGuardSparseCheckout(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+	ctx := context.Background()
+
+	repoPath := helper.CreateGitRepo("monorepo")
+	for _, dir := range []string{"api", "web"} {
+		if err := os.Mkdir(filepath.Join(repoPath, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	helper.CreateCommit(repoPath, "api/main.go", "package main", "Add api")
+	helper.CreateCommit(repoPath, "web/index.html", "<html>", "Add web")
+	sparseCheckout := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"sparse-checkout"}, args...)...)
+		cmd.Dir = repoPath
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git sparse-checkout %v failed: %v\nOutput: %s", args, err, output)
+		}
+	}
+
+	// Without sparse checkout nothing is reported
+	if output := helper.CaptureOutput(func() { guardSparseCheckout(ctx, repoPath)() }); output != "" {
+		t.Errorf("Expected no output, got %q", output)
+	}
+
+	sparseCheckout("set", "--cone", "api")
+	before, _ := git.GetSparseCheckout(ctx, repoPath)
+	output := helper.CaptureOutput(func() { guardSparseCheckout(ctx, repoPath)() })
+	if output != "   🌿 Sparse checkout (cone mode) is kept\n" {
+		t.Errorf("Expected the sparse checkout to be reported, got %q", output)
+	}
+
+	output = helper.CaptureOutput(func() {
+		verify := guardSparseCheckout(ctx, repoPath)
+		sparseCheckout("disable")
+		verify()
+	})
+	if !strings.Contains(output, "changed during the rewrite and was restored") {
+		t.Errorf("Expected the configuration to be restored, got %q", output)
+	}
+	if after, err := git.GetSparseCheckout(ctx, repoPath); err != nil || after != before {
+		t.Errorf("Expected %+v after restoring, got %+v (%v)", before, after, err)
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, "web", "index.html")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected web to be outside the sparse checkout again, got %v", err)
+	}
+}
+
+func TestReadRepoList(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	api := helper.CreateGitRepo("api")
+	web := helper.CreateGitRepo("my web")
+	missing := filepath.Join(helper.TempDir, "missing")
+
 	tests := []struct {
-		name     string
-		repoPath string
-		expected bool
+		name  string
+		input string
 	}{
-		{
-			name:     "regular repository path",
-			repoPath: "/path/to/my-repo",
-			expected: false,
-		},
-		{
-			name:     "backup folder with timestamp",
-			repoPath: "/path/to/my-repo.backup-2024-01-15-14-30-45",
-			expected: true,
-		},
-		{
-			name:     "backup folder in nested path",
-			repoPath: "/home/user/workspace/project.backup-2024-01-15-14-30-45",
-			expected: true,
-		},
-		{
-			name:     "folder with backup in middle of name",
-			repoPath: "/path/to/my-backup-repo",
-			expected: false,
-		},
-		{
-			name:     "folder ending with backup pattern",
-			repoPath: "/path/to/something.backup-",
-			expected: true,
-		},
-		{
-			name:     "folder with backup pattern but no timestamp",
-			repoPath: "/path/to/repo.backup",
-			expected: false,
-		},
-		{
-			name:     "empty path",
-			repoPath: "",
-			expected: false,
-		},
-		{
-			name:     "just backup pattern",
-			repoPath: ".backup-2024-01-15",
-			expected: true,
-		},
+		{"lines", api + "\n" + web + "\n"},
+		{"CRLF lines", api + "\r\n" + web + "\r\n"},
+		{"NUL-terminated", api + "\x00" + web + "\x00"},
+		{".git directories and duplicates", filepath.Join(api, ".git") + "\n\n" + web + "\n" + api + "\n"},
+		{"missing paths", api + "\n" + missing + "\n" + web},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var repos []string
+			var err error
+			output := helper.CaptureOutput(func() { repos, err = readRepoList(strings.NewReader(tt.input)) })
+			if err != nil {
+				t.Fatalf("readRepoList failed: %v", err)
+			}
+			if !slices.Equal(repos, []string{api, web}) {
+				t.Errorf("Expected %v, got %v", []string{api, web}, repos)
+			}
+			if strings.Contains(tt.input, missing) != strings.Contains(output, "Skipping "+missing) {
+				t.Errorf("Unexpected output %q", output)
+			}
+		})
 	}
+}
+
+func TestListRepos(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+	cfg := loadConfig()
+	defer func() { Print0, SkipRepos = false, nil }()
+
+	api := helper.CreateGitRepo("api")
+	web := helper.CreateGitRepo("my web")
 
+	var out strings.Builder
+	if err := cfg.listRepos(helper.TempDir, &out); err != nil {
+		t.Fatalf("listRepos failed: %v", err)
+	}
+	if expected := api + "\n" + web + "\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	Print0, SkipRepos = true, patternList{"api"}
+	out.Reset()
+	if err := cfg.listRepos(helper.TempDir, &out); err != nil {
+		t.Fatalf("listRepos failed: %v", err)
+	}
+	if expected := web + "\x00"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	defer func() { outputFormat = nil }()
+	outputFormat, _ = parseOutputFormat("{{.Name}}", CmdListRepos)
+	out.Reset()
+	if err := cfg.listRepos(helper.TempDir, &out); err != nil {
+		t.Fatalf("listRepos failed: %v", err)
+	}
+	if expected := "my web\x00"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		command string
+		valid   bool
+	}{
+		{"commit fields", `{{.Name}}{{"\t"}}{{.Hash}} {{.Date.Format "2006-01-02"}} {{.Subject}}`, CmdCommitStatus, true},
+		{"repository fields", "{{.Repo}}", CmdListRepos, true},
+		{"commit field of a repository", "{{.Hash}}", CmdListRepos, false},
+		{"misspelled field", "{{.Subjct}}", CmdCommitStatus, false},
+		{"syntax error", "{{.Hash", CmdCommitStatus, false},
+		{"unsupported command", "{{.Repo}}", CmdPushStatus, false},
+	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := isBackupFolder(tt.repoPath)
-			if result != tt.expected {
-				t.Errorf("isBackupFolder(%q) = %v, expected %v", tt.repoPath, result, tt.expected)
+			_, err := parseOutputFormat(tt.text, tt.command)
+			if (err == nil) != tt.valid {
+				t.Errorf("parseOutputFormat(%q, %s) returned %v", tt.text, tt.command, err)
 			}
 		})
 	}
 }
+
+func TestCommitStatusFormat(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	defer func() { outputFormat = nil }()
+
+	repoPath := helper.CreateGitRepo("api")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	var err error
+	outputFormat, err = parseOutputFormat(`{{.Name}}|{{.Author}}|{{.Date.Format "2006-01-02"}}|{{.Subject}}`, CmdCommitStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records strings.Builder
+	output := helper.CaptureOutput(func() { err = b.formatCommitStatus(context.Background(), helper.TempDir, &records) })
+	if err != nil {
+		t.Fatalf("Expected commit_status to succeed, got %v", err)
+	}
+
+	if expected := "api|Test User|2024-01-01|Test commit 1\napi|Test User|2024-01-01|Test commit 0\n"; records.String() != expected {
+		t.Errorf("Expected records %q, got %q", expected, records.String())
+	}
+	if output != "" {
+		t.Errorf("Expected nothing but the records\nOutput:\n%s", output)
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		30 * time.Second: "0 minutes",
+		time.Minute:      "1 minute",
+		5 * time.Hour:    "5 hours",
+		25 * time.Hour:   "1 day",
+		72 * time.Hour:   "3 days",
+	} {
+		if got := formatAge(d); got != expected {
+			t.Errorf("formatAge(%s) = %q, want %q", d, got, expected)
+		}
+	}
+}
+
+func TestLintIdentity(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	defer func() { FixIdentity = false }()
+	b.NewCommitAuthorName, b.NewCommitAuthorEmail = "Jane Doe", "jane@corp.example"
+
+	// Made with the wrong identity on a Saturday, which the fix must not move
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 6, 22, 0, 0, 0, time.Local))
+	before := helper.GetCommits(repoPath)
+
+	output := helper.CaptureOutput(func() { b.lintIdentity(context.Background(), CmdLintIdentity, slices.Values([]string{repoPath})) })
+	for _, expected := range []string{
+		repoPath + ": 2 of 2 unpushed commits have a different author",
+		"Test User <test@example.com> - Test commit 0",
+		"Rerun with --fix to correct them",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q\nOutput:\n%s", expected, output)
+		}
+	}
+	if after := helper.GetCommits(repoPath); after[0].Hash != before[0].Hash {
+		t.Fatalf("Expected lint_identity to change nothing without --fix")
+	}
+
+	FixIdentity = true
+	helper.CaptureOutput(func() { b.lintIdentity(context.Background(), CmdLintIdentity, slices.Values([]string{repoPath})) })
+	after := helper.GetCommits(repoPath)
+	helper.AssertCommitCount(after, len(before))
+	for i, commit := range after {
+		if commit.Author != "Jane Doe" || commit.Email != "jane@corp.example" {
+			t.Errorf("Expected commit %d to be by Jane Doe <jane@corp.example>, got %s <%s>", i, commit.Author, commit.Email)
+		}
+		if commit.DateTime != before[i].DateTime || commit.CommitterDateTime != before[i].CommitterDateTime || commit.Subject != before[i].Subject {
+			t.Errorf("Expected commit %d to keep its dates and message, got %+v, was %+v", i, commit, before[i])
+		}
+	}
+
+	output = helper.CaptureOutput(func() { b.lintIdentity(context.Background(), CmdLintIdentity, slices.Values([]string{repoPath})) })
+	if !strings.Contains(output, repoPath+": All 2 unpushed commits have the expected author") {
+		t.Errorf("Expected the fixed repository to pass\nOutput:\n%s", output)
+	}
+}
+
+func TestFixAuthor(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.NewCommitAuthorName, b.NewCommitAuthorEmail = "Jane Doe", "jane@corp.example"
+	// Settings that would otherwise keep the author or change the messages
+	b.PreserveAuthor, b.SignOff = true, true
+
+	// Late on a Sunday, which fix_author must leave alone
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateTestCommits(repoPath, 3, time.Date(2024, 1, 7, 21, 0, 0, 0, time.Local))
+	before := helper.GetCommits(repoPath)
+
+	var summary cadenceSummary
+	helper.CaptureOutput(func() { summary = b.fixAuthors(context.Background(), slices.Values([]string{repoPath})) })
+	if summary.Commits() != 3 {
+		t.Errorf("Expected 3 rewritten commits, got %+v", summary.Results)
+	}
+
+	after := helper.GetCommits(repoPath)
+	helper.AssertCommitCount(after, len(before))
+	for i, commit := range after {
+		if commit.Author != "Jane Doe" || commit.Email != "jane@corp.example" {
+			t.Errorf("Expected commit %d to be by Jane Doe <jane@corp.example>, got %s <%s>", i, commit.Author, commit.Email)
+		}
+		if commit.DateTime != before[i].DateTime || commit.CommitterDateTime != before[i].CommitterDateTime {
+			t.Errorf("Expected commit %d to keep its dates, got %s/%s, was %s/%s",
+				i, commit.DateTime, commit.CommitterDateTime, before[i].DateTime, before[i].CommitterDateTime)
+		}
+	}
+	if message, err := git.GetCommitMessage(context.Background(), repoPath, "HEAD"); err != nil || strings.TrimSpace(message) != "Test commit 2" {
+		t.Errorf("Expected the message to be kept, got %q (err %v)", message, err)
+	}
+}
+
+func TestCalendarExport(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	ICSFile = filepath.Join(helper.TempDir, "sessions.ics")
+	defer func() { ICSFile = "" }()
+
+	// One session of three commits an hour apart, and two more separated by a long break
+	api := helper.CreateGitRepo("api")
+	helper.CreateTestCommits(api, 3, time.Date(2024, 1, 8, 9, 0, 0, 0, time.Local))
+	web := helper.CreateGitRepo("web")
+	helper.CreateTestCommits(web, 1, time.Date(2024, 1, 8, 10, 0, 0, 0, time.Local))
+	helper.CreateCommit(web, "late.txt", "late", "Late fix")
+
+	output := helper.CaptureOutput(func() {
+		b.run(context.Background(), CmdCommitStatus, helper.TempDir, slices.Values([]string{api, web}))
+	})
+	if !strings.Contains(output, "Wrote 3 work sessions to "+ICSFile) {
+		t.Errorf("Expected 3 sessions to be written\nOutput:\n%s", output)
+	}
+	if calendar != nil {
+		t.Errorf("Expected the export to end with the run")
+	}
+
+	data, err := os.ReadFile(ICSFile)
+	if err != nil {
+		t.Fatalf("Failed to read the calendar: %v", err)
+	}
+	doc := strings.ReplaceAll(string(data), "\r\n ", "")
+	start := time.Date(2024, 1, 8, 8, 30, 0, 0, time.Local).UTC().Format("20060102T150405Z")
+	end := time.Date(2024, 1, 8, 11, 0, 0, 0, time.Local).UTC().Format("20060102T150405Z")
+	for _, expected := range []string{
+		"DTSTART:" + start + "\r\nDTEND:" + end + "\r\nSUMMARY:api (3 commits)",
+		"SUMMARY:web (1 commits)",
+		"Test commit 2",
+	} {
+		if !strings.Contains(doc, expected) {
+			t.Errorf("Expected %q in\n%s", expected, doc)
+		}
+	}
+	if strings.Count(doc, "BEGIN:VEVENT") != 3 {
+		t.Errorf("Expected 3 events in\n%s", doc)
+	}
+}
+
+func TestFetchReposOffline(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	b.FetchTimeout = 50 * time.Millisecond
+
+	// Every fetch hangs like an unreachable remote would
+	var fetched []string
+	hang := git.RunnerFunc(func(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+		fetched = append(fetched, dir)
+		<-ctx.Done()
+		return "", &git.GitError{Command: strings.Join(args, " "), Err: ctx.Err()}
+	})
+	ctx := git.WithRunner(context.Background(), hang)
+
+	output := helper.CaptureOutput(func() { b.fetchRepos(ctx, []string{"/repo/a", "/repo/b", "/repo/c"}) })
+
+	if len(fetched) != 1 {
+		t.Errorf("Expected fetching to stop after the first timeout, fetched %v", fetched)
+	}
+	if !strings.Contains(output, "assuming offline") {
+		t.Errorf("Expected an offline warning, got:\n%s", output)
+	}
+}
+
+func TestStreamCommand(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+	defer func() { SkipRepos = nil }()
+	b.StreamScan, b.ScanCache = true, false
+	SkipRepos = patternList{"legacy-*"}
+
+	repoPath := helper.CreateGitRepo("service-repo")
+	helper.CreateTestCommits(repoPath, 1, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	legacy := helper.CreateGitRepo("legacy-repo")
+
+	var err error
+	output := helper.CaptureOutput(func() { err = runCommand(context.Background(), b, CmdCommitStatus, helper.TempDir) })
+	if err != nil {
+		t.Fatalf("Expected the streamed run to succeed, got %v", err)
+	}
+	if !strings.Contains(output, repoPath+" (1 unpushed commits)") || strings.Contains(output, legacy) {
+		t.Errorf("Expected only %s to be processed\nOutput:\n%s", repoPath, output)
+	}
+	if strings.Contains(output, "Found 1 Git repositories") {
+		t.Errorf("Expected no repository list up front when streaming\nOutput:\n%s", output)
+	}
+}
+
+func TestParseArgsGroupBy(t *testing.T) {
+	defer func() { GroupBy = GroupByRepo }()
+
+	if _, err := parseArgs([]string{"commit_status", ".", "--group-by=author"}); err != nil || GroupBy != GroupByAuthor {
+		t.Errorf("Expected --group-by=author, got %q (%v)", GroupBy, err)
+	}
+	if _, err := parseArgs([]string{"commit_status", "."}); err != nil || GroupBy != GroupByRepo {
+		t.Errorf("Expected grouping by repository by default, got %q (%v)", GroupBy, err)
+	}
+	if _, err := parseArgs([]string{"commit_status", ".", "--group-by", "day"}); err == nil {
+		t.Error("Expected an unknown --group-by value to be rejected")
+	}
+}
+
+func TestParseArgsTrace(t *testing.T) {
+	defer func() { Trace = "" }()
+
+	if args, err := parseArgs([]string{"--trace", "commit_status", "."}); err != nil || Trace != traceToStderr || len(args) != 2 {
+		t.Errorf("Expected --trace alone to trace to stderr, got %q and %v (%v)", Trace, args, err)
+	}
+	if _, err := parseArgs([]string{"commit_status", ".", "--trace=git.log"}); err != nil || Trace != "git.log" {
+		t.Errorf("Expected --trace=git.log to trace to the file, got %q (%v)", Trace, err)
+	}
+	if _, err := parseArgs([]string{"commit_status", "."}); err != nil || Trace != "" {
+		t.Errorf("Expected no tracing by default, got %q (%v)", Trace, err)
+	}
+}
+
+func TestAuthorGroups(t *testing.T) {
+	groups := authorGroups{}
+	groups.add("api", []git.Commit{
+		{Hash: "a2", Author: "Jane", Email: "jane@example.com"},
+		{Hash: "a1", Author: "John", Email: "john@example.com"},
+	})
+	groups.add("web", []git.Commit{
+		{Hash: "w2", Author: "Jane Doe", Email: "Jane@Example.com"},
+		{Hash: "w1", Author: "Jane", Email: "jane@example.com"},
+	})
+
+	sorted := groups.sorted()
+	if len(sorted) != 2 {
+		t.Fatalf("Expected 2 authors, got %d", len(sorted))
+	}
+	jane, john := sorted[0], sorted[1]
+	if jane.Author.Name != "Jane" || jane.Count() != 3 || !slices.Equal(jane.Repos, []string{"api", "web"}) {
+		t.Errorf("Expected Jane first with 3 commits in api and web, got %s with %d in %v", jane.Author, jane.Count(), jane.Repos)
+	}
+	if len(jane.Commits["web"]) != 2 || jane.Commits["web"][0].Hash != "w2" {
+		t.Errorf("Expected both web commits of Jane newest first, got %v", jane.Commits["web"])
+	}
+	if john.Author.Email != "john@example.com" || john.Count() != 1 {
+		t.Errorf("Expected John with 1 commit, got %s with %d", john.Author, john.Count())
+	}
+}
+
+func TestTrackingSummary(t *testing.T) {
+	tests := []struct {
+		status   git.TrackingStatus
+		expected string
+	}{
+		{git.TrackingStatus{}, "detached HEAD"},
+		{git.TrackingStatus{Branch: "feature"}, "feature: no upstream"},
+		{git.TrackingStatus{Branch: "main", Upstream: "origin/main", Ahead: 2, Behind: 1}, "main → origin/main: 2 ahead, 1 behind"},
+	}
+	for _, tt := range tests {
+		if got := trackingSummary(tt.status); got != tt.expected {
+			t.Errorf("trackingSummary(%+v) = %q, want %q", tt.status, got, tt.expected)
+		}
+	}
+}
+
+func TestWorkingTreeSummary(t *testing.T) {
+	tests := []struct {
+		status   git.WorkingTreeStatus
+		expected string
+	}{
+		{git.WorkingTreeStatus{}, "clean"},
+		{git.WorkingTreeStatus{Staged: 2, Untracked: 1}, "2 staged, 1 untracked"},
+		{git.WorkingTreeStatus{Modified: 3, Stashes: 1}, "3 modified, 1 stash"},
+	}
+	for _, tt := range tests {
+		if got := workingTreeSummary(tt.status); got != tt.expected {
+			t.Errorf("workingTreeSummary(%+v) = %q, want %q", tt.status, got, tt.expected)
+		}
+	}
+}
+
+func TestCadenceSummaryNotification(t *testing.T) {
+	summary := cadenceSummary{Results: []repoResult{
+		{Repo: "/a", Outcome: outcomeUpdated, Commits: 3},
+		{Repo: "/b", Outcome: outcomeUpdated, Commits: 2},
+		{Repo: "/c", Outcome: outcomeUnchanged},
+	}}
+	title, message := summary.notification()
+	if title != "Code Cadence: run finished" || message != "Updated 5 commits across 2 repositories" {
+		t.Errorf("Unexpected notification %q: %q", title, message)
+	}
+
+	summary.Results = append(summary.Results,
+		repoResult{Repo: "/d", Outcome: outcomeFailed, Err: errors.New("boom")},
+		repoResult{Repo: "/e", Outcome: outcomeTimedOut},
+		repoResult{Repo: "/f", Outcome: outcomeTimedOut},
+	)
+	title, message = summary.notification()
+	if title != "Code Cadence: run finished with problems" || message != "Updated 5 commits across 2 repositories, 1 failed, 2 timed out" {
+		t.Errorf("Unexpected notification %q: %q", title, message)
+	}
+}
+
+func TestWriteSummaryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", "summary.json")
+	summary := cadenceSummary{
+		StartedAt: time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+		Duration:  1500 * time.Millisecond,
+		Results: []repoResult{
+			{Repo: "/work/a", Outcome: outcomeUpdated, Commits: 3, Duration: time.Second},
+			{Repo: "/work/b", Outcome: outcomeFailed, Err: errors.New("conflict")},
+		},
+	}
+	if err := writeSummaryFile(path, CmdCommitCadence, summary); err != nil {
+		t.Fatalf("writeSummaryFile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read summary: %v", err)
+	}
+	var doc summaryFile
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Summary is not valid JSON: %v\n%s", err, data)
+	}
+	if doc.Command != CmdCommitCadence || doc.DurationMs != 1500 || doc.CommitsUpdated != 3 || doc.ReposUpdated != 1 || doc.ReposFailed != 1 {
+		t.Errorf("Unexpected totals: %+v", doc)
+	}
+	if len(doc.Repositories) != 2 || doc.Repositories[0].DurationMs != 1000 || doc.Repositories[1].Error != "conflict" {
+		t.Errorf("Unexpected repositories: %+v", doc.Repositories)
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Cleanup()
+
+	config := DefaultTestConfig()
+	b := config.Batch()
+
+	repoPath := helper.CreateGitRepo("test-repo")
+	helper.CreateTestCommits(repoPath, 2, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	clean := helper.CreateGitRepo("clean-repo")
+
+	b.SummaryFile = filepath.Join(helper.TempDir, "summary.json")
+	summary := cadenceSummary{StartedAt: time.Now(), Results: []repoResult{
+		{Repo: repoPath, Outcome: outcomeFailed, Err: errors.New("conflict")},
+	}}
+	if err := writeSummaryFile(b.SummaryFile, CmdCommitCadenceSpan, summary); err != nil {
+		t.Fatalf("writeSummaryFile failed: %v", err)
+	}
+
+	subject, body := b.buildReport(context.Background(), helper.TempDir, slices.Values([]string{repoPath, clean}), time.Now())
+	if subject != "Code Cadence: 2 unpushed commits in 1 repositories" {
+		t.Errorf("Unexpected subject %q", subject)
+	}
+	for _, expected := range []string{
+		"Unpushed commits: 2 in 1 of 2 repositories",
+		repoPath + " (2 unpushed commits",
+		"Test commit 1",
+		"Last cadence run: commit_cadence_span at",
+		repoPath + ": failed: conflict",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected the report to contain %q\nReport:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, clean) {
+		t.Errorf("Expected repositories without unpushed commits to be left out\nReport:\n%s", body)
+	}
+}
@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	title, message := `Code "Cadence"`, `Moved 3 commits, it's done \o/`
+
+	name, args := command("linux", title, message)
+	if name != "notify-send" || args[len(args)-2] != title || args[len(args)-1] != message {
+		t.Errorf("Unexpected Linux command %s %q", name, args)
+	}
+
+	name, args = command("darwin", title, message)
+	expected := `display notification "Moved 3 commits, it's done \\o/" with title "Code \"Cadence\""`
+	if name != "osascript" || args[len(args)-1] != expected {
+		t.Errorf("Unexpected macOS command %s %q, want script %q", name, args, expected)
+	}
+
+	name, args = command("windows", title, message)
+	script := args[len(args)-1]
+	if name != "powershell" || !strings.Contains(script, `CreateTextNode('Code "Cadence"')`) ||
+		!strings.Contains(script, `CreateTextNode('Moved 3 commits, it''s done \o/')`) {
+		t.Errorf("Unexpected Windows command %s %q", name, args)
+	}
+}
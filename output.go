@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"os"
+)
+
+// repoOutput holds back what a backup job prints while it runs ahead of the rewrite, so runCadence can print it
+// with the rest of the job's repository instead of in the middle of the repository being rewritten. The zero value
+// is ready to use.
+type repoOutput struct {
+	buf bytes.Buffer
+}
+
+// Write collects p, so a repoOutput can be passed as an io.Writer
+func (o *repoOutput) Write(p []byte) (int, error) {
+	return o.buf.Write(p)
+}
+
+// Flush prints the collected output to stdout and empties the collector
+func (o *repoOutput) Flush() {
+	if o.buf.Len() == 0 {
+		return
+	}
+	os.Stdout.Write(o.buf.Bytes())
+	o.buf.Reset()
+}
+
+// scanOutput is where the STREAM_SCAN stages print what they find on the way to the command, such as fetch warnings
+// and repositories skipped as unchanged. It prints to stdout unless held is set, which backupAhead does while it
+// walks the repositories ahead of the rewrite so the lines come out with the next repository instead.
+type scanOutput struct {
+	held *repoOutput
+}
+
+// Write prints p, or collects it while the output is held
+func (o *scanOutput) Write(p []byte) (int, error) {
+	if o.held != nil {
+		return o.held.Write(p)
+	}
+	return os.Stdout.Write(p)
+}
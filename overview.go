@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/backup"
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/push"
+)
+
+// CmdSummary prints a one-screen overview of the workspace
+const CmdSummary = "summary"
+
+// workspaceOverview is what summary reports about the repositories of a workspace
+type workspaceOverview struct {
+	Repos             int
+	ReposWithUnpushed int
+	Unpushed          int
+	// Oldest is the time of the oldest unpushed commit across all repositories and OldestRepo its repository
+	Oldest           time.Time
+	OldestRepo       string
+	PushDisabled     int
+	Dirty            int
+	ReposWithBackups int
+	Backups          int
+	// Errors counts the repositories some of the checks failed for
+	Errors int
+}
+
+// showSummary prints the overview of the repositories under rootDir
+func (b *batch) showSummary(ctx context.Context, rootDir string, gitRepos iter.Seq[string]) {
+	overview := b.collectOverview(ctx, gitRepos)
+	fmt.Print(overview.format(rootDir, time.Now()))
+}
+
+// collectOverview checks every repository, leaving out backup folders. Failed checks are counted, not reported, to
+// keep the overview on one screen.
+func (s *settings) collectOverview(ctx context.Context, gitRepos iter.Seq[string]) workspaceOverview {
+	var o workspaceOverview
+	backupDir := expandHome(s.BackupDir)
+	for repo := range gitRepos {
+		if ctx.Err() != nil {
+			break
+		}
+		if backup.IsBackupFolder(repo) {
+			continue
+		}
+		o.Repos++
+		failed := false
+
+		if commits, err := git.GetUnpushedCommits(ctx, repo, s.parentBranch(ctx, repo)); err != nil {
+			failed = true
+		} else if len(commits) > 0 {
+			o.ReposWithUnpushed++
+			o.Unpushed += len(commits)
+			for _, commit := range commits {
+				if t, err := commit.Time(); err == nil && (o.Oldest.IsZero() || t.Before(o.Oldest)) {
+					o.Oldest, o.OldestRepo = t, repo
+				}
+			}
+		}
+
+		if status, err := push.GetStatus(ctx, repo); err != nil {
+			failed = true
+		} else if status.State == push.StateDisabled || status.State == push.StateOutdated {
+			o.PushDisabled++
+		}
+
+		if worktree, err := git.GetWorkingTreeStatus(ctx, repo); err != nil {
+			failed = true
+		} else if worktree.Dirty() {
+			o.Dirty++
+		}
+
+		if backups, err := backup.List(repo, backupDir); err != nil {
+			failed = true
+		} else if len(backups) > 0 {
+			o.ReposWithBackups++
+			o.Backups += len(backups)
+		}
+
+		if failed {
+			o.Errors++
+		}
+	}
+	return o
+}
+
+// format returns the overview as aligned lines
+func (o workspaceOverview) format(rootDir string, now time.Time) string {
+	oldest := "none"
+	if o.OldestRepo != "" {
+		oldest = fmt.Sprintf("%s ago (%s)", formatAge(now.Sub(o.Oldest)), o.OldestRepo)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n📊 %s\n", rootDir)
+	fmt.Fprintf(&b, "   Repositories:            %d\n", o.Repos)
+	fmt.Fprintf(&b, "   With unpushed commits:   %d (%d commits)\n", o.ReposWithUnpushed, o.Unpushed)
+	fmt.Fprintf(&b, "   Oldest unpushed commit:  %s\n", oldest)
+	fmt.Fprintf(&b, "   Push disabled:           %d of %d\n", o.PushDisabled, o.Repos)
+	fmt.Fprintf(&b, "   Uncommitted changes:     %d\n", o.Dirty)
+	fmt.Fprintf(&b, "   With backups:            %d (%d backups)\n", o.ReposWithBackups, o.Backups)
+	if o.Errors > 0 {
+		fmt.Fprintf(&b, "   ⚠️  %d repositories could not be checked completely, run commit_status or push_status for details\n", o.Errors)
+	}
+	return b.String()
+}
+
+// formatAge formats a duration for people in its largest whole unit, e.g. "3 days" or "1 hour"
+func formatAge(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case d >= 24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d >= time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	default:
+		return plural(max(int(d/time.Minute), 0), "minute")
+	}
+}
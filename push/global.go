@@ -0,0 +1,112 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// templateDirKey is the git setting naming the template directory new repositories are created from
+const templateDirKey = "init.templateDir"
+
+// DefaultTemplateDir is the template directory DisableGlobal sets up when init.templateDir isn't configured
+func DefaultTemplateDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the user config directory: %w", err)
+	}
+	return filepath.Join(dir, "code-cadence", "git-template"), nil
+}
+
+// DisableGlobal installs the blocking pre-push hook into git's template directory, so repositories created or cloned
+// from then on start with push disabled. Existing repositories are not affected. When init.templateDir isn't set it is
+// pointed at DefaultTemplateDir; a configured template directory is used as it is. It returns the template directory.
+func DisableGlobal(ctx context.Context) (string, error) {
+	templateDir, err := globalTemplateDir(ctx)
+	if err != nil {
+		return "", err
+	}
+	if templateDir == "" {
+		if templateDir, err = DefaultTemplateDir(); err != nil {
+			return "", err
+		}
+		if err := git.SetGlobalConfigValue(ctx, templateDirKey, templateDir); err != nil {
+			return "", err
+		}
+	}
+
+	hooksDir := filepath.Join(templateDir, "hooks")
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create template hooks directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(hooksDir, "pre-push"), []byte(HookContent), 0755); err != nil {
+		return "", fmt.Errorf("failed to write template pre-push hook: %w", err)
+	}
+	return templateDir, nil
+}
+
+// EnableGlobal removes the blocking pre-push hook from git's template directory, and unsets init.templateDir again
+// when it points at DefaultTemplateDir. A pre-push hook this tool didn't install is left alone. Repositories that
+// were created with the hook keep it until push_enable is run on them.
+func EnableGlobal(ctx context.Context) error {
+	templateDir, err := globalTemplateDir(ctx)
+	if err != nil || templateDir == "" {
+		return err
+	}
+
+	status, err := GetGlobalStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if status.State == StateDisabled || status.State == StateOutdated {
+		if err := os.Remove(filepath.Join(templateDir, "hooks", "pre-push")); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove template pre-push hook: %w", err)
+		}
+	}
+
+	defaultDir, err := DefaultTemplateDir()
+	if err != nil {
+		return err
+	}
+	if filepath.Clean(templateDir) == filepath.Clean(defaultDir) {
+		return git.UnsetGlobalConfigValue(ctx, templateDirKey)
+	}
+	return nil
+}
+
+// GetGlobalStatus inspects the pre-push hook of git's template directory. Without a template directory, new
+// repositories get no hook and the state is StateEnabled.
+func GetGlobalStatus(ctx context.Context) (Status, error) {
+	templateDir, err := globalTemplateDir(ctx)
+	if err != nil || templateDir == "" {
+		return Status{State: StateEnabled}, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(templateDir, "hooks", "pre-push"))
+	if os.IsNotExist(err) {
+		return Status{State: StateEnabled}, nil
+	} else if err != nil {
+		return Status{}, fmt.Errorf("failed to read template pre-push hook: %w", err)
+	}
+	return parseHook(string(content)), nil
+}
+
+// globalTemplateDir returns the configured init.templateDir with a leading ~ expanded, or "" when it isn't set
+func globalTemplateDir(ctx context.Context) (string, error) {
+	dir, err := git.GetGlobalConfigValue(ctx, templateDirKey)
+	if err != nil || dir == "" {
+		return "", err
+	}
+	if rest, found := strings.CutPrefix(dir, "~/"); found {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to expand %s: %w", dir, err)
+		}
+		dir = filepath.Join(home, rest)
+	}
+	return dir, nil
+}
@@ -0,0 +1,89 @@
+package push
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// isolateGlobalConfig points git's global configuration and the user config directory at a temporary directory
+func isolateGlobalConfig(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	return home
+}
+
+func TestDisableEnableGlobal(t *testing.T) {
+	ctx := context.Background()
+	isolateGlobalConfig(t)
+
+	if status, err := GetGlobalStatus(ctx); err != nil || status.State != StateEnabled {
+		t.Fatalf("Expected push to be enabled without a template directory, got %+v (%v)", status, err)
+	}
+
+	templateDir, err := DisableGlobal(ctx)
+	if err != nil {
+		t.Fatalf("DisableGlobal failed: %v", err)
+	}
+	if status, err := GetGlobalStatus(ctx); err != nil || status.State != StateDisabled {
+		t.Fatalf("Expected push to be disabled globally, got %+v (%v)", status, err)
+	}
+
+	// New repositories start with the blocking hook
+	repo := t.TempDir()
+	gitInit(t, repo)
+	if disabled, err := IsDisabled(ctx, repo); err != nil || !disabled {
+		t.Errorf("Expected a new repository to have push disabled, got %v (%v)", disabled, err)
+	}
+
+	if err := EnableGlobal(ctx); err != nil {
+		t.Fatalf("EnableGlobal failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(templateDir, "hooks", "pre-push")); !os.IsNotExist(err) {
+		t.Errorf("Expected the template hook to be removed: %v", err)
+	}
+	if output, err := exec.Command("git", "config", "--global", "--get", "init.templateDir").Output(); err == nil {
+		t.Errorf("Expected init.templateDir to be unset, got %q", output)
+	}
+}
+
+func TestDisableGlobalExistingTemplateDir(t *testing.T) {
+	ctx := context.Background()
+	home := isolateGlobalConfig(t)
+
+	// A template directory the user set up is used as it is and kept on enable, along with its other hooks
+	if output, err := exec.Command("git", "config", "--global", "init.templateDir", "~/templates").CombinedOutput(); err != nil {
+		t.Fatalf("git config failed: %v\nOutput: %s", err, output)
+	}
+	hooksDir := filepath.Join(home, "templates", "hooks")
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hooksDir, "commit-msg"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	templateDir, err := DisableGlobal(ctx)
+	if err != nil || templateDir != filepath.Join(home, "templates") {
+		t.Fatalf("Expected the configured template directory, got %q (%v)", templateDir, err)
+	}
+	if err := EnableGlobal(ctx); err != nil {
+		t.Fatalf("EnableGlobal failed: %v", err)
+	}
+
+	output, err := exec.Command("git", "config", "--global", "--get", "init.templateDir").Output()
+	if err != nil || string(output) != "~/templates\n" {
+		t.Errorf("Expected init.templateDir to be kept, got %q (%v)", output, err)
+	}
+	if _, err := os.Stat(filepath.Join(hooksDir, "commit-msg")); err != nil {
+		t.Errorf("Expected the other hooks to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(hooksDir, "pre-push")); !os.IsNotExist(err) {
+		t.Errorf("Expected the template pre-push hook to be removed: %v", err)
+	}
+}
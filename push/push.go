@@ -0,0 +1,179 @@
+// Package push blocks and unblocks git push for a repository using a pre-push hook, or by replacing the push URLs
+// of its remotes.
+package push
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// HookVersion is the version HookContent records, bumped along with it whenever it changes
+const HookVersion = 2
+
+// HookContent is the pre-push hook installed to block pushes
+const HookContent = `#!/bin/sh
+# code-cadence pre-push hook version 2
+echo "Error: git push is disabled for this repository"
+echo "This repository has been configured to prevent pushing changes"
+exit 1
+`
+
+// hookMarker identifies a pre-push hook installed by this tool
+const hookMarker = "git push is disabled for this repository"
+
+// hookVersionMarker precedes the version of a hook installed by this tool. Hooks from before it was added have none.
+const hookVersionMarker = "# code-cadence pre-push hook version "
+
+// hookPreviewLines is how many lines of a foreign pre-push hook Status shows
+const hookPreviewLines = 3
+
+// State is whether a repository's pre-push hook lets pushes through
+type State int
+
+const (
+	// StateEnabled means there is no pre-push hook
+	StateEnabled State = iota
+	// StateDisabled means the blocking hook of this version is installed
+	StateDisabled
+	// StateOutdated means a blocking hook from an older version of this tool is installed. It still blocks pushes.
+	StateOutdated
+	// StateForeign means a pre-push hook this tool didn't install is in place, which may block pushes on its own
+	StateForeign
+)
+
+// Status describes the pre-push hook of a repository
+type Status struct {
+	State State
+	// Version is the version of an outdated hook, 1 for hooks from before versions were recorded
+	Version int
+	// Preview holds the first lines of a foreign hook
+	Preview []string
+	// PushURL is set when pushes are blocked through the push URLs of the remotes rather than a hook
+	PushURL bool
+}
+
+// Disable installs the blocking pre-push hook into the repository
+func Disable(ctx context.Context, repoPath string) error {
+	prePushHookPath, err := hookPath(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+	hooksDir := filepath.Dir(prePushHookPath)
+
+	// Create hooks directory if it doesn't exist
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+
+	// Write the pre-push hook
+	if err := os.WriteFile(prePushHookPath, []byte(HookContent), 0755); err != nil {
+		return fmt.Errorf("failed to write pre-push hook: %w", err)
+	}
+
+	return nil
+}
+
+// Enable removes the pre-push hook from the repository and restores the push URLs DisablePushURL replaced
+func Enable(ctx context.Context, repoPath string) error {
+	if err := enablePushURL(ctx, repoPath); err != nil {
+		return err
+	}
+
+	prePushHookPath, err := hookPath(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+
+	// Remove the pre-push hook if it exists
+	if err := os.Remove(prePushHookPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove pre-push hook: %w", err)
+	}
+
+	return nil
+}
+
+// Upgrade rewrites a blocking hook installed by an older version of this tool with the current one. Other hooks are
+// left alone. It reports whether the hook was rewritten.
+func Upgrade(ctx context.Context, repoPath string) (bool, error) {
+	status, err := GetStatus(ctx, repoPath)
+	if err != nil || status.State != StateOutdated {
+		return false, err
+	}
+	if err := Disable(ctx, repoPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// IsDisabled reports whether the repository has the blocking pre-push hook installed, of any version
+func IsDisabled(ctx context.Context, repoPath string) (bool, error) {
+	status, err := GetStatus(ctx, repoPath)
+	if err != nil {
+		return false, err
+	}
+	return status.State == StateDisabled || status.State == StateOutdated, nil
+}
+
+// GetStatus inspects the push URLs and the pre-push hook of the repository
+func GetStatus(ctx context.Context, repoPath string) (Status, error) {
+	if blocked, err := isPushURLDisabled(ctx, repoPath); err != nil {
+		return Status{}, err
+	} else if blocked {
+		return Status{State: StateDisabled, PushURL: true}, nil
+	}
+
+	prePushHookPath, err := hookPath(ctx, repoPath)
+	if err != nil {
+		return Status{}, err
+	}
+
+	content, err := os.ReadFile(prePushHookPath)
+	if os.IsNotExist(err) {
+		return Status{State: StateEnabled}, nil
+	} else if err != nil {
+		return Status{}, fmt.Errorf("failed to read pre-push hook: %w", err)
+	}
+	return parseHook(string(content)), nil
+}
+
+// parseHook tells a blocking hook of this tool, and its version, from a hook installed by something else
+func parseHook(content string) Status {
+	if !strings.Contains(content, hookMarker) {
+		status := Status{State: StateForeign}
+		for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+			if len(status.Preview) == hookPreviewLines {
+				break
+			}
+			status.Preview = append(status.Preview, strings.TrimRight(line, "\r"))
+		}
+		return status
+	}
+
+	version := 1
+	for _, line := range strings.Split(content, "\n") {
+		if value, found := strings.CutPrefix(line, hookVersionMarker); found {
+			if v, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+				version = v
+			}
+		}
+	}
+	if version < HookVersion {
+		return Status{State: StateOutdated, Version: version}
+	}
+	return Status{State: StateDisabled, Version: version}
+}
+
+// hookPath returns the location of the pre-push hook inside the repository's git directory
+func hookPath(ctx context.Context, repoPath string) (string, error) {
+	gitDir, err := git.GetGitDir(ctx, repoPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, "hooks", "pre-push"), nil
+}
@@ -0,0 +1,195 @@
+package push
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitInit initializes a repository in dir with any extra git init arguments
+func gitInit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"init", "--quiet"}, args...)...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\nOutput: %s", err, output)
+	}
+}
+
+func TestDisableEnable(t *testing.T) {
+	ctx := context.Background()
+
+	// Create a temporary repository
+	tempDir := t.TempDir()
+	gitInit(t, tempDir)
+	gitDir := filepath.Join(tempDir, ".git", "hooks")
+
+	// Test disabling push
+	err := Disable(ctx, tempDir)
+	if err != nil {
+		t.Fatalf("Error disabling git push: %v", err)
+	}
+
+	// Verify hook was created
+	hookPath := filepath.Join(gitDir, "pre-push")
+	if _, err := os.Stat(hookPath); os.IsNotExist(err) {
+		t.Error("Pre-push hook was not created")
+	}
+
+	// Verify hook content
+	content, err := os.ReadFile(hookPath)
+	if err != nil {
+		t.Fatalf("Error reading hook content: %v", err)
+	}
+
+	if !strings.Contains(string(content), "git push is disabled for this repository") {
+		t.Error("Hook content does not contain expected disable message")
+	}
+
+	// Test checking if push is disabled
+	isDisabled, err := IsDisabled(ctx, tempDir)
+	if err != nil {
+		t.Fatalf("Error checking push status: %v", err)
+	}
+	if !isDisabled {
+		t.Error("Expected push to be disabled")
+	}
+
+	// Test enabling push
+	err = Enable(ctx, tempDir)
+	if err != nil {
+		t.Fatalf("Error enabling git push: %v", err)
+	}
+
+	// Verify hook was removed
+	if _, err := os.Stat(hookPath); !os.IsNotExist(err) {
+		t.Error("Pre-push hook was not removed")
+	}
+
+	// Test checking if push is enabled
+	isDisabled, err = IsDisabled(ctx, tempDir)
+	if err != nil {
+		t.Fatalf("Error checking push status: %v", err)
+	}
+	if isDisabled {
+		t.Error("Expected push to be enabled")
+	}
+}
+
+func TestDisableSeparateGitDir(t *testing.T) {
+	ctx := context.Background()
+
+	workTree := t.TempDir()
+	separateGitDir := filepath.Join(t.TempDir(), "repo.git")
+	gitInit(t, workTree, "--separate-git-dir", separateGitDir)
+
+	if err := Disable(ctx, workTree); err != nil {
+		t.Fatalf("Error disabling git push: %v", err)
+	}
+
+	// The hook must be installed where git looks for it, not under the .git file
+	if _, err := os.Stat(filepath.Join(separateGitDir, "hooks", "pre-push")); err != nil {
+		t.Errorf("Expected pre-push hook in separate git dir: %v", err)
+	}
+
+	isDisabled, err := IsDisabled(ctx, workTree)
+	if err != nil {
+		t.Fatalf("Error checking push status: %v", err)
+	}
+	if !isDisabled {
+		t.Error("Expected push to be disabled")
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	ctx := context.Background()
+
+	outdated := t.TempDir()
+	gitInit(t, outdated)
+	oldHook := "#!/bin/sh\necho \"Error: git push is disabled for this repository\"\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(outdated, ".git", "hooks", "pre-push"), []byte(oldHook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	foreign := t.TempDir()
+	gitInit(t, foreign)
+	foreignHook := "#!/bin/sh\nnpm test\n"
+	if err := os.WriteFile(filepath.Join(foreign, ".git", "hooks", "pre-push"), []byte(foreignHook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	enabled := t.TempDir()
+	gitInit(t, enabled)
+
+	if upgraded, err := Upgrade(ctx, outdated); err != nil || !upgraded {
+		t.Fatalf("Expected the outdated hook to be upgraded, got %v (%v)", upgraded, err)
+	}
+	if status, err := GetStatus(ctx, outdated); err != nil || status.State != StateDisabled {
+		t.Errorf("Expected the current hook after upgrading, got %+v (%v)", status, err)
+	}
+
+	for _, repo := range []string{outdated, foreign, enabled} {
+		if upgraded, err := Upgrade(ctx, repo); err != nil || upgraded {
+			t.Errorf("Expected %s to be left alone, got %v (%v)", repo, upgraded, err)
+		}
+	}
+	if content, err := os.ReadFile(filepath.Join(foreign, ".git", "hooks", "pre-push")); err != nil || string(content) != foreignHook {
+		t.Errorf("Expected the foreign hook to be untouched, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(enabled, ".git", "hooks", "pre-push")); !os.IsNotExist(err) {
+		t.Errorf("Expected no hook to be installed where push is enabled: %v", err)
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	gitInit(t, tempDir)
+	hookPath := filepath.Join(tempDir, ".git", "hooks", "pre-push")
+
+	tests := []struct {
+		name     string
+		hook     string
+		expected Status
+	}{
+		{"no hook", "", Status{State: StateEnabled}},
+		{"current hook", HookContent, Status{State: StateDisabled, Version: HookVersion}},
+		{
+			"hook without a version",
+			"#!/bin/sh\necho \"Error: git push is disabled for this repository\"\nexit 1\n",
+			Status{State: StateOutdated, Version: 1},
+		},
+		{
+			"foreign hook",
+			"#!/bin/sh\n# lint before pushing\nnpm run lint\nnpm test\n",
+			Status{State: StateForeign, Preview: []string{"#!/bin/sh", "# lint before pushing", "npm run lint"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Remove(hookPath); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if tt.hook != "" {
+				if err := os.WriteFile(hookPath, []byte(tt.hook), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			status, err := GetStatus(ctx, tempDir)
+			if err != nil {
+				t.Fatalf("GetStatus failed: %v", err)
+			}
+			if status.State != tt.expected.State || status.Version != tt.expected.Version ||
+				strings.Join(status.Preview, "\n") != strings.Join(tt.expected.Preview, "\n") {
+				t.Errorf("Expected %+v, got %+v", tt.expected, status)
+			}
+
+			disabled, err := IsDisabled(ctx, tempDir)
+			if err != nil || disabled != (tt.expected.State == StateDisabled || tt.expected.State == StateOutdated) {
+				t.Errorf("Unexpected IsDisabled result %v (%v)", disabled, err)
+			}
+		})
+	}
+}
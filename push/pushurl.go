@@ -0,0 +1,118 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// PushURLSentinel replaces the push URL of every remote while push is disabled through push URLs. git has no remote
+// helper for it, so every push fails with "unable to find remote helper for 'code-cadence-push-disabled'", even with
+// --no-verify.
+const PushURLSentinel = "code-cadence-push-disabled::push is disabled for this repository"
+
+// ErrNoRemotes is returned when pushes are to be blocked through push URLs in a repository without remotes
+var ErrNoRemotes = errors.New("repository has no remotes to block")
+
+// DisablePushURL blocks pushes by pointing the push URL of every remote at PushURLSentinel. The push URLs configured
+// before are recorded in the repository's configuration, under code-cadence.<remote>, for Enable to restore. Remotes
+// added afterwards are not blocked.
+func DisablePushURL(ctx context.Context, repoPath string) error {
+	remotes, err := git.GetRemotes(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+	if len(remotes) == 0 {
+		return ErrNoRemotes
+	}
+
+	for _, remote := range remotes {
+		pushURLs, err := git.GetConfigValues(ctx, repoPath, pushURLKey(remote))
+		if err != nil {
+			return err
+		}
+		// Disabling twice must not record the sentinel as the original
+		if isBlocked(pushURLs) {
+			continue
+		}
+
+		// The original push URLs are saved before they are replaced, so a failure in between can't lose them
+		if err := git.SetConfigValues(ctx, repoPath, savedPushURLKey(remote), pushURLs); err != nil {
+			return err
+		}
+		if err := git.SetConfigValues(ctx, repoPath, blockedKey(remote), []string{"true"}); err != nil {
+			return err
+		}
+		if err := git.SetConfigValues(ctx, repoPath, pushURLKey(remote), []string{PushURLSentinel}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enablePushURL restores the push URLs DisablePushURL replaced. Remotes it didn't block are left alone.
+func enablePushURL(ctx context.Context, repoPath string) error {
+	remotes, err := git.GetRemotes(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+
+	for _, remote := range remotes {
+		blocked, err := git.GetConfigValue(ctx, repoPath, blockedKey(remote))
+		if err != nil {
+			return err
+		}
+		if blocked != "true" {
+			continue
+		}
+
+		saved, err := git.GetConfigValues(ctx, repoPath, savedPushURLKey(remote))
+		if err != nil {
+			return err
+		}
+		if err := git.SetConfigValues(ctx, repoPath, pushURLKey(remote), saved); err != nil {
+			return err
+		}
+		if err := git.SetConfigValues(ctx, repoPath, savedPushURLKey(remote), nil); err != nil {
+			return err
+		}
+		if err := git.SetConfigValues(ctx, repoPath, blockedKey(remote), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isPushURLDisabled reports whether the repository has remotes and all their push URLs are blocked
+func isPushURLDisabled(ctx context.Context, repoPath string) (bool, error) {
+	remotes, err := git.GetRemotes(ctx, repoPath)
+	if err != nil || len(remotes) == 0 {
+		return false, err
+	}
+	for _, remote := range remotes {
+		pushURLs, err := git.GetConfigValues(ctx, repoPath, pushURLKey(remote))
+		if err != nil || !isBlocked(pushURLs) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// isBlocked reports whether pushURLs are the ones DisablePushURL sets
+func isBlocked(pushURLs []string) bool {
+	return slices.Equal(pushURLs, []string{PushURLSentinel})
+}
+
+func pushURLKey(remote string) string {
+	return "remote." + remote + ".pushurl"
+}
+
+func savedPushURLKey(remote string) string {
+	return "code-cadence." + remote + ".pushurl"
+}
+
+func blockedKey(remote string) string {
+	return "code-cadence." + remote + ".blocked"
+}
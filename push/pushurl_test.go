@@ -0,0 +1,74 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitConfig runs git config in repo and returns its trimmed output, failing the test unless the exit status is 0 or 1
+func gitConfig(t *testing.T, repo string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"config"}, args...)...)
+	cmd.Dir = repo
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		t.Fatalf("git config %v failed: %v", args, err)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestDisablePushURL(t *testing.T) {
+	ctx := context.Background()
+	repo := t.TempDir()
+	gitInit(t, repo)
+
+	if err := DisablePushURL(ctx, repo); !errors.Is(err, ErrNoRemotes) {
+		t.Fatalf("Expected ErrNoRemotes without remotes, got %v", err)
+	}
+
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	gitInit(t, filepath.Dir(remote), "--bare", remote)
+	gitConfig(t, repo, "remote.origin.url", remote)
+	gitConfig(t, repo, "remote.mirror.url", remote)
+	gitConfig(t, repo, "--add", "remote.mirror.pushurl", "https://example.com/a.git")
+	gitConfig(t, repo, "--add", "remote.mirror.pushurl", "https://example.com/b.git")
+
+	// Disabling twice must still restore the original push URLs
+	for i := 0; i < 2; i++ {
+		if err := DisablePushURL(ctx, repo); err != nil {
+			t.Fatalf("DisablePushURL failed: %v", err)
+		}
+	}
+	status, err := GetStatus(ctx, repo)
+	if err != nil || status.State != StateDisabled || !status.PushURL {
+		t.Fatalf("Expected push to be disabled through push URLs, got %+v (%v)", status, err)
+	}
+
+	// Skipping the hooks doesn't get around it
+	cmd := exec.Command("git", "push", "--no-verify", "origin", "HEAD")
+	cmd.Dir = repo
+	if output, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(output), "code-cadence-push-disabled") {
+		t.Errorf("Expected the push to fail on the sentinel, got %v\nOutput: %s", err, output)
+	}
+
+	if err := Enable(ctx, repo); err != nil {
+		t.Fatalf("Enable failed: %v", err)
+	}
+	if pushURLs := gitConfig(t, repo, "--get-all", "remote.origin.pushurl"); pushURLs != "" {
+		t.Errorf("Expected origin to have no push URL again, got %q", pushURLs)
+	}
+	if pushURLs := gitConfig(t, repo, "--get-all", "remote.mirror.pushurl"); pushURLs != "https://example.com/a.git\nhttps://example.com/b.git" {
+		t.Errorf("Expected the push URLs of mirror to be restored, got %q", pushURLs)
+	}
+	if saved := gitConfig(t, repo, "--get-regexp", `^code-cadence\.`); saved != "" {
+		t.Errorf("Expected the saved push URLs to be removed, got %q", saved)
+	}
+	if disabled, err := IsDisabled(ctx, repo); err != nil || disabled {
+		t.Errorf("Expected push to be enabled, got %v (%v)", disabled, err)
+	}
+}
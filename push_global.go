@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/egor-markin/code-cadence/push"
+)
+
+// Push global subcommands
+const (
+	PushGlobalCmdDisable = "disable"
+	PushGlobalCmdEnable  = "enable"
+	PushGlobalCmdStatus  = "status"
+)
+
+// Valid push global subcommands
+var validPushGlobalCommands = []string{
+	PushGlobalCmdDisable,
+	PushGlobalCmdEnable,
+	PushGlobalCmdStatus,
+}
+
+// CmdPushGlobal groups the subcommands that manage the pre-push hook of git's template directory; they take no directory
+const CmdPushGlobal = "push_global"
+
+// runPushGlobalCommand runs a push_global subcommand and returns the process exit code
+func runPushGlobalCommand(ctx context.Context, args []string) int {
+	if len(args) != 1 {
+		fmt.Printf("Usage: code-cadence push_global <%s>\n", strings.Join(validPushGlobalCommands, "|"))
+		return 1
+	}
+
+	switch args[0] {
+	case PushGlobalCmdDisable:
+		templateDir, err := push.DisableGlobal(ctx)
+		if err != nil {
+			fmt.Printf("Error: Failed to disable git push globally: %v\n", err)
+			return 1
+		}
+		fmt.Printf("✓ Installed the blocking pre-push hook into the git template directory %s\n", templateDir)
+		fmt.Println("  Repositories created or cloned from now on start with push disabled; run push_disable for existing ones")
+		return 0
+	case PushGlobalCmdEnable:
+		if err := push.EnableGlobal(ctx); err != nil {
+			fmt.Printf("Error: Failed to enable git push globally: %v\n", err)
+			return 1
+		}
+		fmt.Println("✓ Removed the blocking pre-push hook from the git template directory")
+		fmt.Println("  Repositories created with it keep it; run push_enable for them")
+		return 0
+	case PushGlobalCmdStatus:
+		status, err := push.GetGlobalStatus(ctx)
+		if err != nil {
+			fmt.Printf("Error: Could not check the git template directory: %v\n", err)
+			return 1
+		}
+		switch status.State {
+		case push.StateDisabled:
+			fmt.Println("❌ Push DISABLED for new repositories")
+		case push.StateOutdated:
+			fmt.Printf("❌ Push DISABLED for new repositories (hook version %d, current is %d; rerun push_global disable to upgrade)\n", status.Version, push.HookVersion)
+		case push.StateForeign:
+			fmt.Println("🚧 New repositories get a pre-push hook installed by something else:")
+			for _, line := range status.Preview {
+				fmt.Printf("   | %s\n", line)
+			}
+		default:
+			fmt.Println("✅ Push ENABLED for new repositories")
+		}
+		return 0
+	}
+
+	fmt.Printf("Error: Invalid push_global command '%s'. Valid push_global commands are: %s\n", args[0], strings.Join(validPushGlobalCommands, ", "))
+	return 1
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/egor-markin/code-cadence/git"
+	"github.com/egor-markin/code-cadence/mail"
+)
+
+// CmdEmailReport emails a digest of the unpushed commits and the last cadence run to REPORT_EMAIL_TO
+const CmdEmailReport = "email_report"
+
+// emailReport builds the digest for rootDir and sends it through the configured SMTP server
+func (b *batch) emailReport(ctx context.Context, rootDir string, gitRepos iter.Seq[string]) error {
+	recipients := b.reportRecipients()
+	if b.SMTPHost == "" || b.SMTPFrom == "" || len(recipients) == 0 {
+		return errors.New("email_report needs SMTP_HOST, SMTP_FROM and REPORT_EMAIL_TO")
+	}
+
+	subject, body := b.buildReport(ctx, rootDir, gitRepos, time.Now())
+	cfg := mail.Config{Host: b.SMTPHost, Port: b.SMTPPort, Username: b.SMTPUsername, Password: b.SMTPPassword, From: b.SMTPFrom}
+	if err := mail.Send(cfg, recipients, subject, body); err != nil {
+		return err
+	}
+	fmt.Printf("\n📧 Sent the report to %s\n", strings.Join(recipients, ", "))
+	return nil
+}
+
+// buildReport returns the subject and body of the digest: the unpushed commits of every repository and, when
+// SUMMARY_FILE is set, the outcome of the last cadence run
+func (s *settings) buildReport(ctx context.Context, rootDir string, gitRepos iter.Seq[string], now time.Time) (string, string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Code Cadence report for %s, %s\n", rootDir, now.Format("2006-01-02 15:04"))
+
+	repos, reposWithUnpushed, totalUnpushed := 0, 0, 0
+	var sections strings.Builder
+	for repo := range gitRepos {
+		if ctx.Err() != nil {
+			break
+		}
+		repos++
+		commits, err := git.GetUnpushedCommits(ctx, repo, s.parentBranch(ctx, repo))
+		if err != nil {
+			fmt.Fprintf(&sections, "\n%s: could not check commits: %v\n", repo, err)
+			continue
+		}
+		if len(commits) == 0 {
+			continue
+		}
+		reposWithUnpushed++
+		totalUnpushed += len(commits)
+
+		tracking := "tracking unknown"
+		if status, err := git.GetTrackingStatus(ctx, repo); err == nil {
+			tracking = trackingSummary(status)
+		}
+		fmt.Fprintf(&sections, "\n%s (%d unpushed commits, %s)\n", repo, len(commits), tracking)
+		for _, commit := range commits {
+			fmt.Fprintf(&sections, "  - %s %s (%s, %s)\n", commit.Hash, commit.Subject, commit.Author, commit.DateTime)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nUnpushed commits: %d in %d of %d repositories\n", totalUnpushed, reposWithUnpushed, repos)
+	b.WriteString(sections.String())
+
+	if s.SummaryFile != "" {
+		b.WriteString("\n")
+		if last, err := readSummaryFile(expandHome(s.SummaryFile)); err == nil {
+			fmt.Fprintf(&b, "Last cadence run: %s at %s, updated %d commits across %d repositories",
+				last.Command, last.StartedAt.Local().Format("2006-01-02 15:04"), last.CommitsUpdated, last.ReposUpdated)
+			if last.ReposFailed > 0 || last.ReposTimedOut > 0 {
+				fmt.Fprintf(&b, ", %d failed, %d timed out", last.ReposFailed, last.ReposTimedOut)
+			}
+			b.WriteString("\n")
+			for _, repo := range last.Repositories {
+				if repo.Error != "" {
+					fmt.Fprintf(&b, "  - %s: %s: %s\n", repo.Path, repo.Outcome, repo.Error)
+				}
+			}
+		} else if errors.Is(err, os.ErrNotExist) {
+			b.WriteString("No cadence run recorded yet\n")
+		} else {
+			fmt.Fprintf(&b, "Could not read the last cadence run: %v\n", err)
+		}
+	}
+
+	subject := fmt.Sprintf("Code Cadence: %d unpushed commits in %d repositories", totalUnpushed, reposWithUnpushed)
+	return subject, b.String()
+}
+
+// readSummaryFile reads the summary writeSummaryFile wrote
+func readSummaryFile(path string) (summaryFile, error) {
+	var doc summaryFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return doc, err
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return doc, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return doc, nil
+}
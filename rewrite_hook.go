@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// postRewriteHook runs POST_REWRITE_HOOK in the repository as the last thing done to it, after the rewrite and
+// everything after it, the notes, the message and sparse-checkout checks and the housekeeping. It is given the commits
+// the rewrite created, the number of commits rewritten and what failed before, in or after the rewrite, and runs
+// unless nothing was rewritten and nothing failed.
+//
+// Like git's own post-rewrite hook, the command gets one "<original hash> <new hash>" line per rewritten commit on
+// stdin, both full hashes, and a failed rewrite, which was rolled back, sends none.
+// CODE_CADENCE_REPO, CODE_CADENCE_BRANCH, CODE_CADENCE_REWRITTEN and CODE_CADENCE_ERROR describe the rewrite. What
+// the command prints goes to out, and a failing command is only a warning, the rewrite is done.
+func (s *settings) postRewriteHook(ctx context.Context, target *cadence.Target, rewritten []cadence.Rewritten, count int, err error, out io.Writer) {
+	if s.PostRewriteHook == "" || (err == nil && count == 0) || ctx.Err() != nil {
+		return
+	}
+
+	var lines strings.Builder
+	errMessage := ""
+	if err != nil {
+		errMessage = err.Error()
+	}
+	if count > 0 && len(rewritten) > 0 {
+		// The commits were listed with abbreviated hashes
+		originals := make([]string, len(rewritten))
+		for i, commit := range rewritten {
+			originals[i] = commit.Original.Hash
+		}
+		if full, err := git.ResolveCommits(ctx, target.RepoPath, originals); err != nil {
+			fmt.Fprintf(out, "   ⚠️  POST_REWRITE_HOOK gets abbreviated original hashes: %v\n", err)
+		} else {
+			originals = full
+		}
+		for i, commit := range rewritten {
+			fmt.Fprintf(&lines, "%s %s\n", originals[i], commit.NewHash)
+		}
+	}
+
+	name, args := shellCommand(runtime.GOOS, s.PostRewriteHook)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = target.RepoPath
+	cmd.Env = append(os.Environ(),
+		"CODE_CADENCE_REPO="+target.RepoPath,
+		"CODE_CADENCE_BRANCH="+target.Branch,
+		"CODE_CADENCE_REWRITTEN="+strconv.Itoa(count),
+		"CODE_CADENCE_ERROR="+errMessage,
+	)
+	cmd.Stdin = strings.NewReader(lines.String())
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(out, "   ⚠️  POST_REWRITE_HOOK failed: %v\n", err)
+	}
+}
+
+// shellCommand returns the program and arguments that run command through the shell of goos
+func shellCommand(goos string, command string) (string, []string) {
+	if goos == "windows" {
+		return "cmd", []string{"/C", command}
+	}
+	return "sh", []string{"-c", command}
+}
@@ -0,0 +1,274 @@
+package scan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheVersion is bumped whenever the cache file format or discovery rules change
+const cacheVersion = 5
+
+// Cache stores discovery results on disk so repeated scans of an unchanged tree skip the recursive walk.
+// An entry is reused only while the modification time of every directory visited by the original walk
+// is unchanged, since adding or removing a repository always changes the mtime of its parent directory.
+type Cache struct {
+	// Dir is the directory holding cache files
+	Dir string
+}
+
+// cacheEntry is the on-disk representation of one cached scan
+type cacheEntry struct {
+	Version  int              `json:"version"`
+	Root     string           `json:"root"`
+	Repos    []string         `json:"repos"` // relative to Root
+	Nested   []NestedRepo     `json:"nested"`
+	Excluded []string         `json:"excluded"`
+	Network  []NetworkPath    `json:"network"` // relative to Root
+	Dirs     map[string]int64 `json:"dirs"`    // relative to Root, mtime in nanoseconds
+}
+
+// DefaultCacheDir returns the per-user cache directory, e.g. ~/.cache/code-cadence
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "code-cadence"), nil
+}
+
+// FindRepositories returns the repositories under rootDir, reusing the cached result when the tree is unchanged.
+// refresh forces a full walk. The second return value reports whether the result came from the cache.
+func (c Cache) FindRepositories(rootDir string, opts Options, refresh bool) ([]string, bool, error) {
+	result, cached, err := c.Discover(rootDir, opts, refresh)
+	return result.Repos, cached, err
+}
+
+// Discover is FindRepositories with details about nested repositories
+func (c Cache) Discover(rootDir string, opts Options, refresh bool) (Result, bool, error) {
+	cachePath, err := c.entryPath(rootDir, opts)
+	if err != nil {
+		result, err := Discover(rootDir, opts)
+		return result, false, err
+	}
+
+	if !refresh {
+		if result, ok := c.load(cachePath, rootDir); ok {
+			opts.reportDiscovered(result.Repos)
+			return result, true, nil
+		}
+	}
+
+	result, visited, err := walk(rootDir, opts)
+	if err != nil {
+		return result, false, err
+	}
+
+	// Failing to write the cache only costs a full walk next time
+	_ = c.store(cachePath, rootDir, result, visited)
+
+	opts.reportDiscovered(result.Repos)
+	return result, false, nil
+}
+
+// Stream is Stream going through the cache. On a cache hit the cached repositories are passed to yield, otherwise
+// the tree is walked and the result stored once the walk completes. The second return value reports whether the
+// cache was used.
+func (c Cache) Stream(rootDir string, opts Options, refresh bool, yield func(repo string) bool) (Result, bool, error) {
+	cachePath, err := c.entryPath(rootDir, opts)
+	if err != nil {
+		result, err := Stream(rootDir, opts, yield)
+		return result, false, err
+	}
+
+	yield = opts.reportingDiscovered(yield)
+
+	if !refresh {
+		if result, ok := c.load(cachePath, rootDir); ok {
+			for _, repo := range result.Repos {
+				if !yield(repo) {
+					break
+				}
+			}
+			result.Repos = nil
+			return result, true, nil
+		}
+	}
+
+	var gitRepos []string
+	var visited []string
+	var result Result
+
+	filter := newStreamFilter(opts.NestedRepos, yield)
+	err = walkRepos(rootDir, opts, walkCallbacks{
+		visit: func(dir string) { visited = append(visited, dir) },
+		found: func(path string, outer string) bool {
+			gitRepos = append(gitRepos, path)
+			if outer != "" {
+				result.Nested = append(result.Nested, NestedRepo{Path: path, Outer: outer})
+			}
+			return filter.found(path, outer)
+		},
+		network: func(network NetworkPath) { result.Network = append(result.Network, network) },
+	})
+	if err != nil {
+		return result, false, err
+	}
+	// A walk cut short by yield has not seen the whole tree, so it can't be cached
+	complete := !filter.stopped
+	filter.flush("")
+
+	if complete {
+		stored := result
+		stored.Repos, stored.Excluded = applyNestedPolicy(Dedupe(gitRepos), result.Nested, opts.NestedRepos)
+		// Failing to write the cache only costs a full walk next time
+		_ = c.store(cachePath, rootDir, stored, visited)
+	}
+
+	result.Excluded = filter.excluded
+	return result, false, nil
+}
+
+// entryPath returns the cache file for a root directory and set of options
+func (c Cache) entryPath(rootDir string, opts Options) (string, error) {
+	absRoot, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", err
+	}
+	key, err := json.Marshal(struct {
+		Root string
+		Opts Options
+	}{absRoot, opts})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(key)
+	return filepath.Join(c.Dir, fmt.Sprintf("repos-%s.json", hex.EncodeToString(sum[:8]))), nil
+}
+
+// load returns the cached result if the entry exists and no visited directory has changed
+func (c Cache) load(cachePath string, rootDir string) (Result, bool) {
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return Result{}, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Version != cacheVersion {
+		return Result{}, false
+	}
+
+	for rel, mtime := range entry.Dirs {
+		info, err := os.Stat(filepath.Join(rootDir, rel))
+		if err != nil || info.ModTime().UnixNano() != mtime {
+			return Result{}, false
+		}
+	}
+
+	result := Result{
+		Repos:    joinRelative(rootDir, entry.Repos),
+		Excluded: joinRelative(rootDir, entry.Excluded),
+	}
+	for _, n := range entry.Nested {
+		result.Nested = append(result.Nested, NestedRepo{
+			Path:  joinRelative(rootDir, []string{n.Path})[0],
+			Outer: joinRelative(rootDir, []string{n.Outer})[0],
+		})
+	}
+	for _, n := range entry.Network {
+		result.Network = append(result.Network, NetworkPath{Path: joinRelative(rootDir, []string{n.Path})[0], Filesystem: n.Filesystem})
+	}
+	return result, true
+}
+
+// store writes a cache entry for a completed walk
+func (c Cache) store(cachePath string, rootDir string, result Result, visited []string) error {
+	absRoot, err := filepath.Abs(rootDir)
+	if err != nil {
+		return err
+	}
+
+	entry := cacheEntry{
+		Version: cacheVersion,
+		Root:    absRoot,
+		Dirs:    make(map[string]int64, len(visited)),
+	}
+
+	for _, dir := range visited {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootDir, dir)
+		if err != nil {
+			return err
+		}
+		entry.Dirs[rel] = info.ModTime().UnixNano()
+	}
+
+	if entry.Repos, err = relativePaths(rootDir, result.Repos); err != nil {
+		return err
+	}
+	if entry.Excluded, err = relativePaths(rootDir, result.Excluded); err != nil {
+		return err
+	}
+	for _, n := range result.Nested {
+		rel, err := relativePaths(rootDir, []string{n.Path, n.Outer})
+		if err != nil {
+			return err
+		}
+		entry.Nested = append(entry.Nested, NestedRepo{Path: rel[0], Outer: rel[1]})
+	}
+	for _, n := range result.Network {
+		rel, err := relativePaths(rootDir, []string{n.Path})
+		if err != nil {
+			return err
+		}
+		entry.Network = append(entry.Network, NetworkPath{Path: rel[0], Filesystem: n.Filesystem})
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+
+	// Write atomically so a concurrent run never reads a partial file
+	tmpPath := cachePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, cachePath)
+}
+
+// relativePaths converts paths produced by the walk to paths relative to rootDir
+func relativePaths(rootDir string, paths []string) ([]string, error) {
+	var rels []string
+	for _, path := range paths {
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return nil, err
+		}
+		rels = append(rels, rel)
+	}
+	return rels, nil
+}
+
+// joinRelative rebuilds paths the way the walk would have produced them for rootDir
+func joinRelative(rootDir string, rels []string) []string {
+	var paths []string
+	for _, rel := range rels {
+		if rel == "." {
+			paths = append(paths, rootDir)
+		} else {
+			paths = append(paths, filepath.Join(rootDir, rel))
+		}
+	}
+	return paths
+}
@@ -0,0 +1,151 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheFindRepositories(t *testing.T) {
+	tempDir := t.TempDir()
+	cache := Cache{Dir: t.TempDir()}
+
+	os.MkdirAll(filepath.Join(tempDir, "repo1", ".git"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, "group", "repo2", ".git"), 0755)
+
+	repos, cached, err := cache.FindRepositories(tempDir, Options{}, false)
+	if err != nil {
+		t.Fatalf("Error finding repositories: %v", err)
+	}
+	if cached {
+		t.Error("Expected first scan to walk the directory")
+	}
+	if len(repos) != 2 {
+		t.Fatalf("Expected 2 repositories, got %d: %v", len(repos), repos)
+	}
+
+	// Unchanged tree is served from the cache
+	repos, cached, err = cache.FindRepositories(tempDir, Options{}, false)
+	if err != nil {
+		t.Fatalf("Error finding repositories: %v", err)
+	}
+	if !cached {
+		t.Error("Expected second scan to use the cache")
+	}
+	if len(repos) != 2 || repos[0] != filepath.Join(tempDir, "group", "repo2") {
+		t.Errorf("Unexpected cached repositories: %v", repos)
+	}
+
+	// Refresh forces a walk even though nothing changed
+	if _, cached, _ = cache.FindRepositories(tempDir, Options{}, true); cached {
+		t.Error("Expected refresh to bypass the cache")
+	}
+
+	// A new repository changes its parent's mtime and invalidates the entry
+	group := filepath.Join(tempDir, "group")
+	os.MkdirAll(filepath.Join(group, "repo3", ".git"), 0755)
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(group, future, future)
+
+	repos, cached, err = cache.FindRepositories(tempDir, Options{}, false)
+	if err != nil {
+		t.Fatalf("Error finding repositories: %v", err)
+	}
+	if cached {
+		t.Error("Expected changed tree to be rescanned")
+	}
+	if len(repos) != 3 {
+		t.Errorf("Expected 3 repositories after change, got %d: %v", len(repos), repos)
+	}
+}
+
+func TestCacheKeyedByOptions(t *testing.T) {
+	tempDir := t.TempDir()
+	cache := Cache{Dir: t.TempDir()}
+
+	os.MkdirAll(filepath.Join(tempDir, "vendor", "repo", ".git"), 0755)
+
+	if _, _, err := cache.FindRepositories(tempDir, Options{}, false); err != nil {
+		t.Fatalf("Error finding repositories: %v", err)
+	}
+
+	// Different options must not reuse the default entry
+	repos, cached, err := cache.FindRepositories(tempDir, Options{SkipDirs: []string{}}, false)
+	if err != nil {
+		t.Fatalf("Error finding repositories: %v", err)
+	}
+	if cached {
+		t.Error("Expected different options to miss the cache")
+	}
+	if len(repos) != 1 {
+		t.Errorf("Expected vendored repository to be found, got %v", repos)
+	}
+}
+
+func TestCacheStream(t *testing.T) {
+	tempDir := t.TempDir()
+	cache := Cache{Dir: t.TempDir()}
+
+	os.MkdirAll(filepath.Join(tempDir, "repo1", ".git"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, "repo2", ".git"), 0755)
+
+	stream := func() ([]string, bool) {
+		var repos []string
+		_, cached, err := cache.Stream(tempDir, Options{}, false, func(repo string) bool {
+			repos = append(repos, repo)
+			return true
+		})
+		if err != nil {
+			t.Fatalf("Error streaming repositories: %v", err)
+		}
+		return repos, cached
+	}
+
+	// A walk stopped early is not cached
+	cache.Stream(tempDir, Options{}, false, func(string) bool { return false })
+
+	if repos, cached := stream(); cached || len(repos) != 2 {
+		t.Errorf("Expected the first complete stream to walk and find 2 repositories, got %v (cached %v)", repos, cached)
+	}
+	if repos, cached := stream(); !cached || len(repos) != 2 {
+		t.Errorf("Expected the second stream to use the cache, got %v (cached %v)", repos, cached)
+	}
+}
+
+func TestOnRepoDiscovered(t *testing.T) {
+	tempDir := t.TempDir()
+	cache := Cache{Dir: t.TempDir()}
+
+	os.MkdirAll(filepath.Join(tempDir, "repo1", ".git"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, "repo2", ".git"), 0755)
+
+	var discovered []string
+	opts := Options{OnRepoDiscovered: func(repo string) { discovered = append(discovered, repo) }}
+	expectDiscovered := func(how string) {
+		t.Helper()
+		if len(discovered) != 2 {
+			t.Errorf("Expected 2 repositories to be reported by %s, got %v", how, discovered)
+		}
+		discovered = nil
+	}
+
+	Discover(tempDir, opts)
+	expectDiscovered("Discover")
+	Stream(tempDir, opts, func(string) bool { return true })
+	expectDiscovered("Stream")
+
+	// The callback doesn't change the cache key, and cache hits are reported too
+	if _, cached, _ := cache.Discover(tempDir, opts, false); cached {
+		t.Error("Expected the first scan to walk the directory")
+	}
+	expectDiscovered("a cache miss")
+	if _, cached, _ := cache.Discover(tempDir, Options{OnRepoDiscovered: opts.OnRepoDiscovered}, false); !cached {
+		t.Error("Expected the second scan to use the cache")
+	}
+	expectDiscovered("a cache hit")
+	if _, cached, _ := cache.Stream(tempDir, opts, false, func(string) bool { return true }); !cached {
+		t.Error("Expected the stream to use the cache")
+	}
+	expectDiscovered("a cached stream")
+}
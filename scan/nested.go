@@ -0,0 +1,65 @@
+package scan
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// NestedPolicy decides what happens to a repository found inside another repository's working tree.
+// Submodules and linked worktrees are not affected, since they are never reported as repositories.
+type NestedPolicy string
+
+const (
+	// NestedUnchecked doesn't look inside repositories at all, so nested repositories are never found.
+	// This is the fastest option and the default.
+	NestedUnchecked NestedPolicy = ""
+	// NestedInclude processes outer and nested repositories independently
+	NestedInclude NestedPolicy = "include"
+	// NestedOuterOnly processes the outer repository and leaves the nested ones alone
+	NestedOuterOnly NestedPolicy = "outer-only"
+	// NestedSkip leaves both the outer and the nested repositories alone
+	NestedSkip NestedPolicy = "skip"
+)
+
+// NestedRepo is a repository found inside another repository's working tree
+type NestedRepo struct {
+	Path  string
+	Outer string
+}
+
+// ParseNestedPolicy validates a NESTED_REPOS value
+func ParseNestedPolicy(s string) (NestedPolicy, error) {
+	policy := NestedPolicy(strings.ToLower(strings.TrimSpace(s)))
+	switch policy {
+	case NestedUnchecked, NestedInclude, NestedOuterOnly, NestedSkip:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid nested repository policy %q (expected skip, include or outer-only)", s)
+}
+
+// applyNestedPolicy filters the discovered repositories and returns the kept and excluded ones
+func applyNestedPolicy(repos []string, nested []NestedRepo, policy NestedPolicy) ([]string, []string) {
+	if len(nested) == 0 || policy == NestedInclude || policy == NestedUnchecked {
+		return repos, nil
+	}
+
+	excluded := make(map[string]bool)
+	for _, n := range nested {
+		excluded[n.Path] = true
+		if policy == NestedSkip {
+			excluded[n.Outer] = true
+		}
+	}
+
+	var kept, dropped []string
+	for _, repo := range repos {
+		if excluded[repo] {
+			dropped = append(dropped, repo)
+		} else {
+			kept = append(kept, repo)
+		}
+	}
+
+	return kept, slices.Clip(dropped)
+}
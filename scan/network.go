@@ -0,0 +1,48 @@
+package scan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NetworkPolicy decides what happens to repositories on network filesystems (NFS, SMB, FUSE mounts and the like),
+// where scanning is slow and a rewrite interrupted by a dropped connection is harder to recover from
+type NetworkPolicy string
+
+const (
+	// NetworkInclude treats network filesystems like local ones and doesn't check for them
+	NetworkInclude NetworkPolicy = ""
+	// NetworkWarn processes repositories on network filesystems but reports them
+	NetworkWarn NetworkPolicy = "warn"
+	// NetworkSkip doesn't descend into directories on network filesystems at all
+	NetworkSkip NetworkPolicy = "skip"
+)
+
+// NetworkPath is a repository (NetworkWarn) or a skipped directory (NetworkSkip) on a network filesystem
+type NetworkPath struct {
+	Path string
+	// Filesystem names the filesystem, e.g. "nfs" or "smb2"
+	Filesystem string
+}
+
+// ParseNetworkPolicy validates a NETWORK_REPOS value
+func ParseNetworkPolicy(s string) (NetworkPolicy, error) {
+	policy := NetworkPolicy(strings.ToLower(strings.TrimSpace(s)))
+	if policy == "include" {
+		policy = NetworkInclude
+	}
+	switch policy {
+	case NetworkInclude, NetworkWarn, NetworkSkip:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid network filesystem policy %q (expected warn, skip or include)", s)
+}
+
+// NetworkFilesystem reports whether path is on a network filesystem and names the filesystem. Detection is best
+// effort: anything that can't be identified is treated as local.
+func NetworkFilesystem(path string) (string, bool) {
+	return detectFilesystem(path)
+}
+
+// detectFilesystem is the platform's filesystemType, replaceable in tests
+var detectFilesystem = filesystemType
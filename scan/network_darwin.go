@@ -0,0 +1,30 @@
+package scan
+
+import (
+	"strings"
+	"syscall"
+)
+
+// networkTypes are the names macOS reports for network filesystems; FUSE filesystems are matched by name separately
+var networkTypes = []string{"nfs", "smbfs", "afpfs", "webdav", "cifs", "ftp"}
+
+func filesystemType(path string) (string, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", false
+	}
+
+	var name strings.Builder
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name.WriteByte(byte(c))
+	}
+	for _, network := range networkTypes {
+		if name.String() == network {
+			return network, true
+		}
+	}
+	return name.String(), strings.Contains(name.String(), "fuse")
+}
@@ -0,0 +1,27 @@
+package scan
+
+import "syscall"
+
+// networkMagic maps the statfs magic numbers of network and FUSE filesystems to their names
+var networkMagic = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x5346414f: "afs",
+	0x73757245: "coda",
+	0x00c36400: "ceph",
+	0x01021997: "9p",
+	0x564c:     "ncp",
+}
+
+func filesystemType(path string) (string, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", false
+	}
+	// The field is signed on some architectures, so only its low 32 bits are compared
+	name, ok := networkMagic[uint32(stat.Type)]
+	return name, ok
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package scan
+
+// filesystemType can't identify filesystems on this platform, so everything is treated as local
+func filesystemType(path string) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,456 @@
+// Package scan discovers git repositories inside a directory tree.
+package scan
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DefaultSkipDirs are directories that are unlikely to contain repositories and are not descended into
+var DefaultSkipDirs = []string{
+	"node_modules",
+	"vendor",
+	"target",
+	"build",
+}
+
+// Options controls repository discovery
+type Options struct {
+	// SkipDirs lists directory names that are never descended into. Nil uses DefaultSkipDirs.
+	SkipDirs []string
+	// FollowSymlinks descends into symlinked directories. Targets already covered by the walk are
+	// not entered again, which also breaks symlink cycles.
+	FollowSymlinks bool
+	// NestedRepos decides how repositories inside other repositories are treated
+	NestedRepos NestedPolicy
+	// NetworkRepos decides how repositories on network filesystems are treated
+	NetworkRepos NetworkPolicy
+	// OnRepoDiscovered, when set, is called with every repository Discover returns or Stream passes on, also when
+	// they come from the cache
+	OnRepoDiscovered func(repo string) `json:"-"`
+}
+
+// reportDiscovered calls OnRepoDiscovered for every repository
+func (opts Options) reportDiscovered(repos []string) {
+	if opts.OnRepoDiscovered == nil {
+		return
+	}
+	for _, repo := range repos {
+		opts.OnRepoDiscovered(repo)
+	}
+}
+
+// reportingDiscovered wraps yield so OnRepoDiscovered is called with every repository passed on
+func (opts Options) reportingDiscovered(yield func(repo string) bool) func(repo string) bool {
+	if opts.OnRepoDiscovered == nil {
+		return yield
+	}
+	return func(repo string) bool {
+		opts.OnRepoDiscovered(repo)
+		return yield(repo)
+	}
+}
+
+// Result is the outcome of a discovery walk
+type Result struct {
+	// Repos are the repositories to process
+	Repos []string
+	// Nested lists every repository found inside another repository, whatever the policy did with it
+	Nested []NestedRepo
+	// Excluded are repositories dropped by the nested repository policy
+	Excluded []string
+	// Network lists the repositories (NetworkWarn) or skipped directories (NetworkSkip) on network filesystems
+	Network []NetworkPath
+}
+
+// FindRepositories returns the root directory of every git repository found under rootDir.
+// Only directories are inspected, and the walk does not descend into a repository once its root is found.
+// A repository reachable through several paths (symlinks, bind mounts) is returned once.
+func FindRepositories(rootDir string, opts Options) ([]string, error) {
+	result, err := Discover(rootDir, opts)
+	return result.Repos, err
+}
+
+// Discover is FindRepositories with details about nested repositories
+func Discover(rootDir string, opts Options) (Result, error) {
+	result, _, err := walk(rootDir, opts)
+	if err == nil {
+		opts.reportDiscovered(result.Repos)
+	}
+	return result, err
+}
+
+// walk discovers repositories under rootDir and also returns every directory it visited,
+// which is what the discovery cache needs to detect changes later
+func walk(rootDir string, opts Options) (Result, []string, error) {
+	var gitRepos []string
+	var visited []string
+	var result Result
+
+	err := walkRepos(rootDir, opts, walkCallbacks{
+		visit: func(dir string) { visited = append(visited, dir) },
+		found: func(path string, outer string) bool {
+			gitRepos = append(gitRepos, path)
+			if outer != "" {
+				result.Nested = append(result.Nested, NestedRepo{Path: path, Outer: outer})
+			}
+			return true
+		},
+		network: func(network NetworkPath) { result.Network = append(result.Network, network) },
+	})
+
+	result.Repos, result.Excluded = applyNestedPolicy(Dedupe(gitRepos), result.Nested, opts.NestedRepos)
+
+	return result, visited, err
+}
+
+// walkCallbacks receive what walkRepos comes across
+type walkCallbacks struct {
+	// visit, when not nil, is called with every directory walked
+	visit func(dir string)
+	// found is called with every repository root in walk order, along with the innermost repository it is nested
+	// in, if any. The walk stops when it returns false.
+	found func(path string, outer string) bool
+	// network is called with the repositories or directories on network filesystems, as NetworkRepos asks for
+	network func(network NetworkPath)
+}
+
+// walkRepos walks rootDir and reports the repositories and directories it finds to callbacks
+func walkRepos(rootDir string, opts Options, callbacks walkCallbacks) error {
+	skipDirs := opts.SkipDirs
+	if skipDirs == nil {
+		skipDirs = DefaultSkipDirs
+	}
+
+	// Real paths of every tree walked so far, used to avoid entering a symlink target twice
+	var walkedRoots []string
+	stopped := false
+
+	var walkTree func(treeRoot string) error
+	walkTree = func(treeRoot string) error {
+		if realRoot, err := filepath.EvalSymlinks(treeRoot); err == nil {
+			walkedRoots = append(walkedRoots, realRoot)
+		}
+
+		// WalkDir doesn't descend into a symlinked root, but does when the root ends in a separator
+		walkRoot := treeRoot
+		if info, err := os.Lstat(treeRoot); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			walkRoot = treeRoot + string(filepath.Separator)
+		}
+
+		// Repositories enclosing the current path, innermost last
+		var enclosing []string
+
+		return filepath.WalkDir(walkRoot, func(path string, d fs.DirEntry, err error) error {
+			if stopped {
+				return filepath.SkipAll
+			}
+			if err != nil {
+				return err
+			}
+			if path == walkRoot {
+				path = treeRoot
+			}
+
+			// Symlinked directories are walked as separate trees when following is enabled
+			if d.Type()&fs.ModeSymlink != 0 {
+				if !opts.FollowSymlinks || isSkipped(d.Name(), skipDirs) {
+					return nil
+				}
+				target, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return nil // Dangling symlink
+				}
+				if info, err := os.Stat(target); err != nil || !info.IsDir() {
+					return nil
+				}
+				if isWithinAny(target, walkedRoots) {
+					return nil // Already covered, or a cycle back into the walk
+				}
+				return walkTree(path)
+			}
+
+			// Files are never repository roots; only directories are checked
+			if !d.IsDir() {
+				return nil
+			}
+
+			// Skip hidden directories and common non-repo directories (the root is always scanned)
+			if path != treeRoot && isSkipped(d.Name(), skipDirs) {
+				return filepath.SkipDir
+			}
+
+			// Checking every directory is only worth it when it saves walking a network filesystem
+			if opts.NetworkRepos == NetworkSkip {
+				if filesystem, ok := NetworkFilesystem(path); ok {
+					callbacks.network(NetworkPath{Path: path, Filesystem: filesystem})
+					return filepath.SkipDir
+				}
+			}
+
+			if callbacks.visit != nil {
+				callbacks.visit(path)
+			}
+
+			if !isRepositoryRoot(path) {
+				return nil
+			}
+
+			if opts.NetworkRepos == NetworkWarn {
+				if filesystem, ok := NetworkFilesystem(path); ok {
+					callbacks.network(NetworkPath{Path: path, Filesystem: filesystem})
+				}
+			}
+
+			for len(enclosing) > 0 && !isWithinAny(path, enclosing[len(enclosing)-1:]) {
+				enclosing = enclosing[:len(enclosing)-1]
+			}
+			outer := ""
+			if len(enclosing) > 0 {
+				outer = enclosing[len(enclosing)-1]
+			}
+			if !callbacks.found(path, outer) {
+				stopped = true
+				return filepath.SkipAll
+			}
+
+			// Without a nested policy there is no need to look inside a repository
+			if opts.NestedRepos == NestedUnchecked {
+				return filepath.SkipDir
+			}
+			enclosing = append(enclosing, path)
+
+			return nil
+		})
+	}
+
+	return walkTree(rootDir)
+}
+
+// Stream calls yield with every repository under rootDir as soon as it is known to be kept, so processing can start
+// long before the walk of a large tree is done. Repositories are deduplicated and filtered by the nested repository
+// policy like Discover does, except that with NestedSkip a repository is only passed on once the walk has left it,
+// since a repository found inside it later excludes it. The walk stops when yield returns false.
+// The returned Result has everything but Repos, which would defeat the purpose.
+func Stream(rootDir string, opts Options, yield func(repo string) bool) (Result, error) {
+	var result Result
+	filter := newStreamFilter(opts.NestedRepos, opts.reportingDiscovered(yield))
+	err := walkRepos(rootDir, opts, walkCallbacks{
+		found: func(path string, outer string) bool {
+			if outer != "" {
+				result.Nested = append(result.Nested, NestedRepo{Path: path, Outer: outer})
+			}
+			return filter.found(path, outer)
+		},
+		network: func(network NetworkPath) { result.Network = append(result.Network, network) },
+	})
+	if err != nil {
+		return result, err
+	}
+	filter.flush("")
+	result.Excluded = filter.excluded
+	return result, nil
+}
+
+// streamFilter applies Dedupe and the nested repository policy to repositories as the walk finds them
+type streamFilter struct {
+	policy NestedPolicy
+	yield  func(repo string) bool
+	seen   []os.FileInfo
+	// pending holds, for NestedSkip, the repositories the walk may still be inside, innermost last
+	pending []pendingRepo
+	// excluded lists the repositories dropped by the nested repository policy
+	excluded []string
+	stopped  bool
+}
+
+// pendingRepo is a repository held back until the walk has left it
+type pendingRepo struct {
+	path     string
+	excluded bool
+}
+
+func newStreamFilter(policy NestedPolicy, yield func(repo string) bool) *streamFilter {
+	return &streamFilter{policy: policy, yield: yield}
+}
+
+// found handles a repository reported by walkRepos and reports whether the walk should go on
+func (f *streamFilter) found(path string, outer string) bool {
+	f.flush(path)
+	if f.stopped {
+		return false
+	}
+
+	// Both the nested repository and the one it is in are excluded
+	if f.policy == NestedSkip && outer != "" {
+		for i := range f.pending {
+			if f.pending[i].path == outer {
+				f.pending[i].excluded = true
+			}
+		}
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		if slices.ContainsFunc(f.seen, func(other os.FileInfo) bool { return os.SameFile(info, other) }) {
+			return true
+		}
+		f.seen = append(f.seen, info)
+	}
+
+	switch {
+	case f.policy == NestedSkip:
+		f.pending = append(f.pending, pendingRepo{path: path, excluded: outer != ""})
+	case f.policy == NestedOuterOnly && outer != "":
+		f.excluded = append(f.excluded, path)
+	default:
+		f.stopped = !f.yield(path)
+	}
+	return !f.stopped
+}
+
+// flush passes on the pending repositories that path is outside of; an empty path flushes all of them
+func (f *streamFilter) flush(path string) {
+	for len(f.pending) > 0 {
+		last := f.pending[len(f.pending)-1]
+		if path != "" && isWithinAny(path, []string{last.path}) {
+			return
+		}
+		f.pending = f.pending[:len(f.pending)-1]
+		if last.excluded {
+			f.excluded = append(f.excluded, last.path)
+		} else if !f.stopped {
+			f.stopped = !f.yield(last.path)
+		}
+	}
+}
+
+// Dedupe removes paths that refer to a directory already in the list, keeping the first occurrence.
+// Paths are compared by file identity, so symlinks and bind mounts of the same directory are detected.
+func Dedupe(paths []string) []string {
+	var unique []string
+	var seen []os.FileInfo
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			unique = append(unique, path)
+			continue
+		}
+		if slices.ContainsFunc(seen, func(other os.FileInfo) bool { return os.SameFile(info, other) }) {
+			continue
+		}
+		seen = append(seen, info)
+		unique = append(unique, path)
+	}
+
+	return unique
+}
+
+// FilterByName keeps the repositories whose directory name matches one of the only patterns (all when only is empty)
+// and none of the skip patterns. Patterns use filepath.Match syntax, e.g. "service-*".
+func FilterByName(repos []string, only []string, skip []string) ([]string, error) {
+	for _, pattern := range slices.Concat(only, skip) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid repository name pattern %q: %w", pattern, err)
+		}
+	}
+
+	matchesAny := func(name string, patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool {
+			matched, _ := filepath.Match(pattern, name)
+			return matched
+		})
+	}
+
+	var filtered []string
+	for _, repo := range repos {
+		name := filepath.Base(repo)
+		if len(only) > 0 && !matchesAny(name, only) {
+			continue
+		}
+		if matchesAny(name, skip) {
+			continue
+		}
+		filtered = append(filtered, repo)
+	}
+	return filtered, nil
+}
+
+// isSkipped reports whether a directory name is hidden or in the skip list
+func isSkipped(name string, skipDirs []string) bool {
+	return strings.HasPrefix(name, ".") || slices.Contains(skipDirs, name)
+}
+
+// isWithinAny reports whether path is one of roots or inside one of them
+func isWithinAny(path string, roots []string) bool {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRepositoryRoot reports whether dir is the root of a repository: it either contains a .git directory,
+// or a .git file pointing at a separate git directory (git init --separate-git-dir)
+func isRepositoryRoot(dir string) bool {
+	gitPath := filepath.Join(dir, ".git")
+	info, err := os.Lstat(gitPath)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		return true
+	}
+	if !info.Mode().IsRegular() {
+		return false
+	}
+
+	gitDir, ok := readGitFile(gitPath)
+	if !ok {
+		return false
+	}
+
+	// Linked worktrees share the main repository's git directory, which is found on its own
+	if _, err := os.Stat(filepath.Join(gitDir, "commondir")); err == nil {
+		return false
+	}
+
+	// Submodules are part of their superproject; their git directory records the work tree explicitly
+	config, err := os.ReadFile(filepath.Join(gitDir, "config"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(config), "\n") {
+		key, _, found := strings.Cut(strings.TrimSpace(line), "=")
+		if found && strings.TrimSpace(key) == "worktree" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readGitFile returns the git directory referenced by a "gitdir: <path>" file, resolved against its directory
+func readGitFile(gitPath string) (string, bool) {
+	content, err := os.ReadFile(gitPath)
+	if err != nil {
+		return "", false
+	}
+
+	gitDir, found := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:")
+	if !found {
+		return "", false
+	}
+
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(gitPath), gitDir)
+	}
+	return gitDir, true
+}
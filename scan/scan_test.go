@@ -0,0 +1,435 @@
+package scan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindGitRepositories(t *testing.T) {
+	// Create a temporary directory structure
+	tempDir := t.TempDir()
+
+	// Create some directories
+	repo1 := filepath.Join(tempDir, "repo1")
+	repo2 := filepath.Join(tempDir, "repo2")
+	nonRepo := filepath.Join(tempDir, "non-repo")
+
+	os.MkdirAll(repo1, 0755)
+	os.MkdirAll(repo2, 0755)
+	os.MkdirAll(nonRepo, 0755)
+
+	// Create .git directories
+	os.MkdirAll(filepath.Join(repo1, ".git"), 0755)
+	os.MkdirAll(filepath.Join(repo2, ".git"), 0755)
+
+	// Create a nested repo
+	nestedRepo := filepath.Join(tempDir, "parent", "nested-repo")
+	os.MkdirAll(filepath.Join(nestedRepo, ".git"), 0755)
+
+	// Test finding repositories
+	repos, err := FindRepositories(tempDir, Options{})
+	if err != nil {
+		t.Fatalf("Error finding git repositories: %v", err)
+	}
+
+	if len(repos) != 3 {
+		t.Errorf("Expected 3 repositories, got %d", len(repos))
+	}
+
+	// Verify all expected repos are found
+	expectedRepos := []string{repo1, repo2, nestedRepo}
+	for _, expected := range expectedRepos {
+		found := false
+		for _, repo := range repos {
+			if repo == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Expected to find repository %s", expected)
+		}
+	}
+}
+
+func TestFindRepositoriesPrunesRepositoryContents(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A repository with a lot of content, including a directory that looks like a repository
+	repo := filepath.Join(tempDir, "repo")
+	os.MkdirAll(filepath.Join(repo, ".git"), 0755)
+	os.MkdirAll(filepath.Join(repo, "src", "pkg"), 0755)
+	os.WriteFile(filepath.Join(repo, "src", "main.go"), []byte("package main"), 0644)
+	os.MkdirAll(filepath.Join(repo, "src", "inner", ".git"), 0755)
+
+	// Skipped directories are never descended into
+	os.MkdirAll(filepath.Join(tempDir, "node_modules", "dep", ".git"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, ".hidden", "repo", ".git"), 0755)
+
+	repos, err := FindRepositories(tempDir, Options{})
+	if err != nil {
+		t.Fatalf("Error finding git repositories: %v", err)
+	}
+
+	if len(repos) != 1 || repos[0] != repo {
+		t.Errorf("Expected only %s, got %v", repo, repos)
+	}
+}
+
+func TestFindRepositoriesRootIsRepository(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, ".git"), 0755)
+
+	// Scanning "." must not be treated as a hidden directory
+	t.Chdir(tempDir)
+	repos, err := FindRepositories(".", Options{})
+	if err != nil {
+		t.Fatalf("Error finding git repositories: %v", err)
+	}
+
+	if len(repos) != 1 || repos[0] != "." {
+		t.Errorf("Expected the root to be found, got %v", repos)
+	}
+}
+
+func TestFindRepositoriesCustomSkipDirs(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "vendor", "repo", ".git"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, "archive", "repo", ".git"), 0755)
+
+	repos, err := FindRepositories(tempDir, Options{SkipDirs: []string{"archive"}})
+	if err != nil {
+		t.Fatalf("Error finding git repositories: %v", err)
+	}
+
+	expected := filepath.Join(tempDir, "vendor", "repo")
+	if len(repos) != 1 || repos[0] != expected {
+		t.Errorf("Expected only %s, got %v", expected, repos)
+	}
+}
+
+func BenchmarkFindRepositories(b *testing.B) {
+	tempDir := b.TempDir()
+	for i := 0; i < 20; i++ {
+		repo := filepath.Join(tempDir, fmt.Sprintf("repo%d", i))
+		os.MkdirAll(filepath.Join(repo, ".git"), 0755)
+		for j := 0; j < 50; j++ {
+			os.WriteFile(filepath.Join(repo, fmt.Sprintf("file%d.txt", j)), nil, 0644)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FindRepositories(tempDir, Options{})
+	}
+}
+
+func TestFindRepositoriesFollowSymlinks(t *testing.T) {
+	tempDir := t.TempDir()
+	workspace := filepath.Join(tempDir, "workspace")
+	external := filepath.Join(tempDir, "external")
+
+	os.MkdirAll(filepath.Join(workspace, "local", ".git"), 0755)
+	os.MkdirAll(filepath.Join(external, "linked", ".git"), 0755)
+
+	// A symlink to a tree outside the workspace, a duplicate link to a repository already
+	// in the workspace, and a cycle back to the workspace root
+	symlink(t, external, filepath.Join(workspace, "ext"))
+	symlink(t, filepath.Join(workspace, "local"), filepath.Join(workspace, "local-alias"))
+	symlink(t, workspace, filepath.Join(workspace, "loop"))
+
+	repos, err := FindRepositories(workspace, Options{})
+	if err != nil {
+		t.Fatalf("Error finding repositories: %v", err)
+	}
+	if len(repos) != 1 {
+		t.Errorf("Expected only the local repository without following symlinks, got %v", repos)
+	}
+
+	repos, err = FindRepositories(workspace, Options{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("Error finding repositories: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join(workspace, "ext", "linked"),
+		filepath.Join(workspace, "local"),
+	}
+	if len(repos) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, repos)
+	}
+	for i := range expected {
+		if repos[i] != expected[i] {
+			t.Errorf("Expected %s at position %d, got %s", expected[i], i, repos[i])
+		}
+	}
+}
+
+func TestFindRepositoriesSymlinkedRoot(t *testing.T) {
+	tempDir := t.TempDir()
+	realDir := filepath.Join(tempDir, "real")
+	link := filepath.Join(tempDir, "link")
+
+	os.MkdirAll(filepath.Join(realDir, "repo", ".git"), 0755)
+	symlink(t, realDir, link)
+
+	repos, err := FindRepositories(link, Options{})
+	if err != nil {
+		t.Fatalf("Error finding repositories: %v", err)
+	}
+	if len(repos) != 1 || repos[0] != filepath.Join(link, "repo") {
+		t.Errorf("Expected repository under symlinked root, got %v", repos)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	tempDir := t.TempDir()
+	repo := filepath.Join(tempDir, "repo")
+	alias := filepath.Join(tempDir, "alias")
+	other := filepath.Join(tempDir, "other")
+
+	os.MkdirAll(repo, 0755)
+	os.MkdirAll(other, 0755)
+	symlink(t, repo, alias)
+
+	unique := Dedupe([]string{repo, alias, other, repo})
+	if len(unique) != 2 || unique[0] != repo || unique[1] != other {
+		t.Errorf("Expected [%s %s], got %v", repo, other, unique)
+	}
+}
+
+func TestFindRepositoriesNestedPolicy(t *testing.T) {
+	tempDir := t.TempDir()
+	outer := filepath.Join(tempDir, "outer")
+	inner := filepath.Join(outer, "libs", "inner")
+	standalone := filepath.Join(tempDir, "standalone")
+
+	os.MkdirAll(filepath.Join(outer, ".git"), 0755)
+	os.MkdirAll(filepath.Join(inner, ".git"), 0755)
+	os.MkdirAll(filepath.Join(standalone, ".git"), 0755)
+
+	// Submodules have a .git file and are never treated as nested repositories
+	submodule := filepath.Join(outer, "submodule")
+	os.MkdirAll(submodule, 0755)
+	os.WriteFile(filepath.Join(submodule, ".git"), []byte("gitdir: ../.git/modules/submodule\n"), 0644)
+
+	tests := []struct {
+		policy   NestedPolicy
+		repos    []string
+		excluded []string
+		nested   int
+	}{
+		{NestedUnchecked, []string{outer, standalone}, nil, 0},
+		{NestedInclude, []string{outer, inner, standalone}, nil, 1},
+		{NestedOuterOnly, []string{outer, standalone}, []string{inner}, 1},
+		{NestedSkip, []string{standalone}, []string{outer, inner}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			result, err := Discover(tempDir, Options{NestedRepos: tt.policy})
+			if err != nil {
+				t.Fatalf("Error discovering repositories: %v", err)
+			}
+			if !slices.Equal(result.Repos, tt.repos) {
+				t.Errorf("Expected repos %v, got %v", tt.repos, result.Repos)
+			}
+			if !slices.Equal(result.Excluded, tt.excluded) {
+				t.Errorf("Expected excluded %v, got %v", tt.excluded, result.Excluded)
+			}
+			if len(result.Nested) != tt.nested {
+				t.Fatalf("Expected %d nested repositories, got %v", tt.nested, result.Nested)
+			}
+			if tt.nested > 0 && (result.Nested[0].Path != inner || result.Nested[0].Outer != outer) {
+				t.Errorf("Expected %s nested in %s, got %+v", inner, outer, result.Nested[0])
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{
+		"a-standalone",
+		"b-outer",
+		"b-outer/libs/inner",
+		"b-outer/libs/inner/deeper",
+		"c-outer/vendored",
+		"c-outer",
+		"d-standalone",
+	} {
+		os.MkdirAll(filepath.Join(tempDir, dir, ".git"), 0755)
+	}
+
+	for _, policy := range []NestedPolicy{NestedUnchecked, NestedInclude, NestedOuterOnly, NestedSkip} {
+		t.Run(string(policy), func(t *testing.T) {
+			opts := Options{NestedRepos: policy}
+			expected, err := FindRepositories(tempDir, opts)
+			if err != nil {
+				t.Fatalf("Error finding repositories: %v", err)
+			}
+
+			var streamed []string
+			if _, err := Stream(tempDir, opts, func(repo string) bool {
+				streamed = append(streamed, repo)
+				return true
+			}); err != nil {
+				t.Fatalf("Error streaming repositories: %v", err)
+			}
+			if !slices.Equal(streamed, expected) {
+				t.Errorf("Expected the streamed repositories to match %v, got %v", expected, streamed)
+			}
+		})
+	}
+
+	// Returning false stops the walk
+	var first []string
+	Stream(tempDir, Options{}, func(repo string) bool {
+		first = append(first, repo)
+		return false
+	})
+	if !slices.Equal(first, []string{filepath.Join(tempDir, "a-standalone")}) {
+		t.Errorf("Expected the walk to stop after the first repository, got %v", first)
+	}
+}
+
+func TestFindRepositoriesNetworkPolicy(t *testing.T) {
+	tempDir := t.TempDir()
+	local := filepath.Join(tempDir, "local")
+	mount := filepath.Join(tempDir, "mnt", "share")
+	remote := filepath.Join(mount, "remote")
+	os.MkdirAll(filepath.Join(local, ".git"), 0755)
+	os.MkdirAll(filepath.Join(remote, ".git"), 0755)
+
+	// Everything under mount pretends to be an NFS export
+	defer func(detect func(string) (string, bool)) { detectFilesystem = detect }(detectFilesystem)
+	detectFilesystem = func(path string) (string, bool) {
+		if isWithinAny(path, []string{mount}) {
+			return "nfs", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		policy  NetworkPolicy
+		repos   []string
+		network []NetworkPath
+	}{
+		{NetworkInclude, []string{local, remote}, nil},
+		{NetworkWarn, []string{local, remote}, []NetworkPath{{Path: remote, Filesystem: "nfs"}}},
+		{NetworkSkip, []string{local}, []NetworkPath{{Path: mount, Filesystem: "nfs"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			result, err := Discover(tempDir, Options{NetworkRepos: tt.policy})
+			if err != nil {
+				t.Fatalf("Error discovering repositories: %v", err)
+			}
+			if !slices.Equal(result.Repos, tt.repos) {
+				t.Errorf("Expected repos %v, got %v", tt.repos, result.Repos)
+			}
+			if !slices.Equal(result.Network, tt.network) {
+				t.Errorf("Expected network paths %v, got %v", tt.network, result.Network)
+			}
+		})
+	}
+}
+
+func TestParseNetworkPolicy(t *testing.T) {
+	for input, expected := range map[string]NetworkPolicy{"": NetworkInclude, "include": NetworkInclude, " Warn": NetworkWarn, "skip": NetworkSkip} {
+		if policy, err := ParseNetworkPolicy(input); err != nil || policy != expected {
+			t.Errorf("ParseNetworkPolicy(%q) = %q, %v, want %q", input, policy, err, expected)
+		}
+	}
+	if _, err := ParseNetworkPolicy("sometimes"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestParseNestedPolicy(t *testing.T) {
+	for _, valid := range []string{"", "skip", "Include", " outer-only "} {
+		if _, err := ParseNestedPolicy(valid); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", valid, err)
+		}
+	}
+	if _, err := ParseNestedPolicy("inner-only"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestFindRepositoriesSeparateGitDir(t *testing.T) {
+	tempDir := t.TempDir()
+	gitDirs := t.TempDir()
+
+	// git init --separate-git-dir leaves a .git file pointing at the real git directory
+	separate := filepath.Join(tempDir, "separate")
+	os.MkdirAll(separate, 0755)
+	os.MkdirAll(filepath.Join(gitDirs, "separate.git"), 0755)
+	os.WriteFile(filepath.Join(gitDirs, "separate.git", "config"), []byte("[core]\n\tbare = false\n"), 0644)
+	os.WriteFile(filepath.Join(separate, ".git"), []byte("gitdir: "+filepath.Join(gitDirs, "separate.git")+"\n"), 0644)
+
+	// A linked worktree's git directory has a commondir file
+	worktree := filepath.Join(tempDir, "worktree")
+	os.MkdirAll(worktree, 0755)
+	os.MkdirAll(filepath.Join(gitDirs, "worktrees", "wt"), 0755)
+	os.WriteFile(filepath.Join(gitDirs, "worktrees", "wt", "commondir"), []byte("../..\n"), 0644)
+	os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: "+filepath.Join(gitDirs, "worktrees", "wt")+"\n"), 0644)
+
+	// A submodule's git directory sets core.worktree; relative gitdir paths are resolved against the work tree
+	submodule := filepath.Join(tempDir, "super", "sub")
+	os.MkdirAll(submodule, 0755)
+	os.MkdirAll(filepath.Join(tempDir, "super", ".git", "modules", "sub"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "super", ".git", "modules", "sub", "config"), []byte("[core]\n\tworktree = ../../../sub\n"), 0644)
+	os.WriteFile(filepath.Join(submodule, ".git"), []byte("gitdir: ../.git/modules/sub\n"), 0644)
+
+	repos, err := FindRepositories(tempDir, Options{NestedRepos: NestedInclude})
+	if err != nil {
+		t.Fatalf("Error finding repositories: %v", err)
+	}
+
+	expected := []string{separate, filepath.Join(tempDir, "super")}
+	if !slices.Equal(repos, expected) {
+		t.Errorf("Expected %v, got %v", expected, repos)
+	}
+}
+
+func TestFilterByName(t *testing.T) {
+	repos := []string{"/w/service-api", "/w/service-web", "/w/legacy-service-old", "/w/tools"}
+
+	tests := []struct {
+		only, skip []string
+		expected   []string
+	}{
+		{nil, nil, repos},
+		{[]string{"service-*"}, nil, []string{"/w/service-api", "/w/service-web"}},
+		{nil, []string{"legacy-*"}, []string{"/w/service-api", "/w/service-web", "/w/tools"}},
+		{[]string{"service-*", "tools"}, []string{"*-web"}, []string{"/w/service-api", "/w/tools"}},
+	}
+
+	for _, tt := range tests {
+		got, err := FilterByName(repos, tt.only, tt.skip)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !slices.Equal(got, tt.expected) {
+			t.Errorf("FilterByName(only=%v, skip=%v) = %v, expected %v", tt.only, tt.skip, got, tt.expected)
+		}
+	}
+
+	if _, err := FilterByName(repos, []string{"service-["}, nil); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+}
+
+// symlink creates newname as a symlink to oldname, skipping the test where symlinks can't be created, as on Windows
+// without Developer Mode
+func symlink(t *testing.T, oldname, newname string) {
+	t.Helper()
+	if err := os.Symlink(oldname, newname); err != nil {
+		t.Skipf("Symlinks unavailable: %v", err)
+	}
+}
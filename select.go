@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// errSelectionQuit is returned when the user quits the commit selector, which stops the run
+var errSelectionQuit = errors.New("quit")
+
+// commitSelector lets the user pick which repositories and commits a cadence run rewrites (--select) in a
+// full-screen terminal UI, and shows the plan for the selection before it is applied
+type commitSelector struct {
+	in  io.Reader
+	out io.Writer
+	// quit stops the run when the user quits the selector, since the terminal doesn't send Ctrl-C as a signal
+	quit context.CancelFunc
+}
+
+// selector is set when --select is given; nil rewrites every unpushed commit without asking
+var selector *commitSelector
+
+// newCommitSelector reads keys from in, draws on out and calls quit when the user quits
+func newCommitSelector(in io.Reader, out io.Writer, quit context.CancelFunc) *commitSelector {
+	return &commitSelector{in: in, out: out, quit: quit}
+}
+
+// previewFunc returns the plan for rewriting the commits of a repository with the ones in excluded left at their
+// original times
+type previewFunc func(excluded map[string]bool) (cadence.Plan, error)
+
+// selectCommits lists the commits of repo (newest first) with checkboxes and, once the user accepts the selection,
+// the plan preview returns for it. It returns the plan the user applied, and apply is false when the user excluded
+// the whole repository or declined the plan.
+func (s *commitSelector) selectCommits(ctx context.Context, repo string, commits []git.Commit, preview previewFunc) (plan cadence.Plan, apply bool, err error) {
+	program := tea.NewProgram(newSelectModel(repo, commits, preview),
+		tea.WithContext(ctx), tea.WithInput(s.in), tea.WithOutput(s.out), tea.WithAltScreen())
+	final, err := program.Run()
+	if err != nil {
+		if ctx.Err() != nil {
+			return cadence.Plan{}, false, ctx.Err()
+		}
+		return cadence.Plan{}, false, err
+	}
+
+	m := final.(selectModel)
+	if m.quit {
+		if s.quit != nil {
+			s.quit()
+		}
+		return cadence.Plan{}, false, errSelectionQuit
+	}
+	return m.plan, m.apply, nil
+}
+
+// selectModel is the state of the commit selector. It starts on the checkbox list and switches to the plan preview
+// when the selection is accepted.
+type selectModel struct {
+	repo     string
+	commits  []git.Commit
+	preview  previewFunc
+	excluded map[string]bool
+	// cursor is the row under the cursor: 0 is the repository, the commits follow
+	cursor int
+	// height is the terminal height, 0 until it is known
+	height int
+
+	// previewing shows plan, or planErr when it couldn't be computed, instead of the checkbox list
+	previewing bool
+	plan       cadence.Plan
+	planErr    error
+	// scroll is the first plan line shown
+	scroll int
+
+	apply bool
+	quit  bool
+}
+
+// newSelectModel returns a selector with every commit selected
+func newSelectModel(repo string, commits []git.Commit, preview previewFunc) selectModel {
+	return selectModel{repo: repo, commits: commits, preview: preview, excluded: make(map[string]bool)}
+}
+
+// Init implements tea.Model
+func (m selectModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (m selectModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		if model, cmd, ok := updateEachKey(m, msg); ok {
+			return model, cmd
+		}
+		if msg.String() == "ctrl+c" || msg.String() == "q" {
+			m.quit = true
+			return m, tea.Quit
+		}
+		if m.previewing {
+			return m.updatePreview(msg)
+		}
+		return m.updateList(msg)
+	}
+	return m, nil
+}
+
+// updateList handles a key on the checkbox list
+func (m selectModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.commits) {
+			m.cursor++
+		}
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.commits)
+	case " ", "x":
+		if m.cursor == 0 {
+			m.setAll(len(m.excluded) == len(m.commits))
+		} else {
+			hash := m.commits[m.cursor-1].Hash
+			if m.excluded[hash] {
+				delete(m.excluded, hash)
+			} else {
+				m.excluded[hash] = true
+			}
+		}
+	case "a":
+		m.setAll(true)
+	case "n":
+		m.setAll(false)
+	case "enter":
+		// Leaving every commit out excludes the repository
+		if len(m.excluded) == len(m.commits) {
+			return m, tea.Quit
+		}
+		m.previewing, m.scroll = true, 0
+		m.plan, m.planErr = m.preview(m.excluded)
+	}
+	return m, nil
+}
+
+// updatePreview handles a key on the plan preview
+func (m selectModel) updatePreview(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.scroll > 0 {
+			m.scroll--
+		}
+	case "down", "j":
+		if m.scroll < len(m.planLines())-1 {
+			m.scroll++
+		}
+	case "y":
+		if m.planErr == nil {
+			m.apply = true
+			return m, tea.Quit
+		}
+	case "n":
+		return m, tea.Quit
+	case "b", "esc":
+		m.previewing = false
+	}
+	return m, nil
+}
+
+// updateEachKey passes the keys of msg to m one by one when several arrived in one message, as keys typed faster
+// than they are read do. It stops at the first key that returns a command, and reports whether msg was split.
+func updateEachKey(m tea.Model, msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	if msg.Type != tea.KeyRunes || len(msg.Runes) < 2 || msg.Paste {
+		return m, nil, false
+	}
+	for _, r := range msg.Runes {
+		var cmd tea.Cmd
+		if m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}}); cmd != nil {
+			return m, cmd, true
+		}
+	}
+	return m, nil, true
+}
+
+// setAll selects or deselects every commit
+func (m *selectModel) setAll(selected bool) {
+	m.excluded = make(map[string]bool)
+	if !selected {
+		for _, commit := range m.commits {
+			m.excluded[commit.Hash] = true
+		}
+	}
+}
+
+// planLines is the plan preview, one line per day and commit
+func (m selectModel) planLines() []string {
+	if m.planErr != nil {
+		return []string{fmt.Sprintf("   ❌ %v", m.planErr)}
+	}
+	var b strings.Builder
+	writePlan(&b, m.plan)
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+}
+
+// View implements tea.Model
+func (m selectModel) View() string {
+	if m.quit || m.apply {
+		return ""
+	}
+
+	var b strings.Builder
+	selected := len(m.commits) - len(m.excluded)
+	if m.previewing {
+		fmt.Fprintf(&b, "📦 %s: plan for %d of %d commits\n\n", m.repo, selected, len(m.commits))
+		lines := m.planLines()
+		for _, line := range lines[m.scroll:min(len(lines), m.scroll+m.rows())] {
+			fmt.Fprintln(&b, line)
+		}
+		b.WriteString("\n↑/↓ scroll • y apply • n skip repository • b back • q quit\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "📦 %s: choose the commits to reschedule, the others keep their times\n\n", m.repo)
+	rows := []string{fmt.Sprintf("%s all %d unpushed commits (%d selected)", checkbox(selected == len(m.commits), selected > 0), len(m.commits), selected)}
+	for _, commit := range m.commits {
+		rows = append(rows, fmt.Sprintf("   %s %s %s (%s)", checkbox(!m.excluded[commit.Hash], false), commit.Hash, commit.Subject, commit.DateTime))
+	}
+
+	// Scroll the list so the cursor stays on screen
+	first := max(0, m.cursor-m.rows()+1)
+	for i := first; i < min(len(rows), first+m.rows()); i++ {
+		pointer := "  "
+		if i == m.cursor {
+			pointer = "> "
+		}
+		fmt.Fprintf(&b, "%s%s\n", pointer, rows[i])
+	}
+	b.WriteString("\n↑/↓ move • space toggle • a all • n none • enter preview plan • q quit\n")
+	return b.String()
+}
+
+// rows is how many list or plan lines fit on the screen between the header and the key help
+func (m selectModel) rows() int {
+	if m.height == 0 {
+		return 1 << 20
+	}
+	return max(1, m.height-4)
+}
+
+// checkbox draws a checkbox; partial marks a repository with only some of its commits selected
+func checkbox(checked, partial bool) string {
+	switch {
+	case checked:
+		return "[x]"
+	case partial:
+		return "[-]"
+	}
+	return "[ ]"
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
+)
+
+// pressKeys sends keys to a terminal UI model, one message per key
+func pressKeys[M tea.Model](m M, keys ...string) M {
+	for _, key := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		switch key {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "space":
+			msg = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		}
+		next, _ := m.Update(msg)
+		m = next.(M)
+	}
+	return m
+}
+
+func TestSelectModel(t *testing.T) {
+	commits := []git.Commit{{Hash: "c3", Subject: "Third"}, {Hash: "c2", Subject: "Second"}, {Hash: "c1", Subject: "First"}}
+	var previewed map[string]bool
+	preview := func(excluded map[string]bool) (cadence.Plan, error) {
+		previewed = excluded
+		return cadence.Plan{}, nil
+	}
+
+	// Deselect everything on the repository row, bring back the first two commits, then toggle the second off again
+	m := newSelectModel("repo", commits, preview)
+	m = pressKeys(m, "space", "j", "space", "j", "space", "space")
+	if len(m.excluded) != 2 || !m.excluded["c2"] || !m.excluded["c1"] {
+		t.Errorf("Expected c2 and c1 to be excluded, got %v", m.excluded)
+	}
+	if view := m.View(); !strings.Contains(view, "[-] all 3 unpushed commits (1 selected)") || !strings.Contains(view, "> ") {
+		t.Errorf("Expected a partly selected repository\nView:\n%s", view)
+	}
+
+	// The plan is previewed for the selection, and going back keeps it
+	m = pressKeys(m, "enter")
+	if !m.previewing || len(previewed) != 2 {
+		t.Fatalf("Expected the plan for the selection to be previewed, got %v", previewed)
+	}
+	if view := m.View(); !strings.Contains(view, "plan for 1 of 3 commits") {
+		t.Errorf("Expected the plan preview\nView:\n%s", view)
+	}
+	m = pressKeys(m, "b", "a", "enter", "y")
+	if !m.apply || len(previewed) != 0 {
+		t.Errorf("Expected every commit to be applied, got apply=%t excluded=%v", m.apply, previewed)
+	}
+
+	// Declining the plan skips the repository
+	m = pressKeys(newSelectModel("repo", commits, preview), "enter", "n")
+	if m.apply || m.quit {
+		t.Errorf("Expected the declined plan to skip the repository, got apply=%t quit=%t", m.apply, m.quit)
+	}
+
+	// Excluding the repository skips it without a plan
+	previewed = nil
+	m = pressKeys(newSelectModel("repo", commits, preview), "n", "enter")
+	if m.apply || m.previewing || previewed != nil {
+		t.Error("Expected an empty selection to skip the repository")
+	}
+
+	// A plan that can't be computed can't be applied
+	m = pressKeys(newSelectModel("repo", commits, func(map[string]bool) (cadence.Plan, error) {
+		return cadence.Plan{}, errors.New("no working days left")
+	}), "enter", "y")
+	if m.apply || !strings.Contains(m.View(), "no working days left") {
+		t.Errorf("Expected the error to be shown instead of applying\nView:\n%s", m.View())
+	}
+}
+
+func TestSelectCommitsQuit(t *testing.T) {
+	quit := false
+	s := newCommitSelector(strings.NewReader("q"), &strings.Builder{}, func() { quit = true })
+	_, apply, err := s.selectCommits(context.Background(), "repo", []git.Commit{{Hash: "c1"}}, func(map[string]bool) (cadence.Plan, error) {
+		return cadence.Plan{}, nil
+	})
+	if !errors.Is(err, errSelectionQuit) || apply || !quit {
+		t.Errorf("Expected quitting to stop the run, got apply=%t err=%v quit=%t", apply, err, quit)
+	}
+}
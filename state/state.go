@@ -0,0 +1,103 @@
+// Package state remembers per-repository information between runs.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RepoState is what is remembered about a single repository
+type RepoState struct {
+	// Head is the commit that was checked out when the repository was last processed
+	Head string `json:"head"`
+	// ProcessedAt is when the repository was last processed
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// Store is the set of remembered repositories, keyed by absolute repository path.
+// It is safe for concurrent use.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	Repos map[string]RepoState `json:"repos"`
+}
+
+// DefaultPath returns the per-user state file, e.g. ~/.cache/code-cadence/state.json
+func DefaultPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "code-cadence", "state.json"), nil
+}
+
+// Load reads the state file at path. A missing file yields an empty store.
+func Load(path string) (*Store, error) {
+	store := &Store{path: path, Repos: make(map[string]RepoState)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, err
+	}
+	if store.Repos == nil {
+		store.Repos = make(map[string]RepoState)
+	}
+
+	return store, nil
+}
+
+// Changed reports whether the repository's HEAD differs from the one recorded when it was last processed.
+// Repositories that were never processed are always considered changed.
+func (s *Store) Changed(repoPath string, head string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recorded, ok := s.Repos[key(repoPath)]
+	return !ok || recorded.Head != head
+}
+
+// MarkProcessed records head as the last processed HEAD of the repository
+func (s *Store) MarkProcessed(repoPath string, head string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Repos[key(repoPath)] = RepoState{Head: head, ProcessedAt: time.Now()}
+}
+
+// Save writes the store back to the file it was loaded from
+func (s *Store) Save() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	// Write atomically so an interrupted run never leaves a truncated file
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// key normalizes a repository path so the same repository is found regardless of how it was reached
+func key(repoPath string) string {
+	if abs, err := filepath.Abs(repoPath); err == nil {
+		return abs
+	}
+	return repoPath
+}
@@ -0,0 +1,37 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "state.json")
+
+	store, err := Load(path)
+	if err != nil {
+		t.Fatalf("Error loading missing state file: %v", err)
+	}
+	if !store.Changed("/work/repo", "abc") {
+		t.Error("Expected unknown repository to be reported as changed")
+	}
+
+	store.MarkProcessed("/work/repo", "abc")
+	if err := store.Save(); err != nil {
+		t.Fatalf("Error saving state: %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Error reloading state: %v", err)
+	}
+	if reloaded.Changed("/work/repo", "abc") {
+		t.Error("Expected repository with same HEAD to be unchanged")
+	}
+	if !reloaded.Changed("/work/repo", "def") {
+		t.Error("Expected repository with moved HEAD to be changed")
+	}
+	if reloaded.Repos["/work/repo"].ProcessedAt.IsZero() {
+		t.Error("Expected processed time to be recorded")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/egor-markin/code-cadence/backup"
+	"github.com/egor-markin/code-cadence/notify"
+)
+
+// Outcomes of a repository in a cadence run
+const (
+	outcomeUpdated   = "updated"
+	outcomeUnchanged = "unchanged"
+	outcomeFailed    = "failed"
+	outcomeTimedOut  = "timed_out"
+	outcomeSkipped   = "skipped"
+	// outcomeNotRun is a repository left alone because --fail-fast stopped the run before it
+	outcomeNotRun = "not_run"
+)
+
+// repoResult is what a cadence run did with a single repository
+type repoResult struct {
+	Repo     string
+	Outcome  string
+	Commits  int
+	Duration time.Duration
+	Err      error
+	// Backup is the backup made before the rewrite, if any
+	Backup backup.Backup
+}
+
+// cadenceSummary is the outcome of a cadence run over all repositories
+type cadenceSummary struct {
+	StartedAt   time.Time
+	Duration    time.Duration
+	Interrupted bool
+	Results     []repoResult
+}
+
+// Commits counts the commits updated across all repositories
+func (summary cadenceSummary) Commits() int {
+	commits := 0
+	for _, result := range summary.Results {
+		commits += result.Commits
+	}
+	return commits
+}
+
+// Backups counts the backups made during the run and the bytes they take
+func (summary cadenceSummary) Backups() (int, int64) {
+	count, size := 0, int64(0)
+	for _, result := range summary.Results {
+		if result.Backup.Path != "" {
+			count++
+			size += result.Backup.Size
+		}
+	}
+	return count, size
+}
+
+// Repos lists the repositories with the given outcome
+func (summary cadenceSummary) Repos(outcome string) []string {
+	var repos []string
+	for _, result := range summary.Results {
+		if result.Outcome == outcome {
+			repos = append(repos, result.Repo)
+		}
+	}
+	return repos
+}
+
+// reportCadence hands the summary of a finished cadence run to SUMMARY_FILE and the desktop notification
+func (b *batch) reportCadence(ctx context.Context, command string, summary cadenceSummary) {
+	if b.SummaryFile != "" {
+		if err := writeSummaryFile(expandHome(b.SummaryFile), command, summary); err != nil {
+			fmt.Printf("Warning: Failed to write run summary: %v\n", err)
+		}
+	}
+	b.notifyCadence(ctx, summary)
+}
+
+// notifyCadence sends a desktop notification about a finished run when NOTIFY is enabled and the run was started by
+// watch or took at least NOTIFY_MIN_DURATION. Interrupted runs are not reported.
+func (b *batch) notifyCadence(ctx context.Context, summary cadenceSummary) {
+	if !b.Notify || summary.Interrupted || (!b.watched && summary.Duration < b.NotifyMinDuration) {
+		return
+	}
+	title, message := summary.notification()
+	if err := notify.Send(ctx, title, message); err != nil {
+		fmt.Printf("Warning: Failed to send desktop notification: %v\n", err)
+	}
+}
+
+// notification returns the title and message of the desktop notification about the run
+func (summary cadenceSummary) notification() (string, string) {
+	failed, timedOut := summary.Repos(outcomeFailed), summary.Repos(outcomeTimedOut)
+
+	title := "Code Cadence: run finished"
+	if len(failed) > 0 || len(timedOut) > 0 {
+		title = "Code Cadence: run finished with problems"
+	}
+	message := fmt.Sprintf("Updated %d commits across %d repositories", summary.Commits(), len(summary.Repos(outcomeUpdated)))
+	if len(failed) > 0 {
+		message += fmt.Sprintf(", %d failed", len(failed))
+	}
+	if len(timedOut) > 0 {
+		message += fmt.Sprintf(", %d timed out", len(timedOut))
+	}
+	return title, message
+}
+
+// summaryFile is the JSON document SUMMARY_FILE receives after every cadence run
+type summaryFile struct {
+	Command        string              `json:"command"`
+	StartedAt      time.Time           `json:"started_at"`
+	DurationMs     int64               `json:"duration_ms"`
+	Interrupted    bool                `json:"interrupted"`
+	CommitsUpdated int                 `json:"commits_updated"`
+	ReposUpdated   int                 `json:"repositories_updated"`
+	ReposFailed    int                 `json:"repositories_failed"`
+	ReposTimedOut  int                 `json:"repositories_timed_out"`
+	BackupBytes    int64               `json:"backup_bytes"`
+	Repositories   []summaryFileResult `json:"repositories"`
+}
+
+// summaryFileResult is a repository in summaryFile
+type summaryFileResult struct {
+	Path           string `json:"path"`
+	Outcome        string `json:"outcome"`
+	CommitsUpdated int    `json:"commits_updated"`
+	DurationMs     int64  `json:"duration_ms"`
+	Error          string `json:"error,omitempty"`
+	Backup         string `json:"backup,omitempty"`
+	BackupBytes    int64  `json:"backup_bytes,omitempty"`
+}
+
+// writeSummaryFile writes the summary of a cadence run to path as JSON, replacing the summary of the previous run
+func writeSummaryFile(path string, command string, summary cadenceSummary) error {
+	doc := summaryFile{
+		Command:        command,
+		StartedAt:      summary.StartedAt,
+		DurationMs:     summary.Duration.Milliseconds(),
+		Interrupted:    summary.Interrupted,
+		CommitsUpdated: summary.Commits(),
+		ReposUpdated:   len(summary.Repos(outcomeUpdated)),
+		ReposFailed:    len(summary.Repos(outcomeFailed)),
+		ReposTimedOut:  len(summary.Repos(outcomeTimedOut)),
+		Repositories:   []summaryFileResult{},
+	}
+	_, doc.BackupBytes = summary.Backups()
+	for _, result := range summary.Results {
+		entry := summaryFileResult{
+			Path:           result.Repo,
+			Outcome:        result.Outcome,
+			CommitsUpdated: result.Commits,
+			DurationMs:     result.Duration.Milliseconds(),
+			Backup:         result.Backup.Path,
+			BackupBytes:    result.Backup.Size,
+		}
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		}
+		doc.Repositories = append(doc.Repositories, entry)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Write atomically so wrapper scripts never read a truncated file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
 	"time"
 
-	"code-cadence/git"
+	"github.com/egor-markin/code-cadence/cadence"
+	"github.com/egor-markin/code-cadence/git"
 )
 
 // TestHelper provides utilities for testing
@@ -135,7 +138,7 @@ func (th *TestHelper) CreateMergeCommit(repoPath, branchName, message string) {
 
 // GetCommits returns all commits in the repository
 func (th *TestHelper) GetCommits(repoPath string) []git.Commit {
-	commits, err := git.GetUnpushedCommits(repoPath, "origin/main")
+	commits, err := git.GetUnpushedCommits(context.Background(), repoPath, "origin/main")
 	if err != nil {
 		th.t.Fatalf("Failed to get commits: %v", err)
 	}
@@ -203,6 +206,29 @@ func (th *TestHelper) CreateTestCommits(repoPath string, count int, baseTime tim
 	return hashes
 }
 
+// CaptureOutput runs fn and returns everything it printed to stdout
+func (th *TestHelper) CaptureOutput(fn func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		th.t.Fatalf("Failed to create pipe: %v", err)
+	}
+
+	original := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = original }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+
+	fn()
+	writer.Close()
+
+	return <-output
+}
+
 // Cleanup removes the temporary directory
 func (th *TestHelper) Cleanup() {
 	os.RemoveAll(th.TempDir)
@@ -218,6 +244,7 @@ type TestConfig struct {
 	NewCommitAuthorEmail string
 	CreateBackup         bool
 	SkipWeekDays         string
+	MaxRewriteCommits    int
 }
 
 // DefaultTestConfig returns a default test configuration
@@ -231,23 +258,27 @@ func DefaultTestConfig() *TestConfig {
 		NewCommitAuthorEmail: "test@example.com",
 		CreateBackup:         false,
 		SkipWeekDays:         "Sat,Sun",
+		MaxRewriteCommits:    200,
 	}
 }
 
-// ApplyTestConfig applies the test configuration to global variables
-func (tc *TestConfig) ApplyTestConfig() {
-	WorkDayStartHour = tc.WorkDayStartHour
-	WorkDayEndHour = tc.WorkDayEndHour
-	JitterMinutes = tc.JitterMinutes
-	ParentGitBranchName = tc.ParentGitBranchName
-	NewCommitAuthorName = tc.NewCommitAuthorName
-	NewCommitAuthorEmail = tc.NewCommitAuthorEmail
-	CreateBackup = tc.CreateBackup
-	SkipWeekDays = tc.SkipWeekDays
-	skipWeekdaysSet = parseWeekdays(tc.SkipWeekDays)
+// Settings returns the settings loaded from the environment with the test configuration applied over them
+func (tc *TestConfig) Settings() *settings {
+	s := loadConfig()
+	s.WorkDayStartHour = tc.WorkDayStartHour
+	s.WorkDayEndHour = tc.WorkDayEndHour
+	s.JitterMinutes = tc.JitterMinutes
+	s.ParentGitBranchName = tc.ParentGitBranchName
+	s.NewCommitAuthorName = tc.NewCommitAuthorName
+	s.NewCommitAuthorEmail = tc.NewCommitAuthorEmail
+	s.CreateBackup = tc.CreateBackup
+	s.SkipWeekDays = tc.SkipWeekDays
+	s.skipWeekdays = cadence.ParseWeekdays(tc.SkipWeekDays)
+	s.MaxRewriteCommits = tc.MaxRewriteCommits
+	return s
 }
 
-// RestoreConfig restores the original configuration
-func (tc *TestConfig) RestoreConfig() {
-	loadConfig() // Reload from environment
+// Batch returns a batch that runs commands with the test configuration
+func (tc *TestConfig) Batch() *batch {
+	return &batch{settings: tc.Settings()}
 }
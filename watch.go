@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"time"
+)
+
+// CmdWatch reruns another command periodically until interrupted, reloading the configuration when it changes
+const CmdWatch = "watch"
+
+// configPollInterval is how often the configuration files are checked for changes while watching
+const configPollInterval = 2 * time.Second
+
+// configFileState identifies a version of a configuration file; a missing file has the zero value
+type configFileState struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// configFilesState records the current version of every .env location
+func configFilesState() map[string]configFileState {
+	files := make(map[string]configFileState, len(envFileLocations))
+	for _, location := range envFileLocations {
+		path := expandHome(location)
+		if info, err := os.Stat(path); err == nil {
+			files[path] = configFileState{ModTime: info.ModTime(), Size: info.Size()}
+		} else {
+			files[path] = configFileState{}
+		}
+	}
+	return files
+}
+
+// settingValues captures the effective value of every setting in cfg
+func settingValues(cfg *settings) map[string]string {
+	values := make(map[string]string, len(configSettings))
+	for _, setting := range configSettings {
+		values[setting.Key] = setting.Value(cfg)
+	}
+	return values
+}
+
+// reloadConfig loads the settings again and returns them with a description of every value that changed from cfg
+func reloadConfig(cfg *settings) (*settings, []string) {
+	before := settingValues(cfg)
+	reloaded := loadConfig()
+	after := settingValues(reloaded)
+
+	var changes []string
+	for _, setting := range configSettings {
+		if before[setting.Key] != after[setting.Key] {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", setting.Key, settingDisplayValue(setting.Key, before[setting.Key]), settingDisplayValue(setting.Key, after[setting.Key])))
+		}
+	}
+	return reloaded, changes
+}
+
+// watchLogf prints a timestamped daemon log line
+func watchLogf(format string, args ...any) {
+	fmt.Printf("[%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
+}
+
+// checkWatchConfig logs the problems of cfg and reports whether runs may continue.
+// A broken configuration pauses the daemon instead of rewriting history with it.
+func checkWatchConfig(cfg *settings) bool {
+	problems := cfg.validateConfig()
+	for _, problem := range problems {
+		watchLogf("❌ %s", problem)
+	}
+	if len(problems) > 0 {
+		watchLogf("⏸️  Runs are paused until the configuration is fixed")
+		return false
+	}
+	return true
+}
+
+// runWatch runs command on rootDir every WATCH_INTERVAL until ctx is cancelled, starting with the settings cfg.
+// Configuration files are polled and reloaded without restarting; the new settings apply from the next run.
+func runWatch(ctx context.Context, cfg *settings, command string, rootDir string) {
+	watchLogf("Watching %s: running %s every %s (Ctrl-C to stop)", rootDir, command, cfg.WatchInterval)
+
+	files := configFilesState()
+	healthy := checkWatchConfig(cfg)
+
+	var lastRun time.Time
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if current := configFilesState(); !maps.Equal(current, files) {
+			files = current
+			var changes []string
+			cfg, changes = reloadConfig(cfg)
+			if len(changes) == 0 {
+				watchLogf("Configuration files changed, settings are unchanged")
+			} else {
+				watchLogf("Configuration reloaded:")
+				for _, change := range changes {
+					fmt.Printf("   • %s\n", change)
+				}
+			}
+
+			wasHealthy := healthy
+			healthy = checkWatchConfig(cfg)
+			if healthy && !wasHealthy {
+				watchLogf("▶️  Configuration fixed, resuming runs")
+			}
+		}
+
+		if healthy && (lastRun.IsZero() || time.Since(lastRun) >= cfg.WatchInterval) {
+			watchLogf("Running %s", command)
+			if err := runCommand(ctx, &batch{settings: cfg, watched: true}, command, rootDir); err != nil {
+				watchLogf("❌ %s failed: %v", command, err)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			lastRun = time.Now()
+			watchLogf("Next run at %s", lastRun.Add(cfg.WatchInterval).Format("2006-01-02 15:04:05"))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
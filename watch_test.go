@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadConfig(t *testing.T) {
+	oldLocations := envFileLocations
+	defer func() {
+		envFileLocations = oldLocations
+	}()
+
+	t.Setenv("JITTER_MINUTES", "")
+	t.Setenv("WORK_DAY_START_HOUR", "")
+
+	envFile := filepath.Join(t.TempDir(), "watch.env")
+	os.WriteFile(envFile, []byte("JITTER_MINUTES=10\n"), 0644)
+	envFileLocations = []string{envFile}
+	cfg := loadConfig()
+
+	files := configFilesState()
+
+	// Rewrite the file with a different size and a later modification time
+	os.WriteFile(envFile, []byte("JITTER_MINUTES=25\nWORK_DAY_START_HOUR=8\n"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(envFile, later, later)
+
+	if current := configFilesState(); current[envFile] == files[envFile] {
+		t.Fatal("Expected file change to be detected")
+	}
+
+	cfg, changes := reloadConfig(cfg)
+	expected := []string{
+		"WORK_DAY_START_HOUR: 10 -> 8",
+		"JITTER_MINUTES: 10 -> 25",
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected changes %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected change %q, got %q", expected[i], changes[i])
+		}
+	}
+
+	if cfg.JitterMinutes != 25 || cfg.WorkDayStartHour != 8 {
+		t.Errorf("Expected reloaded settings to apply, got jitter=%d start=%d", cfg.JitterMinutes, cfg.WorkDayStartHour)
+	}
+
+	if _, changes := reloadConfig(cfg); len(changes) != 0 {
+		t.Errorf("Expected no changes on identical reload, got %v", changes)
+	}
+}
+
+func TestConfigFilesStateMissingFile(t *testing.T) {
+	oldLocations := envFileLocations
+	defer func() { envFileLocations = oldLocations }()
+
+	missing := filepath.Join(t.TempDir(), "missing.env")
+	envFileLocations = []string{missing}
+
+	before := configFilesState()
+	if state, ok := before[missing]; !ok || !state.ModTime.IsZero() {
+		t.Errorf("Expected missing file to be tracked with zero state, got %+v", state)
+	}
+
+	os.WriteFile(missing, []byte("JITTER_DAYS=false\n"), 0644)
+	if configFilesState()[missing] == before[missing] {
+		t.Error("Expected a newly created file to be detected")
+	}
+}